@@ -0,0 +1,326 @@
+// ABOUTME: Entry point for the Sendspin server CLI
+// ABOUTME: Streams a file, URL, test tone or piped PCM to players, with a TUI or streaming logs
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"syscall"
+
+	"github.com/Sendspin/sendspin-go/internal/metrics"
+	"github.com/Sendspin/sendspin-go/pkg/config"
+	"github.com/Sendspin/sendspin-go/pkg/sendspin"
+)
+
+// defaults supplies the flag defaults, so -help shows what applies
+// without a config file
+var defaults = config.Default().Server
+
+var (
+	configFile   = flag.String("config", "", "TOML config file; SENDSPIN_* environment variables override it, and command-line flags override both")
+	port         = flag.Int("port", defaults.Port, "WebSocket server port")
+	name         = flag.String("name", "", "Server friendly name (default: hostname-sendspin-server)")
+	audioSrc     = flag.String("audio", "", "Audio source: file path, http(s) URL, - for raw PCM on stdin (default: 440Hz test tone)")
+	pipeRate     = flag.Int("pipe-rate", defaults.PipeRate, "Sample rate of PCM read from stdin")
+	pipeChannels = flag.Int("pipe-channels", defaults.PipeChannels, "Channels of PCM read from stdin")
+	pipeBits     = flag.Int("pipe-bits", defaults.PipeBits, "Bit depth of little-endian PCM read from stdin (16, 24 or 32)")
+	codecs       = flag.String("codecs", strings.Join(defaults.Codecs, ","), "Codec preference, most preferred first (pcm, opus, flac)")
+	leadTime     = flag.Duration("lead-time", defaults.LeadTime, "How far ahead of playback audio is sent")
+	logFile      = flag.String("log-file", defaults.LogFile, "Log file path")
+	debug        = flag.Bool("debug", false, "Enable debug logging")
+	noMDNS       = flag.Bool("no-mdns", false, "Disable mDNS advertisement (clients must connect manually)")
+	noTUI        = flag.Bool("no-tui", false, "Disable TUI, use streaming logs instead")
+	streamLogs   = flag.Bool("stream-logs", false, "Alias for -no-tui")
+)
+
+// flagKeys maps flags onto the config keys they override
+var flagKeys = map[string]string{
+	"port":          "server.port",
+	"name":          "server.name",
+	"pipe-rate":     "server.pipe_rate",
+	"pipe-channels": "server.pipe_channels",
+	"pipe-bits":     "server.pipe_bits",
+	"codecs":        "server.codecs",
+	"lead-time":     "server.lead_time",
+	"log-file":      "server.log_file",
+	"debug":         "server.debug",
+}
+
+func main() {
+	flag.Parse()
+
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	serverConfig, err := cfg.ServerConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid configuration:\n%v\n", err)
+		os.Exit(1)
+	}
+
+	if serverConfig.Name == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			hostname = "unknown"
+		}
+		serverConfig.Name = hostname + "-sendspin-server"
+	}
+
+	// Set up logging
+	f, err := os.OpenFile(cfg.Server.LogFile, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		log.Fatalf("error opening log file: %v", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	if cfg.Server.TUI {
+		// TUI mode: log only to file
+		log.SetOutput(f)
+	} else {
+		// Streaming logs mode: log to both stdout and file
+		log.SetOutput(io.MultiWriter(os.Stdout, f))
+	}
+
+	sources, err := openSources(cfg.Server)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	serverConfig.Source = sources[0]
+
+	// The TUI follows the server's status changes
+	var tui *ServerTUI
+	if cfg.Server.TUI {
+		title, artist, album := sources[0].Metadata()
+		tui = NewServerTUI(sendspin.ServerStatus{Name: serverConfig.Name, Port: serverConfig.Port, Title: title, Artist: artist, Album: album})
+		serverConfig.OnStatusChange = tui.Update
+	}
+
+	server, err := sendspin.NewServer(serverConfig)
+	if err != nil {
+		closeSources(sources)
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	queueSources(server, sources[1:])
+	applyGroups(server, nil, cfg.Groups)
+
+	if cfg.Server.Metrics != "" {
+		metrics.Serve(cfg.Server.Metrics, server.MetricsHandler())
+	}
+
+	// Start server in goroutine
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- server.Start()
+	}()
+
+	var quit <-chan struct{}
+	if tui != nil {
+		quit = tui.QuitChan()
+		go func() {
+			if err := tui.Start(); err != nil {
+				log.Printf("TUI error: %v", err)
+			}
+		}()
+	} else {
+		log.Printf("Starting Sendspin Server: %s on port %d", serverConfig.Name, serverConfig.Port)
+		log.Printf("TUI disabled - logging to file for debugging")
+	}
+
+	// Handle shutdown, and reload the config on SIGHUP
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	hupChan := make(chan os.Signal, 1)
+	signal.Notify(hupChan, syscall.SIGHUP)
+
+wait:
+	for {
+		select {
+		case <-hupChan:
+			cfg = reload(server, cfg)
+		case <-quit:
+			log.Printf("Received quit signal from TUI")
+			break wait
+		case <-sigChan:
+			log.Printf("Shutdown signal received")
+			break wait
+		case err := <-errChan:
+			if tui != nil {
+				tui.Stop()
+			}
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if tui != nil {
+		tui.Stop()
+	}
+
+	server.Stop()
+	<-errChan
+
+	log.Printf("Server stopped")
+}
+
+// loadConfig reads the config file and environment, then applies the
+// flags given on the command line
+func loadConfig() (*config.Config, error) {
+	cfg, err := config.Load(*configFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var errs []error
+	flag.Visit(func(f *flag.Flag) {
+		var err error
+		switch f.Name {
+		case "audio":
+			// A URL may contain commas, so -audio is always one source
+			cfg.Server.Sources = nil
+			if *audioSrc != "" {
+				cfg.Server.Sources = []string{*audioSrc}
+			}
+		case "no-mdns":
+			err = cfg.Set("server.mdns", fmt.Sprint(!*noMDNS), "-no-mdns")
+		case "no-tui", "stream-logs":
+			err = cfg.Set("server.tui", "false", "-"+f.Name)
+		default:
+			if key, ok := flagKeys[f.Name]; ok {
+				err = cfg.Set(key, f.Value.String(), "-"+f.Name)
+			}
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+	})
+	if len(errs) > 0 {
+		return nil, errs[0]
+	}
+	return cfg, nil
+}
+
+// reload applies a changed config file on SIGHUP. The source list and
+// groups change while running; other changes need a restart. An invalid
+// config is reported and the current settings kept.
+func reload(server *sendspin.Server, old *config.Config) *config.Config {
+	log.Printf("Reloading configuration")
+	cfg, err := loadConfig()
+	if err == nil {
+		_, err = cfg.ServerConfig()
+	}
+	if err != nil {
+		log.Printf("Config reload failed, keeping the current settings: %v", err)
+		return old
+	}
+
+	for _, key := range config.Changed(old, cfg) {
+		switch {
+		case key == "server.sources":
+			if slices.Contains(old.Server.Sources, "-") || slices.Contains(cfg.Server.Sources, "-") {
+				log.Printf("Restart to change sources reading from stdin")
+				cfg.Server.Sources = old.Server.Sources
+				continue
+			}
+			sources, err := openSources(cfg.Server)
+			if err != nil {
+				log.Printf("Keeping the current sources: %v", err)
+				cfg.Server.Sources = old.Server.Sources
+				continue
+			}
+			server.ClearQueue()
+			if err := server.SetSource(sources[0]); err != nil {
+				log.Printf("Failed to change source: %v", err)
+				closeSources(sources)
+				cfg.Server.Sources = old.Server.Sources
+				continue
+			}
+			queueSources(server, sources[1:])
+			log.Printf("Sources changed: %v", cfg.Server.Sources)
+		case key == "groups":
+			applyGroups(server, old.Groups, cfg.Groups)
+			log.Printf("Groups changed")
+		case strings.HasPrefix(key, "server.") || strings.HasPrefix(key, "auth.") || strings.HasPrefix(key, "tls."):
+			log.Printf("Setting %s changed; restart the server to apply it", key)
+		}
+	}
+	return cfg
+}
+
+// openSources opens the configured sources, or a test tone if there are
+// none. On error none are left open.
+func openSources(s config.Server) ([]sendspin.AudioSource, error) {
+	if len(s.Sources) == 0 {
+		return []sendspin.AudioSource{sendspin.NewTestTone(0, 0)}, nil
+	}
+
+	var sources []sendspin.AudioSource
+	for _, spec := range s.Sources {
+		source, err := openSource(spec, s)
+		if err != nil {
+			closeSources(sources)
+			return nil, err
+		}
+		sources = append(sources, source)
+	}
+	return sources, nil
+}
+
+// openSource opens one source: "-" for stdin, an http(s) URL or a file
+func openSource(spec string, s config.Server) (sendspin.AudioSource, error) {
+	switch {
+	case spec == "-":
+		return sendspin.NewPipeSource(os.Stdin, s.PipeRate, s.PipeChannels, s.PipeBits)
+	case strings.HasPrefix(spec, "http://") || strings.HasPrefix(spec, "https://"):
+		return sendspin.NewURLSource(spec)
+	default:
+		return sendspin.NewFileSource(spec)
+	}
+}
+
+// queueSources queues sources to play after the current one
+func queueSources(server *sendspin.Server, sources []sendspin.AudioSource) {
+	for i, source := range sources {
+		if err := server.Enqueue(source); err != nil {
+			log.Printf("Failed to queue source: %v", err)
+			closeSources(sources[i:])
+			return
+		}
+	}
+}
+
+func closeSources(sources []sendspin.AudioSource) {
+	for _, source := range sources {
+		source.Close()
+	}
+}
+
+// applyGroups assigns clients to the configured groups, clearing the
+// group of clients no longer listed
+func applyGroups(server *sendspin.Server, old, groups map[string][]string) {
+	for group, ids := range old {
+		for _, id := range ids {
+			if !slices.Contains(groups[group], id) {
+				if err := server.SetClientGroup(id, ""); err != nil {
+					log.Printf("Failed to clear group of %s: %v", id, err)
+				}
+			}
+		}
+	}
+	for group, ids := range groups {
+		for _, id := range ids {
+			if err := server.SetClientGroup(id, group); err != nil {
+				log.Printf("Failed to put %s in group %s: %v", id, group, err)
+			}
+		}
+	}
+}
@@ -1,12 +1,14 @@
 // ABOUTME: Server TUI for displaying connected clients and stats
 // ABOUTME: Real-time server status display using bubbletea
-package server
+package main
 
 import (
 	"fmt"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/Sendspin/sendspin-go/pkg/sendspin"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 )
@@ -14,37 +16,24 @@ import (
 // ServerTUI manages the server TUI
 type ServerTUI struct {
 	program  *tea.Program
-	updates  chan ServerStatus
+	updates  chan sendspin.ServerStatus
 	quitChan chan struct{} // Signal to stop the server
-}
-
-// ServerStatus holds server state for TUI
-type ServerStatus struct {
-	Name       string
-	Port       int
-	Uptime     time.Duration
-	Clients    []ClientInfo
-	AudioTitle string
-}
 
-// ClientInfo holds client information for display
-type ClientInfo struct {
-	Name  string
-	ID    string
-	Codec string
-	State string
+	// Guards updates against sends after Stop closes it
+	mu      sync.Mutex
+	stopped bool
 }
 
 // tuiModel is the bubbletea model for server TUI
 type tuiModel struct {
-	status    ServerStatus
+	status    sendspin.ServerStatus
 	startTime time.Time
 	quitting  bool
 	quitChan  chan struct{} // Channel to signal server stop
 }
 
 type tickMsg time.Time
-type statusMsg ServerStatus
+type statusMsg sendspin.ServerStatus
 
 func (m tuiModel) Init() tea.Cmd {
 	return tea.Batch(
@@ -75,7 +64,7 @@ func (m tuiModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		return m, tickEvery()
 
 	case statusMsg:
-		m.status = ServerStatus(msg)
+		m.status = sendspin.ServerStatus(msg)
 		return m, nil
 	}
 
@@ -126,7 +115,7 @@ func (m tuiModel) View() string {
 	b.WriteString("\n")
 
 	b.WriteString(headerStyle.Render("Playing: "))
-	b.WriteString(valueStyle.Render(m.status.AudioTitle))
+	b.WriteString(valueStyle.Render(audioTitle(m.status)))
 	b.WriteString("\n\n")
 
 	// Connected clients
@@ -150,35 +139,26 @@ func (m tuiModel) View() string {
 	return b.String()
 }
 
-// NewServerTUI creates a new server TUI
-func NewServerTUI(serverName string, port int) *ServerTUI {
-	return &ServerTUI{
-		updates:  make(chan ServerStatus, 10),
+// NewServerTUI creates a server TUI showing the given initial status
+func NewServerTUI(status sendspin.ServerStatus) *ServerTUI {
+	t := &ServerTUI{
+		updates:  make(chan sendspin.ServerStatus, 10),
 		quitChan: make(chan struct{}, 1),
 	}
-}
-
-// Start starts the TUI
-func (t *ServerTUI) Start(serverName string, port int) error {
-	m := tuiModel{
-		status: ServerStatus{
-			Name:       serverName,
-			Port:       port,
-			AudioTitle: "Initializing...",
-			Clients:    []ClientInfo{},
-		},
+	t.program = tea.NewProgram(tuiModel{
+		status:    status,
 		startTime: time.Now(),
 		quitChan:  t.quitChan,
-	}
-
-	t.program = tea.NewProgram(m, tea.WithAltScreen())
+	}, tea.WithAltScreen())
+	return t
+}
 
+// Start runs the TUI until it quits
+func (t *ServerTUI) Start() error {
 	// Start listening for updates in a goroutine
 	go func() {
 		for status := range t.updates {
-			if t.program != nil {
-				t.program.Send(statusMsg(status))
-			}
+			t.program.Send(statusMsg(status))
 		}
 	}()
 
@@ -187,7 +167,13 @@ func (t *ServerTUI) Start(serverName string, port int) error {
 }
 
 // Update sends a status update to the TUI
-func (t *ServerTUI) Update(status ServerStatus) {
+func (t *ServerTUI) Update(status sendspin.ServerStatus) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.stopped {
+		return
+	}
+
 	select {
 	case t.updates <- status:
 	default:
@@ -197,9 +183,14 @@ func (t *ServerTUI) Update(status ServerStatus) {
 
 // Stop stops the TUI
 func (t *ServerTUI) Stop() {
-	if t.program != nil {
-		t.program.Quit()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.stopped {
+		return
 	}
+	t.stopped = true
+
+	t.program.Quit()
 	close(t.updates)
 }
 
@@ -207,3 +198,11 @@ func (t *ServerTUI) Stop() {
 func (t *ServerTUI) QuitChan() <-chan struct{} {
 	return t.quitChan
 }
+
+// audioTitle names the source playing as "artist - title"
+func audioTitle(status sendspin.ServerStatus) string {
+	if status.Artist != "" {
+		return status.Artist + " - " + status.Title
+	}
+	return status.Title
+}
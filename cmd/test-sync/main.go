@@ -1,18 +1,21 @@
-// ABOUTME: Test app to verify clock sync workaround
-// ABOUTME: Fakes monotonic clock sync by pretending to match server uptime
+// ABOUTME: Test app to verify clock sync against a server
+// ABOUTME: Connects a player with a capture output and reports sync RTT, quality and chunk timing
 package main
 
 import (
 	"flag"
 	"fmt"
 	"log"
+	"time"
 
-	"github.com/Sendspin/sendspin-go/internal/app"
+	"github.com/Sendspin/sendspin-go/pkg/audio/output"
+	"github.com/Sendspin/sendspin-go/pkg/sendspin"
 )
 
 var (
 	serverAddr = flag.String("server", "localhost:8927", "Server address")
 	name       = flag.String("name", "test-sync", "Player name")
+	duration   = flag.Duration("duration", 10*time.Second, "How long to watch sync")
 )
 
 func main() {
@@ -23,27 +26,41 @@ func main() {
 	fmt.Println("=== Clock Sync Test App ===")
 	fmt.Println("This test will:")
 	fmt.Println("1. Connect to the server")
-	fmt.Println("2. Perform time sync with FAKE timestamps")
-	fmt.Println("3. Match server's monotonic clock by adding offset to our timestamps")
+	fmt.Println("2. Perform time sync against the server's monotonic clock")
+	fmt.Println("3. Report round-trip time, sync quality and chunk counts every second")
 	fmt.Println()
 
-	// Strategy: We'll intercept time sync and add a fixed offset to our
-	// timestamps to make them match the server's monotonic clock range
-
-	config := app.Config{
+	// Audio is captured rather than played, so no output device is needed
+	player, err := sendspin.NewPlayer(sendspin.PlayerConfig{
 		ServerAddr: *serverAddr,
-		Name:       *name,
+		PlayerName: *name,
 		BufferMs:   150,
+		Output:     output.NewCapture(),
+	})
+	if err != nil {
+		log.Fatalf("Failed to create player: %v", err)
 	}
-
-	player := app.New(config)
+	defer player.Close()
 
 	fmt.Printf("Connecting to %s as '%s'...\n", *serverAddr, *name)
 
-	// Start player (this will do time sync automatically)
-	if err := player.Start(); err != nil {
+	if err := player.Connect(); err != nil {
 		log.Fatalf("Player error: %v", err)
 	}
 
-	log.Printf("Test complete")
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	deadline := time.After(*duration)
+
+	for {
+		select {
+		case <-ticker.C:
+			stats := player.Stats()
+			log.Printf("rtt=%dµs quality=%d received=%d played=%d dropped=%d buffer=%dms",
+				stats.SyncRTT, stats.SyncQuality, stats.Received, stats.Played, stats.Dropped, stats.BufferDepth)
+		case <-deadline:
+			log.Printf("Test complete")
+			return
+		}
+	}
 }
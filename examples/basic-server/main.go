@@ -19,6 +19,7 @@ func main() {
 	sampleRate := flag.Int("rate", 192000, "Sample rate (Hz)")
 	channels := flag.Int("channels", 2, "Number of channels")
 	enableMDNS := flag.Bool("mdns", true, "Enable mDNS service advertisement")
+	adopt := flag.Bool("adopt", false, "Connect to players advertising on the network (requires -mdns)")
 	flag.Parse()
 
 	log.Printf("Creating test tone source: %dHz, %d channels", *sampleRate, *channels)
@@ -34,6 +35,9 @@ func main() {
 		EnableMDNS: *enableMDNS,
 		Debug:      false,
 	}
+	if *adopt {
+		config.Adopt = sendspin.AdoptAll
+	}
 
 	// Create server
 	server, err := sendspin.NewServer(config)
@@ -0,0 +1,21 @@
+// ABOUTME: Serves /metrics for the server and player binaries
+// ABOUTME: Runs a handler on its own HTTP address, apart from the protocol port
+package metrics
+
+import (
+	"log"
+	"net/http"
+)
+
+// Serve serves handler at /metrics on addr in the background, logging
+// if the address can't be served
+func Serve(addr string, handler http.Handler) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", handler)
+	go func() {
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			log.Printf("Metrics server failed: %v", err)
+		}
+	}()
+	log.Printf("Serving metrics on %s/metrics", addr)
+}
@@ -0,0 +1,49 @@
+// ABOUTME: Tests for serving /metrics
+// ABOUTME: Checks the handler answers at /metrics and nowhere else
+package metrics
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestServe(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to find a free port: %v", err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	Serve(addr, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "sendspin_up 1\n")
+	}))
+
+	var resp *http.Response
+	for deadline := time.Now().Add(3 * time.Second); ; {
+		if resp, err = http.Get("http://" + addr + "/metrics"); err == nil || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("failed to get /metrics: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "sendspin_up 1\n" {
+		t.Errorf("unexpected metrics %q", body)
+	}
+
+	resp, err = http.Get("http://" + addr + "/")
+	if err != nil {
+		t.Fatalf("failed to get /: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 outside /metrics, got %d", resp.StatusCode)
+	}
+}
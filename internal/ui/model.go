@@ -5,8 +5,10 @@ package ui
 import (
 	"fmt"
 	"strings"
+	"time"
 
-	"github.com/Sendspin/sendspin-go/internal/sync"
+	"github.com/Sendspin/sendspin-go/pkg/audio"
+	"github.com/Sendspin/sendspin-go/pkg/sync"
 	tea "github.com/charmbracelet/bubbletea"
 )
 
@@ -16,6 +18,11 @@ type Model struct {
 	connected  bool
 	serverName string
 
+	// Server picker
+	servers []ServerEntry
+	picking bool
+	cursor  int
+
 	// Sync
 	syncOffset  int64
 	syncRTT     int64
@@ -33,6 +40,10 @@ type Model struct {
 	album       string
 	artworkPath string
 
+	// Track progress
+	position time.Duration
+	duration time.Duration
+
 	// Playback
 	state  string
 	volume int
@@ -50,6 +61,14 @@ type Model struct {
 	memAlloc   uint64
 	memSys     uint64
 
+	// Output device health (debug view)
+	underruns        int64
+	overruns         int64
+	reprimes         int64
+	outputLatency    time.Duration
+	callbackInterval time.Duration
+	maxCallback      time.Duration
+
 	// Dimensions
 	width  int
 	height int
@@ -86,6 +105,9 @@ func (m Model) View() string {
 
 	s := ""
 	s += m.renderHeader()
+	if m.picking {
+		return s + m.renderPicker()
+	}
 	s += m.renderStreamInfo()
 	s += m.renderControls()
 	s += m.renderStats()
@@ -156,6 +178,17 @@ func (m Model) renderStreamInfo() string {
 		if m.artworkPath != "" {
 			s += fmt.Sprintf("│   Art:    %-*s │\n", innerWidth-10, truncate(m.artworkPath, metaWidth))
 		}
+		if m.duration > 0 {
+			timeStr := fmt.Sprintf("%s / %s", formatTrackTime(m.position), formatTrackTime(m.duration))
+			barWidth := metaWidth - len(timeStr) - 1
+			if barWidth > 30 {
+				barWidth = 30
+			}
+			if barWidth > 0 {
+				timeStr = renderBar(int(m.position/time.Second), int(m.duration/time.Second), barWidth) + " " + timeStr
+			}
+			s += fmt.Sprintf("│   Time:   %-*s │\n", innerWidth-10, timeStr)
+		}
 	} else {
 		s += fmt.Sprintf("│   %-*s │\n", innerWidth-3, "(No metadata)")
 	}
@@ -217,13 +250,45 @@ func (m Model) renderHelp() string {
 	}
 	innerWidth := width - 4
 
-	helpStr := "↑/↓:Volume  m:Mute  r:Reconnect  d:Debug  q:Quit"
+	helpStr := "↑/↓:Volume  m:Mute  s:Servers  r:Reconnect  d:Debug  q:Quit"
 	helpLine := fmt.Sprintf("│ %-*s │\n", innerWidth, helpStr)
 	bottom := "└" + repeatString("─", width-2) + "┘\n"
 
 	return helpLine + bottom
 }
 
+// renderPicker renders the server list in place of the player view
+func (m Model) renderPicker() string {
+	width := m.width
+	if width < 60 {
+		width = 60
+	}
+	innerWidth := width - 4
+
+	s := fmt.Sprintf("│ %-*s │\n", innerWidth, "Servers:")
+	if len(m.servers) == 0 {
+		s += fmt.Sprintf("│   %-*s │\n", innerWidth-2, "(searching...)")
+	}
+	for i, server := range m.servers {
+		pointer := "  "
+		if i == m.cursor {
+			pointer = "> "
+		}
+		label := server.Name
+		if server.Addr != "" && server.Addr != server.Name {
+			label += " (" + server.Addr + ")"
+		}
+		if server.Current {
+			label += " *"
+		}
+		s += fmt.Sprintf("│ %s%-*s │\n", pointer, innerWidth-2, truncate(label, innerWidth-2))
+	}
+
+	helpLine := fmt.Sprintf("│ %-*s │\n", innerWidth, "↑/↓:Select  enter:Connect  esc:Back  (* connected)")
+	bottom := "└" + repeatString("─", width-2) + "┘\n"
+	return s + helpLine + bottom
+}
+
 // renderDebug renders debug information
 func (m Model) renderDebug() string {
 	width := m.width
@@ -242,12 +307,26 @@ func (m Model) renderDebug() string {
 	memLine := fmt.Sprintf("│ %-*s │\n", innerWidth, memStr)
 	clockStr := fmt.Sprintf("  Clock Offset: %+dμs", m.syncOffset)
 	clockLine := fmt.Sprintf("│ %-*s │\n", innerWidth, clockStr)
+	outputStr := fmt.Sprintf("  Output: latency %s  callback %s (max %s)",
+		formatMs(m.outputLatency), formatMs(m.callbackInterval), formatMs(m.maxCallback))
+	outputLine := fmt.Sprintf("│ %-*s │\n", innerWidth, outputStr)
+	xrunStr := fmt.Sprintf("  Underruns: %d  Overruns: %d  Re-primes: %d", m.underruns, m.overruns, m.reprimes)
+	xrunLine := fmt.Sprintf("│ %-*s │\n", innerWidth, xrunStr)
+
+	return debugTitle + goroutineLine + memLine + clockLine + outputLine + xrunLine
+}
 
-	return debugTitle + goroutineLine + memLine + clockLine
+// formatMs formats a duration as milliseconds with one decimal
+func formatMs(d time.Duration) string {
+	return fmt.Sprintf("%.1fms", float64(d)/float64(time.Millisecond))
 }
 
 // handleKey handles keyboard input
 func (m Model) handleKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	if m.picking {
+		return m.handlePickerKey(msg)
+	}
+
 	switch msg.String() {
 	case "q", "ctrl+c":
 		// Send quit signal to player
@@ -301,6 +380,44 @@ func (m Model) handleKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		}
 	case "d":
 		m.showDebug = !m.showDebug
+	case "s":
+		m.picking = true
+		m.cursor = 0
+	}
+
+	return m, nil
+}
+
+// handlePickerKey handles keyboard input while the server list is shown
+func (m Model) handlePickerKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "ctrl+c":
+		m.picking = false
+		return m.handleKey(msg)
+	case "up":
+		if m.cursor > 0 {
+			m.cursor--
+		}
+	case "down":
+		if m.cursor < len(m.servers)-1 {
+			m.cursor++
+		}
+	case "enter":
+		if m.cursor < len(m.servers) && m.volumeCtrl != nil {
+			server := m.servers[m.cursor]
+			target := server.ID
+			if target == "" {
+				target = server.Addr
+			}
+			select {
+			case m.volumeCtrl.ServerSelect <- target:
+			default:
+				// A switch is already pending
+			}
+		}
+		m.picking = false
+	case "esc", "s", "q":
+		m.picking = false
 	}
 
 	return m, nil
@@ -314,6 +431,12 @@ func (m *Model) applyStatus(msg StatusMsg) {
 	if msg.ServerName != "" {
 		m.serverName = msg.ServerName
 	}
+	if msg.Servers != nil {
+		m.servers = msg.Servers
+		if m.cursor >= len(m.servers) {
+			m.cursor = max(len(m.servers)-1, 0)
+		}
+	}
 	// Sync stats are always applied when sent (offset can be 0 for perfect sync)
 	if msg.SyncOffset != 0 || msg.SyncRTT != 0 {
 		m.syncOffset = msg.SyncOffset
@@ -334,11 +457,18 @@ func (m *Model) applyStatus(msg StatusMsg) {
 	if msg.ArtworkPath != "" {
 		m.artworkPath = msg.ArtworkPath
 	}
+	if msg.TrackDuration != 0 {
+		m.position = msg.TrackPosition
+		m.duration = msg.TrackDuration
+	}
 	// Volume is always applied when explicitly sent (can be 0 for silent)
 	// We rely on caller not sending Volume=0 in messages unless it's intentional
 	if msg.Volume != 0 {
 		m.volume = msg.Volume
 	}
+	if msg.Muted != nil {
+		m.muted = *msg.Muted
+	}
 	// Always apply stats - they can legitimately be zero
 	m.received = msg.Received
 	m.played = msg.Played
@@ -347,6 +477,12 @@ func (m *Model) applyStatus(msg StatusMsg) {
 	m.goroutines = msg.Goroutines
 	m.memAlloc = msg.MemAlloc
 	m.memSys = msg.MemSys
+	m.underruns = msg.Underruns
+	m.overruns = msg.Overruns
+	m.reprimes = msg.Reprimes
+	m.outputLatency = msg.OutputLatency
+	m.callbackInterval = msg.CallbackInterval
+	m.maxCallback = msg.MaxCallbackInterval
 }
 
 // StatusMsg updates TUI state
@@ -365,6 +501,15 @@ type StatusMsg struct {
 	Album       string
 	ArtworkPath string
 	Volume      int
+	Muted       *bool
+
+	// Servers replaces the server list when non-nil
+	Servers []ServerEntry
+
+	// Track progress (applied when TrackDuration is non-zero)
+	TrackPosition time.Duration
+	TrackDuration time.Duration
+
 	Received    int64
 	Played      int64
 	Dropped     int64
@@ -372,6 +517,22 @@ type StatusMsg struct {
 	Goroutines  int
 	MemAlloc    uint64
 	MemSys      uint64
+
+	// Output device health
+	Underruns           int64
+	Overruns            int64
+	Reprimes            int64
+	OutputLatency       time.Duration
+	CallbackInterval    time.Duration
+	MaxCallbackInterval time.Duration
+}
+
+// ServerEntry is a server shown in the server picker
+type ServerEntry struct {
+	ID      string
+	Name    string
+	Addr    string
+	Current bool
 }
 
 // VolumeChangeMsg requests a volume change
@@ -396,11 +557,24 @@ func truncate(s string, length int) string {
 	return s[:length-3] + "..."
 }
 
+// formatTrackTime formats a track position as m:ss (or h:mm:ss)
+func formatTrackTime(d time.Duration) string {
+	secs := int(d / time.Second)
+	if secs >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", secs/3600, (secs/60)%60, secs%60)
+	}
+	return fmt.Sprintf("%d:%02d", secs/60, secs%60)
+}
+
 func channelName(channels int) string {
-	if channels == 1 {
+	switch channels {
+	case 1:
 		return "Mono"
+	case 2:
+		return "Stereo"
+	default:
+		return audio.LayoutName(channels)
 	}
-	return "Stereo"
 }
 
 func repeatString(s string, count int) string {
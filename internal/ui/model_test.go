@@ -3,9 +3,12 @@
 package ui
 
 import (
+	"strings"
 	"testing"
+	"time"
 
-	"github.com/Sendspin/sendspin-go/internal/sync"
+	"github.com/Sendspin/sendspin-go/pkg/sync"
+	tea "github.com/charmbracelet/bubbletea"
 )
 
 func TestNewModel(t *testing.T) {
@@ -307,9 +310,10 @@ func TestChannelNameFunction(t *testing.T) {
 	}{
 		{1, "Mono"},
 		{2, "Stereo"},
-		{3, "Stereo"}, // Function only distinguishes 1 vs other
-		{6, "Stereo"},
-		{0, "Stereo"},
+		{3, "3.0"},
+		{6, "5.1"},
+		{8, "7.1"},
+		{0, "0ch"},
 	}
 
 	for _, tt := range tests {
@@ -370,3 +374,139 @@ func TestMetadataClearing(t *testing.T) {
 // NOTE: TestConcurrentStatusUpdates was removed because Bubble Tea
 // guarantees sequential Update() calls - the Model is never accessed
 // concurrently in real usage, so testing concurrent access is unrealistic.
+
+func TestStatusMsgTrackProgress(t *testing.T) {
+	model := NewModel(nil)
+
+	model.applyStatus(StatusMsg{
+		TrackPosition: 83 * time.Second,
+		TrackDuration: 296 * time.Second,
+	})
+
+	if model.position != 83*time.Second {
+		t.Errorf("expected position 83s, got %v", model.position)
+	}
+	if model.duration != 296*time.Second {
+		t.Errorf("expected duration 296s, got %v", model.duration)
+	}
+
+	// Messages without a duration leave progress untouched
+	model.applyStatus(StatusMsg{Received: 10})
+	if model.duration != 296*time.Second {
+		t.Errorf("expected duration to be preserved, got %v", model.duration)
+	}
+}
+
+func TestFormatTrackTime(t *testing.T) {
+	tests := []struct {
+		input    time.Duration
+		expected string
+	}{
+		{0, "0:00"},
+		{83 * time.Second, "1:23"},
+		{296*time.Second + 900*time.Millisecond, "4:56"},
+		{3723 * time.Second, "1:02:03"},
+	}
+
+	for _, tt := range tests {
+		if result := formatTrackTime(tt.input); result != tt.expected {
+			t.Errorf("formatTrackTime(%v) = %q, expected %q", tt.input, result, tt.expected)
+		}
+	}
+}
+
+func TestStatusMsgOutputStats(t *testing.T) {
+	model := NewModel(nil)
+	model.showDebug = true
+
+	model.applyStatus(StatusMsg{
+		Underruns:           3,
+		Overruns:            1,
+		Reprimes:            2,
+		OutputLatency:       42500 * time.Microsecond,
+		CallbackInterval:    10 * time.Millisecond,
+		MaxCallbackInterval: 35 * time.Millisecond,
+	})
+
+	if model.underruns != 3 || model.overruns != 1 || model.reprimes != 2 {
+		t.Errorf("expected 3 underruns, 1 overrun, 2 re-primes, got %d, %d, %d",
+			model.underruns, model.overruns, model.reprimes)
+	}
+
+	debug := model.renderDebug()
+	for _, want := range []string{"latency 42.5ms", "callback 10.0ms (max 35.0ms)", "Underruns: 3  Overruns: 1  Re-primes: 2"} {
+		if !strings.Contains(debug, want) {
+			t.Errorf("expected debug view to contain %q, got:\n%s", want, debug)
+		}
+	}
+}
+
+func TestServerPicker(t *testing.T) {
+	volCtrl := NewVolumeControl()
+	model := NewModel(volCtrl)
+	model.width = 80
+
+	model.applyStatus(StatusMsg{Servers: []ServerEntry{
+		{ID: "id-den", Name: "Den", Addr: "10.0.0.6:8927", Current: true},
+		{Name: "10.0.0.7:8927", Addr: "10.0.0.7:8927"},
+	}})
+
+	press := func(key tea.KeyMsg) {
+		updated, _ := model.handleKey(key)
+		model = updated.(Model)
+	}
+	press(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("s")})
+	if !model.picking {
+		t.Fatal("expected s to open the server list")
+	}
+
+	view := model.View()
+	for _, want := range []string{"> Den (10.0.0.6:8927) *", "  10.0.0.7:8927"} {
+		if !strings.Contains(view, want) {
+			t.Errorf("expected picker to contain %q, got:\n%s", want, view)
+		}
+	}
+
+	// Arrows move the selection rather than the volume
+	press(tea.KeyMsg{Type: tea.KeyDown})
+	press(tea.KeyMsg{Type: tea.KeyDown})
+	if model.cursor != 1 || model.volume != 100 {
+		t.Errorf("expected cursor 1 and volume unchanged, got %d and %d", model.cursor, model.volume)
+	}
+
+	// A server without an ID is selected by address
+	press(tea.KeyMsg{Type: tea.KeyEnter})
+	if model.picking {
+		t.Error("expected enter to close the server list")
+	}
+	select {
+	case target := <-volCtrl.ServerSelect:
+		if target != "10.0.0.7:8927" {
+			t.Errorf("expected address selected, got %q", target)
+		}
+	default:
+		t.Error("expected a server selection")
+	}
+
+	press(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("s")})
+	press(tea.KeyMsg{Type: tea.KeyEnter})
+	if target := <-volCtrl.ServerSelect; target != "id-den" {
+		t.Errorf("expected server selected by ID, got %q", target)
+	}
+}
+
+func TestStatusMsgMuted(t *testing.T) {
+	model := NewModel(nil)
+
+	muted := true
+	model.applyStatus(StatusMsg{Muted: &muted})
+	if !model.muted {
+		t.Error("expected muted after status update")
+	}
+
+	// Messages without Muted leave it alone
+	model.applyStatus(StatusMsg{Volume: 40})
+	if !model.muted || model.volume != 40 {
+		t.Errorf("expected muted at 40%%, got muted=%v volume=%d", model.muted, model.volume)
+	}
+}
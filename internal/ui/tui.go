@@ -10,13 +10,18 @@ import (
 type VolumeControl struct {
 	Changes chan VolumeChangeMsg
 	Quit    chan QuitMsg
+
+	// ServerSelect carries the server picked in the server list (its ID,
+	// or address when it has none)
+	ServerSelect chan string
 }
 
 // NewVolumeControl creates a new volume control handler
 func NewVolumeControl() *VolumeControl {
 	return &VolumeControl{
-		Changes: make(chan VolumeChangeMsg, 10),
-		Quit:    make(chan QuitMsg, 1),
+		Changes:      make(chan VolumeChangeMsg, 10),
+		Quit:         make(chan QuitMsg, 1),
+		ServerSelect: make(chan string, 1),
 	}
 }
 
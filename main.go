@@ -3,6 +3,7 @@
 package main
 
 import (
+	"cmp"
 	"flag"
 	"fmt"
 	"io"
@@ -10,35 +11,108 @@ import (
 	"os"
 	"os/signal"
 	"runtime"
+	"strings"
 	"syscall"
 	"time"
 
-	"github.com/Sendspin/sendspin-go/internal/discovery"
-	internalsync "github.com/Sendspin/sendspin-go/internal/sync"
+	"github.com/Sendspin/sendspin-go/internal/artwork"
+	"github.com/Sendspin/sendspin-go/internal/metrics"
 	"github.com/Sendspin/sendspin-go/internal/ui"
 	"github.com/Sendspin/sendspin-go/internal/version"
+	"github.com/Sendspin/sendspin-go/pkg/audio/output"
+	"github.com/Sendspin/sendspin-go/pkg/config"
+	"github.com/Sendspin/sendspin-go/pkg/discovery"
 	"github.com/Sendspin/sendspin-go/pkg/sendspin"
 	tea "github.com/charmbracelet/bubbletea"
 )
 
+// defaults supplies the flag defaults, so -help shows what applies
+// without a config file
+var defaults = config.Default().Player
+
 var (
+	configFile = flag.String("config", "", "TOML config file; SENDSPIN_* environment variables override it, and command-line flags override both")
 	serverAddr = flag.String("server", "", "Manual server address (skip mDNS)")
-	port       = flag.Int("port", 8927, "Port for mDNS advertisement")
-	name       = flag.String("name", "", "Player friendly name (default: hostname-sendspin-player)")
-	bufferMs   = flag.Int("buffer-ms", 150, "Jitter buffer size in milliseconds")
-	logFile    = flag.String("log-file", "sendspin-player.log", "Log file path")
+	port       = flag.Int("port", defaults.Port, "Port for mDNS advertisement")
+	name       = flag.String("name", "", "Player friendly name (default: the saved name, or hostname-sendspin-player)")
+	bufferMs   = flag.Int("buffer-ms", defaults.BufferMs, "Jitter buffer size in milliseconds")
+	channels   = flag.Int("channels", defaults.Channels, "Output channels, e.g. 6 for 5.1 or 8 for 7.1 (surround is downmixed to fit)")
+	logFile    = flag.String("log-file", defaults.LogFile, "Log file path")
 	noTUI      = flag.Bool("no-tui", false, "Disable TUI, use streaming logs instead")
 	streamLogs = flag.Bool("stream-logs", false, "Alias for -no-tui")
+	device     = flag.String("device", "", "Output device ID or name (default: system default)")
+	listDevs   = flag.Bool("list-devices", false, "List output devices and exit")
+	bitPerfect = flag.Bool("bit-perfect", false, "Bit-perfect passthrough at 100% volume (exclusive device, exact format)")
+	eq         = flag.String("eq", "", "Parametric EQ bands, comma-separated type:freq[:gain[:q]] (e.g. peaking:60:-6:2,highshelf:8000:-2)")
+	ir         = flag.String("ir", "", "Impulse response WAV for convolution (room correction)")
+	irDir      = flag.String("ir-dir", "", "Directory of impulse responses servers may select by file name (default: servers can't load any)")
+	preamp     = flag.Float64("preamp", 0, "Preamp gain in dB applied before EQ (use negative values for headroom)")
+	maxVolume  = flag.Int("max-volume", defaults.MaxVolume, "Volume limit (1-100) applied whoever sets the volume")
+	ifaces     = flag.String("interfaces", "", "Network interfaces for mDNS, comma-separated names or patterns (default: all)")
+	exclude    = flag.String("exclude-interfaces", "", "Network interfaces to skip for mDNS, comma-separated patterns (e.g. docker*,veth*,tun*)")
+	prefer     = flag.String("prefer", "", "Preferred server ID or name; the player moves to it whenever it is available")
+	fallbacks  = flag.String("fallback-servers", "", "More server addresses to fail over to, comma-separated host:port")
+	listSrvs   = flag.Bool("list-servers", false, "List servers found on the network and exit")
+	stateFile  = flag.String("state-file", defaults.StateFile, "File keeping the client ID, name, volume, latency offset and last server (empty to disable)")
+	latency    = flag.Duration("latency-offset", 0, "Output delay to compensate, e.g. 150ms for a Bluetooth speaker; negative plays later (default: the saved offset)")
 )
 
+// flagKeys maps flags onto the config keys they override
+var flagKeys = map[string]string{
+	"server":             "player.server",
+	"port":               "player.port",
+	"name":               "player.name",
+	"buffer-ms":          "player.buffer_ms",
+	"channels":           "player.channels",
+	"log-file":           "player.log_file",
+	"device":             "player.device",
+	"bit-perfect":        "player.bit_perfect",
+	"eq":                 "player.dsp.eq",
+	"ir":                 "player.dsp.impulse_response",
+	"ir-dir":             "player.impulse_response_dir",
+	"preamp":             "player.dsp.preamp",
+	"max-volume":         "player.max_volume",
+	"interfaces":         "player.interfaces",
+	"exclude-interfaces": "player.exclude_interfaces",
+	"prefer":             "player.prefer",
+	"fallback-servers":   "player.fallback_servers",
+	"state-file":         "player.state_file",
+	"latency-offset":     "player.latency_offset",
+}
+
 func main() {
 	flag.Parse()
 
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	playerConfig, err := cfg.PlayerConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid configuration:\n%v\n", err)
+		os.Exit(1)
+	}
+
+	if *listDevs {
+		if err := printDevices(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *listSrvs {
+		log.SetOutput(io.Discard)
+		printServers(cfg.Player)
+		return
+	}
+
 	// Determine if we should use TUI or streaming logs
-	useTUI := !(*noTUI || *streamLogs)
+	useTUI := cfg.Player.TUI
 
 	// Set up logging
-	f, err := os.OpenFile(*logFile, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
+	f, err := os.OpenFile(cfg.Player.LogFile, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
 	if err != nil {
 		log.Fatalf("error opening log file: %v", err)
 	}
@@ -53,21 +127,6 @@ func main() {
 		log.SetOutput(multiWriter)
 	}
 
-	// Determine player name
-	playerName := *name
-	if playerName == "" {
-		hostname, err := os.Hostname()
-		if err != nil {
-			hostname = "unknown"
-		}
-		playerName = fmt.Sprintf("%s-sendspin-player", hostname)
-	}
-
-	if !useTUI {
-		log.Printf("Starting Sendspin Player: %s", playerName)
-		log.Printf("TUI disabled - logging to file for debugging")
-	}
-
 	// TUI setup
 	var tuiProg *tea.Program
 	var volumeCtrl *ui.VolumeControl
@@ -88,78 +147,83 @@ func main() {
 		}
 	}
 
-	// Handle server discovery if no manual server specified
-	var serverAddress string
-	if *serverAddr == "" {
-		log.Printf("Starting server discovery...")
-		disc := discovery.NewManager(discovery.Config{
-			ServiceName: playerName,
-			Port:        *port,
-		})
-		disc.Advertise()
-		disc.Browse()
-
-		// Wait for server discovery
-		select {
-		case server := <-disc.Servers():
-			serverAddress = fmt.Sprintf("%s:%d", server.Host, server.Port)
-			log.Printf("Discovered server at %s", serverAddress)
-		case <-time.After(10 * time.Second):
-			log.Fatalf("No server found after 10 seconds")
+	// Album art is shown in the TUI
+	var artworkDL *artwork.Downloader
+	if useTUI {
+		if artworkDL, err = artwork.NewDownloader(); err != nil {
+			log.Printf("Failed to create artwork downloader: %v", err)
 		}
-	} else {
-		serverAddress = *serverAddr
+	}
+
+	// Without -server the player finds servers, and servers find it, via mDNS
+	var browser *discovery.Manager
+	if cfg.Player.Server == "" {
+		browser = newBrowser(cfg.Player)
+		defer browser.Stop()
 	}
 
 	// Create player with callbacks for TUI
-	config := sendspin.PlayerConfig{
-		ServerAddr: serverAddress,
-		PlayerName: playerName,
-		Volume:     100,
-		BufferMs:   *bufferMs,
-		DeviceInfo: sendspin.DeviceInfo{
-			ProductName:     version.Product,
-			Manufacturer:    version.Manufacturer,
-			SoftwareVersion: version.Version,
-		},
-		OnStateChange: func(state sendspin.PlayerState) {
-			updateTUI(ui.StatusMsg{
-				Codec:      state.Codec,
-				SampleRate: state.SampleRate,
-				Channels:   state.Channels,
-				BitDepth:   state.BitDepth,
-			})
-			if state.Connected {
-				connected := true
-				updateTUI(ui.StatusMsg{
-					Connected:  &connected,
-					ServerName: serverAddress,
-				})
-			}
-		},
-		OnMetadata: func(meta sendspin.Metadata) {
-			updateTUI(ui.StatusMsg{
-				Title:  meta.Title,
-				Artist: meta.Artist,
-				Album:  meta.Album,
-			})
-		},
-		OnError: func(err error) {
-			log.Printf("Player error: %v", err)
-		},
+	playerConfig.Discovery = browser
+	playerConfig.DeviceInfo = sendspin.DeviceInfo{
+		ProductName:     version.Product,
+		Manufacturer:    version.Manufacturer,
+		SoftwareVersion: version.Version,
+	}
+	playerConfig.OnStateChange = func(state sendspin.PlayerState) {
+		updateTUI(ui.StatusMsg{
+			Codec:      state.Codec,
+			SampleRate: state.SampleRate,
+			Channels:   state.Channels,
+			BitDepth:   state.BitDepth,
+		})
+		connected, muted := state.Connected, state.Muted
+		updateTUI(ui.StatusMsg{
+			Connected:  &connected,
+			ServerName: cmp.Or(state.ServerName, state.Server),
+			Volume:     state.Volume,
+			Muted:      &muted,
+		})
+	}
+	playerConfig.OnMetadata = func(meta sendspin.Metadata) {
+		updateTUI(ui.StatusMsg{
+			Title:  meta.Title,
+			Artist: meta.Artist,
+			Album:  meta.Album,
+		})
+		if artworkDL != nil && meta.ArtworkURL != "" {
+			go showArtwork(artworkDL, meta.ArtworkURL, updateTUI)
+		}
+	}
+	playerConfig.OnError = func(err error) {
+		log.Printf("Player error: %v", err)
 	}
 
-	player, err := sendspin.NewPlayer(config)
+	player, err := sendspin.NewPlayer(playerConfig)
 	if err != nil {
 		log.Fatalf("Failed to create player: %v", err)
 	}
 
-	// Connect to server
-	if err := player.Connect(); err != nil {
-		log.Fatalf("Connection failed: %v", err)
+	status := player.Status()
+	updateTUI(ui.StatusMsg{Volume: status.Volume, Muted: &status.Muted})
+
+	if !useTUI {
+		log.Printf("Starting Sendspin Player: %s (client ID: %s)", player.Name(), player.ClientID())
+		log.Printf("TUI disabled - logging to file for debugging")
 	}
 
-	log.Printf("Connected to server: %s", serverAddress)
+	if browser != nil {
+		// Servers can connect to us, or we connect to one we discover
+		if err := player.Listen(fmt.Sprintf(":%d", cfg.Player.Port)); err != nil {
+			log.Fatalf("Failed to listen for servers: %v", err)
+		}
+		advertiser := advertise(player.Name(), player.ClientID(), cfg.Player)
+		defer advertiser.Stop()
+	}
+
+	// Connect, and fail over between servers for as long as we run
+	if err := player.Start(); err != nil {
+		log.Fatalf("Failed to start player: %v", err)
+	}
 
 	// Start volume control handler if TUI is enabled
 	if volumeCtrl != nil {
@@ -171,21 +235,33 @@ func main() {
 		go statsUpdateLoop(player, updateTUI)
 	}
 
-	// Handle shutdown
+	if cfg.Player.Metrics != "" {
+		metrics.Serve(cfg.Player.Metrics, player.MetricsHandler())
+	}
+
+	// Handle shutdown, and reload the config on SIGHUP
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	hupChan := make(chan os.Signal, 1)
+	signal.Notify(hupChan, syscall.SIGHUP)
 
 	// Wait for quit signal from TUI or OS
+	var quit <-chan ui.QuitMsg
 	if volumeCtrl != nil {
+		quit = volumeCtrl.Quit
+	}
+wait:
+	for {
 		select {
-		case <-volumeCtrl.Quit:
+		case <-hupChan:
+			cfg = reload(player, cfg)
+		case <-quit:
 			log.Printf("Received quit signal from TUI")
+			break wait
 		case <-sigChan:
 			log.Printf("Shutdown signal received")
+			break wait
 		}
-	} else {
-		<-sigChan
-		log.Printf("Shutdown signal received")
 	}
 
 	// Close player
@@ -196,6 +272,78 @@ func main() {
 	log.Printf("Player stopped")
 }
 
+// loadConfig reads the config file and environment, then applies the
+// flags given on the command line
+func loadConfig() (*config.Config, error) {
+	cfg, err := config.Load(*configFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var errs []error
+	flag.Visit(func(f *flag.Flag) {
+		var err error
+		switch f.Name {
+		case "no-tui", "stream-logs":
+			err = cfg.Set("player.tui", "false", "-"+f.Name)
+		default:
+			if key, ok := flagKeys[f.Name]; ok {
+				err = cfg.Set(key, f.Value.String(), "-"+f.Name)
+			}
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+	})
+	if len(errs) > 0 {
+		return nil, errs[0]
+	}
+	return cfg, nil
+}
+
+// reload applies a changed config file on SIGHUP. The volume limit and
+// DSP change while playing; other changes need a restart. An invalid
+// config is reported and the current settings kept.
+func reload(player *sendspin.Player, old *config.Config) *config.Config {
+	log.Printf("Reloading configuration")
+	cfg, err := loadConfig()
+	var playerConfig sendspin.PlayerConfig
+	if err == nil {
+		playerConfig, err = cfg.PlayerConfig()
+	}
+	if err != nil {
+		log.Printf("Config reload failed, keeping the current settings: %v", err)
+		return old
+	}
+
+	dspChanged := false
+	for _, key := range config.Changed(old, cfg) {
+		switch {
+		case key == "player.max_volume":
+			if err := player.SetMaxVolume(playerConfig.MaxVolume); err != nil {
+				log.Printf("Failed to change the volume limit: %v", err)
+				continue
+			}
+			log.Printf("Volume limit changed to %d%%", playerConfig.MaxVolume)
+		case strings.HasPrefix(key, "player.dsp."):
+			dspChanged = true
+		case strings.HasPrefix(key, "player.") || strings.HasPrefix(key, "auth.") || strings.HasPrefix(key, "tls."):
+			log.Printf("Setting %s changed; restart the player to apply it", key)
+		}
+	}
+
+	// The file's DSP replaces any the server sent, but only when it changed
+	if dspChanged {
+		if err := player.SetDSP(playerConfig.DSP); err != nil {
+			log.Printf("Keeping the current DSP: %v", err)
+			cfg.Player.DSP = old.Player.DSP
+		} else {
+			log.Printf("DSP changed")
+		}
+	}
+	return cfg
+}
+
 // handleVolumeControl processes volume changes from TUI
 func handleVolumeControl(player *sendspin.Player, volumeCtrl *ui.VolumeControl) {
 	for {
@@ -204,6 +352,13 @@ func handleVolumeControl(player *sendspin.Player, volumeCtrl *ui.VolumeControl)
 			log.Printf("Volume change: %d%%, muted=%v", vol.Volume, vol.Muted)
 			player.SetVolume(vol.Volume)
 			player.Mute(vol.Muted)
+		case target := <-volumeCtrl.ServerSelect:
+			log.Printf("Switching to server %s", target)
+			go func() {
+				if err := player.SwitchServer(target); err != nil {
+					log.Printf("Failed to switch server: %v", err)
+				}
+			}()
 		case <-volumeCtrl.Quit:
 			return
 		}
@@ -235,28 +390,137 @@ func statsUpdateLoop(player *sendspin.Player, updateTUI func(ui.StatusMsg)) {
 		case <-ticker.C:
 			stats := player.Stats()
 
-			// Convert pkg/sync.Quality to internal/sync.Quality
-			var syncQuality internalsync.Quality
-			switch stats.SyncQuality {
-			case 0: // QualityGood
-				syncQuality = internalsync.QualityGood
-			case 1: // QualityDegraded
-				syncQuality = internalsync.QualityDegraded
-			case 2: // QualityLost
-				syncQuality = internalsync.QualityLost
-			}
+			position, duration, _ := player.Progress()
 
 			updateTUI(ui.StatusMsg{
-				Received:    stats.Received,
-				Played:      stats.Played,
-				Dropped:     stats.Dropped,
-				BufferDepth: stats.BufferDepth,
-				SyncRTT:     stats.SyncRTT,
-				SyncQuality: syncQuality,
-				Goroutines:  lastGoroutines,
-				MemAlloc:    lastMemAlloc,
-				MemSys:      lastMemSys,
+				TrackPosition: position,
+				TrackDuration: duration,
+				Received:      stats.Received,
+				Played:        stats.Played,
+				Dropped:       stats.Dropped,
+				BufferDepth:   stats.BufferDepth,
+				SyncRTT:       stats.SyncRTT,
+				SyncQuality:   stats.SyncQuality,
+				Goroutines:    lastGoroutines,
+				MemAlloc:      lastMemAlloc,
+				MemSys:        lastMemSys,
+
+				Underruns:           stats.Underruns,
+				Overruns:            stats.Overruns,
+				Reprimes:            stats.Reprimes,
+				OutputLatency:       stats.OutputLatency,
+				CallbackInterval:    stats.CallbackInterval,
+				MaxCallbackInterval: stats.MaxCallbackInterval,
+
+				Servers: serverEntries(player),
 			})
 		}
 	}
 }
+
+// showArtwork downloads album art and passes it to the TUI
+func showArtwork(artworkDL *artwork.Downloader, url string, updateTUI func(ui.StatusMsg)) {
+	path, err := artworkDL.Download(url)
+	if err != nil {
+		log.Printf("Failed to download artwork: %v", err)
+		return
+	}
+	updateTUI(ui.StatusMsg{ArtworkPath: path})
+}
+
+// printDevices lists playback devices for -list-devices
+func printDevices() error {
+	devices, err := output.ListDevices()
+	if err != nil {
+		return err
+	}
+
+	if len(devices) == 0 {
+		fmt.Println("No output devices found")
+		return nil
+	}
+
+	for _, d := range devices {
+		marker := " "
+		if d.Default {
+			marker = "*"
+		}
+		fmt.Printf("%s %s\n", marker, d.Name)
+		fmt.Printf("    id:      %s\n", d.ID)
+		if len(d.SampleRates) > 0 {
+			fmt.Printf("    rates:   %v\n", d.SampleRates)
+		} else {
+			fmt.Printf("    rates:   any\n")
+		}
+		if len(d.Formats) > 0 {
+			fmt.Printf("    formats: %v\n", d.Formats)
+		}
+	}
+	fmt.Println("\n* system default. Select with -device <id or name>")
+	return nil
+}
+
+// newBrowser starts browsing for servers
+func newBrowser(p config.Player) *discovery.Manager {
+	log.Printf("Starting server discovery...")
+	browser := discovery.NewManager(discovery.Config{
+		Interfaces:        p.Interfaces,
+		ExcludeInterfaces: p.ExcludeInterfaces,
+	})
+	browser.Browse()
+	return browser
+}
+
+// advertise announces the player so servers can connect to it
+func advertise(playerName, clientID string, p config.Player) *discovery.Manager {
+	advertiser := discovery.NewManager(discovery.Config{
+		ServiceName:       playerName,
+		Port:              p.Port,
+		ID:                clientID,
+		Version:           1,
+		Interfaces:        p.Interfaces,
+		ExcludeInterfaces: p.ExcludeInterfaces,
+	})
+	if err := advertiser.Advertise(); err != nil {
+		log.Printf("Failed to start mDNS advertisement: %v", err)
+	}
+	return advertiser
+}
+
+// serverEntries lists the player's candidate servers for the TUI picker
+func serverEntries(player *sendspin.Player) []ui.ServerEntry {
+	status := player.Status()
+	entries := []ui.ServerEntry{}
+	for _, server := range player.Servers() {
+		entries = append(entries, ui.ServerEntry{
+			ID:   server.ID,
+			Name: server.Name,
+			Addr: server.Address(),
+			Current: status.Connected && (server.Address() == status.Server ||
+				(server.ID != "" && server.ID == status.ServerID)),
+		})
+	}
+	return entries
+}
+
+// printServers browses briefly and lists the servers found for -list-servers
+func printServers(p config.Player) {
+	browser := newBrowser(p)
+	defer browser.Stop()
+	time.Sleep(3 * time.Second)
+
+	servers := browser.Servers()
+	if len(servers) == 0 {
+		fmt.Println("No servers found")
+		return
+	}
+	for _, server := range servers {
+		fmt.Printf("%s\n", server.Name)
+		fmt.Printf("    id:      %s\n", server.ID)
+		fmt.Printf("    address: %s\n", server.Address())
+		if server.Version > 0 {
+			fmt.Printf("    version: %d\n", server.Version)
+		}
+	}
+	fmt.Println("\nConnect with -server <address>, or prefer one with -prefer <id or name>")
+}
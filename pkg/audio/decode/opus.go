@@ -1,8 +1,9 @@
 // ABOUTME: Opus audio decoder
-// ABOUTME: Decodes Opus audio to int32 samples
+// ABOUTME: Decodes Opus audio (including multistream surround) to int32 samples
 package decode
 
 import (
+	"bytes"
 	"fmt"
 
 	"github.com/Sendspin/sendspin-go/pkg/audio"
@@ -11,45 +12,173 @@ import (
 
 // OpusDecoder decodes Opus audio
 type OpusDecoder struct {
-	decoder *opus.Decoder
-	format  audio.Format
+	decoders []*opus.Decoder
+	format   audio.Format
+	head     opusHead
+	order    []int     // WAVE index for each channel in Vorbis order
+	pcm      [][]int16 // Per-stream output buffers
 }
 
-// NewOpus creates a new Opus decoder
+// opusHead holds the channel mapping from an OpusHead header (RFC 7845)
+type opusHead struct {
+	family  byte
+	streams int
+	coupled int
+	mapping []byte
+}
+
+// NewOpus creates a new Opus decoder. Streams with more than two channels
+// need the OpusHead codec header describing the multistream layout.
 func NewOpus(format audio.Format) (Decoder, error) {
 	if format.Codec != "opus" {
 		return nil, fmt.Errorf("invalid codec for Opus decoder: %s", format.Codec)
 	}
 
-	dec, err := opus.NewDecoder(format.SampleRate, format.Channels)
+	head := opusHead{streams: 1}
+	if format.Channels == 2 {
+		head.coupled = 1
+	}
+	if format.Channels > 2 {
+		var err error
+		if head, err = parseOpusHead(format.CodecHeader, format.Channels); err != nil {
+			return nil, err
+		}
+	}
+	order, err := audio.VorbisOrder(format.Channels)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create opus decoder: %w", err)
 	}
 
-	return &OpusDecoder{
-		decoder: dec,
-		format:  format,
-	}, nil
+	d := &OpusDecoder{format: format, head: head, order: order}
+	for i := 0; i < head.streams; i++ {
+		dec, err := opus.NewDecoder(format.SampleRate, head.width(i))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create opus decoder: %w", err)
+		}
+		d.decoders = append(d.decoders, dec)
+	}
+	return d, nil
+}
+
+// parseOpusHead reads the channel mapping from an OpusHead header. Pre-skip
+// and output gain are ignored: chunk timestamps already place packets.
+func parseOpusHead(header []byte, channels int) (opusHead, error) {
+	if len(header) < 19 || !bytes.Equal(header[:8], []byte("OpusHead")) {
+		return opusHead{}, fmt.Errorf("opus with %d channels requires an OpusHead codec header", channels)
+	}
+	if int(header[9]) != channels {
+		return opusHead{}, fmt.Errorf("OpusHead has %d channels, stream has %d", header[9], channels)
+	}
+	head := opusHead{family: header[18]}
+	if head.family != 1 {
+		return opusHead{}, fmt.Errorf("unsupported opus channel mapping family %d", head.family)
+	}
+	if len(header) < 21+channels {
+		return opusHead{}, fmt.Errorf("OpusHead channel mapping table is truncated")
+	}
+	head.streams, head.coupled = int(header[19]), int(header[20])
+	head.mapping = header[21 : 21+channels]
+	if head.streams < 1 || head.coupled > head.streams {
+		return opusHead{}, fmt.Errorf("invalid OpusHead stream counts %d/%d", head.streams, head.coupled)
+	}
+	for _, d := range head.mapping {
+		if d != 255 && int(d) >= head.streams+head.coupled {
+			return opusHead{}, fmt.Errorf("OpusHead maps a channel to missing stream channel %d", d)
+		}
+	}
+	return head, nil
+}
+
+// width returns the channel count of a stream
+func (h opusHead) width(stream int) int {
+	if stream < h.coupled {
+		return 2
+	}
+	return 1
 }
 
 // Decode converts Opus bytes to int32 samples
 func (d *OpusDecoder) Decode(data []byte) ([]int32, error) {
-	// Opus decoder outputs to int16 buffer
-	pcmSize := 5760 * d.format.Channels // Max frame size
-	pcm16 := make([]int16, pcmSize)
+	if len(d.decoders) == 1 {
+		// Opus decoder outputs to int16 buffer
+		pcmSize := 5760 * d.format.Channels // Max frame size
+		pcm16 := make([]int16, pcmSize)
+
+		n, err := d.decoders[0].Decode(data, pcm16)
+		if err != nil {
+			return nil, fmt.Errorf("opus decode failed: %w", err)
+		}
 
-	n, err := d.decoder.Decode(data, pcm16)
+		// Convert int16 to int32 (Opus is always 16-bit)
+		actualSamples := n * d.format.Channels
+		pcm32 := make([]int32, actualSamples)
+		for i := 0; i < actualSamples; i++ {
+			pcm32[i] = audio.SampleFromInt16(pcm16[i])
+		}
+		return pcm32, nil
+	}
+
+	frames, err := d.decodeStreams(data)
 	if err != nil {
-		return nil, fmt.Errorf("opus decode failed: %w", err)
+		return nil, err
 	}
+	return d.interleave(frames), nil
+}
+
+// interleave joins the decoded stream channels back into WAVE order
+func (d *OpusDecoder) interleave(frames int) []int32 {
+	channels := d.format.Channels
+	pcm32 := make([]int32, frames*channels)
+	for c, wave := range d.order {
+		index := int(d.head.mapping[c])
+		if index == 255 {
+			continue // Silent channel
+		}
+		stream, sub, width := index-d.head.coupled, 0, 1
+		if index < 2*d.head.coupled {
+			stream, sub, width = index/2, index%2, 2
+		}
+		buf := d.pcm[stream]
+		for f := 0; f < frames; f++ {
+			pcm32[f*channels+wave] = audio.SampleFromInt16(buf[f*width+sub])
+		}
+	}
+	return pcm32
+}
+
+// decodeStreams splits a multistream packet and decodes every stream,
+// returning the frames per stream
+func (d *OpusDecoder) decodeStreams(data []byte) (int, error) {
+	if d.pcm == nil {
+		d.pcm = make([][]int16, len(d.decoders))
+		for i := range d.pcm {
+			d.pcm[i] = make([]int16, 5760*d.head.width(i)) // Max frame size
+		}
+	}
+
+	frames := -1
+	for i, dec := range d.decoders {
+		// Every stream but the last uses self-delimiting framing
+		packet := data
+		if i < len(d.decoders)-1 {
+			var consumed int
+			var err error
+			if packet, consumed, err = splitSelfDelimited(data); err != nil {
+				return 0, fmt.Errorf("opus decode failed in stream %d: %w", i, err)
+			}
+			data = data[consumed:]
+		}
 
-	// Convert int16 to int32 (Opus is always 16-bit)
-	actualSamples := n * d.format.Channels
-	pcm32 := make([]int32, actualSamples)
-	for i := 0; i < actualSamples; i++ {
-		pcm32[i] = audio.SampleFromInt16(pcm16[i])
+		n, err := dec.Decode(packet, d.pcm[i])
+		if err != nil {
+			return 0, fmt.Errorf("opus decode failed in stream %d: %w", i, err)
+		}
+		if frames >= 0 && n != frames {
+			return 0, fmt.Errorf("opus streams decoded %d and %d frames", frames, n)
+		}
+		frames = n
 	}
-	return pcm32, nil
+	return frames, nil
 }
 
 // Close releases decoder resources
@@ -0,0 +1,118 @@
+// ABOUTME: Opus self-delimiting packet framing
+// ABOUTME: Splits the self-delimited packets inside multistream packets (RFC 6716 Appendix B)
+package decode
+
+import "fmt"
+
+// splitSelfDelimited reads one self-delimited Opus packet from the front
+// of data. It returns the packet in standard framing and the number of
+// bytes it occupied.
+func splitSelfDelimited(data []byte) (packet []byte, consumed int, err error) {
+	if len(data) < 1 {
+		return nil, 0, fmt.Errorf("empty opus packet")
+	}
+
+	// Find the end of the frame lengths and the total size of the frames
+	var headerEnd, frames int
+	readLength := func(pos int) (int, int, error) {
+		if pos >= len(data) {
+			return 0, 0, fmt.Errorf("invalid opus packet: truncated frame length")
+		}
+		return readFrameLength(data[pos:])
+	}
+
+	switch data[0] & 0x3 {
+	case 0, 1: // One frame, or two of equal size
+		size, n, err := readLength(1)
+		if err != nil {
+			return nil, 0, err
+		}
+		headerEnd, frames = 1, size
+		if data[0]&0x3 == 1 {
+			frames = 2 * size
+		}
+		consumed = 1 + n + frames
+
+	case 2: // Two frames of different sizes
+		first, n1, err := readLength(1)
+		if err != nil {
+			return nil, 0, err
+		}
+		second, n2, err := readLength(1 + n1)
+		if err != nil {
+			return nil, 0, err
+		}
+		headerEnd = 1 + n1
+		consumed = headerEnd + n2 + first + second
+
+	default: // Any number of frames, with optional padding
+		if len(data) < 2 {
+			return nil, 0, fmt.Errorf("invalid opus packet: missing frame count")
+		}
+		vbr, padded, count := data[1]&0x80 != 0, data[1]&0x40 != 0, int(data[1]&0x3f)
+		if count == 0 {
+			return nil, 0, fmt.Errorf("invalid opus packet: no frames")
+		}
+		pos := 2
+		padding := 0
+		for padded {
+			if pos >= len(data) {
+				return nil, 0, fmt.Errorf("invalid opus packet: truncated padding")
+			}
+			b := int(data[pos])
+			pos++
+			if b == 255 {
+				padding += 254
+			} else {
+				padding += b
+				padded = false
+			}
+		}
+		if vbr {
+			for i := 0; i < count-1; i++ {
+				size, n, err := readLength(pos)
+				if err != nil {
+					return nil, 0, err
+				}
+				pos += n
+				frames += size
+			}
+		}
+		last, n, err := readLength(pos)
+		if err != nil {
+			return nil, 0, err
+		}
+		if vbr {
+			frames += last
+		} else {
+			frames = count * last
+		}
+		headerEnd = pos
+		consumed = pos + n + frames + padding
+	}
+
+	if consumed > len(data) {
+		return nil, 0, fmt.Errorf("invalid opus packet: frames exceed packet")
+	}
+
+	// Drop the extra length to get standard framing
+	_, n, _ := readLength(headerEnd)
+	packet = make([]byte, 0, consumed-n)
+	packet = append(packet, data[:headerEnd]...)
+	packet = append(packet, data[headerEnd+n:consumed]...)
+	return packet, consumed, nil
+}
+
+// readFrameLength reads a one- or two-byte frame length
+func readFrameLength(b []byte) (size, n int, err error) {
+	if len(b) < 1 {
+		return 0, 0, fmt.Errorf("invalid opus packet: truncated frame length")
+	}
+	if b[0] < 252 {
+		return int(b[0]), 1, nil
+	}
+	if len(b) < 2 {
+		return 0, 0, fmt.Errorf("invalid opus packet: truncated frame length")
+	}
+	return int(b[1])*4 + int(b[0]), 2, nil
+}
@@ -0,0 +1,48 @@
+// ABOUTME: Tests for Opus self-delimiting framing
+// ABOUTME: Checks splitting self-delimited packets for every packet code
+package decode
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSplitSelfDelimited(t *testing.T) {
+	long := append([]byte{0x00}, make([]byte, 300)...)
+
+	tests := []struct {
+		name   string
+		framed []byte
+		want   []byte
+	}{
+		{"one frame", []byte{0x00, 3, 1, 2, 3}, []byte{0x00, 1, 2, 3}},
+		{"two equal frames", []byte{0x01, 2, 1, 2, 3, 4}, []byte{0x01, 1, 2, 3, 4}},
+		{"two frames", []byte{0x02, 1, 2, 9, 1, 2}, []byte{0x02, 1, 9, 1, 2}},
+		{"constant frames with padding", []byte{0x03, 0x42, 1, 2, 1, 2, 3, 4, 0}, []byte{0x03, 0x42, 1, 1, 2, 3, 4, 0}},
+		{"variable frames", []byte{0x03, 0x83, 1, 2, 3, 9, 8, 8, 1, 2, 3}, []byte{0x03, 0x83, 1, 2, 9, 8, 8, 1, 2, 3}},
+		{"two-byte length", append([]byte{0x00, 252, 12}, long[1:]...), long},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// A following packet is left unread
+			data := append(append([]byte{}, tt.framed...), 0xff, 0xff)
+			got, consumed, err := splitSelfDelimited(data)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if consumed != len(tt.framed) {
+				t.Errorf("expected %d bytes consumed, got %d", len(tt.framed), consumed)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+
+	for _, bad := range [][]byte{nil, {0x00}, {0x00, 5, 1}, {0x03, 0x00, 1}, {0x03, 0x41}} {
+		if _, _, err := splitSelfDelimited(bad); err == nil {
+			t.Errorf("expected error for %v", bad)
+		}
+	}
+}
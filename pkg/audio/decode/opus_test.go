@@ -6,6 +6,7 @@ import (
 	"testing"
 
 	"github.com/Sendspin/sendspin-go/pkg/audio"
+	"github.com/Sendspin/sendspin-go/pkg/audio/encode"
 )
 
 func TestNewOpus(t *testing.T) {
@@ -108,3 +109,53 @@ func TestOpusClose(t *testing.T) {
 		t.Errorf("expected Close to succeed, got error: %v", err)
 	}
 }
+
+func TestOpusDecoder_Multistream(t *testing.T) {
+	format := audio.Format{Codec: "opus", SampleRate: 48000, Channels: 8, BitDepth: 16}
+
+	if _, err := NewOpus(format); err == nil {
+		t.Fatal("expected error without an OpusHead codec header")
+	}
+
+	encoder, err := encode.NewOpusEncoder(format)
+	if err != nil {
+		t.Fatalf("failed to create encoder: %v", err)
+	}
+	format.CodecHeader = encoder.Header()
+
+	decoder, err := NewOpus(format)
+	if err != nil {
+		t.Fatalf("failed to create decoder: %v", err)
+	}
+	defer decoder.Close()
+
+	packet, err := encoder.Encode(make([]int32, 960*8))
+	if err != nil {
+		t.Fatalf("failed to encode: %v", err)
+	}
+	samples, err := decoder.Decode(packet)
+	if err != nil {
+		t.Fatalf("failed to decode: %v", err)
+	}
+	if len(samples) != 960*8 {
+		t.Errorf("expected %d samples, got %d", 960*8, len(samples))
+	}
+
+	// 7.1 streams (FL/FR, SL/SR, BL/BR, FC, LFE) interleave back into
+	// WAVE order (FL FR FC LFE BL BR SL SR)
+	d := decoder.(*OpusDecoder)
+	d.pcm = [][]int16{{1, 2}, {7, 8}, {5, 6}, {3}, {4}}
+	got := d.interleave(1)
+	for ch, v := range got {
+		if v != audio.SampleFromInt16(int16(ch+1)) {
+			t.Errorf("channel %d: got %d", ch, v)
+		}
+	}
+
+	bad := append([]byte{}, format.CodecHeader...)
+	bad[9] = 6
+	format.CodecHeader = bad
+	if _, err := NewOpus(format); err == nil {
+		t.Error("expected error for mismatched channel count")
+	}
+}
@@ -0,0 +1,193 @@
+// ABOUTME: Biquad filters for parametric EQ
+// ABOUTME: Peaking, shelf and high/low-pass designs from the RBJ audio EQ cookbook
+package dsp
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// FilterType names a biquad filter design
+type FilterType string
+
+const (
+	Peaking   FilterType = "peaking"
+	LowShelf  FilterType = "lowshelf"
+	HighShelf FilterType = "highshelf"
+	LowPass   FilterType = "lowpass"
+	HighPass  FilterType = "highpass"
+)
+
+// defaultQ is a Butterworth response for pass filters and a moderate
+// bandwidth for peaking filters and shelves
+const defaultQ = math.Sqrt2 / 2
+
+// FilterConfig describes one parametric EQ band
+type FilterConfig struct {
+	Type      FilterType `json:"type"`
+	Frequency float64    `json:"frequency"`      // Centre, corner or shelf midpoint (Hz)
+	Gain      float64    `json:"gain,omitempty"` // Boost or cut in dB (peaking and shelves)
+	Q         float64    `json:"q,omitempty"`    // Quality factor; 0 uses 0.707
+}
+
+// String formats the band as accepted by ParseFilter
+func (f FilterConfig) String() string {
+	q := f.Q
+	if q == 0 {
+		q = defaultQ
+	}
+	return fmt.Sprintf("%s:%g:%g:%g", f.Type, f.Frequency, f.Gain, q)
+}
+
+// ParseFilter parses a band written as type:frequency[:gain[:q]], e.g.
+// "peaking:60:-6:2" or "highpass:25"
+func ParseFilter(s string) (FilterConfig, error) {
+	parts := strings.Split(strings.TrimSpace(s), ":")
+	if len(parts) < 2 || len(parts) > 4 {
+		return FilterConfig{}, fmt.Errorf("invalid filter %q: expected type:frequency[:gain[:q]]", s)
+	}
+
+	f := FilterConfig{Type: FilterType(strings.ToLower(parts[0]))}
+	values := make([]float64, len(parts)-1)
+	for i, part := range parts[1:] {
+		v, err := strconv.ParseFloat(part, 64)
+		if err != nil {
+			return FilterConfig{}, fmt.Errorf("invalid filter %q: %w", s, err)
+		}
+		values[i] = v
+	}
+	f.Frequency = values[0]
+	if len(values) > 1 {
+		f.Gain = values[1]
+	}
+	if len(values) > 2 {
+		f.Q = values[2]
+	}
+
+	if err := f.validate(); err != nil {
+		return FilterConfig{}, err
+	}
+	return f, nil
+}
+
+// ParseFilters parses a comma-separated list of bands (see ParseFilter)
+func ParseFilters(s string) ([]FilterConfig, error) {
+	var filters []FilterConfig
+	for _, part := range strings.Split(s, ",") {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+		f, err := ParseFilter(part)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, f)
+	}
+	return filters, nil
+}
+
+// validate checks the band independently of the sample rate
+func (f FilterConfig) validate() error {
+	switch f.Type {
+	case Peaking, LowShelf, HighShelf, LowPass, HighPass:
+	default:
+		return fmt.Errorf("unknown filter type %q (supported: peaking, lowshelf, highshelf, lowpass, highpass)", f.Type)
+	}
+	if f.Frequency <= 0 {
+		return fmt.Errorf("%s filter frequency must be positive, got %g", f.Type, f.Frequency)
+	}
+	if f.Q < 0 {
+		return fmt.Errorf("%s filter Q must be positive, got %g", f.Type, f.Q)
+	}
+	return nil
+}
+
+// biquad is a second-order IIR section (transposed direct form II)
+type biquad struct {
+	b0, b1, b2, a1, a2 float64
+	z1, z2             float64
+}
+
+// newBiquad designs a filter for the sample rate
+func newBiquad(f FilterConfig, sampleRate int) (*biquad, error) {
+	if err := f.validate(); err != nil {
+		return nil, err
+	}
+	nyquist := float64(sampleRate) / 2
+	if f.Frequency >= nyquist {
+		return nil, fmt.Errorf("%s filter frequency %gHz is above Nyquist (%gHz)", f.Type, f.Frequency, nyquist)
+	}
+
+	q := f.Q
+	if q == 0 {
+		q = defaultQ
+	}
+	w0 := 2 * math.Pi * f.Frequency / float64(sampleRate)
+	cosW, sinW := math.Cos(w0), math.Sin(w0)
+	alpha := sinW / (2 * q)
+	a := math.Pow(10, f.Gain/40)
+
+	var b0, b1, b2, a0, a1, a2 float64
+	switch f.Type {
+	case Peaking:
+		b0, b1, b2 = 1+alpha*a, -2*cosW, 1-alpha*a
+		a0, a1, a2 = 1+alpha/a, -2*cosW, 1-alpha/a
+	case LowShelf:
+		sq := 2 * math.Sqrt(a) * alpha
+		b0 = a * ((a + 1) - (a-1)*cosW + sq)
+		b1 = 2 * a * ((a - 1) - (a+1)*cosW)
+		b2 = a * ((a + 1) - (a-1)*cosW - sq)
+		a0 = (a + 1) + (a-1)*cosW + sq
+		a1 = -2 * ((a - 1) + (a+1)*cosW)
+		a2 = (a + 1) + (a-1)*cosW - sq
+	case HighShelf:
+		sq := 2 * math.Sqrt(a) * alpha
+		b0 = a * ((a + 1) + (a-1)*cosW + sq)
+		b1 = -2 * a * ((a - 1) + (a+1)*cosW)
+		b2 = a * ((a + 1) + (a-1)*cosW - sq)
+		a0 = (a + 1) - (a-1)*cosW + sq
+		a1 = 2 * ((a - 1) - (a+1)*cosW)
+		a2 = (a + 1) - (a-1)*cosW - sq
+	case LowPass:
+		b0, b1, b2 = (1-cosW)/2, 1-cosW, (1-cosW)/2
+		a0, a1, a2 = 1+alpha, -2*cosW, 1-alpha
+	case HighPass:
+		b0, b1, b2 = (1+cosW)/2, -(1 + cosW), (1+cosW)/2
+		a0, a1, a2 = 1+alpha, -2*cosW, 1-alpha
+	}
+
+	return &biquad{
+		b0: b0 / a0, b1: b1 / a0, b2: b2 / a0,
+		a1: a1 / a0, a2: a2 / a0,
+	}, nil
+}
+
+// process filters one sample
+func (b *biquad) process(x float64) float64 {
+	y := b.b0*x + b.z1
+	b.z1 = b.b1*x - b.a1*y + b.z2
+	b.z2 = b.b2*x - b.a2*y
+	return y
+}
+
+// reset clears the filter state
+func (b *biquad) reset() {
+	b.z1, b.z2 = 0, 0
+}
+
+// response returns the filter's magnitude response (dB) at a frequency
+func (b *biquad) response(freq float64, sampleRate int) float64 {
+	w := 2 * math.Pi * freq / float64(sampleRate)
+	z1 := complex(math.Cos(-w), math.Sin(-w))
+	z2 := z1 * z1
+	num := complex(b.b0, 0) + complex(b.b1, 0)*z1 + complex(b.b2, 0)*z2
+	den := 1 + complex(b.a1, 0)*z1 + complex(b.a2, 0)*z2
+	return 20 * math.Log10(cmplxAbs(num/den))
+}
+
+// cmplxAbs returns |c|
+func cmplxAbs(c complex128) float64 {
+	return math.Hypot(real(c), imag(c))
+}
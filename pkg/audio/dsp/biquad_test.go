@@ -0,0 +1,94 @@
+// ABOUTME: Tests for parametric EQ biquads
+// ABOUTME: Checks filter responses against their design targets and parsing
+package dsp
+
+import (
+	"math"
+	"testing"
+)
+
+// measureGain filters a sine and returns its steady-state gain (dB)
+func measureGain(b *biquad, freq float64, sampleRate int) float64 {
+	var in, out float64
+	for i := 0; i < sampleRate/2; i++ {
+		x := math.Sin(2 * math.Pi * freq * float64(i) / float64(sampleRate))
+		y := b.process(x)
+		if i >= sampleRate/4 {
+			in += x * x
+			out += y * y
+		}
+	}
+	return 10 * math.Log10(out/in)
+}
+
+func TestBiquadResponses(t *testing.T) {
+	tests := []struct {
+		filter FilterConfig
+		freq   float64
+		want   float64
+	}{
+		{FilterConfig{Type: Peaking, Frequency: 1000, Gain: 6, Q: 1}, 1000, 6},
+		{FilterConfig{Type: Peaking, Frequency: 60, Gain: -9, Q: 4}, 60, -9},
+		{FilterConfig{Type: Peaking, Frequency: 60, Gain: -9, Q: 4}, 1000, 0},
+		{FilterConfig{Type: LowShelf, Frequency: 100, Gain: 6}, 20, 6},
+		{FilterConfig{Type: LowShelf, Frequency: 100, Gain: 6}, 5000, 0},
+		{FilterConfig{Type: HighShelf, Frequency: 8000, Gain: -4}, 18000, -4},
+		{FilterConfig{Type: LowPass, Frequency: 2000}, 2000, -3.01},
+		{FilterConfig{Type: LowPass, Frequency: 2000}, 100, 0},
+		{FilterConfig{Type: HighPass, Frequency: 30}, 30, -3.01},
+		{FilterConfig{Type: HighPass, Frequency: 30}, 1000, 0},
+	}
+
+	for _, tt := range tests {
+		b, err := newBiquad(tt.filter, 48000)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.filter, err)
+		}
+		if got := b.response(tt.freq, 48000); math.Abs(got-tt.want) > 0.1 {
+			t.Errorf("%s at %gHz: designed response %.2f dB, want %.2f dB", tt.filter, tt.freq, got, tt.want)
+		}
+		if got := measureGain(b, tt.freq, 48000); math.Abs(got-tt.want) > 0.1 {
+			t.Errorf("%s at %gHz: measured gain %.2f dB, want %.2f dB", tt.filter, tt.freq, got, tt.want)
+		}
+	}
+}
+
+func TestBiquadRejectsInvalid(t *testing.T) {
+	for _, f := range []FilterConfig{
+		{Type: "notch", Frequency: 100},
+		{Type: Peaking, Frequency: 0},
+		{Type: LowPass, Frequency: 30000},
+		{Type: HighPass, Frequency: 100, Q: -1},
+	} {
+		if _, err := newBiquad(f, 48000); err == nil {
+			t.Errorf("expected error for %+v", f)
+		}
+	}
+}
+
+func TestParseFilters(t *testing.T) {
+	filters, err := ParseFilters("peaking:60:-6:2, lowshelf:100:3,highpass:25")
+	if err != nil {
+		t.Fatalf("ParseFilters failed: %v", err)
+	}
+
+	want := []FilterConfig{
+		{Type: Peaking, Frequency: 60, Gain: -6, Q: 2},
+		{Type: LowShelf, Frequency: 100, Gain: 3},
+		{Type: HighPass, Frequency: 25},
+	}
+	if len(filters) != len(want) {
+		t.Fatalf("expected %d filters, got %d", len(want), len(filters))
+	}
+	for i := range want {
+		if filters[i] != want[i] {
+			t.Errorf("filter %d: got %+v, want %+v", i, filters[i], want[i])
+		}
+	}
+
+	for _, bad := range []string{"peaking", "peaking:abc", "shelf:100:3", "peaking:1:2:3:4"} {
+		if _, err := ParseFilter(bad); err == nil {
+			t.Errorf("expected error parsing %q", bad)
+		}
+	}
+}
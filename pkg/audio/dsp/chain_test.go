@@ -0,0 +1,115 @@
+// ABOUTME: Tests for the player processing chain
+// ABOUTME: Checks passthrough, preamp, EQ and convolution latency
+package dsp
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestChainEmptyIsPassthrough(t *testing.T) {
+	c, err := NewChain(ChainConfig{}, 48000, 2)
+	if err != nil {
+		t.Fatalf("NewChain failed: %v", err)
+	}
+	if c.Latency() != 0 {
+		t.Errorf("expected zero latency, got %d", c.Latency())
+	}
+
+	samples := []int32{1, -2, 8388607, -8388608}
+	want := append([]int32(nil), samples...)
+	c.Process(samples)
+	for i := range want {
+		if samples[i] != want[i] {
+			t.Errorf("sample %d changed: %d -> %d", i, want[i], samples[i])
+		}
+	}
+}
+
+func TestChainPreampAndFilters(t *testing.T) {
+	config := ChainConfig{
+		Preamp:  -6,
+		Filters: []FilterConfig{{Type: Peaking, Frequency: 1000, Gain: 6, Q: 1}},
+	}
+	c, err := NewChain(config, 48000, 1)
+	if err != nil {
+		t.Fatalf("NewChain failed: %v", err)
+	}
+
+	// -6dB preamp cancels +6dB at the peak frequency
+	samples := make([]int32, 48000)
+	for i := range samples {
+		samples[i] = int32(4000000 * math.Sin(2*math.Pi*1000*float64(i)/48000))
+	}
+	c.Process(samples)
+
+	var peak int32
+	for _, s := range samples[24000:] {
+		peak = max(peak, s)
+	}
+	if math.Abs(float64(peak)-4000000) > 4000000*0.01 {
+		t.Errorf("expected peak near 4000000, got %d", peak)
+	}
+}
+
+func TestChainConvolutionLatency(t *testing.T) {
+	// Identity impulse response: output is input delayed by the latency
+	path := filepath.Join(t.TempDir(), "identity.wav")
+	if err := os.WriteFile(path, buildWAV(t, wavFloat, 32, 1, 48000, []float64{1}), 0o644); err != nil {
+		t.Fatalf("failed to write WAV: %v", err)
+	}
+
+	c, err := NewChain(ChainConfig{ImpulseResponse: path}, 48000, 2)
+	if err != nil {
+		t.Fatalf("NewChain failed: %v", err)
+	}
+	latency := c.Latency()
+	if latency != ConvolverBlockSize {
+		t.Fatalf("expected latency %d, got %d", ConvolverBlockSize, latency)
+	}
+
+	frames := 3 * latency
+	samples := make([]int32, frames*2)
+	for i := range samples {
+		samples[i] = int32(i*1000) - 1000000
+	}
+	input := append([]int32(nil), samples...)
+	c.Process(samples)
+
+	for f := latency; f < frames; f++ {
+		for ch := 0; ch < 2; ch++ {
+			got := samples[f*2+ch]
+			want := input[(f-latency)*2+ch]
+			if diff := got - want; diff < -1 || diff > 1 {
+				t.Fatalf("frame %d ch %d: got %d, want %d", f, ch, got, want)
+			}
+		}
+	}
+
+	c.Reset()
+	silence := make([]int32, latency*2)
+	c.Process(silence)
+	for i, s := range silence {
+		if s < -1 || s > 1 {
+			t.Fatalf("expected silence after reset, got %d at %d", s, i)
+		}
+	}
+}
+
+func TestChainConfigValidate(t *testing.T) {
+	if !(ChainConfig{}).Empty() {
+		t.Error("zero config should be empty")
+	}
+	bad := ChainConfig{Filters: []FilterConfig{{Type: Peaking, Frequency: -1}}}
+	if err := bad.Validate(); err == nil {
+		t.Error("expected validation error")
+	}
+	if _, err := NewChain(bad, 48000, 2); err == nil {
+		t.Error("expected NewChain to reject invalid filter")
+	}
+	if _, err := NewChain(ChainConfig{ImpulseResponse: "/nonexistent.wav"}, 48000, 2); err == nil {
+		t.Error("expected NewChain to fail for missing impulse response")
+	}
+}
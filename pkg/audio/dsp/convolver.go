@@ -0,0 +1,168 @@
+// ABOUTME: Uniformly partitioned FFT convolution engine
+// ABOUTME: Applies long impulse responses (room correction) with fixed latency
+package dsp
+
+import (
+	"fmt"
+)
+
+// ConvolverBlockSize is the partition size in frames. Audio leaves the
+// convolver exactly this many frames after it goes in.
+const ConvolverBlockSize = 512
+
+// Convolver applies an impulse response to each channel using uniformly
+// partitioned overlap-save convolution: the impulse response is split into
+// blocks whose spectra are multiplied with a delay line of past input
+// spectra, so the cost per sample grows with IR length / block size rather
+// than IR length.
+type Convolver struct {
+	block    int
+	fft      *fft
+	channels []*convChannel
+}
+
+// convChannel is one channel's filter and streaming state
+type convChannel struct {
+	partitions [][]complex128 // IR block spectra (bins 0..block)
+
+	window  []complex128   // Last two input blocks, then scratch for transforms
+	input   []float64      // Previous and current input block
+	fill    int            // Frames of the current block received
+	spectra [][]complex128 // Delay line of input spectra (bins 0..block)
+	head    int            // Slot for the next input spectrum
+	output  []float64      // Output block being played out
+}
+
+// NewConvolver creates a convolver for interleaved audio. ir holds one
+// impulse response per channel, or a single one applied to every channel.
+func NewConvolver(ir [][]float64, channels int) (*Convolver, error) {
+	if len(ir) != 1 && len(ir) != channels {
+		return nil, fmt.Errorf("impulse response has %d channels, stream has %d", len(ir), channels)
+	}
+	for _, h := range ir {
+		if len(h) == 0 {
+			return nil, fmt.Errorf("impulse response is empty")
+		}
+	}
+
+	block := ConvolverBlockSize
+	c := &Convolver{
+		block: block,
+		fft:   newFFT(2 * block),
+	}
+
+	// Channels sharing an IR share its partition spectra
+	shared := make([][][]complex128, len(ir))
+	for i, h := range ir {
+		shared[i] = c.partition(h)
+	}
+
+	for ch := 0; ch < channels; ch++ {
+		partitions := shared[0]
+		if len(ir) > 1 {
+			partitions = shared[ch]
+		}
+		spectra := make([][]complex128, len(partitions))
+		for i := range spectra {
+			spectra[i] = make([]complex128, block+1)
+		}
+		c.channels = append(c.channels, &convChannel{
+			partitions: partitions,
+			window:     make([]complex128, 2*block),
+			input:      make([]float64, 2*block),
+			spectra:    spectra,
+			output:     make([]float64, block),
+		})
+	}
+	return c, nil
+}
+
+// partition splits an impulse response into blocks and transforms each,
+// zero-padded to twice the block size
+func (c *Convolver) partition(h []float64) [][]complex128 {
+	count := (len(h) + c.block - 1) / c.block
+	partitions := make([][]complex128, count)
+	buf := make([]complex128, 2*c.block)
+
+	for p := range partitions {
+		clear(buf)
+		for i := 0; i < c.block && p*c.block+i < len(h); i++ {
+			buf[i] = complex(h[p*c.block+i], 0)
+		}
+		c.fft.forward(buf)
+		partitions[p] = append([]complex128(nil), buf[:c.block+1]...)
+	}
+	return partitions
+}
+
+// Latency returns the delay the convolver adds, in frames
+func (c *Convolver) Latency() int {
+	return c.block
+}
+
+// Process convolves one sample of a channel, returning the output sample
+// from Latency frames earlier
+func (c *Convolver) Process(ch int, x float64) float64 {
+	st := c.channels[ch]
+
+	y := st.output[st.fill]
+	st.input[c.block+st.fill] = x
+	st.fill++
+
+	if st.fill == c.block {
+		c.processBlock(st)
+		st.fill = 0
+	}
+	return y
+}
+
+// processBlock runs one overlap-save step once a full input block is in
+func (c *Convolver) processBlock(st *convChannel) {
+	n := 2 * c.block
+
+	// Spectrum of the last two input blocks
+	for i, v := range st.input {
+		st.window[i] = complex(v, 0)
+	}
+	c.fft.forward(st.window)
+	copy(st.spectra[st.head], st.window[:c.block+1])
+
+	// Multiply-accumulate each IR block with the matching past input
+	acc := st.window
+	clear(acc)
+	slots := len(st.spectra)
+	for p, h := range st.partitions {
+		x := st.spectra[(st.head-p+slots)%slots]
+		for k := range h {
+			acc[k] += x[k] * h[k]
+		}
+	}
+
+	// Real input: the upper half of the spectrum mirrors the lower
+	for k := 1; k < c.block; k++ {
+		v := acc[k]
+		acc[n-k] = complex(real(v), -imag(v))
+	}
+	c.fft.inverse(acc)
+
+	// Overlap-save: the second half is free of circular wrap-around
+	for i := range st.output {
+		st.output[i] = real(acc[c.block+i])
+	}
+
+	copy(st.input[:c.block], st.input[c.block:])
+	st.head = (st.head + 1) % slots
+}
+
+// Reset clears all buffered audio
+func (c *Convolver) Reset() {
+	for _, st := range c.channels {
+		clear(st.input)
+		clear(st.output)
+		for _, s := range st.spectra {
+			clear(s)
+		}
+		st.fill = 0
+		st.head = 0
+	}
+}
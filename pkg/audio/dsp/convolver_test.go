@@ -0,0 +1,164 @@
+// ABOUTME: Tests for the partitioned FFT convolver
+// ABOUTME: Compares against direct convolution and checks latency and reset
+package dsp
+
+import (
+	"math"
+	"math/cmplx"
+	"math/rand"
+	"testing"
+)
+
+func TestFFTMatchesDFT(t *testing.T) {
+	const n = 64
+	rng := rand.New(rand.NewSource(1))
+	x := make([]complex128, n)
+	for i := range x {
+		x[i] = complex(rng.Float64()-0.5, rng.Float64()-0.5)
+	}
+
+	want := make([]complex128, n)
+	for k := range want {
+		for j, v := range x {
+			want[k] += v * cmplx.Exp(complex(0, -2*math.Pi*float64(j*k)/n))
+		}
+	}
+
+	got := append([]complex128(nil), x...)
+	f := newFFT(n)
+	f.forward(got)
+	for k := range want {
+		if cmplx.Abs(got[k]-want[k]) > 1e-9 {
+			t.Fatalf("bin %d: got %v, want %v", k, got[k], want[k])
+		}
+	}
+
+	f.inverse(got)
+	for i := range x {
+		if cmplx.Abs(got[i]-x[i]) > 1e-12 {
+			t.Fatalf("inverse sample %d: got %v, want %v", i, got[i], x[i])
+		}
+	}
+}
+
+// directConvolve is the reference time-domain convolution
+func directConvolve(x, h []float64) []float64 {
+	y := make([]float64, len(x))
+	for n := range y {
+		for k := 0; k < len(h) && k <= n; k++ {
+			y[n] += h[k] * x[n-k]
+		}
+	}
+	return y
+}
+
+func TestConvolverMatchesDirectConvolution(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+
+	// Several partitions, with a partial last block
+	h := make([]float64, 3*ConvolverBlockSize+100)
+	for i := range h {
+		h[i] = (rng.Float64() - 0.5) * math.Exp(-float64(i)/300)
+	}
+	left := make([]float64, 6000)
+	right := make([]float64, len(left))
+	for i := range left {
+		left[i] = rng.Float64() - 0.5
+		right[i] = math.Sin(float64(i) * 0.05)
+	}
+
+	c, err := NewConvolver([][]float64{h}, 2)
+	if err != nil {
+		t.Fatalf("NewConvolver failed: %v", err)
+	}
+
+	wantL := directConvolve(left, h)
+	wantR := directConvolve(right, h)
+	latency := c.Latency()
+
+	for i := range left {
+		gotL := c.Process(0, left[i])
+		gotR := c.Process(1, right[i])
+		if i < latency {
+			if gotL != 0 || gotR != 0 {
+				t.Fatalf("frame %d: expected silence during latency", i)
+			}
+			continue
+		}
+		if math.Abs(gotL-wantL[i-latency]) > 1e-9 || math.Abs(gotR-wantR[i-latency]) > 1e-9 {
+			t.Fatalf("frame %d: got (%g, %g), want (%g, %g)", i, gotL, gotR, wantL[i-latency], wantR[i-latency])
+		}
+	}
+}
+
+func TestConvolverPerChannelIR(t *testing.T) {
+	// Left passes through, right is inverted and delayed by 3 frames
+	c, err := NewConvolver([][]float64{{1}, {0, 0, 0, -1}}, 2)
+	if err != nil {
+		t.Fatalf("NewConvolver failed: %v", err)
+	}
+
+	latency := c.Latency()
+	for i := 0; i < latency+10; i++ {
+		x := float64(i + 1)
+		gotL := c.Process(0, x)
+		gotR := c.Process(1, x)
+
+		var wantL, wantR float64
+		if i >= latency {
+			wantL = float64(i - latency + 1)
+		}
+		if i >= latency+3 {
+			wantR = -float64(i - latency - 2)
+		}
+		if math.Abs(gotL-wantL) > 1e-9 || math.Abs(gotR-wantR) > 1e-9 {
+			t.Fatalf("frame %d: got (%g, %g), want (%g, %g)", i, gotL, gotR, wantL, wantR)
+		}
+	}
+}
+
+func TestConvolverReset(t *testing.T) {
+	c, err := NewConvolver([][]float64{{0.5, 0.5}}, 1)
+	if err != nil {
+		t.Fatalf("NewConvolver failed: %v", err)
+	}
+	for i := 0; i < 3*ConvolverBlockSize; i++ {
+		c.Process(0, 1)
+	}
+
+	c.Reset()
+	for i := 0; i < 2*ConvolverBlockSize; i++ {
+		if y := c.Process(0, 0); y != 0 {
+			t.Fatalf("expected silence after reset, got %g at %d", y, i)
+		}
+	}
+}
+
+func TestConvolverChannelMismatch(t *testing.T) {
+	if _, err := NewConvolver([][]float64{{1}, {1}, {1}}, 2); err == nil {
+		t.Error("expected error for 3-channel IR on a stereo stream")
+	}
+	if _, err := NewConvolver([][]float64{{}}, 2); err == nil {
+		t.Error("expected error for empty IR")
+	}
+}
+
+func BenchmarkConvolver(b *testing.B) {
+	// One second of stereo IR at 48kHz, 10ms of audio per iteration
+	h := make([]float64, 48000)
+	for i := range h {
+		h[i] = math.Exp(-float64(i) / 4800)
+	}
+	c, err := NewConvolver([][]float64{h}, 2)
+	if err != nil {
+		b.Fatalf("NewConvolver failed: %v", err)
+	}
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		for j := 0; j < 480; j++ {
+			c.Process(0, 0.1)
+			c.Process(1, 0.1)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+// ABOUTME: TPDF dither with optional noise shaping
+// ABOUTME: Requantizes 24-bit internal samples to lower bit depths
+package dsp
+
+import (
+	"math"
+
+	"github.com/Sendspin/sendspin-go/pkg/audio"
+)
+
+// NoiseShaping selects the error-feedback filter applied with dither
+type NoiseShaping int
+
+const (
+	// ShapingNone leaves the dither noise flat (white)
+	ShapingNone NoiseShaping = iota
+
+	// ShapingFirstOrder tilts the noise up by 6 dB/octave towards Nyquist
+	ShapingFirstOrder
+
+	// ShapingSecondOrder tilts the noise up by 12 dB/octave, giving the
+	// lowest noise in the low and mid frequencies
+	ShapingSecondOrder
+)
+
+// String returns the shaping name
+func (s NoiseShaping) String() string {
+	switch s {
+	case ShapingNone:
+		return "none"
+	case ShapingFirstOrder:
+		return "first-order"
+	case ShapingSecondOrder:
+		return "second-order"
+	default:
+		return "unknown"
+	}
+}
+
+// Dither requantizes samples in the internal 24-bit range to a lower bit
+// depth using TPDF dither. It keeps per-channel noise shaping state, so
+// use one Dither per stream; it is not safe for concurrent use.
+type Dither struct {
+	bitDepth int
+	channels int
+	scale    float64 // Internal units per output LSB
+	min, max int32   // Output range
+	shaping  NoiseShaping
+	errors   [][2]float64 // Per channel: last two quantization errors
+	rng      uint64
+}
+
+// NewDither creates a ditherer that reduces 24-bit internal samples to
+// bitDepth (1-24) for interleaved audio with the given channel count
+func NewDither(bitDepth, channels int, shaping NoiseShaping) *Dither {
+	bitDepth = min(max(bitDepth, 1), 24)
+	channels = max(channels, 1)
+
+	return &Dither{
+		bitDepth: bitDepth,
+		channels: channels,
+		scale:    float64(int64(1) << (24 - bitDepth)),
+		min:      -1 << (bitDepth - 1),
+		max:      1<<(bitDepth-1) - 1,
+		shaping:  shaping,
+		errors:   make([][2]float64, channels),
+		rng:      0x9E3779B97F4A7C15,
+	}
+}
+
+// BitDepth returns the output bit depth
+func (d *Dither) BitDepth() int {
+	return d.bitDepth
+}
+
+// Channels returns the interleaved channel count
+func (d *Dither) Channels() int {
+	return d.channels
+}
+
+// Reset clears the noise shaping state, e.g. after a seek or flush
+func (d *Dither) Reset() {
+	clear(d.errors)
+}
+
+// uniform returns a pseudo-random value in [0, 1) (xorshift64*)
+func (d *Dither) uniform() float64 {
+	d.rng ^= d.rng >> 12
+	d.rng ^= d.rng << 25
+	d.rng ^= d.rng >> 27
+	return float64((d.rng*0x2545F4914F6CDD1D)>>11) / (1 << 53)
+}
+
+// Quantize rounds a value in internal 24-bit units (which may carry a
+// fractional part, e.g. after gain) to the output bit depth, returning
+// it in output units clamped to the output range
+func (d *Dither) Quantize(value float64, ch int) int32 {
+	e := &d.errors[ch%d.channels]
+	v := value / d.scale
+
+	// Feed back past errors so the noise transfer is (1 - z^-1)^order
+	switch d.shaping {
+	case ShapingFirstOrder:
+		v -= e[0]
+	case ShapingSecondOrder:
+		v -= 2*e[0] - e[1]
+	}
+
+	// TPDF: the sum of two uniform variables spans +/-1 LSB
+	q := math.Floor(v + d.uniform() - d.uniform() + 0.5)
+
+	// The error stays bounded even when the output clips, keeping the
+	// feedback loop stable
+	e[1], e[0] = e[0], q-v
+
+	if q > float64(d.max) {
+		return d.max
+	}
+	if q < float64(d.min) {
+		return d.min
+	}
+	return int32(q)
+}
+
+// Reduce requantizes one internal sample to the output bit depth.
+// Samples already exact at the output depth (16-bit sources, digital
+// silence) pass through unchanged so they stay bit-perfect.
+func (d *Dither) Reduce(sample int32, ch int) int32 {
+	if d.bitDepth == 24 {
+		return min(max(sample, audio.Min24Bit), audio.Max24Bit)
+	}
+	shift := 24 - d.bitDepth
+	if sample&(1<<shift-1) == 0 {
+		d.errors[ch%d.channels] = [2]float64{}
+		return min(max(sample>>shift, d.min), d.max)
+	}
+	return d.Quantize(float64(sample), ch)
+}
+
+// ToInt16 requantizes interleaved internal samples into dst, which must
+// be at least len(src) long. The Dither must have a bit depth of 16.
+func (d *Dither) ToInt16(dst []int16, src []int32) {
+	for i, s := range src {
+		dst[i] = int16(d.Reduce(s, i%d.channels))
+	}
+}
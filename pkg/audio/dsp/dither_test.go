@@ -0,0 +1,223 @@
+// ABOUTME: Tests for TPDF dither and noise shaping
+// ABOUTME: Measures THD+N and harmonic distortion on low-level test tones
+package dsp
+
+import (
+	"math"
+	"testing"
+)
+
+const (
+	testRate = 48000
+	testFreq = 997 // Standard test tone; exactly bin 997 over one second
+)
+
+// tone returns one second of a 997 Hz sine at the given level (dBFS) in
+// the internal 24-bit range
+func tone(dbfs float64) []int32 {
+	amp := 8388607 * math.Pow(10, dbfs/20)
+	samples := make([]int32, testRate)
+	for i := range samples {
+		samples[i] = int32(amp * math.Sin(2*math.Pi*testFreq*float64(i)/testRate))
+	}
+	return samples
+}
+
+func truncate16(samples []int32) []float64 {
+	out := make([]float64, len(samples))
+	for i, s := range samples {
+		out[i] = float64(s >> 8)
+	}
+	return out
+}
+
+func dither16(samples []int32, shaping NoiseShaping) []float64 {
+	d := NewDither(16, 1, shaping)
+	pcm := make([]int16, len(samples))
+	d.ToInt16(pcm, samples)
+	out := make([]float64, len(pcm))
+	for i, s := range pcm {
+		out[i] = float64(s)
+	}
+	return out
+}
+
+// component returns the sine and cosine amplitudes at a frequency
+func component(x []float64, freq float64) (s, c float64) {
+	for i, v := range x {
+		phase := 2 * math.Pi * freq * float64(i) / testRate
+		s += v * math.Sin(phase)
+		c += v * math.Cos(phase)
+	}
+	return s * 2 / float64(len(x)), c * 2 / float64(len(x))
+}
+
+// fundamentalPower returns the power of the test tone in x
+func fundamentalPower(x []float64) float64 {
+	s, c := component(x, testFreq)
+	return (s*s + c*c) / 2
+}
+
+// residual removes DC and the fundamental, leaving noise plus distortion
+func residual(x []float64) []float64 {
+	var mean float64
+	for _, v := range x {
+		mean += v
+	}
+	mean /= float64(len(x))
+
+	s, c := component(x, testFreq)
+	r := make([]float64, len(x))
+	for i, v := range x {
+		phase := 2 * math.Pi * testFreq * float64(i) / testRate
+		r[i] = v - mean - s*math.Sin(phase) - c*math.Cos(phase)
+	}
+	return r
+}
+
+// lowpass applies a 4th-order Butterworth-style lowpass (two biquads)
+func lowpass(x []float64, cutoff float64) []float64 {
+	w := 2 * math.Pi * cutoff / testRate
+	alpha := math.Sin(w) / (2 * math.Sqrt2 / 2)
+	cw := math.Cos(w)
+	b0, b1, b2 := (1-cw)/2, 1-cw, (1-cw)/2
+	a0, a1, a2 := 1+alpha, -2*cw, 1-alpha
+
+	for pass := 0; pass < 2; pass++ {
+		y := make([]float64, len(x))
+		var x1, x2, y1, y2 float64
+		for i, v := range x {
+			y[i] = (b0*v + b1*x1 + b2*x2 - a1*y1 - a2*y2) / a0
+			x2, x1 = x1, v
+			y2, y1 = y1, y[i]
+		}
+		x = y
+	}
+	return x
+}
+
+func power(x []float64) float64 {
+	// Skip the filter's settling time
+	x = x[len(x)/10:]
+	var p float64
+	for _, v := range x {
+		p += v * v
+	}
+	return p / float64(len(x))
+}
+
+func db(ratio float64) float64 {
+	return 10 * math.Log10(ratio)
+}
+
+// thdnInBand returns THD+N (dB) measured below 4 kHz, where hearing is
+// most sensitive
+func thdnInBand(x []float64) float64 {
+	return db(power(lowpass(residual(x), 4000)) / fundamentalPower(x))
+}
+
+// harmonicDistortion returns the power of harmonics 2-10 relative to the
+// fundamental (dB)
+func harmonicDistortion(x []float64) float64 {
+	var h float64
+	for k := 2; k <= 10; k++ {
+		s, c := component(x, testFreq*float64(k))
+		h += (s*s + c*c) / 2
+	}
+	return db(h / fundamentalPower(x))
+}
+
+func TestDitherRemovesHarmonicDistortion(t *testing.T) {
+	in := tone(-80)
+
+	truncated := harmonicDistortion(truncate16(in))
+	dithered := harmonicDistortion(dither16(in, ShapingNone))
+	t.Logf("harmonic distortion at -80 dBFS: truncated %.1f dB, dithered %.1f dB", truncated, dithered)
+
+	if truncated-dithered < 15 {
+		t.Errorf("expected dither to cut harmonics by at least 15 dB, got %.1f dB", truncated-dithered)
+	}
+}
+
+func TestNoiseShapingImprovesTHDN(t *testing.T) {
+	for _, level := range []float64{-60, -80} {
+		in := tone(level)
+
+		truncated := thdnInBand(truncate16(in))
+		flat := thdnInBand(dither16(in, ShapingNone))
+		first := thdnInBand(dither16(in, ShapingFirstOrder))
+		second := thdnInBand(dither16(in, ShapingSecondOrder))
+		t.Logf("THD+N below 4 kHz at %.0f dBFS: truncated %.1f, flat %.1f, first-order %.1f, second-order %.1f dB",
+			level, truncated, flat, first, second)
+
+		if truncated-second < 6 {
+			t.Errorf("%.0f dBFS: expected second-order shaping at least 6 dB better than truncation, got %.1f dB", level, truncated-second)
+		}
+		if !(second < first && first < flat) {
+			t.Errorf("%.0f dBFS: expected in-band THD+N to fall with shaping order", level)
+		}
+	}
+}
+
+func TestDitherPreservesSubLSBSignal(t *testing.T) {
+	// Under one 16-bit LSB peak, dither keeps the quantizer linear
+	in := tone(-95)
+	want := fundamentalPower(scale16(in))
+	dithered := fundamentalPower(dither16(in, ShapingNone))
+
+	if math.Abs(db(dithered/want)) > 1 {
+		t.Errorf("expected dithered tone level within 1 dB of the input, got %.1f dB", db(dithered/want))
+	}
+}
+
+// scale16 scales samples to 16-bit units without quantizing
+func scale16(samples []int32) []float64 {
+	out := make([]float64, len(samples))
+	for i, s := range samples {
+		out[i] = float64(s) / 256
+	}
+	return out
+}
+
+func TestDitherExactSamplesPassThrough(t *testing.T) {
+	d := NewDither(16, 2, ShapingSecondOrder)
+
+	src := []int32{0, 0, 0x7FFF00, -0x800000, 0x123400, -0x567800}
+	dst := make([]int16, len(src))
+	d.ToInt16(dst, src)
+
+	for i, s := range src {
+		if dst[i] != int16(s>>8) {
+			t.Errorf("sample %d: got %d, want %d", i, dst[i], int16(s>>8))
+		}
+	}
+}
+
+func TestDitherQuantizeClamps(t *testing.T) {
+	d := NewDither(16, 1, ShapingSecondOrder)
+
+	for i := 0; i < 1000; i++ {
+		if got := d.Quantize(9e6, 0); got != 32767 {
+			t.Fatalf("expected clamp to 32767, got %d", got)
+		}
+	}
+	for i := 0; i < 1000; i++ {
+		if got := d.Quantize(-9e6, 0); got != -32768 {
+			t.Fatalf("expected clamp to -32768, got %d", got)
+		}
+	}
+}
+
+func TestDither24BitIsUnbiased(t *testing.T) {
+	d := NewDither(24, 1, ShapingNone)
+
+	// A constant half-LSB value should average out to itself
+	var sum float64
+	const n = 100000
+	for i := 0; i < n; i++ {
+		sum += float64(d.Quantize(1000.5, 0))
+	}
+	if mean := sum / n; math.Abs(mean-1000.5) > 0.02 {
+		t.Errorf("expected mean 1000.5, got %.3f", mean)
+	}
+}
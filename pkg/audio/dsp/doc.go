@@ -0,0 +1,27 @@
+// ABOUTME: Audio signal processing package
+// ABOUTME: Provides dither, parametric EQ, convolution and channel mixing
+// Package dsp provides audio signal processing stages.
+//
+// Dither adds triangular (TPDF) noise before rounding whenever samples
+// are requantized, turning the correlated distortion of plain truncation
+// into a constant, signal-independent noise floor. Optional error-feedback
+// noise shaping moves that noise towards Nyquist, where it is least audible.
+//
+// Chain runs a player's processing between the scheduler and the output:
+// preamp, biquad parametric EQ bands, then partitioned FFT convolution
+// with an impulse response (e.g. for room correction).
+//
+// Matrix mixes channels, e.g. to send one side of a stereo pair or a mono
+// downmix to a player. Downmix builds the ITU-R BS.775 matrix that folds
+// surround layouts (5.1, 7.1) down to stereo or mono.
+//
+// Example:
+//
+//	d := dsp.NewDither(16, 2, dsp.ShapingNone)
+//	pcm := make([]int16, len(samples))
+//	d.ToInt16(pcm, samples)
+//
+//	filters, _ := dsp.ParseFilters("peaking:60:-6:2,highshelf:8000:-2")
+//	chain, err := dsp.NewChain(dsp.ChainConfig{Preamp: -3, Filters: filters}, 48000, 2)
+//	chain.Process(samples)
+package dsp
@@ -0,0 +1,72 @@
+// ABOUTME: Radix-2 fast Fourier transform
+// ABOUTME: In-place complex FFT used by the partitioned convolver
+package dsp
+
+import (
+	"math"
+	"math/bits"
+)
+
+// fft computes in-place complex transforms of a fixed power-of-two size
+type fft struct {
+	n       int
+	twiddle []complex128 // e^(-2πik/n) for k < n/2
+	rev     []int        // Bit-reversal permutation
+}
+
+// newFFT prepares transforms of size n, which must be a power of two
+func newFFT(n int) *fft {
+	f := &fft{
+		n:       n,
+		twiddle: make([]complex128, n/2),
+		rev:     make([]int, n),
+	}
+	for k := range f.twiddle {
+		angle := -2 * math.Pi * float64(k) / float64(n)
+		f.twiddle[k] = complex(math.Cos(angle), math.Sin(angle))
+	}
+	shift := 64 - bits.TrailingZeros(uint(n))
+	for i := range f.rev {
+		f.rev[i] = int(bits.Reverse64(uint64(i)) >> shift)
+	}
+	return f
+}
+
+// forward replaces x with its discrete Fourier transform
+func (f *fft) forward(x []complex128) {
+	f.transform(x, false)
+}
+
+// inverse replaces x with its inverse transform, scaled by 1/n
+func (f *fft) inverse(x []complex128) {
+	f.transform(x, true)
+	scale := complex(1/float64(f.n), 0)
+	for i := range x {
+		x[i] *= scale
+	}
+}
+
+func (f *fft) transform(x []complex128, inverse bool) {
+	for i, j := range f.rev {
+		if i < j {
+			x[i], x[j] = x[j], x[i]
+		}
+	}
+
+	for size := 2; size <= f.n; size <<= 1 {
+		half := size / 2
+		stride := f.n / size
+		for start := 0; start < f.n; start += size {
+			for k := 0; k < half; k++ {
+				w := f.twiddle[k*stride]
+				if inverse {
+					w = complex(real(w), -imag(w))
+				}
+				a := x[start+k]
+				b := x[start+k+half] * w
+				x[start+k] = a + b
+				x[start+k+half] = a - b
+			}
+		}
+	}
+}
@@ -0,0 +1,196 @@
+// ABOUTME: Impulse response loading for convolution
+// ABOUTME: Reads WAV impulse responses and converts them to the stream sample rate
+package dsp
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+
+	"github.com/Sendspin/sendspin-go/pkg/audio/resample"
+)
+
+// MaxImpulseSeconds limits impulse response length to keep convolution
+// cost and memory bounded
+const MaxImpulseSeconds = 5
+
+// WAV format tags
+const (
+	wavPCM        = 1
+	wavFloat      = 3
+	wavExtensible = 0xFFFE
+)
+
+// LoadImpulseResponse reads a WAV impulse response and converts it to the
+// given sample rate. It returns one slice per channel of linear gain
+// coefficients. Only regular files are read, so devices and pipes can't
+// stall the caller.
+func LoadImpulseResponse(path string, sampleRate int) ([][]float64, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open impulse response: %w", err)
+	}
+	if !info.Mode().IsRegular() {
+		return nil, fmt.Errorf("impulse response %s is not a regular file", path)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open impulse response: %w", err)
+	}
+	defer f.Close()
+
+	ir, err := ReadImpulseResponse(f, sampleRate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load impulse response %s: %w", path, err)
+	}
+	return ir, nil
+}
+
+// ReadImpulseResponse reads a WAV impulse response (PCM 16/24/32-bit or
+// float 32/64-bit) from r and converts it to the given sample rate
+func ReadImpulseResponse(r io.Reader, sampleRate int) ([][]float64, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read WAV: %w", err)
+	}
+	if len(data) < 12 || string(data[0:4]) != "RIFF" || string(data[8:12]) != "WAVE" {
+		return nil, fmt.Errorf("not a WAV file")
+	}
+
+	var (
+		formatTag, channels, bitsPerSample int
+		rate                               int
+		samples                            []byte
+		haveFormat                         bool
+	)
+
+	for pos := 12; pos+8 <= len(data); {
+		id := string(data[pos : pos+4])
+		size := int(binary.LittleEndian.Uint32(data[pos+4 : pos+8]))
+		body := data[pos+8 : min(pos+8+size, len(data))]
+
+		switch id {
+		case "fmt ":
+			if len(body) < 16 {
+				return nil, fmt.Errorf("fmt chunk too short")
+			}
+			formatTag = int(binary.LittleEndian.Uint16(body[0:2]))
+			channels = int(binary.LittleEndian.Uint16(body[2:4]))
+			rate = int(binary.LittleEndian.Uint32(body[4:8]))
+			bitsPerSample = int(binary.LittleEndian.Uint16(body[14:16]))
+			if formatTag == wavExtensible && len(body) >= 26 {
+				formatTag = int(binary.LittleEndian.Uint16(body[24:26]))
+			}
+			haveFormat = true
+		case "data":
+			samples = body
+		}
+
+		// Chunks are padded to an even size
+		pos += 8 + size + size%2
+	}
+
+	if !haveFormat || samples == nil {
+		return nil, fmt.Errorf("missing fmt or data chunk")
+	}
+	if channels < 1 || rate < 1 {
+		return nil, fmt.Errorf("invalid format: %d channels at %dHz", channels, rate)
+	}
+
+	decode, err := sampleDecoder(formatTag, bitsPerSample)
+	if err != nil {
+		return nil, err
+	}
+
+	width := bitsPerSample / 8
+	frames := len(samples) / (width * channels)
+	if frames == 0 {
+		return nil, fmt.Errorf("impulse response is empty")
+	}
+	if frames > MaxImpulseSeconds*rate {
+		return nil, fmt.Errorf("impulse response is %.1fs long (max %ds)", float64(frames)/float64(rate), MaxImpulseSeconds)
+	}
+
+	ir := make([][]float64, channels)
+	for ch := range ir {
+		ir[ch] = make([]float64, frames)
+		for i := range ir[ch] {
+			off := (i*channels + ch) * width
+			ir[ch][i] = decode(samples[off : off+width])
+		}
+	}
+
+	if rate != sampleRate {
+		for ch := range ir {
+			ir[ch] = resampleIR(ir[ch], rate, sampleRate)
+		}
+	}
+	return ir, nil
+}
+
+// sampleDecoder returns a function converting one WAV sample to [-1, 1)
+func sampleDecoder(formatTag, bits int) (func([]byte) float64, error) {
+	switch {
+	case formatTag == wavPCM && bits == 16:
+		return func(b []byte) float64 {
+			return float64(int16(binary.LittleEndian.Uint16(b))) / (1 << 15)
+		}, nil
+	case formatTag == wavPCM && bits == 24:
+		return func(b []byte) float64 {
+			v := int32(b[0]) | int32(b[1])<<8 | int32(int8(b[2]))<<16
+			return float64(v) / (1 << 23)
+		}, nil
+	case formatTag == wavPCM && bits == 32:
+		return func(b []byte) float64 {
+			return float64(int32(binary.LittleEndian.Uint32(b))) / (1 << 31)
+		}, nil
+	case formatTag == wavFloat && bits == 32:
+		return func(b []byte) float64 {
+			return float64(math.Float32frombits(binary.LittleEndian.Uint32(b)))
+		}, nil
+	case formatTag == wavFloat && bits == 64:
+		return func(b []byte) float64 {
+			return math.Float64frombits(binary.LittleEndian.Uint64(b))
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported WAV format %d with %d bits (supported: PCM 16/24/32-bit, float 32/64-bit)", formatTag, bits)
+	}
+}
+
+// resampleIR converts an impulse response between sample rates, keeping
+// its frequency response: taps are rescaled so the DC gain is unchanged
+func resampleIR(h []float64, from, to int) []float64 {
+	var peak float64
+	for _, v := range h {
+		peak = max(peak, math.Abs(v))
+	}
+	if peak == 0 {
+		return make([]float64, len(h)*to/from+1)
+	}
+
+	// Work in the resampler's 24-bit range with headroom for ringing
+	scale := 0.5 * 8388607 / peak
+	r := resample.NewWithQuality(from, to, 1, resample.QualityBest)
+	in := make([]int32, len(h)+r.Latency()+1)
+	for i, v := range h {
+		in[i] = int32(math.Round(v * scale))
+	}
+
+	out := make([]int32, len(in)*to/from+2)
+	n := r.Resample(in, out)
+
+	// Skip the resampler's delay so the response keeps its timing
+	skip := int(math.Round(float64(r.Latency()) * float64(to) / float64(from)))
+	length := (len(h)*to + from - 1) / from
+	result := make([]float64, length)
+	gain := float64(from) / float64(to) / scale
+	for i := range result {
+		if skip+i < n {
+			result[i] = float64(out[skip+i]) * gain
+		}
+	}
+	return result
+}
@@ -0,0 +1,134 @@
+// ABOUTME: Tests for impulse response loading
+// ABOUTME: Writes WAV files in several formats and checks decoding and resampling
+package dsp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// buildWAV encodes interleaved samples in [-1, 1] as a WAV file
+func buildWAV(t *testing.T, formatTag, bits, channels, rate int, samples []float64) []byte {
+	t.Helper()
+
+	var data bytes.Buffer
+	for _, v := range samples {
+		switch {
+		case formatTag == wavPCM && bits == 16:
+			binary.Write(&data, binary.LittleEndian, int16(math.Round(v*32767)))
+		case formatTag == wavPCM && bits == 24:
+			s := int32(math.Round(v * 8388607))
+			data.Write([]byte{byte(s), byte(s >> 8), byte(s >> 16)})
+		case formatTag == wavFloat && bits == 32:
+			binary.Write(&data, binary.LittleEndian, float32(v))
+		default:
+			t.Fatalf("unsupported test format %d/%d", formatTag, bits)
+		}
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("RIFF")
+	binary.Write(&buf, binary.LittleEndian, uint32(4+(8+16)+(8+data.Len())+(8+2)))
+	buf.WriteString("WAVE")
+	buf.WriteString("fmt ")
+	binary.Write(&buf, binary.LittleEndian, uint32(16))
+	binary.Write(&buf, binary.LittleEndian, uint16(formatTag))
+	binary.Write(&buf, binary.LittleEndian, uint16(channels))
+	binary.Write(&buf, binary.LittleEndian, uint32(rate))
+	binary.Write(&buf, binary.LittleEndian, uint32(rate*channels*bits/8))
+	binary.Write(&buf, binary.LittleEndian, uint16(channels*bits/8))
+	binary.Write(&buf, binary.LittleEndian, uint16(bits))
+	// An unknown odd-sized chunk before the data must be skipped
+	buf.WriteString("junk")
+	binary.Write(&buf, binary.LittleEndian, uint32(1))
+	buf.Write([]byte{0, 0})
+	buf.WriteString("data")
+	binary.Write(&buf, binary.LittleEndian, uint32(data.Len()))
+	buf.Write(data.Bytes())
+	return buf.Bytes()
+}
+
+func TestReadImpulseResponseFormats(t *testing.T) {
+	// Stereo: left is a decaying pulse, right its inverse
+	samples := []float64{0.5, -0.5, 0.25, -0.25, -0.125, 0.125}
+
+	for _, tt := range []struct {
+		name      string
+		formatTag int
+		bits      int
+		tolerance float64
+	}{
+		{"pcm16", wavPCM, 16, 1.0 / 32768},
+		{"pcm24", wavPCM, 24, 1.0 / 8388608},
+		{"float32", wavFloat, 32, 1e-7},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			wav := buildWAV(t, tt.formatTag, tt.bits, 2, 48000, samples)
+			ir, err := ReadImpulseResponse(bytes.NewReader(wav), 48000)
+			if err != nil {
+				t.Fatalf("ReadImpulseResponse failed: %v", err)
+			}
+			if len(ir) != 2 || len(ir[0]) != 3 {
+				t.Fatalf("expected 2 channels of 3 frames, got %d channels", len(ir))
+			}
+			for i, v := range samples {
+				got := ir[i%2][i/2]
+				if math.Abs(got-v) > tt.tolerance {
+					t.Errorf("sample %d: got %g, want %g", i, got, v)
+				}
+			}
+		})
+	}
+}
+
+func TestReadImpulseResponseRejectsInvalid(t *testing.T) {
+	if _, err := ReadImpulseResponse(bytes.NewReader([]byte("not a wav file")), 48000); err == nil {
+		t.Error("expected error for non-WAV data")
+	}
+
+	// Longer than MaxImpulseSeconds
+	long := make([]float64, (MaxImpulseSeconds+1)*8000)
+	wav := buildWAV(t, wavPCM, 16, 1, 8000, long)
+	if _, err := ReadImpulseResponse(bytes.NewReader(wav), 8000); err == nil {
+		t.Error("expected error for over-long impulse response")
+	}
+}
+
+func TestLoadImpulseResponseResamples(t *testing.T) {
+	// A short lowpass kernel (moving average) at 44.1kHz: unity DC gain
+	h := make([]float64, 32)
+	for i := range h {
+		h[i] = 1.0 / float64(len(h))
+	}
+	path := filepath.Join(t.TempDir(), "ir.wav")
+	if err := os.WriteFile(path, buildWAV(t, wavFloat, 32, 1, 44100, h), 0o644); err != nil {
+		t.Fatalf("failed to write WAV: %v", err)
+	}
+
+	ir, err := LoadImpulseResponse(path, 96000)
+	if err != nil {
+		t.Fatalf("LoadImpulseResponse failed: %v", err)
+	}
+	if want := (len(h)*96000 + 44099) / 44100; len(ir[0]) != want {
+		t.Errorf("expected %d taps, got %d", want, len(ir[0]))
+	}
+
+	var dc float64
+	for _, v := range ir[0] {
+		dc += v
+	}
+	if math.Abs(dc-1) > 0.02 {
+		t.Errorf("DC gain changed by resampling: got %.4f, want 1", dc)
+	}
+
+	if _, err := LoadImpulseResponse(filepath.Join(t.TempDir(), "missing.wav"), 48000); err == nil {
+		t.Error("expected error for missing file")
+	}
+	if _, err := LoadImpulseResponse(t.TempDir(), 48000); err == nil {
+		t.Error("expected error for a directory")
+	}
+}
@@ -0,0 +1,136 @@
+// ABOUTME: Channel mixing matrix
+// ABOUTME: Maps interleaved input channels to output channels with per-pair gains
+package dsp
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/Sendspin/sendspin-go/pkg/audio"
+)
+
+// Matrix mixes channels: each row is an output channel holding one gain
+// per input channel, so out[o] = Σ Matrix[o][i] * in[i]
+type Matrix [][]float64
+
+// Validate checks that the matrix maps the given number of input channels
+func (m Matrix) Validate(inChannels int) error {
+	if len(m) == 0 {
+		return fmt.Errorf("channel matrix has no outputs")
+	}
+	for o, row := range m {
+		if len(row) != inChannels {
+			return fmt.Errorf("channel matrix row %d has %d gains, stream has %d channels", o+1, len(row), inChannels)
+		}
+		for _, g := range row {
+			if math.IsNaN(g) || math.IsInf(g, 0) {
+				return fmt.Errorf("channel matrix row %d has an invalid gain", o+1)
+			}
+		}
+	}
+	return nil
+}
+
+// DownmixHeadroom is the gain applied to every downmix of a surround
+// layout, about -7.7dB: 1/(1+√2) is the largest gain sum of the BS.775 3/2
+// stereo downmix, so full-scale 5.x sources can't clip. A fully correlated
+// 6.1 or 7.1 mix can still go over and is clamped by Apply.
+const DownmixHeadroom = 1 / (1 + math.Sqrt2)
+
+// Downmix returns the ITU-R BS.775 downmix of the default layout for
+// inChannels to stereo (outChannels 2) or mono (outChannels 1). Front
+// channels are mixed in at 1, centre and surround channels at 0.707 (-3dB)
+// and LFE is dropped, then surround layouts are scaled by DownmixHeadroom.
+// Mono is the average of the stereo downmix.
+func Downmix(inChannels, outChannels int) (Matrix, error) {
+	layout, err := audio.LayoutFor(inChannels)
+	if err != nil {
+		return nil, err
+	}
+	if outChannels != 1 && outChannels != 2 {
+		return nil, fmt.Errorf("downmix to %d channels not supported (1 or 2)", outChannels)
+	}
+
+	const minus3dB = math.Sqrt2 / 2
+	left, right := make([]float64, inChannels), make([]float64, inChannels)
+	for i, pos := range layout.Positions {
+		switch pos {
+		case audio.FrontLeft:
+			left[i] = 1
+		case audio.FrontRight:
+			right[i] = 1
+		case audio.FrontCenter:
+			left[i], right[i] = minus3dB, minus3dB
+		case audio.BackLeft, audio.SideLeft:
+			left[i] = minus3dB
+		case audio.BackRight, audio.SideRight:
+			right[i] = minus3dB
+		case audio.BackCenter:
+			// A surround at -3dB, split between both sides for -6dB each
+			left[i], right[i] = 0.5, 0.5
+		}
+	}
+
+	// A mono layout has its only channel at the centre
+	if inChannels == 1 {
+		left[0], right[0] = 1, 1
+	}
+	if inChannels > 2 {
+		for i := range left {
+			left[i] *= DownmixHeadroom
+			right[i] *= DownmixHeadroom
+		}
+	}
+
+	if outChannels == 1 {
+		mono := make([]float64, inChannels)
+		for i := range mono {
+			mono[i] = (left[i] + right[i]) / 2
+		}
+		return Matrix{mono}, nil
+	}
+	return Matrix{left, right}, nil
+}
+
+// After returns the matrix that applies first and then m
+func (m Matrix) After(first Matrix) Matrix {
+	out := make(Matrix, len(m))
+	for o, row := range m {
+		out[o] = make([]float64, len(first[0]))
+		for k, g := range row {
+			for i, h := range first[k] {
+				out[o][i] += g * h
+			}
+		}
+	}
+	return out
+}
+
+// Outputs returns the number of output channels
+func (m Matrix) Outputs() int {
+	return len(m)
+}
+
+// Apply mixes interleaved samples with inChannels channels into dst,
+// which is grown as needed, and returns the mixed samples. Results are
+// clamped to the 24-bit range.
+func (m Matrix) Apply(dst, src []int32, inChannels int) []int32 {
+	frames := len(src) / inChannels
+	outChannels := len(m)
+	if cap(dst) < frames*outChannels {
+		dst = make([]int32, frames*outChannels)
+	}
+	dst = dst[:frames*outChannels]
+
+	for f := 0; f < frames; f++ {
+		in := src[f*inChannels : (f+1)*inChannels]
+		for o, row := range m {
+			var sum float64
+			for i, g := range row {
+				sum += g * float64(in[i])
+			}
+			dst[f*outChannels+o] = int32(math.Round(max(min(sum, audio.Max24Bit), audio.Min24Bit)))
+		}
+	}
+	return dst
+}
@@ -0,0 +1,116 @@
+// ABOUTME: Tests for the channel mixing matrix
+// ABOUTME: Checks channel selection, downmix, clamping and validation
+package dsp
+
+import (
+	"math"
+	"testing"
+)
+
+func TestMatrixApply(t *testing.T) {
+	src := []int32{100, -200, 300, 400}
+
+	left := Matrix{{1, 0}}
+	if got := left.Apply(nil, src, 2); len(got) != 2 || got[0] != 100 || got[1] != 300 {
+		t.Errorf("left: got %v", got)
+	}
+
+	mono := Matrix{{0.5, 0.5}}
+	if got := mono.Apply(nil, src, 2); len(got) != 2 || got[0] != -50 || got[1] != 350 {
+		t.Errorf("mono: got %v", got)
+	}
+
+	// Swapped stereo reuses the destination buffer
+	dst := make([]int32, 0, 8)
+	swap := Matrix{{0, 1}, {1, 0}}
+	got := swap.Apply(dst, src, 2)
+	if &got[0] != &dst[:1][0] || got[0] != -200 || got[1] != 100 || got[2] != 400 || got[3] != 300 {
+		t.Errorf("swap: got %v", got)
+	}
+
+	// Sums are clamped to the 24-bit range
+	loud := Matrix{{1, 1}}
+	if got := loud.Apply(nil, []int32{8000000, 8000000, -8000000, -8000000}, 2); got[0] != 8388607 || got[1] != -8388608 {
+		t.Errorf("expected clamped sum, got %v", got)
+	}
+}
+
+func TestMatrixValidate(t *testing.T) {
+	if err := (Matrix{{1, 0}, {0, 1}}).Validate(2); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := (Matrix{}).Validate(2); err == nil {
+		t.Error("expected error for empty matrix")
+	}
+	if err := (Matrix{{1, 0, 0}}).Validate(2); err == nil {
+		t.Error("expected error for mismatched row")
+	}
+}
+
+func TestDownmix(t *testing.T) {
+	// 5.1 (FL FR FC LFE BL BR): BS.775 gains of 1 for the fronts, 0.707
+	// for centre and surrounds, no LFE, all at the downmix headroom
+	m, err := Downmix(6, 2)
+	if err != nil {
+		t.Fatalf("Downmix failed: %v", err)
+	}
+	h, c := DownmixHeadroom, math.Sqrt2/2*DownmixHeadroom
+	want := Matrix{
+		{h, 0, c, 0, c, 0},
+		{0, h, c, 0, 0, c},
+	}
+	for o := range want {
+		for i := range want[o] {
+			if math.Abs(m[o][i]-want[o][i]) > 1e-12 {
+				t.Fatalf("expected %v, got %v", want, m)
+			}
+		}
+	}
+	if db := 20 * math.Log10(DownmixHeadroom); math.Abs(db+7.66) > 0.01 {
+		t.Errorf("expected about -7.66dB of headroom, got %.2fdB", db)
+	}
+
+	// Full-scale input on every channel of up to 5.1 cannot clip
+	for channels := 1; channels <= 6; channels++ {
+		for _, out := range []int{1, 2} {
+			m, err := Downmix(channels, out)
+			if err != nil {
+				t.Fatalf("Downmix(%d, %d) failed: %v", channels, out, err)
+			}
+			for _, row := range m {
+				var total float64
+				for _, g := range row {
+					total += g
+				}
+				if total > 1+1e-12 {
+					t.Errorf("Downmix(%d, %d): gains sum to %f", channels, out, total)
+				}
+			}
+		}
+	}
+
+	// Mono is the average of the stereo downmix
+	mono, _ := Downmix(6, 1)
+	if math.Abs(mono[0][2]-c) > 1e-12 || math.Abs(mono[0][0]-h/2) > 1e-12 {
+		t.Errorf("expected the average of the stereo rows, got %v", mono)
+	}
+
+	// Stereo to stereo is the identity
+	if m, _ := Downmix(2, 2); m[0][0] != 1 || m[0][1] != 0 || m[1][1] != 1 {
+		t.Errorf("expected identity, got %v", m)
+	}
+	if _, err := Downmix(6, 4); err == nil {
+		t.Error("expected error for unsupported output")
+	}
+	if _, err := Downmix(9, 2); err == nil {
+		t.Error("expected error for unsupported input")
+	}
+}
+
+func TestMatrixAfter(t *testing.T) {
+	downmix, _ := Downmix(6, 2)
+	left := Matrix{{1, 0}}.After(downmix)
+	if len(left) != 1 || len(left[0]) != 6 || left[0][0] != downmix[0][0] || left[0][1] != 0 {
+		t.Errorf("expected left row of the downmix, got %v", left)
+	}
+}
@@ -2,7 +2,8 @@
 // ABOUTME: Provides Encoder interface and implementations for PCM, Opus
 // Package encode provides audio encoders for various codecs.
 //
-// Supports: PCM (16-bit and 24-bit), Opus
+// Supports: PCM (16-bit and 24-bit), Opus (mono, stereo and multistream
+// surround up to 7.1)
 //
 // All encoders accept int32 samples in 24-bit range and encode
 // to wire format.
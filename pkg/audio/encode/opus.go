@@ -1,60 +1,197 @@
 // ABOUTME: Opus audio encoder
-// ABOUTME: Encodes int32 samples to Opus bytes
+// ABOUTME: Encodes int32 samples to Opus bytes, using multistream packets above two channels
 package encode
 
 import (
+	"encoding/binary"
 	"fmt"
+	"log"
 
 	"github.com/Sendspin/sendspin-go/pkg/audio"
+	"github.com/Sendspin/sendspin-go/pkg/audio/dsp"
 	"gopkg.in/hraban/opus.v2"
 )
 
-// OpusEncoder encodes Opus audio
+// maxOpusPacket is the largest packet one Opus stream produces
+const maxOpusPacket = 4000
+
+// OpusEncoder encodes Opus audio. Streams with more than two channels are
+// encoded as Opus multistream (RFC 7845 channel mapping family 1): one
+// stereo or mono Opus stream per channel pair, joined into one packet.
 type OpusEncoder struct {
-	encoder    *opus.Encoder
+	streams    []*opus.Encoder
+	layout     opusLayout
 	sampleRate int
 	channels   int
 	frameSize  int
+	dither     *dsp.Dither // Requantizes to Opus's 16-bit input
+	pcm        [][]int16   // Per-stream input buffers
+}
+
+// opusLayout describes how channels are split into Opus streams
+type opusLayout struct {
+	family  byte   // Channel mapping family (0: mono/stereo, 1: Vorbis order)
+	coupled int    // Streams carrying two channels; they come first
+	mapping []byte // Decoded channel index for each channel in Vorbis order
+	order   []int  // WAVE index for each channel in Vorbis order
+}
+
+// vorbisStreams holds the stream and coupled stream counts and the
+// mapping for each channel count, as chosen by libopus for family 1
+var vorbisStreams = [audio.MaxChannels + 1]struct {
+	streams, coupled int
+	mapping          []byte
+}{
+	1: {1, 0, []byte{0}},
+	2: {1, 1, []byte{0, 1}},
+	3: {2, 1, []byte{0, 2, 1}},
+	4: {2, 2, []byte{0, 1, 2, 3}},
+	5: {3, 2, []byte{0, 4, 1, 2, 3}},
+	6: {4, 2, []byte{0, 4, 1, 2, 3, 5}},
+	7: {4, 3, []byte{0, 4, 1, 2, 3, 5, 6}},
+	8: {5, 3, []byte{0, 6, 1, 2, 3, 4, 5, 7}},
 }
 
 // NewOpus creates a new Opus encoder
 func NewOpus(format audio.Format) (Encoder, error) {
+	encoder, err := NewOpusEncoder(format)
+	if err != nil {
+		return nil, err
+	}
+	return encoder, nil
+}
+
+// NewOpusEncoder creates a new Opus encoder for 1 to 8 channels
+func NewOpusEncoder(format audio.Format) (*OpusEncoder, error) {
 	if format.Codec != "opus" {
 		return nil, fmt.Errorf("invalid codec for Opus encoder: %s", format.Codec)
 	}
-
-	encoder, err := opus.NewEncoder(format.SampleRate, format.Channels, opus.AppAudio)
+	order, err := audio.VorbisOrder(format.Channels)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create opus encoder: %w", err)
 	}
 
-	// Opus frame size depends on sample rate
-	frameSize := format.SampleRate / 50 // 20ms frame
+	table := vorbisStreams[format.Channels]
+	layout := opusLayout{coupled: table.coupled, mapping: table.mapping, order: order}
+	if format.Channels > 2 {
+		layout.family = 1
+	}
 
-	return &OpusEncoder{
-		encoder:    encoder,
+	e := &OpusEncoder{
+		layout:     layout,
 		sampleRate: format.SampleRate,
 		channels:   format.Channels,
-		frameSize:  frameSize,
-	}, nil
+		// Opus frame size depends on sample rate
+		frameSize: format.SampleRate / 50, // 20ms frame
+		dither:    dsp.NewDither(16, format.Channels, dsp.ShapingNone),
+	}
+	for i := 0; i < table.streams; i++ {
+		streamChannels := 1
+		if i < table.coupled {
+			streamChannels = 2
+		}
+		encoder, err := opus.NewEncoder(format.SampleRate, streamChannels, opus.AppAudio)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create opus encoder: %w", err)
+		}
+		// 128 kbps per channel keeps music transparent
+		if err := encoder.SetBitrate(128000 * streamChannels); err != nil {
+			log.Printf("Warning: Failed to set Opus bitrate: %v", err)
+		}
+		e.streams = append(e.streams, encoder)
+	}
+	return e, nil
 }
 
 // Encode converts int32 samples to Opus bytes
 func (e *OpusEncoder) Encode(samples []int32) ([]byte, error) {
-	// Convert int32 to int16 for Opus
+	// Dither int32 down to int16 for Opus; shaped noise would waste bits
 	pcm := make([]int16, len(samples))
-	for i, sample := range samples {
-		pcm[i] = audio.SampleToInt16(sample)
+	e.dither.ToInt16(pcm, samples)
+
+	if len(e.streams) == 1 {
+		data := make([]byte, maxOpusPacket)
+		n, err := e.streams[0].Encode(pcm, data)
+		if err != nil {
+			return nil, fmt.Errorf("opus encode error: %w", err)
+		}
+		return data[:n], nil
 	}
 
-	// Encode to Opus
-	data := make([]byte, 4000) // Max Opus packet size
-	n, err := e.encoder.Encode(pcm, data)
-	if err != nil {
-		return nil, fmt.Errorf("opus encode error: %w", err)
+	e.splitStreams(pcm)
+
+	// Every stream but the last uses self-delimiting framing
+	var packet []byte
+	data := make([]byte, maxOpusPacket)
+	for i, stream := range e.streams {
+		n, err := stream.Encode(e.pcm[i], data)
+		if err != nil {
+			return nil, fmt.Errorf("opus encode error in stream %d: %w", i, err)
+		}
+		if i == len(e.streams)-1 {
+			packet = append(packet, data[:n]...)
+			break
+		}
+		if packet, err = appendSelfDelimited(packet, data[:n]); err != nil {
+			return nil, fmt.Errorf("opus encode error in stream %d: %w", i, err)
+		}
 	}
+	return packet, nil
+}
 
-	return data[:n], nil
+// splitStreams deinterleaves WAVE-ordered samples into per-stream buffers
+func (e *OpusEncoder) splitStreams(pcm []int16) {
+	frames := len(pcm) / e.channels
+	if e.pcm == nil {
+		e.pcm = make([][]int16, len(e.streams))
+	}
+	for i := range e.pcm {
+		width := 1
+		if i < e.layout.coupled {
+			width = 2
+		}
+		if cap(e.pcm[i]) < frames*width {
+			e.pcm[i] = make([]int16, frames*width)
+		}
+		e.pcm[i] = e.pcm[i][:frames*width]
+	}
+
+	for c, wave := range e.layout.order {
+		stream, sub, width := e.layout.stream(e.layout.mapping[c])
+		buf := e.pcm[stream]
+		for f := 0; f < frames; f++ {
+			buf[f*width+sub] = pcm[f*e.channels+wave]
+		}
+	}
+}
+
+// stream returns the stream, the channel within it and its channel count
+// for a decoded channel index
+func (l opusLayout) stream(index byte) (stream, sub, width int) {
+	d := int(index)
+	if d < 2*l.coupled {
+		return d / 2, d % 2, 2
+	}
+	return d - l.coupled, 0, 1
+}
+
+// Header returns the OpusHead identification header (RFC 7845) describing
+// the stream, sent as the codec header in stream/start. Pre-skip is 0:
+// chunk timestamps already place every packet.
+func (e *OpusEncoder) Header() []byte {
+	head := make([]byte, 19, 21+e.channels)
+	copy(head, "OpusHead")
+	head[8] = 1 // Version
+	head[9] = byte(e.channels)
+	binary.LittleEndian.PutUint16(head[10:12], 0)
+	binary.LittleEndian.PutUint32(head[12:16], uint32(e.sampleRate))
+	binary.LittleEndian.PutUint16(head[16:18], 0) // Output gain
+	head[18] = e.layout.family
+	if e.layout.family != 0 {
+		head = append(head, byte(len(e.streams)), byte(e.layout.coupled))
+		head = append(head, e.layout.mapping...)
+	}
+	return head
 }
 
 // Close releases resources
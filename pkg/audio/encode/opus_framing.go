@@ -0,0 +1,117 @@
+// ABOUTME: Opus self-delimiting packet framing
+// ABOUTME: Converts Opus packets to the framing used inside multistream packets (RFC 6716 Appendix B)
+package encode
+
+import "fmt"
+
+// appendSelfDelimited appends an Opus packet in self-delimiting framing:
+// the size of the frame whose length is normally implied by the packet
+// length is written after the other frame lengths.
+func appendSelfDelimited(dst, packet []byte) ([]byte, error) {
+	headerEnd, implied, err := opusImpliedLength(packet)
+	if err != nil {
+		return nil, err
+	}
+	dst = append(dst, packet[:headerEnd]...)
+	dst = appendFrameLength(dst, implied)
+	return append(dst, packet[headerEnd:]...), nil
+}
+
+// opusImpliedLength parses a packet's TOC byte and frame lengths (RFC 6716
+// section 3.2) and returns where the frame lengths end and the size of
+// the frame whose length is implied
+func opusImpliedLength(packet []byte) (headerEnd, implied int, err error) {
+	if len(packet) < 1 {
+		return 0, 0, fmt.Errorf("empty opus packet")
+	}
+	payload := len(packet) - 1
+
+	switch packet[0] & 0x3 {
+	case 0: // One frame
+		return 1, payload, nil
+
+	case 1: // Two frames of equal size
+		if payload%2 != 0 {
+			return 0, 0, fmt.Errorf("invalid opus packet: odd size for two equal frames")
+		}
+		return 1, payload / 2, nil
+
+	case 2: // Two frames, the first size given
+		first, n, err := readFrameLength(packet[1:])
+		if err != nil {
+			return 0, 0, err
+		}
+		rest := payload - n - first
+		if rest < 0 {
+			return 0, 0, fmt.Errorf("invalid opus packet: frame exceeds packet")
+		}
+		return 1 + n, rest, nil
+
+	default: // Any number of frames, with optional padding
+		if len(packet) < 2 {
+			return 0, 0, fmt.Errorf("invalid opus packet: missing frame count")
+		}
+		vbr, padded, count := packet[1]&0x80 != 0, packet[1]&0x40 != 0, int(packet[1]&0x3f)
+		if count == 0 {
+			return 0, 0, fmt.Errorf("invalid opus packet: no frames")
+		}
+		pos := 2
+		padding := 0
+		for padded {
+			if pos >= len(packet) {
+				return 0, 0, fmt.Errorf("invalid opus packet: truncated padding")
+			}
+			b := int(packet[pos])
+			pos++
+			if b == 255 {
+				padding += 254
+			} else {
+				padding += b
+				padded = false
+			}
+		}
+
+		data := len(packet) - pos - padding
+		if vbr {
+			for i := 0; i < count-1; i++ {
+				size, n, err := readFrameLength(packet[pos:])
+				if err != nil {
+					return 0, 0, err
+				}
+				pos += n
+				data -= n + size
+			}
+			if data < 0 {
+				return 0, 0, fmt.Errorf("invalid opus packet: frames exceed packet")
+			}
+			return pos, data, nil
+		}
+		if data < 0 || data%count != 0 {
+			return 0, 0, fmt.Errorf("invalid opus packet: uneven constant frame sizes")
+		}
+		return pos, data / count, nil
+	}
+}
+
+// readFrameLength reads a one- or two-byte frame length
+func readFrameLength(b []byte) (size, n int, err error) {
+	if len(b) < 1 {
+		return 0, 0, fmt.Errorf("invalid opus packet: truncated frame length")
+	}
+	if b[0] < 252 {
+		return int(b[0]), 1, nil
+	}
+	if len(b) < 2 {
+		return 0, 0, fmt.Errorf("invalid opus packet: truncated frame length")
+	}
+	return int(b[1])*4 + int(b[0]), 2, nil
+}
+
+// appendFrameLength writes a frame length in one or two bytes
+func appendFrameLength(dst []byte, size int) []byte {
+	if size < 252 {
+		return append(dst, byte(size))
+	}
+	first := 252 + size&0x3
+	return append(dst, byte(first), byte((size-first)/4))
+}
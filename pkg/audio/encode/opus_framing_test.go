@@ -0,0 +1,43 @@
+// ABOUTME: Tests for Opus self-delimiting framing
+// ABOUTME: Checks the extra frame length for every packet code
+package encode
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestAppendSelfDelimited(t *testing.T) {
+	long := append([]byte{0x00}, make([]byte, 300)...)
+
+	tests := []struct {
+		name   string
+		packet []byte
+		want   []byte
+	}{
+		{"one frame", []byte{0x00, 1, 2, 3}, []byte{0x00, 3, 1, 2, 3}},
+		{"two equal frames", []byte{0x01, 1, 2, 3, 4}, []byte{0x01, 2, 1, 2, 3, 4}},
+		{"two frames", []byte{0x02, 1, 9, 1, 2}, []byte{0x02, 1, 2, 9, 1, 2}},
+		{"constant frames with padding", []byte{0x03, 0x42, 1, 1, 2, 3, 4, 0}, []byte{0x03, 0x42, 1, 2, 1, 2, 3, 4, 0}},
+		{"variable frames", []byte{0x03, 0x83, 1, 2, 9, 8, 8, 1, 2, 3}, []byte{0x03, 0x83, 1, 2, 3, 9, 8, 8, 1, 2, 3}},
+		{"two-byte length", long, append([]byte{0x00, 252, 12}, long[1:]...)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := appendSelfDelimited(nil, tt.packet)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+
+	for _, bad := range [][]byte{nil, {0x01, 1, 2, 3}, {0x02, 9, 1}, {0x03}, {0x03, 0x00}, {0x03, 0x02, 1, 2, 3}} {
+		if _, err := appendSelfDelimited(nil, bad); err == nil {
+			t.Errorf("expected error for %v", bad)
+		}
+	}
+}
@@ -160,3 +160,54 @@ func TestOpusEncoder_Close(t *testing.T) {
 		t.Errorf("Close() unexpected error = %v", err)
 	}
 }
+
+func TestOpusEncoder_Multistream(t *testing.T) {
+	format := audio.Format{Codec: "opus", SampleRate: 48000, Channels: 6, BitDepth: 16}
+
+	encoder, err := NewOpusEncoder(format)
+	if err != nil {
+		t.Fatalf("NewOpusEncoder() failed: %v", err)
+	}
+	defer encoder.Close()
+
+	// 5.1 is two stereo streams (FL/FR, BL/BR) and two mono streams (FC, LFE)
+	head := encoder.Header()
+	want := []byte{1, 6, 0, 0, 0x80, 0xbb, 0, 0, 0, 0, 1, 4, 2, 0, 4, 1, 2, 3, 5}
+	if string(head[:8]) != "OpusHead" || string(head[8:]) != string(want) {
+		t.Errorf("unexpected OpusHead %v", head)
+	}
+
+	// Each WAVE channel (FL FR FC LFE BL BR) lands in its stream
+	frames := 48000 / 50
+	samples := make([]int32, frames*6)
+	for f := 0; f < frames; f++ {
+		for ch := 0; ch < 6; ch++ {
+			samples[f*6+ch] = int32(ch+1) << 16
+		}
+	}
+	output, err := encoder.Encode(samples)
+	if err != nil {
+		t.Fatalf("Encode() failed: %v", err)
+	}
+	if len(output) == 0 {
+		t.Error("Encode() returned empty output")
+	}
+
+	streams := [][]int16{{1, 2}, {5, 6}, {3}, {4}}
+	for i, stream := range streams {
+		got := encoder.pcm[i]
+		if len(got) != frames*len(stream) {
+			t.Fatalf("stream %d: expected %d samples, got %d", i, frames*len(stream), len(got))
+		}
+		for j, ch := range stream {
+			// Dither adds at most one LSB
+			if v := got[j]; v < ch<<8-1 || v > ch<<8+1 {
+				t.Errorf("stream %d channel %d: expected WAVE channel %d, got %d", i, j, ch, v)
+			}
+		}
+	}
+
+	if _, err := NewOpusEncoder(audio.Format{Codec: "opus", SampleRate: 48000, Channels: 9}); err == nil {
+		t.Error("expected error for 9 channels")
+	}
+}
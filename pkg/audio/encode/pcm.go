@@ -7,11 +7,13 @@ import (
 	"fmt"
 
 	"github.com/Sendspin/sendspin-go/pkg/audio"
+	"github.com/Sendspin/sendspin-go/pkg/audio/dsp"
 )
 
 // PCMEncoder encodes PCM audio
 type PCMEncoder struct {
 	bitDepth int
+	dither   *dsp.Dither // Requantizes 16-bit output
 }
 
 // NewPCM creates a new PCM encoder
@@ -24,9 +26,13 @@ func NewPCM(format audio.Format) (Encoder, error) {
 		return nil, fmt.Errorf("unsupported bit depth: %d (supported: 16, 24)", format.BitDepth)
 	}
 
-	return &PCMEncoder{
+	encoder := &PCMEncoder{
 		bitDepth: format.BitDepth,
-	}, nil
+	}
+	if format.BitDepth == 16 {
+		encoder.dither = dsp.NewDither(16, format.Channels, dsp.ShapingNone)
+	}
+	return encoder, nil
 }
 
 // Encode converts int32 samples to PCM bytes
@@ -44,8 +50,9 @@ func (e *PCMEncoder) Encode(samples []int32) ([]byte, error) {
 	} else {
 		// 16-bit PCM: 2 bytes per sample
 		output := make([]byte, len(samples)*2)
+		channels := e.dither.Channels()
 		for i, sample := range samples {
-			sample16 := audio.SampleToInt16(sample)
+			sample16 := int16(e.dither.Reduce(sample, i%channels))
 			binary.LittleEndian.PutUint16(output[i*2:], uint16(sample16))
 		}
 		return output, nil
@@ -0,0 +1,79 @@
+// ABOUTME: Channel layouts for multichannel audio
+// ABOUTME: Names speaker positions in stream channel order (WAVE/SMPTE) for 1-8 channels
+package audio
+
+import "fmt"
+
+// MaxChannels is the most channels a stream can carry (7.1)
+const MaxChannels = 8
+
+// Speaker positions
+const (
+	FrontLeft   = "FL"
+	FrontRight  = "FR"
+	FrontCenter = "FC"
+	LowFreq     = "LFE"
+	BackLeft    = "BL"
+	BackRight   = "BR"
+	BackCenter  = "BC"
+	SideLeft    = "SL"
+	SideRight   = "SR"
+)
+
+// ChannelLayout names the speaker of each channel. Channels are
+// interleaved in WAVE (SMPTE) order, the order FLAC and WAV files use.
+type ChannelLayout struct {
+	Name      string   // e.g. "stereo", "5.1"
+	Positions []string // One speaker position per channel
+}
+
+// layouts holds the default layout for each channel count
+var layouts = [MaxChannels + 1]ChannelLayout{
+	1: {"mono", []string{FrontCenter}},
+	2: {"stereo", []string{FrontLeft, FrontRight}},
+	3: {"3.0", []string{FrontLeft, FrontRight, FrontCenter}},
+	4: {"quad", []string{FrontLeft, FrontRight, BackLeft, BackRight}},
+	5: {"5.0", []string{FrontLeft, FrontRight, FrontCenter, BackLeft, BackRight}},
+	6: {"5.1", []string{FrontLeft, FrontRight, FrontCenter, LowFreq, BackLeft, BackRight}},
+	7: {"6.1", []string{FrontLeft, FrontRight, FrontCenter, LowFreq, BackCenter, SideLeft, SideRight}},
+	8: {"7.1", []string{FrontLeft, FrontRight, FrontCenter, LowFreq, BackLeft, BackRight, SideLeft, SideRight}},
+}
+
+// vorbisOrder maps each channel in Vorbis order (used by Opus) to its
+// index in WAVE order
+var vorbisOrder = [MaxChannels + 1][]int{
+	1: {0},
+	2: {0, 1},
+	3: {0, 2, 1},
+	4: {0, 1, 2, 3},
+	5: {0, 2, 1, 3, 4},
+	6: {0, 2, 1, 4, 5, 3},
+	7: {0, 2, 1, 5, 6, 4, 3},
+	8: {0, 2, 1, 6, 7, 4, 5, 3},
+}
+
+// LayoutFor returns the default layout for a channel count
+func LayoutFor(channels int) (ChannelLayout, error) {
+	if channels < 1 || channels > MaxChannels {
+		return ChannelLayout{}, fmt.Errorf("unsupported channel count %d (1-%d)", channels, MaxChannels)
+	}
+	return layouts[channels], nil
+}
+
+// LayoutName returns the layout name for a channel count, or "Nch" when
+// there is no default layout
+func LayoutName(channels int) string {
+	if layout, err := LayoutFor(channels); err == nil {
+		return layout.Name
+	}
+	return fmt.Sprintf("%dch", channels)
+}
+
+// VorbisOrder returns, for each channel in Vorbis order, its index in
+// WAVE order. Opus multistream (channel mapping family 1) uses Vorbis order.
+func VorbisOrder(channels int) ([]int, error) {
+	if _, err := LayoutFor(channels); err != nil {
+		return nil, err
+	}
+	return vorbisOrder[channels], nil
+}
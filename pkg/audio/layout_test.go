@@ -0,0 +1,57 @@
+// ABOUTME: Tests for channel layouts
+// ABOUTME: Checks layout lookup and the Vorbis channel order used by Opus
+package audio
+
+import "testing"
+
+func TestLayoutFor(t *testing.T) {
+	for channels := 1; channels <= MaxChannels; channels++ {
+		layout, err := LayoutFor(channels)
+		if err != nil {
+			t.Fatalf("LayoutFor(%d): %v", channels, err)
+		}
+		if len(layout.Positions) != channels {
+			t.Errorf("LayoutFor(%d): expected %d positions, got %v", channels, channels, layout.Positions)
+		}
+	}
+	if _, err := LayoutFor(0); err == nil {
+		t.Error("expected error for 0 channels")
+	}
+	if _, err := LayoutFor(MaxChannels + 1); err == nil {
+		t.Error("expected error for too many channels")
+	}
+
+	if got := LayoutName(6); got != "5.1" {
+		t.Errorf("expected 5.1, got %q", got)
+	}
+	if got := LayoutName(12); got != "12ch" {
+		t.Errorf("expected 12ch, got %q", got)
+	}
+}
+
+func TestVorbisOrder(t *testing.T) {
+	// 7.1 in Vorbis order is FL FC FR SL SR BL BR LFE
+	want := []string{FrontLeft, FrontCenter, FrontRight, SideLeft, SideRight, BackLeft, BackRight, LowFreq}
+	order, err := VorbisOrder(8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	layout, _ := LayoutFor(8)
+	for i, wave := range order {
+		if layout.Positions[wave] != want[i] {
+			t.Errorf("Vorbis channel %d: expected %s, got %s", i, want[i], layout.Positions[wave])
+		}
+	}
+
+	// Every order is a permutation
+	for channels := 1; channels <= MaxChannels; channels++ {
+		order, _ := VorbisOrder(channels)
+		seen := make(map[int]bool)
+		for _, wave := range order {
+			if wave < 0 || wave >= channels || seen[wave] {
+				t.Errorf("VorbisOrder(%d) is not a permutation: %v", channels, order)
+			}
+			seen[wave] = true
+		}
+	}
+}
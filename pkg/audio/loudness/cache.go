@@ -0,0 +1,110 @@
+// ABOUTME: On-disk cache of loudness analysis results
+// ABOUTME: Stores one JSON file per analyzed audio file, keyed by path, size and mtime
+package loudness
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// cacheVersion is bumped when analysis changes so stale results are ignored
+const cacheVersion = 1
+
+// Cache stores analysis results so files are only scanned once. Entries
+// are invalidated when a file's size or modification time changes.
+type Cache struct {
+	dir string
+}
+
+// NewCache returns a cache in dir. An empty dir uses sendspin/loudness in
+// the user cache directory.
+func NewCache(dir string) (*Cache, error) {
+	if dir == "" {
+		base, err := os.UserCacheDir()
+		if err != nil {
+			return nil, fmt.Errorf("failed to find cache directory: %w", err)
+		}
+		dir = filepath.Join(base, "sendspin", "loudness")
+	}
+	return &Cache{dir: dir}, nil
+}
+
+// Dir returns the cache directory
+func (c *Cache) Dir() string {
+	return c.dir
+}
+
+// Load returns the cached result for a file, if present and current
+func (c *Cache) Load(path string) (Info, bool) {
+	key, err := cacheKey(path)
+	if err != nil {
+		return Info{}, false
+	}
+
+	data, err := os.ReadFile(filepath.Join(c.dir, key+".json"))
+	if err != nil {
+		return Info{}, false
+	}
+
+	var info Info
+	if err := json.Unmarshal(data, &info); err != nil || info.Empty() {
+		return Info{}, false
+	}
+	return info, true
+}
+
+// Store saves the result for a file
+func (c *Cache) Store(path string, info Info) error {
+	key, err := cacheKey(path)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(info)
+	if err != nil {
+		return fmt.Errorf("failed to encode loudness: %w", err)
+	}
+	if err := os.MkdirAll(c.dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create loudness cache: %w", err)
+	}
+
+	// Write then rename so readers never see a partial entry
+	tmp, err := os.CreateTemp(c.dir, key+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to write loudness cache: %w", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write loudness cache: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write loudness cache: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(c.dir, key+".json")); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write loudness cache: %w", err)
+	}
+	return nil
+}
+
+// cacheKey identifies a version of a file
+func cacheKey(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve %s: %w", path, err)
+	}
+	fi, err := os.Stat(abs)
+	if err != nil {
+		return "", fmt.Errorf("failed to stat %s: %w", path, err)
+	}
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%d\x00%s\x00%d\x00%d", cacheVersion, abs, fi.Size(), fi.ModTime().UnixNano())
+	return hex.EncodeToString(h.Sum(nil))[:32], nil
+}
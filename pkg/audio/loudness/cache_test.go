@@ -0,0 +1,52 @@
+// ABOUTME: Tests for the loudness analysis cache
+// ABOUTME: Checks round trips and invalidation when files change
+package loudness
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCacheRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	audioFile := filepath.Join(dir, "track.flac")
+	if err := os.WriteFile(audioFile, []byte("audio"), 0o644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	cache, err := NewCache(filepath.Join(dir, "cache"))
+	if err != nil {
+		t.Fatalf("NewCache failed: %v", err)
+	}
+	if _, ok := cache.Load(audioFile); ok {
+		t.Fatal("expected empty cache")
+	}
+
+	info := Analyzed(-11.5, 0.97)
+	if err := cache.Store(audioFile, info); err != nil {
+		t.Fatalf("Store failed: %v", err)
+	}
+
+	got, ok := cache.Load(audioFile)
+	if !ok {
+		t.Fatal("expected cached result")
+	}
+	if got.Source != SourceAnalysis || got.Loudness != -11.5 || got.Track == nil || *got.Track != *info.Track {
+		t.Errorf("cached result differs: got %+v, want %+v", got, info)
+	}
+
+	// Changing the file invalidates the entry
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(audioFile, later, later); err != nil {
+		t.Fatalf("failed to touch file: %v", err)
+	}
+	if _, ok := cache.Load(audioFile); ok {
+		t.Error("expected modified file to miss the cache")
+	}
+
+	if err := cache.Store(filepath.Join(dir, "missing.flac"), info); err == nil {
+		t.Error("expected error storing a result for a missing file")
+	}
+}
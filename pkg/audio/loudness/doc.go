@@ -0,0 +1,20 @@
+// ABOUTME: Loudness measurement and normalization package
+// ABOUTME: Provides EBU R128 metering, ReplayGain selection and a true-peak limiter
+// Package loudness measures and normalizes programme loudness.
+//
+// Meter implements the ITU-R BS.1770 / EBU R128 integrated loudness
+// measurement (K-weighting, 400ms gated blocks) along with a 4x
+// oversampled true-peak meter. Info holds ReplayGain-style track and album
+// gains, read from tags or derived from a measurement, and Normalizer
+// applies the gain selected by a Mode through a true-peak Limiter.
+//
+// Example:
+//
+//	meter := loudness.NewMeter(48000, 2)
+//	meter.Add(samples)
+//	info := loudness.Analyzed(meter.Integrated(), meter.TruePeak())
+//
+//	n := loudness.NewNormalizer(loudness.ModeTrack, loudness.ReferenceLoudness, 48000, 2)
+//	n.SetSource(info, album)
+//	n.Process(samples)
+package loudness
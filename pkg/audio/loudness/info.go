@@ -0,0 +1,152 @@
+// ABOUTME: ReplayGain values and normalization modes
+// ABOUTME: Parses ReplayGain tags and selects the gain to apply for a mode
+package loudness
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ReferenceLoudness is the ReplayGain 2.0 reference level (LUFS) that
+// gains in tags and analysis results bring audio to
+const ReferenceLoudness = -18.0
+
+// Mode selects which gain normalization applies
+type Mode string
+
+const (
+	// ModeOff applies no gain
+	ModeOff Mode = "off"
+
+	// ModeTrack levels every track to the target
+	ModeTrack Mode = "track"
+
+	// ModeAlbum keeps the relative levels of an album's tracks, falling
+	// back to the track gain when there is no album gain
+	ModeAlbum Mode = "album"
+
+	// ModeAuto uses the album gain while consecutive sources come from the
+	// same album and the track gain otherwise
+	ModeAuto Mode = "auto"
+)
+
+// ParseMode parses a mode name; the empty string is ModeOff
+func ParseMode(s string) (Mode, error) {
+	switch m := Mode(strings.ToLower(strings.TrimSpace(s))); m {
+	case "":
+		return ModeOff, nil
+	case ModeOff, ModeTrack, ModeAlbum, ModeAuto:
+		return m, nil
+	default:
+		return "", fmt.Errorf("unknown normalization mode %q (supported: off, track, album, auto)", s)
+	}
+}
+
+// Gain is a ReplayGain value: the gain (dB) that brings audio to the
+// reference loudness, and its peak amplitude (1.0 = full scale)
+type Gain struct {
+	Gain float64 `json:"gain"`
+	Peak float64 `json:"peak"`
+}
+
+// Info is a source's loudness. Track and Album are nil when unknown.
+type Info struct {
+	Track *Gain `json:"track,omitempty"`
+	Album *Gain `json:"album,omitempty"`
+
+	// Loudness is the measured integrated loudness (LUFS); zero when the
+	// values come from tags
+	Loudness float64 `json:"loudness,omitempty"`
+
+	// Source is "tags" or "analysis"
+	Source string `json:"source"`
+}
+
+// Info sources
+const (
+	SourceTags     = "tags"
+	SourceAnalysis = "analysis"
+)
+
+// Analyzed returns the Info for a measured integrated loudness and true
+// peak. Silent audio gets no gain.
+func Analyzed(integrated, truePeak float64) Info {
+	info := Info{Source: SourceAnalysis}
+	if math.IsInf(integrated, -1) {
+		info.Track = &Gain{Peak: truePeak}
+		return info
+	}
+	info.Loudness = integrated
+	info.Track = &Gain{Gain: ReferenceLoudness - integrated, Peak: truePeak}
+	return info
+}
+
+// Empty reports whether the info holds no gain
+func (i Info) Empty() bool {
+	return i.Track == nil && i.Album == nil
+}
+
+// Select returns the gain for a mode. albumContinues reports whether the
+// previous source came from the same album (used by ModeAuto). ok is
+// false when the mode is off or no suitable gain is known.
+func (i Info) Select(mode Mode, albumContinues bool) (gain Gain, ok bool) {
+	first := func(gains ...*Gain) (Gain, bool) {
+		for _, g := range gains {
+			if g != nil {
+				return *g, true
+			}
+		}
+		return Gain{}, false
+	}
+
+	switch mode {
+	case ModeTrack:
+		return first(i.Track, i.Album)
+	case ModeAlbum:
+		return first(i.Album, i.Track)
+	case ModeAuto:
+		if albumContinues {
+			return first(i.Album, i.Track)
+		}
+		return first(i.Track, i.Album)
+	default:
+		return Gain{}, false
+	}
+}
+
+// ParseTags builds an Info from ReplayGain tag values, looked up by
+// upper-case tag name (e.g. REPLAYGAIN_TRACK_GAIN = "-6.54 dB"). ok is
+// false when no gain tag is present or parsable.
+func ParseTags(tags map[string]string) (info Info, ok bool) {
+	parse := func(gainTag, peakTag string) *Gain {
+		value, found := tags[gainTag]
+		if !found {
+			return nil
+		}
+		gain, err := parseDB(value)
+		if err != nil {
+			return nil
+		}
+		g := &Gain{Gain: gain, Peak: 1}
+		if peak, err := strconv.ParseFloat(strings.TrimSpace(tags[peakTag]), 64); err == nil && peak > 0 {
+			g.Peak = peak
+		}
+		return g
+	}
+
+	info = Info{
+		Track:  parse("REPLAYGAIN_TRACK_GAIN", "REPLAYGAIN_TRACK_PEAK"),
+		Album:  parse("REPLAYGAIN_ALBUM_GAIN", "REPLAYGAIN_ALBUM_PEAK"),
+		Source: SourceTags,
+	}
+	return info, !info.Empty()
+}
+
+// parseDB parses a gain such as "-6.54 dB" or "+1.2"
+func parseDB(s string) (float64, error) {
+	s = strings.TrimSpace(strings.ToLower(s))
+	s = strings.TrimSpace(strings.TrimSuffix(s, "db"))
+	return strconv.ParseFloat(strings.TrimPrefix(s, "+"), 64)
+}
@@ -0,0 +1,147 @@
+// ABOUTME: Lookahead true-peak limiter
+// ABOUTME: Keeps normalized audio under a dBTP ceiling without clipping
+package loudness
+
+import (
+	"math"
+)
+
+const (
+	// DefaultCeiling is the limiter's true-peak ceiling (dBTP), leaving
+	// headroom for lossy encoding and inter-sample overs in players
+	DefaultCeiling = -1.0
+
+	// limiterLookahead is how far ahead the gain reacts to peaks (seconds)
+	limiterLookahead = 0.002
+
+	// limiterRelease is the time constant for gain recovery after a peak (seconds)
+	limiterRelease = 0.1
+)
+
+// Limiter is a lookahead true-peak limiter for interleaved float samples.
+// The gain for each frame is the minimum needed over the lookahead
+// window, smoothed by a moving average of the same length so it ramps
+// down before a peak arrives; it then recovers exponentially. Audio is
+// delayed by Latency frames.
+type Limiter struct {
+	channels  int
+	ceiling   float64
+	lookahead int
+	release   float64
+
+	peaks []truePeak
+
+	// Minimum of required gains over the last lookahead frames, kept as a
+	// monotonic deque of (frame, gain)
+	minFrames []int64
+	minGains  []float64
+	frame     int64
+
+	envelope float64   // Released minimum gain
+	average  []float64 // Last lookahead envelope values
+	avgPos   int
+	avgSum   float64
+
+	delay    []float64 // Interleaved audio delay line
+	delayPos int
+}
+
+// NewLimiter creates a limiter with a ceiling in dBTP relative to the
+// given full-scale amplitude
+func NewLimiter(sampleRate, channels int, ceilingDB, fullScale float64) *Limiter {
+	lookahead := max(int(float64(sampleRate)*limiterLookahead), 1)
+	l := &Limiter{
+		channels:  channels,
+		ceiling:   math.Pow(10, ceilingDB/20) * fullScale,
+		lookahead: lookahead,
+		release:   math.Exp(-1 / (float64(sampleRate) * limiterRelease)),
+		peaks:     make([]truePeak, channels),
+		average:   make([]float64, lookahead),
+	}
+	l.delay = make([]float64, l.Latency()*channels)
+	l.Reset()
+	return l
+}
+
+// Latency returns the delay the limiter adds, in frames
+func (l *Limiter) Latency() int {
+	// The true-peak estimate lags its sample, and the smoothed gain for a
+	// frame is known lookahead-1 frames after the frame arrives
+	return truePeakDelay + l.lookahead - 1
+}
+
+// Process limits one frame in place
+func (l *Limiter) Process(frame []float64) {
+	// Gain needed for the frame whose true peak is now known
+	var peak float64
+	for ch, x := range frame {
+		peak = max(peak, l.peaks[ch].process(x))
+	}
+	required := 1.0
+	if peak > l.ceiling {
+		required = l.ceiling / peak
+	}
+
+	// Sliding minimum over the lookahead window
+	for n := len(l.minGains); n > 0 && l.minGains[n-1] >= required; n-- {
+		l.minGains = l.minGains[:n-1]
+		l.minFrames = l.minFrames[:n-1]
+	}
+	l.minGains = append(l.minGains, required)
+	l.minFrames = append(l.minFrames, l.frame)
+	if l.minFrames[0] <= l.frame-int64(l.lookahead) {
+		l.minGains = l.minGains[1:]
+		l.minFrames = l.minFrames[1:]
+	}
+	l.frame++
+
+	// Release towards unity, but never above the window minimum
+	l.envelope = min(l.minGains[0], 1-(1-l.envelope)*l.release)
+
+	// Moving average over the lookahead
+	l.avgSum += l.envelope - l.average[l.avgPos]
+	l.average[l.avgPos] = l.envelope
+	l.avgPos = (l.avgPos + 1) % l.lookahead
+	gain := min(l.avgSum/float64(l.lookahead), 1)
+	if l.avgPos == 0 {
+		// Re-sum periodically so rounding errors can't accumulate
+		l.avgSum = 0
+		for _, v := range l.average {
+			l.avgSum += v
+		}
+	}
+
+	// Swap the frame with the delayed one and apply the gain
+	if len(l.delay) == 0 {
+		for ch := range frame {
+			frame[ch] *= gain
+		}
+		return
+	}
+	delayed := l.delay[l.delayPos : l.delayPos+l.channels]
+	for ch := range frame {
+		frame[ch], delayed[ch] = delayed[ch]*gain, frame[ch]
+	}
+	l.delayPos += l.channels
+	if l.delayPos == len(l.delay) {
+		l.delayPos = 0
+	}
+}
+
+// Reset clears the limiter's state and buffered audio
+func (l *Limiter) Reset() {
+	for ch := range l.peaks {
+		l.peaks[ch].reset()
+	}
+	l.minFrames = l.minFrames[:0]
+	l.minGains = l.minGains[:0]
+	l.frame = 0
+	l.envelope = 1
+	for i := range l.average {
+		l.average[i] = 1
+	}
+	l.avgSum = float64(l.lookahead)
+	l.avgPos = 0
+	clear(l.delay)
+	l.delayPos = 0
+}
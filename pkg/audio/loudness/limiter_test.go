@@ -0,0 +1,195 @@
+// ABOUTME: Tests for the true-peak limiter and normalizer
+// ABOUTME: Checks the ceiling holds, quiet audio passes through and gains are selected per mode
+package loudness
+
+import (
+	"math"
+	"testing"
+)
+
+func TestLimiterHoldsCeiling(t *testing.T) {
+	const rate = 48000
+	l := NewLimiter(rate, 2, DefaultCeiling, 1)
+
+	// Bursts 12dB over full scale between quiet passages
+	meter := NewMeter(rate, 2)
+	frame := make([]float64, 2)
+	out := make([]int32, 2)
+	for i := 0; i < rate; i++ {
+		amp := 0.1
+		if (i/4800)%2 == 1 {
+			amp = 4
+		}
+		v := amp * math.Sin(2*math.Pi*997*float64(i)/rate)
+		frame[0], frame[1] = v, -v
+		l.Process(frame)
+		out[0] = int32(frame[0] * 8388608)
+		out[1] = int32(frame[1] * 8388608)
+		meter.Add(out)
+	}
+
+	if peak := 20 * math.Log10(meter.TruePeak()); peak > DefaultCeiling+0.1 {
+		t.Errorf("true peak %.2f dBTP exceeds ceiling %.1f", peak, DefaultCeiling)
+	}
+}
+
+func TestLimiterPassesQuietAudio(t *testing.T) {
+	l := NewLimiter(48000, 1, DefaultCeiling, 1)
+	latency := l.Latency()
+
+	input := make([]float64, 2000)
+	for i := range input {
+		input[i] = 0.5 * math.Sin(float64(i)*0.01)
+	}
+	for i, x := range input {
+		frame := []float64{x}
+		l.Process(frame)
+		want := 0.0
+		if i >= latency {
+			want = input[i-latency]
+		}
+		if math.Abs(frame[0]-want) > 1e-12 {
+			t.Fatalf("frame %d: got %g, want %g", i, frame[0], want)
+		}
+	}
+}
+
+func TestInfoSelect(t *testing.T) {
+	track := &Gain{Gain: -6, Peak: 0.9}
+	album := &Gain{Gain: -4, Peak: 1}
+	both := Info{Track: track, Album: album}
+
+	tests := []struct {
+		info      Info
+		mode      Mode
+		continues bool
+		want      float64
+		ok        bool
+	}{
+		{both, ModeOff, false, 0, false},
+		{both, ModeTrack, false, -6, true},
+		{both, ModeAlbum, false, -4, true},
+		{both, ModeAuto, false, -6, true},
+		{both, ModeAuto, true, -4, true},
+		{Info{Track: track}, ModeAlbum, false, -6, true},
+		{Info{Album: album}, ModeTrack, false, -4, true},
+		{Info{}, ModeTrack, false, 0, false},
+	}
+	for _, tt := range tests {
+		g, ok := tt.info.Select(tt.mode, tt.continues)
+		if ok != tt.ok || g.Gain != tt.want {
+			t.Errorf("%s (continues=%v): got %g/%v, want %g/%v", tt.mode, tt.continues, g.Gain, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestParseTags(t *testing.T) {
+	info, ok := ParseTags(map[string]string{
+		"REPLAYGAIN_TRACK_GAIN": "-6.54 dB",
+		"REPLAYGAIN_TRACK_PEAK": "0.988",
+		"REPLAYGAIN_ALBUM_GAIN": "+1.20 DB",
+	})
+	if !ok {
+		t.Fatal("expected tags to parse")
+	}
+	if info.Track == nil || info.Track.Gain != -6.54 || info.Track.Peak != 0.988 {
+		t.Errorf("unexpected track gain: %+v", info.Track)
+	}
+	if info.Album == nil || info.Album.Gain != 1.2 || info.Album.Peak != 1 {
+		t.Errorf("unexpected album gain: %+v", info.Album)
+	}
+
+	if _, ok := ParseTags(map[string]string{"REPLAYGAIN_TRACK_GAIN": "loud"}); ok {
+		t.Error("expected unparsable gain to be ignored")
+	}
+	if _, err := ParseMode("loud"); err == nil {
+		t.Error("expected error for unknown mode")
+	}
+	if m, err := ParseMode(""); err != nil || m != ModeOff {
+		t.Errorf("expected empty mode to be off, got %q, %v", m, err)
+	}
+}
+
+func TestNormalizerAppliesGain(t *testing.T) {
+	n := NewNormalizer(ModeTrack, ReferenceLoudness, 48000, 2)
+	n.SetSource(Info{Track: &Gain{Gain: -6.0206}, Source: SourceTags}, "")
+
+	samples := make([]int32, 4000)
+	for i := range samples {
+		samples[i] = 1000000
+	}
+	n.Process(samples)
+
+	latency := n.Latency()
+	for i, v := range samples[latency*2:] {
+		if v < 499999 || v > 500001 {
+			t.Fatalf("sample %d: expected half level, got %d", i, v)
+		}
+	}
+
+	// A target 6dB above the reference cancels the gain
+	n = NewNormalizer(ModeTrack, ReferenceLoudness+6.0206, 48000, 2)
+	n.SetSource(Info{Track: &Gain{Gain: -6.0206}}, "")
+	if g, _, ok := n.Gain(); !ok || math.Abs(g.Gain) > 1e-9 {
+		t.Errorf("expected 0dB gain at the adjusted target, got %+v", g)
+	}
+}
+
+func TestNormalizerRampsGainChanges(t *testing.T) {
+	n := NewNormalizer(ModeTrack, ReferenceLoudness, 48000, 1)
+
+	// No gain known yet: unity
+	samples := make([]int32, 48000)
+	for i := range samples {
+		samples[i] = 1000000
+	}
+	n.Process(samples)
+
+	// Analysis completes mid-stream: the gain ramps instead of jumping
+	n.UpdateLoudness(Analyzed(ReferenceLoudness+6.0206, 0.5))
+	for i := range samples {
+		samples[i] = 1000000
+	}
+	n.Process(samples)
+
+	latency := n.Latency()
+	prev := samples[latency]
+	for i, v := range samples[latency+1:] {
+		if d := prev - v; d < -2 || d > 200 {
+			t.Fatalf("frame %d: expected a smooth ramp down, jumped from %d to %d", i, prev, v)
+		}
+		prev = v
+	}
+	if last := samples[len(samples)-1]; last < 499999 || last > 500001 {
+		t.Errorf("expected ramp to reach half level, got %d", last)
+	}
+}
+
+func TestNormalizerAutoFollowsAlbum(t *testing.T) {
+	n := NewNormalizer(ModeAuto, ReferenceLoudness, 48000, 2)
+	info := Info{Track: &Gain{Gain: -6}, Album: &Gain{Gain: -3}}
+
+	for i, step := range []struct {
+		album string
+		want  float64
+	}{
+		{"Album A", -6}, // First track: no album context
+		{"Album A", -3}, // Next track of the same album
+		{"Album B", -6}, // Different album
+		{"", -6},        // No album
+		{"", -6},
+	} {
+		n.SetSource(info, step.album)
+		if g, _, _ := n.Gain(); g.Gain != step.want {
+			t.Errorf("source %d (%q): expected %g dB, got %g", i, step.album, step.want, g.Gain)
+		}
+	}
+
+	// Updating the current source keeps its album context
+	n.SetSource(info, "Album B")
+	n.SetSource(info, "Album B")
+	n.UpdateLoudness(Info{Track: &Gain{Gain: -7}, Album: &Gain{Gain: -2}})
+	if g, _, _ := n.Gain(); g.Gain != -2 {
+		t.Errorf("expected updated album gain, got %g", g.Gain)
+	}
+}
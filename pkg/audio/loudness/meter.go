@@ -0,0 +1,203 @@
+// ABOUTME: EBU R128 integrated loudness meter
+// ABOUTME: K-weights audio and gates 400ms blocks per ITU-R BS.1770-4
+package loudness
+
+import (
+	"math"
+
+	"github.com/Sendspin/sendspin-go/pkg/audio"
+)
+
+const (
+	absoluteGate = -70.0 // LUFS
+	relativeGate = -10.0 // LU below the ungated loudness
+)
+
+// Meter measures integrated loudness and true peak. Samples are
+// interleaved in the internal 24-bit range.
+type Meter struct {
+	channels int
+	weights  []float64 // Per-channel weighting (0 excludes the channel)
+	filters  []kWeighting
+	peaks    []truePeak
+
+	subBlock int         // Frames per 100ms step
+	fill     int         // Frames in the current step
+	stepSums []float64   // Per-channel sum of squares for the current step
+	steps    [][]float64 // Last (up to) four completed steps
+	blocks   []float64   // Weighted mean-square energy of each 400ms gating block
+	truePeak float64
+	samplePk float64
+	scale    float64
+}
+
+// NewMeter creates a meter for a stream format. Channels follow the
+// WAV/SMPTE order; in 5.1 and 7.1 the LFE channel is excluded and
+// surrounds are weighted +1.5dB as BS.1770 specifies.
+func NewMeter(sampleRate, channels int) *Meter {
+	m := &Meter{
+		channels: channels,
+		weights:  channelWeights(channels),
+		filters:  make([]kWeighting, channels),
+		peaks:    make([]truePeak, channels),
+		subBlock: max(sampleRate/10, 1),
+		stepSums: make([]float64, channels),
+		scale:    1 / float64(audio.Max24Bit+1),
+	}
+	for ch := range m.filters {
+		m.filters[ch] = newKWeighting(sampleRate)
+	}
+	return m
+}
+
+// channelWeights returns the BS.1770 weighting for each channel
+func channelWeights(channels int) []float64 {
+	w := make([]float64, channels)
+	for ch := range w {
+		w[ch] = 1
+	}
+	if channels >= 6 {
+		w[3] = 0 // LFE
+		for ch := 4; ch < channels; ch++ {
+			w[ch] = 1.41 // Surrounds
+		}
+	}
+	return w
+}
+
+// Add measures interleaved samples
+func (m *Meter) Add(samples []int32) {
+	for i, s := range samples {
+		ch := i % m.channels
+		x := float64(s) * m.scale
+
+		m.samplePk = max(m.samplePk, math.Abs(x))
+		m.truePeak = max(m.truePeak, m.peaks[ch].process(x))
+
+		y := m.filters[ch].process(x)
+		m.stepSums[ch] += y * y
+
+		if ch == m.channels-1 {
+			m.fill++
+			if m.fill == m.subBlock {
+				m.endStep()
+			}
+		}
+	}
+}
+
+// endStep closes a 100ms step; every four steps form a gating block
+// overlapping the previous one by 75%
+func (m *Meter) endStep() {
+	m.steps = append(m.steps, m.stepSums)
+	m.stepSums = make([]float64, m.channels)
+	m.fill = 0
+	if len(m.steps) < 4 {
+		return
+	}
+
+	var energy float64
+	for ch, w := range m.weights {
+		var sum float64
+		for _, step := range m.steps {
+			sum += step[ch]
+		}
+		energy += w * sum / float64(4*m.subBlock)
+	}
+	m.blocks = append(m.blocks, energy)
+	m.steps = m.steps[1:]
+}
+
+// Integrated returns the gated integrated loudness in LUFS, or -Inf if
+// the audio was silent or shorter than one 400ms block
+func (m *Meter) Integrated() float64 {
+	gated := func(threshold float64) (float64, int) {
+		var sum float64
+		var n int
+		for _, e := range m.blocks {
+			if energyToLUFS(e) > threshold {
+				sum += e
+				n++
+			}
+		}
+		return sum, n
+	}
+
+	sum, n := gated(absoluteGate)
+	if n == 0 {
+		return math.Inf(-1)
+	}
+	sum, n = gated(energyToLUFS(sum/float64(n)) + relativeGate)
+	if n == 0 {
+		return math.Inf(-1)
+	}
+	return energyToLUFS(sum / float64(n))
+}
+
+// TruePeak returns the highest true peak seen (1.0 = full scale)
+func (m *Meter) TruePeak() float64 {
+	return max(m.truePeak, m.samplePk)
+}
+
+// SamplePeak returns the highest absolute sample value (1.0 = full scale)
+func (m *Meter) SamplePeak() float64 {
+	return m.samplePk
+}
+
+// energyToLUFS converts a weighted mean-square energy to LUFS
+func energyToLUFS(e float64) float64 {
+	return -0.691 + 10*math.Log10(e)
+}
+
+// kWeighting is the BS.1770 pre-filter: a high shelf modelling the head
+// followed by a highpass (RLB weighting), designed for any sample rate
+type kWeighting struct {
+	stages [2]section
+}
+
+// section is a biquad in transposed direct form II
+type section struct {
+	b0, b1, b2, a1, a2 float64
+	z1, z2             float64
+}
+
+func (s *section) process(x float64) float64 {
+	y := s.b0*x + s.z1
+	s.z1 = s.b1*x - s.a1*y + s.z2
+	s.z2 = s.b2*x - s.a2*y
+	return y
+}
+
+func newKWeighting(sampleRate int) kWeighting {
+	fs := float64(sampleRate)
+
+	// Stage 1: high shelf, +4dB above ~1.7kHz
+	const f0, gain, q = 1681.974450955533, 3.999843853973347, 0.7071752369554196
+	k := math.Tan(math.Pi * f0 / fs)
+	vh := math.Pow(10, gain/20)
+	vb := math.Pow(vh, 0.4996667741545416)
+	a0 := 1 + k/q + k*k
+	shelf := section{
+		b0: (vh + vb*k/q + k*k) / a0,
+		b1: 2 * (k*k - vh) / a0,
+		b2: (vh - vb*k/q + k*k) / a0,
+		a1: 2 * (k*k - 1) / a0,
+		a2: (1 - k/q + k*k) / a0,
+	}
+
+	// Stage 2: highpass at ~38Hz
+	const f1, q1 = 38.13547087602444, 0.5003270373238773
+	k = math.Tan(math.Pi * f1 / fs)
+	a0 = 1 + k/q1 + k*k
+	highpass := section{
+		b0: 1, b1: -2, b2: 1,
+		a1: 2 * (k*k - 1) / a0,
+		a2: (1 - k/q1 + k*k) / a0,
+	}
+
+	return kWeighting{stages: [2]section{shelf, highpass}}
+}
+
+func (k *kWeighting) process(x float64) float64 {
+	return k.stages[1].process(k.stages[0].process(x))
+}
@@ -0,0 +1,132 @@
+// ABOUTME: Loudness normalization stage
+// ABOUTME: Applies the selected ReplayGain gain through a true-peak limiter
+package loudness
+
+import (
+	"math"
+
+	"github.com/Sendspin/sendspin-go/pkg/audio"
+	"github.com/Sendspin/sendspin-go/pkg/audio/dsp"
+)
+
+// gainRamp is how long a gain change takes once audio is playing (seconds)
+const gainRamp = 0.1
+
+// Normalizer applies loudness normalization to interleaved samples in the
+// internal 24-bit range. It is not safe for concurrent use.
+type Normalizer struct {
+	mode     Mode
+	target   float64
+	channels int
+
+	info           Info
+	applied        Gain // Selected gain, adjusted to the target
+	active         bool // A gain is selected
+	album          string
+	albumContinues bool // The current source follows one from the same album
+
+	gain     float64 // Current linear gain
+	goal     float64 // Linear gain being ramped to
+	step     float64 // Per-frame ramp increment
+	ramp     int     // Frames of a gain change
+	started  bool    // Audio has been processed since creation or the last reset
+	limiter  *Limiter
+	dither   *dsp.Dither
+	frameBuf []float64
+}
+
+// NewNormalizer creates a normalizer bringing audio to the target
+// loudness (LUFS) in the given mode
+func NewNormalizer(mode Mode, target float64, sampleRate, channels int) *Normalizer {
+	return &Normalizer{
+		mode:     mode,
+		target:   target,
+		channels: channels,
+		gain:     1,
+		goal:     1,
+		ramp:     max(int(float64(sampleRate)*gainRamp), 1),
+		limiter:  NewLimiter(sampleRate, channels, DefaultCeiling, float64(audio.Max24Bit)),
+		dither:   dsp.NewDither(24, channels, dsp.ShapingNone),
+		frameBuf: make([]float64, channels),
+	}
+}
+
+// Mode returns the normalization mode
+func (n *Normalizer) Mode() Mode {
+	return n.mode
+}
+
+// SetSource starts a new source with its loudness and the album it
+// belongs to; ModeAuto uses the album gain when the album is the same as
+// the previous source's
+func (n *Normalizer) SetSource(info Info, album string) {
+	n.albumContinues = album != "" && album == n.album
+	n.album = album
+	n.UpdateLoudness(info)
+}
+
+// UpdateLoudness replaces the current source's loudness, e.g. once
+// analysis completes. The gain ramps to the new value if audio is playing.
+func (n *Normalizer) UpdateLoudness(info Info) {
+	n.info = info
+
+	g, ok := info.Select(n.mode, n.albumContinues)
+	n.active = ok
+	goal := 1.0
+	if ok {
+		g.Gain += n.target - ReferenceLoudness
+		n.applied = g
+		goal = math.Pow(10, g.Gain/20)
+	} else {
+		n.applied = Gain{}
+	}
+
+	n.goal = goal
+	if !n.started {
+		n.gain = goal
+		n.step = 0
+		return
+	}
+	n.step = (goal - n.gain) / float64(n.ramp)
+}
+
+// Gain returns the gain being applied (dB, adjusted to the target) and the
+// loudness it is based on. ok is false while no gain is known.
+func (n *Normalizer) Gain() (gain Gain, info Info, ok bool) {
+	return n.applied, n.info, n.active
+}
+
+// Latency returns the delay the normalizer adds, in frames
+func (n *Normalizer) Latency() int {
+	return n.limiter.Latency()
+}
+
+// Process normalizes samples in place
+func (n *Normalizer) Process(samples []int32) {
+	n.started = true
+	frame := n.frameBuf
+	for i := 0; i+n.channels <= len(samples); i += n.channels {
+		if n.step != 0 {
+			n.gain += n.step
+			if (n.step > 0 && n.gain >= n.goal) || (n.step < 0 && n.gain <= n.goal) {
+				n.gain, n.step = n.goal, 0
+			}
+		}
+
+		for ch := range frame {
+			frame[ch] = float64(samples[i+ch]) * n.gain
+		}
+		n.limiter.Process(frame)
+		for ch, x := range frame {
+			samples[i+ch] = n.dither.Quantize(x, ch)
+		}
+	}
+}
+
+// Reset drops buffered audio and limiter state, e.g. after a seek
+func (n *Normalizer) Reset() {
+	n.limiter.Reset()
+	n.dither.Reset()
+	n.gain, n.step = n.goal, 0
+	n.started = false
+}
@@ -0,0 +1,87 @@
+// ABOUTME: True-peak detection by 4x oversampling
+// ABOUTME: Estimates inter-sample peaks as described in ITU-R BS.1770 Annex 2
+package loudness
+
+import "math"
+
+const (
+	oversample    = 4
+	tapsPerPhase  = 12
+	truePeakDelay = tapsPerPhase / 2 // Frames between a sample going in and its peak coming out
+)
+
+// interpolator holds the polyphase windowed-sinc interpolation filter
+// shared by every true-peak detector
+var interpolator = designInterpolator()
+
+// designInterpolator builds a Kaiser-windowed sinc lowpass at the original
+// Nyquist frequency, split into one filter per oversampling phase
+func designInterpolator() [oversample][tapsPerPhase]float64 {
+	const n = oversample * tapsPerPhase
+	const beta = 6.0
+	centre := float64(n-1) / 2
+
+	var phases [oversample][tapsPerPhase]float64
+	for i := 0; i < n; i++ {
+		x := (float64(i) - centre) / oversample
+		sinc := 1.0
+		if x != 0 {
+			sinc = math.Sin(math.Pi*x) / (math.Pi * x)
+		}
+		r := (float64(i) - centre) / centre
+		window := bessel0(beta*math.Sqrt(1-r*r)) / bessel0(beta)
+		phases[i%oversample][i/oversample] = sinc * window
+	}
+
+	// Unity gain at DC for every phase
+	for p := range phases {
+		var sum float64
+		for _, c := range phases[p] {
+			sum += c
+		}
+		for k := range phases[p] {
+			phases[p][k] /= sum
+		}
+	}
+	return phases
+}
+
+// bessel0 is the zeroth-order modified Bessel function of the first kind
+func bessel0(x float64) float64 {
+	sum, term := 1.0, 1.0
+	for k := 1; k < 50; k++ {
+		term *= (x / (2 * float64(k))) * (x / (2 * float64(k)))
+		sum += term
+		if term < 1e-12*sum {
+			break
+		}
+	}
+	return sum
+}
+
+// truePeak tracks one channel's interpolated signal
+type truePeak struct {
+	history [tapsPerPhase]float64 // Most recent input first
+}
+
+// process adds a sample and returns the largest absolute value of the
+// oversampled signal around the sample truePeakDelay frames earlier
+func (t *truePeak) process(x float64) float64 {
+	copy(t.history[1:], t.history[:tapsPerPhase-1])
+	t.history[0] = x
+
+	var peak float64
+	for p := range interpolator {
+		var y float64
+		for k, c := range interpolator[p] {
+			y += c * t.history[k]
+		}
+		peak = max(peak, math.Abs(y))
+	}
+	return peak
+}
+
+// reset clears the filter history
+func (t *truePeak) reset() {
+	t.history = [tapsPerPhase]float64{}
+}
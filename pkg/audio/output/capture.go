@@ -0,0 +1,137 @@
+// ABOUTME: In-memory capture output for tests and offline processing
+// ABOUTME: Records written samples instead of sending them to a device
+package output
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Capture is an Output that records every written sample in memory, after
+// the same volume and mute processing as the device backends. It never
+// blocks, so audio is consumed as fast as it is scheduled.
+type Capture struct {
+	mu         sync.Mutex
+	sampleRate int
+	channels   int
+	bitDepth   int
+	opened     bool
+	samples    []int32
+	writes     int
+	flushes    int
+	gain       *gainStage
+}
+
+// NewCapture creates a new capture output
+func NewCapture() *Capture {
+	return &Capture{gain: newGainStage()}
+}
+
+// Open records the stream format
+func (c *Capture) Open(sampleRate, channels, bitDepth int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.sampleRate = sampleRate
+	c.channels = channels
+	c.bitDepth = bitDepth
+	c.opened = true
+	c.gain.setSampleRate(sampleRate)
+	return nil
+}
+
+// Write appends samples to the capture buffer
+func (c *Capture) Write(samples []int32) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.opened {
+		return fmt.Errorf("output not initialized")
+	}
+
+	c.samples = append(c.samples, c.gain.process(samples, c.channels)...)
+	c.writes++
+	return nil
+}
+
+// Flush counts the flush; captured samples are kept since they were "played"
+func (c *Capture) Flush() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.flushes++
+	return nil
+}
+
+// Close marks the output closed
+func (c *Capture) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.opened = false
+	return nil
+}
+
+// Samples returns a copy of all captured samples
+func (c *Capture) Samples() []int32 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	out := make([]int32, len(c.samples))
+	copy(out, c.samples)
+	return out
+}
+
+// Writes returns the number of Write calls
+func (c *Capture) Writes() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.writes
+}
+
+// Flushes returns the number of Flush calls
+func (c *Capture) Flushes() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.flushes
+}
+
+// Stats reports zero device statistics: captured audio is "played" as soon
+// as it is written, so there is no latency and nothing can underrun
+func (c *Capture) Stats() Stats {
+	return Stats{}
+}
+
+// SetVolume sets the volume (0-100)
+func (c *Capture) SetVolume(volume int) {
+	c.gain.setVolume(volume)
+}
+
+// SetMuted sets mute state
+func (c *Capture) SetMuted(muted bool) {
+	c.gain.setMuted(muted)
+}
+
+// GetVolume returns current volume
+func (c *Capture) GetVolume() int {
+	return c.gain.getVolume()
+}
+
+// IsMuted returns mute state
+func (c *Capture) IsMuted() bool {
+	return c.gain.isMuted()
+}
+
+// Format returns the format passed to Open
+func (c *Capture) Format() (sampleRate, channels, bitDepth int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.sampleRate, c.channels, c.bitDepth
+}
+
+// Reset discards captured samples and counters
+func (c *Capture) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.samples = nil
+	c.writes = 0
+	c.flushes = 0
+}
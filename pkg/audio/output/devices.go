@@ -0,0 +1,122 @@
+// ABOUTME: Playback device enumeration and selection
+// ABOUTME: Lists devices via miniaudio and resolves device IDs or names
+package output
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/gen2brain/malgo"
+)
+
+// Device describes a playback device
+type Device struct {
+	ID          string         // Backend device ID (hex), stable across runs
+	Name        string         // Human-readable device name
+	Default     bool           // True for the system default device
+	SampleRates []int          // Native sample rates; empty if the device accepts any
+	Formats     []SampleFormat // Native sample formats we can produce; empty if unknown
+
+	id malgo.DeviceID
+}
+
+// ListDevices returns the available playback devices
+func ListDevices() ([]Device, error) {
+	ctx, err := malgo.InitContext(nil, malgo.ContextConfig{}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize malgo context: %w", err)
+	}
+	defer func() {
+		_ = ctx.Uninit()
+		ctx.Free()
+	}()
+
+	return listDevices(ctx)
+}
+
+// listDevices enumerates playback devices on an existing context
+func listDevices(ctx *malgo.AllocatedContext) ([]Device, error) {
+	infos, err := ctx.Devices(malgo.Playback)
+	if err != nil {
+		return nil, fmt.Errorf("failed to enumerate playback devices: %w", err)
+	}
+
+	devices := make([]Device, 0, len(infos))
+	for _, info := range infos {
+		device := Device{
+			ID:      info.ID.String(),
+			Name:    info.Name(),
+			Default: info.IsDefault != 0,
+			id:      info.ID,
+		}
+
+		// Native formats need a per-device query; enumeration only has names
+		full, err := ctx.DeviceInfo(malgo.Playback, info.ID, malgo.Shared)
+		if err == nil {
+			device.SampleRates, device.Formats = nativeFormats(full.Formats)
+		}
+
+		devices = append(devices, device)
+	}
+
+	return devices, nil
+}
+
+// nativeFormats collects the distinct sample rates and formats a device reports
+func nativeFormats(formats []malgo.DataFormat) (rates []int, sampleFormats []SampleFormat) {
+	seenRate := make(map[int]bool)
+	seenFormat := make(map[SampleFormat]bool)
+
+	for _, f := range formats {
+		// A zero rate means the device accepts any rate
+		if rate := int(f.SampleRate); rate != 0 && !seenRate[rate] {
+			seenRate[rate] = true
+			rates = append(rates, rate)
+		}
+		if sf := fromMalgoFormat(f.Format); sf != FormatUnknown && !seenFormat[sf] {
+			seenFormat[sf] = true
+			sampleFormats = append(sampleFormats, sf)
+		}
+	}
+
+	sort.Ints(rates)
+	return rates, sampleFormats
+}
+
+// findDevice resolves a device by exact ID, then by name (case-insensitive),
+// then by a name substring that matches exactly one device
+func findDevice(devices []Device, selector string) (Device, error) {
+	for _, d := range devices {
+		if d.ID == selector {
+			return d, nil
+		}
+	}
+
+	for _, d := range devices {
+		if strings.EqualFold(d.Name, selector) {
+			return d, nil
+		}
+	}
+
+	var matches []Device
+	needle := strings.ToLower(selector)
+	for _, d := range devices {
+		if strings.Contains(strings.ToLower(d.Name), needle) {
+			matches = append(matches, d)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return Device{}, fmt.Errorf("no playback device matches %q", selector)
+	case 1:
+		return matches[0], nil
+	default:
+		names := make([]string, len(matches))
+		for i, d := range matches {
+			names[i] = d.Name
+		}
+		return Device{}, fmt.Errorf("device %q is ambiguous: matches %s", selector, strings.Join(names, ", "))
+	}
+}
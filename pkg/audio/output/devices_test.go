@@ -0,0 +1,73 @@
+// ABOUTME: Tests for playback device selection
+// ABOUTME: Verifies ID/name matching and native format collection
+package output
+
+import (
+	"testing"
+
+	"github.com/gen2brain/malgo"
+)
+
+var testDevices = []Device{
+	{ID: "6877", Name: "HDMI Output", Default: true},
+	{ID: "7573", Name: "USB Audio DAC"},
+	{ID: "7573b", Name: "USB Audio DAC (Line)"},
+}
+
+func TestFindDevice(t *testing.T) {
+	tests := []struct {
+		selector string
+		want     string
+	}{
+		{"7573", "USB Audio DAC"},          // Exact ID
+		{"usb audio dac", "USB Audio DAC"}, // Name, case-insensitive
+		{"hdmi", "HDMI Output"},            // Unique substring
+		{"line", "USB Audio DAC (Line)"},   // Unique substring
+		{"7573b", "USB Audio DAC (Line)"},  // ID wins over substring
+		{"HDMI Output", "HDMI Output"},     // Exact name
+	}
+
+	for _, tt := range tests {
+		got, err := findDevice(testDevices, tt.selector)
+		if err != nil {
+			t.Errorf("findDevice(%q): unexpected error: %v", tt.selector, err)
+			continue
+		}
+		if got.Name != tt.want {
+			t.Errorf("findDevice(%q) = %q, want %q", tt.selector, got.Name, tt.want)
+		}
+	}
+}
+
+func TestFindDeviceErrors(t *testing.T) {
+	if _, err := findDevice(testDevices, "bluetooth"); err == nil {
+		t.Error("expected error for unknown device")
+	}
+	if _, err := findDevice(testDevices, "usb"); err == nil {
+		t.Error("expected error for ambiguous device name")
+	}
+}
+
+func TestNativeFormats(t *testing.T) {
+	rates, formats := nativeFormats([]malgo.DataFormat{
+		{Format: malgo.FormatS16, Channels: 2, SampleRate: 48000},
+		{Format: malgo.FormatS16, Channels: 2, SampleRate: 44100},
+		{Format: malgo.FormatS32, Channels: 2, SampleRate: 96000},
+		{Format: malgo.FormatS32, Channels: 2, SampleRate: 48000},
+	})
+
+	wantRates := []int{44100, 48000, 96000}
+	if len(rates) != len(wantRates) {
+		t.Fatalf("expected rates %v, got %v", wantRates, rates)
+	}
+	for i := range wantRates {
+		if rates[i] != wantRates[i] {
+			t.Errorf("expected rates %v, got %v", wantRates, rates)
+			break
+		}
+	}
+
+	if len(formats) != 2 || formats[0] != FormatS16 || formats[1] != FormatS32 {
+		t.Errorf("expected formats [s16 s32], got %v", formats)
+	}
+}
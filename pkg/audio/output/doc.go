@@ -2,13 +2,16 @@
 // ABOUTME: Provides Output interface with malgo (24-bit) and oto (16-bit) implementations
 // Package output provides audio playback interfaces.
 //
-// Currently supports:
-//   - malgo (miniaudio): 16/24/32-bit output, format re-initialization supported
-//   - oto: 16-bit output only, legacy support
+// New returns the standard backend (miniaudio via malgo). It negotiates
+// the device's native format (s16, s24, s32 or f32), converts the internal
+// 24-bit int32 samples to it, and can open the device exclusively for
+// bit-perfect passthrough. Volume, mute and their ramps are applied the
+// same way by every backend, including the legacy 16-bit oto output and
+// the in-memory Capture.
 //
 // Example:
 //
-//	out := output.NewMalgo()
+//	out := output.New(output.Config{Device: "USB", Passthrough: true})
 //	err := out.Open(192000, 2, 24)  // 192kHz, stereo, 24-bit
 //	err = out.Write(samples)
 package output
@@ -0,0 +1,169 @@
+// ABOUTME: Device sample formats and conversion from internal samples
+// ABOUTME: Negotiates the best native format and encodes int32 audio into it
+package output
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+
+	"github.com/Sendspin/sendspin-go/pkg/audio"
+	"github.com/Sendspin/sendspin-go/pkg/audio/dsp"
+)
+
+// SampleFormat is a device sample encoding
+type SampleFormat int
+
+const (
+	FormatUnknown SampleFormat = iota
+	FormatS16                  // Signed 16-bit little-endian
+	FormatS24                  // Signed 24-bit packed little-endian
+	FormatS32                  // Signed 32-bit little-endian
+	FormatF32                  // 32-bit float in [-1, 1)
+)
+
+// String returns the short format name (e.g. "s24")
+func (f SampleFormat) String() string {
+	switch f {
+	case FormatS16:
+		return "s16"
+	case FormatS24:
+		return "s24"
+	case FormatS32:
+		return "s32"
+	case FormatF32:
+		return "f32"
+	default:
+		return fmt.Sprintf("unknown(%d)", int(f))
+	}
+}
+
+// BytesPerSample returns the encoded size of one sample
+func (f SampleFormat) BytesPerSample() int {
+	switch f {
+	case FormatS16:
+		return 2
+	case FormatS24:
+		return 3
+	case FormatS32, FormatF32:
+		return 4
+	default:
+		return 0
+	}
+}
+
+// exactFormat returns the integer format matching a stream bit depth
+func exactFormat(bitDepth int) (SampleFormat, error) {
+	switch bitDepth {
+	case 16:
+		return FormatS16, nil
+	case 24:
+		return FormatS24, nil
+	case 32:
+		return FormatS32, nil
+	default:
+		return FormatUnknown, fmt.Errorf("unsupported bit depth: %d (supported: 16, 24, 32)", bitDepth)
+	}
+}
+
+// precision returns the significant bits a format can carry
+func (f SampleFormat) precision() int {
+	switch f {
+	case FormatS16:
+		return 16
+	case FormatS24, FormatF32: // float32 has a 24-bit mantissa
+		return 24
+	case FormatS32:
+		return 32
+	default:
+		return 0
+	}
+}
+
+// negotiateFormat picks the device-native format for a stream. The exact
+// integer format is preferred, then the lowest-precision format that still
+// holds every bit of the stream, then the most precise format available.
+// An empty native list means the device converts anything, so the exact
+// format is used. exact reports whether the result is bit-perfect.
+func negotiateFormat(native []SampleFormat, bitDepth int) (format SampleFormat, exact bool, err error) {
+	want, err := exactFormat(bitDepth)
+	if err != nil {
+		return FormatUnknown, false, err
+	}
+	if len(native) == 0 {
+		return want, true, nil
+	}
+
+	var lossless, best SampleFormat
+	for _, f := range native {
+		if f == want {
+			return want, true, nil
+		}
+		if f.precision() >= want.precision() && (lossless == FormatUnknown || f.precision() < lossless.precision()) {
+			lossless = f
+		}
+		if f.precision() > best.precision() {
+			best = f
+		}
+	}
+
+	if lossless != FormatUnknown {
+		// Widening is lossless but not bit-identical on the wire
+		return lossless, false, nil
+	}
+	if best == FormatUnknown {
+		return FormatUnknown, false, fmt.Errorf("device has no supported sample format")
+	}
+	return best, false, nil
+}
+
+// f32Scale maps the internal 24-bit range onto [-1, 1)
+const f32Scale = 1.0 / (audio.Max24Bit + 1)
+
+// newEncodeDither returns the dither for requantizing to a device format,
+// or nil when the format holds every internal bit. Noise shaping is used
+// only at rates where the shaped noise lands above the audible band.
+func newEncodeDither(format SampleFormat, sampleRate, channels int) *dsp.Dither {
+	if format != FormatS16 {
+		return nil
+	}
+	shaping := dsp.ShapingSecondOrder
+	if sampleRate < 44100 {
+		shaping = dsp.ShapingNone
+	}
+	return dsp.NewDither(16, channels, shaping)
+}
+
+// encodeSamples converts internal samples (24-bit range in int32) to the
+// device format. dst must hold len(src)*format.BytesPerSample() bytes.
+// dither, if non-nil, requantizes 16-bit output instead of truncating.
+func encodeSamples(dst []byte, src []int32, format SampleFormat, dither *dsp.Dither) {
+	switch format {
+	case FormatS16:
+		if dither != nil {
+			channels := dither.Channels()
+			for i, s := range src {
+				binary.LittleEndian.PutUint16(dst[i*2:], uint16(int16(dither.Reduce(s, i%channels))))
+			}
+			return
+		}
+		for i, s := range src {
+			binary.LittleEndian.PutUint16(dst[i*2:], uint16(audio.SampleToInt16(s)))
+		}
+	case FormatS24:
+		for i, s := range src {
+			dst[i*3] = byte(s)
+			dst[i*3+1] = byte(s >> 8)
+			dst[i*3+2] = byte(s >> 16)
+		}
+	case FormatS32:
+		for i, s := range src {
+			// Left-justify the 24-bit value in the 32-bit container
+			binary.LittleEndian.PutUint32(dst[i*4:], uint32(s<<8))
+		}
+	case FormatF32:
+		for i, s := range src {
+			binary.LittleEndian.PutUint32(dst[i*4:], math.Float32bits(float32(float64(s)*f32Scale)))
+		}
+	}
+}
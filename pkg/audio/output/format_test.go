@@ -0,0 +1,103 @@
+// ABOUTME: Tests for device format negotiation and sample encoding
+// ABOUTME: Verifies format choice and int32 to s16/s24/s32/f32 scaling
+package output
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"github.com/Sendspin/sendspin-go/pkg/audio"
+)
+
+func TestNegotiateFormat(t *testing.T) {
+	tests := []struct {
+		name      string
+		native    []SampleFormat
+		bitDepth  int
+		want      SampleFormat
+		wantExact bool
+	}{
+		{"exact 24-bit", []SampleFormat{FormatS16, FormatS24, FormatS32}, 24, FormatS24, true},
+		{"unknown device", nil, 16, FormatS16, true},
+		{"widen 16 to s24", []SampleFormat{FormatS32, FormatS24}, 16, FormatS24, false},
+		{"24-bit into float", []SampleFormat{FormatS16, FormatF32}, 24, FormatF32, false},
+		{"24-bit into s32", []SampleFormat{FormatS32}, 24, FormatS32, false},
+		{"lossy fallback", []SampleFormat{FormatS16}, 24, FormatS16, false},
+	}
+
+	for _, tt := range tests {
+		got, exact, err := negotiateFormat(tt.native, tt.bitDepth)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+			continue
+		}
+		if got != tt.want || exact != tt.wantExact {
+			t.Errorf("%s: got %s (exact %v), want %s (exact %v)", tt.name, got, exact, tt.want, tt.wantExact)
+		}
+	}
+
+	if _, _, err := negotiateFormat(nil, 20); err == nil {
+		t.Error("expected error for unsupported bit depth")
+	}
+}
+
+func TestEncodeSamples(t *testing.T) {
+	src := []int32{audio.Max24Bit, audio.Min24Bit, 0x123456, -256}
+
+	s16 := make([]byte, len(src)*2)
+	encodeSamples(s16, src, FormatS16, nil)
+	for i, want := range []int16{32767, -32768, 0x1234, -1} {
+		if got := int16(binary.LittleEndian.Uint16(s16[i*2:])); got != want {
+			t.Errorf("s16 sample %d: got %d, want %d", i, got, want)
+		}
+	}
+
+	s24 := make([]byte, len(src)*3)
+	encodeSamples(s24, src, FormatS24, nil)
+	for i, want := range src {
+		got := audio.SampleFrom24Bit([3]byte{s24[i*3], s24[i*3+1], s24[i*3+2]})
+		if got != want {
+			t.Errorf("s24 sample %d: got %d, want %d", i, got, want)
+		}
+	}
+
+	s32 := make([]byte, len(src)*4)
+	encodeSamples(s32, src, FormatS32, nil)
+	for i, want := range src {
+		if got := int32(binary.LittleEndian.Uint32(s32[i*4:])); got != want<<8 {
+			t.Errorf("s32 sample %d: got %d, want %d", i, got, want<<8)
+		}
+	}
+
+	f32 := make([]byte, len(src)*4)
+	encodeSamples(f32, src, FormatF32, nil)
+	for i, want := range []float32{1 - 1.0/8388608, -1, float32(0x123456) / 8388608, -256.0 / 8388608} {
+		if got := math.Float32frombits(binary.LittleEndian.Uint32(f32[i*4:])); got != want {
+			t.Errorf("f32 sample %d: got %v, want %v", i, got, want)
+		}
+	}
+}
+
+func TestEncodeSamplesDithered(t *testing.T) {
+	dither := newEncodeDither(FormatS16, 48000, 2)
+	if newEncodeDither(FormatS24, 48000, 2) != nil {
+		t.Error("expected no dither for 24-bit output")
+	}
+
+	// Exact 16-bit values pass through; others land on a neighbouring LSB
+	src := []int32{0x123400, -0x567800, 0x123456, -0x123456}
+	dst := make([]byte, len(src)*2)
+	encodeSamples(dst, src, FormatS16, dither)
+
+	for i, s := range src {
+		got := int32(int16(binary.LittleEndian.Uint16(dst[i*2:])))
+		want := s >> 8
+		if s&0xFF == 0 && got != want {
+			t.Errorf("sample %d: expected exact %d, got %d", i, want, got)
+		}
+		if got < want-1 || got > want+2 {
+			t.Errorf("sample %d: got %d, want within a LSB of %d", i, got, want)
+		}
+	}
+}
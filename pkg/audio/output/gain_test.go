@@ -0,0 +1,82 @@
+// ABOUTME: Tests for the shared volume and mute stage
+// ABOUTME: Verifies unity passthrough, ramps and clamping
+package output
+
+import "testing"
+
+func TestGainUnityPassthrough(t *testing.T) {
+	g := newGainStage()
+	samples := []int32{1, -2, 3, -4}
+
+	out := g.process(samples, 2)
+	if &out[0] != &samples[0] {
+		t.Error("expected samples returned untouched at unity")
+	}
+	if !g.unity() {
+		t.Error("expected unity at 100% volume")
+	}
+}
+
+func TestGainVolumeRamp(t *testing.T) {
+	g := newGainStage()
+	g.setSampleRate(400) // 4-frame ramp
+	g.setVolume(50)
+
+	samples := make([]int32, 12) // 6 stereo frames
+	for i := range samples {
+		samples[i] = 1000
+	}
+	out := g.process(samples, 2)
+
+	// Dithered rounding may land one LSB either side
+	want := []int32{1000, 1000, 750, 750, 500, 500, 500, 500, 500, 500, 500, 500}
+	for i := range want {
+		if d := out[i] - want[i]; d < -1 || d > 1 {
+			t.Errorf("sample %d: got %d, want %d (+/-1)", i, out[i], want[i])
+		}
+	}
+	if samples[2] != 1000 {
+		t.Error("expected input samples left unmodified")
+	}
+	if g.unity() {
+		t.Error("expected non-unity at 50% volume")
+	}
+}
+
+func TestGainMuteAndRestore(t *testing.T) {
+	g := newGainStage()
+	g.setSampleRate(100) // 1-frame ramp
+	g.setMuted(true)
+
+	out := g.process([]int32{800, 800, 800}, 1)
+	if out[1] != 0 || out[2] != 0 {
+		t.Errorf("expected silence once muted, got %v", out)
+	}
+
+	g.setMuted(false)
+	g.process([]int32{800}, 1)
+	if !g.unity() {
+		t.Error("expected unity after unmute ramp completes")
+	}
+	if g.getVolume() != 100 || g.isMuted() {
+		t.Errorf("expected volume 100 unmuted, got %d muted=%v", g.getVolume(), g.isMuted())
+	}
+}
+
+func TestGainVolumeClamped(t *testing.T) {
+	g := newGainStage()
+	g.setVolume(150)
+	if g.getVolume() != 100 {
+		t.Errorf("expected volume clamped to 100, got %d", g.getVolume())
+	}
+	g.setVolume(-5)
+	if g.getVolume() != 0 {
+		t.Errorf("expected volume clamped to 0, got %d", g.getVolume())
+	}
+}
+
+func TestOutputsImplementVolumeControl(t *testing.T) {
+	var _ VolumeControl = (*Malgo)(nil)
+	var _ VolumeControl = (*Oto)(nil)
+	var _ VolumeControl = (*Capture)(nil)
+}
@@ -7,8 +7,10 @@ import (
 	"fmt"
 	"log"
 	"sync"
+	"sync/atomic"
+	"time"
 
-	"github.com/Sendspin/sendspin-go/pkg/audio"
+	"github.com/Sendspin/sendspin-go/pkg/audio/dsp"
 	"github.com/gen2brain/malgo"
 )
 
@@ -21,95 +23,84 @@ type Malgo struct {
 	sampleRate int
 	channels   int
 	bitDepth   int
-	volume     int
-	muted      bool
 	ready      bool
 
-	// Ring buffer for callback-based playback
-	ringBuffer *RingBuffer
-	mu         sync.Mutex
-}
+	// format is the negotiated device format; bitPerfect is set when it
+	// matches the stream exactly
+	format     SampleFormat
+	bitPerfect bool
 
-// RingBuffer provides thread-safe circular buffer for audio samples
-type RingBuffer struct {
-	buffer   []int32
-	readPos  int
-	writePos int
-	size     int
-	count    int // Number of samples currently in buffer
-	mu       sync.Mutex
-}
-
-// NewRingBuffer creates a ring buffer with given capacity (in samples)
-func NewRingBuffer(capacity int) *RingBuffer {
-	return &RingBuffer{
-		buffer: make([]int32, capacity),
-		size:   capacity,
-	}
-}
+	// dither requantizes for 16-bit devices; used only by the callback
+	dither *dsp.Dither
 
-// Write adds samples to the ring buffer
-func (rb *RingBuffer) Write(samples []int32) int {
-	rb.mu.Lock()
-	defer rb.mu.Unlock()
+	// Volume, mute and their ramps
+	gain *gainStage
 
-	written := 0
-	for i := 0; i < len(samples) && rb.count < rb.size; i++ {
-		rb.buffer[rb.writePos] = samples[i]
-		rb.writePos = (rb.writePos + 1) % rb.size
-		rb.count++
-		written++
-	}
-	return written
-}
+	// selector is the requested device ID or name ("" for the system default)
+	selector string
 
-// Read retrieves samples from the ring buffer
-func (rb *RingBuffer) Read(samples []int32) int {
-	rb.mu.Lock()
-	defer rb.mu.Unlock()
+	// passthrough requests an exclusive, exact-format device
+	passthrough bool
 
-	read := 0
-	for i := 0; i < len(samples) && rb.count > 0; i++ {
-		samples[i] = rb.buffer[rb.readPos]
-		rb.readPos = (rb.readPos + 1) % rb.size
-		rb.count--
-		read++
-	}
+	// lost is set when the device stops without being closed (e.g. unplugged);
+	// stopping marks stops we initiated ourselves
+	lost        atomic.Bool
+	stopping    atomic.Bool
+	lastRecover time.Time
 
-	// Zero-fill remaining if underrun
-	for i := read; i < len(samples); i++ {
-		samples[i] = 0
-	}
+	// Device health
+	stats    deviceStats
+	overruns atomic.Int64
+	period   atomic.Int64 // Frames requested by the last callback
 
-	return read
+	// Ring buffer for callback-based playback; scratch is the callback's
+	// reusable sample buffer so the real-time thread never allocates
+	ringBuffer *RingBuffer
+	scratch    []int32
+	mu         sync.Mutex
 }
 
-// Available returns the number of samples available to read
-func (rb *RingBuffer) Available() int {
-	rb.mu.Lock()
-	defer rb.mu.Unlock()
-	return rb.count
-}
+// recoverInterval limits how often a lost device is reopened
+const recoverInterval = time.Second
 
-// Free returns the number of free slots in the buffer
-func (rb *RingBuffer) Free() int {
-	rb.mu.Lock()
-	defer rb.mu.Unlock()
-	return rb.size - rb.count
+// Config configures the output backend
+type Config struct {
+	// Device selects the playback device by ID or name (see ListDevices).
+	// Empty uses the system default.
+	Device string
+
+	// Passthrough requests bit-perfect playback: the device is opened in
+	// exclusive mode in the stream's exact format where it supports it.
+	// Samples are untouched while volume is 100% and unmuted.
+	Passthrough bool
 }
 
-// NewMalgo creates a new Malgo output
-func NewMalgo() Output {
+// New creates the output backend. Playback goes through miniaudio, which
+// handles 16, 24 and 32-bit streams and negotiates the device's native
+// format; volume and mute are applied in software before conversion.
+func New(config Config) Output {
 	ctx, cancel := context.WithCancel(context.Background())
 
 	return &Malgo{
-		ctx:    ctx,
-		cancel: cancel,
-		volume: 100,
-		muted:  false,
+		ctx:         ctx,
+		cancel:      cancel,
+		gain:        newGainStage(),
+		selector:    config.Device,
+		passthrough: config.Passthrough,
 	}
 }
 
+// NewMalgo creates a new Malgo output on the system default device
+func NewMalgo() Output {
+	return New(Config{})
+}
+
+// NewMalgoDevice creates a new Malgo output on the given device, selected by
+// ID or name (see ListDevices). An empty device uses the system default.
+func NewMalgoDevice(device string) Output {
+	return New(Config{Device: device})
+}
+
 // Open initializes the output device with specified format
 func (m *Malgo) Open(sampleRate, channels, bitDepth int) error {
 	m.mu.Lock()
@@ -139,41 +130,108 @@ func (m *Malgo) Open(sampleRate, channels, bitDepth int) error {
 		m.malgoCtx = ctx
 	}
 
-	// Map bit depth to malgo format
-	var format malgo.FormatType
-	switch bitDepth {
-	case 16:
-		format = malgo.FormatS16
-	case 24:
-		format = malgo.FormatS24
-	case 32:
-		format = malgo.FormatS32
-	default:
-		return fmt.Errorf("unsupported bit depth: %d (supported: 16, 24, 32)", bitDepth)
+	// Resolve the requested device by ID or name
+	var device *Device
+	if m.selector != "" {
+		found, err := m.resolveDevice()
+		if err != nil {
+			return err
+		}
+		device = &found
+	}
+
+	return m.openDevice(device, sampleRate, channels, bitDepth)
+}
+
+// resolveDevice finds the selected device among those currently present
+func (m *Malgo) resolveDevice() (Device, error) {
+	devices, err := listDevices(m.malgoCtx)
+	if err != nil {
+		return Device{}, err
+	}
+	return findDevice(devices, m.selector)
+}
+
+// nativeFormatsOf returns the native formats of a device, or of the system
+// default if nil. Nil means unknown, in which case miniaudio converts.
+func (m *Malgo) nativeFormatsOf(selected *Device) []SampleFormat {
+	if selected != nil {
+		return selected.Formats
+	}
+
+	devices, err := listDevices(m.malgoCtx)
+	if err != nil {
+		return nil
+	}
+	for _, d := range devices {
+		if d.Default {
+			return d.Formats
+		}
+	}
+	return nil
+}
+
+// openDevice initializes and starts a device, or the default if nil (must hold m.mu)
+func (m *Malgo) openDevice(selected *Device, sampleRate, channels, bitDepth int) error {
+	// Use the device's native format, as close to the stream as it gets
+	format, exact, err := negotiateFormat(m.nativeFormatsOf(selected), bitDepth)
+	if err != nil {
+		return err
+	}
+	if m.passthrough && !exact {
+		log.Printf("Warning: passthrough requested but device has no native %d-bit format, using %s", bitDepth, format)
 	}
 
 	// Create ring buffer (80ms capacity - tuned for Music Assistant)
 	bufferSamples := (sampleRate * channels * 80) / 1000
 	m.ringBuffer = NewRingBuffer(bufferSamples)
 
+	// The callback reads these, so they are set before the device starts
+	m.channels = channels
+	m.format = format
+	m.dither = newEncodeDither(format, sampleRate, channels)
+
 	// Configure device
 	deviceConfig := malgo.DefaultDeviceConfig(malgo.Playback)
-	deviceConfig.Playback.Format = format
+	deviceConfig.Playback.Format = toMalgoFormat(format)
 	deviceConfig.Playback.Channels = uint32(channels)
 	deviceConfig.SampleRate = uint32(sampleRate)
 	deviceConfig.Alsa.NoMMap = 1
+	if selected != nil {
+		deviceConfig.Playback.DeviceID = selected.id.Pointer()
+	}
 
 	// Set up callbacks
 	onSamples := func(pOutputSample, pInputSamples []byte, frameCount uint32) {
 		m.dataCallback(pOutputSample, frameCount)
 	}
 
+	onStop := func() {
+		if !m.stopping.Load() {
+			m.lost.Store(true)
+		}
+	}
+
 	deviceCallbacks := malgo.DeviceCallbacks{
 		Data: onSamples,
+		Stop: onStop,
+	}
+
+	// Exclusive mode bypasses the system mixer, which may resample or convert
+	exclusive := false
+	if m.passthrough && exact {
+		deviceConfig.Playback.ShareMode = malgo.Exclusive
+		exclusive = true
 	}
 
 	// Initialize device
 	device, err := malgo.InitDevice(m.malgoCtx.Context, deviceConfig, deviceCallbacks)
+	if err != nil && exclusive {
+		log.Printf("Warning: exclusive mode unavailable (%v), using shared mode", err)
+		deviceConfig.Playback.ShareMode = malgo.Shared
+		exclusive = false
+		device, err = malgo.InitDevice(m.malgoCtx.Context, deviceConfig, deviceCallbacks)
+	}
 	if err != nil {
 		return fmt.Errorf("failed to initialize playback device: %w", err)
 	}
@@ -186,91 +244,136 @@ func (m *Malgo) Open(sampleRate, channels, bitDepth int) error {
 
 	m.device = device
 	m.sampleRate = sampleRate
-	m.channels = channels
 	m.bitDepth = bitDepth
+	m.bitPerfect = exact && exclusive
 	m.ready = true
+	m.lost.Store(false)
+	m.stats.idle()
+	m.gain.setSampleRate(sampleRate)
 
-	log.Printf("Audio output initialized: %dHz, %d channels, %d-bit (malgo/%s)",
-		sampleRate, channels, bitDepth, formatName(format))
+	deviceName := "default device"
+	if selected != nil {
+		deviceName = selected.Name
+	}
+	mode := "shared"
+	if exclusive {
+		mode = "exclusive"
+	}
+	log.Printf("Audio output initialized: %dHz, %d channels, %d-bit (malgo/%s %s, %s)",
+		sampleRate, channels, bitDepth, format, mode, deviceName)
 
 	return nil
 }
 
-// Write queues audio samples for playback
-func (m *Malgo) Write(samples []int32) error {
-	if !m.ready {
-		return fmt.Errorf("output not initialized")
-	}
+// recoverDevice reopens a lost device, falling back to the system default
+// if the selected device is gone. Attempts are limited to one per
+// recoverInterval; audio written in between is dropped.
+func (m *Malgo) recoverDevice() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
-	// Apply volume and mute
-	volumedSamples := applyVolume(samples, m.volume, m.muted)
+	if !m.lost.Load() || time.Since(m.lastRecover) < recoverInterval {
+		return nil
+	}
+	m.lastRecover = time.Now()
 
-	// Write to ring buffer (blocks if full)
-	written := 0
-	for written < len(volumedSamples) {
-		n := m.ringBuffer.Write(volumedSamples[written:])
-		written += n
+	sampleRate, channels, bitDepth := m.sampleRate, m.channels, m.bitDepth
+	log.Printf("Audio device lost, reopening")
+	if err := m.closeDevice(); err != nil {
+		return err
+	}
 
-		// If buffer is full, yield briefly
-		if n == 0 {
-			// Buffer is full, this will naturally throttle the writer
-			// In practice, the callback drains the buffer continuously
-			break
+	if m.selector != "" {
+		device, err := m.resolveDevice()
+		if err == nil {
+			if err = m.openDevice(&device, sampleRate, channels, bitDepth); err == nil {
+				return nil
+			}
 		}
+		log.Printf("Selected device %q unavailable (%v), falling back to default", m.selector, err)
 	}
 
+	if err := m.openDevice(nil, sampleRate, channels, bitDepth); err != nil {
+		// Stay lost so the next write retries
+		m.lost.Store(true)
+		return fmt.Errorf("failed to recover audio device: %w", err)
+	}
 	return nil
 }
 
-// dataCallback is called by malgo to fill the audio output buffer
-func (m *Malgo) dataCallback(pOutput []byte, frameCount uint32) {
-	totalSamples := int(frameCount) * m.channels
-	samples := make([]int32, totalSamples)
+// Write queues audio samples for playback
+func (m *Malgo) Write(samples []int32) error {
+	if m.lost.Load() {
+		if err := m.recoverDevice(); err != nil {
+			return err
+		}
+		if m.lost.Load() {
+			// Waiting to retry; drop audio until the device is back
+			return nil
+		}
+	}
 
-	// Read from ring buffer
-	m.ringBuffer.Read(samples)
+	if !m.ready {
+		return fmt.Errorf("output not initialized")
+	}
 
-	// Convert int32 to output format
-	switch m.bitDepth {
-	case 16:
-		m.write16Bit(pOutput, samples)
-	case 24:
-		m.write24Bit(pOutput, samples)
-	case 32:
-		m.write32Bit(pOutput, samples)
+	// Apply volume and mute (a no-op at unity)
+	volumedSamples := m.gain.process(samples, m.channels)
+
+	// Write what fits without blocking; the rest is left to the caller
+	written := m.ringBuffer.Write(volumedSamples)
+	if written < len(volumedSamples) {
+		// The writer is running ahead of the device
+		m.overruns.Add(1)
+		return &BufferFullError{Written: written, Total: len(volumedSamples)}
 	}
+
+	return nil
 }
 
-// write16Bit converts int32 samples to 16-bit output
-func (m *Malgo) write16Bit(output []byte, samples []int32) {
-	for i, sample := range samples {
-		// Convert 24-bit (int32) to 16-bit
-		sample16 := audio.SampleToInt16(sample)
-		output[i*2] = byte(sample16)
-		output[i*2+1] = byte(sample16 >> 8)
+// Flush discards samples queued in the ring buffer
+func (m *Malgo) Flush() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.ringBuffer != nil {
+		m.ringBuffer.Clear()
 	}
+	m.stats.idle()
+	return nil
 }
 
-// write24Bit converts int32 samples to 24-bit output (3 bytes per sample)
-func (m *Malgo) write24Bit(output []byte, samples []int32) {
-	for i, sample := range samples {
-		// Pack 24-bit value (little-endian)
-		output[i*3] = byte(sample)
-		output[i*3+1] = byte(sample >> 8)
-		output[i*3+2] = byte(sample >> 16)
+// Stats reports callback timing, dropouts and output latency. Latency is
+// the audio waiting in the ring buffer plus one device period.
+func (m *Malgo) Stats() Stats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stats := Stats{Overruns: m.overruns.Load()}
+	m.stats.fill(&stats, time.Now())
+
+	if m.ringBuffer != nil && m.channels > 0 {
+		frames := m.ringBuffer.Available()/m.channels + int(m.period.Load())
+		stats.Latency = framesToDuration(frames, m.sampleRate)
 	}
+	return stats
 }
 
-// write32Bit converts int32 samples to 32-bit output
-func (m *Malgo) write32Bit(output []byte, samples []int32) {
-	for i, sample := range samples {
-		// Write as 32-bit (little-endian), left-shifted for proper 24-bit representation
-		sample32 := sample << 8 // Shift 24-bit value to upper bits of 32-bit container
-		output[i*4] = byte(sample32)
-		output[i*4+1] = byte(sample32 >> 8)
-		output[i*4+2] = byte(sample32 >> 16)
-		output[i*4+3] = byte(sample32 >> 24)
+// dataCallback is called by malgo to fill the audio output buffer
+func (m *Malgo) dataCallback(pOutput []byte, frameCount uint32) {
+	totalSamples := int(frameCount) * m.channels
+	if cap(m.scratch) < totalSamples {
+		m.scratch = make([]int32, totalSamples)
 	}
+	samples := m.scratch[:totalSamples]
+
+	// Read from ring buffer (zero-filled on underrun)
+	n := m.ringBuffer.Read(samples)
+	m.stats.pull(time.Now(), n < totalSamples)
+	m.period.Store(int64(frameCount))
+
+	// Convert to the negotiated device format
+	encodeSamples(pOutput, samples, m.format, m.dither)
 }
 
 // Close releases output resources
@@ -297,10 +400,12 @@ func (m *Malgo) Close() error {
 // closeDevice stops and uninitializes the device (must hold m.mu)
 func (m *Malgo) closeDevice() error {
 	if m.device != nil {
+		m.stopping.Store(true)
 		if err := m.device.Stop(); err != nil {
 			log.Printf("Warning: device stop error: %v", err)
 		}
 		m.device.Uninit()
+		m.stopping.Store(false)
 		m.device = nil
 		m.ready = false
 	}
@@ -309,42 +414,63 @@ func (m *Malgo) closeDevice() error {
 
 // SetVolume sets the volume (0-100)
 func (m *Malgo) SetVolume(volume int) {
-	if volume < 0 {
-		volume = 0
-	}
-	if volume > 100 {
-		volume = 100
-	}
-	m.volume = volume
-	log.Printf("Volume set to %d", volume)
+	m.gain.setVolume(volume)
+	log.Printf("Volume set to %d", m.gain.getVolume())
 }
 
 // SetMuted sets mute state
 func (m *Malgo) SetMuted(muted bool) {
-	m.muted = muted
+	m.gain.setMuted(muted)
 	log.Printf("Muted: %v", muted)
 }
 
 // GetVolume returns current volume
 func (m *Malgo) GetVolume() int {
-	return m.volume
+	return m.gain.getVolume()
 }
 
 // IsMuted returns mute state
 func (m *Malgo) IsMuted() bool {
-	return m.muted
+	return m.gain.isMuted()
+}
+
+// BitPerfect reports whether samples currently reach the device unaltered:
+// an exact-format exclusive device, at 100% volume and unmuted
+func (m *Malgo) BitPerfect() bool {
+	m.mu.Lock()
+	bitPerfect := m.bitPerfect
+	m.mu.Unlock()
+	return bitPerfect && m.gain.unity()
+}
+
+// toMalgoFormat maps a sample format to miniaudio's
+func toMalgoFormat(format SampleFormat) malgo.FormatType {
+	switch format {
+	case FormatS16:
+		return malgo.FormatS16
+	case FormatS24:
+		return malgo.FormatS24
+	case FormatS32:
+		return malgo.FormatS32
+	case FormatF32:
+		return malgo.FormatF32
+	default:
+		return malgo.FormatUnknown
+	}
 }
 
-// formatName returns human-readable format name
-func formatName(format malgo.FormatType) string {
+// fromMalgoFormat maps a miniaudio format to ours (FormatUnknown if unsupported)
+func fromMalgoFormat(format malgo.FormatType) SampleFormat {
 	switch format {
 	case malgo.FormatS16:
-		return "S16"
+		return FormatS16
 	case malgo.FormatS24:
-		return "S24"
+		return FormatS24
 	case malgo.FormatS32:
-		return "S32"
+		return FormatS32
+	case malgo.FormatF32:
+		return FormatF32
 	default:
-		return fmt.Sprintf("Unknown(%d)", format)
+		return FormatUnknown
 	}
 }
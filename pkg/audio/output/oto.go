@@ -4,12 +4,13 @@ package output
 
 import (
 	"context"
-	"encoding/binary"
 	"fmt"
 	"io"
 	"log"
+	"sync"
+	"time"
 
-	"github.com/Sendspin/sendspin-go/pkg/audio"
+	"github.com/Sendspin/sendspin-go/pkg/audio/dsp"
 	"github.com/ebitengine/oto/v3"
 )
 
@@ -18,14 +19,49 @@ type Oto struct {
 	ctx        context.Context
 	cancel     context.CancelFunc
 	otoCtx     *oto.Context
-	player     *oto.Player
 	pipeReader *io.PipeReader
 	pipeWriter *io.PipeWriter
 	sampleRate int
 	channels   int
-	volume     int
-	muted      bool
 	ready      bool
+
+	// player pulls from the pipe. Flush replaces it on the stream control
+	// goroutine while Stats reads it from others, so it is guarded by
+	// playerMu.
+	playerMu  sync.Mutex
+	player    otoPlayer
+	newPlayer func(io.Reader) otoPlayer
+
+	// Volume, mute and their ramps
+	gain *gainStage
+
+	// dither requantizes to oto's 16-bit output
+	dither *dsp.Dither
+
+	// Device health; oto pulls from the pipe on its own goroutine, so each
+	// pipe read stands in for a device callback
+	stats deviceStats
+}
+
+// otoPlayer is the part of *oto.Player the output uses
+type otoPlayer interface {
+	Play()
+	Pause()
+	Close() error
+	BufferedSize() int
+}
+
+// timedReader reports each read oto makes from the pipe to deviceStats
+type timedReader struct {
+	r     io.Reader
+	stats *deviceStats
+}
+
+func (t *timedReader) Read(p []byte) (int, error) {
+	t.stats.beginPull(time.Now())
+	n, err := t.r.Read(p)
+	t.stats.endPull(time.Now())
+	return n, err
 }
 
 // NewOto creates a new Oto output
@@ -35,8 +71,7 @@ func NewOto() Output {
 	return &Oto{
 		ctx:    ctx,
 		cancel: cancel,
-		volume: 100,
-		muted:  false,
+		gain:   newGainStage(),
 	}
 }
 
@@ -77,13 +112,19 @@ func (o *Oto) Open(sampleRate, channels, bitDepth int) error {
 	o.otoCtx = ctx
 	o.sampleRate = sampleRate
 	o.channels = channels
+	o.gain.setSampleRate(sampleRate)
+	o.dither = newEncodeDither(FormatS16, sampleRate, channels)
 
 	// Create pipe for continuous streaming
 	o.pipeReader, o.pipeWriter = io.Pipe()
 
 	// Create persistent player that reads from the pipe
-	o.player = o.otoCtx.NewPlayer(o.pipeReader)
+	o.newPlayer = func(r io.Reader) otoPlayer { return ctx.NewPlayer(r) }
+	o.stats.idle()
+	o.playerMu.Lock()
+	o.player = o.newPlayer(o.source())
 	o.player.Play()
+	o.playerMu.Unlock()
 
 	o.ready = true
 
@@ -98,20 +139,12 @@ func (o *Oto) Write(samples []int32) error {
 		return fmt.Errorf("output not initialized")
 	}
 
-	// Apply volume to samples (int32 format)
-	volumedSamples := applyVolume(samples, o.volume, o.muted)
+	// Apply volume and mute (a no-op at unity)
+	volumedSamples := o.gain.process(samples, o.channels)
 
-	// Convert int32 samples to int16 for oto (oto uses 16-bit output)
-	samples16 := make([]int16, len(volumedSamples))
-	for i, s := range volumedSamples {
-		samples16[i] = audio.SampleToInt16(s)
-	}
-
-	// Convert int16 samples to bytes for audio output
-	output := make([]byte, len(samples16)*2)
-	for i, sample := range samples16 {
-		binary.LittleEndian.PutUint16(output[i*2:], uint16(sample))
-	}
+	// oto plays 16-bit only
+	output := make([]byte, len(volumedSamples)*FormatS16.BytesPerSample())
+	encodeSamples(output, volumedSamples, FormatS16, o.dither)
 
 	// Write to pipe (which feeds the persistent player)
 	// This blocks until the write completes
@@ -122,81 +155,89 @@ func (o *Oto) Write(samples []int32) error {
 	return nil
 }
 
+// Flush discards audio buffered in the oto player by replacing it with a
+// fresh player on the same pipe
+func (o *Oto) Flush() error {
+	o.playerMu.Lock()
+	defer o.playerMu.Unlock()
+	if !o.ready || o.player == nil {
+		return nil
+	}
+
+	o.player.Pause()
+	if err := o.player.Close(); err != nil {
+		return fmt.Errorf("failed to close player: %w", err)
+	}
+	o.stats.idle()
+	o.player = o.newPlayer(o.source())
+	o.player.Play()
+	return nil
+}
+
+// source returns the pipe reader instrumented for device statistics
+func (o *Oto) source() io.Reader {
+	return &timedReader{r: o.pipeReader, stats: &o.stats}
+}
+
+// Stats reports pull timing, dropouts and output latency. Latency is the
+// audio buffered inside the oto player; writes block rather than drop, so
+// there are no overruns.
+func (o *Oto) Stats() Stats {
+	var stats Stats
+	o.stats.fill(&stats, time.Now())
+
+	o.playerMu.Lock()
+	defer o.playerMu.Unlock()
+	if o.ready && o.player != nil && o.channels > 0 {
+		// oto buffers 16-bit samples
+		frames := o.player.BufferedSize() / (2 * o.channels)
+		stats.Latency = framesToDuration(frames, o.sampleRate)
+	}
+	return stats
+}
+
 // Close releases output resources
 func (o *Oto) Close() error {
 	if o.pipeWriter != nil {
 		o.pipeWriter.Close()
 		o.pipeWriter = nil
 	}
+	o.playerMu.Lock()
 	if o.player != nil {
 		o.player.Close()
 		o.player = nil
 	}
-	if o.pipeReader != nil {
-		o.pipeReader.Close()
-		o.pipeReader = nil
-	}
 	if o.otoCtx != nil {
 		o.otoCtx.Suspend()
 		o.ready = false
 	}
+	o.playerMu.Unlock()
+	if o.pipeReader != nil {
+		o.pipeReader.Close()
+		o.pipeReader = nil
+	}
 	o.cancel()
 	return nil
 }
 
 // SetVolume sets the volume (0-100)
 func (o *Oto) SetVolume(volume int) {
-	if volume < 0 {
-		volume = 0
-	}
-	if volume > 100 {
-		volume = 100
-	}
-	o.volume = volume
-	log.Printf("Volume set to %d", volume)
+	o.gain.setVolume(volume)
+	log.Printf("Volume set to %d", o.gain.getVolume())
 }
 
 // SetMuted sets mute state
 func (o *Oto) SetMuted(muted bool) {
-	o.muted = muted
+	o.gain.setMuted(muted)
 	log.Printf("Muted: %v", muted)
 }
 
 // GetVolume returns current volume
 func (o *Oto) GetVolume() int {
-	return o.volume
+	return o.gain.getVolume()
 }
 
 // IsMuted returns mute state
 func (o *Oto) IsMuted() bool {
-	return o.muted
-}
-
-// applyVolume applies volume and mute to samples with clipping protection
-func applyVolume(samples []int32, volume int, muted bool) []int32 {
-	multiplier := getVolumeMultiplier(volume, muted)
-
-	result := make([]int32, len(samples))
-	for i, sample := range samples {
-		scaled := int64(float64(sample) * multiplier)
-
-		// Clamp to 24-bit range to prevent overflow
-		if scaled > audio.Max24Bit {
-			scaled = audio.Max24Bit
-		} else if scaled < audio.Min24Bit {
-			scaled = audio.Min24Bit
-		}
-
-		result[i] = int32(scaled)
-	}
-
-	return result
-}
-
-// getVolumeMultiplier calculates volume multiplier
-func getVolumeMultiplier(volume int, muted bool) float64 {
-	if muted {
-		return 0.0
-	}
-	return float64(volume) / 100.0
+	return o.gain.isMuted()
 }
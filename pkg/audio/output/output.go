@@ -2,14 +2,47 @@
 // ABOUTME: Common interface for audio playback backends
 package output
 
+import (
+	"errors"
+	"fmt"
+)
+
 // Output represents an audio output device
 type Output interface {
 	// Open initializes the output device
 	Open(sampleRate, channels, bitDepth int) error
 
-	// Write outputs audio samples (blocks until written)
+	// Write outputs audio samples. Blocking outputs return once everything
+	// is written; non-blocking outputs return a *BufferFullError when only
+	// part of the samples fit.
 	Write(samples []int32) error
 
 	// Close releases output resources
 	Close() error
 }
+
+// Flusher is implemented by outputs that can discard audio queued for
+// playback without closing the device (used on stream/clear)
+type Flusher interface {
+	// Flush drops any samples written but not yet played
+	Flush() error
+}
+
+// ErrBufferFull reports backpressure from a non-blocking output
+var ErrBufferFull = errors.New("output buffer full")
+
+// BufferFullError is returned by non-blocking outputs that accepted only
+// part of a write. The caller may retry the remaining samples once the
+// device has played some audio. It matches ErrBufferFull with errors.Is.
+type BufferFullError struct {
+	Written int // Samples accepted
+	Total   int // Samples offered
+}
+
+func (e *BufferFullError) Error() string {
+	return fmt.Sprintf("%v: wrote %d of %d samples", ErrBufferFull, e.Written, e.Total)
+}
+
+func (e *BufferFullError) Unwrap() error {
+	return ErrBufferFull
+}
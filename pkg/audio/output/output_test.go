@@ -3,6 +3,9 @@
 package output
 
 import (
+	"io"
+	"sync"
+	"sync/atomic"
 	"testing"
 )
 
@@ -16,3 +19,124 @@ func TestNewOto(t *testing.T) {
 		t.Fatal("NewOto returned nil")
 	}
 }
+
+func TestOutputsImplementFlusher(t *testing.T) {
+	var _ Flusher = (*Oto)(nil)
+	var _ Flusher = (*Malgo)(nil)
+}
+
+func TestRingBufferClear(t *testing.T) {
+	rb := NewRingBuffer(8)
+	rb.Write([]int32{1, 2, 3, 4, 5})
+
+	rb.Clear()
+
+	if rb.Available() != 0 {
+		t.Errorf("expected empty buffer after Clear, got %d samples", rb.Available())
+	}
+	if rb.Free() != 8 {
+		t.Errorf("expected 8 free slots after Clear, got %d", rb.Free())
+	}
+
+	// Buffer is usable again and returns only new samples
+	rb.Write([]int32{9})
+	out := make([]int32, 2)
+	if n := rb.Read(out); n != 1 || out[0] != 9 {
+		t.Errorf("expected to read [9], got %d samples %v", n, out)
+	}
+}
+
+func TestMalgoFlushBeforeOpen(t *testing.T) {
+	m := NewMalgo().(*Malgo)
+	if err := m.Flush(); err != nil {
+		t.Errorf("Flush on unopened output failed: %v", err)
+	}
+}
+
+// fakeOtoPlayer stands in for an oto player, failing calls made after Close
+type fakeOtoPlayer struct {
+	t      *testing.T
+	closed atomic.Bool
+}
+
+func (p *fakeOtoPlayer) Play()  {}
+func (p *fakeOtoPlayer) Pause() {}
+
+func (p *fakeOtoPlayer) Close() error {
+	p.closed.Store(true)
+	return nil
+}
+
+func (p *fakeOtoPlayer) BufferedSize() int {
+	if p.closed.Load() {
+		p.t.Error("BufferedSize called on a closed player")
+	}
+	return 1920
+}
+
+// Run with -race: Flush replaces the player while Stats reads it
+func TestOtoStatsDuringFlush(t *testing.T) {
+	o := NewOto().(*Oto)
+	o.ready = true
+	o.sampleRate = 48000
+	o.channels = 2
+	o.newPlayer = func(io.Reader) otoPlayer { return &fakeOtoPlayer{t: t} }
+	o.player = o.newPlayer(nil)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for range 1000 {
+			if err := o.Flush(); err != nil {
+				t.Errorf("Flush failed: %v", err)
+				return
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for range 1000 {
+			if s := o.Stats(); s.Latency <= 0 {
+				t.Errorf("expected latency from the buffered player, got %v", s.Latency)
+				return
+			}
+		}
+	}()
+	wg.Wait()
+}
+
+func TestCaptureImplementsOutput(t *testing.T) {
+	var _ Output = (*Capture)(nil)
+	var _ Flusher = (*Capture)(nil)
+}
+
+func TestCaptureRecordsWrites(t *testing.T) {
+	c := NewCapture()
+
+	if err := c.Write([]int32{1}); err == nil {
+		t.Error("expected error writing before Open")
+	}
+
+	if err := c.Open(48000, 2, 24); err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	c.Write([]int32{1, 2})
+	c.Write([]int32{3, 4})
+	c.Flush()
+
+	if got := c.Samples(); len(got) != 4 || got[3] != 4 {
+		t.Errorf("expected [1 2 3 4], got %v", got)
+	}
+	if c.Writes() != 2 || c.Flushes() != 1 {
+		t.Errorf("expected 2 writes and 1 flush, got %d and %d", c.Writes(), c.Flushes())
+	}
+	if rate, ch, bits := c.Format(); rate != 48000 || ch != 2 || bits != 24 {
+		t.Errorf("unexpected format %d/%d/%d", rate, ch, bits)
+	}
+
+	c.Reset()
+	if len(c.Samples()) != 0 || c.Writes() != 0 {
+		t.Error("expected Reset to clear captured audio")
+	}
+}
@@ -0,0 +1,111 @@
+// ABOUTME: Lock-free single-producer/single-consumer ring buffer
+// ABOUTME: Feeds the real-time device callback without locks or allocation
+package output
+
+import "sync/atomic"
+
+// cacheLinePad keeps the producer and consumer indices on separate cache lines
+type cacheLinePad [64]byte
+
+// RingBuffer is a lock-free single-producer/single-consumer circular buffer
+// of audio samples. One goroutine writes while another (the real-time device
+// callback) reads; neither ever blocks or allocates.
+//
+// Indices are monotonic sample counts; a sample's slot is index % size.
+type RingBuffer struct {
+	buffer []int32
+	size   uint64
+
+	_        cacheLinePad
+	writePos atomic.Uint64 // Advanced only by the producer
+	_        cacheLinePad
+	readPos  atomic.Uint64 // Advanced only by the consumer
+	_        cacheLinePad
+
+	// discard is a pending Clear: the write index + 1 the reader should
+	// skip to (0 when none). The reader applies it on its next Read, so
+	// Clear never touches the consumer's index.
+	discard atomic.Uint64
+}
+
+// NewRingBuffer creates a ring buffer with given capacity (in samples)
+func NewRingBuffer(capacity int) *RingBuffer {
+	return &RingBuffer{
+		buffer: make([]int32, capacity),
+		size:   uint64(capacity),
+	}
+}
+
+// Write adds as many samples as fit without blocking (see Free) and
+// returns the number written. Only one goroutine may call Write.
+func (rb *RingBuffer) Write(samples []int32) int {
+	w := rb.writePos.Load()
+	r := rb.readPos.Load()
+
+	n := uint64(len(samples))
+	if free := rb.size - (w - r); n > free {
+		n = free
+	}
+	if n == 0 {
+		return 0
+	}
+
+	// Copy in at most two segments: up to the end of the buffer, then wrapped
+	start := w % rb.size
+	first := min(n, rb.size-start)
+	copy(rb.buffer[start:start+first], samples[:first])
+	copy(rb.buffer, samples[first:n])
+
+	// Publish after the copy so the reader never sees unwritten slots
+	rb.writePos.Store(w + n)
+	return int(n)
+}
+
+// Read retrieves up to len(samples) samples without blocking, zero-filling
+// the rest on underrun. Returns the number of samples read. Only one
+// goroutine may call Read.
+func (rb *RingBuffer) Read(samples []int32) int {
+	r := rb.readPos.Load()
+	if d := rb.discard.Swap(0); d != 0 && d-1 > r {
+		r = d - 1
+	}
+	w := rb.writePos.Load()
+
+	n := min(uint64(len(samples)), w-r)
+	if n > 0 {
+		start := r % rb.size
+		first := min(n, rb.size-start)
+		copy(samples[:first], rb.buffer[start:start+first])
+		copy(samples[first:n], rb.buffer[:n-first])
+	}
+
+	// Release the slots only after copying out of them
+	rb.readPos.Store(r + n)
+
+	clear(samples[n:])
+	return int(n)
+}
+
+// Available returns the number of samples available to read
+func (rb *RingBuffer) Available() int {
+	w := rb.writePos.Load()
+	r := rb.readPos.Load()
+	if d := rb.discard.Load(); d != 0 && d-1 > r {
+		r = d - 1
+	}
+	return int(w - r)
+}
+
+// Clear discards all buffered samples. It is safe to call from any
+// goroutine; samples written concurrently with Clear may survive it.
+// The reader skips the discarded samples on its next Read.
+func (rb *RingBuffer) Clear() {
+	rb.discard.Store(rb.writePos.Load() + 1)
+}
+
+// Free returns the number of samples Write can take now. Samples discarded
+// by Clear stay in use until the reader skips them on its next Read, since
+// it may still be copying them out.
+func (rb *RingBuffer) Free() int {
+	return int(rb.size - (rb.writePos.Load() - rb.readPos.Load()))
+}
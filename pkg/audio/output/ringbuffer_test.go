@@ -0,0 +1,303 @@
+// ABOUTME: Tests and benchmarks for the lock-free SPSC ring buffer
+// ABOUTME: Compares against the previous mutex-based implementation
+package output
+
+import (
+	"runtime"
+	"sync"
+	"testing"
+)
+
+func TestRingBufferWrapAround(t *testing.T) {
+	rb := NewRingBuffer(5)
+	out := make([]int32, 3)
+
+	rb.Write([]int32{1, 2, 3, 4})
+	rb.Read(out)
+
+	// Write spans the end of the buffer
+	if n := rb.Write([]int32{5, 6, 7, 8}); n != 4 {
+		t.Fatalf("expected 4 samples written, got %d", n)
+	}
+
+	out = make([]int32, 5)
+	if n := rb.Read(out); n != 5 {
+		t.Fatalf("expected 5 samples read, got %d", n)
+	}
+	for i, want := range []int32{4, 5, 6, 7, 8} {
+		if out[i] != want {
+			t.Errorf("sample %d: expected %d, got %d", i, want, out[i])
+		}
+	}
+}
+
+func TestRingBufferPartialWrite(t *testing.T) {
+	rb := NewRingBuffer(4)
+
+	if n := rb.Write([]int32{1, 2, 3, 4, 5, 6}); n != 4 {
+		t.Errorf("expected write to stop at capacity (4), got %d", n)
+	}
+	if n := rb.Write([]int32{7}); n != 0 {
+		t.Errorf("expected full buffer to accept nothing, got %d", n)
+	}
+	if rb.Free() != 0 || rb.Available() != 4 {
+		t.Errorf("expected full buffer, got %d free, %d available", rb.Free(), rb.Available())
+	}
+}
+
+func TestRingBufferUnderrunZeroFills(t *testing.T) {
+	rb := NewRingBuffer(8)
+	rb.Write([]int32{1, 2})
+
+	out := []int32{9, 9, 9, 9}
+	if n := rb.Read(out); n != 2 {
+		t.Fatalf("expected 2 samples read, got %d", n)
+	}
+	for i, want := range []int32{1, 2, 0, 0} {
+		if out[i] != want {
+			t.Errorf("sample %d: expected %d, got %d", i, want, out[i])
+		}
+	}
+}
+
+// TestRingBufferConcurrent streams a counting sequence through the buffer
+// from a producer to a consumer goroutine; run with -race.
+func TestRingBufferConcurrent(t *testing.T) {
+	const total = 200_000
+	rb := NewRingBuffer(1024)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+
+	go func() {
+		defer wg.Done()
+		chunk := make([]int32, 300)
+		next := int32(1)
+		for next <= total {
+			n := min(len(chunk), total-int(next)+1)
+			for i := 0; i < n; i++ {
+				chunk[i] = next + int32(i)
+			}
+			written := 0
+			for written < n {
+				w := rb.Write(chunk[written:n])
+				if w == 0 {
+					runtime.Gosched()
+				}
+				written += w
+			}
+			next += int32(n)
+		}
+	}()
+
+	errs := make(chan string, 1)
+	go func() {
+		defer wg.Done()
+		buf := make([]int32, 256)
+		want := int32(1)
+		for want <= total {
+			n := rb.Read(buf)
+			if n == 0 {
+				runtime.Gosched()
+			}
+			for i := 0; i < n; i++ {
+				if buf[i] != want {
+					errs <- "out of order sample"
+					return
+				}
+				want++
+			}
+		}
+	}()
+
+	wg.Wait()
+	select {
+	case msg := <-errs:
+		t.Fatal(msg)
+	default:
+	}
+}
+
+func TestRingBufferClearThenWrite(t *testing.T) {
+	rb := NewRingBuffer(8)
+	if n := rb.Write(make([]int32, 8)); n != 8 {
+		t.Fatalf("expected to fill the buffer, wrote %d", n)
+	}
+	rb.Clear()
+
+	// Discarded samples are gone for the reader but hold their slots
+	// until it skips them, and Free agrees with Write
+	if a := rb.Available(); a != 0 {
+		t.Errorf("expected nothing available after Clear, got %d", a)
+	}
+	if f := rb.Free(); f != 0 {
+		t.Errorf("expected no free slots before the reader skips, got %d", f)
+	}
+	if n := rb.Write([]int32{1}); n != rb.Free() {
+		t.Errorf("Write took %d samples, Free reported %d", n, rb.Free())
+	}
+
+	buf := make([]int32, 4)
+	if n := rb.Read(buf); n != 0 {
+		t.Errorf("expected the discarded samples to be skipped, read %d", n)
+	}
+	if f := rb.Free(); f != 8 {
+		t.Errorf("expected the whole buffer free after the skip, got %d", f)
+	}
+	if n := rb.Write([]int32{1, 2, 3}); n != 3 {
+		t.Errorf("expected to write 3 samples, wrote %d", n)
+	}
+	if n := rb.Read(buf); n != 3 || buf[0] != 1 || buf[2] != 3 {
+		t.Errorf("expected the new samples, got %d %v", n, buf)
+	}
+}
+
+func TestRingBufferConcurrentClear(t *testing.T) {
+	rb := NewRingBuffer(256)
+	done := make(chan struct{})
+
+	go func() {
+		buf := make([]int32, 64)
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				if rb.Read(buf) == 0 {
+					runtime.Gosched()
+				}
+			}
+		}
+	}()
+
+	samples := make([]int32, 100)
+	for i := 0; i < 10_000; i++ {
+		rb.Write(samples)
+		if i%10 == 0 {
+			rb.Clear()
+		}
+		if a := rb.Available(); a < 0 || a > 256 {
+			t.Fatalf("available out of range: %d", a)
+		}
+	}
+	close(done)
+}
+
+// mutexRingBuffer is the previous mutex-guarded, sample-at-a-time ring
+// buffer, kept as a benchmark baseline
+type mutexRingBuffer struct {
+	buffer   []int32
+	readPos  int
+	writePos int
+	size     int
+	count    int
+	mu       sync.Mutex
+}
+
+func newMutexRingBuffer(capacity int) *mutexRingBuffer {
+	return &mutexRingBuffer{buffer: make([]int32, capacity), size: capacity}
+}
+
+func (rb *mutexRingBuffer) Write(samples []int32) int {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+
+	written := 0
+	for i := 0; i < len(samples) && rb.count < rb.size; i++ {
+		rb.buffer[rb.writePos] = samples[i]
+		rb.writePos = (rb.writePos + 1) % rb.size
+		rb.count++
+		written++
+	}
+	return written
+}
+
+func (rb *mutexRingBuffer) Read(samples []int32) int {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+
+	read := 0
+	for i := 0; i < len(samples) && rb.count > 0; i++ {
+		samples[i] = rb.buffer[rb.readPos]
+		rb.readPos = (rb.readPos + 1) % rb.size
+		rb.count--
+		read++
+	}
+	for i := read; i < len(samples); i++ {
+		samples[i] = 0
+	}
+	return read
+}
+
+type sampleRing interface {
+	Write(samples []int32) int
+	Read(samples []int32) int
+}
+
+// 10ms of 192kHz stereo, in an 80ms buffer as used by Malgo
+const (
+	benchChunk    = 192000 * 2 / 100
+	benchCapacity = 192000 * 2 * 80 / 1000
+)
+
+func benchmarkSequential(b *testing.B, rb sampleRing) {
+	in := make([]int32, benchChunk)
+	out := make([]int32, benchChunk)
+	b.SetBytes(benchChunk * 4)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		rb.Write(in)
+		rb.Read(out)
+	}
+}
+
+func benchmarkConcurrent(b *testing.B, rb sampleRing) {
+	in := make([]int32, benchChunk)
+	b.SetBytes(benchChunk * 4)
+	done := make(chan struct{})
+
+	go func() {
+		out := make([]int32, benchChunk/2)
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				if rb.Read(out) == 0 {
+					runtime.Gosched()
+				}
+			}
+		}
+	}()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		written := 0
+		for written < len(in) {
+			w := rb.Write(in[written:])
+			if w == 0 {
+				runtime.Gosched()
+			}
+			written += w
+		}
+	}
+	b.StopTimer()
+	close(done)
+}
+
+func BenchmarkRingBufferSequential(b *testing.B) {
+	benchmarkSequential(b, NewRingBuffer(benchCapacity))
+}
+
+func BenchmarkMutexRingBufferSequential(b *testing.B) {
+	benchmarkSequential(b, newMutexRingBuffer(benchCapacity))
+}
+
+func BenchmarkRingBufferConcurrent(b *testing.B) {
+	benchmarkConcurrent(b, NewRingBuffer(benchCapacity))
+}
+
+func BenchmarkMutexRingBufferConcurrent(b *testing.B) {
+	benchmarkConcurrent(b, newMutexRingBuffer(benchCapacity))
+}
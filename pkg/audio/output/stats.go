@@ -0,0 +1,137 @@
+// ABOUTME: Output device health statistics
+// ABOUTME: Tracks underruns, overruns, callback timing and output latency
+package output
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Stats reports output device health
+type Stats struct {
+	// Underruns counts dropouts: times the device asked for audio after
+	// playing and found too little, so it played silence
+	Underruns int64
+
+	// Overruns counts writes that found the buffer full (backpressure)
+	Overruns int64
+
+	// Callbacks counts device pulls (audio callbacks) since Open
+	Callbacks int64
+
+	// CallbackInterval is the mean time between device pulls, and
+	// MaxCallbackInterval the longest gap seen
+	CallbackInterval    time.Duration
+	MaxCallbackInterval time.Duration
+
+	// Starved is how long the device has currently been short of audio
+	// (0 while it is being fed)
+	Starved time.Duration
+
+	// Latency is the audio written but not yet played
+	Latency time.Duration
+}
+
+// StatsReporter is implemented by outputs that report device statistics
+type StatsReporter interface {
+	// Stats returns a snapshot of the output's statistics
+	Stats() Stats
+}
+
+// deviceStats accumulates device pull timing and starvation. Backends
+// report every pull the device makes. Every field is an atomic and no
+// method takes a lock, so the real-time callback never waits on Stats
+// being read from another goroutine; a snapshot may mix values from
+// either side of a concurrent pull.
+type deviceStats struct {
+	callbacks    atomic.Int64
+	underruns    atomic.Int64
+	last         atomic.Int64 // Time of the last pull (Unix ns, 0 before the first)
+	totalGap     atomic.Int64 // Sum of the gaps between pulls (ns)
+	maxGap       atomic.Int64 // Longest gap between pulls (ns)
+	fed          atomic.Bool  // Device has been given audio since open/flush
+	starvedSince atomic.Int64 // Unix ns; 0 while the device is being fed
+	pending      atomic.Int64 // Start of an in-progress blocking pull (Unix ns, 0 if none)
+}
+
+// starveThreshold is how long a blocking pull may wait before it counts as starved
+const starveThreshold = 20 * time.Millisecond
+
+// pull records a completed device pull; short reports that the device got
+// less audio than it asked for
+func (d *deviceStats) pull(now time.Time, short bool) {
+	t := now.UnixNano()
+	if last := d.last.Swap(t); last != 0 {
+		gap := t - last
+		d.totalGap.Add(gap)
+		for {
+			longest := d.maxGap.Load()
+			if gap <= longest || d.maxGap.CompareAndSwap(longest, gap) {
+				break
+			}
+		}
+	}
+	d.callbacks.Add(1)
+	d.pending.Store(0)
+
+	if !short {
+		d.fed.Store(true)
+		d.starvedSince.Store(0)
+		return
+	}
+
+	// Silence before anything was written (or after a flush) isn't a dropout
+	if d.fed.Load() && d.starvedSince.CompareAndSwap(0, t) {
+		d.underruns.Add(1)
+	}
+}
+
+// beginPull marks the start of a pull that blocks until audio arrives
+func (d *deviceStats) beginPull(now time.Time) {
+	d.pending.Store(now.UnixNano())
+}
+
+// endPull completes a blocking pull. Waiting longer than starveThreshold
+// means the device ran without audio, which counts as an underrun; the
+// read returning means audio has arrived again.
+func (d *deviceStats) endPull(now time.Time) {
+	pending := d.pending.Load()
+	if pending != 0 && time.Duration(now.UnixNano()-pending) > starveThreshold && d.fed.Load() {
+		d.underruns.Add(1)
+	}
+	d.pull(now, false)
+}
+
+// idle marks the device as intentionally empty (opened or flushed)
+func (d *deviceStats) idle() {
+	d.fed.Store(false)
+	d.starvedSince.Store(0)
+}
+
+// fill copies the pull statistics into s
+func (d *deviceStats) fill(s *Stats, now time.Time) {
+	callbacks := d.callbacks.Load()
+	s.Callbacks = callbacks
+	s.Underruns = d.underruns.Load()
+	if callbacks > 1 {
+		s.CallbackInterval = time.Duration(d.totalGap.Load() / (callbacks - 1))
+	}
+	s.MaxCallbackInterval = time.Duration(d.maxGap.Load())
+
+	t := now.UnixNano()
+	starved, pending := d.starvedSince.Load(), d.pending.Load()
+	switch {
+	case starved != 0:
+		s.Starved = time.Duration(t - starved)
+	case d.fed.Load() && pending != 0 && time.Duration(t-pending) > starveThreshold:
+		s.Starved = time.Duration(t - pending)
+	}
+}
+
+// framesToDuration converts a frame count to playback time
+func framesToDuration(frames, sampleRate int) time.Duration {
+	if sampleRate <= 0 {
+		return 0
+	}
+	return time.Duration(int64(frames) * int64(time.Second) / int64(sampleRate))
+}
@@ -0,0 +1,125 @@
+// ABOUTME: Tests for output device statistics
+// ABOUTME: Verifies underrun counting, starvation and callback timing
+package output
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDeviceStatsUnderruns(t *testing.T) {
+	var d deviceStats
+	now := time.Now()
+
+	// Silence before the first write is not a dropout
+	d.pull(now, true)
+	d.pull(now.Add(10*time.Millisecond), false)
+	d.pull(now.Add(20*time.Millisecond), false)
+
+	// One dropout spanning several short callbacks
+	d.pull(now.Add(30*time.Millisecond), true)
+	d.pull(now.Add(40*time.Millisecond), true)
+
+	var s Stats
+	d.fill(&s, now.Add(50*time.Millisecond))
+	if s.Underruns != 1 {
+		t.Errorf("expected 1 underrun, got %d", s.Underruns)
+	}
+	if s.Starved != 20*time.Millisecond {
+		t.Errorf("expected starved for 20ms, got %v", s.Starved)
+	}
+	if s.Callbacks != 5 {
+		t.Errorf("expected 5 callbacks, got %d", s.Callbacks)
+	}
+	if s.CallbackInterval != 10*time.Millisecond || s.MaxCallbackInterval != 10*time.Millisecond {
+		t.Errorf("expected 10ms callback interval, got mean %v max %v", s.CallbackInterval, s.MaxCallbackInterval)
+	}
+
+	// Audio arriving ends the starvation
+	d.pull(now.Add(60*time.Millisecond), false)
+	s = Stats{}
+	d.fill(&s, now.Add(70*time.Millisecond))
+	if s.Starved != 0 {
+		t.Errorf("expected no starvation once fed, got %v", s.Starved)
+	}
+
+	// A flush empties the device on purpose
+	d.idle()
+	d.pull(now.Add(80*time.Millisecond), true)
+	s = Stats{}
+	d.fill(&s, now.Add(90*time.Millisecond))
+	if s.Underruns != 1 || s.Starved != 0 {
+		t.Errorf("expected silence after idle to be ignored, got %d underruns, starved %v", s.Underruns, s.Starved)
+	}
+}
+
+func TestDeviceStatsBlockingPull(t *testing.T) {
+	var d deviceStats
+	now := time.Now()
+
+	d.pull(now, false)
+
+	// A pull blocked past the threshold shows as starvation while waiting
+	d.beginPull(now.Add(10 * time.Millisecond))
+	var s Stats
+	d.fill(&s, now.Add(110*time.Millisecond))
+	if s.Starved != 100*time.Millisecond {
+		t.Errorf("expected starved for 100ms while blocked, got %v", s.Starved)
+	}
+
+	d.endPull(now.Add(110 * time.Millisecond))
+	s = Stats{}
+	d.fill(&s, now.Add(120*time.Millisecond))
+	if s.Underruns != 1 {
+		t.Errorf("expected blocked pull to count as an underrun, got %d", s.Underruns)
+	}
+	if s.Starved != 0 {
+		t.Errorf("expected no starvation once the pull returned, got %v", s.Starved)
+	}
+}
+
+// Run with -race: the device thread pulls while other goroutines read
+// Stats and flush. deviceStats takes no lock, so the callback never waits.
+func TestDeviceStatsConcurrent(t *testing.T) {
+	var d deviceStats
+	start := time.Now()
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := range 10000 {
+			d.pull(start.Add(time.Duration(i)*time.Millisecond), i%100 == 99)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := range 1000 {
+			var s Stats
+			d.fill(&s, time.Now())
+			if i%100 == 0 {
+				d.idle()
+			}
+		}
+	}()
+	wg.Wait()
+
+	var s Stats
+	d.fill(&s, start)
+	if s.Callbacks != 10000 {
+		t.Errorf("expected 10000 callbacks, got %d", s.Callbacks)
+	}
+	if s.MaxCallbackInterval != time.Millisecond || s.CallbackInterval != time.Millisecond {
+		t.Errorf("expected 1ms callback interval, got mean %v max %v", s.CallbackInterval, s.MaxCallbackInterval)
+	}
+}
+
+func TestFramesToDuration(t *testing.T) {
+	if got := framesToDuration(480, 48000); got != 10*time.Millisecond {
+		t.Errorf("expected 10ms, got %v", got)
+	}
+	if got := framesToDuration(480, 0); got != 0 {
+		t.Errorf("expected 0 for unknown rate, got %v", got)
+	}
+}
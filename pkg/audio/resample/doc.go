@@ -1,12 +1,15 @@
-// ABOUTME: Audio resampling package using linear interpolation
+// ABOUTME: Audio resampling package using a polyphase windowed-sinc filter
 // ABOUTME: Converts audio between different sample rates
 // Package resample provides audio sample rate conversion.
 //
-// Uses linear interpolation for converting between sample rates.
-// Handles both upsampling and downsampling.
+// Uses a polyphase Kaiser-windowed sinc filter for arbitrary ratios,
+// handling both upsampling and downsampling without aliasing. Quality
+// presets trade CPU for filter length; run the package benchmarks to pick
+// one for low-power players. Input is buffered across calls, and the
+// ratio can be adjusted at runtime for clock drift correction.
 //
 // Example:
 //
-//	r := resample.New(44100, 48000, 2)
+//	r := resample.NewWithQuality(44100, 48000, 2, resample.QualityMedium)
 //	outputSize := r.Resample(inputSamples, outputSamples)
 package resample
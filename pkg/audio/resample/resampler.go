@@ -1,93 +1,346 @@
-// ABOUTME: Simple linear resampler for converting audio sample rates
-// ABOUTME: Used to convert between different sample rates using linear interpolation
+// ABOUTME: Polyphase windowed-sinc resampler for converting audio sample rates
+// ABOUTME: Supports quality presets, arbitrary ratios and runtime ratio adjustment
 package resample
 
-// Resampler performs linear interpolation to convert between sample rates
+import (
+	"math"
+
+	"github.com/Sendspin/sendspin-go/pkg/audio"
+)
+
+// Quality selects a filter preset, trading CPU for passband width and
+// stopband rejection
+type Quality int
+
+const (
+	// QualityLow uses 16 taps: ~60 dB rejection, flat to ~50% of Nyquist
+	QualityLow Quality = iota
+
+	// QualityMedium uses 48 taps: ~80 dB rejection, flat to ~75% of Nyquist
+	QualityMedium
+
+	// QualityHigh uses 96 taps: ~100 dB rejection, flat to ~85% of Nyquist
+	QualityHigh
+
+	// QualityBest uses 192 taps: ~120 dB rejection, flat to ~90% of Nyquist
+	QualityBest
+)
+
+// String returns the preset name
+func (q Quality) String() string {
+	switch q {
+	case QualityLow:
+		return "low"
+	case QualityMedium:
+		return "medium"
+	case QualityHigh:
+		return "high"
+	case QualityBest:
+		return "best"
+	default:
+		return "unknown"
+	}
+}
+
+// preset describes the filter behind a quality level
+type preset struct {
+	halfTaps    int     // Zero crossings on each side of the sinc
+	attenuation float64 // Stopband rejection (dB)
+	phases      int     // Polyphase table resolution
+}
+
+var presets = map[Quality]preset{
+	QualityLow:    {halfTaps: 8, attenuation: 60, phases: 64},
+	QualityMedium: {halfTaps: 24, attenuation: 80, phases: 256},
+	QualityHigh:   {halfTaps: 48, attenuation: 100, phases: 512},
+	QualityBest:   {halfTaps: 96, attenuation: 120, phases: 1024},
+}
+
+// Resampler converts interleaved audio between sample rates with a
+// polyphase Kaiser-windowed sinc filter. Input is buffered across calls,
+// so a stream may be fed in chunks of any size.
+//
+// Output is delayed by half the filter length (see Latency); equal rates
+// pass samples through untouched until a ratio adjustment is made.
 type Resampler struct {
 	inputRate  int
 	outputRate int
 	channels   int
-	ratio      float64
-	position   float64
-	lastSample []int32 // one sample per channel
+	quality    Quality
+	ratio      float64 // Input frames per output frame, before adjustment
+	adjust     float64 // Runtime ratio adjustment (1 = none)
+	step       float64 // Input frames advanced per output frame
+
+	// Polyphase table: phases+1 rows of taps coefficients; row i holds the
+	// filter for a fractional offset of i/phases. float32 keeps it compact
+	// while staying well below 24-bit resolution.
+	halfN  int
+	taps   int
+	phases int
+	table  []float32
+
+	// history holds buffered input frames (interleaved); position is the
+	// filter centre for the next output frame, in frames into history
+	history     []int32
+	position    float64
+	passthrough bool
+	coeffs      []float64 // Interpolated filter for the current output frame
 }
 
-// New creates a new resampler
+// New creates a resampler using the high quality preset
 func New(inputRate, outputRate, channels int) *Resampler {
-	return &Resampler{
+	return NewWithQuality(inputRate, outputRate, channels, QualityHigh)
+}
+
+// NewWithQuality creates a resampler using a quality preset
+func NewWithQuality(inputRate, outputRate, channels int, quality Quality) *Resampler {
+	p, ok := presets[quality]
+	if !ok {
+		quality = QualityHigh
+		p = presets[quality]
+	}
+	channels = max(channels, 1)
+
+	r := &Resampler{
 		inputRate:  inputRate,
 		outputRate: outputRate,
 		channels:   channels,
+		quality:    quality,
 		ratio:      float64(inputRate) / float64(outputRate),
-		position:   0.0,
-		lastSample: make([]int32, channels),
+		adjust:     1,
+		phases:     p.phases,
+	}
+	r.step = r.ratio
+	r.buildTable(p)
+	r.coeffs = make([]float64, r.taps)
+	r.Reset()
+	return r
+}
+
+// buildTable designs the anti-aliasing filter and splits it into phases
+func (r *Resampler) buildTable(p preset) {
+	// Kaiser design: transition width (as a fraction of Nyquist) for the
+	// requested rejection, with the stopband starting at Nyquist
+	transition := (p.attenuation - 8) / (2.285 * float64(2*p.halfTaps-1)) / math.Pi
+	cutoff := 1 - transition/2
+	beta := 0.1102 * (p.attenuation - 8.7)
+
+	// When downsampling, lower the cutoff to the output Nyquist and widen
+	// the filter to match
+	scale := 1.0
+	if r.ratio > 1 {
+		scale = 1 / r.ratio
+	}
+	fc := cutoff * scale
+	r.halfN = int(math.Ceil(float64(p.halfTaps) / scale))
+	r.taps = 2 * r.halfN
+
+	r.table = make([]float32, (r.phases+1)*r.taps)
+	row := make([]float64, r.taps)
+	i0Beta := besselI0(beta)
+	for phase := 0; phase <= r.phases; phase++ {
+		frac := float64(phase) / float64(r.phases)
+		clear(row)
+
+		var sum float64
+		for j := range row {
+			x := float64(j-r.halfN+1) - frac
+			t := x / float64(r.halfN)
+			if t <= -1 || t >= 1 {
+				continue
+			}
+			w := besselI0(beta*math.Sqrt(1-t*t)) / i0Beta
+			row[j] = fc * sinc(fc*x) * w
+			sum += row[j]
+		}
+
+		// Unity gain at DC for every phase
+		for j, v := range row {
+			r.table[phase*r.taps+j] = float32(v / sum)
+		}
+	}
+}
+
+// sinc returns sin(pi x)/(pi x)
+func sinc(x float64) float64 {
+	if x == 0 {
+		return 1
+	}
+	return math.Sin(math.Pi*x) / (math.Pi * x)
+}
+
+// besselI0 returns the zeroth-order modified Bessel function of the first kind
+func besselI0(x float64) float64 {
+	sum, term := 1.0, 1.0
+	for k := 1; k < 50; k++ {
+		term *= (x / (2 * float64(k))) * (x / (2 * float64(k)))
+		sum += term
+		if term < sum*1e-16 {
+			break
+		}
 	}
+	return sum
 }
 
-// Resample converts input samples to output sample rate using linear interpolation
+// Quality returns the filter preset in use
+func (r *Resampler) Quality() Quality {
+	return r.quality
+}
+
+// Latency returns the delay the filter adds, in input frames. Equal-rate
+// passthrough adds none until a ratio adjustment is made.
+func (r *Resampler) Latency() int {
+	if r.passthrough {
+		return 0
+	}
+	return r.halfN
+}
+
+// SetRatioAdjustment scales the output rate by factor at runtime, e.g.
+// 1.0001 produces 0.01% more output, for clock drift correction. The
+// change applies from the next output frame without a discontinuity.
+// The anti-aliasing filter is not redesigned, so keep factor close to 1.
+func (r *Resampler) SetRatioAdjustment(factor float64) {
+	if factor <= 0 {
+		return
+	}
+	r.adjust = factor
+	r.step = r.ratio / factor
+	if factor != 1 {
+		r.passthrough = false
+	}
+}
+
+// RatioAdjustment returns the current runtime ratio adjustment
+func (r *Resampler) RatioAdjustment() float64 {
+	return r.adjust
+}
+
+// Resample converts input samples to output sample rate
 // input: interleaved samples at inputRate
 // output: interleaved samples at outputRate
+// Returns the number of samples written. Input that cannot be consumed
+// yet (filter lookahead, or a full output) is kept for the next call.
 func (r *Resampler) Resample(input []int32, output []int32) int {
-	if len(input) == 0 {
-		return 0
-	}
+	r.history = append(r.history, input[:len(input)/r.channels*r.channels]...)
 
-	inputFrames := len(input) / r.channels
+	frames := len(r.history) / r.channels
 	outputFrames := len(output) / r.channels
-
 	outIdx := 0
 
-	for outIdx < outputFrames {
-		// Calculate which input frame we need
-		inputPos := r.position
-		inputIdx := int(inputPos)
+	for ; outIdx < outputFrames; outIdx++ {
+		base := int(r.position)
 
-		// If we've consumed all input, stop
-		if inputIdx >= inputFrames-1 {
+		if r.passthrough {
+			if base >= frames {
+				break
+			}
+			copy(output[outIdx*r.channels:(outIdx+1)*r.channels], r.history[base*r.channels:(base+1)*r.channels])
+			r.position++
+			continue
+		}
+
+		// The filter needs halfN frames after the centre
+		if base+r.halfN >= frames {
 			break
 		}
 
-		// Linear interpolation factor
-		frac := inputPos - float64(inputIdx)
+		// Interpolate coefficients between the two nearest phases
+		p := (r.position - float64(base)) * float64(r.phases)
+		phase := int(p)
+		t := p - float64(phase)
+		row0 := r.table[phase*r.taps : (phase+1)*r.taps]
+		row1 := r.table[(phase+1)*r.taps : (phase+2)*r.taps]
 
-		// Interpolate each channel
-		for ch := 0; ch < r.channels; ch++ {
-			sample1 := input[inputIdx*r.channels+ch]
-			sample2 := input[(inputIdx+1)*r.channels+ch]
+		for j := range r.coeffs {
+			c0 := float64(row0[j])
+			r.coeffs[j] = c0 + t*(float64(row1[j])-c0)
+		}
 
-			// Linear interpolation
-			interpolated := float64(sample1)*(1.0-frac) + float64(sample2)*frac
-			output[outIdx*r.channels+ch] = int32(interpolated)
+		first := (base - r.halfN + 1) * r.channels
+		for ch := 0; ch < r.channels; ch++ {
+			window := r.history[first+ch : first+r.taps*r.channels]
+			var acc float64
+			for j, c := range r.coeffs {
+				acc += c * float64(window[j*r.channels])
+			}
+			output[outIdx*r.channels+ch] = clamp24(math.Round(acc))
 		}
+		r.position += r.step
+	}
+
+	r.trim()
+	return outIdx * r.channels
+}
 
-		outIdx++
-		r.position += r.ratio
+// trim drops history frames the filter no longer needs
+func (r *Resampler) trim() {
+	drop := int(r.position) - r.halfN + 1
+	if drop <= 0 {
+		return
 	}
+	drop = min(drop, len(r.history)/r.channels)
 
-	// Reset position for next chunk, keeping fractional part
-	r.position -= float64(int(r.position))
+	n := copy(r.history, r.history[drop*r.channels:])
+	r.history = r.history[:n]
+	r.position -= float64(drop)
+}
 
-	return outIdx * r.channels
+// clamp24 limits filter overshoot to the 24-bit sample range
+func clamp24(v float64) int32 {
+	if v > audio.Max24Bit {
+		return audio.Max24Bit
+	}
+	if v < audio.Min24Bit {
+		return audio.Min24Bit
+	}
+	return int32(v)
 }
 
 // Reset resets the resampler state
 func (r *Resampler) Reset() {
-	r.position = 0.0
-	for i := range r.lastSample {
-		r.lastSample[i] = 0
+	// Silence before the stream lets output start without waiting for
+	// lookahead; equal-rate passthrough starts aligned with the input
+	zeros := 2*r.halfN - 1
+	r.history = make([]int32, zeros*r.channels, (zeros+4096)*r.channels)
+	r.passthrough = r.inputRate == r.outputRate && r.adjust == 1
+	if r.passthrough {
+		r.position = float64(zeros)
+	} else {
+		r.position = float64(zeros - r.halfN)
 	}
 }
 
+// available returns the last output centre the buffered input can feed
+func (r *Resampler) available(frames int) float64 {
+	if r.passthrough {
+		return float64(frames - 1)
+	}
+	return float64(frames - 1 - r.halfN)
+}
+
 // OutputSamplesNeeded calculates how many output samples will be produced from input samples
 func (r *Resampler) OutputSamplesNeeded(inputSamples int) int {
-	inputFrames := inputSamples / r.channels
-	outputFrames := int(float64(inputFrames) / r.ratio)
-	return outputFrames * r.channels
+	frames := len(r.history)/r.channels + inputSamples/r.channels
+	last := r.available(frames)
+	if last < r.position {
+		return 0
+	}
+	return (int((last-r.position)/r.step) + 1) * r.channels
 }
 
 // InputSamplesNeeded calculates how many input samples are needed to produce output samples
 func (r *Resampler) InputSamplesNeeded(outputSamples int) int {
 	outputFrames := outputSamples / r.channels
-	inputFrames := int(float64(outputFrames) * r.ratio)
-	return inputFrames * r.channels
+	if outputFrames == 0 {
+		return 0
+	}
+
+	// Frames needed so the last output's centre is available
+	lastCentre := r.position + float64(outputFrames-1)*r.step
+	frames := int(math.Floor(lastCentre)) + 1
+	if !r.passthrough {
+		frames += r.halfN
+	}
+	return max(frames-len(r.history)/r.channels, 0) * r.channels
 }
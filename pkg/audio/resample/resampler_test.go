@@ -1,8 +1,9 @@
 // ABOUTME: Tests for audio resampler
-// ABOUTME: Tests linear interpolation resampling between sample rates
+// ABOUTME: Tests sinc resampling between sample rates, filter quality and streaming
 package resample
 
 import (
+	"math"
 	"testing"
 )
 
@@ -121,14 +122,15 @@ func TestResampleStereo(t *testing.T) {
 	// Test that stereo channels are handled correctly
 	r := New(44100, 48000, 2)
 
-	// Create input with different L/R patterns
-	input := make([]int32, 20) // 10 stereo samples
-	for i := 0; i < 10; i++ {
+	// Create input with different L/R patterns, long enough to get past
+	// the filter delay
+	input := make([]int32, 400) // 200 stereo samples
+	for i := 0; i < 200; i++ {
 		input[i*2] = 1000    // Left channel
 		input[i*2+1] = -1000 // Right channel
 	}
 
-	output := make([]int32, 30) // Space for upsampled output
+	output := make([]int32, 500) // Space for upsampled output
 	n := r.Resample(input, output)
 
 	if n == 0 {
@@ -258,3 +260,226 @@ func abs(x int) int {
 	}
 	return x
 }
+
+// measureTone resamples one second of a half-scale sine and returns the
+// output's gain at the tone frequency and its total output level, both
+// relative to the input amplitude (dB). Tones above the output Nyquist
+// alias, so only the total level is meaningful for them.
+func measureTone(quality Quality, inRate, outRate int, freq float64) (gain, level float64) {
+	const amp = 0.5 * 8388607
+	input := make([]int32, inRate)
+	for i := range input {
+		input[i] = int32(math.Round(amp * math.Sin(2*math.Pi*freq*float64(i)/float64(inRate))))
+	}
+
+	r := NewWithQuality(inRate, outRate, 1, quality)
+	output := make([]int32, outRate+100)
+	n := r.Resample(input, output)
+
+	// Skip the filter's start-up transient
+	skip := (r.Latency()*outRate/inRate + 1) * 2
+	out := output[skip:n]
+
+	// Least-squares fit of sine and cosine at the tone frequency
+	var ss, cc, sc, ys, yc, total float64
+	for i, v := range out {
+		phase := 2 * math.Pi * freq * float64(i+skip) / float64(outRate)
+		s, c := math.Sin(phase), math.Cos(phase)
+		ss += s * s
+		cc += c * c
+		sc += s * c
+		ys += float64(v) * s
+		yc += float64(v) * c
+		total += float64(v) * float64(v)
+	}
+	det := ss*cc - sc*sc
+	a := (ys*cc - yc*sc) / det
+	b := (yc*ss - ys*sc) / det
+
+	gain = 20 * math.Log10(math.Hypot(a, b)/amp)
+	level = 10 * math.Log10(total/float64(len(out))/(amp*amp/2))
+	return gain, level
+}
+
+var qualityLimits = []struct {
+	quality   Quality
+	flatTo    float64 // Passband edge as a fraction of Nyquist
+	ripple    float64 // Maximum passband deviation (dB)
+	rejection float64 // Minimum stopband rejection (dB)
+}{
+	{QualityLow, 0.5, 0.05, 55},
+	{QualityMedium, 0.75, 0.01, 80},
+	{QualityHigh, 0.85, 0.001, 100},
+	{QualityBest, 0.9, 0.001, 120},
+}
+
+func TestResamplePassbandRipple(t *testing.T) {
+	for _, tt := range qualityLimits {
+		worst := 0.0
+		for _, frac := range []float64{0.01, 0.1, 0.25, 0.4, 0.5, 0.6, 0.75, 0.85, 0.9} {
+			if frac > tt.flatTo {
+				break
+			}
+			// 44.1kHz -> 48kHz: the filter sits at the input Nyquist
+			gain, _ := measureTone(tt.quality, 44100, 48000, frac*22050)
+			worst = max(worst, math.Abs(gain))
+		}
+		t.Logf("%s: passband ripple %.5f dB up to %.0f%% of Nyquist", tt.quality, worst, tt.flatTo*100)
+
+		if worst > tt.ripple {
+			t.Errorf("%s: passband ripple %.5f dB exceeds %.3f dB", tt.quality, worst, tt.ripple)
+		}
+	}
+}
+
+func TestResampleStopbandRejection(t *testing.T) {
+	for _, tt := range qualityLimits {
+		worst := math.Inf(-1)
+		// 96kHz -> 48kHz: everything above 24kHz must be rejected
+		for _, freq := range []float64{24500, 26000, 30000, 40000} {
+			_, level := measureTone(tt.quality, 96000, 48000, freq)
+			worst = max(worst, level)
+		}
+		t.Logf("%s: stopband rejection %.1f dB", tt.quality, -worst)
+
+		if -worst < tt.rejection {
+			t.Errorf("%s: stopband rejection %.1f dB, want at least %.0f dB", tt.quality, -worst, tt.rejection)
+		}
+	}
+}
+
+func TestResampleStreamingMatchesSingleCall(t *testing.T) {
+	input := make([]int32, 2*4410)
+	for i := range input {
+		input[i] = int32(1e6 * math.Sin(float64(i)*0.01))
+	}
+
+	whole := make([]int32, 2*5000)
+	n := New(44100, 48000, 2).Resample(input, whole)
+
+	// Feed the same audio in uneven chunks of whole frames
+	r := New(44100, 48000, 2)
+	var chunked []int32
+	for pos, frames := 0, 1; pos < len(input); frames = frames*3%499 + 1 {
+		end := min(pos+frames*2, len(input))
+		out := make([]int32, 2*600)
+		m := r.Resample(input[pos:end], out)
+		chunked = append(chunked, out[:m]...)
+		pos = end
+	}
+	for out := make([]int32, 2*600); ; {
+		m := r.Resample(nil, out)
+		if m == 0 {
+			break
+		}
+		chunked = append(chunked, out[:m]...)
+	}
+
+	if len(chunked) != n {
+		t.Fatalf("expected %d samples from chunks, got %d", n, len(chunked))
+	}
+	for i := range chunked {
+		if chunked[i] != whole[i] {
+			t.Fatalf("sample %d: chunked %d, single call %d", i, chunked[i], whole[i])
+		}
+	}
+}
+
+func TestResampleSmallOutputKeepsInput(t *testing.T) {
+	r := New(48000, 44100, 1)
+	input := make([]int32, 4800)
+
+	total := 0
+	out := make([]int32, 100)
+	total += r.Resample(input, out)
+	for i := 0; i < 100; i++ {
+		total += r.Resample(nil, out)
+	}
+
+	// Everything buffered is eventually produced
+	want := 4800 * 44100 / 48000
+	if total < want-2 || total > want+2 {
+		t.Errorf("expected ~%d samples, got %d", want, total)
+	}
+}
+
+func TestResampleInputSamplesNeeded(t *testing.T) {
+	for _, rates := range [][2]int{{44100, 48000}, {192000, 48000}, {48000, 48000}} {
+		r := New(rates[0], rates[1], 2)
+		out := make([]int32, 2*480)
+
+		for i := 0; i < 5; i++ {
+			input := make([]int32, r.InputSamplesNeeded(len(out)))
+			if n := r.Resample(input, out); n != len(out) {
+				t.Errorf("%d -> %d: expected %d samples, got %d", rates[0], rates[1], len(out), n)
+			}
+		}
+	}
+}
+
+func TestResampleRatioAdjustment(t *testing.T) {
+	const freq = 1000.0
+	r := New(48000, 48000, 1)
+	if r.Latency() != 0 {
+		t.Errorf("expected no latency in passthrough, got %d", r.Latency())
+	}
+
+	input := make([]int32, 48000)
+	for i := range input {
+		input[i] = int32(4e6 * math.Sin(2*math.Pi*freq*float64(i)/48000))
+	}
+
+	// Pass through the first half, then speed up by 0.5% mid-stream
+	first := make([]int32, 24000)
+	n1 := r.Resample(input[:24000], first)
+	r.SetRatioAdjustment(1.005)
+	second := make([]int32, 30000)
+	n2 := r.Resample(input[24000:], second)
+
+	if n1 != 24000 {
+		t.Errorf("expected passthrough of 24000 samples, got %d", n1)
+	}
+	want := int(float64(24000-r.Latency()) * 1.005)
+	if n2 < want-2 || n2 > want+2 {
+		t.Errorf("expected ~%d adjusted samples, got %d", want, n2)
+	}
+
+	// The joined output is a continuous sine (at a slightly lower pitch
+	// after the switch): no sample-to-sample jump beyond the sine's slope
+	out := append(first[:n1], second[:n2]...)
+	maxStep := 4e6 * 2 * math.Pi * freq / 48000 * 1.01
+	for i := 1; i < len(out); i++ {
+		if step := math.Abs(float64(out[i] - out[i-1])); step > maxStep {
+			t.Fatalf("discontinuity at sample %d: step %.0f exceeds %.0f", i, step, maxStep)
+		}
+	}
+}
+
+func benchmarkResample(b *testing.B, inRate, outRate int) {
+	for _, q := range []Quality{QualityLow, QualityMedium, QualityHigh, QualityBest} {
+		b.Run(q.String(), func(b *testing.B) {
+			r := NewWithQuality(inRate, outRate, 2, q)
+
+			// 20ms of stereo audio per call
+			input := make([]int32, inRate/50*2)
+			for i := range input {
+				input[i] = int32(i * 997 % 65536)
+			}
+			output := make([]int32, outRate/50*2+64)
+			b.SetBytes(int64(len(input) * 4))
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				r.Resample(input, output)
+			}
+		})
+	}
+}
+
+func BenchmarkResample44100To48000(b *testing.B) {
+	benchmarkResample(b, 44100, 48000)
+}
+
+func BenchmarkResample192000To48000(b *testing.B) {
+	benchmarkResample(b, 192000, 48000)
+}
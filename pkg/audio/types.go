@@ -27,7 +27,8 @@ type Buffer struct {
 	Format    Format
 }
 
-// SampleToInt16 converts int32 sample to int16 (for 16-bit playback)
+// SampleToInt16 converts int32 sample to int16 by truncation. Use
+// dsp.Dither to requantize audio without correlated distortion.
 func SampleToInt16(sample int32) int16 {
 	// Right-shift to convert 24-bit (or 16-bit) to 16-bit range
 	return int16(sample >> 8)
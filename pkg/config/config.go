@@ -0,0 +1,329 @@
+// ABOUTME: Settings for the server and player binaries
+// ABOUTME: Loads them from a TOML file and the environment, and maps them onto ServerConfig and PlayerConfig
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/Sendspin/sendspin-go/pkg/audio"
+	"github.com/Sendspin/sendspin-go/pkg/audio/dsp"
+	"github.com/Sendspin/sendspin-go/pkg/audio/loudness"
+	"github.com/Sendspin/sendspin-go/pkg/sendspin"
+)
+
+// Config holds every setting of both binaries. Keys are the toml tags,
+// nested by table, e.g. "player.dsp.eq".
+type Config struct {
+	Server Server `toml:"server"`
+	Player Player `toml:"player"`
+
+	// Groups assigns clients to groups: group name to client IDs
+	Groups map[string][]string `toml:"groups"`
+
+	Auth Auth `toml:"auth"`
+	TLS  TLS  `toml:"tls"`
+
+	// origins records where each key was set: a file, "$VAR" or a flag
+	origins map[string]string
+}
+
+// Server holds the [server] table
+type Server struct {
+	Name string `toml:"name"`
+	Port int    `toml:"port"`
+
+	// Sources are files, http(s) URLs or "-" for PCM on stdin; the first
+	// plays and the rest are queued. Empty plays a test tone.
+	Sources      []string `toml:"sources"`
+	PipeRate     int      `toml:"pipe_rate"`
+	PipeChannels int      `toml:"pipe_channels"`
+	PipeBits     int      `toml:"pipe_bits"`
+
+	Codecs              []string      `toml:"codecs"`
+	LeadTime            time.Duration `toml:"lead_time"`
+	Crossfade           time.Duration `toml:"crossfade"`
+	Normalization       string        `toml:"normalization"`
+	NormalizationTarget float64       `toml:"normalization_target"`
+	StateFile           string        `toml:"state_file"`
+
+	MDNS              bool     `toml:"mdns"`
+	Interfaces        []string `toml:"interfaces"`
+	ExcludeInterfaces []string `toml:"exclude_interfaces"`
+
+	// Metrics is the address serving /metrics; empty disables it
+	Metrics string `toml:"metrics"`
+
+	LogFile string `toml:"log_file"`
+	Debug   bool   `toml:"debug"`
+	TUI     bool   `toml:"tui"`
+}
+
+// Player holds the [player] table
+type Player struct {
+	Name            string   `toml:"name"`
+	Server          string   `toml:"server"`
+	Prefer          string   `toml:"prefer"`
+	FallbackServers []string `toml:"fallback_servers"`
+
+	// Port is where the player listens for servers and advertises itself
+	Port              int      `toml:"port"`
+	Interfaces        []string `toml:"interfaces"`
+	ExcludeInterfaces []string `toml:"exclude_interfaces"`
+
+	BufferMs      int           `toml:"buffer_ms"`
+	Channels      int           `toml:"channels"`
+	Device        string        `toml:"device"`
+	BitPerfect    bool          `toml:"bit_perfect"`
+	StateFile     string        `toml:"state_file"`
+	LatencyOffset time.Duration `toml:"latency_offset"`
+	MaxVolume     int           `toml:"max_volume"`
+
+	DSP DSP `toml:"dsp"`
+
+	// ImpulseResponseDir holds the impulse responses servers may select
+	// by file name with the "dsp" command; empty refuses them
+	ImpulseResponseDir string `toml:"impulse_response_dir"`
+
+	// Metrics is the address serving /metrics; empty disables it
+	Metrics string `toml:"metrics"`
+
+	LogFile string `toml:"log_file"`
+	TUI     bool   `toml:"tui"`
+}
+
+// DSP holds the [player.dsp] table
+type DSP struct {
+	Preamp float64 `toml:"preamp"`
+
+	// EQ bands as type:frequency[:gain[:q]] (see dsp.ParseFilter)
+	EQ []string `toml:"eq"`
+
+	ImpulseResponse string `toml:"impulse_response"`
+}
+
+// Auth holds the [auth] table
+type Auth struct {
+	// Token is a shared secret servers and players must both present
+	Token string `toml:"token"`
+}
+
+// TLS holds the [tls] table
+type TLS struct {
+	// Enabled serves wss:// from the server, using Cert and Key, and
+	// connects players with wss://, trusting CA (default: system roots)
+	Enabled bool   `toml:"enabled"`
+	Cert    string `toml:"cert"`
+	Key     string `toml:"key"`
+	CA      string `toml:"ca"`
+}
+
+// Default returns the settings used where a file, the environment and
+// flags leave them unset
+func Default() *Config {
+	return &Config{
+		Server: Server{
+			Port:                8927,
+			PipeRate:            48000,
+			PipeChannels:        2,
+			PipeBits:            16,
+			Codecs:              slices.Clone(sendspin.DefaultCodecs),
+			LeadTime:            sendspin.BufferAheadMs * time.Millisecond,
+			Normalization:       string(loudness.ModeOff),
+			NormalizationTarget: loudness.ReferenceLoudness,
+			MDNS:                true,
+			LogFile:             "sendspin-server.log",
+			TUI:                 true,
+		},
+		Player: Player{
+			Port:      8927,
+			BufferMs:  150,
+			Channels:  2,
+			StateFile: sendspin.DefaultStateFile(),
+			MaxVolume: 100,
+			LogFile:   "sendspin-player.log",
+			TUI:       true,
+		},
+	}
+}
+
+// Load returns the defaults overridden by the file at path (if not empty)
+// and then by SENDSPIN_* environment variables
+func Load(path string) (*Config, error) {
+	c := Default()
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read config: %w", err)
+		}
+		if err := c.Decode(path, string(data)); err != nil {
+			return nil, err
+		}
+	}
+	if err := c.ApplyEnv(os.Environ()); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// ServerConfig validates the settings the server uses and maps them onto
+// a ServerConfig. Source and callbacks are left for the caller.
+func (c *Config) ServerConfig() (sendspin.ServerConfig, error) {
+	var errs []error
+	fail := func(key, format string, args ...any) {
+		errs = append(errs, c.errorf(key, format, args...))
+	}
+
+	s := c.Server
+	if s.Port < 1 || s.Port > 65535 {
+		fail("server.port", "must be between 1 and 65535, got %d", s.Port)
+	}
+	for _, source := range s.Sources {
+		if source == "" {
+			fail("server.sources", "sources must not be empty")
+		}
+		if source == "-" && len(s.Sources) > 1 {
+			fail("server.sources", `stdin ("-") can't be combined with other sources`)
+		}
+	}
+	if s.PipeRate < 1 {
+		fail("server.pipe_rate", "must be positive, got %d", s.PipeRate)
+	}
+	if s.PipeChannels < 1 || s.PipeChannels > audio.MaxChannels {
+		fail("server.pipe_channels", "must be between 1 and %d, got %d", audio.MaxChannels, s.PipeChannels)
+	}
+	if s.PipeBits != 16 && s.PipeBits != 24 && s.PipeBits != 32 {
+		fail("server.pipe_bits", "must be 16, 24 or 32, got %d", s.PipeBits)
+	}
+	for _, codec := range s.Codecs {
+		if codec != "pcm" && codec != "opus" && codec != "flac" {
+			fail("server.codecs", "unsupported codec %q (supported: pcm, opus, flac)", codec)
+		}
+	}
+	if s.LeadTime < sendspin.ChunkDurationMs*time.Millisecond {
+		fail("server.lead_time", "must be at least %dms, got %v", sendspin.ChunkDurationMs, s.LeadTime)
+	}
+	if s.Crossfade < 0 || s.Crossfade > sendspin.MaxCrossfade {
+		fail("server.crossfade", "must be between 0 and %v, got %v", sendspin.MaxCrossfade, s.Crossfade)
+	}
+	mode, err := loudness.ParseMode(s.Normalization)
+	if err != nil {
+		fail("server.normalization", "%v", err)
+	}
+
+	member := make(map[string]string)
+	for _, group := range slices.Sorted(maps.Keys(c.Groups)) {
+		for _, id := range c.Groups[group] {
+			if other, ok := member[id]; ok {
+				fail("groups."+group, "client %q is already in group %q", id, other)
+			}
+			member[id] = group
+		}
+	}
+
+	config := sendspin.ServerConfig{
+		Port:                s.Port,
+		Name:                s.Name,
+		EnableMDNS:          s.MDNS,
+		Interfaces:          s.Interfaces,
+		ExcludeInterfaces:   s.ExcludeInterfaces,
+		Debug:               s.Debug,
+		Normalization:       mode,
+		NormalizationTarget: s.NormalizationTarget,
+		Crossfade:           s.Crossfade,
+		StateFile:           s.StateFile,
+		Codecs:              s.Codecs,
+		LeadTime:            s.LeadTime,
+		AuthToken:           c.Auth.Token,
+	}
+	if c.TLS.Enabled {
+		if c.TLS.Cert == "" || c.TLS.Key == "" {
+			fail("tls.enabled", "the server needs tls.cert and tls.key")
+		}
+		config.TLSCertFile = c.TLS.Cert
+		config.TLSKeyFile = c.TLS.Key
+	}
+
+	return config, errors.Join(errs...)
+}
+
+// PlayerConfig validates the settings the player uses and maps them onto
+// a PlayerConfig. Discovery, output and callbacks are left for the caller.
+func (c *Config) PlayerConfig() (sendspin.PlayerConfig, error) {
+	var errs []error
+	fail := func(key, format string, args ...any) {
+		errs = append(errs, c.errorf(key, format, args...))
+	}
+
+	p := c.Player
+	if p.Port < 1 || p.Port > 65535 {
+		fail("player.port", "must be between 1 and 65535, got %d", p.Port)
+	}
+	if p.BufferMs < 1 {
+		fail("player.buffer_ms", "must be positive, got %d", p.BufferMs)
+	}
+	if p.Channels < 1 || p.Channels > audio.MaxChannels {
+		fail("player.channels", "must be between 1 and %d, got %d", audio.MaxChannels, p.Channels)
+	}
+	if p.MaxVolume < 1 || p.MaxVolume > 100 {
+		fail("player.max_volume", "must be between 1 and 100, got %d", p.MaxVolume)
+	}
+
+	chain := dsp.ChainConfig{Preamp: p.DSP.Preamp, ImpulseResponse: p.DSP.ImpulseResponse}
+	for _, band := range p.DSP.EQ {
+		filter, err := dsp.ParseFilter(band)
+		if err != nil {
+			fail("player.dsp.eq", "%v", err)
+			continue
+		}
+		chain.Filters = append(chain.Filters, filter)
+	}
+
+	config := sendspin.PlayerConfig{
+		ServerAddr:         p.Server,
+		PreferredServer:    p.Prefer,
+		FallbackServers:    p.FallbackServers,
+		StateFile:          p.StateFile,
+		PlayerName:         p.Name,
+		LatencyOffset:      p.LatencyOffset,
+		BufferMs:           p.BufferMs,
+		Channels:           p.Channels,
+		Device:             p.Device,
+		BitPerfect:         p.BitPerfect,
+		MaxVolume:          p.MaxVolume,
+		DSP:                chain,
+		ImpulseResponseDir: p.ImpulseResponseDir,
+		AuthToken:          c.Auth.Token,
+	}
+	if c.TLS.Enabled {
+		config.TLS = &tls.Config{}
+		if c.TLS.CA != "" {
+			pem, err := os.ReadFile(c.TLS.CA)
+			if err != nil {
+				fail("tls.ca", "%v", err)
+			} else {
+				config.TLS.RootCAs = x509.NewCertPool()
+				if !config.TLS.RootCAs.AppendCertsFromPEM(pem) {
+					fail("tls.ca", "no certificates found in %s", c.TLS.CA)
+				}
+			}
+		}
+	}
+
+	return config, errors.Join(errs...)
+}
+
+// errorf reports a problem with a setting, naming where it was set
+func (c *Config) errorf(key, format string, args ...any) error {
+	msg := fmt.Sprintf(format, args...)
+	if origin, ok := c.origins[key]; ok {
+		return fmt.Errorf("%s: %s: %s", origin, key, msg)
+	}
+	return fmt.Errorf("%s: %s", key, msg)
+}
@@ -0,0 +1,275 @@
+// ABOUTME: Tests for loading settings and mapping them onto server and player configs
+// ABOUTME: Covers decoding, environment overrides, validation errors and change detection
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Sendspin/sendspin-go/pkg/audio/dsp"
+	"github.com/Sendspin/sendspin-go/pkg/audio/loudness"
+)
+
+const fleet = `[server]
+name = "Living Room"
+sources = ["/music/a.flac", "http://radio.example/stream"]
+crossfade = "3s"
+normalization = "album"
+metrics = ":9100"
+
+[groups]
+downstairs = ["kitchen-pi", "lounge-pi"]
+
+[player]
+server = "10.0.0.2:8927"
+max_volume = 80
+latency_offset = "-20ms"
+
+[player.dsp]
+preamp = -3
+eq = ["peaking:60:-6:2", "highshelf:8000:-2"]
+
+[auth]
+token = "fleet-secret"
+`
+
+func decode(t *testing.T, src string) *Config {
+	t.Helper()
+	c := Default()
+	if err := c.Decode("fleet.toml", src); err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	return c
+}
+
+func TestDecode(t *testing.T) {
+	c := decode(t, fleet)
+
+	sc, err := c.ServerConfig()
+	if err != nil {
+		t.Fatalf("ServerConfig failed: %v", err)
+	}
+	if sc.Name != "Living Room" || sc.Port != 8927 || sc.Crossfade != 3*time.Second {
+		t.Errorf("unexpected server config: %+v", sc)
+	}
+	if sc.Normalization != loudness.ModeAlbum || sc.AuthToken != "fleet-secret" || !sc.EnableMDNS {
+		t.Errorf("unexpected server config: %+v", sc)
+	}
+	if !slices.Equal(c.Server.Sources, []string{"/music/a.flac", "http://radio.example/stream"}) {
+		t.Errorf("unexpected sources: %v", c.Server.Sources)
+	}
+	if !slices.Equal(c.Groups["downstairs"], []string{"kitchen-pi", "lounge-pi"}) {
+		t.Errorf("unexpected groups: %v", c.Groups)
+	}
+
+	pc, err := c.PlayerConfig()
+	if err != nil {
+		t.Fatalf("PlayerConfig failed: %v", err)
+	}
+	if pc.ServerAddr != "10.0.0.2:8927" || pc.MaxVolume != 80 || pc.LatencyOffset != -20*time.Millisecond {
+		t.Errorf("unexpected player config: %+v", pc)
+	}
+	if pc.BufferMs != 150 || pc.AuthToken != "fleet-secret" || pc.TLS != nil {
+		t.Errorf("unexpected player config: %+v", pc)
+	}
+	wantEQ := []dsp.FilterConfig{
+		{Type: dsp.Peaking, Frequency: 60, Gain: -6, Q: 2},
+		{Type: dsp.HighShelf, Frequency: 8000, Gain: -2},
+	}
+	if pc.DSP.Preamp != -3 || !slices.Equal(pc.DSP.Filters, wantEQ) {
+		t.Errorf("unexpected DSP: %+v", pc.DSP)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{"unknown setting", "[server]\nport = 1\nvolume = 3", "fleet.toml: unknown setting server.volume"},
+		{"unknown table", "[metrics]", "fleet.toml: unknown table [metrics]"},
+		{"top-level setting", "port = 8927", "fleet.toml: unknown setting port"},
+		{"wrong type", "[server]\nport = \"8927\"", "fleet.toml: server.port: expected an integer, got a string"},
+		{"bad duration", "[player]\nlatency_offset = \"soon\"", `fleet.toml: player.latency_offset: invalid duration "soon"`},
+		{"duration as number", "[server]\nlead_time = 500", "fleet.toml: server.lead_time: expected a duration"},
+		{"table as setting", "[player]\ndsp = 1", "fleet.toml: player.dsp is a table, not a setting"},
+		{"list of numbers", "[groups]\nattic = [1]", "fleet.toml: groups.attic: expected a list of strings"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Default().Decode("fleet.toml", tt.src)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestDecodeErrorsIgnoreKeysInCommentsAndStrings(t *testing.T) {
+	// Only the real port setting is reported, by key, not by a line the
+	// key's name happens to appear on
+	src := "[server]\n# port = 1\nname = \"\"\"\nport = 2\n\"\"\"\n\n[player]\nport = 1\n\n[server.tls]\n"
+	err := Default().Decode("fleet.toml", src)
+	if err == nil || err.Error() != "fleet.toml: unknown table [server.tls]" {
+		t.Errorf("expected the unknown table by name, got %v", err)
+	}
+
+	src = "[server]\n# port = 1\nname = \"\"\"\nport = 2\n\"\"\"\nport = \"x\"\n"
+	err = Default().Decode("fleet.toml", src)
+	if err == nil || err.Error() != "fleet.toml: server.port: expected an integer, got a string" {
+		t.Errorf("expected the bad port by key, got %v", err)
+	}
+}
+
+func TestValidationErrorsNameTheirFile(t *testing.T) {
+	c := decode(t, "[server]\nport = 70000\ncodecs = [\"aac\"]\n\n[groups]\na = [\"pi\"]\nb = [\"pi\"]\n\n[player]\nmax_volume = 0\n\n[player.dsp]\neq = [\"notch:50\"]\n")
+
+	_, err := c.ServerConfig()
+	for _, want := range []string{
+		"fleet.toml: server.port: must be between 1 and 65535, got 70000",
+		`fleet.toml: server.codecs: unsupported codec "aac"`,
+		`fleet.toml: groups.b: client "pi" is already in group "a"`,
+	} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("expected error containing %q, got %v", want, err)
+		}
+	}
+
+	_, err = c.PlayerConfig()
+	for _, want := range []string{
+		"fleet.toml: player.max_volume: must be between 1 and 100, got 0",
+		`fleet.toml: player.dsp.eq: unknown filter type "notch"`,
+	} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("expected error containing %q, got %v", want, err)
+		}
+	}
+}
+
+func TestApplyEnv(t *testing.T) {
+	c := decode(t, fleet)
+	err := c.ApplyEnv([]string{
+		"HOME=/root",
+		"SENDSPIN_SERVER_PORT=9000",
+		"SENDSPIN_PLAYER_DSP_EQ=lowpass:100, highpass:20",
+		"SENDSPIN_PLAYER_BIT_PERFECT=true",
+		"SENDSPIN_AUTH_TOKEN=from-env",
+	})
+	if err != nil {
+		t.Fatalf("ApplyEnv failed: %v", err)
+	}
+	if c.Server.Port != 9000 || !c.Player.BitPerfect || c.Auth.Token != "from-env" {
+		t.Errorf("environment not applied: %+v", c)
+	}
+	if !slices.Equal(c.Player.DSP.EQ, []string{"lowpass:100", "highpass:20"}) {
+		t.Errorf("unexpected EQ: %v", c.Player.DSP.EQ)
+	}
+
+	if err := c.ApplyEnv([]string{"SENDSPIN_SERVER_PROT=1"}); err == nil || !strings.Contains(err.Error(), "$SENDSPIN_SERVER_PROT: unknown setting") {
+		t.Errorf("expected unknown variable error, got %v", err)
+	}
+	if err := c.ApplyEnv([]string{"SENDSPIN_PLAYER_CHANNELS=six"}); err == nil || !strings.Contains(err.Error(), `$SENDSPIN_PLAYER_CHANNELS: player.channels: invalid value "six"`) {
+		t.Errorf("expected invalid value error, got %v", err)
+	}
+
+	// Validation names the variable that set a bad value
+	c.ApplyEnv([]string{"SENDSPIN_PLAYER_MAX_VOLUME=120"})
+	if _, err := c.PlayerConfig(); err == nil || !strings.Contains(err.Error(), "$SENDSPIN_PLAYER_MAX_VOLUME: player.max_volume") {
+		t.Errorf("expected error naming the variable, got %v", err)
+	}
+}
+
+func TestSet(t *testing.T) {
+	c := Default()
+	if err := c.Set("server.lead_time", "1s", "-lead-time"); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if c.Server.LeadTime != time.Second {
+		t.Errorf("expected lead time 1s, got %v", c.Server.LeadTime)
+	}
+	if err := c.Set("server.codecs", "flac, opus", "-codecs"); err != nil || !slices.Equal(c.Server.Codecs, []string{"flac", "opus"}) {
+		t.Errorf("unexpected codecs %v (err %v)", c.Server.Codecs, err)
+	}
+	if err := c.Set("server.nope", "1", "-nope"); err == nil {
+		t.Error("expected error for an unknown key")
+	}
+}
+
+func TestTLS(t *testing.T) {
+	c := decode(t, "[tls]\nenabled = true\ncert = \"server.pem\"\n")
+	if _, err := c.ServerConfig(); err == nil || !strings.Contains(err.Error(), "fleet.toml: tls.enabled: the server needs tls.cert and tls.key") {
+		t.Errorf("expected missing key error, got %v", err)
+	}
+
+	// Players trust the system roots unless given a CA
+	pc, err := c.PlayerConfig()
+	if err != nil {
+		t.Fatalf("PlayerConfig failed: %v", err)
+	}
+	if pc.TLS == nil || pc.TLS.RootCAs != nil {
+		t.Errorf("expected TLS with system roots, got %+v", pc.TLS)
+	}
+
+	ca := filepath.Join(t.TempDir(), "ca.pem")
+	os.WriteFile(ca, []byte("not a certificate"), 0o644)
+	c.Set("tls.ca", ca, "-ca")
+	if _, err := c.PlayerConfig(); err == nil || !strings.Contains(err.Error(), "no certificates found") {
+		t.Errorf("expected bad CA error, got %v", err)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sendspin.toml")
+	if err := os.WriteFile(path, []byte(fleet), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SENDSPIN_PLAYER_MAX_VOLUME", "60")
+
+	c, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if c.Player.MaxVolume != 60 || c.Server.Name != "Living Room" {
+		t.Errorf("expected file and environment settings, got %+v", c)
+	}
+
+	if _, err := Load(filepath.Join(t.TempDir(), "missing.toml")); err == nil {
+		t.Error("expected error for a missing file")
+	}
+}
+
+func TestChanged(t *testing.T) {
+	old := decode(t, fleet)
+	new := decode(t, strings.Replace(fleet, "max_volume = 80", "max_volume = 70", 1))
+	new.Set("player.dsp.preamp", "-6", "-preamp")
+	new.Groups["upstairs"] = []string{"attic-pi"}
+
+	want := []string{"player.max_volume", "player.dsp.preamp", "groups"}
+	if got := Changed(old, new); !slices.Equal(got, want) {
+		t.Errorf("Changed = %v, want %v", got, want)
+	}
+	if got := Changed(old, decode(t, fleet)); len(got) != 0 {
+		t.Errorf("expected no changes, got %v", got)
+	}
+}
+
+func TestKeys(t *testing.T) {
+	keys := Keys()
+	for _, want := range []string{"server.port", "player.dsp.eq", "auth.token", "tls.ca"} {
+		if !slices.Contains(keys, want) {
+			t.Errorf("Keys missing %s", want)
+		}
+	}
+	if slices.Contains(keys, "groups") {
+		t.Error("Keys should leave out groups")
+	}
+	if got := EnvName("player.dsp.impulse_response"); got != "SENDSPIN_PLAYER_DSP_IMPULSE_RESPONSE" {
+		t.Errorf("EnvName = %s", got)
+	}
+}
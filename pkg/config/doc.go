@@ -0,0 +1,30 @@
+// ABOUTME: Configuration file package
+// ABOUTME: Loads TOML settings for the server and player binaries
+// Package config loads the settings of the sendspin-server and player
+// binaries from a TOML file, with environment variable overrides, and
+// maps them onto sendspin.ServerConfig and sendspin.PlayerConfig.
+//
+// One file can configure a whole fleet: the server reads [server] and
+// [groups], the player reads [player], and both read [auth] and [tls].
+// Every setting can be overridden by an environment variable named after
+// its key, e.g. SENDSPIN_PLAYER_MAX_VOLUME for max_volume in [player].
+// Errors name the file or the variable that set the value, and the line
+// of syntax errors in a file.
+//
+// Example:
+//
+//	[server]
+//	sources = ["/music/morning.flac", "http://radio.example/stream"]
+//
+//	[groups]
+//	downstairs = ["kitchen-pi", "lounge-pi"]
+//
+//	[player]
+//	max_volume = 80
+//
+//	[player.dsp]
+//	eq = ["peaking:60:-6:2"]
+//
+//	cfg, err := config.Load("/etc/sendspin.toml")
+//	playerConfig, err := cfg.PlayerConfig()
+package config
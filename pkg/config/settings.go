@@ -0,0 +1,306 @@
+// ABOUTME: Assigns settings to a Config by key from files, environment variables and flags
+// ABOUTME: Walks the toml tags to find each key, converts values, and compares configs
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// envPrefix starts the environment variable of every key
+const envPrefix = "SENDSPIN_"
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// Decode applies the settings in a TOML file's contents; name is used in
+// errors, with the line of syntax errors
+func (c *Config) Decode(name, src string) error {
+	entries, err := parseTOML(name, src)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if e.value == nil {
+			if !c.isTable(e.key) {
+				return fmt.Errorf("%s: unknown table [%s]", name, e.key)
+			}
+			continue
+		}
+		if err := c.set(e.key, e.value, name); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// ApplyEnv applies SENDSPIN_* variables from environ ("NAME=value"
+// pairs, as from os.Environ). Each key's variable is its path in upper
+// case with dots as underscores, e.g. SENDSPIN_PLAYER_DSP_EQ; lists are
+// comma-separated. Unknown SENDSPIN_* variables are an error, so typos
+// don't go unnoticed.
+func (c *Config) ApplyEnv(environ []string) error {
+	keys := make(map[string]string)
+	for _, key := range Keys() {
+		keys[EnvName(key)] = key
+	}
+
+	for _, kv := range environ {
+		name, value, _ := strings.Cut(kv, "=")
+		if !strings.HasPrefix(name, envPrefix) {
+			continue
+		}
+		key, ok := keys[name]
+		if !ok {
+			return fmt.Errorf("$%s: unknown setting", name)
+		}
+		if err := c.Set(key, value, "$"+name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Set assigns a setting from text, as given in an environment variable
+// or flag: lists are comma-separated and durations written as "150ms".
+// origin names where the value came from in errors, e.g. "-port".
+func (c *Config) Set(key, value, origin string) error {
+	v, err := c.field(key)
+	if err != nil {
+		return fmt.Errorf("%s: %w", origin, err)
+	}
+
+	var parsed any
+	switch {
+	case v.Type() == durationType || v.Kind() == reflect.String:
+		parsed = value
+	case v.Kind() == reflect.Int:
+		parsed, err = strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	case v.Kind() == reflect.Float64:
+		parsed, err = strconv.ParseFloat(strings.TrimSpace(value), 64)
+	case v.Kind() == reflect.Bool:
+		parsed, err = strconv.ParseBool(strings.TrimSpace(value))
+	case v.Kind() == reflect.Slice:
+		items := []any{}
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		parsed = items
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %s: invalid value %q", origin, key, value)
+	}
+
+	if err := c.set(key, parsed, origin); err != nil {
+		return fmt.Errorf("%s: %w", origin, err)
+	}
+	return nil
+}
+
+// Keys lists every setting's key, e.g. "server.port". Groups are left
+// out, since their keys are the group names.
+func Keys() []string {
+	var keys []string
+	var walk func(t reflect.Type, prefix string)
+	walk = func(t reflect.Type, prefix string) {
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			tag := f.Tag.Get("toml")
+			if tag == "" {
+				continue
+			}
+			switch {
+			case f.Type.Kind() == reflect.Struct:
+				walk(f.Type, prefix+tag+".")
+			case f.Type.Kind() == reflect.Map:
+			default:
+				keys = append(keys, prefix+tag)
+			}
+		}
+	}
+	walk(reflect.TypeOf(Config{}), "")
+	return keys
+}
+
+// EnvName returns the environment variable that overrides a key
+func EnvName(key string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+}
+
+// Changed lists the keys whose values differ between two configs, with
+// "groups" standing for any change to the groups
+func Changed(old, new *Config) []string {
+	var changed []string
+	for _, key := range Keys() {
+		a, _ := old.field(key)
+		b, _ := new.field(key)
+		if a.Kind() == reflect.Slice && a.Len() == 0 && b.Len() == 0 {
+			continue
+		}
+		if !reflect.DeepEqual(a.Interface(), b.Interface()) {
+			changed = append(changed, key)
+		}
+	}
+	if !reflect.DeepEqual(old.Groups, new.Groups) && (len(old.Groups) > 0 || len(new.Groups) > 0) {
+		changed = append(changed, "groups")
+	}
+	return changed
+}
+
+// field finds the struct field a key names
+func (c *Config) field(key string) (reflect.Value, error) {
+	v := reflect.ValueOf(c).Elem()
+	for _, part := range strings.Split(key, ".") {
+		if v.Kind() != reflect.Struct || v.Type() == durationType {
+			return reflect.Value{}, fmt.Errorf("unknown setting %s", key)
+		}
+		f, ok := fieldByTag(v, part)
+		if !ok {
+			return reflect.Value{}, fmt.Errorf("unknown setting %s", key)
+		}
+		v = f
+	}
+	if v.Kind() == reflect.Struct || v.Kind() == reflect.Map {
+		return reflect.Value{}, fmt.Errorf("%s is a table, not a setting", key)
+	}
+	return v, nil
+}
+
+// isTable reports whether a table header names a table of settings
+func (c *Config) isTable(key string) bool {
+	v := reflect.ValueOf(c).Elem()
+	for _, part := range strings.Split(key, ".") {
+		if v.Kind() != reflect.Struct {
+			return false
+		}
+		f, ok := fieldByTag(v, part)
+		if !ok {
+			return false
+		}
+		v = f
+	}
+	return v.Kind() == reflect.Map || v.Kind() == reflect.Struct && v.Type() != durationType
+}
+
+func fieldByTag(v reflect.Value, tag string) (reflect.Value, bool) {
+	for i := 0; i < v.NumField(); i++ {
+		if v.Type().Field(i).Tag.Get("toml") == tag {
+			return v.Field(i), true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+// set assigns a parsed value (string, int64, float64, bool or []any) to
+// a key, and records where it came from
+func (c *Config) set(key string, value any, origin string) error {
+	if c.origins == nil {
+		c.origins = make(map[string]string)
+	}
+	if group, ok := strings.CutPrefix(key, "groups."); ok && !strings.Contains(group, ".") {
+		var ids []string
+		if err := assign(reflect.ValueOf(&ids).Elem(), value); err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+		if c.Groups == nil {
+			c.Groups = make(map[string][]string)
+		}
+		c.Groups[group] = ids
+		c.origins[key] = origin
+		return nil
+	}
+
+	v, err := c.field(key)
+	if err != nil {
+		return err
+	}
+	if err := assign(v, value); err != nil {
+		return fmt.Errorf("%s: %w", key, err)
+	}
+	c.origins[key] = origin
+	return nil
+}
+
+// assign converts a parsed value to a field's type
+func assign(v reflect.Value, value any) error {
+	if v.Type() == durationType {
+		s, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("expected a duration such as \"150ms\", got %s", describe(value))
+		}
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q", s)
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		s, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("expected a string, got %s", describe(value))
+		}
+		v.SetString(s)
+	case reflect.Int:
+		n, ok := value.(int64)
+		if !ok {
+			return fmt.Errorf("expected an integer, got %s", describe(value))
+		}
+		v.SetInt(n)
+	case reflect.Float64:
+		switch n := value.(type) {
+		case float64:
+			v.SetFloat(n)
+		case int64:
+			v.SetFloat(float64(n))
+		default:
+			return fmt.Errorf("expected a number, got %s", describe(value))
+		}
+	case reflect.Bool:
+		b, ok := value.(bool)
+		if !ok {
+			return fmt.Errorf("expected true or false, got %s", describe(value))
+		}
+		v.SetBool(b)
+	case reflect.Slice:
+		items, ok := value.([]any)
+		if !ok {
+			return fmt.Errorf("expected a list of strings, got %s", describe(value))
+		}
+		list := make([]string, len(items))
+		for i, item := range items {
+			s, ok := item.(string)
+			if !ok {
+				return fmt.Errorf("expected a list of strings, got %s in the list", describe(item))
+			}
+			list[i] = s
+		}
+		v.Set(reflect.ValueOf(list))
+	default:
+		return fmt.Errorf("unsupported setting type %s", v.Type())
+	}
+	return nil
+}
+
+// describe names a parsed value's type for errors
+func describe(value any) string {
+	switch value.(type) {
+	case string:
+		return "a string"
+	case int64:
+		return "an integer"
+	case float64:
+		return "a number"
+	case bool:
+		return "a boolean"
+	case []any:
+		return "a list"
+	}
+	return fmt.Sprintf("%T", value)
+}
@@ -0,0 +1,59 @@
+// ABOUTME: Reads config files with the BurntSushi/toml decoder
+// ABOUTME: Lists a file's tables and keys in order with their values
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// entry is a table or key/value pair from a config file
+type entry struct {
+	key   string // Dotted path, e.g. "server.port" or "player.dsp"
+	value any    // string, int64, float64, bool, []any or a date; nil for a table
+}
+
+// parseTOML returns the tables and keys of a file in order. Syntax errors
+// are reported as "name:line: message"; the decoder doesn't say where
+// keys are, so errors about a key name the file and the key.
+func parseTOML(name, src string) ([]entry, error) {
+	var data map[string]any
+	md, err := toml.Decode(src, &data)
+	if err != nil {
+		var perr toml.ParseError
+		if errors.As(err, &perr) {
+			return nil, fmt.Errorf("%s:%d: %s", name, perr.Position.Line, perr.Message)
+		}
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	var entries []entry
+	for _, key := range md.Keys() {
+		path := strings.Join(key, ".")
+		if md.Type(key...) == "ArrayHash" {
+			return nil, fmt.Errorf("%s: %s: arrays of tables are not supported", name, path)
+		}
+		value := lookup(data, key)
+		if _, ok := value.(map[string]any); ok {
+			value = nil
+		}
+		entries = append(entries, entry{key: path, value: value})
+	}
+	return entries, nil
+}
+
+// lookup returns the decoded value of a key
+func lookup(data map[string]any, key toml.Key) any {
+	var value any = data
+	for _, part := range key {
+		table, ok := value.(map[string]any)
+		if !ok {
+			return nil
+		}
+		value = table[part]
+	}
+	return value
+}
@@ -0,0 +1,84 @@
+// ABOUTME: Tests for reading config files
+// ABOUTME: Covers values, tables, dotted keys and inline tables, and syntax errors
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseTOML(t *testing.T) {
+	src := `# Fleet settings
+top = "value" # trailing comment
+
+[server]
+port = 8_927
+name = "Living \"Room\""
+path = 'C:\music'
+target = -23.5
+debug = true
+sources = [
+  "a.flac", # first
+  "b.flac",
+]
+
+["player"]
+empty = []
+dsp = { preamp = -3, eq = ["peaking:60:-6"] }
+log.file = "p.log"
+`
+	entries, err := parseTOML("fleet.toml", src)
+	if err != nil {
+		t.Fatalf("parseTOML failed: %v", err)
+	}
+
+	want := []entry{
+		{key: "top", value: "value"},
+		{key: "server"},
+		{key: "server.port", value: int64(8927)},
+		{key: "server.name", value: `Living "Room"`},
+		{key: "server.path", value: `C:\music`},
+		{key: "server.target", value: -23.5},
+		{key: "server.debug", value: true},
+		{key: "server.sources", value: []any{"a.flac", "b.flac"}},
+		{key: "player"},
+		{key: "player.empty", value: []any{}},
+		{key: "player.dsp"},
+		{key: "player.dsp.preamp", value: int64(-3)},
+		{key: "player.dsp.eq", value: []any{"peaking:60:-6"}},
+		{key: "player.log.file", value: "p.log"},
+	}
+	if !reflect.DeepEqual(entries, want) {
+		t.Errorf("entries:\n got %+v\nwant %+v", entries, want)
+	}
+}
+
+func TestParseTOMLErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{"unquoted string", "[server]\nname = living-room", "f.toml:2: expected value"},
+		{"missing equals", "port 8927", "f.toml:1: expected '.' or '='"},
+		{"duplicate key", "[server]\nport = 1\n\nport = 2", "f.toml:4: Key 'server.port' has already been defined"},
+		{"duplicate table", "[server]\n[server]", "f.toml:2: Key 'server' has already been defined"},
+		{"unterminated string", "name = \"abc", "f.toml:1: unexpected EOF"},
+		{"unterminated array", "eq = [\"a\",\n\"b\"", "f.toml:2: expected a comma"},
+		{"trailing garbage", "port = 1 2", "f.toml:1: expected a top-level item to end with a newline"},
+		{"array of tables", "[server]\n\n[[source]]\nfile = \"a\"", "f.toml: source: arrays of tables are not supported"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseTOML("f.toml", tt.src)
+			if err == nil {
+				t.Fatalf("expected error containing %q", tt.want)
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error %q does not contain %q", err, tt.want)
+			}
+		})
+	}
+}
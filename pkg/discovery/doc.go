@@ -1,14 +1,16 @@
 // ABOUTME: mDNS service discovery package
-// ABOUTME: Discover and advertise Resonate servers on local network
-// Package discovery provides mDNS service discovery for Resonate servers.
+// ABOUTME: Discover and advertise Sendspin servers on local network
+// Package discovery provides mDNS service discovery for Sendspin servers.
 //
-// Allows discovering servers on the local network and advertising
-// server availability.
+// Servers advertise _sendspin-server._tcp and players _sendspin._tcp,
+// with id, name, path and version TXT fields. Browsing keeps a live
+// registry of servers keyed by ID and reports changes as events.
 //
 // Example:
 //
-//	services, err := discovery.Discover(5 * time.Second)
-//	for _, svc := range services {
-//	    fmt.Printf("Found: %s at %s:%d\n", svc.Name, svc.Address, svc.Port)
+//	disc := discovery.NewManager(discovery.Config{ExcludeInterfaces: []string{"docker*"}})
+//	disc.Browse()
+//	for event := range disc.Events() {
+//	    fmt.Printf("%s: %s at %s\n", event.Type, event.Server.Name, event.Server.URL())
 //	}
 package discovery
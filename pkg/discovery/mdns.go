@@ -7,55 +7,111 @@ import (
 	"fmt"
 	"log"
 	"net"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/hashicorp/mdns"
 )
 
+const (
+	// DefaultPath is the WebSocket endpoint advertised and assumed when a
+	// TXT record has no path
+	DefaultPath = "/sendspin"
+
+	// DefaultQueryInterval is how often browsing re-queries the network
+	DefaultQueryInterval = 5 * time.Second
+
+	// DefaultTTL is how long a server stays listed after its last answer
+	DefaultTTL = 20 * time.Second
+
+	serverService = "_sendspin-server._tcp"
+	playerService = "_sendspin._tcp"
+)
+
 // Config holds discovery configuration
 type Config struct {
 	ServiceName string
 	Port        int
 	ServerMode  bool // If true, advertise as _sendspin-server._tcp, otherwise _sendspin._tcp
+
+	// ID is advertised in the TXT record so browsers can recognize this
+	// instance across restarts and address changes
+	ID string
+
+	// Version is the protocol version advertised in the TXT record
+	// (omitted when 0)
+	Version int
+
+	// Path is the advertised WebSocket endpoint (default: DefaultPath)
+	Path string
+
+	// Interfaces limits advertising and browsing to these network
+	// interfaces (names or path.Match patterns such as "en*"). Empty
+	// means every interface.
+	Interfaces []string
+
+	// ExcludeInterfaces skips matching interfaces, e.g. "docker*",
+	// "br-*", "veth*", "tun*" and "wg*" to keep container and VPN
+	// addresses out of advertisements
+	ExcludeInterfaces []string
+
+	// QueryInterval is how often browsing re-queries (default: DefaultQueryInterval)
+	QueryInterval time.Duration
+
+	// TTL is how long a server stays listed without answering a query
+	// before it is removed (default: DefaultTTL)
+	TTL time.Duration
 }
 
 // Manager handles mDNS operations
 type Manager struct {
-	config  Config
-	ctx     context.Context
-	cancel  context.CancelFunc
-	servers chan *ServerInfo
-}
-
-// ServerInfo describes a discovered server
-type ServerInfo struct {
-	Name string
-	Host string
-	Port int
+	config   Config
+	ctx      context.Context
+	cancel   context.CancelFunc
+	registry *registry
+	browsing sync.Once
 }
 
 // NewManager creates a discovery manager
 func NewManager(config Config) *Manager {
 	ctx, cancel := context.WithCancel(context.Background())
 
+	if config.Path == "" {
+		config.Path = DefaultPath
+	}
+	if config.QueryInterval <= 0 {
+		config.QueryInterval = DefaultQueryInterval
+	}
+	if config.TTL <= 0 {
+		config.TTL = DefaultTTL
+	}
+
 	return &Manager{
-		config:  config,
-		ctx:     ctx,
-		cancel:  cancel,
-		servers: make(chan *ServerInfo, 10),
+		config:   config,
+		ctx:      ctx,
+		cancel:   cancel,
+		registry: newRegistry(config.TTL),
 	}
 }
 
 // Advertise advertises this player via mDNS
 func (m *Manager) Advertise() error {
-	ips, err := getLocalIPs()
+	ifaces, err := listInterfaces(m.config.Interfaces, m.config.ExcludeInterfaces)
 	if err != nil {
-		return fmt.Errorf("failed to get local IPs: %w", err)
+		return fmt.Errorf("failed to list network interfaces: %w", err)
+	}
+	ips := localIPs(ifaces)
+	if len(ips) == 0 && m.filtered() {
+		return fmt.Errorf("no addresses to advertise on the selected interfaces")
 	}
 
 	// Choose service type based on mode
-	serviceType := "_sendspin._tcp"
+	serviceType := playerService
 	if m.config.ServerMode {
-		serviceType = "_sendspin-server._tcp"
+		serviceType = serverService
 	}
 
 	service, err := mdns.NewMDNSService(
@@ -65,18 +121,23 @@ func (m *Manager) Advertise() error {
 		"",
 		m.config.Port,
 		ips,
-		[]string{"path=/sendspin"},
+		m.txtRecord(),
 	)
 	if err != nil {
 		return fmt.Errorf("failed to create service: %w", err)
 	}
 
-	server, err := mdns.NewServer(&mdns.Config{Zone: service})
+	// The responder binds one interface or all of them
+	mdnsConfig := &mdns.Config{Zone: service}
+	if m.filtered() && len(ifaces) == 1 {
+		mdnsConfig.Iface = ifaces[0]
+	}
+	server, err := mdns.NewServer(mdnsConfig)
 	if err != nil {
 		return fmt.Errorf("failed to create mdns server: %w", err)
 	}
 
-	log.Printf("Advertising mDNS service: %s on port %d (type: %s)", m.config.ServiceName, m.config.Port, serviceType)
+	log.Printf("Advertising mDNS service: %s on port %d (type: %s, addresses: %v)", m.config.ServiceName, m.config.Port, serviceType, ips)
 
 	go func() {
 		<-m.ctx.Done()
@@ -86,56 +147,205 @@ func (m *Manager) Advertise() error {
 	return nil
 }
 
-// Browse searches for Sendspin servers
+// txtRecord builds the advertised TXT fields
+func (m *Manager) txtRecord() []string {
+	txt := []string{"path=" + m.config.Path}
+	if m.config.ID != "" {
+		txt = append(txt, "id="+m.config.ID)
+	}
+	if m.config.ServiceName != "" {
+		txt = append(txt, "name="+m.config.ServiceName)
+	}
+	if m.config.Version > 0 {
+		txt = append(txt, "version="+strconv.Itoa(m.config.Version))
+	}
+	return txt
+}
+
+// Browse searches for the other side in the background: servers, or
+// players (_sendspin._tcp) in ServerMode, so a server can connect to
+// them. Found services are listed by Servers and reported on Events.
 func (m *Manager) Browse() error {
-	go m.browseLoop()
+	m.browsing.Do(func() {
+		go m.browseLoop()
+	})
 	return nil
 }
 
-// browseLoop continuously browses for servers
+// browseLoop queries for servers until stopped, expiring those that stop
+// answering
 func (m *Manager) browseLoop() {
+	ticker := time.NewTicker(m.config.QueryInterval)
+	defer ticker.Stop()
+
 	for {
+		m.query()
+		m.registry.expire(time.Now())
+
 		select {
 		case <-m.ctx.Done():
 			return
-		default:
+		case <-ticker.C:
 		}
+	}
+}
 
-		entries := make(chan *mdns.ServiceEntry, 10)
+// query runs one round of queries, on each selected interface when
+// interfaces are filtered
+func (m *Manager) query() {
+	targets := []*net.Interface{nil} // The system's default multicast interface
+	if m.filtered() {
+		ifaces, err := listInterfaces(m.config.Interfaces, m.config.ExcludeInterfaces)
+		if err != nil {
+			log.Printf("Failed to list network interfaces: %v", err)
+			return
+		}
+		targets = ifaces
+	}
 
+	for _, iface := range targets {
+		service := m.browseService()
+		entries := make(chan *mdns.ServiceEntry, 16)
+		done := make(chan struct{})
 		go func() {
+			defer close(done)
 			for entry := range entries {
-				server := &ServerInfo{
-					Name: entry.Name,
-					Host: entry.AddrV4.String(),
-					Port: entry.Port,
-				}
-
-				log.Printf("Discovered server: %s at %s:%d", server.Name, server.Host, server.Port)
-
-				select {
-				case m.servers <- server:
-				case <-m.ctx.Done():
-					return
+				if info, ok := parseEntry(entry, service, time.Now()); ok {
+					m.registry.observe(info)
 				}
 			}
 		}()
 
 		params := &mdns.QueryParam{
-			Service: "_sendspin-server._tcp",
-			Domain:  "local",
-			Timeout: 3,
-			Entries: entries,
+			Service:   service,
+			Domain:    "local",
+			Timeout:   time.Second,
+			Interface: iface,
+			Entries:   entries,
+		}
+		if err := mdns.QueryContext(m.ctx, params); err != nil && m.ctx.Err() == nil {
+			log.Printf("mDNS query failed: %v", err)
 		}
-
-		mdns.Query(params)
 		close(entries)
+		<-done
+
+		if m.ctx.Err() != nil {
+			return
+		}
 	}
 }
 
-// Servers returns the channel of discovered servers
-func (m *Manager) Servers() <-chan *ServerInfo {
-	return m.servers
+// browseService returns the service type Browse looks for
+func (m *Manager) browseService() string {
+	if m.config.ServerMode {
+		return playerService
+	}
+	return serverService
+}
+
+// parseEntry turns a query answer into server info
+func parseEntry(entry *mdns.ServiceEntry, service string, now time.Time) (ServerInfo, bool) {
+	info := ServerInfo{
+		Port:     entry.Port,
+		Path:     DefaultPath,
+		TXT:      parseTXT(entry.InfoFields),
+		LastSeen: now,
+	}
+
+	if entry.AddrV4 != nil {
+		info.Addrs = append(info.Addrs, entry.AddrV4)
+		info.Host = entry.AddrV4.String()
+	}
+	if v6 := entry.AddrV6IPAddr; v6 != nil {
+		info.Addrs = append(info.Addrs, v6.IP)
+		if info.Host == "" {
+			info.Host = v6.String() // Includes the zone of link-local addresses
+		}
+	}
+	if info.Host == "" || info.Port == 0 {
+		return ServerInfo{}, false
+	}
+
+	instance := instanceName(entry.Name, service)
+	info.ID = instance
+	if id := info.TXT["id"]; id != "" {
+		info.ID = id
+	}
+	info.Name = instance
+	if name := info.TXT["name"]; name != "" {
+		info.Name = name
+	}
+	if p := info.TXT["path"]; p != "" {
+		info.Path = p
+	}
+	if v, err := strconv.Atoi(info.TXT["version"]); err == nil {
+		info.Version = v
+	}
+	return info, true
+}
+
+// parseTXT splits TXT fields into keys and values. Keys are
+// case-insensitive; fields without "=" are boolean attributes.
+func parseTXT(fields []string) map[string]string {
+	txt := make(map[string]string, len(fields))
+	for _, field := range fields {
+		key, value, _ := strings.Cut(field, "=")
+		if key == "" {
+			continue
+		}
+		key = strings.ToLower(key)
+		if _, ok := txt[key]; ok {
+			continue // The first occurrence wins (RFC 6763 section 6.4)
+		}
+		txt[key] = value
+	}
+	return txt
+}
+
+// instanceName extracts the unescaped instance label from a service
+// instance name such as "Living\ Room._sendspin-server._tcp.local."
+func instanceName(name, service string) string {
+	if i := strings.Index(name, "."+service+"."); i >= 0 {
+		name = name[:i]
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if c != '\\' || i+1 >= len(name) {
+			b.WriteByte(c)
+			continue
+		}
+		// \DDD is a decimal byte, anything else is taken literally
+		if i+3 < len(name) {
+			if v, err := strconv.Atoi(name[i+1 : i+4]); err == nil && v < 256 {
+				b.WriteByte(byte(v))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(name[i+1])
+		i++
+	}
+	return b.String()
+}
+
+// Servers returns the servers currently on the network, sorted by name
+func (m *Manager) Servers() []ServerInfo {
+	return m.registry.list()
+}
+
+// Server returns a discovered server by ID
+func (m *Manager) Server(id string) (ServerInfo, bool) {
+	return m.registry.get(id)
+}
+
+// Events returns a channel reporting servers as they are added, updated
+// and removed. The first call reports servers already found as added.
+// Events are dropped if the channel is not drained; Servers is always
+// current.
+func (m *Manager) Events() <-chan Event {
+	return m.registry.subscribe()
 }
 
 // Stop stops the discovery manager
@@ -143,33 +353,77 @@ func (m *Manager) Stop() {
 	m.cancel()
 }
 
-// getLocalIPs returns local IP addresses
-func getLocalIPs() ([]net.IP, error) {
-	var ips []net.IP
+// filtered reports whether interfaces are selected explicitly
+func (m *Manager) filtered() bool {
+	return len(m.config.Interfaces) > 0 || len(m.config.ExcludeInterfaces) > 0
+}
 
+// listInterfaces returns the up, non-loopback, multicast-capable
+// interfaces that pass the include and exclude patterns
+func listInterfaces(include, exclude []string) ([]*net.Interface, error) {
 	ifaces, err := net.Interfaces()
 	if err != nil {
 		return nil, err
 	}
 
-	for _, iface := range ifaces {
-		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+	var selected []*net.Interface
+	for i := range ifaces {
+		iface := &ifaces[i]
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 || iface.Flags&net.FlagMulticast == 0 {
 			continue
 		}
+		if selectInterface(iface.Name, include, exclude) {
+			selected = append(selected, iface)
+		}
+	}
+	return selected, nil
+}
+
+// selectInterface reports whether an interface name passes the include
+// and exclude patterns
+func selectInterface(name string, include, exclude []string) bool {
+	for _, pattern := range exclude {
+		if ok, _ := path.Match(pattern, name); ok {
+			return false
+		}
+	}
+	if len(include) == 0 {
+		return true
+	}
+	for _, pattern := range include {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// getLocalIPs returns the local addresses of the selected interfaces
+func getLocalIPs(include, exclude []string) ([]net.IP, error) {
+	ifaces, err := listInterfaces(include, exclude)
+	if err != nil {
+		return nil, err
+	}
+	return localIPs(ifaces), nil
+}
 
+// localIPs returns the IPv4 and IPv6 addresses of interfaces. IPv6
+// link-local addresses are left out: they need a zone to be reachable.
+func localIPs(ifaces []*net.Interface) []net.IP {
+	ips := []net.IP{}
+	for _, iface := range ifaces {
 		addrs, err := iface.Addrs()
 		if err != nil {
 			continue
 		}
 
 		for _, addr := range addrs {
-			if ipnet, ok := addr.(*net.IPNet); ok && !ipnet.IP.IsLoopback() {
-				if ipnet.IP.To4() != nil {
-					ips = append(ips, ipnet.IP)
-				}
+			ipnet, ok := addr.(*net.IPNet)
+			if !ok || ipnet.IP.IsLoopback() || ipnet.IP.IsLinkLocalUnicast() {
+				continue
 			}
+			ips = append(ips, ipnet.IP)
 		}
 	}
-
-	return ips, nil
+	return ips
 }
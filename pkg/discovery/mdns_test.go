@@ -3,8 +3,11 @@
 package discovery
 
 import (
+	"net"
 	"testing"
 	"time"
+
+	"github.com/hashicorp/mdns"
 )
 
 func TestNewManager(t *testing.T) {
@@ -32,8 +35,12 @@ func TestNewManager(t *testing.T) {
 		t.Errorf("Expected ServerMode false, got %v", manager.config.ServerMode)
 	}
 
-	if manager.servers == nil {
-		t.Error("servers channel should not be nil")
+	if manager.registry == nil {
+		t.Error("registry should not be nil")
+	}
+
+	if manager.config.Path != DefaultPath || manager.config.QueryInterval != DefaultQueryInterval || manager.config.TTL != DefaultTTL {
+		t.Errorf("Expected defaults, got %+v", manager.config)
 	}
 
 	if manager.ctx == nil {
@@ -63,7 +70,7 @@ func TestManagerServerMode(t *testing.T) {
 	}
 }
 
-func TestManagerServersChannel(t *testing.T) {
+func TestManagerEvents(t *testing.T) {
 	config := Config{
 		ServiceName: "test",
 		Port:        8080,
@@ -73,16 +80,21 @@ func TestManagerServersChannel(t *testing.T) {
 	manager := NewManager(config)
 	defer manager.Stop()
 
-	// Get the servers channel
-	serversChan := manager.Servers()
+	// Events are only recorded once someone listens
+	if manager.registry.events != nil {
+		t.Error("events channel should not exist before Events()")
+	}
 
-	if serversChan == nil {
-		t.Fatal("Servers() returned nil channel")
+	events := manager.Events()
+	if events == nil {
+		t.Fatal("Events() returned nil channel")
+	}
+	if events != manager.Events() {
+		t.Error("Events() should return the same channel every time")
 	}
 
-	// Verify it's the same channel
-	if serversChan != manager.servers {
-		t.Error("Servers() should return the manager's servers channel")
+	if servers := manager.Servers(); len(servers) != 0 {
+		t.Errorf("Expected no servers before browsing, got %v", servers)
 	}
 }
 
@@ -108,23 +120,23 @@ func TestManagerStop(t *testing.T) {
 }
 
 func TestGetLocalIPs(t *testing.T) {
-	ips, err := getLocalIPs()
+	ips, err := getLocalIPs(nil, nil)
 
 	if err != nil {
 		t.Fatalf("getLocalIPs failed: %v", err)
 	}
 
-	// We should have at least one non-loopback IPv4 address on most systems
+	// We should have at least one non-loopback address on most systems
 	// This test may be environment-dependent, so we just verify it doesn't crash
 	// and returns a non-nil slice
 	if ips == nil {
 		t.Error("getLocalIPs returned nil slice")
 	}
 
-	// Verify all returned IPs are IPv4
+	// IPv6 is included, but not link-local addresses
 	for _, ip := range ips {
-		if ip.To4() == nil {
-			t.Errorf("getLocalIPs returned non-IPv4 address: %v", ip)
+		if ip.IsLinkLocalUnicast() {
+			t.Errorf("getLocalIPs returned link-local address: %v", ip)
 		}
 		if ip.IsLoopback() {
 			t.Errorf("getLocalIPs returned loopback address: %v", ip)
@@ -137,6 +149,7 @@ func TestServerInfo(t *testing.T) {
 		Name: "test-server",
 		Host: "192.168.1.100",
 		Port: 8080,
+		Path: "/sendspin",
 	}
 
 	if info.Name != "test-server" {
@@ -152,6 +165,90 @@ func TestServerInfo(t *testing.T) {
 	}
 }
 
+func TestServerInfoAddress(t *testing.T) {
+	info := ServerInfo{Host: "fd00::1", Port: 8927, Path: "/sendspin"}
+	if got := info.Address(); got != "[fd00::1]:8927" {
+		t.Errorf("Expected bracketed IPv6 address, got %s", got)
+	}
+	if got := info.URL(); got != "ws://[fd00::1]:8927/sendspin" {
+		t.Errorf("Expected WebSocket URL, got %s", got)
+	}
+}
+
+func TestParseEntry(t *testing.T) {
+	now := time.Now()
+	entry := &mdns.ServiceEntry{
+		Name:         `Living\ Room._sendspin-server._tcp.local.`,
+		AddrV4:       net.ParseIP("192.168.1.10"),
+		AddrV6IPAddr: &net.IPAddr{IP: net.ParseIP("fd00::10")},
+		Port:         8927,
+		InfoFields:   []string{"path=/custom", "ID=abc-123", "name=Living Room", "version=1", "id=ignored", "secure"},
+	}
+
+	info, ok := parseEntry(entry, serverService, now)
+	if !ok {
+		t.Fatal("parseEntry rejected a complete entry")
+	}
+	if info.ID != "abc-123" || info.Name != "Living Room" || info.Path != "/custom" || info.Version != 1 {
+		t.Errorf("Unexpected TXT fields: %+v", info)
+	}
+	if info.Host != "192.168.1.10" || len(info.Addrs) != 2 || !info.LastSeen.Equal(now) {
+		t.Errorf("Expected IPv4 host with both addresses, got %+v", info)
+	}
+	if _, ok := info.TXT["secure"]; !ok {
+		t.Error("Expected boolean TXT attribute to be kept")
+	}
+
+	// Servers without TXT fields fall back to the instance name
+	entry = &mdns.ServiceEntry{
+		Name:         `Den\032Server._sendspin-server._tcp.local.`,
+		AddrV6IPAddr: &net.IPAddr{IP: net.ParseIP("fd00::20")},
+		Port:         9000,
+	}
+	info, ok = parseEntry(entry, serverService, now)
+	if !ok {
+		t.Fatal("parseEntry rejected an IPv6-only entry")
+	}
+	if info.ID != "Den Server" || info.Name != "Den Server" || info.Path != DefaultPath || info.Host != "fd00::20" {
+		t.Errorf("Unexpected fallbacks: %+v", info)
+	}
+
+	if _, ok := parseEntry(&mdns.ServiceEntry{Name: "x", Port: 1}, serverService, now); ok {
+		t.Error("Expected entry without an address to be rejected")
+	}
+}
+
+func TestSelectInterface(t *testing.T) {
+	tests := []struct {
+		name    string
+		include []string
+		exclude []string
+		want    bool
+	}{
+		{"eth0", nil, nil, true},
+		{"docker0", nil, []string{"docker*", "veth*"}, false},
+		{"eth0", nil, []string{"docker*", "veth*"}, true},
+		{"en0", []string{"en*"}, nil, true},
+		{"wlan0", []string{"en*"}, nil, false},
+		{"wg0", []string{"*"}, []string{"wg*"}, false},
+	}
+	for _, tt := range tests {
+		if got := selectInterface(tt.name, tt.include, tt.exclude); got != tt.want {
+			t.Errorf("selectInterface(%q, %v, %v) = %v, want %v", tt.name, tt.include, tt.exclude, got, tt.want)
+		}
+	}
+}
+
+func TestTXTRecord(t *testing.T) {
+	manager := NewManager(Config{ServiceName: "Kitchen", ID: "srv-1", Version: 1, ServerMode: true})
+	defer manager.Stop()
+
+	txt := parseTXT(manager.txtRecord())
+	if txt["path"] != DefaultPath || txt["id"] != "srv-1" || txt["name"] != "Kitchen" || txt["version"] != "1" {
+		t.Errorf("Unexpected TXT record: %v", txt)
+	}
+}
+
 func TestConfigValidation(t *testing.T) {
 	tests := []struct {
 		name   string
@@ -200,3 +297,18 @@ func TestConfigValidation(t *testing.T) {
 		})
 	}
 }
+
+func TestBrowseService(t *testing.T) {
+	player := NewManager(Config{ServiceName: "player"})
+	defer player.Stop()
+	if got := player.browseService(); got != serverService {
+		t.Errorf("Players should browse for %s, got %s", serverService, got)
+	}
+
+	// Servers look for players to connect to
+	server := NewManager(Config{ServiceName: "server", ServerMode: true})
+	defer server.Stop()
+	if got := server.browseService(); got != playerService {
+		t.Errorf("Servers should browse for %s, got %s", playerService, got)
+	}
+}
@@ -0,0 +1,188 @@
+// ABOUTME: Registry of servers found by mDNS browsing
+// ABOUTME: Deduplicates servers by ID, expires silent ones, and emits add/update/remove events
+package discovery
+
+import (
+	"cmp"
+	"log"
+	"maps"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EventType says what happened to a discovered server
+type EventType int
+
+const (
+	// ServerAdded is sent when a server is first seen
+	ServerAdded EventType = iota
+	// ServerUpdated is sent when a server's name, address or TXT record changes
+	ServerUpdated
+	// ServerRemoved is sent when a server stops answering for longer than the TTL
+	ServerRemoved
+)
+
+// String returns the event type's name
+func (t EventType) String() string {
+	switch t {
+	case ServerAdded:
+		return "added"
+	case ServerUpdated:
+		return "updated"
+	case ServerRemoved:
+		return "removed"
+	default:
+		return "unknown"
+	}
+}
+
+// Event reports a change to the set of discovered servers
+type Event struct {
+	Type   EventType
+	Server ServerInfo
+}
+
+// ServerInfo describes a discovered server, or a discovered player when a
+// server-mode Manager browses
+type ServerInfo struct {
+	// ID identifies the server across restarts and address changes (the
+	// id TXT field, or the mDNS instance name for servers without one)
+	ID string
+
+	// Name is the server's friendly name
+	Name string
+
+	// Host is the address to connect to, IPv4 when the server has one
+	Host string
+	Port int
+
+	// Path is the WebSocket endpoint (default: /sendspin)
+	Path string
+
+	// Version is the advertised protocol version (0 if not advertised)
+	Version int
+
+	// Addrs are all of the server's advertised addresses
+	Addrs []net.IP
+
+	// TXT holds every key=value field of the TXT record
+	TXT map[string]string
+
+	// LastSeen is when the server last answered a query
+	LastSeen time.Time
+}
+
+// Address returns the server's host:port, bracketing IPv6 hosts
+func (s ServerInfo) Address() string {
+	return net.JoinHostPort(s.Host, strconv.Itoa(s.Port))
+}
+
+// URL returns the server's WebSocket URL
+func (s ServerInfo) URL() string {
+	return "ws://" + s.Address() + s.Path
+}
+
+// changed reports whether anything but LastSeen differs
+func (s ServerInfo) changed(other ServerInfo) bool {
+	return s.Name != other.Name || s.Host != other.Host || s.Port != other.Port ||
+		s.Path != other.Path || s.Version != other.Version ||
+		!slices.EqualFunc(s.Addrs, other.Addrs, net.IP.Equal) || !maps.Equal(s.TXT, other.TXT)
+}
+
+// registry keeps the set of live servers keyed by ID
+type registry struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	servers map[string]ServerInfo
+	events  chan Event // nil until someone asks for events
+}
+
+// newRegistry creates a registry that forgets servers unseen for ttl
+func newRegistry(ttl time.Duration) *registry {
+	return &registry{
+		ttl:     ttl,
+		servers: make(map[string]ServerInfo),
+	}
+}
+
+// subscribe returns the event channel, creating it on first use with
+// an Added event for each server already known
+func (r *registry) subscribe() <-chan Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.events == nil {
+		r.events = make(chan Event, 64)
+		for _, info := range r.servers {
+			r.emit(Event{Type: ServerAdded, Server: info})
+		}
+	}
+	return r.events
+}
+
+// observe records a query answer
+func (r *registry) observe(info ServerInfo) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	old, ok := r.servers[info.ID]
+	r.servers[info.ID] = info
+	switch {
+	case !ok:
+		log.Printf("Discovered server: %s (%s) at %s", info.Name, info.ID, info.Address())
+		r.emit(Event{Type: ServerAdded, Server: info})
+	case old.changed(info):
+		log.Printf("Server updated: %s (%s) at %s", info.Name, info.ID, info.Address())
+		r.emit(Event{Type: ServerUpdated, Server: info})
+	}
+}
+
+// expire removes servers that have not answered within the TTL
+func (r *registry) expire(now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for id, info := range r.servers {
+		if now.Sub(info.LastSeen) > r.ttl {
+			delete(r.servers, id)
+			log.Printf("Server gone: %s (%s)", info.Name, info.ID)
+			r.emit(Event{Type: ServerRemoved, Server: info})
+		}
+	}
+}
+
+// list returns the live servers sorted by name
+func (r *registry) list() []ServerInfo {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	servers := slices.Collect(maps.Values(r.servers))
+	slices.SortFunc(servers, func(a, b ServerInfo) int {
+		return cmp.Or(strings.Compare(a.Name, b.Name), strings.Compare(a.ID, b.ID))
+	})
+	return servers
+}
+
+// get returns a live server by ID
+func (r *registry) get(id string) (ServerInfo, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	info, ok := r.servers[id]
+	return info, ok
+}
+
+// emit sends an event without blocking discovery (called with mu held).
+// The server list stays authoritative if a slow consumer misses events.
+func (r *registry) emit(e Event) {
+	if r.events == nil {
+		return
+	}
+	select {
+	case r.events <- e:
+	default:
+		log.Printf("Discovery event dropped, consumer is not keeping up: %s %s", e.Type, e.Server.ID)
+	}
+}
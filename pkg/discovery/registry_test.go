@@ -0,0 +1,123 @@
+// ABOUTME: Tests for the discovered server registry
+// ABOUTME: Validates deduplication, update detection, expiry and events
+package discovery
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestRegistryEvents(t *testing.T) {
+	r := newRegistry(10 * time.Second)
+	events := r.subscribe()
+	start := time.Now()
+
+	server := ServerInfo{
+		ID:       "srv-1",
+		Name:     "Kitchen",
+		Host:     "192.168.1.10",
+		Port:     8927,
+		Path:     "/sendspin",
+		Addrs:    []net.IP{net.ParseIP("192.168.1.10")},
+		TXT:      map[string]string{"id": "srv-1"},
+		LastSeen: start,
+	}
+	r.observe(server)
+
+	// Repeated answers only refresh the entry
+	again := server
+	again.LastSeen = start.Add(5 * time.Second)
+	r.observe(again)
+
+	moved := again
+	moved.Host = "192.168.1.11"
+	moved.Addrs = []net.IP{net.ParseIP("192.168.1.11")}
+	r.observe(moved)
+
+	r.expire(start.Add(14 * time.Second))
+	if len(r.list()) != 1 {
+		t.Fatal("Server expired before its TTL")
+	}
+	r.expire(start.Add(16 * time.Second))
+
+	want := []EventType{ServerAdded, ServerUpdated, ServerRemoved}
+	for _, w := range want {
+		select {
+		case e := <-events:
+			if e.Type != w || e.Server.ID != "srv-1" {
+				t.Errorf("Expected %s for srv-1, got %s for %s", w, e.Type, e.Server.ID)
+			}
+		default:
+			t.Fatalf("Missing %s event", w)
+		}
+	}
+	select {
+	case e := <-events:
+		t.Errorf("Unexpected event: %s", e.Type)
+	default:
+	}
+
+	if _, ok := r.get("srv-1"); ok {
+		t.Error("Expired server is still listed")
+	}
+}
+
+func TestRegistryList(t *testing.T) {
+	r := newRegistry(time.Minute)
+	now := time.Now()
+	r.observe(ServerInfo{ID: "b", Name: "Office", Host: "10.0.0.2", Port: 1, LastSeen: now})
+	r.observe(ServerInfo{ID: "a", Name: "Den", Host: "10.0.0.1", Port: 1, LastSeen: now})
+	r.observe(ServerInfo{ID: "c", Name: "Den", Host: "10.0.0.3", Port: 1, LastSeen: now})
+
+	servers := r.list()
+	if len(servers) != 3 {
+		t.Fatalf("Expected 3 servers, got %d", len(servers))
+	}
+	if servers[0].ID != "a" || servers[1].ID != "c" || servers[2].ID != "b" {
+		t.Errorf("Expected servers sorted by name then ID, got %v", servers)
+	}
+
+	info, ok := r.get("b")
+	if !ok || info.Name != "Office" {
+		t.Errorf("Expected to find server b, got %+v", info)
+	}
+}
+
+func TestRegistrySlowConsumer(t *testing.T) {
+	r := newRegistry(time.Minute)
+	r.subscribe()
+
+	// A consumer that never reads must not block discovery
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 100; i++ {
+			r.observe(ServerInfo{ID: string(rune('a' + i)), Host: "10.0.0.1", Port: 1, LastSeen: time.Now()})
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("observe blocked on a full event channel")
+	}
+	if len(r.list()) != 100 {
+		t.Errorf("Expected every server listed, got %d", len(r.list()))
+	}
+}
+
+func TestRegistryLateSubscriber(t *testing.T) {
+	r := newRegistry(time.Minute)
+	r.observe(ServerInfo{ID: "a", Name: "Den", Host: "10.0.0.1", Port: 1, LastSeen: time.Now()})
+
+	// Servers found before anyone listened are reported as added
+	select {
+	case e := <-r.subscribe():
+		if e.Type != ServerAdded || e.Server.ID != "a" {
+			t.Errorf("Expected added event for a, got %s for %s", e.Type, e.Server.ID)
+		}
+	default:
+		t.Error("Expected an event for the known server")
+	}
+}
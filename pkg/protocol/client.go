@@ -3,12 +3,16 @@
 package protocol
 
 import (
+	"cmp"
 	"context"
+	"crypto/tls"
 	"encoding/binary"
 	"encoding/json"
 	"fmt"
 	"log"
+	"net/http"
 	"net/url"
+	"slices"
 	"sync"
 	"time"
 
@@ -20,11 +24,20 @@ type Config struct {
 	ServerAddr        string
 	ClientID          string
 	Name              string
-	Version           int
+	Version           int      // Newest version offered (default: Version)
+	Features          []string // Optional features offered (default: SupportedFeatures)
+	Volume            int      // Reported in the initial player/update
+	Muted             bool     // Reported in the initial player/update
 	DeviceInfo        DeviceInfo
 	PlayerSupport     PlayerSupport
 	MetadataSupport   MetadataSupport
 	VisualizerSupport VisualizerSupport
+
+	// AuthToken is sent as a bearer token to servers that require one
+	AuthToken string
+
+	// TLS connects with wss:// using this configuration; nil uses ws://
+	TLS *tls.Config
 }
 
 // Client represents a WebSocket client
@@ -32,17 +45,22 @@ type Client struct {
 	config Config
 	conn   *websocket.Conn
 	mu     sync.RWMutex
+	sendMu sync.Mutex // Serializes writes; the connection allows one writer
 
 	// Message channels
 	AudioChunks   chan AudioChunk
 	ControlMsgs   chan ServerCommand
 	TimeSyncResp  chan ServerTime
-	StreamStart   chan StreamStart
+	StreamEvents  chan StreamEvent // stream/start, stream/clear and stream/end, in order
 	Metadata      chan StreamMetadata
 	SessionUpdate chan SessionUpdate
+	Errors        chan Error // server/error messages after the handshake
 
 	// State
 	connected bool
+	server    ServerHello // The server's hello, set by the handshake
+	features  []string    // Features both sides support, set by the handshake
+	streamGen uint64      // Bumped on stream/start and stream/clear (reader goroutine only)
 	ctx       context.Context
 	cancel    context.CancelFunc
 }
@@ -51,6 +69,11 @@ type Client struct {
 type AudioChunk struct {
 	Timestamp int64  // Microseconds, server clock
 	Data      []byte // Encoded audio
+
+	// Generation counts the stream/start and stream/clear messages received
+	// before this chunk. Consumers that have handled N of those messages
+	// should discard chunks whose Generation is not N.
+	Generation uint64
 }
 
 // NewClient creates a new WebSocket client
@@ -62,9 +85,10 @@ func NewClient(config Config) *Client {
 		AudioChunks:   make(chan AudioChunk, 100),
 		ControlMsgs:   make(chan ServerCommand, 10),
 		TimeSyncResp:  make(chan ServerTime, 10),
-		StreamStart:   make(chan StreamStart, 1),
+		StreamEvents:  make(chan StreamEvent, 10),
 		Metadata:      make(chan StreamMetadata, 10),
 		SessionUpdate: make(chan SessionUpdate, 10),
+		Errors:        make(chan Error, 10),
 		ctx:           ctx,
 		cancel:        cancel,
 	}
@@ -73,13 +97,35 @@ func NewClient(config Config) *Client {
 // Connect establishes WebSocket connection and performs handshake
 func (c *Client) Connect() error {
 	u := url.URL{Scheme: "ws", Host: c.config.ServerAddr, Path: "/sendspin"}
+	dialer := *websocket.DefaultDialer
+	if c.config.TLS != nil {
+		u.Scheme = "wss"
+		dialer.TLSClientConfig = c.config.TLS
+	}
+	var header http.Header
+	if c.config.AuthToken != "" {
+		header = http.Header{"Authorization": {"Bearer " + c.config.AuthToken}}
+	}
 	log.Printf("Connecting to %s", u.String())
 
-	conn, _, err := websocket.DefaultDialer.Dial(u.String(), nil)
+	conn, _, err := dialer.Dial(u.String(), header)
 	if err != nil {
 		return fmt.Errorf("dial failed: %w", err)
 	}
 
+	return c.start(conn)
+}
+
+// Accept performs the handshake on a connection a server opened to this
+// client (server-initiated connections). The client still speaks first
+// with client/hello, exactly as when it dials.
+func (c *Client) Accept(conn *websocket.Conn) error {
+	log.Printf("Accepted connection from server at %s", conn.RemoteAddr())
+	return c.start(conn)
+}
+
+// start performs the handshake on an open connection and starts reading
+func (c *Client) start(conn *websocket.Conn) error {
 	c.mu.Lock()
 	c.conn = conn
 	c.connected = true
@@ -97,14 +143,22 @@ func (c *Client) Connect() error {
 	return nil
 }
 
-// handshake performs the protocol handshake
+// handshake performs the protocol handshake, offering this client's
+// newest version and features and checking the server's choice
 func (c *Client) handshake() error {
+	version := cmp.Or(c.config.Version, Version)
+	features := c.config.Features
+	if features == nil {
+		features = SupportedFeatures
+	}
+
 	// Send client/hello
 	hello := ClientHello{
 		ClientID:          c.config.ClientID,
 		Name:              c.config.Name,
-		Version:           c.config.Version,
+		Version:           version,
 		SupportedRoles:    []string{"player", "metadata", "visualizer"},
+		Features:          features,
 		DeviceInfo:        &c.config.DeviceInfo,
 		PlayerSupport:     &c.config.PlayerSupport,
 		MetadataSupport:   &c.config.MetadataSupport,
@@ -137,17 +191,39 @@ func (c *Client) handshake() error {
 		return fmt.Errorf("failed to parse server/hello: %w", err)
 	}
 
+	if serverMsg.Type == "server/error" {
+		var refusal Error
+		if err := DecodePayload(serverMsg.Payload, &refusal); err != nil {
+			return fmt.Errorf("server refused the connection with an invalid error: %w", err)
+		}
+		return fmt.Errorf("server refused the connection: %w", &refusal)
+	}
 	if serverMsg.Type != "server/hello" {
 		return fmt.Errorf("expected server/hello, got %s", serverMsg.Type)
 	}
 
-	log.Printf("Handshake complete with server")
+	var serverHello ServerHello
+	if err := DecodePayload(serverMsg.Payload, &serverHello); err != nil {
+		c.SendError(ErrorInvalidMessage, "server/hello: "+err.Error())
+		return fmt.Errorf("invalid server/hello: %w", err)
+	}
+	if serverHello.Version < MinVersion || serverHello.Version > version {
+		err := Errorf(ErrorUnsupportedVersion, "server chose protocol version %d, client speaks %d to %d", serverHello.Version, MinVersion, version)
+		c.SendError(err.Code, err.Reason)
+		return err
+	}
+	c.mu.Lock()
+	c.server = serverHello
+	c.features = NegotiateFeatures(features, serverHello.Features)
+	c.mu.Unlock()
+
+	log.Printf("Handshake complete with server (protocol version %d)", serverHello.Version)
 
 	// Send initial state
 	state := ClientState{
 		State:  "idle",
-		Volume: 100,
-		Muted:  false,
+		Volume: c.config.Volume,
+		Muted:  c.config.Muted,
 	}
 
 	stateMsg := Message{
@@ -171,6 +247,8 @@ func (c *Client) sendJSON(msg Message) error {
 		return fmt.Errorf("not connected")
 	}
 
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
 	return c.conn.WriteJSON(msg)
 }
 
@@ -209,7 +287,7 @@ func (c *Client) handleBinaryMessage(data []byte) {
 	}
 
 	msgType := data[0]
-	if msgType != 1 {
+	if msgType != AudioChunkType {
 		log.Printf("Unknown binary message type: %d", msgType)
 		return
 	}
@@ -218,8 +296,9 @@ func (c *Client) handleBinaryMessage(data []byte) {
 	audioData := data[9:]
 
 	chunk := AudioChunk{
-		Timestamp: timestamp,
-		Data:      audioData,
+		Timestamp:  timestamp,
+		Data:       audioData,
+		Generation: c.streamGen,
 	}
 
 	select {
@@ -228,21 +307,29 @@ func (c *Client) handleBinaryMessage(data []byte) {
 	}
 }
 
-// handleJSONMessage routes JSON messages
+// handleJSONMessage routes JSON messages. Payloads that fail validation
+// and unknown message types are answered with client/error.
 func (c *Client) handleJSONMessage(data []byte) {
 	var msg Message
 	if err := json.Unmarshal(data, &msg); err != nil {
 		log.Printf("Failed to parse JSON message: %v", err)
+		c.SendError(ErrorInvalidMessage, "malformed JSON: "+err.Error())
 		return
 	}
 
 	log.Printf("Received message type: %s", msg.Type)
-	payloadBytes, _ := json.Marshal(msg.Payload)
 
 	switch msg.Type {
 	case "server/command":
 		var cmd ServerCommand
-		json.Unmarshal(payloadBytes, &cmd)
+		if !c.decode(msg, &cmd) {
+			return
+		}
+		if !slices.Contains(c.config.PlayerSupport.SupportedCommands, cmd.Command) {
+			log.Printf("Unsupported server command: %s", cmd.Command)
+			c.SendError(ErrorUnsupportedCommand, fmt.Sprintf("command %q is not supported", cmd.Command))
+			return
+		}
 		select {
 		case c.ControlMsgs <- cmd:
 		case <-c.ctx.Done():
@@ -250,7 +337,9 @@ func (c *Client) handleJSONMessage(data []byte) {
 
 	case "server/time":
 		var timeMsg ServerTime
-		json.Unmarshal(payloadBytes, &timeMsg)
+		if !c.decode(msg, &timeMsg) {
+			return
+		}
 		select {
 		case c.TimeSyncResp <- timeMsg:
 		case <-c.ctx.Done():
@@ -258,15 +347,41 @@ func (c *Client) handleJSONMessage(data []byte) {
 
 	case "stream/start":
 		var start StreamStart
-		json.Unmarshal(payloadBytes, &start)
+		if !c.decode(msg, &start) {
+			return
+		}
+		c.streamGen++
+		select {
+		case c.StreamEvents <- start:
+		case <-c.ctx.Done():
+		}
+
+	case "stream/clear":
+		var streamClear StreamClear
+		if !c.decode(msg, &streamClear) {
+			return
+		}
+		c.streamGen++
 		select {
-		case c.StreamStart <- start:
+		case c.StreamEvents <- streamClear:
+		case <-c.ctx.Done():
+		}
+
+	case "stream/end":
+		var end StreamEnd
+		if !c.decode(msg, &end) {
+			return
+		}
+		select {
+		case c.StreamEvents <- end:
 		case <-c.ctx.Done():
 		}
 
 	case "stream/metadata":
 		var meta StreamMetadata
-		json.Unmarshal(payloadBytes, &meta)
+		if !c.decode(msg, &meta) {
+			return
+		}
 		select {
 		case c.Metadata <- meta:
 		case <-c.ctx.Done():
@@ -274,8 +389,7 @@ func (c *Client) handleJSONMessage(data []byte) {
 
 	case "session/update":
 		var update SessionUpdate
-		if err := json.Unmarshal(payloadBytes, &update); err != nil {
-			log.Printf("Failed to parse session/update: %v", err)
+		if !c.decode(msg, &update) {
 			return
 		}
 		log.Printf("Session update: group=%s, state=%s", update.GroupID, update.PlaybackState)
@@ -289,11 +403,36 @@ func (c *Client) handleJSONMessage(data []byte) {
 			log.Printf("Session update channel full, dropping message")
 		}
 
+	case "server/error":
+		// Never answered with an error, so two peers can't trade them forever
+		var serverErr Error
+		if err := DecodePayload(msg.Payload, &serverErr); err != nil {
+			log.Printf("Invalid server/error: %v", err)
+			return
+		}
+		log.Printf("Server reported an error: %v", &serverErr)
+		select {
+		case c.Errors <- serverErr:
+		default:
+		}
+
 	default:
 		log.Printf("Unknown message type: %s", msg.Type)
+		c.SendError(ErrorUnknownMessage, fmt.Sprintf("message type %q is not supported", msg.Type))
 	}
 }
 
+// decode decodes and validates a message's payload, answering the server
+// with client/error when it is invalid
+func (c *Client) decode(msg Message, v any) bool {
+	if err := DecodePayload(msg.Payload, v); err != nil {
+		log.Printf("Invalid %s: %v", msg.Type, err)
+		c.SendError(ErrorInvalidMessage, fmt.Sprintf("%s: %v", msg.Type, err))
+		return false
+	}
+	return true
+}
+
 // SendState sends a player/update message
 func (c *Client) SendState(state ClientState) error {
 	msg := Message{
@@ -314,6 +453,24 @@ func (c *Client) SendTimeSync(t1 int64) error {
 	return c.sendJSON(msg)
 }
 
+// SendCommand sends a client/command message (requires the controller role)
+func (c *Client) SendCommand(cmd ClientCommand) error {
+	msg := Message{
+		Type:    "client/command",
+		Payload: cmd,
+	}
+	return c.sendJSON(msg)
+}
+
+// SendError sends a client/error message reporting a problem to the server
+func (c *Client) SendError(code, reason string) error {
+	msg := Message{
+		Type:    "client/error",
+		Payload: Error{Code: code, Reason: reason},
+	}
+	return c.sendJSON(msg)
+}
+
 // Close closes the connection
 func (c *Client) Close() {
 	c.mu.Lock()
@@ -327,6 +484,32 @@ func (c *Client) Close() {
 	}
 }
 
+// Done returns a channel that is closed when the connection closes
+func (c *Client) Done() <-chan struct{} {
+	return c.ctx.Done()
+}
+
+// Server returns the hello the server sent during the handshake, which
+// identifies the server by ID and name
+func (c *Client) Server() ServerHello {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.server
+}
+
+// Features returns the optional features both this client and the server
+// support, as negotiated by the handshake
+func (c *Client) Features() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.features
+}
+
+// HasFeature reports whether both sides support an optional feature
+func (c *Client) HasFeature(feature string) bool {
+	return slices.Contains(c.Features(), feature)
+}
+
 // IsConnected returns connection status
 func (c *Client) IsConnected() bool {
 	c.mu.RLock()
@@ -1,9 +1,17 @@
 // ABOUTME: Tests for WebSocket client implementation
-// ABOUTME: Tests connection, handshake, and message routing
+// ABOUTME: Tests connection, handshake, negotiation, and message routing
 package protocol
 
 import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
 )
 
 func TestNewClient(t *testing.T) {
@@ -22,3 +30,194 @@ func TestNewClient(t *testing.T) {
 		t.Errorf("expected server addr localhost:8927, got %s", client.config.ServerAddr)
 	}
 }
+
+func TestClientStreamGeneration(t *testing.T) {
+	client := NewClient(Config{})
+	chunk := []byte{1, 0, 0, 0, 0, 0, 0, 0, 1, 0xAA}
+
+	client.handleBinaryMessage(chunk)
+	client.handleJSONMessage([]byte(`{"type":"stream/start","payload":{"player":{"codec":"pcm","sample_rate":48000,"channels":2,"bit_depth":16}}}`))
+	client.handleBinaryMessage(chunk)
+	client.handleJSONMessage([]byte(`{"type":"stream/clear","payload":{}}`))
+	client.handleBinaryMessage(chunk)
+	client.handleJSONMessage([]byte(`{"type":"stream/end","payload":{}}`))
+	client.handleBinaryMessage(chunk)
+
+	for i, want := range []uint64{0, 1, 2, 2} {
+		got := <-client.AudioChunks
+		if got.Generation != want {
+			t.Errorf("chunk %d: expected generation %d, got %d", i, want, got.Generation)
+		}
+	}
+
+	// Stream control arrives in the order it was sent
+	for i, want := range []string{"start", "clear", "end"} {
+		var got string
+		switch (<-client.StreamEvents).(type) {
+		case StreamStart:
+			got = "start"
+		case StreamClear:
+			got = "clear"
+		case StreamEnd:
+			got = "end"
+		}
+		if got != want {
+			t.Errorf("event %d: expected %s, got %s", i, want, got)
+		}
+	}
+}
+
+// fakeServer accepts one client, reads its hello and passes the
+// connection to serve
+func fakeServer(t *testing.T, serve func(conn *websocket.Conn, hello ClientHello)) string {
+	t.Helper()
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		var msg Message
+		if err := conn.ReadJSON(&msg); err != nil {
+			return
+		}
+		var hello ClientHello
+		if err := DecodePayload(msg.Payload, &hello); err != nil {
+			t.Errorf("invalid client/hello: %v", err)
+			return
+		}
+		serve(conn, hello)
+	}))
+	t.Cleanup(srv.Close)
+	return strings.TrimPrefix(srv.URL, "http://")
+}
+
+// readType reads messages until one of the given type arrives
+func readType(t *testing.T, conn *websocket.Conn, msgType string) Message {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	for {
+		var msg Message
+		if err := conn.ReadJSON(&msg); err != nil {
+			t.Fatalf("failed waiting for %s: %v", msgType, err)
+		}
+		if msg.Type == msgType {
+			return msg
+		}
+	}
+}
+
+func TestClientHandshakeNegotiatesFeatures(t *testing.T) {
+	offered := make(chan ClientHello, 1)
+	addr := fakeServer(t, func(conn *websocket.Conn, hello ClientHello) {
+		offered <- hello
+		conn.WriteJSON(Message{Type: "server/hello", Payload: ServerHello{
+			ServerID: "srv", Name: "Server", Version: 1,
+			Features: []string{FeatureErrors, "from_the_future"},
+		}})
+		readType(t, conn, "player/update")
+		conn.ReadMessage() // Hold the connection until the client closes
+	})
+
+	client := NewClient(Config{ServerAddr: addr, ClientID: "c1", Name: "Client"})
+	if err := client.Connect(); err != nil {
+		t.Fatalf("connect failed: %v", err)
+	}
+	defer client.Close()
+
+	hello := <-offered
+	if hello.Version != Version {
+		t.Errorf("expected hello to offer version %d, got %d", Version, hello.Version)
+	}
+	if !slices.Equal(hello.Features, SupportedFeatures) {
+		t.Errorf("expected hello to offer %v, got %v", SupportedFeatures, hello.Features)
+	}
+	if !slices.Equal(client.Features(), []string{FeatureErrors}) {
+		t.Errorf("expected negotiated features [%s], got %v", FeatureErrors, client.Features())
+	}
+	if client.HasFeature(FeatureProgress) {
+		t.Errorf("expected %s not to be negotiated", FeatureProgress)
+	}
+}
+
+func TestClientHandshakeRefused(t *testing.T) {
+	addr := fakeServer(t, func(conn *websocket.Conn, hello ClientHello) {
+		conn.WriteJSON(Message{Type: "server/error", Payload: Error{Code: ErrorDuplicateClient, Reason: "already connected"}})
+	})
+
+	err := NewClient(Config{ServerAddr: addr, ClientID: "c1", Name: "Client"}).Connect()
+	var refusal *Error
+	if !errors.As(err, &refusal) || refusal.Code != ErrorDuplicateClient {
+		t.Fatalf("expected a %s error, got %v", ErrorDuplicateClient, err)
+	}
+}
+
+func TestClientRejectsUnsupportedVersion(t *testing.T) {
+	answered := make(chan Error, 1)
+	addr := fakeServer(t, func(conn *websocket.Conn, hello ClientHello) {
+		conn.WriteJSON(Message{Type: "server/hello", Payload: ServerHello{ServerID: "srv", Version: Version + 1}})
+		var clientErr Error
+		DecodePayload(readType(t, conn, "client/error").Payload, &clientErr)
+		answered <- clientErr
+	})
+
+	err := NewClient(Config{ServerAddr: addr, ClientID: "c1", Name: "Client"}).Connect()
+	var versionErr *Error
+	if !errors.As(err, &versionErr) || versionErr.Code != ErrorUnsupportedVersion {
+		t.Fatalf("expected a %s error, got %v", ErrorUnsupportedVersion, err)
+	}
+	if got := <-answered; got.Code != ErrorUnsupportedVersion {
+		t.Errorf("expected the server to be told %s, got %q", ErrorUnsupportedVersion, got.Code)
+	}
+}
+
+func TestClientAnswersBadMessagesWithErrors(t *testing.T) {
+	codes := make(chan string, 3)
+	addr := fakeServer(t, func(conn *websocket.Conn, hello ClientHello) {
+		conn.WriteJSON(Message{Type: "server/hello", Payload: ServerHello{ServerID: "srv", Version: 1}})
+		readType(t, conn, "player/update")
+
+		for _, msg := range []Message{
+			{Type: "server/command", Payload: ServerCommand{Command: "volume", Volume: 150}},
+			{Type: "server/teleport", Payload: struct{}{}},
+			{Type: "server/command", Payload: ServerCommand{Command: "reboot"}},
+		} {
+			conn.WriteJSON(msg)
+			var clientErr Error
+			DecodePayload(readType(t, conn, "client/error").Payload, &clientErr)
+			codes <- clientErr.Code
+		}
+		conn.WriteJSON(Message{Type: "server/error", Payload: Error{Code: ErrorNotPermitted, Reason: "no"}})
+		conn.ReadMessage()
+	})
+
+	client := NewClient(Config{
+		ServerAddr:    addr,
+		ClientID:      "c1",
+		Name:          "Client",
+		PlayerSupport: PlayerSupport{SupportedCommands: []string{"volume", "mute"}},
+	})
+	if err := client.Connect(); err != nil {
+		t.Fatalf("connect failed: %v", err)
+	}
+	defer client.Close()
+
+	for _, want := range []string{ErrorInvalidMessage, ErrorUnknownMessage, ErrorUnsupportedCommand} {
+		if got := <-codes; got != want {
+			t.Errorf("expected client/error %s, got %s", want, got)
+		}
+	}
+	select {
+	case got := <-client.Errors:
+		if got.Code != ErrorNotPermitted {
+			t.Errorf("expected server error %s, got %s", ErrorNotPermitted, got.Code)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("server/error was not delivered")
+	}
+	if len(client.ControlMsgs) != 0 {
+		t.Errorf("expected rejected commands not to be delivered, got %d", len(client.ControlMsgs))
+	}
+}
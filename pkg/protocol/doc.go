@@ -1,12 +1,27 @@
 // ABOUTME: Resonate wire protocol package
-// ABOUTME: Defines protocol messages and WebSocket client
+// ABOUTME: Defines protocol messages, the WebSocket client and the server side of a connection
 // Package protocol implements the Resonate wire protocol.
 //
 // Provides message types and WebSocket client for communicating
-// with Resonate servers.
+// with Resonate servers, and ServerConn for building servers: it reads
+// client/hello, answers time sync, delivers client messages on typed
+// channels and queues messages and audio chunks for the client.
+//
+// Hellos negotiate the protocol version (NegotiateVersion) and optional
+// features (NegotiateFeatures). Payloads are decoded and validated with
+// DecodePayload; unknown fields are ignored, and problems are reported
+// to the peer as server/error or client/error messages (Error).
 //
 // Example:
 //
 //	client, err := protocol.NewClient("localhost:8927")
 //	err = client.SendHello(helloMsg)
+//
+// Server side, in a WebSocket handler:
+//
+//	sc, err := protocol.NewServerConn(conn, protocol.ServerConfig{ServerID: id, Name: "Living Room"})
+//	err = sc.Accept()
+//	sc.SendStreamStart(start)
+//	sc.SendAudioChunk(timestamp, data)
+//	for state := range sc.PlayerUpdates { ... }
 package protocol
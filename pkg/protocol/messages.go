@@ -2,6 +2,8 @@
 // ABOUTME: Defines structs for all message types in the protocol
 package protocol
 
+import "fmt"
+
 // Message is the top-level wrapper for all protocol messages
 type Message struct {
 	Type    string      `json:"type"`
@@ -12,8 +14,9 @@ type Message struct {
 type ClientHello struct {
 	ClientID          string             `json:"client_id"`
 	Name              string             `json:"name"`
-	Version           int                `json:"version"`
+	Version           int                `json:"version"` // Newest protocol version the client speaks
 	SupportedRoles    []string           `json:"supported_roles"`
+	Features          []string           `json:"features,omitempty"` // Optional features the client supports
 	DeviceInfo        *DeviceInfo        `json:"device_info,omitempty"`
 	PlayerSupport     *PlayerSupport     `json:"player_support,omitempty"`
 	MetadataSupport   *MetadataSupport   `json:"metadata_support,omitempty"`
@@ -64,23 +67,76 @@ type VisualizerSupport struct {
 
 // ServerHello is the server's response to client/hello
 type ServerHello struct {
-	ServerID string `json:"server_id"`
-	Name     string `json:"name"`
-	Version  int    `json:"version"`
+	ServerID string   `json:"server_id"`
+	Name     string   `json:"name"`
+	Version  int      `json:"version"`            // Protocol version chosen for the connection
+	Features []string `json:"features,omitempty"` // Optional features both sides support
+}
+
+// Error codes carried by server/error and client/error. Peers treat codes
+// they don't know as generic errors.
+const (
+	ErrorInvalidMessage     = "invalid_message"     // Malformed payload or missing/out-of-range field
+	ErrorUnknownMessage     = "unknown_message"     // Message type not understood
+	ErrorUnsupportedVersion = "unsupported_version" // No protocol version in common
+	ErrorUnsupportedCommand = "unsupported_command" // Command not supported by the receiver
+	ErrorNotPermitted       = "not_permitted"       // Message not allowed for the sender's roles
+	ErrorDuplicateClient    = "duplicate_client"    // Client ID already connected
+	ErrorShuttingDown       = "shutting_down"       // Server is stopping
+)
+
+// Error reports a problem to the peer (sent as server/error or
+// client/error). Errors during the handshake are followed by the
+// connection closing; later ones leave it open.
+type Error struct {
+	Code   string `json:"code"`
+	Reason string `json:"reason"`
+}
+
+// Errorf returns an Error with the given code and a formatted reason
+func Errorf(code, format string, args ...any) *Error {
+	return &Error{Code: code, Reason: fmt.Sprintf(format, args...)}
+}
+
+func (e *Error) Error() string {
+	return e.Code + ": " + e.Reason
 }
 
 // ClientState reports the player's current state (sent as player/update message)
 type ClientState struct {
-	State  string `json:"state"`  // "playing" or "idle"
+	State  string `json:"state"`  // "playing", "paused" or "idle"
 	Volume int    `json:"volume"` // 0-100
 	Muted  bool   `json:"muted"`  // All fields are required
 }
 
 // ServerCommand is a control message from the server
 type ServerCommand struct {
-	Command string `json:"command"`
-	Volume  int    `json:"volume,omitempty"`
-	Mute    bool   `json:"mute,omitempty"`
+	Command string       `json:"command"`
+	Volume  int          `json:"volume,omitempty"`
+	Mute    bool         `json:"mute,omitempty"`
+	DSP     *DSPSettings `json:"dsp,omitempty"` // Set for the "dsp" command
+}
+
+// DSPSettings replaces a player's processing chain (sent with the "dsp"
+// command). Empty settings disable processing.
+type DSPSettings struct {
+	Preamp          float64     `json:"preamp,omitempty"`           // dB
+	Filters         []DSPFilter `json:"filters,omitempty"`          // Applied in order
+	ImpulseResponse string      `json:"impulse_response,omitempty"` // WAV file name in the player's impulse response directory
+}
+
+// DSPFilter is one parametric EQ band
+type DSPFilter struct {
+	Type      string  `json:"type"` // "peaking", "lowshelf", "highshelf", "lowpass" or "highpass"
+	Frequency float64 `json:"frequency"`
+	Gain      float64 `json:"gain,omitempty"` // dB
+	Q         float64 `json:"q,omitempty"`
+}
+
+// ClientCommand is a control request from a controller client (sent as client/command)
+type ClientCommand struct {
+	Command  string `json:"command"`            // "seek" or "next"
+	Position int64  `json:"position,omitempty"` // Seek target in milliseconds
 }
 
 // StreamStartPlayer contains the audio format details
@@ -89,7 +145,16 @@ type StreamStartPlayer struct {
 	SampleRate  int    `json:"sample_rate"`
 	Channels    int    `json:"channels"`
 	BitDepth    int    `json:"bit_depth"`
-	CodecHeader string `json:"codec_header,omitempty"` // Base64-encoded
+	CodecHeader string `json:"codec_header,omitempty"` // Base64-encoded (OpusHead for opus)
+
+	// ChannelLayout names the channels sent, e.g. "stereo" or "5.1".
+	// Channels are interleaved in WAVE order (FL FR FC LFE BL BR SL SR).
+	ChannelLayout string `json:"channel_layout,omitempty"`
+
+	// ChannelRole is the channels the server sends this player: "stereo"
+	// (all source channels), "left", "right", "mono" or "custom"
+	ChannelRole   string      `json:"channel_role,omitempty"`
+	ChannelMatrix [][]float64 `json:"channel_matrix,omitempty"` // Source channel gains per sent channel (custom role)
 }
 
 // StreamStart notifies the client of stream format (nested structure)
@@ -97,6 +162,27 @@ type StreamStart struct {
 	Player *StreamStartPlayer `json:"player,omitempty"`
 }
 
+// StreamEnd tells clients the stream is over; players finish buffered audio then go idle
+type StreamEnd struct {
+	Roles []string `json:"roles,omitempty"` // Roles the end applies to (all if empty)
+}
+
+// StreamClear tells clients to drop buffered audio that has not played yet
+// (sent on seek, skip and stop; the stream continues with new chunks)
+type StreamClear struct {
+	Roles []string `json:"roles,omitempty"` // Roles the clear applies to (all if empty)
+}
+
+// StreamEvent is a StreamStart, StreamClear or StreamEnd. Clients deliver
+// them on one channel, in the order the server sent them.
+type StreamEvent interface {
+	streamEvent()
+}
+
+func (StreamStart) streamEvent() {}
+func (StreamEnd) streamEvent()   {}
+func (StreamClear) streamEvent() {}
+
 // StreamMetadata contains track information
 type StreamMetadata struct {
 	Title      string `json:"title,omitempty"`
@@ -118,13 +204,25 @@ type SessionMetadata struct {
 	PlaybackSpeed float64 `json:"playback_speed,omitempty"`
 	Repeat        string  `json:"repeat,omitempty"`
 	Shuffle       bool    `json:"shuffle,omitempty"`
-	Timestamp     int64   `json:"timestamp,omitempty"`
+	Timestamp     int64   `json:"timestamp,omitempty"`      // Server clock (µs) at which TrackProgress was current
+	TrackProgress int64   `json:"track_progress,omitempty"` // Position in milliseconds at Timestamp
+
+	Normalization *Normalization `json:"normalization,omitempty"`
+}
+
+// Normalization reports the loudness normalization the server applies
+type Normalization struct {
+	Mode     string  `json:"mode"`               // "track", "album" or "auto"
+	Gain     float64 `json:"gain"`               // Applied gain in dB
+	Peak     float64 `json:"peak,omitempty"`     // Peak amplitude the gain is based on (1.0 = full scale)
+	Loudness float64 `json:"loudness,omitempty"` // Measured integrated loudness (LUFS), if analyzed
+	Source   string  `json:"source"`             // "tags" or "analysis"
 }
 
 // SessionUpdate notifies client of session state changes
 type SessionUpdate struct {
 	GroupID       string           `json:"group_id"`
-	PlaybackState string           `json:"playback_state,omitempty"` // "playing" or "idle"
+	PlaybackState string           `json:"playback_state,omitempty"` // "playing", "paused" or "idle"
 	Metadata      *SessionMetadata `json:"metadata,omitempty"`
 }
 
@@ -0,0 +1,391 @@
+// ABOUTME: Scripted protocol connection used by the fake server and fake player
+// ABOUTME: Sends raw or typed messages and asserts the sequence of messages received
+package protocoltest
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Sendspin/sendspin-go/pkg/protocol"
+	"github.com/gorilla/websocket"
+)
+
+// Frame types for messages that are not JSON protocol messages
+const (
+	TypeAudioChunk = "<audio chunk>" // Binary audio chunk
+	TypeBinary     = "<binary>"      // Other binary message
+	TypeMalformed  = "<malformed>"   // Text message that is not a protocol message
+)
+
+const (
+	// DefaultTimeout is how long expectations wait for a message
+	DefaultTimeout = 3 * time.Second
+
+	// DefaultQuiet is how long ExpectNoError watches for errors
+	DefaultQuiet = 300 * time.Millisecond
+)
+
+// Frame is one message received from the peer
+type Frame struct {
+	Type    string      // Message type, or one of the Type* constants
+	Payload interface{} // JSON payload
+
+	Timestamp int64  // Audio chunk timestamp (µs, server clock)
+	Data      []byte // Audio chunk data, or the raw message for other binary and malformed frames
+}
+
+// Conn is one side of a scripted protocol connection. Its methods fail
+// the test, so call them from the test goroutine.
+//
+// Connections of the fake server answer client/time themselves, so time
+// sync never interrupts an expected sequence; ExpectTimeSync checks it
+// happened.
+type Conn struct {
+	// Timeout is how long expectations wait for a message
+	Timeout time.Duration
+
+	t     testing.TB
+	ws    *websocket.Conn
+	peer  string // "client" or "server": the prefix of messages the peer sends
+	local string // The prefix of messages this side sends
+
+	writeMu sync.Mutex
+	frames  chan Frame
+	syncs   chan protocol.ClientTime // client/time requests answered (fake server only)
+	done    chan struct{}            // Closed when the test ends
+
+	mu       sync.Mutex
+	received []Frame
+	readErr  error
+}
+
+// newConn wraps an open WebSocket; peer names the other side
+func newConn(t testing.TB, ws *websocket.Conn, peer string) *Conn {
+	c := &Conn{
+		Timeout: DefaultTimeout,
+		t:       t,
+		ws:      ws,
+		peer:    peer,
+		local:   map[string]string{"client": "server", "server": "client"}[peer],
+		frames:  make(chan Frame, 256),
+		syncs:   make(chan protocol.ClientTime, 64),
+		done:    make(chan struct{}),
+	}
+	t.Cleanup(func() {
+		close(c.done)
+		ws.Close()
+	})
+	go c.readFrames()
+	return c
+}
+
+// readFrames reads until the connection closes, answering time sync on
+// the server side
+func (c *Conn) readFrames() {
+	defer close(c.frames)
+
+	for {
+		kind, data, err := c.ws.ReadMessage()
+		if err != nil {
+			c.mu.Lock()
+			c.readErr = err
+			c.mu.Unlock()
+			return
+		}
+		received := time.Now().UnixMicro()
+
+		frame := parseFrame(kind, data)
+		if frame.Type == "client/time" && c.peer == "client" {
+			var clientTime protocol.ClientTime
+			if protocol.DecodePayload(frame.Payload, &clientTime) == nil {
+				c.write(websocket.TextMessage, protocol.Message{Type: "server/time", Payload: protocol.ServerTime{
+					ClientTransmitted: clientTime.ClientTransmitted,
+					ServerReceived:    received,
+					ServerTransmitted: time.Now().UnixMicro(),
+				}})
+				select {
+				case c.syncs <- clientTime:
+				default:
+				}
+				continue
+			}
+		}
+
+		c.mu.Lock()
+		c.received = append(c.received, frame)
+		c.mu.Unlock()
+		select {
+		case c.frames <- frame:
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// parseFrame turns a WebSocket message into a Frame
+func parseFrame(kind int, data []byte) Frame {
+	if kind == websocket.BinaryMessage {
+		if len(data) >= 9 && data[0] == protocol.AudioChunkType {
+			return Frame{
+				Type:      TypeAudioChunk,
+				Timestamp: int64(binary.BigEndian.Uint64(data[1:9])),
+				Data:      data[9:],
+			}
+		}
+		return Frame{Type: TypeBinary, Data: data}
+	}
+
+	var msg protocol.Message
+	if err := json.Unmarshal(data, &msg); err != nil || msg.Type == "" {
+		return Frame{Type: TypeMalformed, Data: data}
+	}
+	return Frame{Type: msg.Type, Payload: msg.Payload}
+}
+
+// Received returns every frame received so far, in order
+func (c *Conn) Received() []Frame {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return slices.Clone(c.received)
+}
+
+// Send sends a JSON protocol message
+func (c *Conn) Send(msgType string, payload interface{}) {
+	c.t.Helper()
+	if err := c.write(websocket.TextMessage, protocol.Message{Type: msgType, Payload: payload}); err != nil {
+		c.t.Fatalf("failed to send %s: %v", msgType, err)
+	}
+}
+
+// SendRaw sends data as a text message as is, e.g. malformed JSON
+func (c *Conn) SendRaw(data []byte) {
+	c.t.Helper()
+	if err := c.write(websocket.TextMessage, data); err != nil {
+		c.t.Fatalf("failed to send raw message: %v", err)
+	}
+}
+
+// SendBinary sends data as a binary message as is
+func (c *Conn) SendBinary(data []byte) {
+	c.t.Helper()
+	if err := c.write(websocket.BinaryMessage, data); err != nil {
+		c.t.Fatalf("failed to send binary message: %v", err)
+	}
+}
+
+// SendAudioChunk sends an audio chunk to play at timestamp (µs, server clock)
+func (c *Conn) SendAudioChunk(timestamp int64, data []byte) {
+	c.t.Helper()
+	chunk := make([]byte, 9+len(data))
+	chunk[0] = protocol.AudioChunkType
+	binary.BigEndian.PutUint64(chunk[1:9], uint64(timestamp))
+	copy(chunk[9:], data)
+	c.SendBinary(chunk)
+}
+
+// SendError sends server/error or client/error, whichever this side sends
+func (c *Conn) SendError(code, reason string) {
+	c.t.Helper()
+	c.Send(c.local+"/error", protocol.Error{Code: code, Reason: reason})
+}
+
+// write writes a message; v is a []byte or a value to encode as JSON
+func (c *Conn) write(kind int, v interface{}) error {
+	data, ok := v.([]byte)
+	if !ok {
+		var err error
+		if data, err = json.Marshal(v); err != nil {
+			return err
+		}
+	}
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	c.ws.SetWriteDeadline(time.Now().Add(DefaultTimeout))
+	return c.ws.WriteMessage(kind, data)
+}
+
+// Next returns the next frame, failing if none arrives in time or the
+// connection closes
+func (c *Conn) Next() Frame {
+	c.t.Helper()
+	frame, ok := c.next(c.Timeout)
+	if !ok {
+		c.t.Fatalf("expected a message from the %s, %s", c.peer, c.closedReason())
+	}
+	return frame
+}
+
+// next waits up to timeout for a frame; ok is false on timeout or close
+func (c *Conn) next(timeout time.Duration) (Frame, bool) {
+	select {
+	case frame, ok := <-c.frames:
+		return frame, ok
+	case <-time.After(timeout):
+		return Frame{}, false
+	}
+}
+
+// closedReason describes why no frame arrived
+func (c *Conn) closedReason() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.readErr != nil {
+		return "but the connection closed: " + c.readErr.Error()
+	}
+	return "but none arrived"
+}
+
+// Expect requires the next frame to be of msgType. When v is not nil the
+// payload is decoded into it and validated.
+func (c *Conn) Expect(msgType string, v any) Frame {
+	c.t.Helper()
+	frame := c.Next()
+	if frame.Type != msgType {
+		c.t.Fatalf("expected %s from the %s, got %s", msgType, c.peer, describe(frame))
+	}
+	c.decode(frame, v)
+	return frame
+}
+
+// ExpectSequence requires the next frames to be of the given types, in order
+func (c *Conn) ExpectSequence(types ...string) []Frame {
+	c.t.Helper()
+	frames := make([]Frame, len(types))
+	for i, msgType := range types {
+		frames[i] = c.Expect(msgType, nil)
+	}
+	return frames
+}
+
+// WaitFor skips frames until one of msgType arrives, decoding it into v
+// like Expect. Use it where the peer may interleave other messages, such
+// as a server streaming audio.
+func (c *Conn) WaitFor(msgType string, v any) Frame {
+	c.t.Helper()
+	deadline := time.Now().Add(c.Timeout)
+	for {
+		frame, ok := c.next(time.Until(deadline))
+		if !ok {
+			c.t.Fatalf("expected %s from the %s, %s", msgType, c.peer, c.closedReason())
+		}
+		if frame.Type == msgType {
+			c.decode(frame, v)
+			return frame
+		}
+	}
+}
+
+// ExpectError waits for the peer's error message, skipping other
+// messages, and requires its code to be one of codes (any code when none
+// are given)
+func (c *Conn) ExpectError(codes ...string) protocol.Error {
+	c.t.Helper()
+	var e protocol.Error
+	c.WaitFor(c.peer+"/error", &e)
+	if len(codes) > 0 && !slices.Contains(codes, e.Code) {
+		c.t.Fatalf("expected %s/error %s, got %v", c.peer, strings.Join(codes, " or "), &e)
+	}
+	return e
+}
+
+// ExpectNoError watches the connection for d, failing if the peer reports
+// an error, sends something malformed or closes the connection. Other
+// messages are skipped.
+func (c *Conn) ExpectNoError(d time.Duration) {
+	c.t.Helper()
+	deadline := time.Now().Add(d)
+	for {
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return
+		}
+		select {
+		case frame, ok := <-c.frames:
+			if !ok {
+				c.t.Fatalf("expected the connection to stay open, %s", c.closedReason())
+			}
+			switch frame.Type {
+			case c.peer + "/error", TypeMalformed:
+				c.t.Fatalf("expected no error from the %s, got %s", c.peer, describe(frame))
+			}
+		case <-time.After(remaining):
+			return
+		}
+	}
+}
+
+// ExpectClosed waits for the peer to close the connection, skipping any
+// messages sent before it does
+func (c *Conn) ExpectClosed() {
+	c.t.Helper()
+	deadline := time.Now().Add(c.Timeout)
+	for {
+		select {
+		case _, ok := <-c.frames:
+			if !ok {
+				return
+			}
+		case <-time.After(time.Until(deadline)):
+			c.t.Fatalf("expected the %s to close the connection", c.peer)
+		}
+	}
+}
+
+// ExpectTimeSync waits for the client to send client/time, which the fake
+// server has answered with server/time, and returns the request
+func (c *Conn) ExpectTimeSync() protocol.ClientTime {
+	c.t.Helper()
+	select {
+	case clientTime := <-c.syncs:
+		return clientTime
+	case <-time.After(c.Timeout):
+		c.t.Fatal("expected client/time from the client")
+		return protocol.ClientTime{}
+	}
+}
+
+// decode decodes and validates a frame's payload into v, if v is not nil
+func (c *Conn) decode(frame Frame, v any) {
+	c.t.Helper()
+	if v == nil {
+		return
+	}
+	if err := protocol.DecodePayload(frame.Payload, v); err != nil {
+		c.t.Fatalf("invalid %s from the %s: %v", frame.Type, c.peer, err)
+	}
+}
+
+// Close closes the connection cleanly, telling the peer with a close frame
+func (c *Conn) Close() {
+	c.writeMu.Lock()
+	msg := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+	c.ws.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+	c.writeMu.Unlock()
+	c.ws.Close()
+}
+
+// Drop closes the connection without a close frame, as if the network failed
+func (c *Conn) Drop() {
+	c.ws.Close()
+}
+
+// describe formats a frame for failure messages
+func describe(frame Frame) string {
+	switch frame.Type {
+	case TypeAudioChunk:
+		return "an audio chunk"
+	case TypeBinary:
+		return fmt.Sprintf("a %d-byte binary message", len(frame.Data))
+	case TypeMalformed:
+		return fmt.Sprintf("malformed message %q", frame.Data)
+	}
+	payload, _ := json.Marshal(frame.Payload)
+	return frame.Type + " " + string(payload)
+}
@@ -0,0 +1,27 @@
+// ABOUTME: Protocol conformance test harness package
+// ABOUTME: Scriptable fake server and fake player plus suites for checking implementations
+// Package protocoltest provides a scriptable fake Sendspin server and fake
+// player for testing protocol implementations, and conformance suites
+// built on them.
+//
+// Both fakes speak raw protocol messages over a loopback WebSocket, so
+// tests decide exactly what is sent, including malformed and out-of-order
+// messages, and assert the sequence of messages that comes back:
+//
+//	srv := protocoltest.NewServer(t)
+//	go player.Connect(srv.Addr)
+//	conn, hello := srv.Handshake()
+//	conn.Expect("player/update", nil)
+//	conn.SendRaw([]byte("{not json"))
+//	conn.ExpectError(protocol.ErrorInvalidMessage)
+//
+//	conn, serverHello := protocoltest.DialPlayer(t, url, protocoltest.PlayerHello("p1"))
+//	conn.Send("client/time", protocol.ClientTime{ClientTransmitted: 1})
+//	conn.Expect("server/time", &reply)
+//
+// RunServerSuite and RunPlayerSuite check a server or player against the
+// protocol: the handshake, stream start, time sync, commands, disconnects,
+// and how malformed and out-of-order messages are handled. Servers and
+// players written in other languages can be checked by running the suites
+// against them over the network.
+package protocoltest
@@ -0,0 +1,77 @@
+// ABOUTME: Fake Sendspin player for testing servers
+// ABOUTME: Dials a server and scripts the client side of the conversation
+package protocoltest
+
+import (
+	"net/http"
+	"slices"
+	"testing"
+
+	"github.com/Sendspin/sendspin-go/pkg/protocol"
+	"github.com/gorilla/websocket"
+)
+
+// Dial connects a fake client to the server at url (ws://host:port/path)
+// without sending anything. The connection is closed when the test ends.
+func Dial(t testing.TB, url string, header http.Header) *Conn {
+	t.Helper()
+	dialer := websocket.Dialer{HandshakeTimeout: DefaultTimeout}
+	ws, _, err := dialer.Dial(url, header)
+	if err != nil {
+		t.Fatalf("failed to connect to %s: %v", url, err)
+	}
+	return newConn(t, ws, "server")
+}
+
+// DialPlayer connects a fake client and performs the handshake: it sends
+// hello, requires server/hello as the first reply and, for players, sends
+// the initial player/update
+func DialPlayer(t testing.TB, url string, hello protocol.ClientHello) (*Conn, protocol.ServerHello) {
+	t.Helper()
+	return dialHello(t, url, nil, hello)
+}
+
+// dialHello is DialPlayer with headers sent when connecting
+func dialHello(t testing.TB, url string, header http.Header, hello protocol.ClientHello) (*Conn, protocol.ServerHello) {
+	t.Helper()
+	conn := Dial(t, url, header)
+	conn.Send("client/hello", hello)
+
+	var serverHello protocol.ServerHello
+	conn.Expect("server/hello", &serverHello)
+	if slices.Contains(hello.SupportedRoles, "player") {
+		conn.Send("player/update", protocol.ClientState{State: "idle", Volume: 100})
+	}
+	return conn, serverHello
+}
+
+// PlayerHello returns a valid client/hello for a stereo PCM player with
+// the volume and mute commands
+func PlayerHello(clientID string) protocol.ClientHello {
+	return protocol.ClientHello{
+		ClientID:       clientID,
+		Name:           "Conformance Player " + clientID,
+		Version:        protocol.Version,
+		SupportedRoles: []string{"player"},
+		Features:       protocol.SupportedFeatures,
+		PlayerSupport: &protocol.PlayerSupport{
+			SupportFormats: []protocol.AudioFormat{
+				{Codec: "pcm", Channels: 2, SampleRate: 48000, BitDepth: 16},
+				{Codec: "pcm", Channels: 2, SampleRate: 48000, BitDepth: 24},
+			},
+			BufferCapacity:    1 << 20,
+			SupportedCommands: []string{"volume", "mute"},
+		},
+	}
+}
+
+// ControllerHello returns a valid client/hello for a controller
+func ControllerHello(clientID string) protocol.ClientHello {
+	return protocol.ClientHello{
+		ClientID:       clientID,
+		Name:           "Conformance Controller " + clientID,
+		Version:        protocol.Version,
+		SupportedRoles: []string{"controller"},
+		Features:       protocol.SupportedFeatures,
+	}
+}
@@ -0,0 +1,292 @@
+// ABOUTME: Conformance suite for Sendspin players
+// ABOUTME: Plays the fake server against a player and checks its side of the protocol
+package protocoltest
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Sendspin/sendspin-go/pkg/protocol"
+)
+
+// Player is a player under test, connected by PlayerOptions.Connect
+type Player interface {
+	// Done is closed when the player notices its connection closing
+	Done() <-chan struct{}
+
+	// Close disconnects the player
+	Close()
+}
+
+// PlayerOptions describes the player RunPlayerSuite checks
+type PlayerOptions struct {
+	// Connect makes the player connect to the server at addr (host:port)
+	// and returns once the handshake is over. It runs on its own
+	// goroutine while the suite plays the server, and its error is
+	// expected when the suite refuses the player.
+	Connect func(addr string) (Player, error)
+
+	// TimeSync reports whether the player syncs its clock with
+	// client/time by itself; the time sync check is skipped otherwise
+	TimeSync bool
+}
+
+// RunPlayerSuite checks a player against the protocol, playing a fake
+// server each check connects to afresh:
+//
+//   - handshake: client/hello is the first message and is valid, and the
+//     initial player/update follows server/hello; a refused player, or a
+//     server choosing a version it doesn't speak, ends the connection
+//   - stream start: stream/start, audio chunks and stream/end in a format
+//     the player offered are accepted without errors
+//   - time sync: the player sends client/time (when it syncs by itself)
+//   - commands: the commands the player advertises are accepted, others
+//     are refused with unsupported_command
+//   - malformed and out-of-order messages are reported with client/error
+//     or ignored, and leave the connection open
+//   - disconnect: the player closes cleanly, and notices the server
+//     closing or dropping the connection
+func RunPlayerSuite(t *testing.T, options PlayerOptions) {
+	s := &playerSuite{options: options}
+	t.Run("Handshake", s.testHandshake)
+	t.Run("Refused", s.testRefused)
+	t.Run("UnsupportedVersion", s.testUnsupportedVersion)
+	t.Run("StreamStart", s.testStreamStart)
+	t.Run("TimeSync", s.testTimeSync)
+	t.Run("Commands", s.testCommands)
+	t.Run("MalformedMessages", s.testMalformedMessages)
+	t.Run("OutOfOrderMessages", s.testOutOfOrderMessages)
+	t.Run("Disconnect", s.testDisconnect)
+}
+
+type playerSuite struct {
+	options PlayerOptions
+}
+
+// connectResult is the outcome of PlayerOptions.Connect
+type connectResult struct {
+	player Player
+	err    error
+}
+
+// start starts a fake server and has the player connect to it. The
+// returned function waits for Connect to return.
+func (s *playerSuite) start(t *testing.T) (*Server, func() (Player, error)) {
+	t.Helper()
+	srv := NewServer(t)
+	results := make(chan connectResult, 1)
+	go func() {
+		player, err := s.options.Connect(srv.Addr)
+		results <- connectResult{player, err}
+	}()
+
+	wait := func() (Player, error) {
+		t.Helper()
+		select {
+		case r := <-results:
+			if r.player != nil {
+				t.Cleanup(r.player.Close)
+			}
+			return r.player, r.err
+		case <-time.After(DefaultTimeout):
+			t.Fatal("expected the player's Connect to return")
+			return nil, nil
+		}
+	}
+	return srv, wait
+}
+
+// connect has the player connect and completes the handshake, returning
+// the server's side of the connection
+func (s *playerSuite) connect(t *testing.T) (*Conn, protocol.ClientHello, Player) {
+	t.Helper()
+	srv, wait := s.start(t)
+	conn, hello := srv.Handshake()
+	if hello.PlayerSupport == nil {
+		t.Fatal("expected player_support in client/hello")
+	}
+	conn.Expect("player/update", nil)
+
+	player, err := wait()
+	if err != nil {
+		t.Fatalf("player failed to connect: %v", err)
+	}
+	return conn, hello, player
+}
+
+// expectPlayerAlive checks the player still answers, skipping errors it
+// reported for earlier messages
+func expectPlayerAlive(t *testing.T, conn *Conn) {
+	t.Helper()
+	conn.Send("server/command", protocol.ServerCommand{Command: "conformance-unknown"})
+	for {
+		if conn.ExpectError().Code == protocol.ErrorUnsupportedCommand {
+			return
+		}
+	}
+}
+
+func (s *playerSuite) testHandshake(t *testing.T) {
+	srv, wait := s.start(t)
+	conn, hello := srv.Handshake()
+
+	if !slices.Contains(hello.SupportedRoles, "player") {
+		t.Errorf("expected the player role, got %v", hello.SupportedRoles)
+	}
+	if hello.PlayerSupport == nil || len(hello.PlayerSupport.SupportFormats)+len(hello.PlayerSupport.SupportCodecs) == 0 {
+		t.Error("expected player_support to list formats")
+	}
+
+	var state protocol.ClientState
+	conn.Expect("player/update", &state)
+	if _, err := wait(); err != nil {
+		t.Fatalf("player failed to connect: %v", err)
+	}
+	conn.ExpectNoError(DefaultQuiet)
+}
+
+func (s *playerSuite) testRefused(t *testing.T) {
+	srv, wait := s.start(t)
+	conn := srv.Accept()
+	conn.ExpectHello()
+	conn.SendError(protocol.ErrorDuplicateClient, "conformance test")
+
+	conn.ExpectClosed()
+	if _, err := wait(); err == nil {
+		t.Error("expected Connect to fail when refused")
+	}
+}
+
+func (s *playerSuite) testUnsupportedVersion(t *testing.T) {
+	srv, wait := s.start(t)
+	conn := srv.Accept()
+	hello := conn.ExpectHello()
+	reply := srv.Hello
+	reply.Version = hello.Version + 1
+	conn.Send("server/hello", reply)
+
+	conn.ExpectError(protocol.ErrorUnsupportedVersion)
+	conn.ExpectClosed()
+	if _, err := wait(); err == nil {
+		t.Error("expected Connect to fail on an unsupported version")
+	}
+}
+
+func (s *playerSuite) testStreamStart(t *testing.T) {
+	conn, hello, _ := s.connect(t)
+
+	format := protocol.AudioFormat{Codec: "pcm", Channels: 2, SampleRate: 48000, BitDepth: 16}
+	for _, f := range hello.PlayerSupport.SupportFormats {
+		if f.Codec == "pcm" {
+			format = f
+			break
+		}
+	}
+	conn.Send("stream/start", protocol.StreamStart{Player: &protocol.StreamStartPlayer{
+		Codec:      format.Codec,
+		SampleRate: format.SampleRate,
+		Channels:   format.Channels,
+		BitDepth:   format.BitDepth,
+	}})
+
+	// 20ms of silence per chunk, due shortly
+	silence := make([]byte, format.SampleRate/50*format.Channels*format.BitDepth/8)
+	due := time.Now().Add(500 * time.Millisecond).UnixMicro()
+	for i := range 5 {
+		conn.SendAudioChunk(due+int64(i)*20000, silence)
+	}
+	conn.ExpectNoError(DefaultQuiet)
+
+	conn.Send("stream/end", protocol.StreamEnd{})
+	conn.ExpectNoError(DefaultQuiet)
+	expectPlayerAlive(t, conn)
+}
+
+func (s *playerSuite) testTimeSync(t *testing.T) {
+	if !s.options.TimeSync {
+		t.Skip("player does not sync by itself")
+	}
+	conn, _, _ := s.connect(t)
+	conn.ExpectTimeSync()
+	conn.ExpectNoError(DefaultQuiet)
+}
+
+func (s *playerSuite) testCommands(t *testing.T) {
+	conn, hello, _ := s.connect(t)
+
+	for _, command := range hello.PlayerSupport.SupportedCommands {
+		cmd := protocol.ServerCommand{Command: command}
+		switch command {
+		case "volume":
+			cmd.Volume = 30
+		case "mute":
+			cmd.Mute = true
+		}
+		conn.Send("server/command", cmd)
+		conn.ExpectNoError(DefaultQuiet)
+	}
+	conn.Send("server/command", protocol.ServerCommand{Command: "conformance-unknown"})
+	conn.ExpectError(protocol.ErrorUnsupportedCommand)
+}
+
+func (s *playerSuite) testMalformedMessages(t *testing.T) {
+	conn, _, _ := s.connect(t)
+
+	conn.SendRaw([]byte("{not json"))
+	conn.ExpectError(protocol.ErrorInvalidMessage)
+	conn.Send("server/teleport", struct{}{})
+	conn.ExpectError(protocol.ErrorUnknownMessage)
+	conn.Send("stream/start", protocol.StreamStart{Player: &protocol.StreamStartPlayer{SampleRate: 48000, Channels: 2, BitDepth: 16}})
+	conn.ExpectError(protocol.ErrorInvalidMessage)
+	conn.Send("server/time", map[string]any{"client_transmitted": "soon"})
+	conn.ExpectError(protocol.ErrorInvalidMessage)
+
+	// Truncated and unknown binary messages may be ignored
+	conn.SendBinary([]byte{protocol.AudioChunkType, 0, 0})
+	conn.SendBinary([]byte{0xFF, 0, 0, 0, 0, 0, 0, 0, 0, 0})
+	expectPlayerAlive(t, conn)
+}
+
+func (s *playerSuite) testOutOfOrderMessages(t *testing.T) {
+	conn, _, _ := s.connect(t)
+
+	// Audio with no stream, and ends and clears of no stream
+	conn.SendAudioChunk(time.Now().UnixMicro(), make([]byte, 192))
+	conn.Send("stream/clear", protocol.StreamClear{})
+	conn.Send("stream/end", protocol.StreamEnd{})
+
+	// A second hello
+	conn.Send("server/hello", protocol.ServerHello{ServerID: "conformance-second-hello", Version: protocol.Version})
+	expectPlayerAlive(t, conn)
+}
+
+func (s *playerSuite) testDisconnect(t *testing.T) {
+	t.Run("player closes", func(t *testing.T) {
+		conn, _, player := s.connect(t)
+		player.Close()
+		conn.ExpectClosed()
+	})
+
+	t.Run("server closes", func(t *testing.T) {
+		conn, _, player := s.connect(t)
+		conn.Close()
+		expectDone(t, player)
+	})
+
+	t.Run("server drops", func(t *testing.T) {
+		conn, _, player := s.connect(t)
+		conn.Drop()
+		expectDone(t, player)
+	})
+}
+
+// expectDone waits for the player to notice its connection closing
+func expectDone(t *testing.T, player Player) {
+	t.Helper()
+	select {
+	case <-player.Done():
+	case <-time.After(DefaultTimeout):
+		t.Fatal("expected the player to notice the connection closing")
+	}
+}
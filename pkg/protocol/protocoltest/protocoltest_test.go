@@ -0,0 +1,164 @@
+// ABOUTME: Runs the conformance suites against the Go protocol implementation
+// ABOUTME: Checks protocol.ServerConn as a server and protocol.Client as a player
+package protocoltest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Sendspin/sendspin-go/pkg/protocol"
+	"github.com/gorilla/websocket"
+)
+
+// serveStream runs a minimal server on ServerConn that streams silence to
+// every player that joins
+func serveStream(t *testing.T) string {
+	t.Helper()
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		sc, err := protocol.NewServerConn(conn, protocol.ServerConfig{
+			ServerID: "go-server",
+			Name:     "Go Server",
+			Commands: []string{"next"},
+		})
+		if err != nil {
+			return
+		}
+		if err := sc.Accept(); err != nil {
+			return
+		}
+
+		if sc.HasRole("player") {
+			sc.SendStreamStart(protocol.StreamStart{Player: &protocol.StreamStartPlayer{
+				Codec: "pcm", SampleRate: 48000, Channels: 2, BitDepth: 24,
+			}})
+			go func() {
+				ticker := time.NewTicker(20 * time.Millisecond)
+				defer ticker.Stop()
+				silence := make([]byte, 960*2*3)
+				for {
+					select {
+					case now := <-ticker.C:
+						sc.SendAudioChunk(now.Add(500*time.Millisecond).UnixMicro(), silence)
+					case <-sc.Done():
+						return
+					}
+				}
+			}()
+		}
+
+		for {
+			select {
+			case <-sc.PlayerUpdates:
+			case <-sc.Commands:
+			case <-sc.Errors:
+			case <-sc.Done():
+				return
+			}
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return "ws://" + strings.TrimPrefix(srv.URL, "http://") + "/sendspin"
+}
+
+func TestServerConnConformance(t *testing.T) {
+	RunServerSuite(t, serveStream(t), ServerOptions{
+		Streams:  true,
+		Commands: []string{"next"},
+	})
+}
+
+func TestClientConformance(t *testing.T) {
+	RunPlayerSuite(t, PlayerOptions{
+		Connect: func(addr string) (Player, error) {
+			client := protocol.NewClient(protocol.Config{
+				ServerAddr: addr,
+				ClientID:   "go-player",
+				Name:       "Go Player",
+				Volume:     100,
+				PlayerSupport: protocol.PlayerSupport{
+					SupportFormats:    []protocol.AudioFormat{{Codec: "pcm", Channels: 2, SampleRate: 48000, BitDepth: 16}},
+					SupportedCommands: []string{"volume", "mute"},
+				},
+			})
+			if err := client.Connect(); err != nil {
+				return nil, err
+			}
+
+			// Stand in for the player: sync once and consume what arrives
+			client.SendTimeSync(time.Now().UnixMicro())
+			go func() {
+				for {
+					select {
+					case <-client.AudioChunks:
+					case <-client.ControlMsgs:
+					case <-client.TimeSyncResp:
+					case <-client.StreamEvents:
+					case <-client.Metadata:
+					case <-client.SessionUpdate:
+					case <-client.Errors:
+					case <-client.Done():
+						return
+					}
+				}
+			}()
+			return client, nil
+		},
+		TimeSync: true,
+	})
+}
+
+func TestConnScriptsBothSides(t *testing.T) {
+	srv := NewServer(t)
+	player := Dial(t, srv.URL, nil)
+	player.Send("client/hello", PlayerHello("p1"))
+
+	conn, hello := srv.Handshake()
+	if hello.ClientID != "p1" {
+		t.Errorf("expected client p1, got %s", hello.ClientID)
+	}
+	var serverHello protocol.ServerHello
+	player.Expect("server/hello", &serverHello)
+	if serverHello.ServerID != srv.Hello.ServerID || serverHello.Version != protocol.Version {
+		t.Errorf("unexpected server/hello %+v", serverHello)
+	}
+
+	// client/time is answered by the fake server without reaching the script
+	player.Send("client/time", protocol.ClientTime{ClientTransmitted: 5})
+	player.Send("player/update", protocol.ClientState{State: "idle", Volume: 80})
+	var reply protocol.ServerTime
+	player.Expect("server/time", &reply)
+	if reply.ClientTransmitted != 5 {
+		t.Errorf("expected client_transmitted 5, got %d", reply.ClientTransmitted)
+	}
+	if got := conn.ExpectTimeSync(); got.ClientTransmitted != 5 {
+		t.Errorf("expected time sync at 5, got %d", got.ClientTransmitted)
+	}
+	conn.Expect("player/update", nil)
+
+	conn.Send("stream/start", protocol.StreamStart{})
+	conn.SendAudioChunk(42, []byte{1, 2})
+	conn.SendRaw([]byte("{not json"))
+	frames := player.ExpectSequence("stream/start", TypeAudioChunk, TypeMalformed)
+	if frames[1].Timestamp != 42 || string(frames[1].Data) != "\x01\x02" {
+		t.Errorf("unexpected audio chunk %+v", frames[1])
+	}
+	if got := len(player.Received()); got != 5 {
+		t.Errorf("expected 5 frames received, got %d", got)
+	}
+
+	conn.SendError(protocol.ErrorNotPermitted, "test")
+	if e := player.ExpectError(protocol.ErrorNotPermitted); e.Reason != "test" {
+		t.Errorf("unexpected error %+v", e)
+	}
+
+	player.Close()
+	conn.ExpectClosed()
+}
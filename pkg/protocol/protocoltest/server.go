@@ -0,0 +1,105 @@
+// ABOUTME: Fake Sendspin server for testing players
+// ABOUTME: Accepts WebSocket connections on loopback and hands them to the test to script
+package protocoltest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Sendspin/sendspin-go/pkg/protocol"
+	"github.com/gorilla/websocket"
+)
+
+// Server is a fake server listening on loopback. It answers nothing by
+// itself: the test accepts each connection and scripts the conversation,
+// or uses Handshake for the usual opening.
+type Server struct {
+	// URL is the WebSocket URL to connect to (ws://host:port/sendspin)
+	URL string
+
+	// Addr is the server's host:port
+	Addr string
+
+	// Hello is sent by Handshake, with the version and features
+	// negotiated for each client
+	Hello protocol.ServerHello
+
+	t     testing.TB
+	conns chan *Conn
+}
+
+// NewServer starts a fake server that is shut down when the test ends
+func NewServer(t testing.TB) *Server {
+	t.Helper()
+	s := &Server{
+		Hello: protocol.ServerHello{
+			ServerID: "protocoltest-server",
+			Name:     "Conformance Server",
+			Version:  protocol.Version,
+			Features: protocol.SupportedFeatures,
+		},
+		t:     t,
+		conns: make(chan *Conn, 8),
+	}
+
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		s.conns <- newConn(t, ws, "client")
+	}))
+	t.Cleanup(srv.Close)
+
+	s.Addr = strings.TrimPrefix(srv.URL, "http://")
+	s.URL = "ws://" + s.Addr + "/sendspin"
+	return s
+}
+
+// Accept waits for the next client to connect
+func (s *Server) Accept() *Conn {
+	s.t.Helper()
+	select {
+	case conn := <-s.conns:
+		return conn
+	case <-time.After(DefaultTimeout):
+		s.t.Fatal("expected a client to connect")
+		return nil
+	}
+}
+
+// Handshake accepts the next client, requires client/hello as its first
+// message and answers with server/hello
+func (s *Server) Handshake() (*Conn, protocol.ClientHello) {
+	s.t.Helper()
+	conn := s.Accept()
+	hello := conn.ExpectHello()
+	s.answerHello(conn, hello)
+	return conn, hello
+}
+
+// answerHello sends server/hello with the version and features
+// negotiated for a client's hello
+func (s *Server) answerHello(conn *Conn, hello protocol.ClientHello) {
+	s.t.Helper()
+	version, err := protocol.NegotiateVersion(hello.Version)
+	if err != nil {
+		s.t.Fatalf("client offered an unusable version: %v", err)
+	}
+	reply := s.Hello
+	reply.Version = min(version, s.Hello.Version)
+	reply.Features = protocol.NegotiateFeatures(s.Hello.Features, hello.Features)
+	conn.Send("server/hello", reply)
+}
+
+// ExpectHello requires the next message to be a valid client/hello
+func (c *Conn) ExpectHello() protocol.ClientHello {
+	c.t.Helper()
+	var hello protocol.ClientHello
+	c.Expect("client/hello", &hello)
+	return hello
+}
@@ -0,0 +1,286 @@
+// ABOUTME: Conformance suite for Sendspin servers
+// ABOUTME: Plays fake clients against a running server and checks its side of the protocol
+package protocoltest
+
+import (
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Sendspin/sendspin-go/pkg/protocol"
+)
+
+// ServerOptions describes the server RunServerSuite checks
+type ServerOptions struct {
+	// Streams reports whether the server streams to players as soon as
+	// they join; the stream start checks are skipped otherwise
+	Streams bool
+
+	// Commands lists the client/command commands the server accepts from
+	// controllers
+	Commands []string
+
+	// Header is sent when connecting, e.g. for authorization
+	Header http.Header
+}
+
+// RunServerSuite checks the server at url (ws://host:port/path) against
+// the protocol, each check as a subtest with its own client IDs:
+//
+//   - handshake: server/hello answers client/hello first, with a version
+//     and features the client offered; hellos that can't be accepted, or
+//     messages sent before the hello, are refused with server/error and
+//     the connection closes
+//   - stream start: players get a valid stream/start in a format they
+//     offered before any audio, and chunk timestamps increase
+//   - time sync: client/time is answered with server/time echoing the
+//     client's timestamp
+//   - commands: controllers' supported commands are accepted, others are
+//     refused, and clients without the role are not permitted to send them
+//   - malformed and out-of-order messages are reported with server/error
+//     and leave the connection open; client/error is never answered
+//   - disconnect: a client that closes or drops its connection can
+//     connect again with the same client ID
+func RunServerSuite(t *testing.T, url string, options ServerOptions) {
+	s := &serverSuite{url: url, options: options}
+	t.Run("Handshake", s.testHandshake)
+	t.Run("HandshakeRefusals", s.testHandshakeRefusals)
+	t.Run("NewerClient", s.testNewerClient)
+	t.Run("StreamStart", s.testStreamStart)
+	t.Run("TimeSync", s.testTimeSync)
+	t.Run("Commands", s.testCommands)
+	t.Run("MalformedMessages", s.testMalformedMessages)
+	t.Run("OutOfOrderMessages", s.testOutOfOrderMessages)
+	t.Run("Disconnect", s.testDisconnect)
+}
+
+type serverSuite struct {
+	url     string
+	options ServerOptions
+}
+
+// dial connects a fake client and completes the handshake
+func (s *serverSuite) dial(t *testing.T, hello protocol.ClientHello) (*Conn, protocol.ServerHello) {
+	t.Helper()
+	return dialHello(t, s.url, s.options.Header, hello)
+}
+
+// expectAlive checks the server still answers time sync
+func expectAlive(t *testing.T, conn *Conn) {
+	t.Helper()
+	conn.Send("client/time", protocol.ClientTime{ClientTransmitted: 1})
+	conn.WaitFor("server/time", nil)
+}
+
+func (s *serverSuite) testHandshake(t *testing.T) {
+	hello := PlayerHello("conformance-handshake")
+	conn, serverHello := s.dial(t, hello)
+
+	if serverHello.Version < protocol.MinVersion || serverHello.Version > hello.Version {
+		t.Errorf("expected a version between %d and %d, got %d", protocol.MinVersion, hello.Version, serverHello.Version)
+	}
+	for _, f := range serverHello.Features {
+		if !slices.Contains(hello.Features, f) {
+			t.Errorf("server chose feature %q the client did not offer", f)
+		}
+	}
+	conn.ExpectNoError(DefaultQuiet)
+}
+
+func (s *serverSuite) testHandshakeRefusals(t *testing.T) {
+	noName := PlayerHello("conformance-no-name")
+	noName.Name = ""
+	noVersion := PlayerHello("conformance-no-version")
+	noVersion.Version = 0
+	noRole := PlayerHello("conformance-no-role")
+	noRole.SupportedRoles = []string{"controller"}
+
+	refusals := []struct {
+		name string
+		send func(conn *Conn)
+		want string
+	}{
+		{"malformed hello", func(conn *Conn) { conn.SendRaw([]byte(`{"type":"client/hello","payload":`)) }, protocol.ErrorInvalidMessage},
+		{"message before hello", func(conn *Conn) {
+			conn.Send("client/time", protocol.ClientTime{ClientTransmitted: 1})
+		}, protocol.ErrorInvalidMessage},
+		{"missing name", func(conn *Conn) { conn.Send("client/hello", noName) }, protocol.ErrorInvalidMessage},
+		{"support without role", func(conn *Conn) { conn.Send("client/hello", noRole) }, protocol.ErrorInvalidMessage},
+		{"unsupported version", func(conn *Conn) { conn.Send("client/hello", noVersion) }, protocol.ErrorUnsupportedVersion},
+	}
+	for _, r := range refusals {
+		t.Run(r.name, func(t *testing.T) {
+			conn := Dial(t, s.url, s.options.Header)
+			r.send(conn)
+
+			var e protocol.Error
+			conn.Expect("server/error", &e)
+			if e.Code != r.want {
+				t.Errorf("expected %s, got %v", r.want, &e)
+			}
+			conn.ExpectClosed()
+		})
+	}
+}
+
+func (s *serverSuite) testNewerClient(t *testing.T) {
+	hello := PlayerHello("conformance-newer")
+	hello.Version = protocol.Version + 1
+	hello.Features = append(slices.Clone(hello.Features), "conformance_from_the_future")
+	_, serverHello := s.dial(t, hello)
+
+	if serverHello.Version < protocol.MinVersion || serverHello.Version > hello.Version {
+		t.Errorf("expected a version between %d and %d, got %d", protocol.MinVersion, hello.Version, serverHello.Version)
+	}
+	if slices.Contains(serverHello.Features, "conformance_from_the_future") {
+		t.Error("server chose a feature it can't know")
+	}
+}
+
+func (s *serverSuite) testStreamStart(t *testing.T) {
+	if !s.options.Streams {
+		t.Skip("server does not stream on join")
+	}
+	hello := PlayerHello("conformance-stream")
+	conn, _ := s.dial(t, hello)
+
+	// Everything before the first chunk must include a valid stream/start
+	var start *protocol.StreamStart
+	for {
+		frame := conn.Next()
+		if frame.Type == TypeAudioChunk {
+			break
+		}
+		if frame.Type == "stream/start" {
+			start = &protocol.StreamStart{}
+			conn.decode(frame, start)
+		}
+	}
+	if start == nil || start.Player == nil {
+		t.Fatal("expected stream/start with a player format before audio")
+	}
+	p := start.Player
+	offered := protocol.AudioFormat{Codec: p.Codec, Channels: p.Channels, SampleRate: p.SampleRate, BitDepth: p.BitDepth}
+	if !slices.Contains(hello.PlayerSupport.SupportFormats, offered) {
+		t.Errorf("server chose %+v, which the player did not offer", offered)
+	}
+
+	last := int64(-1)
+	for range 3 {
+		chunk := conn.WaitFor(TypeAudioChunk, nil)
+		if chunk.Timestamp <= last {
+			t.Errorf("expected increasing chunk timestamps, got %d after %d", chunk.Timestamp, last)
+		}
+		last = chunk.Timestamp
+	}
+}
+
+func (s *serverSuite) testTimeSync(t *testing.T) {
+	conn, _ := s.dial(t, PlayerHello("conformance-time"))
+
+	for _, sent := range []int64{1000, 2000} {
+		conn.Send("client/time", protocol.ClientTime{ClientTransmitted: sent})
+		var reply protocol.ServerTime
+		conn.WaitFor("server/time", &reply)
+		if reply.ClientTransmitted != sent {
+			t.Errorf("expected client_transmitted %d to be echoed, got %d", sent, reply.ClientTransmitted)
+		}
+		if reply.ServerTransmitted < reply.ServerReceived {
+			t.Errorf("server transmitted at %d before receiving at %d", reply.ServerTransmitted, reply.ServerReceived)
+		}
+	}
+}
+
+func (s *serverSuite) testCommands(t *testing.T) {
+	controller, _ := s.dial(t, ControllerHello("conformance-controller"))
+	for _, command := range s.options.Commands {
+		controller.Send("client/command", protocol.ClientCommand{Command: command})
+		controller.ExpectNoError(DefaultQuiet)
+	}
+	controller.Send("client/command", protocol.ClientCommand{Command: "conformance-unknown"})
+	controller.ExpectError(protocol.ErrorUnsupportedCommand)
+	controller.Send("player/update", protocol.ClientState{State: "idle", Volume: 50})
+	controller.ExpectError(protocol.ErrorNotPermitted)
+
+	player, _ := s.dial(t, PlayerHello("conformance-not-controller"))
+	player.Send("client/command", protocol.ClientCommand{Command: "next"})
+	player.ExpectError(protocol.ErrorNotPermitted)
+}
+
+func (s *serverSuite) testMalformedMessages(t *testing.T) {
+	conn, _ := s.dial(t, PlayerHello("conformance-malformed"))
+
+	conn.SendRaw([]byte("{not json"))
+	conn.ExpectError(protocol.ErrorInvalidMessage)
+	conn.Send("client/teleport", struct{}{})
+	conn.ExpectError(protocol.ErrorUnknownMessage)
+	conn.Send("player/update", protocol.ClientState{State: "idle", Volume: 150})
+	conn.ExpectError(protocol.ErrorInvalidMessage)
+	conn.Send("client/time", map[string]any{"client_transmitted": "soon"})
+	conn.ExpectError(protocol.ErrorInvalidMessage)
+
+	// Clients don't send binary messages; they may be ignored
+	conn.SendBinary([]byte{0xFF})
+	expectAlive(t, conn)
+}
+
+func (s *serverSuite) testOutOfOrderMessages(t *testing.T) {
+	conn, _ := s.dial(t, PlayerHello("conformance-out-of-order"))
+
+	// A second hello is reported without ending the session
+	conn.Send("client/hello", PlayerHello("conformance-out-of-order"))
+	conn.ExpectError()
+	expectAlive(t, conn)
+
+	// client/error is never answered with server/error
+	conn.SendError(protocol.ErrorUnknownMessage, "conformance test")
+	conn.Send("client/time", protocol.ClientTime{ClientTransmitted: 1})
+	for {
+		frame := conn.Next()
+		if frame.Type == "server/error" {
+			t.Fatalf("expected client/error not to be answered, got %s", describe(frame))
+		}
+		if frame.Type == "server/time" {
+			break
+		}
+	}
+}
+
+func (s *serverSuite) testDisconnect(t *testing.T) {
+	hello := PlayerHello("conformance-disconnect")
+
+	conn, _ := s.dial(t, hello)
+	conn.Close()
+	s.reconnect(t, hello)
+
+	conn, _ = s.dial(t, hello)
+	conn.Drop()
+	s.reconnect(t, hello)
+}
+
+// reconnect connects again with a hello whose client just disconnected,
+// allowing the server a moment to notice
+func (s *serverSuite) reconnect(t *testing.T, hello protocol.ClientHello) {
+	t.Helper()
+	deadline := time.Now().Add(DefaultTimeout)
+	for {
+		conn := Dial(t, s.url, s.options.Header)
+		conn.Send("client/hello", hello)
+		frame := conn.Next()
+		if frame.Type == "server/hello" {
+			conn.Close()
+			return
+		}
+
+		var e protocol.Error
+		if frame.Type != "server/error" || protocol.DecodePayload(frame.Payload, &e) != nil || e.Code != protocol.ErrorDuplicateClient {
+			t.Fatalf("expected server/hello on reconnecting, got %s", describe(frame))
+		}
+		conn.Drop()
+		if time.Now().After(deadline) {
+			t.Fatal("server still considers the client connected")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
@@ -0,0 +1,422 @@
+// ABOUTME: Server side of a Sendspin Protocol WebSocket connection
+// ABOUTME: Handles client/hello, time sync replies, inbound message routing and outbound queueing
+package protocol
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// AudioChunkType marks binary messages carrying an audio chunk: the type
+// byte, an 8-byte big-endian timestamp (µs, server clock), then the audio
+const AudioChunkType = 1
+
+const (
+	helloTimeout  = 10 * time.Second
+	writeTimeout  = 10 * time.Second
+	pingInterval  = 30 * time.Second
+	sendQueueSize = 100
+)
+
+// ServerConfig describes the server to the clients it accepts
+type ServerConfig struct {
+	ServerID string
+	Name     string
+	Features []string // Optional features offered (default: SupportedFeatures)
+
+	// Commands lists the client/command commands the server handles;
+	// others are answered with unsupported_command
+	Commands []string
+
+	// Clock returns the server clock in microseconds, used to answer
+	// client/time and meant to match audio chunk timestamps
+	// (default: microseconds since the Unix epoch)
+	Clock func() int64
+}
+
+// ServerConn is the server's side of a connection to one client. Create it
+// with NewServerConn, which reads the client's hello, then Accept or Refuse
+// the client. Accepted connections answer client/time themselves and
+// deliver other client messages on the channels once validated.
+type ServerConn struct {
+	config ServerConfig
+	conn   *websocket.Conn
+
+	hello    ClientHello
+	version  int
+	features []string
+
+	// Inbound messages
+	PlayerUpdates chan ClientState   // player/update, from clients with the player role
+	Commands      chan ClientCommand // client/command, from clients with the controller role
+	Errors        chan Error         // client/error
+
+	sendChan  chan interface{} // Message or []byte, written in order
+	ctx       context.Context
+	cancel    context.CancelFunc
+	closeOnce sync.Once
+}
+
+// NewServerConn reads and validates client/hello from a newly opened
+// connection and negotiates the protocol version and features. Clients
+// whose hello is unusable are sent server/error and the connection is
+// closed.
+func NewServerConn(conn *websocket.Conn, config ServerConfig) (*ServerConn, error) {
+	if config.Features == nil {
+		config.Features = SupportedFeatures
+	}
+	if config.Clock == nil {
+		config.Clock = func() int64 { return time.Now().UnixMicro() }
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	sc := &ServerConn{
+		config:        config,
+		conn:          conn,
+		PlayerUpdates: make(chan ClientState, 10),
+		Commands:      make(chan ClientCommand, 10),
+		Errors:        make(chan Error, 10),
+		sendChan:      make(chan interface{}, sendQueueSize),
+		ctx:           ctx,
+		cancel:        cancel,
+	}
+
+	if err := sc.readHello(); err != nil {
+		return nil, sc.Refuse(err)
+	}
+	return sc, nil
+}
+
+// readHello reads client/hello and negotiates with the client
+func (sc *ServerConn) readHello() error {
+	sc.conn.SetReadDeadline(time.Now().Add(helloTimeout))
+	_, data, err := sc.conn.ReadMessage()
+	if err != nil {
+		return fmt.Errorf("failed to read hello: %w", err)
+	}
+	sc.conn.SetReadDeadline(time.Time{})
+
+	var msg Message
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return fmt.Errorf("malformed JSON: %w", err)
+	}
+	if msg.Type != "client/hello" {
+		return fmt.Errorf("expected client/hello, got %s", msg.Type)
+	}
+	if err := DecodePayload(msg.Payload, &sc.hello); err != nil {
+		return fmt.Errorf("invalid client/hello: %w", err)
+	}
+
+	sc.version, err = NegotiateVersion(sc.hello.Version)
+	if err != nil {
+		return err
+	}
+	sc.features = NegotiateFeatures(sc.config.Features, sc.hello.Features)
+	return nil
+}
+
+// Accept answers the client with server/hello and starts exchanging
+// messages. Messages sent before Accept follow the hello.
+func (sc *ServerConn) Accept() error {
+	hello := Message{
+		Type: "server/hello",
+		Payload: ServerHello{
+			ServerID: sc.config.ServerID,
+			Name:     sc.config.Name,
+			Version:  sc.version,
+			Features: sc.features,
+		},
+	}
+	sc.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	if err := sc.conn.WriteJSON(hello); err != nil {
+		sc.Close()
+		return fmt.Errorf("failed to send server/hello: %w", err)
+	}
+
+	go sc.writeMessages()
+	go sc.readMessages()
+	return nil
+}
+
+// Refuse tells the client why it is being turned away with server/error,
+// closes the connection and returns err. Errors other than *Error are
+// sent as invalid_message.
+func (sc *ServerConn) Refuse(err error) error {
+	var reason *Error
+	if !errors.As(err, &reason) {
+		reason = Errorf(ErrorInvalidMessage, "%v", err)
+	}
+	sc.conn.SetWriteDeadline(time.Now().Add(time.Second))
+	sc.conn.WriteJSON(Message{Type: "server/error", Payload: reason})
+	sc.Close()
+	return err
+}
+
+// Hello returns the client's hello
+func (sc *ServerConn) Hello() ClientHello {
+	return sc.hello
+}
+
+// Version returns the protocol version negotiated with the client
+func (sc *ServerConn) Version() int {
+	return sc.version
+}
+
+// Features returns the optional features both the server and the client
+// support
+func (sc *ServerConn) Features() []string {
+	return sc.features
+}
+
+// HasFeature reports whether both sides support an optional feature
+func (sc *ServerConn) HasFeature(feature string) bool {
+	return slices.Contains(sc.features, feature)
+}
+
+// HasRole reports whether the client claimed a role in its hello
+func (sc *ServerConn) HasRole(role string) bool {
+	return slices.Contains(sc.hello.SupportedRoles, role)
+}
+
+// RemoteAddr returns the client's network address
+func (sc *ServerConn) RemoteAddr() net.Addr {
+	return sc.conn.RemoteAddr()
+}
+
+// Send queues a JSON message for the client. It fails rather than block
+// when the client is not keeping up.
+func (sc *ServerConn) Send(msgType string, payload interface{}) error {
+	return sc.enqueue(Message{Type: msgType, Payload: payload})
+}
+
+// SendStreamStart sends stream/start
+func (sc *ServerConn) SendStreamStart(start StreamStart) error {
+	return sc.Send("stream/start", start)
+}
+
+// SendStreamEnd sends stream/end
+func (sc *ServerConn) SendStreamEnd(end StreamEnd) error {
+	return sc.Send("stream/end", end)
+}
+
+// SendStreamClear sends stream/clear
+func (sc *ServerConn) SendStreamClear(clear StreamClear) error {
+	return sc.Send("stream/clear", clear)
+}
+
+// SendMetadata sends stream/metadata
+func (sc *ServerConn) SendMetadata(meta StreamMetadata) error {
+	return sc.Send("stream/metadata", meta)
+}
+
+// SendSessionUpdate sends session/update
+func (sc *ServerConn) SendSessionUpdate(update SessionUpdate) error {
+	return sc.Send("session/update", update)
+}
+
+// SendCommand sends a server/command to a player
+func (sc *ServerConn) SendCommand(cmd ServerCommand) error {
+	return sc.Send("server/command", cmd)
+}
+
+// SendError sends a server/error reporting a problem to the client
+func (sc *ServerConn) SendError(code, reason string) error {
+	return sc.Send("server/error", Error{Code: code, Reason: reason})
+}
+
+// SendAudioChunk sends encoded audio to play at timestamp (µs, server clock)
+func (sc *ServerConn) SendAudioChunk(timestamp int64, data []byte) error {
+	chunk := make([]byte, 1+8+len(data))
+	chunk[0] = AudioChunkType
+	binary.BigEndian.PutUint64(chunk[1:9], uint64(timestamp))
+	copy(chunk[9:], data)
+	return sc.enqueue(chunk)
+}
+
+// enqueue adds a message to the send queue without blocking
+func (sc *ServerConn) enqueue(v interface{}) error {
+	select {
+	case <-sc.ctx.Done():
+		return fmt.Errorf("connection closed")
+	default:
+	}
+	select {
+	case sc.sendChan <- v:
+		return nil
+	default:
+		return fmt.Errorf("client send buffer full")
+	}
+}
+
+// CloseGoingAway tells the client the server is going away, then closes
+// the connection
+func (sc *ServerConn) CloseGoingAway(reason string) {
+	msg := websocket.FormatCloseMessage(websocket.CloseGoingAway, reason)
+	sc.conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+	sc.Close()
+}
+
+// Close closes the connection; queued messages are dropped
+func (sc *ServerConn) Close() {
+	sc.closeOnce.Do(func() {
+		sc.cancel()
+		sc.conn.Close()
+	})
+}
+
+// Done returns a channel that is closed when the connection closes
+func (sc *ServerConn) Done() <-chan struct{} {
+	return sc.ctx.Done()
+}
+
+// writeMessages writes queued messages in order and keeps the connection
+// alive with pings
+func (sc *ServerConn) writeMessages() {
+	defer sc.Close()
+
+	ticker := time.NewTicker(pingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case v := <-sc.sendChan:
+			kind := websocket.TextMessage
+			data, ok := v.([]byte)
+			if ok {
+				kind = websocket.BinaryMessage
+			} else {
+				var err error
+				if data, err = json.Marshal(v); err != nil {
+					log.Printf("Failed to encode message: %v", err)
+					continue
+				}
+			}
+			sc.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+			if err := sc.conn.WriteMessage(kind, data); err != nil {
+				return
+			}
+
+		case <-ticker.C:
+			if err := sc.conn.WriteControl(websocket.PingMessage, []byte{}, time.Now().Add(writeTimeout)); err != nil {
+				return
+			}
+
+		case <-sc.ctx.Done():
+			return
+		}
+	}
+}
+
+// readMessages reads client messages until the connection closes
+func (sc *ServerConn) readMessages() {
+	defer sc.Close()
+
+	for {
+		kind, data, err := sc.conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
+				log.Printf("WebSocket error: %v", err)
+			}
+			return
+		}
+		received := sc.config.Clock()
+
+		if kind == websocket.TextMessage {
+			sc.handleMessage(data, received)
+		}
+	}
+}
+
+// handleMessage answers client/time and routes other messages to their
+// channels. Invalid payloads, messages the client's roles don't allow and
+// unknown message types are answered with server/error.
+func (sc *ServerConn) handleMessage(data []byte, received int64) {
+	var msg Message
+	if err := json.Unmarshal(data, &msg); err != nil {
+		log.Printf("Failed to parse JSON message from %s: %v", sc.hello.Name, err)
+		sc.SendError(ErrorInvalidMessage, "malformed JSON: "+err.Error())
+		return
+	}
+
+	switch msg.Type {
+	case "client/time":
+		var clientTime ClientTime
+		if !sc.decode(msg, &clientTime) {
+			return
+		}
+		sc.Send("server/time", ServerTime{
+			ClientTransmitted: clientTime.ClientTransmitted,
+			ServerReceived:    received,
+			ServerTransmitted: sc.config.Clock(),
+		})
+
+	case "player/update":
+		if !sc.HasRole("player") {
+			sc.SendError(ErrorNotPermitted, "player/update requires the player role")
+			return
+		}
+		var state ClientState
+		if !sc.decode(msg, &state) {
+			return
+		}
+		select {
+		case sc.PlayerUpdates <- state:
+		case <-sc.ctx.Done():
+		}
+
+	case "client/command":
+		if !sc.HasRole("controller") {
+			log.Printf("Ignoring command from %s: not a controller", sc.hello.Name)
+			sc.SendError(ErrorNotPermitted, "client/command requires the controller role")
+			return
+		}
+		var cmd ClientCommand
+		if !sc.decode(msg, &cmd) {
+			return
+		}
+		if !slices.Contains(sc.config.Commands, cmd.Command) {
+			sc.SendError(ErrorUnsupportedCommand, fmt.Sprintf("command %q is not supported", cmd.Command))
+			return
+		}
+		select {
+		case sc.Commands <- cmd:
+		case <-sc.ctx.Done():
+		}
+
+	case "client/error":
+		// Never answered with an error, so two peers can't trade them forever
+		var clientErr Error
+		if err := DecodePayload(msg.Payload, &clientErr); err != nil {
+			log.Printf("Invalid client/error from %s: %v", sc.hello.Name, err)
+			return
+		}
+		select {
+		case sc.Errors <- clientErr:
+		default:
+		}
+
+	default:
+		sc.SendError(ErrorUnknownMessage, fmt.Sprintf("message type %q is not supported", msg.Type))
+	}
+}
+
+// decode decodes and validates a message's payload, answering the client
+// with server/error when it is invalid
+func (sc *ServerConn) decode(msg Message, v any) bool {
+	if err := DecodePayload(msg.Payload, v); err != nil {
+		log.Printf("Invalid %s from %s: %v", msg.Type, sc.hello.Name, err)
+		sc.SendError(ErrorInvalidMessage, fmt.Sprintf("%s: %v", msg.Type, err))
+		return false
+	}
+	return true
+}
@@ -0,0 +1,220 @@
+// ABOUTME: Tests for the server side of a protocol connection
+// ABOUTME: Runs the Client against ServerConn for the handshake, routing and sending
+package protocol
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// serveConns runs a server accepting clients with config, passing each
+// handshake's outcome to the returned channels
+func serveConns(t *testing.T, config ServerConfig) (string, chan *ServerConn, chan error) {
+	t.Helper()
+	conns := make(chan *ServerConn, 1)
+	errs := make(chan error, 1)
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		sc, err := NewServerConn(conn, config)
+		if err != nil {
+			errs <- err
+			return
+		}
+		if err := sc.Accept(); err != nil {
+			errs <- err
+			return
+		}
+		conns <- sc
+	}))
+	t.Cleanup(srv.Close)
+	return strings.TrimPrefix(srv.URL, "http://"), conns, errs
+}
+
+func TestServerConnSession(t *testing.T) {
+	addr, conns, _ := serveConns(t, ServerConfig{
+		ServerID: "srv-1",
+		Name:     "Test Server",
+		Commands: []string{"next"},
+		Clock:    func() int64 { return 42 },
+	})
+
+	client := NewClient(Config{
+		ServerAddr:    addr,
+		ClientID:      "player-1",
+		Name:          "Kitchen",
+		Volume:        35,
+		PlayerSupport: PlayerSupport{SupportedCommands: []string{"volume"}},
+	})
+	if err := client.Connect(); err != nil {
+		t.Fatalf("connect failed: %v", err)
+	}
+	defer client.Close()
+
+	var sc *ServerConn
+	select {
+	case sc = <-conns:
+	case <-time.After(3 * time.Second):
+		t.Fatal("server did not accept the client")
+	}
+	defer sc.Close()
+
+	if got := client.Server(); got.ServerID != "srv-1" || got.Name != "Test Server" || got.Version != Version {
+		t.Errorf("unexpected server/hello %+v", got)
+	}
+	if hello := sc.Hello(); hello.ClientID != "player-1" || !sc.HasRole("player") || sc.HasRole("controller") {
+		t.Errorf("unexpected client/hello %+v", hello)
+	}
+	if len(sc.Features()) != len(SupportedFeatures) || !client.HasFeature(FeatureErrors) {
+		t.Errorf("expected all features negotiated, got %v and %v", sc.Features(), client.Features())
+	}
+
+	// The initial player/update arrives on PlayerUpdates
+	select {
+	case state := <-sc.PlayerUpdates:
+		if state.State != "idle" || state.Volume != 35 {
+			t.Errorf("unexpected initial state %+v", state)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("player/update was not delivered")
+	}
+
+	// client/time is answered with the server clock
+	if err := client.SendTimeSync(7); err != nil {
+		t.Fatalf("failed to send client/time: %v", err)
+	}
+	select {
+	case reply := <-client.TimeSyncResp:
+		if reply.ClientTransmitted != 7 || reply.ServerReceived != 42 || reply.ServerTransmitted != 42 {
+			t.Errorf("unexpected server/time %+v", reply)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("client/time was not answered")
+	}
+
+	// Typed sends reach the client in order
+	start := StreamStart{Player: &StreamStartPlayer{Codec: "pcm", SampleRate: 48000, Channels: 2, BitDepth: 24}}
+	if err := sc.SendStreamStart(start); err != nil {
+		t.Fatalf("SendStreamStart failed: %v", err)
+	}
+	if err := sc.SendAudioChunk(123456, []byte{1, 2, 3}); err != nil {
+		t.Fatalf("SendAudioChunk failed: %v", err)
+	}
+	if err := sc.SendCommand(ServerCommand{Command: "volume", Volume: 20}); err != nil {
+		t.Fatalf("SendCommand failed: %v", err)
+	}
+	if err := sc.SendMetadata(StreamMetadata{Title: "Song"}); err != nil {
+		t.Fatalf("SendMetadata failed: %v", err)
+	}
+
+	if got, ok := (<-client.StreamEvents).(StreamStart); !ok || got.Player == nil || got.Player.Codec != "pcm" {
+		t.Errorf("unexpected stream/start %+v", got)
+	}
+	if got := <-client.AudioChunks; got.Timestamp != 123456 || string(got.Data) != "\x01\x02\x03" || got.Generation != 1 {
+		t.Errorf("unexpected audio chunk %+v", got)
+	}
+	if got := <-client.ControlMsgs; got.Command != "volume" || got.Volume != 20 {
+		t.Errorf("unexpected server/command %+v", got)
+	}
+	if got := <-client.Metadata; got.Title != "Song" {
+		t.Errorf("unexpected stream/metadata %+v", got)
+	}
+
+	// Commands need the controller role, and are reported to the client
+	if err := client.SendCommand(ClientCommand{Command: "next"}); err != nil {
+		t.Fatalf("failed to send client/command: %v", err)
+	}
+	select {
+	case got := <-client.Errors:
+		if got.Code != ErrorNotPermitted {
+			t.Errorf("expected %s, got %s", ErrorNotPermitted, got.Code)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("server/error was not delivered")
+	}
+	if len(sc.Commands) != 0 {
+		t.Error("expected the command not to be delivered")
+	}
+
+	// Closing the server side ends the client's session
+	sc.Close()
+	select {
+	case <-client.Done():
+	case <-time.After(3 * time.Second):
+		t.Fatal("client did not notice the connection closing")
+	}
+	if err := sc.Send("stream/end", StreamEnd{}); err == nil {
+		t.Error("expected sending on a closed connection to fail")
+	}
+}
+
+func TestServerConnCommands(t *testing.T) {
+	addr, conns, _ := serveConns(t, ServerConfig{ServerID: "srv", Commands: []string{"next"}})
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws://"+addr+"/sendspin", nil)
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	defer conn.Close()
+	conn.WriteJSON(Message{Type: "client/hello", Payload: ClientHello{
+		ClientID: "remote", Name: "Remote", Version: Version, SupportedRoles: []string{"controller"},
+	}})
+	readType(t, conn, "server/hello")
+	sc := <-conns
+	defer sc.Close()
+
+	conn.WriteJSON(Message{Type: "client/command", Payload: ClientCommand{Command: "shuffle"}})
+	var e Error
+	DecodePayload(readType(t, conn, "server/error").Payload, &e)
+	if e.Code != ErrorUnsupportedCommand {
+		t.Errorf("expected %s, got %s", ErrorUnsupportedCommand, e.Code)
+	}
+
+	conn.WriteJSON(Message{Type: "client/command", Payload: ClientCommand{Command: "next"}})
+	select {
+	case cmd := <-sc.Commands:
+		if cmd.Command != "next" {
+			t.Errorf("expected next, got %s", cmd.Command)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("client/command was not delivered")
+	}
+
+	conn.WriteJSON(Message{Type: "client/error", Payload: Error{Code: ErrorUnknownMessage, Reason: "?"}})
+	select {
+	case got := <-sc.Errors:
+		if got.Code != ErrorUnknownMessage {
+			t.Errorf("expected %s, got %s", ErrorUnknownMessage, got.Code)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("client/error was not delivered")
+	}
+}
+
+func TestServerConnRefusesBadHello(t *testing.T) {
+	addr, _, errs := serveConns(t, ServerConfig{ServerID: "srv"})
+
+	client := NewClient(Config{ServerAddr: addr, ClientID: "c1"}) // No name
+	err := client.Connect()
+	var refusal *Error
+	if !errors.As(err, &refusal) || refusal.Code != ErrorInvalidMessage || !strings.Contains(refusal.Reason, "name is required") {
+		t.Fatalf("expected an invalid_message refusal naming the field, got %v", err)
+	}
+	select {
+	case err := <-errs:
+		if !strings.Contains(err.Error(), "name is required") {
+			t.Errorf("unexpected server error %v", err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("NewServerConn did not fail")
+	}
+}
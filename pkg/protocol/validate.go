@@ -0,0 +1,194 @@
+// ABOUTME: Validation of protocol message payloads
+// ABOUTME: Checks required fields, value ranges and role consistency, ignoring unknown fields
+package protocol
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// validator is implemented by payloads with rules beyond their JSON shape
+type validator interface {
+	Validate() error
+}
+
+// DecodePayload decodes a message payload into v, a pointer to a payload
+// struct, and validates it. Unknown fields are ignored so newer peers can
+// add them.
+func DecodePayload(payload interface{}, v any) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode payload: %w", err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("failed to decode payload: %w", err)
+	}
+	if val, ok := v.(validator); ok {
+		return val.Validate()
+	}
+	return nil
+}
+
+// Validate checks the hello's required fields, and that each *_support
+// object belongs to a role the client claims. Unknown roles are allowed.
+// The version is checked by NegotiateVersion.
+func (h ClientHello) Validate() error {
+	var errs []error
+	if h.ClientID == "" {
+		errs = append(errs, errors.New("client_id is required"))
+	}
+	if h.Name == "" {
+		errs = append(errs, errors.New("name is required"))
+	}
+	if len(h.SupportedRoles) == 0 {
+		errs = append(errs, errors.New("supported_roles must list at least one role"))
+	}
+	for i, role := range h.SupportedRoles {
+		if slices.Contains(h.SupportedRoles[:i], role) {
+			errs = append(errs, fmt.Errorf("role %q listed twice", role))
+		}
+	}
+
+	supports := []struct {
+		field string
+		role  string
+		set   bool
+	}{
+		{"player_support", "player", h.PlayerSupport != nil},
+		{"metadata_support", "metadata", h.MetadataSupport != nil},
+		{"visualizer_support", "visualizer", h.VisualizerSupport != nil},
+	}
+	for _, s := range supports {
+		if s.set && !slices.Contains(h.SupportedRoles, s.role) {
+			errs = append(errs, fmt.Errorf("%s given without the %s role", s.field, s.role))
+		}
+	}
+	if h.PlayerSupport != nil {
+		if err := h.PlayerSupport.Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("player_support: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Validate checks the advertised formats
+func (s PlayerSupport) Validate() error {
+	if s.BufferCapacity < 0 {
+		return fmt.Errorf("buffer_capacity must not be negative, got %d", s.BufferCapacity)
+	}
+	for i, f := range s.SupportFormats {
+		if err := validateFormat(f.Codec, f.SampleRate, f.Channels, f.BitDepth); err != nil {
+			return fmt.Errorf("support_formats[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// Validate checks the server identified itself and chose a version
+func (h ServerHello) Validate() error {
+	if h.ServerID == "" {
+		return errors.New("server_id is required")
+	}
+	if h.Version < 1 {
+		return fmt.Errorf("version must be positive, got %d", h.Version)
+	}
+	return nil
+}
+
+// Validate checks the state is given and the volume is a percentage.
+// States other than playing, paused and idle are allowed for newer peers.
+func (s ClientState) Validate() error {
+	if s.State == "" {
+		return errors.New("state is required")
+	}
+	if s.Volume < 0 || s.Volume > 100 {
+		return fmt.Errorf("volume must be between 0 and 100, got %d", s.Volume)
+	}
+	return nil
+}
+
+// Validate checks the command is named and its arguments are in range
+func (c ServerCommand) Validate() error {
+	switch c.Command {
+	case "":
+		return errors.New("command is required")
+	case "volume":
+		if c.Volume < 0 || c.Volume > 100 {
+			return fmt.Errorf("volume must be between 0 and 100, got %d", c.Volume)
+		}
+	case "dsp":
+		if c.DSP == nil {
+			return nil
+		}
+		for i, f := range c.DSP.Filters {
+			if f.Type == "" {
+				return fmt.Errorf("dsp filters[%d]: type is required", i)
+			}
+			if f.Frequency <= 0 {
+				return fmt.Errorf("dsp filters[%d]: frequency must be positive, got %g", i, f.Frequency)
+			}
+			if f.Q < 0 {
+				return fmt.Errorf("dsp filters[%d]: q must not be negative, got %g", i, f.Q)
+			}
+		}
+	}
+	return nil
+}
+
+// Validate checks the command is named and a seek position is not negative
+func (c ClientCommand) Validate() error {
+	if c.Command == "" {
+		return errors.New("command is required")
+	}
+	if c.Command == "seek" && c.Position < 0 {
+		return fmt.Errorf("position must not be negative, got %d", c.Position)
+	}
+	return nil
+}
+
+// Validate checks the player format, when there is one, can be played
+func (s StreamStart) Validate() error {
+	if s.Player == nil {
+		return nil
+	}
+	p := s.Player
+	if err := validateFormat(p.Codec, p.SampleRate, p.Channels, p.BitDepth); err != nil {
+		return fmt.Errorf("player: %w", err)
+	}
+	for i, row := range p.ChannelMatrix {
+		if len(row) == 0 {
+			return fmt.Errorf("player: channel_matrix row %d is empty", i)
+		}
+	}
+	if len(p.ChannelMatrix) > 0 && len(p.ChannelMatrix) != p.Channels {
+		return fmt.Errorf("player: channel_matrix has %d rows for %d channels", len(p.ChannelMatrix), p.Channels)
+	}
+	return nil
+}
+
+// Validate checks an error carries a code
+func (e Error) Validate() error {
+	if e.Code == "" {
+		return errors.New("code is required")
+	}
+	return nil
+}
+
+// validateFormat checks an audio format's fields are set and positive
+func validateFormat(codec string, sampleRate, channels, bitDepth int) error {
+	if codec == "" {
+		return errors.New("codec is required")
+	}
+	if sampleRate <= 0 {
+		return fmt.Errorf("sample_rate must be positive, got %d", sampleRate)
+	}
+	if channels <= 0 {
+		return fmt.Errorf("channels must be positive, got %d", channels)
+	}
+	if bitDepth <= 0 {
+		return fmt.Errorf("bit_depth must be positive, got %d", bitDepth)
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+// ABOUTME: Tests for protocol payload validation
+// ABOUTME: Covers required fields, ranges, role consistency and unknown fields
+package protocol
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestClientHelloValidate(t *testing.T) {
+	valid := ClientHello{
+		ClientID:       "c1",
+		Name:           "Kitchen",
+		Version:        1,
+		SupportedRoles: []string{"player", "metadata"},
+		PlayerSupport: &PlayerSupport{SupportFormats: []AudioFormat{
+			{Codec: "pcm", Channels: 2, SampleRate: 48000, BitDepth: 16},
+		}},
+		MetadataSupport: &MetadataSupport{},
+	}
+	if err := valid.Validate(); err != nil {
+		t.Fatalf("expected valid hello, got %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(h *ClientHello)
+		want   string
+	}{
+		{"missing client ID", func(h *ClientHello) { h.ClientID = "" }, "client_id is required"},
+		{"missing name", func(h *ClientHello) { h.Name = "" }, "name is required"},
+		{"no roles", func(h *ClientHello) { h.SupportedRoles = nil; h.PlayerSupport = nil; h.MetadataSupport = nil }, "at least one role"},
+		{"duplicate role", func(h *ClientHello) { h.SupportedRoles = append(h.SupportedRoles, "player") }, `role "player" listed twice`},
+		{"support without role", func(h *ClientHello) { h.VisualizerSupport = &VisualizerSupport{} }, "visualizer_support given without the visualizer role"},
+		{"bad format", func(h *ClientHello) { h.PlayerSupport.SupportFormats[0].SampleRate = 0 }, "support_formats[0]: sample_rate must be positive"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := valid
+			h.SupportedRoles = append([]string(nil), valid.SupportedRoles...)
+			h.PlayerSupport = &PlayerSupport{SupportFormats: append([]AudioFormat(nil), valid.PlayerSupport.SupportFormats...)}
+			tt.modify(&h)
+			err := h.Validate()
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+
+	unknownRole := valid
+	unknownRole.SupportedRoles = []string{"player", "metadata", "hologram"}
+	if err := unknownRole.Validate(); err != nil {
+		t.Errorf("expected unknown roles to be allowed, got %v", err)
+	}
+}
+
+func TestPayloadValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload validator
+		want    string // Empty if valid
+	}{
+		{"server hello", ServerHello{ServerID: "s", Version: 1}, ""},
+		{"server hello without ID", ServerHello{Version: 1}, "server_id is required"},
+		{"server hello without version", ServerHello{ServerID: "s"}, "version must be positive"},
+		{"state", ClientState{State: "playing", Volume: 100}, ""},
+		{"newer state", ClientState{State: "synchronized", Volume: 50}, ""},
+		{"state missing", ClientState{Volume: 50}, "state is required"},
+		{"volume out of range", ClientState{State: "idle", Volume: 101}, "volume must be between 0 and 100"},
+		{"command", ServerCommand{Command: "mute", Mute: true}, ""},
+		{"command missing", ServerCommand{}, "command is required"},
+		{"command volume", ServerCommand{Command: "volume", Volume: -1}, "volume must be between 0 and 100"},
+		{"dsp off", ServerCommand{Command: "dsp"}, ""},
+		{"dsp filter", ServerCommand{Command: "dsp", DSP: &DSPSettings{Filters: []DSPFilter{{Type: "peaking"}}}}, "frequency must be positive"},
+		{"seek", ClientCommand{Command: "seek", Position: 1000}, ""},
+		{"seek negative", ClientCommand{Command: "seek", Position: -1}, "position must not be negative"},
+		{"stream start for metadata", StreamStart{}, ""},
+		{"stream start", StreamStart{Player: &StreamStartPlayer{Codec: "flac", SampleRate: 44100, Channels: 2, BitDepth: 16}}, ""},
+		{"stream start without codec", StreamStart{Player: &StreamStartPlayer{SampleRate: 44100, Channels: 2, BitDepth: 16}}, "codec is required"},
+		{"stream start matrix", StreamStart{Player: &StreamStartPlayer{
+			Codec: "pcm", SampleRate: 48000, Channels: 2, BitDepth: 16,
+			ChannelMatrix: [][]float64{{1, 0}},
+		}}, "channel_matrix has 1 rows for 2 channels"},
+		{"error", Error{Code: ErrorUnknownMessage}, ""},
+		{"error without code", Error{Reason: "?"}, "code is required"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.payload.Validate()
+			if tt.want == "" {
+				if err != nil {
+					t.Errorf("expected valid, got %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestDecodePayload(t *testing.T) {
+	// Payloads arrive as decoded JSON; unknown fields are ignored
+	payload := map[string]any{"state": "idle", "volume": 40.0, "muted": true, "added_later": "x"}
+	var state ClientState
+	if err := DecodePayload(payload, &state); err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	if state.State != "idle" || state.Volume != 40 || !state.Muted {
+		t.Errorf("unexpected state %+v", state)
+	}
+
+	if err := DecodePayload(map[string]any{"state": "idle", "volume": "loud"}, &state); err == nil {
+		t.Error("expected a wrongly typed field to fail")
+	}
+	if err := DecodePayload(map[string]any{"volume": 40.0}, &ClientState{}); err == nil {
+		t.Error("expected a missing required field to fail")
+	}
+	if err := DecodePayload(nil, &ClientTime{}); err != nil {
+		t.Errorf("expected payloads without rules to decode, got %v", err)
+	}
+}
@@ -0,0 +1,47 @@
+// ABOUTME: Protocol version and feature negotiation
+// ABOUTME: Picks the version and optional features both peers speak from their hellos
+package protocol
+
+import "slices"
+
+const (
+	// Version is the newest protocol version this package speaks; hellos
+	// offer it and the server answers with the version chosen
+	Version = 1
+
+	// MinVersion is the oldest protocol version this package still speaks
+	MinVersion = 1
+)
+
+// Optional features announced in hellos. A peer only relies on a feature
+// the other side announced too; unknown features are ignored.
+const (
+	FeatureStreamClear    = "stream_clear"    // stream/clear and stream/end
+	FeatureProgress       = "progress"        // Progress anchors in session/update
+	FeatureChannelMapping = "channel_mapping" // Channel roles and matrices in stream/start
+	FeatureErrors         = "errors"          // server/error and client/error
+)
+
+// SupportedFeatures lists the optional features this package implements
+var SupportedFeatures = []string{FeatureStreamClear, FeatureProgress, FeatureChannelMapping, FeatureErrors}
+
+// NegotiateVersion picks the version to speak with a client offering
+// versions up to offered: the newest both sides know. It fails with an
+// ErrorUnsupportedVersion error when the client is too old.
+func NegotiateVersion(offered int) (int, error) {
+	if offered < MinVersion {
+		return 0, Errorf(ErrorUnsupportedVersion, "protocol version %d is not supported (need %d to %d)", offered, MinVersion, Version)
+	}
+	return min(offered, Version), nil
+}
+
+// NegotiateFeatures returns the features in ours that theirs has too
+func NegotiateFeatures(ours, theirs []string) []string {
+	common := []string{}
+	for _, f := range ours {
+		if slices.Contains(theirs, f) && !slices.Contains(common, f) {
+			common = append(common, f)
+		}
+	}
+	return common
+}
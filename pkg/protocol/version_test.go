@@ -0,0 +1,37 @@
+// ABOUTME: Tests for protocol version and feature negotiation
+// ABOUTME: Verifies the newest common version and the shared features are chosen
+package protocol
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestNegotiateVersion(t *testing.T) {
+	if v, err := NegotiateVersion(Version); err != nil || v != Version {
+		t.Errorf("expected version %d, got %d (%v)", Version, v, err)
+	}
+	if v, err := NegotiateVersion(Version + 3); err != nil || v != Version {
+		t.Errorf("expected a newer client to get version %d, got %d (%v)", Version, v, err)
+	}
+
+	_, err := NegotiateVersion(MinVersion - 1)
+	var versionErr *Error
+	if !errors.As(err, &versionErr) || versionErr.Code != ErrorUnsupportedVersion {
+		t.Errorf("expected %s for version %d, got %v", ErrorUnsupportedVersion, MinVersion-1, err)
+	}
+}
+
+func TestNegotiateFeatures(t *testing.T) {
+	got := NegotiateFeatures(
+		[]string{FeatureStreamClear, FeatureErrors, FeatureProgress},
+		[]string{"from_the_future", FeatureProgress, FeatureErrors, FeatureErrors},
+	)
+	if want := []string{FeatureErrors, FeatureProgress}; !slices.Equal(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+	if got := NegotiateFeatures(SupportedFeatures, nil); len(got) != 0 {
+		t.Errorf("expected no features with a peer that announces none, got %v", got)
+	}
+}
@@ -0,0 +1,171 @@
+// ABOUTME: Server-initiated connections to players
+// ABOUTME: Dials players that host a WebSocket endpoint, by address or found via mDNS
+package sendspin
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/Sendspin/sendspin-go/pkg/discovery"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// adoptRetry is how long the server waits before reconnecting to a
+	// player that is still advertised after its connection ended
+	adoptRetry = 2 * time.Second
+
+	// adoptBackoff is how long the server waits before trying again to
+	// connect to a player that could not be reached or was busy
+	adoptBackoff = 30 * time.Second
+)
+
+// AdoptPolicy decides whether the server connects to a player it found
+// advertising _sendspin._tcp. It sees the player's name, ID (the id TXT
+// field, which players set to their client ID) and TXT record.
+type AdoptPolicy func(player discovery.ServerInfo) bool
+
+// AdoptAll connects to every advertising player
+func AdoptAll(discovery.ServerInfo) bool {
+	return true
+}
+
+// AdoptNamed connects to the players with one of the given names or IDs
+func AdoptNamed(names ...string) AdoptPolicy {
+	return func(player discovery.ServerInfo) bool {
+		return slices.Contains(names, player.Name) || slices.Contains(names, player.ID)
+	}
+}
+
+// ConnectPlayer connects to a player hosting a WebSocket endpoint (see
+// Player.Listen), given as a ws:// URL or host:port. The handshake runs as
+// if the player had connected to the server, and the session continues in
+// the background once it succeeds.
+func (s *Server) ConnectPlayer(addr string) error {
+	target, err := playerURL(addr)
+	if err != nil {
+		return err
+	}
+	c, err := s.dialPlayer(target)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		defer c.conn.Close()
+		s.serveClient(c)
+	}()
+	return nil
+}
+
+// dialPlayer opens a connection to a player and performs the handshake
+func (s *Server) dialPlayer(target string) (*client, error) {
+	dialer := websocket.Dialer{HandshakeTimeout: 5 * time.Second}
+	conn, _, err := dialer.Dial(target, authHeader(s.config.AuthToken))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to player at %s: %w", target, err)
+	}
+
+	c, err := s.handshake(conn)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("handshake with player at %s failed: %w", target, err)
+	}
+	log.Printf("Connected to player %s at %s", c.Name, target)
+	return c, nil
+}
+
+// playerURL turns host:port into the player's WebSocket URL
+func playerURL(addr string) (string, error) {
+	if u, err := url.Parse(addr); err == nil && (u.Scheme == "ws" || u.Scheme == "wss") {
+		return addr, nil
+	}
+	if addr == "" {
+		return "", fmt.Errorf("player address is empty")
+	}
+	return (&url.URL{Scheme: "ws", Host: addr, Path: discovery.DefaultPath}).String(), nil
+}
+
+// adoptPlayers connects to players found by mDNS that the adopt policy
+// accepts, and reconnects while they stay advertised
+func (s *Server) adoptPlayers(events <-chan discovery.Event) {
+	// Players with a session in progress or pending, by discovered ID
+	active := make(map[string]bool)
+	type result struct {
+		id        string
+		connected bool
+	}
+	ended := make(chan result)
+
+	start := func(player discovery.ServerInfo, delay time.Duration) {
+		active[player.ID] = true
+		go func() {
+			select {
+			case <-time.After(delay):
+			case <-s.stopChan:
+				return
+			}
+			connected := s.adopt(player)
+			select {
+			case ended <- result{player.ID, connected}:
+			case <-s.stopChan:
+			}
+		}()
+	}
+
+	for {
+		select {
+		case event := <-events:
+			player := event.Server
+			if event.Type == discovery.ServerRemoved || active[player.ID] || !s.config.Adopt(player) {
+				continue
+			}
+			start(player, 0)
+
+		case r := <-ended:
+			delete(active, r.id)
+
+			// The player is still around: reconnect if the connection
+			// dropped, or try again later if it was busy or unreachable
+			if player, ok := s.mdnsManager.Server(r.id); ok {
+				delay := adoptBackoff
+				if r.connected {
+					delay = adoptRetry
+				}
+				start(player, delay)
+			}
+
+		case <-s.stopChan:
+			return
+		}
+	}
+}
+
+// adopt connects to a discovered player and returns when its session
+// ends, reporting whether there was one. Players already connected (in
+// either direction) are left alone.
+func (s *Server) adopt(player discovery.ServerInfo) bool {
+	if s.isConnected(player.ID) {
+		return false
+	}
+
+	c, err := s.dialPlayer(player.URL())
+	if err != nil {
+		log.Printf("Failed to adopt player %s: %v", player.Name, err)
+		return false
+	}
+	defer c.conn.Close()
+	s.serveClient(c)
+	return true
+}
+
+// isConnected reports whether a client with the ID is connected
+func (s *Server) isConnected(id string) bool {
+	s.clientsMu.RLock()
+	defer s.clientsMu.RUnlock()
+	_, ok := s.clients[id]
+	return ok
+}
@@ -0,0 +1,135 @@
+// ABOUTME: Tests for server-initiated connections
+// ABOUTME: Covers adopt policies, player URLs, and a server dialing a listening player
+package sendspin
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Sendspin/sendspin-go/pkg/audio/output"
+	"github.com/Sendspin/sendspin-go/pkg/discovery"
+)
+
+func TestAdoptPolicies(t *testing.T) {
+	kitchen := discovery.ServerInfo{ID: "id-kitchen", Name: "Kitchen"}
+	den := discovery.ServerInfo{ID: "id-den", Name: "Den"}
+
+	if !AdoptAll(kitchen) {
+		t.Error("AdoptAll should accept every player")
+	}
+
+	policy := AdoptNamed("Kitchen", "id-office")
+	if !policy(kitchen) {
+		t.Error("expected player adopted by name")
+	}
+	if !policy(discovery.ServerInfo{ID: "id-office", Name: "Office Speaker"}) {
+		t.Error("expected player adopted by ID")
+	}
+	if policy(den) {
+		t.Error("expected unlisted player to be left alone")
+	}
+}
+
+func TestPlayerURL(t *testing.T) {
+	tests := []struct {
+		addr string
+		want string
+	}{
+		{"192.168.1.20:8927", "ws://192.168.1.20:8927/sendspin"},
+		{"[fd00::20]:8927", "ws://[fd00::20]:8927/sendspin"},
+		{"ws://speaker.local:9000/custom", "ws://speaker.local:9000/custom"},
+	}
+	for _, tt := range tests {
+		got, err := playerURL(tt.addr)
+		if err != nil || got != tt.want {
+			t.Errorf("playerURL(%q) = %q, %v; want %q", tt.addr, got, err, tt.want)
+		}
+	}
+	if _, err := playerURL(""); err == nil {
+		t.Error("expected error for an empty address")
+	}
+}
+
+func TestServerConnectPlayer(t *testing.T) {
+	server, err := NewServer(ServerConfig{
+		Port:   8942,
+		Name:   "Test Server",
+		Source: NewTestTone(48000, 2),
+	})
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- server.Start()
+	}()
+	time.Sleep(200 * time.Millisecond)
+
+	states := make(chan PlayerState, 100)
+	player, err := NewPlayer(PlayerConfig{
+		PlayerName:    "Speaker",
+		Output:        output.NewCapture(),
+		OnStateChange: func(s PlayerState) { states <- s },
+	})
+	if err != nil {
+		t.Fatalf("failed to create player: %v", err)
+	}
+	if err := player.Listen("127.0.0.1:8943"); err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	if err := player.Listen("127.0.0.1:8943"); err == nil {
+		t.Error("expected error listening twice")
+	}
+
+	// The server dials the player, which then plays as if it had connected
+	if err := server.ConnectPlayer("127.0.0.1:8943"); err != nil {
+		t.Fatalf("ConnectPlayer failed: %v", err)
+	}
+
+	timeout := time.After(5 * time.Second)
+	for playing := false; !playing; {
+		select {
+		case s := <-states:
+			playing = s.Connected && s.State == "playing"
+		case <-timeout:
+			t.Fatal("player did not start playing")
+		}
+	}
+
+	ids := func() []string {
+		var ids []string
+		for _, c := range server.Clients() {
+			ids = append(ids, c.ID)
+		}
+		return ids
+	}
+	if !slices.Contains(ids(), player.ClientID()) {
+		t.Errorf("expected player %s in the client list, got %v", player.ClientID(), ids())
+	}
+
+	// A player serves one server at a time
+	if err := server.ConnectPlayer("127.0.0.1:8943"); err == nil {
+		t.Error("expected a connected player to refuse another connection")
+	}
+	if err := server.ConnectPlayer("127.0.0.1:1"); err == nil {
+		t.Error("expected error connecting to a missing player")
+	}
+
+	player.Close()
+	deadline := time.Now().Add(2 * time.Second)
+	for len(server.Clients()) > 0 && time.Now().Before(deadline) {
+		time.Sleep(20 * time.Millisecond)
+	}
+	if len(server.Clients()) != 0 {
+		t.Errorf("expected player removed after closing, got %v", ids())
+	}
+
+	server.Stop()
+	select {
+	case <-errChan:
+	case <-time.After(5 * time.Second):
+		t.Error("server did not stop within timeout")
+	}
+}
@@ -0,0 +1,324 @@
+// ABOUTME: Announcements mixed into the stream of selected players
+// ABOUTME: Ducks the music around a short clip (doorbell, TTS) and restores it afterwards
+package sendspin
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"time"
+
+	"github.com/Sendspin/sendspin-go/pkg/audio"
+	"github.com/Sendspin/sendspin-go/pkg/audio/dsp"
+	"github.com/Sendspin/sendspin-go/pkg/audio/resample"
+)
+
+const (
+	// DefaultDuck is the music level change during an announcement, in dB
+	DefaultDuck = -12.0
+
+	// DefaultDuckFade is how long the music takes to duck and to recover
+	DefaultDuckFade = 250 * time.Millisecond
+
+	// MaxAnnouncement is the longest clip Announce plays
+	MaxAnnouncement = time.Minute
+)
+
+// AnnounceOptions configure an announcement
+type AnnounceOptions struct {
+	// Duck is the music level change while the clip plays, in dB
+	// (default: DefaultDuck). -100 or lower silences the music.
+	Duck float64
+
+	// Gain adjusts the clip level, in dB
+	Gain float64
+
+	// Fade is how long the music takes to duck before the clip and to
+	// recover after it (default: DefaultDuckFade)
+	Fade time.Duration
+
+	// OnComplete is called once the announcement has finished playing on
+	// the players, with nil, or with an error if it was cut short (e.g.
+	// by a sample rate change or the server stopping). It runs on its own
+	// goroutine.
+	OnComplete func(error)
+}
+
+// announcement is a clip being mixed into some players' streams. Its
+// timeline is fade frames of ducking, the clip, then fade frames of
+// recovery. Only used under sourceMu.
+type announcement struct {
+	clip       []int32 // At the stream's sample rate
+	channels   int     // Clip channels
+	sampleRate int
+	targets    map[string]bool
+	duck       int64 // Music gain while ducked (Q16)
+	gain       int64 // Clip gain (Q16)
+	fade       int   // Frames
+	pos        int   // Timeline frame at the start of the current chunk
+	onComplete func(error)
+
+	// Clip mixes for each player channel count
+	matrices map[int]dsp.Matrix
+}
+
+// Announce mixes a short clip, such as a doorbell or a TTS WAV, into the
+// streams of the given players, ducking their music around it. The clip
+// starts in the same chunk for every target, so it plays in sync; other
+// players don't hear it. Announce reads the whole source (at most
+// MaxAnnouncement) and closes it. Announcements play one after another,
+// and wait while the group is paused.
+func (s *Server) Announce(source AudioSource, clientIDs []string, opts AnnounceOptions) error {
+	if err := checkSource(source); err != nil {
+		return err
+	}
+	defer closeSource(source)
+
+	if len(clientIDs) == 0 {
+		return fmt.Errorf("announcement needs at least one player")
+	}
+	if opts.Duck > 0 {
+		return fmt.Errorf("duck must be 0 dB or lower, got %g", opts.Duck)
+	}
+	if opts.Fade < 0 || opts.Fade > 5*time.Second {
+		return fmt.Errorf("duck fade must be between 0 and 5s, got %v", opts.Fade)
+	}
+	if opts.Duck == 0 {
+		opts.Duck = DefaultDuck
+	}
+	if opts.Fade == 0 {
+		opts.Fade = DefaultDuckFade
+	}
+
+	// Decode outside the lock so streaming carries on meanwhile
+	s.sourceMu.Lock()
+	sampleRate := s.audioSource.SampleRate()
+	s.sourceMu.Unlock()
+	clip, err := loadClip(source, sampleRate)
+	if err != nil {
+		return fmt.Errorf("failed to read announcement: %w", err)
+	}
+
+	s.sourceMu.Lock()
+	defer s.sourceMu.Unlock()
+
+	targets := make(map[string]bool, len(clientIDs))
+	s.clientsMu.RLock()
+	for _, id := range clientIDs {
+		c, ok := s.clients[id]
+		if !ok || !s.hasRole(c, "player") {
+			s.clientsMu.RUnlock()
+			return fmt.Errorf("player %q is not connected", id)
+		}
+		targets[id] = true
+	}
+	s.clientsMu.RUnlock()
+
+	s.announcements = append(s.announcements, &announcement{
+		clip:       clip,
+		channels:   source.Channels(),
+		sampleRate: sampleRate,
+		targets:    targets,
+		duck:       gainQ16(opts.Duck),
+		gain:       gainQ16(opts.Gain),
+		fade:       durationToFrames(opts.Fade, sampleRate),
+		onComplete: opts.OnComplete,
+		matrices:   make(map[int]dsp.Matrix),
+	})
+	log.Printf("Announcement queued for %d player(s): %v", len(targets),
+		time.Duration(len(clip)/source.Channels())*time.Second/time.Duration(sampleRate))
+	return nil
+}
+
+// loadClip reads a whole source, resampled to the given rate. Sources of
+// known duration are read to their end; others until they stop returning
+// audio.
+func loadClip(source AudioSource, sampleRate int) ([]int32, error) {
+	channels := source.Channels()
+	limit := durationToFrames(MaxAnnouncement, source.SampleRate())
+	frames, known := remainingFrames(source)
+	if known && frames > limit {
+		return nil, fmt.Errorf("clip is longer than %v", MaxAnnouncement)
+	}
+
+	var clip []int32
+	buf := make([]int32, 4096*channels)
+	for !known || len(clip)/channels < frames {
+		want := buf
+		if known {
+			want = buf[:min(len(buf), (frames-len(clip)/channels)*channels)]
+		}
+		n, err := source.Read(want)
+		clip = append(clip, want[:n/channels*channels]...)
+		if err == io.EOF || n == 0 {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(clip)/channels > limit {
+			return nil, fmt.Errorf("clip is longer than %v", MaxAnnouncement)
+		}
+	}
+	if len(clip) == 0 {
+		return nil, fmt.Errorf("clip is empty")
+	}
+	if source.SampleRate() == sampleRate {
+		return clip, nil
+	}
+
+	// Pad with silence so the filter tail comes out, then drop the
+	// filter delay and trim to length
+	r := resample.New(source.SampleRate(), sampleRate, channels)
+	outFrames := int(int64(len(clip)/channels) * int64(sampleRate) / int64(source.SampleRate()))
+	delay := int(int64(r.Latency()) * int64(sampleRate) / int64(source.SampleRate()))
+	out := make([]int32, (outFrames+2*delay+64)*channels)
+	n := r.Resample(append(clip, make([]int32, 2*(r.Latency()+64)*channels)...), out)
+	n = min(n/channels, delay+outFrames)
+	if n <= delay {
+		return nil, fmt.Errorf("clip is too short to resample")
+	}
+	return out[delay*channels : n*channels], nil
+}
+
+// gainQ16 converts a level in dB to a Q16 gain
+func gainQ16(db float64) int64 {
+	return int64(math.Round(math.Pow(10, db/20) * 65536))
+}
+
+// length returns the announcement's timeline length in frames
+func (a *announcement) length() int {
+	return 2*a.fade + len(a.clip)/a.channels
+}
+
+// musicGain returns the music gain (Q16) at a timeline frame
+func (a *announcement) musicGain(pos int) int64 {
+	clipEnd := a.fade + len(a.clip)/a.channels
+	switch {
+	case pos < a.fade:
+		return 65536 + (a.duck-65536)*int64(2*pos+1)/int64(2*a.fade)
+	case pos < clipEnd:
+		return a.duck
+	default:
+		return a.duck + (65536-a.duck)*int64(2*(pos-clipEnd)+1)/int64(2*a.fade)
+	}
+}
+
+// mix adds the announcement to one player's samples for the chunk
+// starting at the current timeline position
+func (a *announcement) mix(samples []int32, channels int) {
+	m, ok := a.matrices[channels]
+	if !ok {
+		m = clipMatrix(a.channels, channels)
+		a.matrices[channels] = m
+	}
+
+	clipFrames := len(a.clip) / a.channels
+	frames := min(len(samples)/channels, a.length()-a.pos)
+	for f := 0; f < frames; f++ {
+		pos := a.pos + f
+		music := a.musicGain(pos)
+		c := pos - a.fade
+		for ch := 0; ch < channels; ch++ {
+			j := f*channels + ch
+			var voice int32
+			if c >= 0 && c < clipFrames {
+				in := a.clip[c*a.channels : (c+1)*a.channels]
+				if m == nil {
+					voice = in[ch]
+				} else {
+					var sum float64
+					for i, g := range m[ch] {
+						sum += g * float64(in[i])
+					}
+					voice = int32(max(min(sum, audio.Max24Bit), audio.Min24Bit))
+				}
+			}
+			samples[j] = mixSamples(samples[j], voice, music, a.gain)
+		}
+	}
+}
+
+// clipMatrix maps clip channels to a player's channels, or nil when they
+// match. Clips are taken to stereo (mono clips play on both sides) and
+// then sent to the front pair of surround players.
+func clipMatrix(in, out int) dsp.Matrix {
+	if in == out {
+		return nil
+	}
+	var stereo dsp.Matrix
+	switch in {
+	case 1:
+		stereo = dsp.Matrix{{1}, {1}}
+	case 2:
+		stereo = dsp.Matrix{{1, 0}, {0, 1}}
+	default:
+		stereo, _ = dsp.Downmix(in, 2)
+	}
+	if out == 1 {
+		return dsp.Matrix{{0.5, 0.5}}.After(stereo)
+	}
+	m := make(dsp.Matrix, out)
+	for o := range m {
+		m[o] = make([]float64, in)
+	}
+	copy(m, stereo)
+	return m
+}
+
+// mixAnnouncement mixes the current announcement into the first frames
+// of a player's samples if the player is a target (called with sourceMu
+// held). It returns the samples to send, copied first if they are shared
+// with other players.
+func (s *Server) mixAnnouncement(c *client, samples []int32, shared bool, channels, frames int) []int32 {
+	if len(s.announcements) == 0 || !s.announcements[0].targets[c.ID] {
+		return samples
+	}
+	if shared {
+		c.mixedBuf = append(c.mixedBuf[:0], samples...)
+		samples = c.mixedBuf
+	}
+	s.announcements[0].mix(samples[:frames*channels], channels)
+	return samples
+}
+
+// advanceAnnouncement moves the current announcement past a chunk of
+// frames that plays at playbackTime (called with sourceMu held)
+func (s *Server) advanceAnnouncement(frames, sampleRate int, playbackTime int64) {
+	if len(s.announcements) == 0 {
+		return
+	}
+	a := s.announcements[0]
+	if a.sampleRate != sampleRate {
+		s.announcements = s.announcements[1:]
+		a.complete(0, fmt.Errorf("announcement cut short by a sample rate change"))
+		return
+	}
+
+	a.pos += frames
+	if a.pos < a.length() {
+		return
+	}
+	s.announcements = s.announcements[1:]
+
+	// Report completion once the last chunk has played
+	end := playbackTime + int64(frames)*1000000/int64(sampleRate)
+	a.complete(time.Duration(end-s.getClockMicros())*time.Microsecond, nil)
+}
+
+// cancelAnnouncements drops every announcement (called with sourceMu held)
+func (s *Server) cancelAnnouncements(err error) {
+	for _, a := range s.announcements {
+		a.complete(0, err)
+	}
+	s.announcements = nil
+}
+
+// complete calls the completion callback after a delay
+func (a *announcement) complete(delay time.Duration, err error) {
+	if a.onComplete == nil {
+		return
+	}
+	time.AfterFunc(max(delay, 0), func() { a.onComplete(err) })
+}
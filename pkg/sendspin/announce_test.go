@@ -0,0 +1,275 @@
+// ABOUTME: Tests for announcements
+// ABOUTME: Covers ducking, clip mixing and resampling, and targeting selected players
+package sendspin
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/Sendspin/sendspin-go/pkg/audio"
+	"github.com/Sendspin/sendspin-go/pkg/audio/dsp"
+	"github.com/Sendspin/sendspin-go/pkg/protocol"
+	"github.com/gorilla/websocket"
+)
+
+func TestAnnouncementMix(t *testing.T) {
+	// Timeline: 4 frames of ducking, 4 of clip, 4 of recovery
+	a := &announcement{
+		clip:     []int32{2000000, 2000000, 2000000, 2000000},
+		channels: 1,
+		duck:     gainQ16(-6),
+		gain:     65536,
+		fade:     4,
+		matrices: make(map[int]dsp.Matrix),
+	}
+	if a.length() != 12 {
+		t.Fatalf("expected 12 frames, got %d", a.length())
+	}
+
+	// A stereo player; the chunk runs past the end of the announcement
+	samples := make([]int32, 16*2)
+	for i := range samples {
+		samples[i] = 1000000
+	}
+	a.mix(samples, 2)
+
+	duck := 1000000 * math.Pow(10, -6.0/20)
+	for f := 0; f < 16; f++ {
+		var want float64
+		switch {
+		case f < 4:
+			// Ducking ramps down between full level and the duck
+			want = -1
+		case f < 8:
+			want = duck + 2000000
+		case f < 12:
+			want = -1
+		default:
+			want = 1000000
+		}
+		for ch := 0; ch < 2; ch++ {
+			got := float64(samples[f*2+ch])
+			if want < 0 {
+				if got > 1000000 || got < duck {
+					t.Errorf("frame %d: expected a level between %.0f and 1000000, got %.0f", f, duck, got)
+				}
+				continue
+			}
+			if math.Abs(got-want) > 32 {
+				t.Errorf("frame %d channel %d: expected %.0f, got %.0f", f, ch, want, got)
+			}
+		}
+	}
+	if samples[0] <= samples[6] || samples[18] >= samples[22] {
+		t.Error("expected the music to ramp down and back up")
+	}
+}
+
+func TestClipMatrix(t *testing.T) {
+	if m := clipMatrix(2, 2); m != nil {
+		t.Errorf("expected passthrough, got %v", m)
+	}
+	if m := clipMatrix(1, 2); len(m) != 2 || m[0][0] != 1 || m[1][0] != 1 {
+		t.Errorf("expected mono clip on both sides, got %v", m)
+	}
+	// Surround players hear the clip on the front pair only
+	m := clipMatrix(2, 6)
+	if len(m) != 6 || m[0][0] != 1 || m[1][1] != 1 || m[2][0] != 0 || m[4][0] != 0 {
+		t.Errorf("expected clip on the front pair, got %v", m)
+	}
+	if m := clipMatrix(2, 1); len(m) != 1 || m[0][0] != 0.5 || m[0][1] != 0.5 {
+		t.Errorf("expected mono downmix, got %v", m)
+	}
+}
+
+// endingSource plays a constant level for a number of frames, then
+// returns io.EOF like a live stream would
+type endingSource struct {
+	value    int32
+	frames   int
+	rate     int
+	channels int
+}
+
+func (s *endingSource) Read(samples []int32) (int, error) {
+	n := min(len(samples)/s.channels, s.frames)
+	if n == 0 {
+		return 0, io.EOF
+	}
+	for i := 0; i < n*s.channels; i++ {
+		samples[i] = s.value
+	}
+	s.frames -= n
+	return n * s.channels, nil
+}
+
+func (s *endingSource) SampleRate() int                    { return s.rate }
+func (s *endingSource) Channels() int                      { return s.channels }
+func (s *endingSource) Metadata() (string, string, string) { return "Chime", "", "" }
+func (s *endingSource) Close() error                       { return nil }
+
+func TestLoadClip(t *testing.T) {
+	// Sources of known duration are read once, not looped
+	ramp := newRampSource("Chime", 0, 1, 1000, 48000)
+	ramp.channels = 1
+	clip, err := loadClip(ramp, 48000)
+	if err != nil {
+		t.Fatalf("loadClip failed: %v", err)
+	}
+	if len(clip) != 1000 || clip[999] != 999 {
+		t.Errorf("expected 1000 frames of the ramp, got %d", len(clip))
+	}
+
+	// Others are read until they end, and resampled to the stream rate
+	clip, err = loadClip(&endingSource{value: 1000000, frames: 24000, rate: 24000, channels: 2}, 48000)
+	if err != nil {
+		t.Fatalf("loadClip failed: %v", err)
+	}
+	if len(clip) != 48000*2 {
+		t.Errorf("expected %d samples, got %d", 48000*2, len(clip))
+	}
+	if v := clip[24000*2]; math.Abs(float64(v)-1000000) > 1000 {
+		t.Errorf("expected the level to survive resampling, got %d", v)
+	}
+
+	if _, err := loadClip(&endingSource{rate: 48000, channels: 1}, 48000); err == nil {
+		t.Error("expected error for an empty clip")
+	}
+	if _, err := loadClip(NewTestTone(48000, 2), 48000); err == nil {
+		t.Error("expected error for an endless clip")
+	}
+}
+
+func TestServerAnnounce(t *testing.T) {
+	server, err := NewServer(ServerConfig{
+		Port:   8941,
+		Name:   "Test Server",
+		Source: newRampSource("Music", 1000000, 0, 48000, 48000),
+	})
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- server.Start()
+	}()
+	time.Sleep(200 * time.Millisecond)
+
+	connect := func(id string) *websocket.Conn {
+		t.Helper()
+		conn, _, err := websocket.DefaultDialer.Dial("ws://localhost:8941/sendspin", nil)
+		if err != nil {
+			t.Fatalf("failed to connect to server: %v", err)
+		}
+		hello := protocol.Message{
+			Type: "client/hello",
+			Payload: protocol.ClientHello{
+				ClientID:       id,
+				Name:           id,
+				Version:        1,
+				SupportedRoles: []string{"player"},
+			},
+		}
+		if err := conn.WriteJSON(hello); err != nil {
+			t.Fatalf("failed to send hello: %v", err)
+		}
+		readUntil(t, conn, "stream/start")
+		return conn
+	}
+	kitchen := connect("kitchen")
+	defer kitchen.Close()
+	bedroom := connect("bedroom")
+	defer bedroom.Close()
+
+	chime := newRampSource("Chime", 2000000, 0, 1920, 48000)
+	chime.channels = 1
+	if err := server.Announce(chime, []string{"kitchen", "garage"}, AnnounceOptions{}); err == nil {
+		t.Error("expected error for a player that is not connected")
+	}
+	if err := server.Announce(chime, nil, AnnounceOptions{}); err == nil {
+		t.Error("expected error without players")
+	}
+
+	done := make(chan error, 1)
+	chime = newRampSource("Chime", 2000000, 0, 1920, 48000)
+	chime.channels = 1
+	err = server.Announce(chime, []string{"kitchen"}, AnnounceOptions{
+		Duck:       -6,
+		Fade:       20 * time.Millisecond,
+		OnComplete: func(err error) { done <- err },
+	})
+	if err != nil {
+		t.Fatalf("Announce failed: %v", err)
+	}
+
+	// peaks reads audio chunks and returns the loudest left sample of each,
+	// by timestamp
+	peaks := func(conn *websocket.Conn, chunks int) map[int64]int32 {
+		t.Helper()
+		conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+		defer conn.SetReadDeadline(time.Time{})
+		result := make(map[int64]int32)
+		for len(result) < chunks {
+			kind, data, err := conn.ReadMessage()
+			if err != nil {
+				t.Fatalf("failed to read audio: %v", err)
+			}
+			if kind != websocket.BinaryMessage {
+				continue
+			}
+			ts := int64(binary.BigEndian.Uint64(data[1:9]))
+			var peak int32
+			for i := 9; i+6 <= len(data); i += 6 {
+				peak = max(peak, audio.SampleFrom24Bit([3]byte{data[i], data[i+1], data[i+2]}))
+			}
+			result[ts] = peak
+		}
+		return result
+	}
+	heard := peaks(kitchen, 10)
+	quiet := peaks(bedroom, 10)
+
+	// The chime plays over the ducked music in the kitchen only
+	want := int32(1000000*math.Pow(10, -6.0/20) + 2000000)
+	found := false
+	for ts, peak := range heard {
+		if math.Abs(float64(peak-want)) < 64 {
+			found = true
+			if other, ok := quiet[ts]; ok && other != 1000000 {
+				t.Errorf("expected unchanged music in the bedroom at %d, got %d", ts, other)
+			}
+		}
+	}
+	if !found {
+		t.Errorf("expected the chime at %d in the kitchen, got %v", want, heard)
+	}
+	for ts, peak := range quiet {
+		if peak != 1000000 {
+			t.Errorf("expected unchanged music in the bedroom at %d, got %d", ts, peak)
+		}
+	}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("expected announcement to complete, got %v", err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Error("announcement did not complete")
+	}
+
+	kitchen.Close()
+	bedroom.Close()
+	time.Sleep(100 * time.Millisecond)
+
+	server.Stop()
+	select {
+	case <-errChan:
+	case <-time.After(5 * time.Second):
+		t.Error("server did not stop within timeout")
+	}
+}
@@ -0,0 +1,27 @@
+// ABOUTME: Shared-token authentication for WebSocket connections
+// ABOUTME: Checks and sends bearer tokens in either connection direction
+package sendspin
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// authorized reports whether a request carries the token as a bearer
+// token. An empty token accepts every request.
+func authorized(r *http.Request, token string) bool {
+	if token == "" {
+		return true
+	}
+	got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(got), []byte(token)) == 1
+}
+
+// authHeader carries the token on an outgoing connection (nil if empty)
+func authHeader(token string) http.Header {
+	if token == "" {
+		return nil
+	}
+	return http.Header{"Authorization": {"Bearer " + token}}
+}
@@ -0,0 +1,98 @@
+// ABOUTME: Tests for shared-token authentication
+// ABOUTME: Verifies servers and listening players refuse connections without the token
+package sendspin
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Sendspin/sendspin-go/pkg/audio/output"
+)
+
+func TestAuthorized(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		token  string
+		want   bool
+	}{
+		{"no token required", "", "", true},
+		{"matching token", "Bearer secret", "secret", true},
+		{"missing token", "", "secret", false},
+		{"wrong token", "Bearer other", "secret", false},
+		{"wrong scheme", "Basic secret", "secret", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, _ := http.NewRequest("GET", "/sendspin", nil)
+			if tt.header != "" {
+				r.Header.Set("Authorization", tt.header)
+			}
+			if got := authorized(r, tt.token); got != tt.want {
+				t.Errorf("authorized = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestServerAuthToken(t *testing.T) {
+	server, err := NewServer(ServerConfig{
+		Port:      8948,
+		Name:      "Test Server",
+		Source:    NewTestTone(48000, 2),
+		AuthToken: "secret",
+	})
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- server.Start()
+	}()
+	time.Sleep(200 * time.Millisecond)
+
+	newPlayer := func(token string) *Player {
+		player, err := NewPlayer(PlayerConfig{
+			ServerAddr: "localhost:8948",
+			PlayerName: "Speaker",
+			AuthToken:  token,
+			Output:     output.NewCapture(),
+		})
+		if err != nil {
+			t.Fatalf("failed to create player: %v", err)
+		}
+		return player
+	}
+
+	intruder := newPlayer("wrong")
+	if err := intruder.Connect(); err == nil {
+		t.Error("expected a player with the wrong token to be refused")
+	}
+	intruder.Close()
+
+	player := newPlayer("secret")
+	if err := player.Connect(); err != nil {
+		t.Fatalf("player with the token failed to connect: %v", err)
+	}
+
+	// A listening player with a token refuses servers without it
+	listener := newPlayer("other")
+	if err := listener.Listen("127.0.0.1:8949"); err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	if err := server.ConnectPlayer("127.0.0.1:8949"); err == nil {
+		t.Error("expected a player with another token to refuse the server")
+	}
+	listener.Close()
+
+	player.Close()
+	server.Stop()
+	select {
+	case <-errChan:
+	case <-time.After(5 * time.Second):
+		t.Fatal("server did not stop")
+	}
+}
@@ -0,0 +1,119 @@
+// ABOUTME: Per-player channel roles
+// ABOUTME: Maps the source channels to what each player receives (stereo pairs, mono, custom)
+package sendspin
+
+import (
+	"fmt"
+
+	"github.com/Sendspin/sendspin-go/pkg/audio/dsp"
+)
+
+// ChannelRole selects which channels a player receives
+type ChannelRole string
+
+const (
+	// ChannelsStereo sends every source channel unchanged (the default),
+	// downmixed to stereo for players that take fewer channels
+	ChannelsStereo ChannelRole = "stereo"
+
+	// ChannelsLeft sends the left channel only, e.g. for one speaker of a
+	// stereo pair
+	ChannelsLeft ChannelRole = "left"
+
+	// ChannelsRight sends the right channel only
+	ChannelsRight ChannelRole = "right"
+
+	// ChannelsMono sends an equal-gain downmix of all channels, e.g. for a
+	// subwoofer
+	ChannelsMono ChannelRole = "mono"
+
+	// ChannelsCustom sends the channels produced by ChannelMapping.Matrix
+	ChannelsCustom ChannelRole = "custom"
+)
+
+// ChannelMapping assigns a player its channels. The zero value is stereo.
+type ChannelMapping struct {
+	Role ChannelRole `json:"role"`
+
+	// Matrix is used with ChannelsCustom: one row per channel sent to the
+	// player, holding a gain for each source channel
+	Matrix dsp.Matrix `json:"matrix,omitempty"`
+}
+
+// role returns the mapping's role, defaulting to stereo
+func (m ChannelMapping) role() ChannelRole {
+	if m.Role == "" {
+		return ChannelsStereo
+	}
+	return m.Role
+}
+
+// Validate checks the mapping independently of the source format
+func (m ChannelMapping) Validate() error {
+	switch m.role() {
+	case ChannelsStereo, ChannelsLeft, ChannelsRight, ChannelsMono:
+		if m.Matrix != nil {
+			return fmt.Errorf("channel matrix is only used with the custom role")
+		}
+	case ChannelsCustom:
+		if len(m.Matrix) == 0 {
+			return fmt.Errorf("custom channel role requires a matrix")
+		}
+	default:
+		return fmt.Errorf("unknown channel role %q (supported: stereo, left, right, mono, custom)", m.Role)
+	}
+	return nil
+}
+
+// matrix returns the mix for a source with the given channel count sent
+// to a player accepting up to playerChannels, or nil when the source
+// passes through unchanged. Surround sources are folded down with the ITU
+// downmix before a player's side is picked, and for players that take
+// fewer channels than the source.
+func (m ChannelMapping) matrix(channels, playerChannels int) (dsp.Matrix, error) {
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+
+	// Left and right of a surround source come from its stereo downmix
+	var stereo dsp.Matrix
+	if channels > 2 {
+		var err error
+		if stereo, err = dsp.Downmix(channels, 2); err != nil {
+			return nil, err
+		}
+	}
+	pick := func(ch int) dsp.Matrix {
+		if stereo != nil {
+			return dsp.Matrix{stereo[ch]}
+		}
+		row := make([]float64, channels)
+		row[min(ch, channels-1)] = 1
+		return dsp.Matrix{row}
+	}
+
+	switch m.role() {
+	case ChannelsLeft:
+		return pick(0), nil
+	case ChannelsRight:
+		return pick(1), nil
+	case ChannelsMono:
+		if channels == 1 {
+			return nil, nil
+		}
+		if channels > 2 {
+			return dsp.Downmix(channels, 1)
+		}
+		return dsp.Matrix{{0.5, 0.5}}, nil
+	case ChannelsCustom:
+		if err := m.Matrix.Validate(channels); err != nil {
+			return nil, err
+		}
+		return m.Matrix, nil
+	default:
+		if channels <= playerChannels {
+			return nil, nil
+		}
+		return dsp.Downmix(channels, min(max(playerChannels, 1), 2))
+	}
+}
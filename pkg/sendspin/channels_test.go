@@ -0,0 +1,319 @@
+// ABOUTME: Tests for per-player channel roles
+// ABOUTME: Covers role matrices, the client settings store and stream/start signalling
+package sendspin
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Sendspin/sendspin-go/pkg/audio/dsp"
+	"github.com/Sendspin/sendspin-go/pkg/protocol"
+	"github.com/gorilla/websocket"
+)
+
+func TestChannelMappingMatrix(t *testing.T) {
+	stereo51, _ := dsp.Downmix(6, 2)
+	mono51, _ := dsp.Downmix(6, 1)
+
+	tests := []struct {
+		name     string
+		mapping  ChannelMapping
+		channels int
+		player   int
+		want     dsp.Matrix
+	}{
+		{"default is stereo", ChannelMapping{}, 2, 2, nil},
+		{"stereo", ChannelMapping{Role: ChannelsStereo}, 2, 2, nil},
+		{"left", ChannelMapping{Role: ChannelsLeft}, 2, 2, dsp.Matrix{{1, 0}}},
+		{"right", ChannelMapping{Role: ChannelsRight}, 2, 2, dsp.Matrix{{0, 1}}},
+		{"right of mono source", ChannelMapping{Role: ChannelsRight}, 1, 2, dsp.Matrix{{1}}},
+		{"mono", ChannelMapping{Role: ChannelsMono}, 2, 2, dsp.Matrix{{0.5, 0.5}}},
+		{"mono of mono source", ChannelMapping{Role: ChannelsMono}, 1, 2, nil},
+		{"custom", ChannelMapping{Role: ChannelsCustom, Matrix: dsp.Matrix{{0, 1}, {1, 0}}}, 2, 2, dsp.Matrix{{0, 1}, {1, 0}}},
+		{"surround player", ChannelMapping{}, 6, 8, nil},
+		{"surround downmix", ChannelMapping{}, 6, 2, stereo51},
+		{"surround mono player", ChannelMapping{}, 6, 1, mono51},
+		{"left of surround", ChannelMapping{Role: ChannelsLeft}, 6, 8, dsp.Matrix{stereo51[0]}},
+		{"mono of surround", ChannelMapping{Role: ChannelsMono}, 6, 2, mono51},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.mapping.matrix(tt.channels, tt.player)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("expected %v, got %v", tt.want, got)
+			}
+			for o := range got {
+				for i := range got[o] {
+					if got[o][i] != tt.want[o][i] {
+						t.Fatalf("expected %v, got %v", tt.want, got)
+					}
+				}
+			}
+		})
+	}
+
+	invalid := []ChannelMapping{
+		{Role: "surround"},
+		{Role: ChannelsCustom},
+		{Role: ChannelsLeft, Matrix: dsp.Matrix{{1, 0}}},
+	}
+	for _, m := range invalid {
+		if err := m.Validate(); err == nil {
+			t.Errorf("expected error for %+v", m)
+		}
+	}
+	custom := ChannelMapping{Role: ChannelsCustom, Matrix: dsp.Matrix{{1, 0, 0}}}
+	if _, err := custom.matrix(2, 2); err == nil {
+		t.Error("expected error for a matrix that does not fit the source")
+	}
+}
+
+func TestClientStorePersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "clients.json")
+
+	st, err := loadClientStore(path)
+	if err != nil {
+		t.Fatalf("failed to load missing store: %v", err)
+	}
+	if st.get("speaker").ChannelMapping != nil {
+		t.Error("expected no settings for an unknown client")
+	}
+
+	mapping := ChannelMapping{Role: ChannelsLeft}
+	if err := st.update("speaker", func(s *clientSettings) { s.ChannelMapping = &mapping }); err != nil {
+		t.Fatalf("update failed: %v", err)
+	}
+
+	reloaded, err := loadClientStore(path)
+	if err != nil {
+		t.Fatalf("failed to reload store: %v", err)
+	}
+	if got := reloaded.get("speaker").ChannelMapping; got == nil || got.Role != ChannelsLeft {
+		t.Errorf("expected left mapping after reload, got %+v", got)
+	}
+
+	if err := os.WriteFile(path, []byte("{"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadClientStore(path); err == nil {
+		t.Error("expected error for a corrupt store")
+	}
+}
+
+func TestServerChannelMapping(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "clients.json")
+
+	server, err := NewServer(ServerConfig{
+		Port:      8939,
+		Name:      "Test Server",
+		Source:    NewTestTone(48000, 2),
+		StateFile: stateFile,
+	})
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	// Mappings can be assigned before the player connects
+	if err := server.SetChannelMapping("pair-left", ChannelMapping{Role: ChannelsLeft}); err != nil {
+		t.Fatalf("SetChannelMapping failed: %v", err)
+	}
+	bad := ChannelMapping{Role: ChannelsCustom, Matrix: dsp.Matrix{{1}}}
+	if err := server.SetChannelMapping("pair-left", bad); err == nil {
+		t.Error("expected error for a matrix that does not fit the source")
+	}
+
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- server.Start()
+	}()
+	time.Sleep(200 * time.Millisecond)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws://localhost:8939/sendspin", nil)
+	if err != nil {
+		t.Fatalf("failed to connect to server: %v", err)
+	}
+	defer conn.Close()
+
+	hello := protocol.Message{
+		Type: "client/hello",
+		Payload: protocol.ClientHello{
+			ClientID:       "pair-left",
+			Name:           "Left Speaker",
+			Version:        1,
+			SupportedRoles: []string{"player"},
+		},
+	}
+	if err := conn.WriteJSON(hello); err != nil {
+		t.Fatalf("failed to send hello: %v", err)
+	}
+
+	readStart := func() protocol.StreamStartPlayer {
+		t.Helper()
+		data, _ := json.Marshal(readUntil(t, conn, "stream/start").Payload)
+		var start protocol.StreamStart
+		if err := json.Unmarshal(data, &start); err != nil || start.Player == nil {
+			t.Fatalf("failed to unmarshal stream/start: %v", err)
+		}
+		return *start.Player
+	}
+
+	start := readStart()
+	if start.Channels != 1 || start.ChannelRole != "left" {
+		t.Errorf("expected 1 left channel, got %d %q", start.Channels, start.ChannelRole)
+	}
+
+	// Audio carries one channel: 20ms at 48kHz is 960 24-bit samples
+	conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	for {
+		kind, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("failed to read audio: %v", err)
+		}
+		if kind == websocket.BinaryMessage {
+			if got := len(data) - 9; got != 960*3 {
+				t.Errorf("expected %d bytes of audio, got %d", 960*3, got)
+			}
+			break
+		}
+	}
+	conn.SetReadDeadline(time.Time{})
+
+	// Changing the mapping of a connected player restarts its stream
+	if err := server.SetChannelMapping("pair-left", ChannelMapping{Role: ChannelsMono}); err != nil {
+		t.Fatalf("SetChannelMapping failed: %v", err)
+	}
+	start = readStart()
+	if start.Channels != 1 || start.ChannelRole != "mono" {
+		t.Errorf("expected mono channel, got %d %q", start.Channels, start.ChannelRole)
+	}
+
+	clients := server.Clients()
+	if len(clients) != 1 || clients[0].ChannelRole != ChannelsMono {
+		t.Errorf("expected client with mono role, got %+v", clients)
+	}
+
+	conn.Close()
+	time.Sleep(100 * time.Millisecond)
+
+	server.Stop()
+	select {
+	case <-errChan:
+	case <-time.After(5 * time.Second):
+		t.Error("server did not stop within timeout")
+	}
+
+	// The mapping survives a restart
+	restarted, err := NewServer(ServerConfig{Source: NewTestTone(48000, 2), StateFile: stateFile})
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	if got := restarted.ChannelMapping("pair-left"); got.Role != ChannelsMono {
+		t.Errorf("expected persisted mono mapping, got %+v", got)
+	}
+	if got := restarted.ChannelMapping("other"); got.Role != ChannelsStereo {
+		t.Errorf("expected stereo default, got %+v", got)
+	}
+}
+
+func TestServerSurroundDownmix(t *testing.T) {
+	surround := newRampSource("Surround", 0, 1, 48000, 48000)
+	surround.channels = 6
+
+	tooMany := newRampSource("Too many", 0, 1, 48000, 48000)
+	tooMany.channels = 9
+	if _, err := NewServer(ServerConfig{Source: tooMany}); err == nil {
+		t.Error("expected error for a 9-channel source")
+	}
+
+	server, err := NewServer(ServerConfig{
+		Port:   8940,
+		Name:   "Test Server",
+		Source: surround,
+	})
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- server.Start()
+	}()
+	time.Sleep(200 * time.Millisecond)
+
+	connect := func(id string, formats []protocol.AudioFormat) (*websocket.Conn, protocol.StreamStartPlayer) {
+		t.Helper()
+		conn, _, err := websocket.DefaultDialer.Dial("ws://localhost:8940/sendspin", nil)
+		if err != nil {
+			t.Fatalf("failed to connect to server: %v", err)
+		}
+		hello := protocol.Message{
+			Type: "client/hello",
+			Payload: protocol.ClientHello{
+				ClientID:       id,
+				Name:           id,
+				Version:        1,
+				SupportedRoles: []string{"player"},
+				PlayerSupport:  &protocol.PlayerSupport{SupportFormats: formats},
+			},
+		}
+		if err := conn.WriteJSON(hello); err != nil {
+			t.Fatalf("failed to send hello: %v", err)
+		}
+		data, _ := json.Marshal(readUntil(t, conn, "stream/start").Payload)
+		var start protocol.StreamStart
+		if err := json.Unmarshal(data, &start); err != nil || start.Player == nil {
+			t.Fatalf("failed to unmarshal stream/start: %v", err)
+		}
+		return conn, *start.Player
+	}
+
+	// A stereo player gets the ITU downmix
+	stereo, start := connect("stereo", []protocol.AudioFormat{{Codec: "pcm", Channels: 2, SampleRate: 48000, BitDepth: 24}})
+	defer stereo.Close()
+	if start.Channels != 2 || start.ChannelLayout != "stereo" {
+		t.Errorf("expected stereo downmix, got %d %q", start.Channels, start.ChannelLayout)
+	}
+	stereo.SetReadDeadline(time.Now().Add(3 * time.Second))
+	for {
+		kind, data, err := stereo.ReadMessage()
+		if err != nil {
+			t.Fatalf("failed to read audio: %v", err)
+		}
+		if kind == websocket.BinaryMessage {
+			if got := len(data) - 9; got != 960*2*3 {
+				t.Errorf("expected %d bytes of audio, got %d", 960*2*3, got)
+			}
+			break
+		}
+	}
+
+	// A surround player gets every channel, as Opus multistream
+	surroundConn, start := connect("surround", []protocol.AudioFormat{{Codec: "opus", Channels: 6, SampleRate: 48000, BitDepth: 16}})
+	defer surroundConn.Close()
+	if start.Codec != "opus" || start.Channels != 6 || start.ChannelLayout != "5.1" {
+		t.Errorf("expected 5.1 opus, got %s %d %q", start.Codec, start.Channels, start.ChannelLayout)
+	}
+	header, err := base64.StdEncoding.DecodeString(start.CodecHeader)
+	if err != nil || len(header) != 27 || string(header[:8]) != "OpusHead" || header[18] != 1 {
+		t.Errorf("expected multistream OpusHead, got %v (%v)", header, err)
+	}
+
+	stereo.Close()
+	surroundConn.Close()
+	time.Sleep(100 * time.Millisecond)
+
+	server.Stop()
+	select {
+	case <-errChan:
+	case <-time.After(5 * time.Second):
+		t.Error("server did not stop within timeout")
+	}
+}
@@ -0,0 +1,115 @@
+// ABOUTME: Server-side store of per-client settings
+// ABOUTME: Remembers settings by client ID, optionally persisted to a JSON file
+package sendspin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// clientSettings are remembered for a client ID across connections
+type clientSettings struct {
+	ChannelMapping *ChannelMapping `json:"channel_mapping,omitempty"`
+
+	// Name overrides the name the client reports
+	Name  string `json:"name,omitempty"`
+	Group string `json:"group,omitempty"`
+
+	// Volume and Muted are the player's last reported or assigned levels
+	Volume *int  `json:"volume,omitempty"`
+	Muted  *bool `json:"muted,omitempty"`
+}
+
+// clientStore holds settings by client ID. With a path, every change is
+// written to disk so settings survive restarts.
+type clientStore struct {
+	path    string
+	mu      sync.Mutex
+	clients map[string]clientSettings
+}
+
+// clientStoreFile is the on-disk layout
+type clientStoreFile struct {
+	Clients map[string]clientSettings `json:"clients"`
+}
+
+// loadClientStore reads a store from path; a missing file is an empty
+// store, and an empty path keeps settings in memory only
+func loadClientStore(path string) (*clientStore, error) {
+	st := &clientStore{path: path, clients: make(map[string]clientSettings)}
+	if path == "" {
+		return st, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return st, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client state: %w", err)
+	}
+
+	var file clientStoreFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse client state %s: %w", path, err)
+	}
+	for id, settings := range file.Clients {
+		st.clients[id] = settings
+	}
+	return st, nil
+}
+
+// get returns a client's settings
+func (st *clientStore) get(clientID string) clientSettings {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.clients[clientID]
+}
+
+// update changes a client's settings and saves the store
+func (st *clientStore) update(clientID string, change func(*clientSettings)) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	settings := st.clients[clientID]
+	change(&settings)
+	st.clients[clientID] = settings
+	return st.save()
+}
+
+// save writes the store to disk (called with mu held)
+func (st *clientStore) save() error {
+	if st.path == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(clientStoreFile{Clients: st.clients}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode client state: %w", err)
+	}
+	if err := writeFileAtomic(st.path, data); err != nil {
+		return fmt.Errorf("failed to write client state: %w", err)
+	}
+	return nil
+}
+
+// writeFileAtomic writes a file then renames it into place, so a crash
+// never leaves a truncated file
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
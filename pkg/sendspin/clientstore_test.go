@@ -0,0 +1,151 @@
+// ABOUTME: Tests for settings the server remembers per client ID
+// ABOUTME: Covers display names, groups and volume restored on client/hello
+package sendspin
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Sendspin/sendspin-go/pkg/protocol"
+	"github.com/gorilla/websocket"
+)
+
+func TestServerRemembersClients(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "clients.json")
+
+	server, err := NewServer(ServerConfig{
+		Port:      8946,
+		Name:      "Test Server",
+		Source:    NewTestTone(48000, 2),
+		StateFile: stateFile,
+	})
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	// Settings can be assigned before the player ever connects
+	if err := server.SetClientName("kitchen-1", "Kitchen"); err != nil {
+		t.Fatalf("SetClientName failed: %v", err)
+	}
+	if err := server.SetClientGroup("kitchen-1", "Downstairs"); err != nil {
+		t.Fatalf("SetClientGroup failed: %v", err)
+	}
+	if err := server.SetPlayerVolume("kitchen-1", 101, false); err == nil {
+		t.Error("expected error for volume above 100")
+	}
+
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- server.Start()
+	}()
+	time.Sleep(200 * time.Millisecond)
+
+	connect := func() *websocket.Conn {
+		t.Helper()
+		conn, _, err := websocket.DefaultDialer.Dial("ws://localhost:8946/sendspin", nil)
+		if err != nil {
+			t.Fatalf("failed to connect to server: %v", err)
+		}
+		hello := protocol.Message{
+			Type: "client/hello",
+			Payload: protocol.ClientHello{
+				ClientID:       "kitchen-1",
+				Name:           "raspberrypi",
+				Version:        1,
+				SupportedRoles: []string{"player"},
+				PlayerSupport:  &protocol.PlayerSupport{SupportedCommands: []string{"volume", "mute"}},
+			},
+		}
+		if err := conn.WriteJSON(hello); err != nil {
+			t.Fatalf("failed to send hello: %v", err)
+		}
+		readUntil(t, conn, "server/hello")
+		return conn
+	}
+
+	conn := connect()
+	clients := server.Clients()
+	if len(clients) != 1 || clients[0].Name != "Kitchen" || clients[0].Group != "Downstairs" {
+		t.Errorf("expected the assigned name and group, got %+v", clients)
+	}
+
+	// The player turns itself down; the server remembers it
+	update := protocol.Message{Type: "player/update", Payload: protocol.ClientState{State: "idle", Volume: 30, Muted: true}}
+	if err := conn.WriteJSON(update); err != nil {
+		t.Fatalf("failed to send state: %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	conn.Close()
+	time.Sleep(100 * time.Millisecond)
+
+	server.Stop()
+	select {
+	case <-errChan:
+	case <-time.After(5 * time.Second):
+		t.Error("server did not stop within timeout")
+	}
+
+	// After a restart, the returning player gets its name and volume back
+	restarted, err := NewServer(ServerConfig{
+		Port:      8946,
+		Name:      "Test Server",
+		Source:    NewTestTone(48000, 2),
+		StateFile: stateFile,
+	})
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	go func() {
+		errChan <- restarted.Start()
+	}()
+	time.Sleep(200 * time.Millisecond)
+
+	conn = connect()
+	defer conn.Close()
+
+	command := func() protocol.ServerCommand {
+		t.Helper()
+		data, _ := json.Marshal(readUntil(t, conn, "server/command").Payload)
+		var cmd protocol.ServerCommand
+		if err := json.Unmarshal(data, &cmd); err != nil {
+			t.Fatalf("failed to unmarshal server/command: %v", err)
+		}
+		return cmd
+	}
+	if cmd := command(); cmd.Command != "volume" || cmd.Volume != 30 {
+		t.Errorf("expected volume 30 restored, got %+v", cmd)
+	}
+	if cmd := command(); cmd.Command != "mute" || !cmd.Mute {
+		t.Errorf("expected mute restored, got %+v", cmd)
+	}
+	if clients := restarted.Clients(); len(clients) != 1 || clients[0].Name != "Kitchen" {
+		t.Errorf("expected the assigned name after restart, got %+v", clients)
+	}
+
+	// Clearing the display name restores the client's own
+	if err := restarted.SetClientName("kitchen-1", ""); err != nil {
+		t.Fatalf("SetClientName failed: %v", err)
+	}
+	if clients := restarted.Clients(); clients[0].Name != "raspberrypi" {
+		t.Errorf("expected the reported name, got %q", clients[0].Name)
+	}
+
+	// Volume set by the server reaches a connected player
+	if err := restarted.SetPlayerVolume("kitchen-1", 55, false); err != nil {
+		t.Fatalf("SetPlayerVolume failed: %v", err)
+	}
+	if cmd := command(); cmd.Command != "volume" || cmd.Volume != 55 {
+		t.Errorf("expected volume 55, got %+v", cmd)
+	}
+
+	conn.Close()
+	time.Sleep(100 * time.Millisecond)
+	restarted.Stop()
+	select {
+	case <-errChan:
+	case <-time.After(5 * time.Second):
+		t.Error("server did not stop within timeout")
+	}
+}
@@ -0,0 +1,101 @@
+// ABOUTME: Protocol conformance tests for the Server and Player
+// ABOUTME: Runs the protocoltest server and player suites against them
+package sendspin
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Sendspin/sendspin-go/pkg/audio/output"
+	"github.com/Sendspin/sendspin-go/pkg/protocol/protocoltest"
+)
+
+func TestServerConformance(t *testing.T) {
+	port := freePort(t)
+	server, err := NewServer(ServerConfig{
+		Port:   port,
+		Name:   "Conformance Server",
+		Source: NewTestTone(48000, 2),
+	})
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	go server.Start()
+	defer server.Stop()
+	addr := fmt.Sprintf("localhost:%d", port)
+	waitListening(t, addr)
+
+	protocoltest.RunServerSuite(t, "ws://"+addr+"/sendspin", protocoltest.ServerOptions{
+		Streams:  true,
+		Commands: clientCommands,
+	})
+}
+
+func TestPlayerConformance(t *testing.T) {
+	protocoltest.RunPlayerSuite(t, protocoltest.PlayerOptions{
+		Connect: func(addr string) (protocoltest.Player, error) {
+			player, err := NewPlayer(PlayerConfig{
+				PlayerName: "Conformance Player",
+				Volume:     80,
+				Output:     output.NewCapture(),
+			})
+			if err != nil {
+				return nil, err
+			}
+			if err := player.ConnectTo(addr); err != nil {
+				player.Close()
+				return nil, err
+			}
+			player.connMu.Lock()
+			client := player.client
+			player.connMu.Unlock()
+			return &conformancePlayer{Player: player, done: client.Done()}, nil
+		},
+		TimeSync: true,
+	})
+}
+
+// conformancePlayer is a connected Player as the player suite sees it
+type conformancePlayer struct {
+	*Player
+	done <-chan struct{}
+}
+
+// Done is closed when the player's connection closes
+func (p *conformancePlayer) Done() <-chan struct{} {
+	return p.done
+}
+
+func (p *conformancePlayer) Close() {
+	p.Player.Close()
+}
+
+// freePort returns a loopback port nothing is listening on
+func freePort(t *testing.T) int {
+	t.Helper()
+	l, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("failed to find a free port: %v", err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+// waitListening waits until a server accepts connections at addr
+func waitListening(t *testing.T, addr string) {
+	t.Helper()
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		conn, err := net.Dial("tcp", addr)
+		if err == nil {
+			conn.Close()
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("server did not start listening on %s: %v", addr, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
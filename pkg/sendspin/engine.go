@@ -0,0 +1,369 @@
+// ABOUTME: Audio engine for the Sendspin server
+// ABOUTME: Reads the source every chunk, negotiates codecs and encodes timed audio for each player
+package sendspin
+
+import (
+	"encoding/base64"
+	"log"
+	"time"
+
+	"github.com/Sendspin/sendspin-go/pkg/audio"
+	"github.com/Sendspin/sendspin-go/pkg/audio/encode"
+	"github.com/Sendspin/sendspin-go/pkg/audio/resample"
+	"github.com/Sendspin/sendspin-go/pkg/protocol"
+)
+
+// opusRate is the only sample rate the server encodes Opus at; other
+// sources are resampled per client
+const opusRate = 48000
+
+// streamAudio generates and sends audio chunks to clients
+func (s *Server) streamAudio() {
+	log.Printf("Audio streaming started")
+
+	ticker := time.NewTicker(time.Duration(ChunkDurationMs) * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.generateAndSendChunk()
+		case <-s.stopChan:
+			log.Printf("Audio streaming stopping")
+			return
+		}
+	}
+}
+
+// generateAndSendChunk generates a chunk of audio and sends it to all clients
+func (s *Server) generateAndSendChunk() {
+	// Get current timestamp + buffer ahead time
+	currentTime := s.getClockMicros()
+	playbackTime := currentTime + s.config.LeadTime.Microseconds()
+
+	// Held until the chunk is queued so Seek can't reorder around it
+	s.sourceMu.Lock()
+	defer s.sourceMu.Unlock()
+
+	if s.paused {
+		return
+	}
+
+	// Calculate chunk size based on source sample rate
+	sampleRate, channels := s.audioSource.SampleRate(), s.audioSource.Channels()
+	chunkSamples := (sampleRate * ChunkDurationMs) / 1000
+
+	// Read audio samples from source
+	samples := make([]int32, chunkSamples*channels)
+
+	seekable, isSeekable := s.audioSource.(Seekable)
+	var position time.Duration
+	if isSeekable {
+		position = seekable.Position()
+	}
+	progressTime := playbackTime
+	n, change, err := s.readSource(samples)
+	if change != nil {
+		// Progress restarts with the new source where it begins in the chunk
+		seekable, isSeekable = s.audioSource.(Seekable)
+		position = change.position
+		progressTime += int64(change.offset) * 1000000 / int64(sampleRate)
+		s.progressDirty = true
+	} else if isSeekable && seekable.Position() < position {
+		// Source looped back to the start
+		s.progressDirty = true
+	}
+	sendProgress := s.progressDirty && isSeekable
+	s.progressDirty = false
+	if err != nil && n == 0 {
+		log.Printf("Error reading audio source: %v", err)
+		return
+	}
+	if s.normalizer != nil {
+		s.normalizer.Process(samples[:n])
+		// The limiter delays audio, so this chunk starts that much earlier
+		// in the track
+		latency := time.Duration(s.normalizer.Latency()) * time.Second / time.Duration(sampleRate)
+		position = max(position-latency, 0)
+	}
+	if change != nil {
+		s.sourceChanged(change)
+	}
+
+	// Send to all clients
+	s.clientsMu.RLock()
+	defer s.clientsMu.RUnlock()
+
+	if sendProgress {
+		// The first sample of this chunk (or of a new source starting
+		// within it) plays at progressTime
+		update := s.progressUpdate("playing", progressTime, position, seekable.Duration())
+		for _, c := range s.clients {
+			c.conn.SendSessionUpdate(update)
+		}
+	}
+
+	for _, c := range s.clients {
+		if n == 0 {
+			break
+		}
+		var audioData []byte
+		var encodeErr error
+
+		c.mu.RLock()
+		codec := c.Codec
+		opusEncoder := c.OpusEncoder
+		resampler := c.resampler
+		matrix := c.matrix
+		c.mu.RUnlock()
+
+		// Mix down to the client's channels (buffer only used under sourceMu)
+		clientSamples, sent, sendChannels := samples, n, channels
+		if matrix != nil {
+			c.mixedBuf = matrix.Apply(c.mixedBuf, samples, channels)
+			clientSamples = c.mixedBuf
+			sendChannels = matrix.Outputs()
+			sent = n / channels * sendChannels
+		}
+		clientSamples = s.mixAnnouncement(c, clientSamples, matrix == nil, sendChannels, n/channels)
+
+		// Encode based on client's negotiated codec
+		switch codec {
+		case "opus":
+			if opusEncoder != nil && resampler != nil {
+				s.sendResampledOpus(c, resampler, opusEncoder, clientSamples[:sent], sendChannels, sampleRate, playbackTime)
+				continue
+			}
+			if opusEncoder != nil {
+				// Opus needs whole frames; a chunk cut short by a format
+				// change is padded with silence
+				audioData, encodeErr = opusEncoder.Encode(clientSamples)
+				if encodeErr != nil {
+					log.Printf("Opus encode error for %s: %v", c.Name, encodeErr)
+					continue
+				}
+			} else {
+				continue
+			}
+		case "pcm":
+			audioData = encodePCM(clientSamples[:sent])
+		default:
+			audioData = encodePCM(clientSamples[:sent])
+		}
+
+		if err := c.conn.SendAudioChunk(playbackTime, audioData); err != nil {
+			if s.config.Debug {
+				log.Printf("Error sending audio to %s: %v", c.Name, err)
+			}
+		}
+	}
+
+	s.advanceAnnouncement(n/channels, sampleRate, playbackTime)
+
+	if change != nil {
+		s.announceSource(change)
+	}
+}
+
+// addClientToStream adds a client to receive audio
+func (s *Server) addClientToStream(c *client) {
+	// Held so the source can't change while the client is set up
+	s.sourceMu.Lock()
+	defer s.sourceMu.Unlock()
+
+	codec := s.configureStream(c)
+	log.Printf("Added client %s with codec %s", c.Name, codec)
+
+	c.conn.SendMetadata(s.streamMetadata())
+
+	// Give the new client a progress anchor with the next chunk
+	s.progressDirty = true
+}
+
+// configureStream negotiates a codec for the current source format, sets
+// up the client's encoder and sends stream/start. Called with sourceMu held.
+func (s *Server) configureStream(c *client) string {
+	// Negotiate codec
+	codec := s.negotiateCodec(c)
+	if codec == "flac" {
+		log.Printf("FLAC streaming not supported for %s, using PCM", c.Name)
+		codec = "pcm"
+	}
+
+	// Map the source channels to the client's role, downmixing for
+	// players that take fewer channels than the source
+	sampleRate, channels := s.audioSource.SampleRate(), s.audioSource.Channels()
+	var mapping ChannelMapping
+	if stored := s.store.get(c.ID).ChannelMapping; stored != nil {
+		mapping = *stored
+	}
+	playerChannels := maxChannels(c.Capabilities, codec)
+	matrix, err := mapping.matrix(channels, playerChannels)
+	if err != nil {
+		log.Printf("Channel mapping for %s does not fit %d channels, sending all: %v", c.Name, channels, err)
+		mapping = ChannelMapping{}
+		matrix, _ = mapping.matrix(channels, playerChannels)
+	}
+	sendChannels := channels
+	if matrix != nil {
+		sendChannels = matrix.Outputs()
+	}
+
+	// Create encoder if needed, resampling for Opus when the source
+	// isn't at 48kHz
+	var opusEncoder *encode.OpusEncoder
+	var resampler *resample.Resampler
+	var codecHeader string
+	streamRate := sampleRate
+	if codec == "opus" {
+		encoder, err := encode.NewOpusEncoder(audio.Format{Codec: "opus", SampleRate: opusRate, Channels: sendChannels})
+		if err != nil {
+			log.Printf("Failed to create Opus encoder for %s, falling back to PCM: %v", c.Name, err)
+			codec = "pcm"
+		} else {
+			opusEncoder = encoder
+			codecHeader = base64.StdEncoding.EncodeToString(encoder.Header())
+			streamRate = opusRate
+			if sampleRate != opusRate {
+				resampler = resample.New(sampleRate, opusRate, sendChannels)
+				log.Printf("Resampling %dHz to 48kHz for Opus (client: %s)", sampleRate, c.Name)
+			}
+		}
+	}
+
+	c.mu.Lock()
+	if c.OpusEncoder != nil {
+		c.OpusEncoder.Close()
+	}
+	c.Codec = codec
+	c.OpusEncoder = opusEncoder
+	c.resampler = resampler
+	c.opusBuf = c.opusBuf[:0]
+	c.mapping = mapping
+	c.matrix = matrix
+	c.mu.Unlock()
+
+	streamStart := protocol.StreamStart{
+		Player: &protocol.StreamStartPlayer{
+			Codec:       codec,
+			SampleRate:  streamRate,
+			Channels:    sendChannels,
+			BitDepth:    DefaultBitDepth,
+			CodecHeader: codecHeader,
+			ChannelRole: string(mapping.role()),
+		},
+	}
+	switch mapping.role() {
+	case ChannelsCustom:
+		streamStart.Player.ChannelMatrix = mapping.Matrix
+	case ChannelsStereo:
+		streamStart.Player.ChannelLayout = audio.LayoutName(sendChannels)
+	default:
+		streamStart.Player.ChannelLayout = audio.LayoutName(1)
+	}
+	c.conn.SendStreamStart(streamStart)
+
+	return codec
+}
+
+// negotiateCodec selects the first codec in the server's preference that
+// the client supports
+func (s *Server) negotiateCodec(c *client) string {
+	if c.Capabilities == nil {
+		return "pcm"
+	}
+
+	for _, codec := range s.config.Codecs {
+		if supportsCodec(c.Capabilities, codec, s.audioSource.SampleRate()) {
+			return codec
+		}
+	}
+	return "pcm"
+}
+
+// supportsCodec reports whether a player can receive a codec for a source
+// at sourceRate. PCM is only chosen at the native rate and bit depth;
+// Opus works at any rate since the source is resampled to 48kHz.
+func supportsCodec(caps *protocol.PlayerSupport, codec string, sourceRate int) bool {
+	for _, format := range caps.SupportFormats {
+		if format.Codec != codec {
+			continue
+		}
+		if codec != "pcm" || (format.SampleRate == sourceRate && format.BitDepth == DefaultBitDepth) {
+			return true
+		}
+	}
+
+	// Legacy support
+	if codec != "pcm" {
+		for _, legacy := range caps.SupportCodecs {
+			if legacy == codec {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// maxChannels returns the most channels a player accepts for a codec.
+// Players that don't say are assumed to be stereo.
+func maxChannels(caps *protocol.PlayerSupport, codec string) int {
+	if caps == nil {
+		return 2
+	}
+	most := 0
+	for _, format := range caps.SupportFormats {
+		if format.Codec == codec {
+			most = max(most, format.Channels)
+		}
+	}
+	if most == 0 {
+		for _, channels := range caps.SupportChannels {
+			most = max(most, channels)
+		}
+	}
+	if most == 0 {
+		return 2
+	}
+	return most
+}
+
+// sendResampledOpus resamples a chunk to 48kHz for a client's Opus stream
+// and sends every whole 20ms frame. Audio short of a frame waits for the
+// next chunk, so frames are stamped from where the buffered audio starts.
+// Called with sourceMu held.
+func (s *Server) sendResampledOpus(c *client, r *resample.Resampler, encoder *encode.OpusEncoder, samples []int32, channels, sourceRate int, playbackTime int64) {
+	// Buffered audio precedes this chunk, and the filter delays it further
+	buffered := len(c.opusBuf) / channels
+	start := playbackTime - int64(buffered)*1000000/opusRate - int64(r.Latency())*1000000/int64(sourceRate)
+
+	out := make([]int32, r.OutputSamplesNeeded(len(samples)))
+	n := r.Resample(samples, out)
+	c.opusBuf = append(c.opusBuf, out[:n]...)
+
+	frame := opusRate * ChunkDurationMs / 1000 * channels
+	sent := 0
+	for ; len(c.opusBuf)-sent >= frame; sent += frame {
+		data, err := encoder.Encode(c.opusBuf[sent : sent+frame])
+		if err != nil {
+			log.Printf("Opus encode error for %s: %v", c.Name, err)
+			continue
+		}
+		timestamp := start + int64(sent/channels)*1000000/opusRate
+		if err := c.conn.SendAudioChunk(timestamp, data); err != nil && s.config.Debug {
+			log.Printf("Error sending audio to %s: %v", c.Name, err)
+		}
+	}
+	c.opusBuf = append(c.opusBuf[:0], c.opusBuf[sent:]...)
+}
+
+// encodePCM encodes int32 samples as 24-bit PCM bytes
+func encodePCM(samples []int32) []byte {
+	output := make([]byte, len(samples)*3)
+	for i, sample := range samples {
+		output[i*3] = byte(sample)
+		output[i*3+1] = byte(sample >> 8)
+		output[i*3+2] = byte(sample >> 16)
+	}
+	return output
+}
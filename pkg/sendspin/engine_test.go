@@ -0,0 +1,110 @@
+// ABOUTME: Tests for the server audio engine
+// ABOUTME: Covers Opus streams resampled from sources not at 48kHz
+package sendspin
+
+import (
+	"encoding/binary"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Sendspin/sendspin-go/pkg/protocol"
+	"github.com/gorilla/websocket"
+)
+
+func TestServerResamplesOpus(t *testing.T) {
+	server, err := NewServer(ServerConfig{Source: NewTestTone(44100, 2), Codecs: []string{"opus"}})
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	sc, conn := acceptTestConn(t, protocol.ClientHello{
+		ClientID:       "opus",
+		Name:           "opus",
+		Version:        protocol.Version,
+		SupportedRoles: []string{"player"},
+	})
+	c := &client{
+		ID:    "opus",
+		Name:  "opus",
+		Roles: []string{"player"},
+		Capabilities: &protocol.PlayerSupport{SupportFormats: []protocol.AudioFormat{
+			{Codec: "opus", Channels: 2, SampleRate: 48000, BitDepth: 16},
+		}},
+		conn: sc,
+	}
+	server.clients[c.ID] = c
+	server.addClientToStream(c)
+
+	var start protocol.StreamStart
+	if err := protocol.DecodePayload(readUntil(t, conn, "stream/start").Payload, &start); err != nil {
+		t.Fatalf("invalid stream/start: %v", err)
+	}
+	if start.Player == nil || start.Player.Codec != "opus" || start.Player.SampleRate != 48000 {
+		t.Fatalf("expected stream/start for 48kHz Opus, got %+v", start.Player)
+	}
+
+	// One second of 44.1kHz chunks, with the clock moving 20ms per chunk
+	for i := 0; i < 50; i++ {
+		server.clockStart = time.Now().Add(-time.Duration(i*ChunkDurationMs) * time.Millisecond)
+		server.generateAndSendChunk()
+	}
+
+	var timestamps []int64
+	for {
+		conn.SetReadDeadline(time.Now().Add(500 * time.Millisecond))
+		kind, data, err := conn.ReadMessage()
+		if err != nil {
+			break
+		}
+		if kind == websocket.BinaryMessage {
+			timestamps = append(timestamps, int64(binary.BigEndian.Uint64(data[1:9])))
+		}
+	}
+
+	// Audio short of a frame is held back, so at most one frame is missing
+	if len(timestamps) < 49 || len(timestamps) > 50 {
+		t.Fatalf("expected 49 or 50 Opus frames, got %d", len(timestamps))
+	}
+	for i := 1; i < len(timestamps); i++ {
+		if gap := timestamps[i] - timestamps[i-1]; gap < 19800 || gap > 20200 {
+			t.Errorf("frame %d: expected 20ms after the previous frame, got %dµs", i, gap)
+		}
+	}
+}
+
+// acceptTestConn connects a WebSocket client that sends hello, and returns
+// the server's accepted connection along with the client's end
+func acceptTestConn(t *testing.T, hello protocol.ClientHello) (*protocol.ServerConn, *websocket.Conn) {
+	t.Helper()
+
+	accepted := make(chan *websocket.Conn, 1)
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if conn, err := upgrader.Upgrade(w, r, nil); err == nil {
+			accepted <- conn
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	if err := conn.WriteJSON(protocol.Message{Type: "client/hello", Payload: hello}); err != nil {
+		t.Fatalf("failed to send hello: %v", err)
+	}
+
+	sc, err := protocol.NewServerConn(<-accepted, protocol.ServerConfig{ServerID: "test"})
+	if err != nil {
+		t.Fatalf("handshake failed: %v", err)
+	}
+	if err := sc.Accept(); err != nil {
+		t.Fatalf("accept failed: %v", err)
+	}
+	t.Cleanup(sc.Close)
+	return sc, conn
+}
@@ -0,0 +1,73 @@
+// ABOUTME: Linear gain ramps for click-free pause and resume
+// ABOUTME: Applies per-frame fades to interleaved int32 samples
+package sendspin
+
+import "time"
+
+// FadeDuration is the length of the fade applied on pause and resume
+const FadeDuration = 30 * time.Millisecond
+
+// fader ramps gain linearly towards a target, one step per frame
+type fader struct {
+	gain   float64 // Current gain (0-1)
+	target float64 // Gain being ramped towards
+	step   float64 // Gain change per frame (always positive)
+}
+
+// newFader returns a fader at unity gain
+func newFader() *fader {
+	return &fader{gain: 1, target: 1}
+}
+
+// fadeTo starts a ramp from the current gain to target over the given frames
+func (f *fader) fadeTo(target float64, frames int) {
+	f.target = target
+	if frames <= 0 {
+		f.gain = target
+		f.step = 0
+		return
+	}
+	diff := target - f.gain
+	if diff < 0 {
+		diff = -diff
+	}
+	f.step = diff / float64(frames)
+}
+
+// silent reports whether the fader has fully faded out
+func (f *fader) silent() bool {
+	return f.gain == 0 && f.target == 0
+}
+
+// apply scales interleaved samples in place, advancing the ramp per frame
+func (f *fader) apply(samples []int32, channels int) {
+	if f.gain == 1 && f.target == 1 {
+		return
+	}
+	if channels < 1 {
+		channels = 1
+	}
+
+	for i := 0; i+channels <= len(samples); i += channels {
+		for ch := 0; ch < channels; ch++ {
+			samples[i+ch] = int32(float64(samples[i+ch]) * f.gain)
+		}
+
+		if f.gain < f.target {
+			f.gain += f.step
+			if f.gain > f.target {
+				f.gain = f.target
+			}
+		} else if f.gain > f.target {
+			f.gain -= f.step
+			if f.gain < f.target {
+				f.gain = f.target
+			}
+		}
+	}
+}
+
+// fadeFrames converts FadeDuration to frames at the given sample rate
+func fadeFrames(sampleRate int) int {
+	return int(int64(sampleRate) * int64(FadeDuration) / int64(time.Second))
+}
@@ -0,0 +1,67 @@
+// ABOUTME: Tests for pause/resume gain ramps
+// ABOUTME: Verifies fade-out, fade-in and unity passthrough
+package sendspin
+
+import "testing"
+
+func TestFaderUnityPassthrough(t *testing.T) {
+	f := newFader()
+	samples := []int32{1000, -1000, 500, -500}
+
+	f.apply(samples, 2)
+
+	want := []int32{1000, -1000, 500, -500}
+	for i := range want {
+		if samples[i] != want[i] {
+			t.Errorf("sample %d: expected %d, got %d", i, want[i], samples[i])
+		}
+	}
+}
+
+func TestFaderFadeOut(t *testing.T) {
+	f := newFader()
+	f.fadeTo(0, 4)
+
+	// Stereo frames, both channels get the same gain
+	samples := make([]int32, 12)
+	for i := range samples {
+		samples[i] = 1000
+	}
+	f.apply(samples, 2)
+
+	want := []int32{1000, 1000, 750, 750, 500, 500, 250, 250, 0, 0, 0, 0}
+	for i := range want {
+		if samples[i] != want[i] {
+			t.Errorf("sample %d: expected %d, got %d", i, want[i], samples[i])
+		}
+	}
+	if !f.silent() {
+		t.Error("expected fader to be silent after fade-out")
+	}
+}
+
+func TestFaderFadeIn(t *testing.T) {
+	f := newFader()
+	f.gain = 0
+	f.fadeTo(1, 2)
+
+	if f.silent() {
+		t.Error("fader fading in should not report silent")
+	}
+
+	samples := []int32{800, 800, 800, 800}
+	f.apply(samples, 1)
+
+	want := []int32{0, 400, 800, 800}
+	for i := range want {
+		if samples[i] != want[i] {
+			t.Errorf("sample %d: expected %d, got %d", i, want[i], samples[i])
+		}
+	}
+}
+
+func TestFadeFrames(t *testing.T) {
+	if got := fadeFrames(48000); got != 1440 {
+		t.Errorf("expected 1440 frames at 48kHz, got %d", got)
+	}
+}
@@ -0,0 +1,271 @@
+// ABOUTME: Player server selection and failover
+// ABOUTME: Ranks preferred, last-used, configured and discovered servers and keeps the player connected
+package sendspin
+
+import (
+	"cmp"
+	"fmt"
+	"log"
+	"net"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/Sendspin/sendspin-go/pkg/discovery"
+	"github.com/Sendspin/sendspin-go/pkg/protocol"
+)
+
+const (
+	// failoverRetry is how long Start waits before trying the servers
+	// again when none could be reached
+	failoverRetry = 2 * time.Second
+
+	// failoverBackoff caps the wait between rounds while no server is
+	// reachable
+	failoverBackoff = 30 * time.Second
+)
+
+// Start keeps the player connected: it connects to the best available
+// server (see Servers), fails over to the next one when the server goes
+// away, and moves back to the preferred server when it appears. Start
+// returns at once; Close stops it. Servers may also connect to the
+// player (see Listen) while it is not connected.
+func (p *Player) Start() error {
+	if !p.started.CompareAndSwap(false, true) {
+		return fmt.Errorf("already started")
+	}
+
+	var events <-chan discovery.Event
+	if p.config.Discovery != nil {
+		events = p.config.Discovery.Events()
+	}
+	go p.supervise(events)
+	return nil
+}
+
+// Servers lists the servers the player knows, in the order Start tries
+// them: the preferred server, the last one used, ServerAddr and the
+// fallback servers, then other discovered servers. Servers from
+// configured addresses have no ID.
+func (p *Player) Servers() []discovery.ServerInfo {
+	var discovered []discovery.ServerInfo
+	if p.config.Discovery != nil {
+		discovered = p.config.Discovery.Servers()
+	}
+
+	p.connMu.Lock()
+	preferred, last := p.preferred, p.lastServer
+	p.connMu.Unlock()
+
+	configured := append([]string{p.config.ServerAddr}, p.config.FallbackServers...)
+	return rankServers(preferred, last, configured, discovered)
+}
+
+// SwitchServer moves the player to another server, given by ID, name or
+// address (host:port), and makes it the preferred server so failover
+// returns to it. The current session ends first.
+func (p *Player) SwitchServer(target string) error {
+	addr := target
+	for _, server := range p.Servers() {
+		if matchServer(server, target) {
+			addr = server.Address()
+			break
+		}
+	}
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return fmt.Errorf("unknown server %q", target)
+	}
+
+	p.connMu.Lock()
+	p.preferred = target
+	current := p.state.Connected && p.state.Server == addr
+	p.connMu.Unlock()
+
+	if current {
+		return nil
+	}
+	return p.switchTo(addr)
+}
+
+// supervise connects whenever the player is disconnected, backing off
+// while no server answers
+func (p *Player) supervise(events <-chan discovery.Event) {
+	retry := time.NewTimer(0)
+	defer retry.Stop()
+	backoff := failoverRetry
+
+	for {
+		select {
+		case <-p.disconnected:
+			backoff = failoverRetry
+			retry.Reset(0)
+
+		case event := <-events:
+			switch {
+			case event.Type == discovery.ServerRemoved:
+			case !p.connected():
+				retry.Reset(0) // A new candidate: try now
+			case event.Type == discovery.ServerAdded && p.isPreferred(event.Server) && !p.onPreferred():
+				log.Printf("Preferred server %s appeared, switching to it", event.Server.Name)
+				p.switchTo(event.Server.Address())
+			}
+
+		case <-retry.C:
+			if p.connected() || p.connectAny() {
+				backoff = failoverRetry
+				continue
+			}
+			retry.Reset(backoff)
+			backoff = min(backoff*2, failoverBackoff)
+
+		case <-p.ctx.Done():
+			return
+		}
+	}
+}
+
+// connectAny connects to the first server that answers, in Servers order
+func (p *Player) connectAny() bool {
+	for _, server := range p.Servers() {
+		if p.connected() {
+			return true // A server connected to the player, or a switch won
+		}
+		if err := p.ConnectTo(server.Address()); err != nil {
+			log.Printf("Server %s unavailable: %v", serverLabel(server), err)
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+// switchTo ends the current session and connects to addr. If that fails
+// the supervisor fails over as if the server had gone away.
+func (p *Player) switchTo(addr string) error {
+	p.dialMu.Lock()
+	defer p.dialMu.Unlock()
+
+	// Ending the session first keeps watchConnection from waking the
+	// supervisor
+	p.connMu.Lock()
+	c := p.client
+	p.connMu.Unlock()
+	if c != nil {
+		p.endSession(c)
+		c.Close()
+	}
+
+	if err := p.connectTo(addr); err != nil {
+		p.wakeSupervisor()
+		return err
+	}
+	return nil
+}
+
+// wakeSupervisor tells Start's supervisor the session ended
+func (p *Player) wakeSupervisor() {
+	select {
+	case p.disconnected <- struct{}{}:
+	default:
+	}
+}
+
+// isPreferred reports whether a server is the preferred one
+func (p *Player) isPreferred(server discovery.ServerInfo) bool {
+	p.connMu.Lock()
+	defer p.connMu.Unlock()
+	return matchServer(server, p.preferred)
+}
+
+// onPreferred reports whether the connected server is the preferred one
+func (p *Player) onPreferred() bool {
+	p.connMu.Lock()
+	defer p.connMu.Unlock()
+	return p.preferred == "" || p.preferred == p.state.ServerID ||
+		p.preferred == p.state.ServerName || p.preferred == p.state.Server
+}
+
+// rememberServer records the server the player connected to, persisting
+// it when a state file is configured
+func (p *Player) rememberServer(hello protocol.ServerHello, addr string) {
+	p.connMu.Lock()
+	p.lastServer = &savedServer{ID: hello.ServerID, Name: hello.Name, Addr: addr}
+	p.connMu.Unlock()
+	p.saveState()
+}
+
+// rankServers orders candidate servers: the preferred server first, then
+// the last one used (at its discovered address if it moved), configured
+// addresses, and the other discovered servers. Duplicates are dropped.
+func rankServers(preferred string, last *savedServer, configured []string, discovered []discovery.ServerInfo) []discovery.ServerInfo {
+	var all []discovery.ServerInfo
+	if last != nil {
+		if server, ok := serverAt(last.Addr); ok {
+			server.ID, server.Name = last.ID, cmp.Or(last.Name, server.Name)
+			for _, d := range discovered {
+				if last.ID != "" && d.ID == last.ID {
+					server = d
+				}
+			}
+			all = append(all, server)
+		}
+	}
+	for _, addr := range configured {
+		if server, ok := serverAt(addr); ok {
+			all = append(all, server)
+		}
+	}
+	all = append(all, discovered...)
+
+	// The preferred server moves to the front, keeping the order otherwise
+	slices.SortStableFunc(all, func(a, b discovery.ServerInfo) int {
+		pa, pb := matchServer(a, preferred), matchServer(b, preferred)
+		switch {
+		case pa && !pb:
+			return -1
+		case pb && !pa:
+			return 1
+		}
+		return 0
+	})
+
+	var ranked []discovery.ServerInfo
+	seen := make(map[string]bool)
+	for _, server := range all {
+		if seen[server.Address()] || (server.ID != "" && seen["id:"+server.ID]) {
+			continue
+		}
+		seen[server.Address()] = true
+		if server.ID != "" {
+			seen["id:"+server.ID] = true
+		}
+		ranked = append(ranked, server)
+	}
+	return ranked
+}
+
+// serverAt describes a configured host:port address
+func serverAt(addr string) (discovery.ServerInfo, bool) {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil || host == "" {
+		return discovery.ServerInfo{}, false
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return discovery.ServerInfo{}, false
+	}
+	return discovery.ServerInfo{Name: addr, Host: host, Port: port, Path: discovery.DefaultPath}, true
+}
+
+// matchServer reports whether a server has the given ID, name or address
+func matchServer(server discovery.ServerInfo, target string) bool {
+	return target != "" && (server.ID == target || server.Name == target || server.Address() == target)
+}
+
+// serverLabel names a server in logs
+func serverLabel(server discovery.ServerInfo) string {
+	if server.Name == server.Address() {
+		return server.Name
+	}
+	return fmt.Sprintf("%s (%s)", server.Name, server.Address())
+}
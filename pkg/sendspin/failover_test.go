@@ -0,0 +1,146 @@
+// ABOUTME: Tests for player server selection and failover
+// ABOUTME: Covers candidate ranking and failing over between servers
+package sendspin
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Sendspin/sendspin-go/pkg/audio/output"
+	"github.com/Sendspin/sendspin-go/pkg/discovery"
+)
+
+func TestRankServers(t *testing.T) {
+	kitchen := discovery.ServerInfo{ID: "id-kitchen", Name: "Kitchen", Host: "10.0.0.5", Port: 8927}
+	den := discovery.ServerInfo{ID: "id-den", Name: "Den", Host: "10.0.0.6", Port: 8927}
+	last := &savedServer{ID: "id-den", Name: "Den", Addr: "10.0.0.9:8927"}
+	configured := []string{"", "10.0.0.7:8927", "10.0.0.5:8927", "not-an-address"}
+
+	addrs := func(servers []discovery.ServerInfo) []string {
+		var out []string
+		for _, s := range servers {
+			out = append(out, s.Address())
+		}
+		return out
+	}
+
+	// The last server is tried at its discovered address, and a configured
+	// address matching a discovered server is listed once
+	got := addrs(rankServers("", last, configured, []discovery.ServerInfo{kitchen, den}))
+	want := []string{"10.0.0.6:8927", "10.0.0.7:8927", "10.0.0.5:8927"}
+	if len(got) != len(want) {
+		t.Fatalf("Expected %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("Expected %v, got %v", want, got)
+		}
+	}
+
+	// The preferred server, by name, comes first
+	ranked := rankServers("Kitchen", last, configured, []discovery.ServerInfo{kitchen, den})
+	if ranked[0].ID != "id-kitchen" {
+		t.Errorf("Expected preferred server first, got %v", addrs(ranked))
+	}
+
+	// Without discovery the last server keeps its saved address
+	ranked = rankServers("", last, nil, nil)
+	if len(ranked) != 1 || ranked[0].Address() != "10.0.0.9:8927" || ranked[0].Name != "Den" {
+		t.Errorf("Expected saved last server, got %+v", ranked)
+	}
+}
+
+func TestPlayerFailover(t *testing.T) {
+	startServer := func(port int, name string) (*Server, chan error) {
+		server, err := NewServer(ServerConfig{Port: port, Name: name, Source: NewTestTone(48000, 2)})
+		if err != nil {
+			t.Fatalf("failed to create server: %v", err)
+		}
+		errChan := make(chan error, 1)
+		go func() {
+			errChan <- server.Start()
+		}()
+		return server, errChan
+	}
+	stopServer := func(server *Server, errChan chan error) {
+		server.Stop()
+		select {
+		case <-errChan:
+		case <-time.After(5 * time.Second):
+			t.Error("server did not stop within timeout")
+		}
+	}
+
+	primary, primaryErr := startServer(8944, "Primary")
+	backup, backupErr := startServer(8945, "Backup")
+	defer stopServer(backup, backupErr)
+	time.Sleep(200 * time.Millisecond)
+
+	stateFile := filepath.Join(t.TempDir(), "player.json")
+	states := make(chan PlayerState, 100)
+	player, err := NewPlayer(PlayerConfig{
+		ServerAddr:      "127.0.0.1:8944",
+		FallbackServers: []string{"127.0.0.1:8945"},
+		StateFile:       stateFile,
+		PlayerName:      "Speaker",
+		Output:          output.NewCapture(),
+		OnStateChange:   func(s PlayerState) { states <- s },
+	})
+	if err != nil {
+		t.Fatalf("failed to create player: %v", err)
+	}
+	defer player.Close()
+
+	waitFor := func(name string) {
+		t.Helper()
+		timeout := time.After(10 * time.Second)
+		for {
+			select {
+			case s := <-states:
+				if s.Connected && s.ServerName == name {
+					return
+				}
+			case <-timeout:
+				t.Fatalf("player did not connect to %s", name)
+			}
+		}
+	}
+
+	if err := player.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	if err := player.Start(); err == nil {
+		t.Error("expected error starting twice")
+	}
+	waitFor("Primary")
+
+	// The primary goes away and the player moves to the backup
+	stopServer(primary, primaryErr)
+	waitFor("Backup")
+
+	// The state file is written just after the connection is reported
+	var st playerStateFile
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(20 * time.Millisecond) {
+		if st, err = loadPlayerState(stateFile); err == nil && st.LastServer != nil && st.LastServer.Name == "Backup" {
+			break
+		}
+	}
+	if st.LastServer == nil || st.LastServer.Name != "Backup" || st.LastServer.Addr != "127.0.0.1:8945" {
+		t.Errorf("Expected backup saved as the last server, got %+v, %v", st.LastServer, err)
+	}
+
+	// Switching to the primary's address brings the player back when it
+	// returns
+	primary, primaryErr = startServer(8944, "Primary")
+	defer stopServer(primary, primaryErr)
+	time.Sleep(200 * time.Millisecond)
+	if err := player.SwitchServer("127.0.0.1:8944"); err != nil {
+		t.Fatalf("SwitchServer failed: %v", err)
+	}
+	waitFor("Primary")
+
+	if err := player.SwitchServer("Nowhere"); err == nil {
+		t.Error("expected error switching to an unknown server")
+	}
+}
@@ -1,6 +1,6 @@
-// ABOUTME: Audio source abstraction for streaming from files or generating test tones
-// ABOUTME: Supports MP3, FLAC, WAV files with automatic decoding
-package server
+// ABOUTME: File and URL audio sources decoded for streaming
+// ABOUTME: Supports MP3, FLAC and WAV files, HTTP MP3 streams and ffmpeg-decoded HLS
+package sendspin
 
 import (
 	"bufio"
@@ -12,34 +12,21 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/Sendspin/sendspin-go/pkg/audio"
+	"github.com/Sendspin/sendspin-go/pkg/audio/loudness"
 	"github.com/hajimehoshi/go-mp3"
 	"github.com/mewkiz/flac"
+	flacframe "github.com/mewkiz/flac/frame"
 )
 
-// AudioSource provides PCM audio samples
-type AudioSource interface {
-	// Read reads PCM samples into the buffer (int32 for 24-bit support). Returns number of samples read or error.
-	Read(samples []int32) (int, error)
-	// SampleRate returns the sample rate of the audio
-	SampleRate() int
-	// Channels returns the number of channels
-	Channels() int
-	// Metadata returns title, artist, album
-	Metadata() (title, artist, album string)
-	// Close closes the audio source
-	Close() error
-}
-
-// NewAudioSource creates an audio source from a file path or HTTP URL
-// If path is empty, returns a test tone generator
-// Automatically resamples to 48kHz if needed for Opus compatibility
-func NewAudioSource(pathOrURL string) (AudioSource, error) {
-	if pathOrURL == "" {
-		return NewTestToneSource(), nil
-	}
-
+// openSource opens a file path or HTTP(S) URL, choosing the decoder by
+// scheme and file extension. Sources keep their native sample rate; the
+// server resamples per client where a codec needs it.
+func openSource(pathOrURL string) (AudioSource, error) {
 	var source AudioSource
 	var err error
 
@@ -80,29 +67,54 @@ func NewAudioSource(pathOrURL string) (AudioSource, error) {
 			if err != nil {
 				return nil, err
 			}
+		case ".wav":
+			source, err = NewWAVSource(pathOrURL)
+			if err != nil {
+				return nil, err
+			}
 		default:
-			return nil, fmt.Errorf("unsupported audio format: %s (supported: .mp3, .flac)", ext)
+			return nil, fmt.Errorf("unsupported audio format: %s (supported: .mp3, .flac, .wav)", ext)
 		}
 	}
 
-	// Note: We no longer auto-resample here. Sources are kept at native sample rate.
-	// If Opus encoding is needed and source isn't 48kHz, resampling happens per-client in audio engine.
-	// This allows PCM clients to receive hi-res audio at native rates!
-
 	return source, nil
 }
 
+// durationToSamples converts a duration to a PCM frame count at the given rate
+func durationToSamples(d time.Duration, sampleRate int) int64 {
+	return int64(d) * int64(sampleRate) / int64(time.Second)
+}
+
+// samplesToDuration converts a PCM frame count to a duration at the given rate
+func samplesToDuration(samples int64, sampleRate int) time.Duration {
+	if sampleRate <= 0 {
+		return 0
+	}
+	return time.Duration(samples * int64(time.Second) / int64(sampleRate))
+}
+
 // MP3Source reads from an MP3 file
 type MP3Source struct {
 	file       *os.File
+	path       string
 	decoder    *mp3.Decoder
 	sampleRate int
 	channels   int
 	title      string
 	artist     string
 	album      string
+	replayGain *loudness.Info // From ID3 tags, nil if untagged
+
+	// Seeking: toc is set when the file has a Xing/Info or VBRI header with a
+	// seek table; otherwise decoder.Seek is used (go-mp3 indexes every frame).
+	toc          *mp3TOC
+	totalSamples int64 // PCM frames in the track (0 if unknown)
+	position     int64 // PCM frames delivered since the start of the track
 }
 
+// readerOnly hides io.Seeker so go-mp3 skips its full-file frame scan
+type readerOnly struct{ io.Reader }
+
 // NewMP3Source creates a new MP3 audio source
 func NewMP3Source(filePath string) (*MP3Source, error) {
 	f, err := os.Open(filePath)
@@ -110,27 +122,52 @@ func NewMP3Source(filePath string) (*MP3Source, error) {
 		return nil, fmt.Errorf("failed to open MP3 file: %w", err)
 	}
 
-	decoder, err := mp3.NewDecoder(f)
+	var fileSize int64
+	if fi, err := f.Stat(); err == nil {
+		fileSize = fi.Size()
+	}
+
+	toc, err := readMP3TOC(f, fileSize)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to read MP3 header: %w", err)
+	}
+
+	s := &MP3Source{
+		file:       f,
+		path:       filePath,
+		channels:   2, // MP3 decoder outputs stereo
+		artist:     "Unknown Artist",
+		album:      "Unknown Album",
+		replayGain: replayGainFromTags(readID3Tags(f)),
+	}
+
+	if toc != nil && len(toc.points) > 0 {
+		// The TOC gives us duration and seek offsets, no need to scan the file
+		s.toc = toc
+		s.totalSamples = toc.totalSamples
+		s.decoder, err = mp3.NewDecoder(readerOnly{f})
+	} else {
+		s.decoder, err = mp3.NewDecoder(f)
+		if err == nil {
+			if length := s.decoder.Length(); length > 0 {
+				s.totalSamples = length / 4 // 16-bit stereo
+			}
+		}
+	}
 	if err != nil {
 		f.Close()
 		return nil, fmt.Errorf("failed to decode MP3: %w", err)
 	}
+	s.sampleRate = s.decoder.SampleRate()
 
 	// Extract filename as title
 	filename := filepath.Base(filePath)
-	title := strings.TrimSuffix(filename, filepath.Ext(filename))
+	s.title = strings.TrimSuffix(filename, filepath.Ext(filename))
 
-	log.Printf("Loaded MP3: %s (sample rate: %d Hz)", title, decoder.SampleRate())
+	log.Printf("Loaded MP3: %s (sample rate: %d Hz, duration: %v)", s.title, s.sampleRate, s.Duration())
 
-	return &MP3Source{
-		file:       f,
-		decoder:    decoder,
-		sampleRate: decoder.SampleRate(),
-		channels:   2, // MP3 decoder outputs stereo
-		title:      title,
-		artist:     "Unknown Artist",
-		album:      "Unknown Album",
-	}, nil
+	return s, nil
 }
 
 func (s *MP3Source) Read(samples []int32) (int, error) {
@@ -151,28 +188,78 @@ func (s *MP3Source) Read(samples []int32) (int, error) {
 		// Example: 32767 (max 16-bit) << 8 = 8388352 (near max 24-bit 8388607)
 		samples[i] = int32(sample16) << 8
 	}
+	s.position += int64(numSamples / s.channels)
 
 	if err == io.EOF {
 		// Loop the audio - seek back to start
-		if _, seekErr := s.file.Seek(0, 0); seekErr != nil {
+		if seekErr := s.Seek(0); seekErr != nil {
 			return numSamples, fmt.Errorf("failed to seek to start: %w", seekErr)
 		}
-		// Create new decoder
-		newDecoder, decErr := mp3.NewDecoder(s.file)
-		if decErr != nil {
-			return numSamples, fmt.Errorf("failed to create new decoder: %w", decErr)
-		}
-		s.decoder = newDecoder
 	}
 
 	return numSamples, nil
 }
 
+// Seek moves playback to the given position in the track
+func (s *MP3Source) Seek(position time.Duration) error {
+	target := durationToSamples(position, s.sampleRate)
+	if target < 0 {
+		target = 0
+	}
+	if s.totalSamples > 0 && target > s.totalSamples {
+		target = s.totalSamples
+	}
+
+	if s.toc != nil {
+		offset, _ := s.toc.offsetFor(target)
+		if _, err := s.file.Seek(s.toc.dataStart+offset, io.SeekStart); err != nil {
+			return fmt.Errorf("failed to seek MP3 file: %w", err)
+		}
+		// A fresh decoder resyncs on the next frame header after the offset
+		decoder, err := mp3.NewDecoder(readerOnly{s.file})
+		if err != nil {
+			return fmt.Errorf("failed to create new decoder: %w", err)
+		}
+		s.decoder = decoder
+		s.position = target
+		return nil
+	}
+
+	if s.decoder.Length() < 0 {
+		return fmt.Errorf("MP3 stream is not seekable")
+	}
+	if _, err := s.decoder.Seek(target*4, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to seek MP3 decoder: %w", err)
+	}
+	s.position = target
+	return nil
+}
+
+// Position returns the current playback position in the track
+func (s *MP3Source) Position() time.Duration {
+	return samplesToDuration(s.position, s.sampleRate)
+}
+
+// Duration returns the track length, or 0 if unknown
+func (s *MP3Source) Duration() time.Duration {
+	return samplesToDuration(s.totalSamples, s.sampleRate)
+}
+
 func (s *MP3Source) SampleRate() int { return s.sampleRate }
 func (s *MP3Source) Channels() int   { return s.channels }
 func (s *MP3Source) Metadata() (string, string, string) {
 	return s.title, s.artist, s.album
 }
+func (s *MP3Source) Path() string { return s.path }
+
+// Loudness returns the ReplayGain values from the file's ID3 tags
+func (s *MP3Source) Loudness() (loudness.Info, bool) {
+	if s.replayGain == nil {
+		return loudness.Info{}, false
+	}
+	return *s.replayGain, true
+}
+
 func (s *MP3Source) Close() error {
 	return s.file.Close()
 }
@@ -180,6 +267,7 @@ func (s *MP3Source) Close() error {
 // FLACSource reads from a FLAC file
 type FLACSource struct {
 	file       *os.File
+	path       string
 	stream     *flac.Stream
 	sampleRate int
 	channels   int
@@ -187,10 +275,14 @@ type FLACSource struct {
 	title      string
 	artist     string
 	album      string
+	replayGain *loudness.Info // From Vorbis comments, nil if untagged
 
 	// Buffer for partial frames (FLAC frames may not align with chunk boundaries)
 	frameBuffer    []int32
 	frameBufferPos int
+
+	totalSamples int64 // PCM frames in the track (0 if unknown)
+	position     int64 // PCM frames delivered since the start of the track
 }
 
 // NewFLACSource creates a new FLAC audio source
@@ -200,7 +292,8 @@ func NewFLACSource(filePath string) (*FLACSource, error) {
 		return nil, fmt.Errorf("failed to open FLAC file: %w", err)
 	}
 
-	stream, err := flac.New(f)
+	// NewSeek uses the SEEKTABLE when present and builds one on first seek otherwise
+	stream, err := flac.NewSeek(f)
 	if err != nil {
 		f.Close()
 		return nil, fmt.Errorf("failed to decode FLAC: %w", err)
@@ -219,119 +312,136 @@ func NewFLACSource(filePath string) (*FLACSource, error) {
 	log.Printf("Loaded FLAC: %s (sample rate: %d Hz, channels: %d, bit depth: %d)",
 		title, sampleRate, channels, bitDepth)
 
+	var replayGain *loudness.Info
+	if tags, err := readFLACTags(filePath); err == nil {
+		replayGain = replayGainFromTags(tags)
+	} else {
+		log.Printf("Failed to read FLAC tags: %v", err)
+	}
+
 	return &FLACSource{
-		file:       f,
-		stream:     stream,
-		sampleRate: sampleRate,
-		channels:   channels,
-		bitDepth:   bitDepth,
-		title:      title,
-		artist:     "Unknown Artist",
-		album:      "Unknown Album",
+		file:         f,
+		path:         filePath,
+		replayGain:   replayGain,
+		stream:       stream,
+		sampleRate:   sampleRate,
+		channels:     channels,
+		bitDepth:     bitDepth,
+		title:        title,
+		artist:       "Unknown Artist",
+		album:        "Unknown Album",
+		totalSamples: int64(info.NSamples),
 	}, nil
 }
 
 func (s *FLACSource) Read(samples []int32) (int, error) {
 	samplesRead := 0
 
-	// First, drain any buffered samples from previous partial frame
-	if s.frameBuffer != nil && s.frameBufferPos < len(s.frameBuffer) {
-		available := len(s.frameBuffer) - s.frameBufferPos
-		toCopy := len(samples)
-		if toCopy > available {
-			toCopy = available
-		}
-
-		copy(samples[samplesRead:], s.frameBuffer[s.frameBufferPos:s.frameBufferPos+toCopy])
-		samplesRead += toCopy
-		s.frameBufferPos += toCopy
-
-		// If we've filled the output buffer, we're done
-		if samplesRead >= len(samples) {
-			return samplesRead, nil
-		}
-
-		// If we've consumed all buffered samples, clear the buffer
-		if s.frameBufferPos >= len(s.frameBuffer) {
-			s.frameBuffer = nil
-			s.frameBufferPos = 0
+	for samplesRead < len(samples) {
+		// Drain any buffered samples from a previous partial frame (or a seek)
+		if s.frameBufferPos < len(s.frameBuffer) {
+			toCopy := copy(samples[samplesRead:], s.frameBuffer[s.frameBufferPos:])
+			samplesRead += toCopy
+			s.frameBufferPos += toCopy
+			s.position += int64(toCopy / s.channels)
+			continue
 		}
-	}
 
-	// Read new FLAC frames as needed
-	for samplesRead < len(samples) {
 		// Parse next frame
 		frame, err := s.stream.ParseNext()
 		if err != nil {
 			if err == io.EOF {
 				// Loop back to start
-				if _, seekErr := s.file.Seek(0, 0); seekErr != nil {
+				if seekErr := s.Seek(0); seekErr != nil {
 					return samplesRead, fmt.Errorf("failed to seek to start: %w", seekErr)
 				}
-				// Create new stream
-				newStream, decErr := flac.New(s.file)
-				if decErr != nil {
-					return samplesRead, fmt.Errorf("failed to create new stream: %w", decErr)
-				}
-				s.stream = newStream
-				s.frameBuffer = nil
-				s.frameBufferPos = 0
 				continue
 			}
 			return samplesRead, err
 		}
 
-		// Convert entire frame to int32 24-bit range
-		frameSize := int(frame.BlockSize) * s.channels
-		frameSamples := make([]int32, frameSize)
-		frameIdx := 0
-
-		for i := 0; i < int(frame.BlockSize); i++ {
-			for ch := 0; ch < s.channels; ch++ {
-				sample := frame.Subframes[ch].Samples[i]
-
-				// Convert to int32 24-bit range
-				var converted int32
-				if s.bitDepth == 16 {
-					// Convert 16-bit to 24-bit range
-					converted = sample << 8
-				} else if s.bitDepth == 24 {
-					// Already 24-bit, use directly
-					converted = sample
+		// Convert entire frame to int32 24-bit range; leftovers stay buffered for next Read()
+		s.frameBuffer = s.convertFrame(frame)
+		s.frameBufferPos = 0
+	}
+
+	return samplesRead, nil
+}
+
+// convertFrame interleaves a decoded frame into int32 samples in 24-bit range
+func (s *FLACSource) convertFrame(frame *flacframe.Frame) []int32 {
+	frameSamples := make([]int32, int(frame.BlockSize)*s.channels)
+	frameIdx := 0
+
+	for i := 0; i < int(frame.BlockSize); i++ {
+		for ch := 0; ch < s.channels; ch++ {
+			sample := frame.Subframes[ch].Samples[i]
+
+			// Convert to int32 24-bit range
+			var converted int32
+			if s.bitDepth == 16 {
+				// Convert 16-bit to 24-bit range
+				converted = sample << 8
+			} else if s.bitDepth == 24 {
+				// Already 24-bit, use directly
+				converted = sample
+			} else {
+				// For other bit depths, scale to 24-bit range
+				shift := s.bitDepth - 24
+				if shift > 0 {
+					converted = sample >> shift
 				} else {
-					// For other bit depths, scale to 24-bit range
-					shift := s.bitDepth - 24
-					if shift > 0 {
-						converted = sample >> shift
-					} else {
-						converted = sample << -shift
-					}
+					converted = sample << -shift
 				}
-
-				frameSamples[frameIdx] = converted
-				frameIdx++
 			}
-		}
 
-		// Copy as much as we can to the output buffer
-		remaining := len(samples) - samplesRead
-		toCopy := frameSize
-		if toCopy > remaining {
-			toCopy = remaining
+			frameSamples[frameIdx] = converted
+			frameIdx++
 		}
+	}
 
-		copy(samples[samplesRead:], frameSamples[:toCopy])
-		samplesRead += toCopy
+	return frameSamples
+}
 
-		// If there are leftover samples, buffer them for next Read()
-		if toCopy < frameSize {
-			s.frameBuffer = frameSamples
-			s.frameBufferPos = toCopy
-			break
-		}
+// Seek moves playback to the given position in the track
+func (s *FLACSource) Seek(position time.Duration) error {
+	target := durationToSamples(position, s.sampleRate)
+	if target < 0 {
+		target = 0
+	}
+	if s.totalSamples > 0 && target >= s.totalSamples {
+		target = s.totalSamples - 1
 	}
 
-	return samplesRead, nil
+	// Seek lands on the start of the frame containing target
+	frameStart, err := s.stream.Seek(uint64(target))
+	if err != nil {
+		return fmt.Errorf("failed to seek FLAC stream: %w", err)
+	}
+
+	frame, err := s.stream.ParseNext()
+	if err != nil {
+		return fmt.Errorf("failed to decode FLAC frame after seek: %w", err)
+	}
+
+	// Buffer the frame and skip the samples before the target
+	s.frameBuffer = s.convertFrame(frame)
+	s.frameBufferPos = int(int64(target)-int64(frameStart)) * s.channels
+	if s.frameBufferPos > len(s.frameBuffer) {
+		s.frameBufferPos = len(s.frameBuffer)
+	}
+	s.position = target
+	return nil
+}
+
+// Position returns the current playback position in the track
+func (s *FLACSource) Position() time.Duration {
+	return samplesToDuration(s.position, s.sampleRate)
+}
+
+// Duration returns the track length, or 0 if unknown
+func (s *FLACSource) Duration() time.Duration {
+	return samplesToDuration(s.totalSamples, s.sampleRate)
 }
 
 func (s *FLACSource) SampleRate() int { return s.sampleRate }
@@ -339,6 +449,16 @@ func (s *FLACSource) Channels() int   { return s.channels }
 func (s *FLACSource) Metadata() (string, string, string) {
 	return s.title, s.artist, s.album
 }
+func (s *FLACSource) Path() string { return s.path }
+
+// Loudness returns the ReplayGain values from the file's Vorbis comments
+func (s *FLACSource) Loudness() (loudness.Info, bool) {
+	if s.replayGain == nil {
+		return loudness.Info{}, false
+	}
+	return *s.replayGain, true
+}
+
 func (s *FLACSource) Close() error {
 	return s.file.Close()
 }
@@ -380,7 +500,7 @@ func NewHTTPMP3Source(url string) (*HTTPMP3Source, error) {
 		response:   resp,
 		decoder:    decoder,
 		sampleRate: decoder.SampleRate(),
-		channels:   2, // MP3 decoder outputs stereo
+		channels:   2, // MP3 is at most stereo; the decoder always outputs two channels
 		title:      "HTTP Stream",
 	}, nil
 }
@@ -438,15 +558,16 @@ func NewFFmpegSource(url string) (*FFmpegSource, error) {
 		return nil, fmt.Errorf("ffmpeg not found in PATH: %w (install with: brew install ffmpeg)", err)
 	}
 
-	// Fixed output format for consistency
+	// Fixed sample rate for consistency; surround streams keep their
+	// channels (up to 7.1)
 	sampleRate := 48000
-	channels := 2
+	channels := probeChannels(url)
 
 	// Start ffmpeg to decode the stream
 	// -i <url>: input URL
 	// -f s16le: output format (signed 16-bit little-endian PCM)
 	// -ar 48000: output sample rate
-	// -ac 2: output channels (stereo)
+	// -ac N: output channels
 	// -: output to stdout
 	cmd := exec.Command("ffmpeg",
 		"-loglevel", "error", // Only show errors
@@ -480,6 +601,26 @@ func NewFFmpegSource(url string) (*FFmpegSource, error) {
 	}, nil
 }
 
+// probeChannels asks ffprobe for the channel count of the first audio
+// stream, capped at audio.MaxChannels. It returns 2 (stereo) when
+// ffprobe is missing or fails.
+func probeChannels(url string) int {
+	out, err := exec.Command("ffprobe",
+		"-v", "error",
+		"-select_streams", "a:0",
+		"-show_entries", "stream=channels",
+		"-of", "default=noprint_wrappers=1:nokey=1",
+		url).Output()
+	if err != nil {
+		return 2
+	}
+	channels, err := strconv.Atoi(strings.TrimSpace(string(out)))
+	if err != nil || channels < 1 {
+		return 2
+	}
+	return min(channels, audio.MaxChannels)
+}
+
 func (s *FFmpegSource) Read(samples []int32) (int, error) {
 	// Read raw PCM bytes from ffmpeg stdout
 	numBytes := len(samples) * 2 // int16 = 2 bytes
@@ -516,65 +657,3 @@ func (s *FFmpegSource) Close() error {
 	}
 	return nil
 }
-
-// ResampledSource wraps an AudioSource and resamples to a target sample rate
-type ResampledSource struct {
-	source       AudioSource
-	resampler    *Resampler
-	targetRate   int
-	inputBuffer  []int32
-	outputBuffer []int32
-}
-
-// NewResampledSource creates a resampling wrapper around an audio source
-func NewResampledSource(source AudioSource, targetRate int) *ResampledSource {
-	inputRate := source.SampleRate()
-	channels := source.Channels()
-
-	// Calculate buffer sizes for 100ms chunks
-	inputSamples := (inputRate * channels * 100) / 1000
-	outputSamples := (targetRate * channels * 100) / 1000
-
-	return &ResampledSource{
-		source:       source,
-		resampler:    NewResampler(inputRate, targetRate, channels),
-		targetRate:   targetRate,
-		inputBuffer:  make([]int32, inputSamples),
-		outputBuffer: make([]int32, outputSamples*2), // Extra space for safety
-	}
-}
-
-func (r *ResampledSource) Read(samples []int32) (int, error) {
-	// Calculate how many input samples we need
-	neededInput := r.resampler.InputSamplesNeeded(len(samples))
-	if neededInput > len(r.inputBuffer) {
-		neededInput = len(r.inputBuffer)
-	}
-
-	// Read from underlying source
-	n, err := r.source.Read(r.inputBuffer[:neededInput])
-	if err != nil && err != io.EOF {
-		return 0, err
-	}
-
-	// Resample to output
-	outputSamples := r.resampler.Resample(r.inputBuffer[:n], samples)
-
-	return outputSamples, nil
-}
-
-func (r *ResampledSource) SampleRate() int {
-	return r.targetRate
-}
-
-func (r *ResampledSource) Channels() int {
-	return r.source.Channels()
-}
-
-func (r *ResampledSource) Metadata() (string, string, string) {
-	return r.source.Metadata()
-}
-
-func (r *ResampledSource) Close() error {
-	return r.source.Close()
-}
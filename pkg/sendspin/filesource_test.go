@@ -0,0 +1,480 @@
+// ABOUTME: Tests for file audio sources
+// ABOUTME: Verifies WAV/FLAC decoding, seeking, position and duration reporting
+package sendspin
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mewkiz/flac"
+	"github.com/mewkiz/flac/frame"
+	"github.com/mewkiz/flac/meta"
+)
+
+// writeTestWAV writes a 16-bit WAV whose left channel is the frame index
+// (mod 32768) and right channel its negation
+func writeTestWAV(t *testing.T, sampleRate, frames int) string {
+	t.Helper()
+
+	var data bytes.Buffer
+	for i := 0; i < frames; i++ {
+		v := int16(i % 32768)
+		binary.Write(&data, binary.LittleEndian, v)
+		binary.Write(&data, binary.LittleEndian, -v)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("RIFF")
+	binary.Write(&buf, binary.LittleEndian, uint32(36+data.Len()))
+	buf.WriteString("WAVE")
+	buf.WriteString("fmt ")
+	binary.Write(&buf, binary.LittleEndian, uint32(16))
+	binary.Write(&buf, binary.LittleEndian, uint16(wavFormatPCM))
+	binary.Write(&buf, binary.LittleEndian, uint16(2))
+	binary.Write(&buf, binary.LittleEndian, uint32(sampleRate))
+	binary.Write(&buf, binary.LittleEndian, uint32(sampleRate*4))
+	binary.Write(&buf, binary.LittleEndian, uint16(4))
+	binary.Write(&buf, binary.LittleEndian, uint16(16))
+	buf.WriteString("data")
+	binary.Write(&buf, binary.LittleEndian, uint32(data.Len()))
+	buf.Write(data.Bytes())
+
+	path := filepath.Join(t.TempDir(), "ramp.wav")
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatalf("failed to write WAV: %v", err)
+	}
+	return path
+}
+
+// writeTestFLAC writes a 16-bit stereo FLAC with the same ramp as writeTestWAV,
+// followed by any extra metadata blocks
+func writeTestFLAC(t *testing.T, sampleRate, blockSize, blocks int, extra ...*meta.Block) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "ramp.flac")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("failed to create FLAC: %v", err)
+	}
+	defer f.Close()
+
+	info := &meta.StreamInfo{
+		BlockSizeMin:  uint16(blockSize),
+		BlockSizeMax:  uint16(blockSize),
+		SampleRate:    uint32(sampleRate),
+		NChannels:     2,
+		BitsPerSample: 16,
+		NSamples:      uint64(blockSize * blocks),
+	}
+	enc, err := flac.NewEncoder(f, info, extra...)
+	if err != nil {
+		t.Fatalf("failed to create encoder: %v", err)
+	}
+
+	for b := 0; b < blocks; b++ {
+		left := make([]int32, blockSize)
+		right := make([]int32, blockSize)
+		for i := range left {
+			v := int32((b*blockSize + i) % 32768)
+			left[i] = v
+			right[i] = -v
+		}
+		fr := &frame.Frame{
+			Header: frame.Header{
+				HasFixedBlockSize: true,
+				BlockSize:         uint16(blockSize),
+				SampleRate:        uint32(sampleRate),
+				Channels:          frame.ChannelsLR,
+				BitsPerSample:     16,
+				Num:               uint64(b),
+			},
+			Subframes: []*frame.Subframe{
+				{SubHeader: frame.SubHeader{Pred: frame.PredVerbatim}, Samples: left, NSamples: blockSize},
+				{SubHeader: frame.SubHeader{Pred: frame.PredVerbatim}, Samples: right, NSamples: blockSize},
+			},
+		}
+		if err := enc.WriteFrame(fr); err != nil {
+			t.Fatalf("failed to write frame: %v", err)
+		}
+	}
+
+	if err := enc.Close(); err != nil {
+		t.Fatalf("failed to close encoder: %v", err)
+	}
+	return path
+}
+
+func TestWAVSourceRead(t *testing.T) {
+	path := writeTestWAV(t, 8000, 8000)
+
+	src, err := NewWAVSource(path)
+	if err != nil {
+		t.Fatalf("NewWAVSource failed: %v", err)
+	}
+	defer src.Close()
+
+	if src.SampleRate() != 8000 || src.Channels() != 2 {
+		t.Fatalf("expected 8000Hz/2ch, got %dHz/%dch", src.SampleRate(), src.Channels())
+	}
+	if src.Duration() != time.Second {
+		t.Errorf("expected duration 1s, got %v", src.Duration())
+	}
+
+	samples := make([]int32, 200)
+	n, err := src.Read(samples)
+	if err != nil || n != 200 {
+		t.Fatalf("Read returned %d, %v", n, err)
+	}
+
+	// 16-bit samples are scaled to 24-bit range
+	if samples[10] != 5<<8 || samples[11] != -5<<8 {
+		t.Errorf("expected frame 5 = (%d, %d), got (%d, %d)", 5<<8, -5<<8, samples[10], samples[11])
+	}
+	if src.Position() != 100*time.Second/8000 {
+		t.Errorf("expected position 12.5ms, got %v", src.Position())
+	}
+}
+
+func TestWAVSourceSeek(t *testing.T) {
+	path := writeTestWAV(t, 8000, 8000)
+
+	src, err := NewWAVSource(path)
+	if err != nil {
+		t.Fatalf("NewWAVSource failed: %v", err)
+	}
+	defer src.Close()
+
+	if err := src.Seek(500 * time.Millisecond); err != nil {
+		t.Fatalf("Seek failed: %v", err)
+	}
+	if src.Position() != 500*time.Millisecond {
+		t.Errorf("expected position 500ms, got %v", src.Position())
+	}
+
+	samples := make([]int32, 2)
+	if _, err := src.Read(samples); err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if samples[0] != 4000<<8 {
+		t.Errorf("expected frame 4000 after seek, got %d", samples[0]>>8)
+	}
+}
+
+func TestWAVSourceLoops(t *testing.T) {
+	path := writeTestWAV(t, 8000, 100)
+
+	src, err := NewWAVSource(path)
+	if err != nil {
+		t.Fatalf("NewWAVSource failed: %v", err)
+	}
+	defer src.Close()
+
+	// Read across the end of the file
+	samples := make([]int32, 300) // 150 frames
+	n, err := src.Read(samples)
+	if err != nil || n != 300 {
+		t.Fatalf("Read returned %d, %v", n, err)
+	}
+	if samples[200] != 0 || samples[202] != 1<<8 {
+		t.Errorf("expected audio to restart at frame 0, got %d, %d", samples[200]>>8, samples[202]>>8)
+	}
+	if src.Position() != 50*time.Second/8000 {
+		t.Errorf("expected position to wrap to 50 frames, got %v", src.Position())
+	}
+}
+
+func TestWAVSourceRejectsInvalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bad.wav")
+	if err := os.WriteFile(path, []byte("not a wav file at all"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewWAVSource(path); err == nil {
+		t.Error("expected error for invalid WAV")
+	}
+}
+
+func TestFLACSourceSeek(t *testing.T) {
+	path := writeTestFLAC(t, 44100, 4096, 10)
+
+	src, err := NewFLACSource(path)
+	if err != nil {
+		t.Fatalf("NewFLACSource failed: %v", err)
+	}
+	defer src.Close()
+
+	if want := samplesToDuration(40960, 44100); src.Duration() != want {
+		t.Errorf("expected duration %v, got %v", want, src.Duration())
+	}
+
+	// Target sits in the middle of a frame; leading samples must be skipped
+	if err := src.Seek(500 * time.Millisecond); err != nil {
+		t.Fatalf("Seek failed: %v", err)
+	}
+	if src.Position() != 500*time.Millisecond {
+		t.Errorf("expected position 500ms, got %v", src.Position())
+	}
+
+	samples := make([]int32, 8192)
+	n, err := src.Read(samples)
+	if err != nil || n != len(samples) {
+		t.Fatalf("Read returned %d, %v", n, err)
+	}
+	if samples[0] != 22050<<8 || samples[1] != -22050<<8 {
+		t.Errorf("expected frame 22050 after seek, got (%d, %d)", samples[0]>>8, samples[1]>>8)
+	}
+	// Continuity across the FLAC frame boundary
+	if samples[8190] != (22050+4095)<<8 {
+		t.Errorf("expected frame %d, got %d", 22050+4095, samples[8190]>>8)
+	}
+}
+
+func TestOpenSourceWAV(t *testing.T) {
+	path := writeTestWAV(t, 8000, 800)
+
+	src, err := openSource(path)
+	if err != nil {
+		t.Fatalf("openSource failed: %v", err)
+	}
+	defer src.Close()
+
+	if _, ok := src.(*WAVSource); !ok {
+		t.Errorf("expected *WAVSource, got %T", src)
+	}
+}
+
+// xingHeaderFrame builds an MPEG1 Layer III frame carrying a Xing tag
+func xingHeaderFrame(frames, size uint32) []byte {
+	var buf bytes.Buffer
+	buf.Write([]byte{0xFF, 0xFB, 0x90, 0x00}) // MPEG1 L3, 128kbps, 44100Hz, stereo
+	buf.Write(make([]byte, 32))               // side info
+	buf.WriteString("Xing")
+	binary.Write(&buf, binary.BigEndian, uint32(0x7)) // frames, bytes, TOC
+	binary.Write(&buf, binary.BigEndian, frames)
+	binary.Write(&buf, binary.BigEndian, size)
+	for i := 0; i < 100; i++ {
+		buf.WriteByte(byte(i * 256 / 100))
+	}
+	buf.Write(make([]byte, 300))
+	return buf.Bytes()
+}
+
+func TestReadMP3TOCXing(t *testing.T) {
+	data := xingHeaderFrame(100, 100000)
+
+	toc, err := readMP3TOC(bytes.NewReader(data), 200000)
+	if err != nil {
+		t.Fatalf("readMP3TOC failed: %v", err)
+	}
+	if toc == nil {
+		t.Fatal("expected Xing TOC to be found")
+	}
+	if toc.kind != "xing" {
+		t.Errorf("expected kind xing, got %s", toc.kind)
+	}
+	if toc.totalSamples != 100*1152 {
+		t.Errorf("expected %d samples, got %d", 100*1152, toc.totalSamples)
+	}
+
+	// Halfway through maps to TOC entry 50 (128/256 of the data)
+	offset, ok := toc.offsetFor(50 * 1152)
+	if !ok || offset != 50000 {
+		t.Errorf("expected offset 50000, got %d (ok=%v)", offset, ok)
+	}
+	if offset, _ := toc.offsetFor(toc.totalSamples); offset != 100000 {
+		t.Errorf("expected end offset 100000, got %d", offset)
+	}
+}
+
+func TestReadMP3TOCSkipsID3(t *testing.T) {
+	id3 := []byte{'I', 'D', '3', 4, 0, 0, 0, 0, 0, 20}
+	data := append(append(id3, make([]byte, 20)...), xingHeaderFrame(10, 5000)...)
+
+	toc, err := readMP3TOC(bytes.NewReader(data), int64(len(data)))
+	if err != nil || toc == nil {
+		t.Fatalf("expected TOC after ID3 tag, got %v, %v", toc, err)
+	}
+	if toc.dataStart != 30 {
+		t.Errorf("expected data start 30, got %d", toc.dataStart)
+	}
+}
+
+func TestReadMP3TOCVBRI(t *testing.T) {
+	var buf bytes.Buffer
+	buf.Write([]byte{0xFF, 0xFB, 0x90, 0x00})
+	buf.Write(make([]byte, 32))
+	buf.WriteString("VBRI")
+	binary.Write(&buf, binary.BigEndian, uint16(1))    // version
+	binary.Write(&buf, binary.BigEndian, uint16(0))    // delay
+	binary.Write(&buf, binary.BigEndian, uint16(75))   // quality
+	binary.Write(&buf, binary.BigEndian, uint32(4000)) // bytes
+	binary.Write(&buf, binary.BigEndian, uint32(40))   // frames
+	binary.Write(&buf, binary.BigEndian, uint16(4))    // entries
+	binary.Write(&buf, binary.BigEndian, uint16(1))    // scale
+	binary.Write(&buf, binary.BigEndian, uint16(2))    // entry size
+	binary.Write(&buf, binary.BigEndian, uint16(10))   // frames per entry
+	for _, size := range []uint16{500, 1500, 1000, 1000} {
+		binary.Write(&buf, binary.BigEndian, size)
+	}
+
+	toc, err := readMP3TOC(bytes.NewReader(buf.Bytes()), 8000)
+	if err != nil || toc == nil {
+		t.Fatalf("expected VBRI TOC, got %v, %v", toc, err)
+	}
+	if toc.kind != "vbri" || toc.totalSamples != 40*1152 {
+		t.Errorf("unexpected TOC: kind=%s samples=%d", toc.kind, toc.totalSamples)
+	}
+
+	// Frame 20 is the end of the second entry: 500 + 1500 bytes
+	if offset, _ := toc.offsetFor(20 * 1152); offset != 2000 {
+		t.Errorf("expected offset 2000, got %d", offset)
+	}
+}
+
+func TestReadMP3TOCNone(t *testing.T) {
+	data := make([]byte, 600)
+	copy(data, []byte{0xFF, 0xFB, 0x90, 0x00})
+
+	toc, err := readMP3TOC(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("readMP3TOC failed: %v", err)
+	}
+	if toc != nil {
+		t.Errorf("expected no TOC for plain CBR frame, got %+v", toc)
+	}
+}
+
+func TestWAVSourceSurround(t *testing.T) {
+	// 5.1 WAVE_FORMAT_EXTENSIBLE, 16-bit; each channel holds its index
+	const channels, frames = 6, 100
+	var data bytes.Buffer
+	for i := 0; i < frames; i++ {
+		for ch := 0; ch < channels; ch++ {
+			binary.Write(&data, binary.LittleEndian, int16(ch*1000+i))
+		}
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("RIFF")
+	binary.Write(&buf, binary.LittleEndian, uint32(60+data.Len()))
+	buf.WriteString("WAVE")
+	buf.WriteString("fmt ")
+	binary.Write(&buf, binary.LittleEndian, uint32(40))
+	binary.Write(&buf, binary.LittleEndian, uint16(wavFormatExtensible))
+	binary.Write(&buf, binary.LittleEndian, uint16(channels))
+	binary.Write(&buf, binary.LittleEndian, uint32(48000))
+	binary.Write(&buf, binary.LittleEndian, uint32(48000*channels*2))
+	binary.Write(&buf, binary.LittleEndian, uint16(channels*2))
+	binary.Write(&buf, binary.LittleEndian, uint16(16))
+	binary.Write(&buf, binary.LittleEndian, uint16(22))   // Extension size
+	binary.Write(&buf, binary.LittleEndian, uint16(16))   // Valid bits
+	binary.Write(&buf, binary.LittleEndian, uint32(0x3F)) // FL FR FC LFE BL BR
+	binary.Write(&buf, binary.LittleEndian, uint16(wavFormatPCM))
+	buf.Write(make([]byte, 14)) // Rest of the sub-format GUID
+	buf.WriteString("data")
+	binary.Write(&buf, binary.LittleEndian, uint32(data.Len()))
+	buf.Write(data.Bytes())
+
+	path := filepath.Join(t.TempDir(), "surround.wav")
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	src, err := NewWAVSource(path)
+	if err != nil {
+		t.Fatalf("NewWAVSource failed: %v", err)
+	}
+	defer src.Close()
+
+	if src.Channels() != channels || src.channelMask != 0x3F {
+		t.Errorf("expected 6 channels with mask 0x3F, got %d, 0x%X", src.Channels(), src.channelMask)
+	}
+	samples := make([]int32, 2*channels)
+	if n, err := src.Read(samples); err != nil || n != len(samples) {
+		t.Fatalf("Read returned %d, %v", n, err)
+	}
+	for i, v := range samples {
+		if want := int32((i%channels)*1000+i/channels) << 8; v != want {
+			t.Errorf("sample %d: expected %d, got %d", i, want, v)
+		}
+	}
+
+	// A non-PCM sub-format is rejected
+	bad := buf.Bytes()
+	binary.LittleEndian.PutUint16(bad[44:46], 3)
+	if err := os.WriteFile(path, bad, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewWAVSource(path); err == nil {
+		t.Error("expected error for a float sub-format")
+	}
+}
+
+func TestFLACSourceSurround(t *testing.T) {
+	// 7.1 FLAC; each channel holds its index
+	const channels, blockSize = 8, 256
+	path := filepath.Join(t.TempDir(), "surround.flac")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("failed to create FLAC: %v", err)
+	}
+	enc, err := flac.NewEncoder(f, &meta.StreamInfo{
+		BlockSizeMin:  blockSize,
+		BlockSizeMax:  blockSize,
+		SampleRate:    48000,
+		NChannels:     channels,
+		BitsPerSample: 16,
+		NSamples:      blockSize,
+	})
+	if err != nil {
+		t.Fatalf("failed to create encoder: %v", err)
+	}
+	fr := &frame.Frame{
+		Header: frame.Header{
+			HasFixedBlockSize: true,
+			BlockSize:         blockSize,
+			SampleRate:        48000,
+			Channels:          frame.ChannelsLRCLfeLsRsSlSr,
+			BitsPerSample:     16,
+		},
+	}
+	for ch := 0; ch < channels; ch++ {
+		samples := make([]int32, blockSize)
+		for i := range samples {
+			samples[i] = int32(ch*1000 + i)
+		}
+		fr.Subframes = append(fr.Subframes, &frame.Subframe{
+			SubHeader: frame.SubHeader{Pred: frame.PredVerbatim}, Samples: samples, NSamples: blockSize,
+		})
+	}
+	if err := enc.WriteFrame(fr); err != nil {
+		t.Fatalf("failed to write frame: %v", err)
+	}
+	if err := enc.Close(); err != nil {
+		t.Fatalf("failed to close encoder: %v", err)
+	}
+	f.Close()
+
+	src, err := NewFLACSource(path)
+	if err != nil {
+		t.Fatalf("NewFLACSource failed: %v", err)
+	}
+	defer src.Close()
+
+	if src.Channels() != channels {
+		t.Fatalf("expected %d channels, got %d", channels, src.Channels())
+	}
+	samples := make([]int32, 2*channels)
+	if n, err := src.Read(samples); err != nil || n != len(samples) {
+		t.Fatalf("Read returned %d, %v", n, err)
+	}
+	for i, v := range samples {
+		if want := int32((i%channels)*1000+i/channels) << 8; v != want {
+			t.Errorf("sample %d: expected %d, got %d", i, want, v)
+		}
+	}
+}
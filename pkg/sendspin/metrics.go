@@ -0,0 +1,86 @@
+// ABOUTME: Prometheus-style metrics endpoints for servers and players
+// ABOUTME: Serves status and playback statistics in the text exposition format
+package sendspin
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// MetricsHandler serves the server's status in the Prometheus text format:
+// uptime, queued sources, and each connected client's state and volume
+func (s *Server) MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status := s.Status()
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+		writeMetric(w, "sendspin_server_uptime_seconds", "gauge", "Time since the server started", "", status.Uptime.Seconds())
+		writeMetric(w, "sendspin_server_clients", "gauge", "Connected clients", "", float64(len(status.Clients)))
+		writeMetric(w, "sendspin_server_queued_sources", "gauge", "Sources waiting to play", "", float64(s.Queued()))
+
+		writeHeader(w, "sendspin_server_client_volume", "gauge", "Volume of each connected client (0-100)")
+		for _, c := range status.Clients {
+			fmt.Fprintf(w, "sendspin_server_client_volume%s %d\n", clientLabels(c), c.Volume)
+		}
+		writeHeader(w, "sendspin_server_client_muted", "gauge", "Whether each connected client is muted")
+		for _, c := range status.Clients {
+			fmt.Fprintf(w, "sendspin_server_client_muted%s %d\n", clientLabels(c), boolMetric(c.Muted))
+		}
+	})
+}
+
+// MetricsHandler serves the player's playback statistics in the
+// Prometheus text format
+func (p *Player) MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		stats := p.Stats()
+		state := p.Status()
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+		writeMetric(w, "sendspin_player_connected", "gauge", "Whether a server session is running", "", float64(boolMetric(state.Connected)))
+		writeMetric(w, "sendspin_player_volume", "gauge", "Volume (0-100)", "", float64(state.Volume))
+		writeMetric(w, "sendspin_player_muted", "gauge", "Whether the player is muted", "", float64(boolMetric(state.Muted)))
+		writeMetric(w, "sendspin_player_chunks_received_total", "counter", "Audio chunks received", "", float64(stats.Received))
+		writeMetric(w, "sendspin_player_chunks_played_total", "counter", "Audio chunks played", "", float64(stats.Played))
+		writeMetric(w, "sendspin_player_chunks_dropped_total", "counter", "Audio chunks dropped as late or stale", "", float64(stats.Dropped))
+		writeMetric(w, "sendspin_player_buffer_seconds", "gauge", "Audio buffered ahead of playback", "", float64(stats.BufferDepth)/1000)
+		writeMetric(w, "sendspin_player_sync_rtt_seconds", "gauge", "Clock sync round-trip time", "", float64(stats.SyncRTT)/1e6)
+		writeMetric(w, "sendspin_player_underruns_total", "counter", "Output underruns", "", float64(stats.Underruns))
+		writeMetric(w, "sendspin_player_overruns_total", "counter", "Output overruns", "", float64(stats.Overruns))
+		writeMetric(w, "sendspin_player_reprimes_total", "counter", "Output re-primes after starvation", "", float64(stats.Reprimes))
+		writeMetric(w, "sendspin_player_output_latency_seconds", "gauge", "Latency reported by the output device", "", stats.OutputLatency.Seconds())
+	})
+}
+
+// writeHeader writes a metric's HELP and TYPE lines
+func writeHeader(w io.Writer, name, kind, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// writeMetric writes a metric with one sample
+func writeMetric(w io.Writer, name, kind, help, labels string, value float64) {
+	writeHeader(w, name, kind, help)
+	fmt.Fprintf(w, "%s%s %g\n", name, labels, value)
+}
+
+// clientLabels identifies a client in a metric's labels
+func clientLabels(c ClientInfo) string {
+	return fmt.Sprintf(`{id="%s",name="%s",group="%s"}`,
+		escapeLabel(c.ID), escapeLabel(c.Name), escapeLabel(c.Group))
+}
+
+// labelEscaper escapes label values as the text format requires
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(value string) string {
+	return labelEscaper.Replace(value)
+}
+
+func boolMetric(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
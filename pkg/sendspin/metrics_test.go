@@ -0,0 +1,59 @@
+// ABOUTME: Tests for the metrics endpoints
+// ABOUTME: Checks servers and players report their state in the text format
+package sendspin
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Sendspin/sendspin-go/pkg/audio/output"
+)
+
+func TestServerMetrics(t *testing.T) {
+	server, err := NewServer(ServerConfig{Source: NewTestTone(48000, 2)})
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	server.clients["kitchen"] = &client{ID: "kitchen", Name: `Kitchen "Pi"`, Group: "downstairs", Volume: 40, Muted: true}
+	if err := server.Enqueue(NewTestTone(48000, 2)); err != nil {
+		t.Fatalf("Enqueue failed: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	server.MetricsHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body := rec.Body.String()
+
+	for _, want := range []string{
+		"# TYPE sendspin_server_clients gauge\nsendspin_server_clients 1\n",
+		"sendspin_server_queued_sources 1\n",
+		`sendspin_server_client_volume{id="kitchen",name="Kitchen \"Pi\"",group="downstairs"} 40`,
+		`sendspin_server_client_muted{id="kitchen",name="Kitchen \"Pi\"",group="downstairs"} 1`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics missing %q:\n%s", want, body)
+		}
+	}
+}
+
+func TestPlayerMetrics(t *testing.T) {
+	player, err := NewPlayer(PlayerConfig{PlayerName: "Speaker", Volume: 30, Output: output.NewCapture()})
+	if err != nil {
+		t.Fatalf("failed to create player: %v", err)
+	}
+	defer player.Close()
+
+	rec := httptest.NewRecorder()
+	player.MetricsHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body := rec.Body.String()
+
+	for _, want := range []string{
+		"sendspin_player_connected 0\n",
+		"sendspin_player_volume 30\n",
+		"# TYPE sendspin_player_chunks_received_total counter\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics missing %q:\n%s", want, body)
+		}
+	}
+}
@@ -0,0 +1,254 @@
+// ABOUTME: MP3 Xing/Info and VBRI header parsing for duration and seeking
+// ABOUTME: Builds a seek table from the TOC so files can be seeked without a full scan
+package sendspin
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// mp3SeekPoint maps a PCM sample frame to a byte offset relative to the first audio frame
+type mp3SeekPoint struct {
+	sample int64
+	offset int64
+}
+
+// mp3TOC holds the information found in a Xing/Info or VBRI header
+type mp3TOC struct {
+	kind         string // "xing" or "vbri"
+	totalSamples int64  // PCM frames in the stream (excluding the header frame)
+	dataStart    int64  // file offset of the first audio frame (the header frame)
+	dataSize     int64  // size in bytes of the audio data
+	points       []mp3SeekPoint
+}
+
+// mp3FrameInfo is the subset of an MPEG audio frame header we need
+type mp3FrameInfo struct {
+	mpeg1           bool
+	mono            bool
+	sampleRate      int
+	samplesPerFrame int
+}
+
+var mp3SampleRates = map[byte][3]int{
+	3: {44100, 48000, 32000}, // MPEG1
+	2: {22050, 24000, 16000}, // MPEG2
+	0: {11025, 12000, 8000},  // MPEG2.5
+}
+
+// parseMP3FrameHeader decodes a 4-byte MPEG Layer III frame header
+func parseMP3FrameHeader(h []byte) (mp3FrameInfo, error) {
+	if len(h) < 4 || h[0] != 0xFF || h[1]&0xE0 != 0xE0 {
+		return mp3FrameInfo{}, fmt.Errorf("no frame sync")
+	}
+
+	version := (h[1] >> 3) & 0x03
+	layer := (h[1] >> 1) & 0x03
+	rateIdx := (h[2] >> 2) & 0x03
+	channelMode := (h[3] >> 6) & 0x03
+
+	rates, ok := mp3SampleRates[version]
+	if !ok || layer != 1 || rateIdx == 3 {
+		return mp3FrameInfo{}, fmt.Errorf("not an MPEG Layer III frame")
+	}
+
+	info := mp3FrameInfo{
+		mpeg1:      version == 3,
+		mono:       channelMode == 3,
+		sampleRate: rates[rateIdx],
+	}
+	if info.mpeg1 {
+		info.samplesPerFrame = 1152
+	} else {
+		info.samplesPerFrame = 576
+	}
+	return info, nil
+}
+
+// sideInfoSize returns the Layer III side information size for the frame
+func (f mp3FrameInfo) sideInfoSize() int {
+	switch {
+	case f.mpeg1 && f.mono:
+		return 17
+	case f.mpeg1:
+		return 32
+	case f.mono:
+		return 9
+	default:
+		return 17
+	}
+}
+
+// id3v2Size returns the total size of a leading ID3v2 tag, or 0 if there is none
+func id3v2Size(r io.ReaderAt) int64 {
+	hdr := make([]byte, 10)
+	if _, err := r.ReadAt(hdr, 0); err != nil || string(hdr[:3]) != "ID3" {
+		return 0
+	}
+	size := int64(hdr[6])<<21 | int64(hdr[7])<<14 | int64(hdr[8])<<7 | int64(hdr[9])
+	if hdr[5]&0x10 != 0 {
+		size += 10 // footer present
+	}
+	return 10 + size
+}
+
+// readMP3TOC looks for a Xing/Info or VBRI header in the first audio frame.
+// Returns nil (and no error) if the file has neither.
+func readMP3TOC(r io.ReaderAt, fileSize int64) (*mp3TOC, error) {
+	start := id3v2Size(r)
+
+	// The header frame is small; 4 bytes header + side info + tag payload
+	buf := make([]byte, 4+32+120+400)
+	n, err := r.ReadAt(buf, start)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	buf = buf[:n]
+
+	frame, err := parseMP3FrameHeader(buf)
+	if err != nil {
+		return nil, nil
+	}
+
+	toc := &mp3TOC{dataStart: start, dataSize: fileSize - start}
+
+	// Xing/Info follows the side information
+	xingAt := 4 + frame.sideInfoSize()
+	if len(buf) >= xingAt+8 {
+		tag := string(buf[xingAt : xingAt+4])
+		if tag == "Xing" || tag == "Info" {
+			if parseXing(toc, buf[xingAt+4:], frame) {
+				return toc, nil
+			}
+			return nil, nil
+		}
+	}
+
+	// VBRI always sits 32 bytes after the frame header
+	const vbriAt = 4 + 32
+	if len(buf) >= vbriAt+26 && string(buf[vbriAt:vbriAt+4]) == "VBRI" {
+		if parseVBRI(toc, buf[vbriAt+4:], frame) {
+			return toc, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// parseXing fills toc from the body of a Xing/Info tag (after the 4-byte ID)
+func parseXing(toc *mp3TOC, b []byte, frame mp3FrameInfo) bool {
+	if len(b) < 4 {
+		return false
+	}
+	flags := binary.BigEndian.Uint32(b)
+	b = b[4:]
+
+	const (
+		flagFrames = 0x1
+		flagBytes  = 0x2
+		flagTOC    = 0x4
+	)
+
+	if flags&flagFrames == 0 || len(b) < 4 {
+		return false
+	}
+	frames := int64(binary.BigEndian.Uint32(b))
+	b = b[4:]
+	toc.kind = "xing"
+	toc.totalSamples = frames * int64(frame.samplesPerFrame)
+
+	if flags&flagBytes != 0 && len(b) >= 4 {
+		if size := int64(binary.BigEndian.Uint32(b)); size > 0 && size <= toc.dataSize {
+			toc.dataSize = size
+		}
+		b = b[4:]
+	}
+
+	if flags&flagTOC != 0 && len(b) >= 100 {
+		toc.points = make([]mp3SeekPoint, 0, 101)
+		for i := 0; i < 100; i++ {
+			toc.points = append(toc.points, mp3SeekPoint{
+				sample: toc.totalSamples * int64(i) / 100,
+				offset: toc.dataSize * int64(b[i]) / 256,
+			})
+		}
+		toc.points = append(toc.points, mp3SeekPoint{sample: toc.totalSamples, offset: toc.dataSize})
+	}
+
+	return true
+}
+
+// parseVBRI fills toc from the body of a VBRI tag (after the 4-byte ID)
+func parseVBRI(toc *mp3TOC, b []byte, frame mp3FrameInfo) bool {
+	// version(2) delay(2) quality(2) bytes(4) frames(4) entries(2) scale(2) entrySize(2) framesPerEntry(2)
+	if len(b) < 22 {
+		return false
+	}
+	size := int64(binary.BigEndian.Uint32(b[6:]))
+	frames := int64(binary.BigEndian.Uint32(b[10:]))
+	entries := int(binary.BigEndian.Uint16(b[14:]))
+	scale := int64(binary.BigEndian.Uint16(b[16:]))
+	entrySize := int(binary.BigEndian.Uint16(b[18:]))
+	framesPerEntry := int64(binary.BigEndian.Uint16(b[20:]))
+	b = b[22:]
+
+	if frames == 0 {
+		return false
+	}
+	toc.kind = "vbri"
+	toc.totalSamples = frames * int64(frame.samplesPerFrame)
+	if size > 0 && size <= toc.dataSize {
+		toc.dataSize = size
+	}
+
+	if entrySize < 1 || entrySize > 4 || len(b) < entries*entrySize {
+		return true
+	}
+
+	toc.points = make([]mp3SeekPoint, 0, entries+1)
+	toc.points = append(toc.points, mp3SeekPoint{})
+	var offset int64
+	for i := 0; i < entries; i++ {
+		var v int64
+		for j := 0; j < entrySize; j++ {
+			v = v<<8 | int64(b[i*entrySize+j])
+		}
+		offset += v * scale
+		sample := int64(i+1) * framesPerEntry * int64(frame.samplesPerFrame)
+		if sample > toc.totalSamples {
+			sample = toc.totalSamples
+		}
+		toc.points = append(toc.points, mp3SeekPoint{sample: sample, offset: offset})
+	}
+
+	return true
+}
+
+// offsetFor returns the byte offset (relative to dataStart) for a PCM sample
+// frame, interpolating between TOC entries
+func (t *mp3TOC) offsetFor(sample int64) (int64, bool) {
+	if len(t.points) < 2 {
+		return 0, false
+	}
+	if sample <= 0 {
+		return 0, true
+	}
+
+	for i := 1; i < len(t.points); i++ {
+		a, b := t.points[i-1], t.points[i]
+		if sample > b.sample && i < len(t.points)-1 {
+			continue
+		}
+		if b.sample <= a.sample {
+			return a.offset, true
+		}
+		frac := float64(sample-a.sample) / float64(b.sample-a.sample)
+		if frac > 1 {
+			frac = 1
+		}
+		return a.offset + int64(frac*float64(b.offset-a.offset)), true
+	}
+
+	return t.points[len(t.points)-1].offset, true
+}
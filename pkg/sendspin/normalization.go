@@ -0,0 +1,137 @@
+// ABOUTME: Server-side loudness normalization
+// ABOUTME: Finds the source's loudness from tags, the analysis cache or a background scan
+package sendspin
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/Sendspin/sendspin-go/pkg/audio/loudness"
+)
+
+// analysisChunk is how much audio the analysis reads at a time
+const analysisChunk = time.Second
+
+// prepareLoudness gives the normalizer the current source's loudness.
+// Tags are used when present; otherwise a cached or fresh analysis of the
+// file is, and audio plays unnormalized until the analysis completes.
+// Called with sourceMu held.
+func (s *Server) prepareLoudness() {
+	if s.normalizer == nil {
+		return
+	}
+	source := s.audioSource
+	_, _, album := source.Metadata()
+
+	if tagged, ok := source.(LoudnessTagged); ok {
+		if info, ok := tagged.Loudness(); ok {
+			s.normalizer.SetSource(info, album)
+			s.logLoudness()
+			return
+		}
+	}
+
+	file, ok := source.(FileBacked)
+	if !ok {
+		s.normalizer.SetSource(loudness.Info{}, album)
+		log.Printf("Source has no loudness information, normalization inactive")
+		return
+	}
+	path := file.Path()
+
+	if s.loudnessCache != nil {
+		if info, ok := s.loudnessCache.Load(path); ok {
+			s.normalizer.SetSource(info, album)
+			s.logLoudness()
+			return
+		}
+	}
+	s.normalizer.SetSource(loudness.Info{}, album)
+
+	log.Printf("Analyzing loudness of %s", path)
+	cache := s.loudnessCache
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+
+		info, err := analyzeLoudness(path, s.stopChan)
+		if err != nil {
+			log.Printf("Loudness analysis failed: %v", err)
+			return
+		}
+		if cache != nil {
+			if err := cache.Store(path, info); err != nil {
+				log.Printf("Failed to cache loudness: %v", err)
+			}
+		}
+		s.updateLoudness(source, info)
+	}()
+}
+
+// updateLoudness applies loudness found after a source started and
+// reports the new gain to clients with the next chunk. Results for a
+// source that is no longer playing are dropped.
+func (s *Server) updateLoudness(source AudioSource, info loudness.Info) {
+	s.sourceMu.Lock()
+	defer s.sourceMu.Unlock()
+
+	if s.audioSource != source {
+		return
+	}
+	s.normalizer.UpdateLoudness(info)
+	s.progressDirty = true
+	s.logLoudness()
+}
+
+// logLoudness logs the gain the normalizer applies (called with sourceMu held)
+func (s *Server) logLoudness() {
+	gain, info, ok := s.normalizer.Gain()
+	if !ok {
+		log.Printf("Normalization (%s): no gain available", s.config.Normalization)
+		return
+	}
+	log.Printf("Normalization (%s): %+.2f dB from %s", s.config.Normalization, gain.Gain, info.Source)
+}
+
+// analyzeLoudness measures a file's integrated loudness and true peak,
+// reading it with a separate decoder so streaming is unaffected. It stops
+// early when stop is closed.
+func analyzeLoudness(path string, stop <-chan struct{}) (loudness.Info, error) {
+	source, err := openSource(path)
+	if err != nil {
+		return loudness.Info{}, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer source.Close()
+
+	// File sources loop at the end, so read exactly one pass
+	seekable, ok := source.(Seekable)
+	if !ok || seekable.Duration() <= 0 {
+		return loudness.Info{}, fmt.Errorf("cannot analyze %s: unknown duration", path)
+	}
+	rate, channels := source.SampleRate(), source.Channels()
+	remaining := int64(seekable.Duration()) * int64(rate) / int64(time.Second)
+
+	meter := loudness.NewMeter(rate, channels)
+	buf := make([]int32, int(analysisChunk)*rate/int(time.Second)*channels)
+	for remaining > 0 {
+		select {
+		case <-stop:
+			return loudness.Info{}, fmt.Errorf("analysis of %s cancelled", path)
+		default:
+		}
+
+		n, err := source.Read(buf)
+		frames := min(int64(n/channels), remaining)
+		meter.Add(buf[:frames*int64(channels)])
+		remaining -= frames
+		if err != nil {
+			break
+		}
+		if n == 0 {
+			return loudness.Info{}, fmt.Errorf("failed to read %s: no data", path)
+		}
+	}
+
+	return loudness.Analyzed(meter.Integrated(), meter.TruePeak()), nil
+}
@@ -0,0 +1,244 @@
+// ABOUTME: Tests for server-side loudness normalization
+// ABOUTME: Covers tagged sources, background analysis and the analysis cache
+package sendspin
+
+import (
+	"encoding/binary"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Sendspin/sendspin-go/pkg/audio/loudness"
+	"github.com/Sendspin/sendspin-go/pkg/protocol"
+	"github.com/gorilla/websocket"
+)
+
+// taggedTone is a seekable test tone carrying ReplayGain values
+type taggedTone struct {
+	*seekableTone
+	info loudness.Info
+}
+
+func (s *taggedTone) Loudness() (loudness.Info, bool) {
+	return s.info, true
+}
+
+// writeSineWAV writes a 16-bit stereo WAV of a 1kHz sine at the given
+// peak amplitude (1.0 = full scale)
+func writeSineWAV(t *testing.T, sampleRate int, length time.Duration, amplitude float64) string {
+	t.Helper()
+
+	frames := int(length) * sampleRate / int(time.Second)
+	data := make([]byte, frames*4)
+	for i := 0; i < frames; i++ {
+		v := int16(math.Round(amplitude * 32767 * math.Sin(2*math.Pi*1000*float64(i)/float64(sampleRate))))
+		binary.LittleEndian.PutUint16(data[i*4:], uint16(v))
+		binary.LittleEndian.PutUint16(data[i*4+2:], uint16(v))
+	}
+
+	header := make([]byte, 44)
+	copy(header[0:], "RIFF")
+	binary.LittleEndian.PutUint32(header[4:], uint32(36+len(data)))
+	copy(header[8:], "WAVEfmt ")
+	binary.LittleEndian.PutUint32(header[16:], 16)
+	binary.LittleEndian.PutUint16(header[20:], 1)
+	binary.LittleEndian.PutUint16(header[22:], 2)
+	binary.LittleEndian.PutUint32(header[24:], uint32(sampleRate))
+	binary.LittleEndian.PutUint32(header[28:], uint32(sampleRate*4))
+	binary.LittleEndian.PutUint16(header[32:], 4)
+	binary.LittleEndian.PutUint16(header[34:], 16)
+	copy(header[36:], "data")
+	binary.LittleEndian.PutUint32(header[40:], uint32(len(data)))
+
+	path := filepath.Join(t.TempDir(), "sine.wav")
+	if err := os.WriteFile(path, append(header, data...), 0o644); err != nil {
+		t.Fatalf("failed to write WAV: %v", err)
+	}
+	return path
+}
+
+func TestNewServerNormalizationMode(t *testing.T) {
+	if _, err := NewServer(ServerConfig{Source: NewTestTone(48000, 2), Normalization: "loud"}); err == nil {
+		t.Error("expected error for unknown normalization mode")
+	}
+
+	s, err := NewServer(ServerConfig{Source: NewTestTone(48000, 2), Normalization: "Album"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if s.normalizer == nil || s.normalizer.Mode() != loudness.ModeAlbum {
+		t.Error("expected album normalizer")
+	}
+	if s.config.NormalizationTarget != loudness.ReferenceLoudness {
+		t.Errorf("expected default target %v, got %v", loudness.ReferenceLoudness, s.config.NormalizationTarget)
+	}
+
+	s, err = NewServer(ServerConfig{Source: NewTestTone(48000, 2)})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if s.normalizer != nil {
+		t.Error("expected normalization off by default")
+	}
+}
+
+func TestServerNormalizationTags(t *testing.T) {
+	source := &taggedTone{
+		seekableTone: newSeekableTone(48000, 2, 3*time.Minute),
+		info: loudness.Info{
+			Track:  &loudness.Gain{Gain: -6, Peak: 0.5},
+			Album:  &loudness.Gain{Gain: -3, Peak: 0.5},
+			Source: loudness.SourceTags,
+		},
+	}
+
+	server, err := NewServer(ServerConfig{
+		Port:          8937,
+		Name:          "Test Server",
+		Source:        source,
+		Normalization: loudness.ModeTrack,
+	})
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- server.Start()
+	}()
+	time.Sleep(200 * time.Millisecond)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws://localhost:8937/sendspin", nil)
+	if err != nil {
+		t.Fatalf("failed to connect to server: %v", err)
+	}
+	defer conn.Close()
+
+	hello := protocol.Message{
+		Type: "client/hello",
+		Payload: protocol.ClientHello{
+			ClientID:       "loudness-client",
+			Name:           "Loudness Client",
+			Version:        1,
+			SupportedRoles: []string{"player"},
+		},
+	}
+	if err := conn.WriteJSON(hello); err != nil {
+		t.Fatalf("failed to send hello: %v", err)
+	}
+	readUntil(t, conn, "stream/start")
+
+	meta := decodeSessionMetadata(t, readUntil(t, conn, "session/update"))
+	want := protocol.Normalization{Mode: "track", Gain: -6, Peak: 0.5, Source: "tags"}
+	if meta.Normalization == nil || *meta.Normalization != want {
+		t.Errorf("expected normalization %+v, got %+v", want, meta.Normalization)
+	}
+
+	// The tone peaks at half scale; -6dB brings it to about a quarter
+	var peak int32
+	conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	for chunks := 0; chunks < 10; {
+		kind, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("failed to read audio: %v", err)
+		}
+		if kind != websocket.BinaryMessage {
+			continue
+		}
+		for i := 9; i+3 <= len(data); i += 3 {
+			v := int32(data[i]) | int32(data[i+1])<<8 | int32(int8(data[i+2]))<<16
+			peak = max(peak, v, -v)
+		}
+		chunks++
+	}
+	conn.SetReadDeadline(time.Time{})
+
+	if got := float64(peak) / 8388607; got < 0.24 || got > 0.26 {
+		t.Errorf("expected peak near 0.25 after -6dB, got %.3f", got)
+	}
+
+	conn.Close()
+	time.Sleep(100 * time.Millisecond)
+
+	server.Stop()
+	select {
+	case <-errChan:
+	case <-time.After(5 * time.Second):
+		t.Error("server did not stop within timeout")
+	}
+}
+
+func TestServerNormalizationAnalysis(t *testing.T) {
+	// A stereo 1kHz sine peaking at -20dBFS measures about -20 LUFS
+	path := writeSineWAV(t, 48000, 3*time.Second, 0.1)
+	cacheDir := t.TempDir()
+
+	newServer := func() *Server {
+		source, err := NewFileSource(path)
+		if err != nil {
+			t.Fatalf("failed to open source: %v", err)
+		}
+		t.Cleanup(func() { source.Close() })
+
+		s, err := NewServer(ServerConfig{
+			Source:           source,
+			Normalization:    loudness.ModeAuto,
+			LoudnessCacheDir: cacheDir,
+		})
+		if err != nil {
+			t.Fatalf("failed to create server: %v", err)
+		}
+		return s
+	}
+
+	s := newServer()
+	s.sourceMu.Lock()
+	s.prepareLoudness()
+	s.sourceMu.Unlock()
+	s.wg.Wait()
+
+	s.sourceMu.Lock()
+	gain, info, ok := s.normalizer.Gain()
+	dirty := s.progressDirty
+	s.sourceMu.Unlock()
+
+	if !ok || info.Source != loudness.SourceAnalysis {
+		t.Fatalf("expected gain from analysis, got %+v, %v", info, ok)
+	}
+	if math.Abs(info.Loudness+20) > 0.2 || math.Abs(gain.Gain-2) > 0.2 {
+		t.Errorf("expected about -20 LUFS and +2dB, got %.2f LUFS and %+.2f dB", info.Loudness, gain.Gain)
+	}
+	if !dirty {
+		t.Error("expected a session/update to be requested after analysis")
+	}
+
+	entries, err := os.ReadDir(cacheDir)
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("expected one cache entry, got %v (%v)", entries, err)
+	}
+
+	// A second server uses the cached result without analyzing
+	s = newServer()
+	s.sourceMu.Lock()
+	s.prepareLoudness()
+	cached, _, ok := s.normalizer.Gain()
+	s.sourceMu.Unlock()
+	if !ok || cached != gain {
+		t.Errorf("expected cached gain %+v, got %+v, %v", gain, cached, ok)
+	}
+}
+
+func TestAnalyzeLoudnessCancelled(t *testing.T) {
+	path := writeSineWAV(t, 48000, 3*time.Second, 0.1)
+
+	stop := make(chan struct{})
+	close(stop)
+	if _, err := analyzeLoudness(path, stop); err == nil {
+		t.Error("expected error when stopped")
+	}
+	if _, err := analyzeLoudness(filepath.Join(t.TempDir(), "missing.wav"), nil); err == nil {
+		t.Error("expected error for missing file")
+	}
+}
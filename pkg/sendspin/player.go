@@ -3,17 +3,30 @@
 package sendspin
 
 import (
+	"cmp"
 	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
 	"fmt"
 	"log"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+	gosync "sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/Sendspin/sendspin-go/pkg/audio"
 	"github.com/Sendspin/sendspin-go/pkg/audio/decode"
+	"github.com/Sendspin/sendspin-go/pkg/audio/dsp"
 	"github.com/Sendspin/sendspin-go/pkg/audio/output"
+	"github.com/Sendspin/sendspin-go/pkg/discovery"
 	"github.com/Sendspin/sendspin-go/pkg/protocol"
 	"github.com/Sendspin/sendspin-go/pkg/sync"
 	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
 )
 
 // PlayerConfig holds player configuration
@@ -21,24 +34,98 @@ type PlayerConfig struct {
 	// ServerAddr is the server address (host:port)
 	ServerAddr string
 
-	// PlayerName is the display name for this player
+	// PreferredServer is the ID, name or address of the server Start
+	// connects to whenever it is available, moving back to it when it
+	// reappears
+	PreferredServer string
+
+	// FallbackServers are more server addresses (host:port) Start tries
+	// when the preferred, last-used and ServerAddr servers are unavailable
+	FallbackServers []string
+
+	// Discovery supplies servers found on the network to Start, Servers
+	// and SwitchServer. The caller browses with it and stops it.
+	Discovery *discovery.Manager
+
+	// StateFile persists the client ID, name, volume, mute, latency
+	// offset and last server across restarts (see DefaultStateFile).
+	// Empty keeps them in memory.
+	StateFile string
+
+	// PlayerName is the display name for this player (default: the name
+	// saved in StateFile, or "<hostname>-sendspin-player")
 	PlayerName string
 
-	// Volume is the initial volume (0-100)
+	// ClientID identifies the player to servers, which remember settings
+	// by it. Empty uses the ID saved in StateFile, or a new one that is
+	// saved there.
+	ClientID string
+
+	// Volume is the initial volume (0-100; default: the volume saved in
+	// StateFile, or 100)
 	Volume int
 
+	// MaxVolume caps the volume however it is set, by the player or the
+	// server (1-100; default: 100). See SetMaxVolume.
+	MaxVolume int
+
+	// LatencyOffset compensates for delay after the output, e.g. a
+	// Bluetooth speaker or AV receiver: audio is released this much
+	// earlier. Negative values play later. Zero uses the offset saved in
+	// StateFile.
+	LatencyOffset time.Duration
+
 	// BufferMs is the playback buffer size in milliseconds (default: 500)
 	BufferMs int
 
+	// Channels is the most channels the output plays, e.g. 6 for 5.1
+	// (default: 2). The server downmixes surround sources to fit.
+	Channels int
+
 	// DeviceInfo provides device identification
 	DeviceInfo DeviceInfo
 
+	// Device selects the playback device by ID or name (see
+	// output.ListDevices). Empty uses the system default.
+	Device string
+
+	// BitPerfect requests passthrough: the device is opened exclusively in
+	// the stream's exact format, and samples reach it unaltered while
+	// volume is 100% and unmuted
+	BitPerfect bool
+
+	// DSP configures processing (preamp, parametric EQ, convolution)
+	// between the scheduler and the output. Processing alters samples, so
+	// it defeats BitPerfect. The server can replace it with a "dsp" command.
+	DSP dsp.ChainConfig
+
+	// ImpulseResponseDir is the directory a server's "dsp" command may load
+	// impulse responses from. The server names a file in it; paths are
+	// refused. Empty refuses impulse responses from servers.
+	ImpulseResponseDir string
+
+	// AuthToken is sent to servers that require a shared token, and
+	// required from servers connecting to Listen
+	AuthToken string
+
+	// TLS connects to servers with wss:// using this configuration; nil
+	// uses ws://
+	TLS *tls.Config
+
+	// Output overrides the audio backend (e.g. output.NewCapture() in tests).
+	// If nil, output.New is used.
+	Output output.Output
+
 	// OnMetadata is called when metadata is received
 	OnMetadata func(Metadata)
 
 	// OnStateChange is called when playback state changes
 	OnStateChange func(PlayerState)
 
+	// OnProgress is called when the server sends a new progress anchor
+	// (on connect, seek, and track loop)
+	OnProgress func(Progress)
+
 	// OnError is called when errors occur
 	OnError func(error)
 }
@@ -62,6 +149,28 @@ type Metadata struct {
 	Duration    int // seconds
 }
 
+// Progress anchors the track position to a point on the server clock.
+// Use At or Player.Progress to get the current position.
+type Progress struct {
+	Position  time.Duration // Track position at Timestamp
+	Duration  time.Duration // Track length (0 if unknown)
+	Speed     float64       // Playback speed (1.0 = normal)
+	Timestamp int64         // Server clock time in microseconds
+}
+
+// At returns the extrapolated track position at the given server time
+func (p Progress) At(serverMicros int64) time.Duration {
+	elapsed := time.Duration(float64(serverMicros-p.Timestamp)*p.Speed) * time.Microsecond
+	pos := p.Position + elapsed
+	if pos < 0 {
+		pos = 0
+	}
+	if p.Duration > 0 && pos > p.Duration {
+		pos = p.Duration
+	}
+	return pos
+}
+
 // PlayerState describes the current state
 type PlayerState struct {
 	State      string // "idle", "playing", "paused"
@@ -72,6 +181,22 @@ type PlayerState struct {
 	Channels   int
 	BitDepth   int
 	Connected  bool
+
+	// ChannelRole is the channels the server sends this player, e.g.
+	// "left" for one side of a stereo pair (see ChannelRole)
+	ChannelRole string
+
+	// ChannelLayout names the channels received, e.g. "stereo" or "5.1"
+	ChannelLayout string
+
+	// Server is the address of the connected server, whether the player
+	// connected to it or it connected to the player
+	Server string
+
+	// ServerID and ServerName identify the connected server, as sent in
+	// its server/hello
+	ServerID   string
+	ServerName string
 }
 
 // PlayerStats contains playback statistics
@@ -82,8 +207,25 @@ type PlayerStats struct {
 	BufferDepth int // milliseconds
 	SyncRTT     int64
 	SyncQuality sync.Quality
+
+	// Output device health (zero if the backend doesn't report it)
+	Underruns           int64
+	Overruns            int64
+	Reprimes            int64
+	OutputLatency       time.Duration
+	CallbackInterval    time.Duration
+	MaxCallbackInterval time.Duration
 }
 
+// reprimeAfter is how long the output may starve before the player re-primes
+const reprimeAfter = 250 * time.Millisecond
+
+// starvationCheckInterval is how often the output is checked for starvation
+const starvationCheckInterval = 50 * time.Millisecond
+
+// backpressureRetry is how long to wait before retrying a write to a full output
+const backpressureRetry = 2 * time.Millisecond
+
 // Player provides high-level audio playback from Resonate servers
 type Player struct {
 	config PlayerConfig
@@ -95,22 +237,93 @@ type Player struct {
 	output    output.Output
 	decoder   decode.Decoder
 
+	// streamMu guards decoder and scheduler, which are replaced on
+	// stream/start and used by the audio chunk goroutine
+	streamMu gosync.Mutex
+
+	// generation counts handled stream/start and stream/clear messages;
+	// chunks from other generations are stale and dropped
+	generation atomic.Uint64
+
+	// paused silences local output while still following the group timeline
+	paused atomic.Bool
+
+	// latencyOffset is the user's output delay compensation, added to the
+	// DSP chain's latency when scheduling
+	latencyOffset atomic.Int64
+
+	// dspMu guards dspConfig and dspFormat; chain is built from them for
+	// the current stream and swapped in atomically (nil when disabled)
+	dspMu     gosync.Mutex
+	dspConfig dsp.ChainConfig
+	dspFormat audio.Format
+	chain     atomic.Pointer[dsp.Chain]
+
+	// connMu guards state, replacing client, which happens only while no
+	// server is connected, and the listener for server-initiated connections
+	connMu   gosync.Mutex
+	listener *http.Server
+
+	// preferred and lastServer steer server selection (guarded by
+	// connMu); disconnected wakes Start's supervisor when a session ends
+	// dialMu serializes outgoing connections, so a switch and a failover
+	// never dial at once
+	dialMu gosync.Mutex
+
+	// saveMu serializes writes to the state file
+	saveMu gosync.Mutex
+
+	preferred    string
+	lastServer   *savedServer
+	disconnected chan struct{}
+	started      atomic.Bool
+
+	// maxVolume caps state.Volume (guarded by connMu)
+	maxVolume int
+
 	// State
 	state      PlayerState
+	progress   atomic.Pointer[Progress]
 	ctx        context.Context
 	cancel     context.CancelFunc
 	serverAddr string
+	clientID   string
 }
 
 // NewPlayer creates a new player with the given configuration
 func NewPlayer(config PlayerConfig) (*Player, error) {
-	// Set defaults
-	if config.Volume == 0 {
+	saved, err := loadPlayerState(config.StateFile)
+	if err != nil {
+		return nil, err
+	}
+
+	// Set defaults, preferring saved settings
+	config.ClientID = cmp.Or(config.ClientID, saved.ClientID, uuid.New().String())
+	config.PlayerName = cmp.Or(config.PlayerName, saved.Name, defaultPlayerName())
+	if config.Volume == 0 && saved.Volume != nil {
+		config.Volume = *saved.Volume
+	} else if config.Volume == 0 {
 		config.Volume = 100
 	}
+	if config.MaxVolume == 0 {
+		config.MaxVolume = 100
+	}
+	if config.MaxVolume < 1 || config.MaxVolume > 100 {
+		return nil, fmt.Errorf("max volume must be between 1 and 100, got %d", config.MaxVolume)
+	}
+	config.Volume = min(config.Volume, config.MaxVolume)
+	if config.LatencyOffset == 0 {
+		config.LatencyOffset = time.Duration(saved.LatencyOffsetMs * float64(time.Millisecond))
+	}
 	if config.BufferMs == 0 {
 		config.BufferMs = 500
 	}
+	if config.Channels == 0 {
+		config.Channels = 2
+	}
+	if config.Channels < 1 || config.Channels > audio.MaxChannels {
+		return nil, fmt.Errorf("channels must be between 1 and %d, got %d", audio.MaxChannels, config.Channels)
+	}
 	if config.DeviceInfo.ProductName == "" {
 		config.DeviceInfo.ProductName = "Sendspin Player"
 	}
@@ -131,33 +344,161 @@ func NewPlayer(config PlayerConfig) (*Player, error) {
 	// (oto for 16-bit, malgo for 24-bit)
 
 	player := &Player{
-		config:     config,
-		clockSync:  clockSync,
-		output:     nil, // Created when format is known
-		ctx:        ctx,
-		cancel:     cancel,
-		serverAddr: config.ServerAddr,
+		config:       config,
+		clockSync:    clockSync,
+		output:       config.Output, // Created when format is known unless injected
+		ctx:          ctx,
+		cancel:       cancel,
+		serverAddr:   config.ServerAddr,
+		clientID:     config.ClientID,
+		dspConfig:    config.DSP,
+		preferred:    config.PreferredServer,
+		lastServer:   saved.LastServer,
+		disconnected: make(chan struct{}, 1),
+		maxVolume:    config.MaxVolume,
 		state: PlayerState{
 			State:     "idle",
 			Volume:    config.Volume,
-			Muted:     false,
+			Muted:     saved.Muted,
 			Connected: false,
 		},
 	}
+	player.latencyOffset.Store(int64(config.LatencyOffset))
+
+	// Save right away so the client ID is stable from the first run
+	player.saveState()
 
 	return player, nil
 }
 
 // Connect establishes connection to the server and performs initial setup
 func (p *Player) Connect() error {
-	clientID := uuid.New().String()
+	return p.ConnectTo(p.config.ServerAddr)
+}
+
+// ConnectTo connects to the server at addr (host:port), e.g. one found by
+// discovery, instead of the configured one
+func (p *Player) ConnectTo(addr string) error {
+	p.dialMu.Lock()
+	defer p.dialMu.Unlock()
+	return p.connectTo(addr)
+}
+
+// connectTo dials a server (called with dialMu held)
+func (p *Player) connectTo(addr string) error {
+	if p.ctx.Err() != nil {
+		return fmt.Errorf("player is closed")
+	}
+	if p.connected() {
+		return fmt.Errorf("already connected")
+	}
+
+	config := p.clientConfig()
+	config.ServerAddr = addr
+	c := protocol.NewClient(config)
+	if err := c.Connect(); err != nil {
+		return fmt.Errorf("connection failed: %w", err)
+	}
+	if err := p.start(c, addr); err != nil {
+		c.Close()
+		return err
+	}
+	p.rememberServer(c.Server(), addr)
+	return nil
+}
 
-	// Configure protocol client
-	clientConfig := protocol.Config{
+// Listen hosts a WebSocket endpoint at addr (e.g. ":8927") so servers
+// that discover the player can connect to it. The handshake is the same
+// as with Connect. One server is served at a time; others are refused
+// until it disconnects. Listen returns once the endpoint is listening.
+func (p *Player) Listen(addr string) error {
+	p.connMu.Lock()
+	defer p.connMu.Unlock()
+
+	if p.listener != nil {
+		return fmt.Errorf("already listening")
+	}
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/sendspin", p.handleServerConnection)
+	p.listener = &http.Server{Handler: mux}
+
+	go func(server *http.Server) {
+		if err := server.Serve(ln); err != http.ErrServerClosed {
+			p.notifyError(fmt.Errorf("listener failed: %w", err))
+		}
+	}(p.listener)
+
+	log.Printf("Listening for server connections on %s", ln.Addr())
+	return nil
+}
+
+// handleServerConnection adopts a connection opened by a server
+func (p *Player) handleServerConnection(w http.ResponseWriter, r *http.Request) {
+	if !authorized(r, p.config.AuthToken) {
+		log.Printf("Refused unauthorized server at %s", r.RemoteAddr)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if p.connected() {
+		http.Error(w, "player is connected to another server", http.StatusConflict)
+		return
+	}
+
+	upgrader := websocket.Upgrader{
+		CheckOrigin: func(r *http.Request) bool { return true },
+	}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("WebSocket upgrade error: %v", err)
+		return
+	}
+
+	c := protocol.NewClient(p.clientConfig())
+	if err := c.Accept(conn); err != nil {
+		p.notifyError(fmt.Errorf("connection from %s failed: %w", r.RemoteAddr, err))
+		return
+	}
+	if err := p.start(c, r.RemoteAddr); err != nil {
+		c.Close()
+		log.Printf("Refused server at %s: %v", r.RemoteAddr, err)
+	}
+}
+
+// connected reports whether a server session is running
+func (p *Player) connected() bool {
+	p.connMu.Lock()
+	defer p.connMu.Unlock()
+	return p.state.Connected
+}
+
+// ClientID returns the ID the player identifies itself with
+func (p *Player) ClientID() string {
+	return p.clientID
+}
+
+// Name returns the player's display name
+func (p *Player) Name() string {
+	return p.config.PlayerName
+}
+
+// clientConfig describes this player for the handshake
+func (p *Player) clientConfig() protocol.Config {
+	st := p.Status()
+	return protocol.Config{
 		ServerAddr: p.serverAddr,
-		ClientID:   clientID,
+		ClientID:   p.clientID,
 		Name:       p.config.PlayerName,
-		Version:    1,
+		Volume:     st.Volume,
+		Muted:      st.Muted,
+		Version:    protocol.Version,
+		AuthToken:  p.config.AuthToken,
+		TLS:        p.config.TLS,
 		DeviceInfo: protocol.DeviceInfo{
 			ProductName:     p.config.DeviceInfo.ProductName,
 			Manufacturer:    p.config.DeviceInfo.Manufacturer,
@@ -165,23 +506,12 @@ func (p *Player) Connect() error {
 		},
 		PlayerSupport: protocol.PlayerSupport{
 			// New spec format - hi-res formats first
-			SupportFormats: []protocol.AudioFormat{
-				// PCM hi-res - highest quality first
-				{Codec: "pcm", Channels: 2, SampleRate: 192000, BitDepth: 24},
-				{Codec: "pcm", Channels: 2, SampleRate: 176400, BitDepth: 24},
-				{Codec: "pcm", Channels: 2, SampleRate: 96000, BitDepth: 24},
-				{Codec: "pcm", Channels: 2, SampleRate: 88200, BitDepth: 24},
-				// PCM standard quality
-				{Codec: "pcm", Channels: 2, SampleRate: 48000, BitDepth: 16},
-				{Codec: "pcm", Channels: 2, SampleRate: 44100, BitDepth: 16},
-				// Opus fallback
-				{Codec: "opus", Channels: 2, SampleRate: 48000, BitDepth: 16},
-			},
+			SupportFormats:    supportFormats(p.config.Channels),
 			BufferCapacity:    1048576,
-			SupportedCommands: []string{"volume", "mute"},
+			SupportedCommands: []string{"volume", "mute", "dsp"},
 			// Legacy format (Music Assistant compatibility)
 			SupportCodecs:      []string{"pcm", "opus"},
-			SupportChannels:    []int{2, 1},
+			SupportChannels:    supportChannels(p.config.Channels),
 			SupportSampleRates: []int{192000, 176400, 96000, 88200, 48000, 44100},
 			SupportBitDepth:    []int{24, 16},
 		},
@@ -194,43 +524,92 @@ func (p *Player) Connect() error {
 			BufferCapacity: 1048576,
 		},
 	}
+}
 
-	p.client = protocol.NewClient(clientConfig)
-
-	if err := p.client.Connect(); err != nil {
-		return fmt.Errorf("connection failed: %w", err)
+// start runs a session on a connection that has completed the handshake,
+// in either direction
+func (p *Player) start(c *protocol.Client, addr string) error {
+	p.connMu.Lock()
+	if p.state.Connected {
+		p.connMu.Unlock()
+		return fmt.Errorf("already connected")
 	}
-
-	log.Printf("Connected to server: %s", p.serverAddr)
+	hello := c.Server()
+	p.client = c
+	p.serverAddr = addr
 	p.state.Connected = true
+	p.state.Server = addr
+	p.state.ServerID = hello.ServerID
+	p.state.ServerName = hello.Name
+	p.connMu.Unlock()
+
+	// The new connection counts stream generations from zero
+	p.streamMu.Lock()
+	p.generation.Store(0)
+	p.streamMu.Unlock()
+
+	log.Printf("Connected to server: %s", addr)
 	p.notifyStateChange()
 
 	// Perform initial clock sync
-	if err := p.performInitialSync(); err != nil {
+	if err := p.performInitialSync(c); err != nil {
 		log.Printf("Initial clock sync failed: %v", err)
 	}
 
 	// Start component goroutines
-	go p.handleStreamStart()
-	go p.handleAudioChunks()
-	go p.handleControls()
-	go p.handleMetadata()
-	go p.handleSessionUpdates()
-	go p.clockSyncLoop()
+	go p.handleStreamControl(c)
+	go p.handleAudioChunks(c)
+	go p.handleControls(c)
+	go p.handleMetadata(c)
+	go p.handleSessionUpdates(c)
+	go p.clockSyncLoop(c)
+	go p.watchConnection(c)
 
 	return nil
 }
 
+// watchConnection marks the player disconnected when the server goes
+// away, letting buffered audio play out, and wakes Start's supervisor to
+// fail over
+func (p *Player) watchConnection(c *protocol.Client) {
+	select {
+	case <-c.Done():
+	case <-p.ctx.Done():
+		return
+	}
+
+	if p.endSession(c) {
+		p.wakeSupervisor()
+	}
+}
+
+// endSession marks the player disconnected if c is the current session,
+// reporting whether it was
+func (p *Player) endSession(c *protocol.Client) bool {
+	p.connMu.Lock()
+	if p.client != c || !p.state.Connected {
+		p.connMu.Unlock()
+		return false
+	}
+	p.state.Connected = false
+	p.connMu.Unlock()
+
+	log.Printf("Disconnected from server: %s", p.serverAddr)
+	p.handleStreamEnd()
+	p.notifyStateChange()
+	return true
+}
+
 // performInitialSync does multiple sync rounds before audio starts
-func (p *Player) performInitialSync() error {
+func (p *Player) performInitialSync(c *protocol.Client) error {
 	log.Printf("Performing initial clock synchronization...")
 
 	for i := 0; i < 5; i++ {
 		t1 := time.Now().UnixMicro()
-		p.client.SendTimeSync(t1)
+		c.SendTimeSync(t1)
 
 		select {
-		case resp := <-p.client.TimeSyncResp:
+		case resp := <-c.TimeSyncResp:
 			t4 := time.Now().UnixMicro()
 			p.clockSync.ProcessSyncResponse(resp.ClientTransmitted, resp.ServerReceived, resp.ServerTransmitted, t4)
 
@@ -248,7 +627,7 @@ func (p *Player) performInitialSync() error {
 }
 
 // clockSyncLoop continuously syncs clock
-func (p *Player) clockSyncLoop() {
+func (p *Player) clockSyncLoop(c *protocol.Client) {
 	ticker := time.NewTicker(1 * time.Second)
 	defer ticker.Stop()
 
@@ -258,7 +637,7 @@ func (p *Player) clockSyncLoop() {
 			// Drain stale responses
 			for {
 				select {
-				case <-p.client.TimeSyncResp:
+				case <-c.TimeSyncResp:
 					log.Printf("Discarded stale time sync response")
 				default:
 					goto sendRequest
@@ -267,111 +646,218 @@ func (p *Player) clockSyncLoop() {
 
 		sendRequest:
 			t1 := time.Now().UnixMicro()
-			p.client.SendTimeSync(t1)
+			c.SendTimeSync(t1)
 
-		case resp := <-p.client.TimeSyncResp:
+		case resp := <-c.TimeSyncResp:
 			t4 := time.Now().UnixMicro()
 			p.clockSync.ProcessSyncResponse(resp.ClientTransmitted, resp.ServerReceived, resp.ServerTransmitted, t4)
 
+		case <-c.Done():
+			return
 		case <-p.ctx.Done():
 			return
 		}
 	}
 }
 
-// handleStreamStart initializes decoder and output
-func (p *Player) handleStreamStart() {
+// handleStreamControl processes stream/start, stream/clear and stream/end
+// in the order the server sent them
+func (p *Player) handleStreamControl(c *protocol.Client) {
 	for {
 		select {
-		case start := <-p.client.StreamStart:
-			if start.Player == nil {
-				log.Printf("Received stream/start with no player info")
-				continue
+		case event := <-c.StreamEvents:
+			switch e := event.(type) {
+			case protocol.StreamStart:
+				p.handleStreamStart(e)
+			case protocol.StreamClear:
+				p.handleStreamClear()
+			case protocol.StreamEnd:
+				p.handleStreamEnd()
 			}
 
-			log.Printf("Stream starting: %s %dHz %dch %dbit",
-				start.Player.Codec, start.Player.SampleRate, start.Player.Channels, start.Player.BitDepth)
+		case <-c.Done():
+			return
+		case <-p.ctx.Done():
+			return
+		}
+	}
+}
 
-			format := audio.Format{
-				Codec:      start.Player.Codec,
-				SampleRate: start.Player.SampleRate,
-				Channels:   start.Player.Channels,
-				BitDepth:   start.Player.BitDepth,
-			}
+// handleStreamStart initializes decoder, output and a fresh scheduler
+func (p *Player) handleStreamStart(start protocol.StreamStart) {
+	// Discard audio buffered for the previous stream before anything else;
+	// chunks for the new stream are dropped until the scheduler is ready
+	p.streamMu.Lock()
+	p.generation.Add(1)
+	if p.scheduler != nil {
+		p.scheduler.Stop()
+		p.scheduler = nil
+	}
+	if p.decoder != nil {
+		p.decoder.Close()
+		p.decoder = nil
+	}
+	p.streamMu.Unlock()
 
-			// Initialize decoder
-			var decoder decode.Decoder
-			var err error
-
-			switch format.Codec {
-			case "pcm":
-				decoder, err = decode.NewPCM(format)
-			case "opus":
-				decoder, err = decode.NewOpus(format)
-			case "flac":
-				decoder, err = decode.NewFLAC(format)
-			case "mp3":
-				decoder, err = decode.NewMP3(format)
-			default:
-				err = fmt.Errorf("unsupported codec: %s", format.Codec)
-			}
+	if start.Player == nil {
+		log.Printf("Received stream/start with no player info")
+		return
+	}
 
-			if err != nil {
-				p.notifyError(fmt.Errorf("failed to create decoder: %w", err))
-				continue
-			}
-			p.decoder = decoder
-
-			// Create appropriate output backend based on bit depth
-			// Use oto for 16-bit (Music Assistant compatibility)
-			// Use malgo for 24-bit (true hi-res support)
-			if p.output == nil {
-				if format.BitDepth <= 16 {
-					p.output = output.NewOto()
-					log.Printf("Using oto backend for %d-bit audio", format.BitDepth)
-				} else {
-					p.output = output.NewMalgo()
-					log.Printf("Using malgo backend for %d-bit audio", format.BitDepth)
-				}
-			}
+	log.Printf("Stream starting: %s %dHz %dch (%s) %dbit",
+		start.Player.Codec, start.Player.SampleRate, start.Player.Channels,
+		audio.LayoutName(start.Player.Channels), start.Player.BitDepth)
+	if start.Player.ChannelRole != "" && start.Player.ChannelRole != string(ChannelsStereo) {
+		log.Printf("Channel role: %s", start.Player.ChannelRole)
+	}
 
-			// Initialize output
-			if err := p.output.Open(format.SampleRate, format.Channels, format.BitDepth); err != nil {
-				p.notifyError(fmt.Errorf("failed to initialize output: %w", err))
-				continue
-			}
+	format := audio.Format{
+		Codec:      start.Player.Codec,
+		SampleRate: start.Player.SampleRate,
+		Channels:   start.Player.Channels,
+		BitDepth:   start.Player.BitDepth,
+	}
+	if start.Player.CodecHeader != "" {
+		header, err := base64.StdEncoding.DecodeString(start.Player.CodecHeader)
+		if err != nil {
+			p.notifyError(fmt.Errorf("invalid codec header: %w", err))
+			return
+		}
+		format.CodecHeader = header
+	}
 
-			// Update state
-			p.state.Codec = format.Codec
-			p.state.SampleRate = format.SampleRate
-			p.state.Channels = format.Channels
-			p.state.BitDepth = format.BitDepth
-			p.state.State = "playing"
-			p.notifyStateChange()
+	// Initialize decoder
+	var decoder decode.Decoder
+	var err error
+
+	switch format.Codec {
+	case "pcm":
+		decoder, err = decode.NewPCM(format)
+	case "opus":
+		decoder, err = decode.NewOpus(format)
+	case "flac":
+		decoder, err = decode.NewFLAC(format)
+	case "mp3":
+		decoder, err = decode.NewMP3(format)
+	default:
+		err = fmt.Errorf("unsupported codec: %s", format.Codec)
+	}
 
-			// Initialize scheduler
-			p.scheduler = NewScheduler(p.clockSync, p.config.BufferMs)
-			go p.scheduler.Run()
-			go p.handleScheduledAudio()
+	if err != nil {
+		p.notifyError(fmt.Errorf("failed to create decoder: %w", err))
+		return
+	}
 
-		case <-p.ctx.Done():
-			return
+	// One backend for every bit depth; it negotiates the device format
+	if p.output == nil {
+		p.output = output.New(output.Config{
+			Device:      p.config.Device,
+			Passthrough: p.config.BitPerfect,
+		})
+		if vc, ok := p.output.(output.VolumeControl); ok {
+			st := p.Status()
+			vc.SetVolume(st.Volume)
+			vc.SetMuted(st.Muted)
+		}
+	}
+
+	// Initialize output
+	if err := p.output.Open(format.SampleRate, format.Channels, format.BitDepth); err != nil {
+		decoder.Close()
+		p.notifyError(fmt.Errorf("failed to initialize output: %w", err))
+		return
+	}
+	p.flushOutput()
+
+	// Update state
+	p.connMu.Lock()
+	p.state.Codec = format.Codec
+	p.state.SampleRate = format.SampleRate
+	p.state.Channels = format.Channels
+	p.state.BitDepth = format.BitDepth
+	p.state.ChannelRole = start.Player.ChannelRole
+	p.state.ChannelLayout = start.Player.ChannelLayout
+	if p.state.ChannelLayout == "" {
+		p.state.ChannelLayout = audio.LayoutName(format.Channels)
+	}
+	if p.paused.Load() {
+		p.state.State = "paused"
+	} else {
+		p.state.State = "playing"
+	}
+	p.connMu.Unlock()
+	p.notifyStateChange()
+
+	// Build the DSP chain for this format; a bad impulse response
+	// shouldn't stop playback
+	p.dspMu.Lock()
+	p.dspFormat = format
+	chain, err := newChain(p.dspConfig, format)
+	p.dspMu.Unlock()
+	if err != nil {
+		p.notifyError(fmt.Errorf("failed to create DSP chain, playing unprocessed: %w", err))
+	}
+	p.chain.Store(chain)
+
+	// Initialize scheduler
+	scheduler := NewScheduler(p.clockSync, p.config.BufferMs)
+	scheduler.SetLatency(p.schedulerLatency(chain, format))
+	go scheduler.Run()
+	go p.handleScheduledAudio(scheduler, format)
+
+	p.streamMu.Lock()
+	p.decoder = decoder
+	p.scheduler = scheduler
+	p.streamMu.Unlock()
+}
+
+// handleStreamClear drops all audio that has not played yet
+func (p *Player) handleStreamClear() {
+	p.streamMu.Lock()
+	p.generation.Add(1)
+	if p.scheduler != nil {
+		p.scheduler.Clear()
+	}
+	p.streamMu.Unlock()
+
+	p.flushOutput()
+}
+
+// handleStreamEnd lets buffered audio finish, after which the player goes idle
+func (p *Player) handleStreamEnd() {
+	p.streamMu.Lock()
+	defer p.streamMu.Unlock()
+
+	if p.scheduler != nil {
+		p.scheduler.End()
+	}
+}
+
+// flushOutput discards audio queued in the output device, if supported
+func (p *Player) flushOutput() {
+	if f, ok := p.output.(output.Flusher); ok {
+		if err := f.Flush(); err != nil {
+			p.notifyError(fmt.Errorf("failed to flush output: %w", err))
 		}
 	}
 }
 
 // handleAudioChunks decodes and schedules audio
-func (p *Player) handleAudioChunks() {
+func (p *Player) handleAudioChunks(c *protocol.Client) {
 	for {
 		select {
-		case chunk := <-p.client.AudioChunks:
-			if p.decoder == nil || p.scheduler == nil {
+		case chunk := <-c.AudioChunks:
+			p.streamMu.Lock()
+			if chunk.Generation != p.generation.Load() || p.decoder == nil || p.scheduler == nil {
+				// Stale (queued before a stream/start or stream/clear) or no stream yet
+				p.streamMu.Unlock()
 				continue
 			}
 
 			// Decode
 			pcm, err := p.decoder.Decode(chunk.Data)
 			if err != nil {
+				p.streamMu.Unlock()
 				p.notifyError(fmt.Errorf("decode error: %w", err))
 				continue
 			}
@@ -382,41 +868,233 @@ func (p *Player) handleAudioChunks() {
 				Samples:   pcm,
 			}
 			p.scheduler.Schedule(buf)
+			p.streamMu.Unlock()
 
+		case <-c.Done():
+			return
 		case <-p.ctx.Done():
 			return
 		}
 	}
 }
 
-// handleScheduledAudio plays scheduled buffers
-func (p *Player) handleScheduledAudio() {
+// handleScheduledAudio plays buffers from a scheduler until it is stopped
+func (p *Player) handleScheduledAudio(sched *Scheduler, format audio.Format) {
+	fade := newFader()
+	frames := fadeFrames(format.SampleRate)
+	paused := false
+	generation := p.generation.Load()
+
+	starvation := time.NewTicker(starvationCheckInterval)
+	defer starvation.Stop()
+
 	for {
 		select {
-		case buf := <-p.scheduler.Output():
-			if err := p.output.Write(buf.Samples); err != nil {
+		case <-starvation.C:
+			if !paused && !p.paused.Load() {
+				p.checkStarvation(sched)
+			}
+
+		case buf := <-sched.Output():
+			// Pick up pause/resume at buffer boundaries
+			if nowPaused := p.paused.Load(); nowPaused != paused {
+				paused = nowPaused
+				if paused {
+					fade.fadeTo(0, frames)
+				} else {
+					// Re-join the timeline at this buffer, fading in from silence
+					p.flushOutput()
+					fade.gain = 0
+					fade.fadeTo(1, frames)
+					p.resetChain()
+				}
+			}
+
+			// Audio before a stream/clear must not ring into what follows
+			if g := p.generation.Load(); g != generation {
+				generation = g
+				p.resetChain()
+			}
+
+			if fade.silent() {
+				// Paused: this buffer's slot in the group timeline passes in silence
+				continue
+			}
+
+			if chain := p.chain.Load(); chain != nil {
+				chain.Process(buf.Samples)
+			}
+			fade.apply(buf.Samples, format.Channels)
+			if err := p.writeOutput(buf.Samples, format); err != nil {
 				p.notifyError(fmt.Errorf("playback error: %w", err))
 			}
 
+		case <-sched.ctx.Done():
+			select {
+			case <-sched.Done():
+				// Stream ended: play what was already handed over, then go idle
+				p.drainScheduled(sched, format)
+				p.streamEnded()
+			default:
+			}
+			return
+
 		case <-p.ctx.Done():
 			return
 		}
 	}
 }
 
-// handleControls processes server commands
-func (p *Player) handleControls() {
+// checkStarvation re-primes the scheduler once the output has gone without
+// audio for reprimeAfter, so playback restarts cleanly on the timeline
+// instead of stuttering through whatever trickles in
+func (p *Player) checkStarvation(sched *Scheduler) {
+	reporter, ok := p.output.(output.StatsReporter)
+	if !ok {
+		return
+	}
+
+	starved := reporter.Stats().Starved
+	if starved < reprimeAfter {
+		return
+	}
+
+	if sched.Reprime() {
+		log.Printf("Output starved for %v, re-priming", starved)
+		p.flushOutput()
+	}
+}
+
+// writeOutput writes samples to the output. Backpressure from a
+// non-blocking output is waited out for up to the duration of the samples
+// being written; anything still unwritten after that is dropped.
+func (p *Player) writeOutput(samples []int32, format audio.Format) error {
+	var deadline time.Time
+	for {
+		err := p.output.Write(samples)
+
+		var full *output.BufferFullError
+		if !errors.As(err, &full) {
+			return err
+		}
+
+		if deadline.IsZero() {
+			frames := len(samples) / max(format.Channels, 1)
+			deadline = time.Now().Add(time.Duration(frames) * time.Second / time.Duration(max(format.SampleRate, 1)))
+		}
+		if time.Now().After(deadline) {
+			return err
+		}
+
+		samples = samples[full.Written:]
+		time.Sleep(backpressureRetry)
+	}
+}
+
+// drainScheduled writes any buffers left in an ended scheduler's output,
+// followed by the tail still held in the DSP chain
+func (p *Player) drainScheduled(sched *Scheduler, format audio.Format) {
+	chain := p.chain.Load()
 	for {
 		select {
-		case cmd := <-p.client.ControlMsgs:
+		case buf := <-sched.Output():
+			if chain != nil {
+				chain.Process(buf.Samples)
+			}
+			if err := p.writeOutput(buf.Samples, format); err != nil {
+				p.notifyError(fmt.Errorf("playback error: %w", err))
+			}
+		default:
+			if chain != nil && chain.Latency() > 0 {
+				tail := make([]int32, chain.Latency()*format.Channels)
+				chain.Process(tail)
+				if err := p.writeOutput(tail, format); err != nil {
+					p.notifyError(fmt.Errorf("playback error: %w", err))
+				}
+			}
+			return
+		}
+	}
+}
+
+// resetChain clears the DSP chain's state, e.g. when audio is discontinuous
+func (p *Player) resetChain() {
+	if chain := p.chain.Load(); chain != nil {
+		chain.Reset()
+	}
+}
+
+// newChain builds the DSP chain for a stream format; it returns nil when
+// the configuration leaves audio untouched
+func newChain(config dsp.ChainConfig, format audio.Format) (*dsp.Chain, error) {
+	if config.Empty() {
+		return nil, nil
+	}
+	return dsp.NewChain(config, format.SampleRate, format.Channels)
+}
+
+// schedulerLatency is how early audio is released: the chain's delay
+// plus the latency offset
+func (p *Player) schedulerLatency(chain *dsp.Chain, format audio.Format) time.Duration {
+	return chainLatency(chain, format) + time.Duration(p.latencyOffset.Load())
+}
+
+// chainLatency converts the chain's delay to a duration
+func chainLatency(chain *dsp.Chain, format audio.Format) time.Duration {
+	if chain == nil || format.SampleRate == 0 {
+		return 0
+	}
+	return time.Duration(chain.Latency()) * time.Second / time.Duration(format.SampleRate)
+}
+
+// streamEnded moves the player to idle once an ended stream has played out
+func (p *Player) streamEnded() {
+	log.Printf("Stream ended")
+	st := p.setPlayState("idle")
+	p.notifyStateChange()
+
+	if p.client != nil {
+		p.client.SendState(protocol.ClientState{
+			State:  "idle",
+			Volume: st.Volume,
+			Muted:  st.Muted,
+		})
+	}
+}
+
+// handleControls processes server commands and reports server errors
+func (p *Player) handleControls(c *protocol.Client) {
+	for {
+		select {
+		case cmd := <-c.ControlMsgs:
 			switch cmd.Command {
 			case "volume":
 				p.SetVolume(cmd.Volume)
 
 			case "mute":
 				p.Mute(cmd.Mute)
+
+			case "dsp":
+				var config dsp.ChainConfig
+				if cmd.DSP != nil {
+					config = dspConfigFromProtocol(*cmd.DSP)
+				}
+				ir, err := p.remoteImpulseResponse(config.ImpulseResponse)
+				if err != nil {
+					p.notifyError(fmt.Errorf("refused DSP from server: %w", err))
+					continue
+				}
+				config.ImpulseResponse = ir
+				if err := p.SetDSP(config); err != nil {
+					p.notifyError(fmt.Errorf("failed to apply DSP from server: %w", err))
+				}
 			}
 
+		case serverErr := <-c.Errors:
+			p.notifyError(fmt.Errorf("server reported an error: %w", &serverErr))
+
+		case <-c.Done():
+			return
 		case <-p.ctx.Done():
 			return
 		}
@@ -424,10 +1102,10 @@ func (p *Player) handleControls() {
 }
 
 // handleMetadata processes metadata updates
-func (p *Player) handleMetadata() {
+func (p *Player) handleMetadata(c *protocol.Client) {
 	for {
 		select {
-		case meta := <-p.client.Metadata:
+		case meta := <-c.Metadata:
 			if p.config.OnMetadata != nil {
 				p.config.OnMetadata(Metadata{
 					Title:  meta.Title,
@@ -436,6 +1114,8 @@ func (p *Player) handleMetadata() {
 				})
 			}
 
+		case <-c.Done():
+			return
 		case <-p.ctx.Done():
 			return
 		}
@@ -443,10 +1123,10 @@ func (p *Player) handleMetadata() {
 }
 
 // handleSessionUpdates processes session updates
-func (p *Player) handleSessionUpdates() {
+func (p *Player) handleSessionUpdates(c *protocol.Client) {
 	for {
 		select {
-		case update := <-p.client.SessionUpdate:
+		case update := <-c.SessionUpdate:
 			if update.Metadata != nil && p.config.OnMetadata != nil {
 				p.config.OnMetadata(Metadata{
 					Title:       update.Metadata.Title,
@@ -460,113 +1140,300 @@ func (p *Player) handleSessionUpdates() {
 				})
 			}
 
+			if update.Metadata != nil && update.Metadata.Timestamp != 0 {
+				p.updateProgress(update)
+			}
+
+		case <-c.Done():
+			return
 		case <-p.ctx.Done():
 			return
 		}
 	}
 }
 
+// updateProgress stores the progress anchor from a session update
+func (p *Player) updateProgress(update protocol.SessionUpdate) {
+	meta := update.Metadata
+	speed := meta.PlaybackSpeed
+	if speed == 0 {
+		speed = 1.0
+	}
+	if update.PlaybackState == "paused" {
+		// Group is paused: position holds at the anchor
+		speed = 0
+	}
+
+	progress := Progress{
+		Position:  time.Duration(meta.TrackProgress) * time.Millisecond,
+		Duration:  time.Duration(meta.TrackDuration) * time.Second,
+		Speed:     speed,
+		Timestamp: meta.Timestamp,
+	}
+	p.progress.Store(&progress)
+
+	if p.config.OnProgress != nil {
+		p.config.OnProgress(progress)
+	}
+}
+
+// Progress returns the current track position and duration.
+// Returns false if the server has not reported progress.
+func (p *Player) Progress() (position, duration time.Duration, ok bool) {
+	progress := p.progress.Load()
+	if progress == nil {
+		return 0, 0, false
+	}
+	return progress.At(sync.ServerMicrosNow()), progress.Duration, true
+}
+
 // Play starts or resumes playback
 func (p *Player) Play() error {
-	if !p.state.Connected {
+	if !p.connected() {
 		return fmt.Errorf("not connected")
 	}
 
-	p.state.State = "playing"
+	p.paused.Store(false)
+	st := p.setPlayState("playing")
 	p.notifyStateChange()
 
 	return p.client.SendState(protocol.ClientState{
 		State:  "playing",
-		Volume: p.state.Volume,
-		Muted:  p.state.Muted,
+		Volume: st.Volume,
+		Muted:  st.Muted,
 	})
 }
 
-// Pause pauses playback
+// Pause fades out and silences local playback. The player keeps following
+// the group timeline, so Play resumes at the group's current position.
+// When every player in the group is paused the server pauses its source.
 func (p *Player) Pause() error {
-	if !p.state.Connected {
+	if !p.connected() {
 		return fmt.Errorf("not connected")
 	}
 
-	p.state.State = "paused"
+	p.paused.Store(true)
+	st := p.setPlayState("paused")
 	p.notifyStateChange()
 
 	return p.client.SendState(protocol.ClientState{
-		State:  "idle",
-		Volume: p.state.Volume,
-		Muted:  p.state.Muted,
+		State:  "paused",
+		Volume: st.Volume,
+		Muted:  st.Muted,
 	})
 }
 
 // Stop stops playback
 func (p *Player) Stop() error {
-	if !p.state.Connected {
+	if !p.connected() {
 		return fmt.Errorf("not connected")
 	}
 
-	p.state.State = "idle"
+	st := p.setPlayState("idle")
 	p.notifyStateChange()
 
 	return p.client.SendState(protocol.ClientState{
 		State:  "idle",
-		Volume: p.state.Volume,
-		Muted:  p.state.Muted,
+		Volume: st.Volume,
+		Muted:  st.Muted,
 	})
 }
 
-// SetVolume sets the volume (0-100)
+// SetVolume sets the volume (0-100), capped at the volume limit
 func (p *Player) SetVolume(volume int) error {
 	if volume < 0 {
 		volume = 0
 	}
-	if volume > 100 {
-		volume = 100
-	}
 
+	p.connMu.Lock()
+	volume = min(volume, p.maxVolume)
 	p.state.Volume = volume
+	st := p.state
+	p.connMu.Unlock()
 
 	// Apply to output
-	if oto, ok := p.output.(*output.Oto); ok {
-		oto.SetVolume(volume)
+	if vc, ok := p.output.(output.VolumeControl); ok {
+		vc.SetVolume(volume)
 	}
 
 	// Send state to server
-	if p.client != nil && p.state.Connected {
+	if p.client != nil && st.Connected {
 		p.client.SendState(protocol.ClientState{
-			State:  p.state.State,
+			State:  st.State,
 			Volume: volume,
-			Muted:  p.state.Muted,
+			Muted:  st.Muted,
 		})
 	}
 
 	p.notifyStateChange()
+	p.saveState()
 	return nil
 }
 
+// SetMaxVolume changes the volume limit (1-100). A volume above the new
+// limit is lowered to it.
+func (p *Player) SetMaxVolume(limit int) error {
+	if limit < 1 || limit > 100 {
+		return fmt.Errorf("max volume must be between 1 and 100, got %d", limit)
+	}
+
+	p.connMu.Lock()
+	p.maxVolume = limit
+	volume := p.state.Volume
+	p.connMu.Unlock()
+
+	if volume > limit {
+		return p.SetVolume(limit)
+	}
+	return nil
+}
+
+// MaxVolume returns the volume limit
+func (p *Player) MaxVolume() int {
+	p.connMu.Lock()
+	defer p.connMu.Unlock()
+	return p.maxVolume
+}
+
 // Mute sets the mute state
 func (p *Player) Mute(muted bool) error {
+	p.connMu.Lock()
 	p.state.Muted = muted
+	st := p.state
+	p.connMu.Unlock()
 
 	// Apply to output
-	if oto, ok := p.output.(*output.Oto); ok {
-		oto.SetMuted(muted)
+	if vc, ok := p.output.(output.VolumeControl); ok {
+		vc.SetMuted(muted)
 	}
 
 	// Send state to server
-	if p.client != nil && p.state.Connected {
+	if p.client != nil && st.Connected {
 		p.client.SendState(protocol.ClientState{
-			State:  p.state.State,
-			Volume: p.state.Volume,
+			State:  st.State,
+			Volume: st.Volume,
 			Muted:  muted,
 		})
 	}
 
 	p.notifyStateChange()
+	p.saveState()
+	return nil
+}
+
+// SetDSP replaces the processing chain. The impulse response (if any) is
+// loaded immediately for the current stream, so errors are reported here
+// and the previous chain stays in place. Scheduling is adjusted for the
+// new chain's latency.
+func (p *Player) SetDSP(config dsp.ChainConfig) error {
+	if err := config.Validate(); err != nil {
+		return fmt.Errorf("invalid DSP config: %w", err)
+	}
+
+	p.dspMu.Lock()
+	defer p.dspMu.Unlock()
+
+	var chain *dsp.Chain
+	if p.dspFormat.SampleRate > 0 {
+		var err error
+		chain, err = newChain(config, p.dspFormat)
+		if err != nil {
+			return fmt.Errorf("failed to create DSP chain: %w", err)
+		}
+	}
+
+	p.dspConfig = config
+	p.chain.Store(chain)
+
+	p.streamMu.Lock()
+	if p.scheduler != nil {
+		p.scheduler.SetLatency(p.schedulerLatency(chain, p.dspFormat))
+	}
+	p.streamMu.Unlock()
+
+	log.Printf("DSP updated: preamp=%gdB, %d filters, impulse response=%q",
+		config.Preamp, len(config.Filters), config.ImpulseResponse)
 	return nil
 }
 
+// SetLatencyOffset changes the output delay compensation (see
+// PlayerConfig.LatencyOffset); it applies to the current stream at once
+func (p *Player) SetLatencyOffset(offset time.Duration) {
+	p.latencyOffset.Store(int64(offset))
+
+	p.dspMu.Lock()
+	format := p.dspFormat
+	p.dspMu.Unlock()
+
+	p.streamMu.Lock()
+	if p.scheduler != nil {
+		p.scheduler.SetLatency(p.schedulerLatency(p.chain.Load(), format))
+	}
+	p.streamMu.Unlock()
+
+	log.Printf("Latency offset: %v", offset)
+	p.saveState()
+}
+
+// LatencyOffset returns the output delay compensation
+func (p *Player) LatencyOffset() time.Duration {
+	return time.Duration(p.latencyOffset.Load())
+}
+
+// DSP returns the current processing configuration
+func (p *Player) DSP() dsp.ChainConfig {
+	p.dspMu.Lock()
+	defer p.dspMu.Unlock()
+
+	return p.dspConfig
+}
+
+// remoteImpulseResponse resolves an impulse response the server named to
+// a file in PlayerConfig.ImpulseResponseDir. Servers may only name a file
+// directly in it, so they can't make the player open anything else.
+func (p *Player) remoteImpulseResponse(name string) (string, error) {
+	if name == "" {
+		return "", nil
+	}
+	if p.config.ImpulseResponseDir == "" {
+		return "", fmt.Errorf("impulse response %q: no impulse response directory is configured", name)
+	}
+	if name == "." || filepath.Clean(name) != name || !filepath.IsLocal(name) ||
+		filepath.Base(name) != name || strings.ContainsAny(name, `/\`) {
+		return "", fmt.Errorf("impulse response %q: must be a file name, not a path", name)
+	}
+	return filepath.Join(p.config.ImpulseResponseDir, name), nil
+}
+
+// dspConfigFromProtocol converts DSP settings sent by the server
+func dspConfigFromProtocol(settings protocol.DSPSettings) dsp.ChainConfig {
+	config := dsp.ChainConfig{
+		Preamp:          settings.Preamp,
+		ImpulseResponse: settings.ImpulseResponse,
+	}
+	for _, f := range settings.Filters {
+		config.Filters = append(config.Filters, dsp.FilterConfig{
+			Type:      dsp.FilterType(f.Type),
+			Frequency: f.Frequency,
+			Gain:      f.Gain,
+			Q:         f.Q,
+		})
+	}
+	return config
+}
+
 // Status returns the current player state
 func (p *Player) Status() PlayerState {
+	p.connMu.Lock()
+	defer p.connMu.Unlock()
+	return p.state
+}
+
+// setPlayState changes the playback state and returns the new state
+func (p *Player) setPlayState(state string) PlayerState {
+	p.connMu.Lock()
+	defer p.connMu.Unlock()
+	p.state.State = state
 	return p.state
 }
 
@@ -574,12 +1441,26 @@ func (p *Player) Status() PlayerState {
 func (p *Player) Stats() PlayerStats {
 	stats := PlayerStats{}
 
-	if p.scheduler != nil {
-		s := p.scheduler.Stats()
+	p.streamMu.Lock()
+	scheduler := p.scheduler
+	p.streamMu.Unlock()
+
+	if scheduler != nil {
+		s := scheduler.Stats()
 		stats.Received = s.Received
 		stats.Played = s.Played
 		stats.Dropped = s.Dropped
-		stats.BufferDepth = p.scheduler.BufferDepth()
+		stats.Reprimes = s.Reprimes
+		stats.BufferDepth = scheduler.BufferDepth()
+	}
+
+	if reporter, ok := p.output.(output.StatsReporter); ok {
+		o := reporter.Stats()
+		stats.Underruns = o.Underruns
+		stats.Overruns = o.Overruns
+		stats.OutputLatency = o.Latency
+		stats.CallbackInterval = o.CallbackInterval
+		stats.MaxCallbackInterval = o.MaxCallbackInterval
 	}
 
 	if p.clockSync != nil {
@@ -595,24 +1476,35 @@ func (p *Player) Stats() PlayerStats {
 func (p *Player) Close() error {
 	p.cancel()
 
+	p.connMu.Lock()
+	if p.listener != nil {
+		p.listener.Close()
+	}
+	p.connMu.Unlock()
+
 	if p.client != nil {
 		p.client.Close()
 	}
 
+	p.streamMu.Lock()
 	if p.scheduler != nil {
 		p.scheduler.Stop()
+		p.scheduler = nil
 	}
-
 	if p.decoder != nil {
 		p.decoder.Close()
+		p.decoder = nil
 	}
+	p.streamMu.Unlock()
 
 	if p.output != nil {
 		p.output.Close()
 	}
 
+	p.connMu.Lock()
 	p.state.Connected = false
 	p.state.State = "idle"
+	p.connMu.Unlock()
 	p.notifyStateChange()
 
 	return nil
@@ -621,7 +1513,7 @@ func (p *Player) Close() error {
 // notifyStateChange calls the OnStateChange callback if set
 func (p *Player) notifyStateChange() {
 	if p.config.OnStateChange != nil {
-		p.config.OnStateChange(p.state)
+		p.config.OnStateChange(p.Status())
 	}
 }
 
@@ -633,3 +1525,31 @@ func (p *Player) notifyError(err error) {
 		log.Printf("Player error: %v", err)
 	}
 }
+
+// supportFormats lists the formats the player accepts, hi-res first, for
+// outputs with up to the given number of channels
+func supportFormats(channels int) []protocol.AudioFormat {
+	return []protocol.AudioFormat{
+		// PCM hi-res - highest quality first
+		{Codec: "pcm", Channels: channels, SampleRate: 192000, BitDepth: 24},
+		{Codec: "pcm", Channels: channels, SampleRate: 176400, BitDepth: 24},
+		{Codec: "pcm", Channels: channels, SampleRate: 96000, BitDepth: 24},
+		{Codec: "pcm", Channels: channels, SampleRate: 88200, BitDepth: 24},
+		// PCM standard quality
+		{Codec: "pcm", Channels: channels, SampleRate: 48000, BitDepth: 16},
+		{Codec: "pcm", Channels: channels, SampleRate: 44100, BitDepth: 16},
+		// Opus fallback
+		{Codec: "opus", Channels: channels, SampleRate: 48000, BitDepth: 16},
+	}
+}
+
+// supportChannels lists the channel counts the player accepts, most first
+func supportChannels(channels int) []int {
+	counts := []int{channels}
+	for _, n := range []int{2, 1} {
+		if n < channels {
+			counts = append(counts, n)
+		}
+	}
+	return counts
+}
@@ -3,8 +3,18 @@
 package sendspin
 
 import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	gosync "sync"
 	"testing"
 	"time"
+
+	"github.com/Sendspin/sendspin-go/pkg/audio"
+	"github.com/Sendspin/sendspin-go/pkg/audio/dsp"
+	"github.com/Sendspin/sendspin-go/pkg/audio/output"
+	"github.com/Sendspin/sendspin-go/pkg/protocol"
 )
 
 func TestNewPlayer(t *testing.T) {
@@ -128,6 +138,44 @@ func TestPlayerSetVolume(t *testing.T) {
 	}
 }
 
+func TestPlayerMaxVolume(t *testing.T) {
+	if _, err := NewPlayer(PlayerConfig{PlayerName: "Speaker", MaxVolume: 101}); err == nil {
+		t.Error("expected error for a max volume above 100")
+	}
+
+	player, err := NewPlayer(PlayerConfig{PlayerName: "Speaker", Volume: 90, MaxVolume: 80})
+	if err != nil {
+		t.Fatalf("Failed to create player: %v", err)
+	}
+	defer player.Close()
+
+	if got := player.Status().Volume; got != 80 {
+		t.Errorf("Expected initial volume capped at 80, got %d", got)
+	}
+
+	player.SetVolume(100)
+	if got := player.Status().Volume; got != 80 {
+		t.Errorf("Expected volume capped at 80, got %d", got)
+	}
+
+	// Lowering the limit lowers the volume; raising it leaves it alone
+	if err := player.SetMaxVolume(50); err != nil {
+		t.Fatalf("SetMaxVolume failed: %v", err)
+	}
+	if got := player.Status().Volume; got != 50 {
+		t.Errorf("Expected volume lowered to 50, got %d", got)
+	}
+	if err := player.SetMaxVolume(100); err != nil {
+		t.Fatalf("SetMaxVolume failed: %v", err)
+	}
+	if got := player.Status().Volume; got != 50 {
+		t.Errorf("Expected volume to stay at 50, got %d", got)
+	}
+	if err := player.SetMaxVolume(0); err == nil {
+		t.Error("expected error for a max volume of 0")
+	}
+}
+
 func TestPlayerMute(t *testing.T) {
 	config := PlayerConfig{
 		ServerAddr: "localhost:8927",
@@ -322,3 +370,521 @@ func BenchmarkSetVolume(b *testing.B) {
 		player.SetVolume(i % 100)
 	}
 }
+
+func TestProgressAt(t *testing.T) {
+	p := Progress{
+		Position:  10 * time.Second,
+		Duration:  60 * time.Second,
+		Speed:     1.0,
+		Timestamp: 1_000_000,
+	}
+
+	if got := p.At(3_000_000); got != 12*time.Second {
+		t.Errorf("expected 12s after 2s elapsed, got %v", got)
+	}
+	if got := p.At(500_000_000); got != 60*time.Second {
+		t.Errorf("expected position clamped to duration, got %v", got)
+	}
+	if got := p.At(0); got != 9*time.Second {
+		t.Errorf("expected 9s before anchor, got %v", got)
+	}
+}
+
+// fakeOutput records writes and flushes instead of playing audio
+type fakeOutput struct {
+	mu      gosync.Mutex
+	writes  int
+	flushes int
+}
+
+func (o *fakeOutput) Open(sampleRate, channels, bitDepth int) error { return nil }
+func (o *fakeOutput) Close() error                                  { return nil }
+
+func (o *fakeOutput) Write(samples []int32) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.writes++
+	return nil
+}
+
+func (o *fakeOutput) Flush() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.flushes++
+	return nil
+}
+
+var testStreamStart = protocol.StreamStart{
+	Player: &protocol.StreamStartPlayer{Codec: "pcm", SampleRate: 48000, Channels: 2, BitDepth: 24},
+}
+
+func TestPlayerStreamRestartDoesNotLeak(t *testing.T) {
+	player, err := NewPlayer(PlayerConfig{ServerAddr: "localhost:8927", PlayerName: "Leak Test"})
+	if err != nil {
+		t.Fatalf("Failed to create player: %v", err)
+	}
+	defer player.Close()
+	player.output = &fakeOutput{}
+
+	// One stream: scheduler Run + handleScheduledAudio
+	player.handleStreamStart(testStreamStart)
+	baseline := runtime.NumGoroutine()
+
+	for i := 0; i < 20; i++ {
+		player.handleStreamStart(testStreamStart)
+		player.handleStreamClear()
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > baseline && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := runtime.NumGoroutine(); n > baseline {
+		t.Errorf("goroutines grew from %d to %d across stream restarts", baseline, n)
+	}
+}
+
+func TestPlayerDropsStaleChunks(t *testing.T) {
+	player, err := NewPlayer(PlayerConfig{ServerAddr: "localhost:8927", PlayerName: "Stale Test"})
+	if err != nil {
+		t.Fatalf("Failed to create player: %v", err)
+	}
+	defer player.Close()
+	out := &fakeOutput{}
+	player.output = out
+	player.client = protocol.NewClient(protocol.Config{})
+	go player.handleAudioChunks(player.client)
+
+	player.handleStreamStart(testStreamStart) // generation 1
+	player.handleStreamClear()                // generation 2
+
+	data := make([]byte, 960*2*3)
+	player.client.AudioChunks <- protocol.AudioChunk{Timestamp: 1, Data: data, Generation: 1}
+	player.client.AudioChunks <- protocol.AudioChunk{Timestamp: 2, Data: data, Generation: 2}
+
+	deadline := time.Now().Add(time.Second)
+	for player.Stats().Received < 1 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	if got := player.Stats().Received; got != 1 {
+		t.Errorf("expected only the current-generation chunk to be scheduled, got %d", got)
+	}
+
+	out.mu.Lock()
+	flushes := out.flushes
+	out.mu.Unlock()
+	if flushes < 2 {
+		t.Errorf("expected output flushed on stream/start and stream/clear, got %d flushes", flushes)
+	}
+}
+
+func TestPlayerStreamEndGoesIdle(t *testing.T) {
+	states := make(chan string, 10)
+	player, err := NewPlayer(PlayerConfig{
+		ServerAddr: "localhost:8927",
+		PlayerName: "End Test",
+		OnStateChange: func(s PlayerState) {
+			states <- s.State
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create player: %v", err)
+	}
+	defer player.Close()
+	player.output = &fakeOutput{}
+
+	player.handleStreamStart(testStreamStart)
+	if s := <-states; s != "playing" {
+		t.Fatalf("expected playing after stream/start, got %s", s)
+	}
+
+	player.handleStreamEnd()
+
+	select {
+	case s := <-states:
+		if s != "idle" {
+			t.Errorf("expected idle after stream/end, got %s", s)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("player did not go idle after stream/end")
+	}
+}
+
+// waitUntil polls cond until it holds or a second has passed
+func waitUntil(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestPlayerPauseResume(t *testing.T) {
+	capture := output.NewCapture()
+	player, err := NewPlayer(PlayerConfig{
+		ServerAddr: "localhost:8927",
+		PlayerName: "Pause Test",
+		Output:     capture,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create player: %v", err)
+	}
+	defer player.Close()
+
+	// No server: Pause and Play change local playback, sending state just fails
+	player.state.Connected = true
+	player.client = protocol.NewClient(protocol.Config{})
+
+	player.handleStreamStart(testStreamStart)
+	player.streamMu.Lock()
+	sched := player.scheduler
+	player.streamMu.Unlock()
+
+	// 10ms stereo buffers; buffer i holds the value 100*(i+1) so its
+	// place on the timeline can be read back from the capture
+	const frames = 480
+	base := serverNowPlus(100 * time.Millisecond)
+	for i := 0; i < 150; i++ {
+		samples := make([]int32, frames*2)
+		for j := range samples {
+			samples[j] = int32(100 * (i + 1))
+		}
+		sched.Schedule(audio.Buffer{Timestamp: base + int64(i)*10_000, Samples: samples})
+	}
+
+	waitUntil(t, "playback", func() bool { return capture.Writes() >= 10 })
+
+	player.Pause()
+	if state := player.Status().State; state != "paused" {
+		t.Errorf("expected paused state, got %s", state)
+	}
+	pausedAt := len(capture.Samples())
+	time.Sleep(300 * time.Millisecond)
+
+	// Fade-out runs for FadeDuration and ends in silence
+	paused := capture.Samples()
+	if faded := (len(paused) - pausedAt) / 2; faded < fadeFrames(48000) {
+		t.Errorf("expected at least %d fade-out frames, got %d", fadeFrames(48000), faded)
+	}
+	if last := paused[len(paused)-1]; last != 0 {
+		t.Errorf("expected fade-out to end in silence, got %d", last)
+	}
+
+	writes := capture.Writes()
+	time.Sleep(100 * time.Millisecond)
+	if got := capture.Writes(); got != writes {
+		t.Errorf("expected no writes while paused, got %d", got-writes)
+	}
+
+	flushes := capture.Flushes()
+	player.Play()
+	waitUntil(t, "resumed playback", func() bool { return capture.Writes() >= writes+6 })
+
+	resumed := capture.Samples()[len(paused):]
+	if resumed[0] != 0 {
+		t.Errorf("expected fade-in to start from silence, got %d", resumed[0])
+	}
+	if capture.Flushes() <= flushes {
+		t.Error("expected output flushed on resume")
+	}
+
+	// Playback re-joins the timeline where the group is now, rather than
+	// replaying the buffers that were due while paused
+	pausedIndex := paused[pausedAt-1]/100 - 1
+	resumedIndex := resumed[len(resumed)-1]/100 - 1
+	if resumedIndex-pausedIndex < 30 {
+		t.Errorf("expected to resume ~40 buffers after pausing at %d, resumed at %d", pausedIndex, resumedIndex)
+	}
+}
+
+func TestPlayerDSP(t *testing.T) {
+	capture := output.NewCapture()
+	player, err := NewPlayer(PlayerConfig{
+		ServerAddr: "localhost:8927",
+		PlayerName: "DSP Test",
+		Output:     capture,
+		DSP:        dsp.ChainConfig{Preamp: -6.0206}, // Half amplitude
+	})
+	if err != nil {
+		t.Fatalf("Failed to create player: %v", err)
+	}
+	defer player.Close()
+	player.client = protocol.NewClient(protocol.Config{})
+	go player.handleControls(player.client)
+
+	player.handleStreamStart(testStreamStart)
+	player.streamMu.Lock()
+	sched := player.scheduler
+	player.streamMu.Unlock()
+	sched.mu.Lock()
+	sched.bufferTarget = 1
+	sched.mu.Unlock()
+
+	schedule := func(count int) {
+		base := serverNowPlus(50 * time.Millisecond)
+		for i := 0; i < count; i++ {
+			samples := make([]int32, 480*2)
+			for j := range samples {
+				samples[j] = 1000000
+			}
+			sched.Schedule(audio.Buffer{Timestamp: base + int64(i)*10_000, Samples: samples})
+		}
+	}
+
+	schedule(5)
+	waitUntil(t, "processed playback", func() bool { return capture.Writes() >= 5 })
+	for i, v := range capture.Samples() {
+		if v < 499999 || v > 500001 {
+			t.Fatalf("sample %d: expected preamp to halve 1000000, got %d", i, v)
+		}
+	}
+
+	// The server replaces the chain; empty settings disable processing
+	player.client.ControlMsgs <- protocol.ServerCommand{Command: "dsp", DSP: &protocol.DSPSettings{}}
+	waitUntil(t, "DSP update", func() bool { return player.DSP().Empty() })
+
+	written := len(capture.Samples())
+	schedule(5)
+	waitUntil(t, "unprocessed playback", func() bool { return capture.Writes() >= 10 })
+	for i, v := range capture.Samples()[written:] {
+		if v != 1000000 {
+			t.Fatalf("sample %d: expected unprocessed audio, got %d", i, v)
+		}
+	}
+
+	if err := player.SetDSP(dsp.ChainConfig{Filters: []dsp.FilterConfig{{Type: "notch", Frequency: 50}}}); err == nil {
+		t.Error("expected SetDSP to reject an invalid filter")
+	}
+	if !player.DSP().Empty() {
+		t.Error("expected rejected config to leave the previous one in place")
+	}
+}
+
+// writeIdentityIR writes a one-tap 16-bit mono WAV impulse response
+func writeIdentityIR(t *testing.T) string {
+	t.Helper()
+
+	wav := []byte("RIFF\x26\x00\x00\x00WAVEfmt \x10\x00\x00\x00" +
+		"\x01\x00\x01\x00\x80\xbb\x00\x00\x00\x77\x01\x00\x02\x00\x10\x00" +
+		"data\x02\x00\x00\x00\xff\x7f")
+	path := filepath.Join(t.TempDir(), "identity.wav")
+	if err := os.WriteFile(path, wav, 0o644); err != nil {
+		t.Fatalf("failed to write impulse response: %v", err)
+	}
+	return path
+}
+
+func TestPlayerRemoteImpulseResponse(t *testing.T) {
+	irDir := filepath.Dir(writeIdentityIR(t))
+	errs := make(chan error, 10)
+	player, err := NewPlayer(PlayerConfig{
+		ServerAddr:         "localhost:8927",
+		PlayerName:         "IR Test",
+		Output:             output.NewCapture(),
+		ImpulseResponseDir: irDir,
+		OnError:            func(err error) { errs <- err },
+	})
+	if err != nil {
+		t.Fatalf("Failed to create player: %v", err)
+	}
+	defer player.Close()
+
+	// Servers name a file in the directory, nothing else
+	for _, name := range []string{"/etc/passwd", "../identity.wav", "sub/identity.wav", "..", ".", "./", "identity.wav/", `..\identity.wav`} {
+		if _, err := player.remoteImpulseResponse(name); err == nil {
+			t.Errorf("expected %q to be refused", name)
+		}
+	}
+	path, err := player.remoteImpulseResponse("identity.wav")
+	if err != nil || path != filepath.Join(irDir, "identity.wav") {
+		t.Errorf("expected identity.wav in %s, got %q, %v", irDir, path, err)
+	}
+
+	player.client = protocol.NewClient(protocol.Config{})
+	go player.handleControls(player.client)
+
+	// A refused path leaves the chain alone and is reported
+	player.client.ControlMsgs <- protocol.ServerCommand{Command: "dsp", DSP: &protocol.DSPSettings{Preamp: -3, ImpulseResponse: "/dev/zero"}}
+	select {
+	case <-errs:
+	case <-time.After(3 * time.Second):
+		t.Fatal("expected the refused impulse response to be reported")
+	}
+	if !player.DSP().Empty() {
+		t.Errorf("expected the DSP to stay empty, got %+v", player.DSP())
+	}
+
+	player.client.ControlMsgs <- protocol.ServerCommand{Command: "dsp", DSP: &protocol.DSPSettings{ImpulseResponse: "identity.wav"}}
+	waitUntil(t, "DSP update", func() bool { return player.DSP().ImpulseResponse == path })
+
+	// Without a directory, servers can't load impulse responses at all
+	player.config.ImpulseResponseDir = ""
+	if _, err := player.remoteImpulseResponse("identity.wav"); err == nil {
+		t.Error("expected impulse responses to be refused without a directory")
+	}
+}
+
+func TestPlayerDSPLatencyCompensation(t *testing.T) {
+	errs := make(chan error, 1)
+	player, err := NewPlayer(PlayerConfig{
+		ServerAddr: "localhost:8927",
+		PlayerName: "Latency Test",
+		DSP:        dsp.ChainConfig{ImpulseResponse: filepath.Join(t.TempDir(), "missing.wav")},
+		OnError:    func(err error) { errs <- err },
+	})
+	if err != nil {
+		t.Fatalf("Failed to create player: %v", err)
+	}
+	defer player.Close()
+	player.output = &fakeOutput{}
+
+	// A missing impulse response doesn't stop the stream
+	player.handleStreamStart(testStreamStart)
+	select {
+	case <-errs:
+	default:
+		t.Error("expected error reported for missing impulse response")
+	}
+	if player.chain.Load() != nil {
+		t.Error("expected playback without a chain")
+	}
+
+	schedulerLatency := func() time.Duration {
+		player.streamMu.Lock()
+		defer player.streamMu.Unlock()
+		player.scheduler.mu.Lock()
+		defer player.scheduler.mu.Unlock()
+		return player.scheduler.latency
+	}
+
+	// During a stream the chain is built immediately and its latency compensated
+	if err := player.SetDSP(dsp.ChainConfig{ImpulseResponse: writeIdentityIR(t)}); err != nil {
+		t.Fatalf("SetDSP failed: %v", err)
+	}
+	want := time.Duration(dsp.ConvolverBlockSize) * time.Second / 48000
+	if got := schedulerLatency(); got != want {
+		t.Errorf("expected scheduler latency %v, got %v", want, got)
+	}
+
+	// The latency carries over to the next stream
+	player.handleStreamStart(testStreamStart)
+	if got := schedulerLatency(); got != want {
+		t.Errorf("expected scheduler latency %v after restart, got %v", want, got)
+	}
+
+	if err := player.SetDSP(dsp.ChainConfig{Filters: []dsp.FilterConfig{{Type: dsp.HighPass, Frequency: 20}}}); err != nil {
+		t.Fatalf("SetDSP failed: %v", err)
+	}
+	if got := schedulerLatency(); got != 0 {
+		t.Errorf("expected no latency for filters only, got %v", got)
+	}
+}
+
+// starvingOutput is a capture output that reports a starved device
+type starvingOutput struct {
+	*output.Capture
+	starved time.Duration
+}
+
+func (o *starvingOutput) Stats() output.Stats {
+	return output.Stats{Starved: o.starved, Underruns: 1, Latency: 40 * time.Millisecond}
+}
+
+func TestPlayerReprimesStarvedOutput(t *testing.T) {
+	out := &starvingOutput{Capture: output.NewCapture(), starved: 100 * time.Millisecond}
+	player, err := NewPlayer(PlayerConfig{ServerAddr: "localhost:8927", PlayerName: "Starve Test", Output: out})
+	if err != nil {
+		t.Fatalf("Failed to create player: %v", err)
+	}
+	defer player.Close()
+
+	sched := newTestScheduler()
+	defer sched.Stop()
+	sched.Schedule(audio.Buffer{Timestamp: serverNowPlus(0)})
+	sched.processQueue()
+
+	// A short gap is left alone
+	player.checkStarvation(sched)
+	if sched.Stats().Reprimes != 0 {
+		t.Fatal("expected no re-prime for a brief starvation")
+	}
+
+	out.starved = reprimeAfter
+	flushes := out.Flushes()
+	player.checkStarvation(sched)
+	if sched.Stats().Reprimes != 1 {
+		t.Fatal("expected re-prime after sustained starvation")
+	}
+	if out.Flushes() != flushes+1 {
+		t.Error("expected output flushed on re-prime")
+	}
+
+	// Already re-priming: no repeat while the buffer refills
+	player.checkStarvation(sched)
+	if sched.Stats().Reprimes != 1 {
+		t.Errorf("expected a single re-prime, got %d", sched.Stats().Reprimes)
+	}
+
+	player.streamMu.Lock()
+	player.scheduler = sched
+	player.streamMu.Unlock()
+	stats := player.Stats()
+	if stats.Reprimes != 1 || stats.Underruns != 1 || stats.OutputLatency != 40*time.Millisecond {
+		t.Errorf("expected output stats in PlayerStats, got %+v", stats)
+	}
+}
+
+// slowOutput accepts at most perWrite samples per Write, like a full
+// non-blocking device buffer that drains between retries
+type slowOutput struct {
+	*output.Capture
+	perWrite int
+}
+
+func (o *slowOutput) Write(samples []int32) error {
+	n := min(len(samples), o.perWrite)
+	if err := o.Capture.Write(samples[:n]); err != nil {
+		return err
+	}
+	if n < len(samples) {
+		return &output.BufferFullError{Written: n, Total: len(samples)}
+	}
+	return nil
+}
+
+func TestPlayerWriteOutputBackpressure(t *testing.T) {
+	out := &slowOutput{Capture: output.NewCapture(), perWrite: 480}
+	out.Open(48000, 2, 24)
+	player := &Player{output: out}
+	format := audio.Format{SampleRate: 48000, Channels: 2}
+
+	// 10ms of audio is retried until it is all written
+	samples := make([]int32, 960)
+	for i := range samples {
+		samples[i] = int32(i)
+	}
+	if err := player.writeOutput(samples, format); err != nil {
+		t.Fatalf("expected backpressure to be waited out, got %v", err)
+	}
+	got := out.Samples()
+	if len(got) != len(samples) || got[len(got)-1] != 959 {
+		t.Fatalf("expected all %d samples written in order, got %d", len(samples), len(got))
+	}
+
+	// An output that never drains gives up after the audio's duration
+	out.perWrite = 0
+	start := time.Now()
+	err := player.writeOutput(samples, format)
+	if !errors.Is(err, output.ErrBufferFull) {
+		t.Errorf("expected ErrBufferFull, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 200*time.Millisecond {
+		t.Errorf("expected to give up after ~10ms, took %v", elapsed)
+	}
+}
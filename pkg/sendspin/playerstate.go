@@ -0,0 +1,113 @@
+// ABOUTME: Player-side state persisted across restarts
+// ABOUTME: Keeps the client ID, name, volume, latency offset and last server in a JSON file
+package sendspin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// savedServer identifies a server the player connected to
+type savedServer struct {
+	ID   string `json:"id,omitempty"`
+	Name string `json:"name,omitempty"`
+	Addr string `json:"addr"`
+}
+
+// playerStateFile is the on-disk layout of PlayerConfig.StateFile
+type playerStateFile struct {
+	ClientID        string       `json:"client_id,omitempty"`
+	Name            string       `json:"name,omitempty"`
+	Volume          *int         `json:"volume,omitempty"`
+	Muted           bool         `json:"muted,omitempty"`
+	LatencyOffsetMs float64      `json:"latency_offset_ms,omitempty"`
+	LastServer      *savedServer `json:"last_server,omitempty"`
+}
+
+// DefaultStateFile is the player state file in the user's config
+// directory ($XDG_CONFIG_HOME/sendspin/player.json on Linux), or empty if
+// there is none
+func DefaultStateFile() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "sendspin", "player.json")
+}
+
+// defaultPlayerName names a player after its host
+func defaultPlayerName() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	return hostname + "-sendspin-player"
+}
+
+// loadPlayerState reads player state from path; a missing file is an
+// empty state
+func loadPlayerState(path string) (playerStateFile, error) {
+	var st playerStateFile
+	if path == "" {
+		return st, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return st, nil
+	}
+	if err != nil {
+		return st, fmt.Errorf("failed to read player state: %w", err)
+	}
+	if err := json.Unmarshal(data, &st); err != nil {
+		return st, fmt.Errorf("failed to parse player state %s: %w", path, err)
+	}
+	return st, nil
+}
+
+// save writes player state to path (a no-op without a path)
+func (st playerStateFile) save(path string) error {
+	if path == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode player state: %w", err)
+	}
+	if err := writeFileAtomic(path, data); err != nil {
+		return fmt.Errorf("failed to write player state: %w", err)
+	}
+	return nil
+}
+
+// saveState writes the player's settings to its state file, if any
+func (p *Player) saveState() {
+	if p.config.StateFile == "" {
+		return
+	}
+
+	p.saveMu.Lock()
+	defer p.saveMu.Unlock()
+
+	p.connMu.Lock()
+	volume := p.state.Volume
+	st := playerStateFile{
+		ClientID:        p.clientID,
+		Name:            p.config.PlayerName,
+		Volume:          &volume,
+		Muted:           p.state.Muted,
+		LatencyOffsetMs: float64(p.latencyOffset.Load()) / float64(time.Millisecond),
+		LastServer:      p.lastServer,
+	}
+	p.connMu.Unlock()
+
+	if err := st.save(p.config.StateFile); err != nil {
+		log.Printf("Failed to save player state: %v", err)
+	}
+}
@@ -0,0 +1,84 @@
+// ABOUTME: Tests for the player state file
+// ABOUTME: Covers loading, saving, and settings that survive a player restart
+package sendspin
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Sendspin/sendspin-go/pkg/audio/output"
+)
+
+func TestPlayerStateFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sendspin", "player.json")
+
+	st, err := loadPlayerState(path)
+	if err != nil || st.LastServer != nil {
+		t.Fatalf("Expected empty state for a missing file, got %+v, %v", st, err)
+	}
+
+	st.LastServer = &savedServer{ID: "id-den", Name: "Den", Addr: "10.0.0.6:8927"}
+	if err := st.save(path); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+
+	loaded, err := loadPlayerState(path)
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if loaded.LastServer == nil || *loaded.LastServer != *st.LastServer {
+		t.Errorf("Expected %+v, got %+v", st.LastServer, loaded.LastServer)
+	}
+}
+
+func TestPlayerPersistsSettings(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "player.json")
+
+	first, err := NewPlayer(PlayerConfig{PlayerName: "Den", StateFile: stateFile, Output: output.NewCapture()})
+	if err != nil {
+		t.Fatalf("failed to create player: %v", err)
+	}
+	first.SetVolume(40)
+	first.Mute(true)
+	first.SetLatencyOffset(120 * time.Millisecond)
+	first.Close()
+
+	// A restarted player keeps its identity and settings
+	second, err := NewPlayer(PlayerConfig{StateFile: stateFile, Output: output.NewCapture()})
+	if err != nil {
+		t.Fatalf("failed to create player: %v", err)
+	}
+	defer second.Close()
+	if second.ClientID() != first.ClientID() {
+		t.Errorf("expected client ID %s kept, got %s", first.ClientID(), second.ClientID())
+	}
+	if second.Name() != "Den" {
+		t.Errorf("expected saved name, got %q", second.Name())
+	}
+	if st := second.Status(); st.Volume != 40 || !st.Muted {
+		t.Errorf("expected volume 40 muted, got %d muted=%v", st.Volume, st.Muted)
+	}
+	if second.LatencyOffset() != 120*time.Millisecond {
+		t.Errorf("expected 120ms latency offset, got %v", second.LatencyOffset())
+	}
+
+	// Configuration overrides saved settings
+	third, err := NewPlayer(PlayerConfig{ClientID: "fixed", PlayerName: "Office", Volume: 70, StateFile: stateFile, Output: output.NewCapture()})
+	if err != nil {
+		t.Fatalf("failed to create player: %v", err)
+	}
+	defer third.Close()
+	if third.ClientID() != "fixed" || third.Name() != "Office" || third.Status().Volume != 70 {
+		t.Errorf("expected configured ID, name and volume, got %s %q %d", third.ClientID(), third.Name(), third.Status().Volume)
+	}
+
+	// Without a state file every player is new
+	a, _ := NewPlayer(PlayerConfig{Output: output.NewCapture()})
+	b, _ := NewPlayer(PlayerConfig{Output: output.NewCapture()})
+	defer a.Close()
+	defer b.Close()
+	if a.ClientID() == b.ClientID() || a.Name() == "" {
+		t.Errorf("expected distinct IDs and a default name, got %s, %s, %q", a.ClientID(), b.ClientID(), a.Name())
+	}
+}
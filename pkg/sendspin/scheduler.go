@@ -6,6 +6,7 @@ import (
 	"container/heap"
 	"context"
 	"log"
+	gosync "sync"
 	"time"
 
 	"github.com/Sendspin/sendspin-go/pkg/audio"
@@ -21,8 +22,14 @@ type Scheduler struct {
 	ctx          context.Context
 	cancel       context.CancelFunc
 	buffering    bool
-	bufferTarget int // Number of chunks to buffer before starting playback
-
+	bufferTarget int           // Number of chunks to buffer before starting playback
+	ending       bool          // End called: play out the queue, then finish
+	ended        bool          // The ended stream has played out and drained is closed
+	drained      chan struct{} // Closed once an ended stream has played out
+	latency      time.Duration // Processing delay after the scheduler; buffers are released this much early
+
+	// mu guards bufferQ, buffering, ending, ended, latency and stats
+	mu    gosync.Mutex
 	stats SchedulerStats
 }
 
@@ -31,6 +38,7 @@ type SchedulerStats struct {
 	Received int64
 	Played   int64
 	Dropped  int64
+	Reprimes int64 // Returns to startup buffering after the output ran dry
 }
 
 // NewScheduler creates a playback scheduler
@@ -49,6 +57,7 @@ func NewScheduler(clockSync *sync.ClockSync, jitterMs int) *Scheduler {
 		cancel:       cancel,
 		buffering:    true,
 		bufferTarget: bufferTarget,
+		drained:      make(chan struct{}),
 	}
 }
 
@@ -57,6 +66,14 @@ func (s *Scheduler) Schedule(buf audio.Buffer) {
 	// Convert server timestamp to local play time
 	buf.PlayAt = s.clockSync.ServerToLocalTime(buf.Timestamp)
 
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.ending {
+		// Stream has ended; audio before the next stream/start is stale
+		return
+	}
+
 	// Sanity logs for first 5 chunks showing timing
 	if s.stats.Received < 5 {
 		serverNow := sync.ServerMicrosNow()
@@ -88,8 +105,25 @@ func (s *Scheduler) Run() {
 
 // processQueue checks for buffers ready to play
 func (s *Scheduler) processQueue() {
-	// Check if we're still buffering at startup
-	if s.buffering {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Run may still pick a ready tick after the scheduler finished
+	if s.ended || s.ctx.Err() != nil {
+		return
+	}
+
+	if s.ending && s.bufferQ.Len() == 0 {
+		// Everything queued before stream/end has been handed to the output
+		log.Printf("Stream ended, buffered audio played out")
+		s.ended = true
+		close(s.drained)
+		s.cancel()
+		return
+	}
+
+	// Check if we're still buffering at startup (an ended stream plays whatever it has)
+	if s.buffering && !s.ending {
 		if s.bufferQ.Len() >= s.bufferTarget {
 			log.Printf("Startup buffering complete: %d chunks ready", s.bufferQ.Len())
 			s.buffering = false
@@ -104,7 +138,7 @@ func (s *Scheduler) processQueue() {
 	for s.bufferQ.Len() > 0 {
 		buf := s.bufferQ.Peek()
 
-		delay := buf.PlayAt.Sub(now)
+		delay := buf.PlayAt.Sub(now) - s.latency
 
 		if delay > 50*time.Millisecond {
 			// Too early, wait
@@ -115,19 +149,84 @@ func (s *Scheduler) processQueue() {
 			s.stats.Dropped++
 			log.Printf("Dropped late buffer: %v late", -delay)
 		} else {
-			// Ready to play (within ±50ms window)
-			heap.Pop(s.bufferQ)
-
+			// Ready to play (within ±50ms window). Don't block while
+			// holding the lock; if the output is backed up, retry next tick.
 			select {
 			case s.output <- buf:
+				heap.Pop(s.bufferQ)
 				s.stats.Played++
-			case <-s.ctx.Done():
+			default:
 				return
 			}
 		}
 	}
 }
 
+// SetLatency sets the delay added between the scheduler and the output
+// (e.g. by a DSP chain). Buffers are released that much ahead of their
+// play time so they still reach the output on time.
+func (s *Scheduler) SetLatency(latency time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.latency = latency
+}
+
+// Clear drops all queued audio, including buffers already handed to the
+// output channel but not yet consumed. Playback resumes once the startup
+// buffer refills with new chunks.
+func (s *Scheduler) Clear() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dropped := s.bufferQ.Len()
+	s.bufferQ.Clear()
+	for {
+		select {
+		case <-s.output:
+			dropped++
+			continue
+		default:
+		}
+		break
+	}
+
+	s.buffering = true
+	log.Printf("Scheduler cleared: %d buffers dropped", dropped)
+}
+
+// Reprime returns the scheduler to startup buffering after the output ran
+// dry. Playback restarts once the startup buffer refills, dropping chunks
+// that are already late, so audio re-aligns with the timeline. Returns
+// false if the scheduler is already buffering or the stream is ending.
+func (s *Scheduler) Reprime() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.buffering || s.ending {
+		return false
+	}
+
+	s.buffering = true
+	s.stats.Reprimes++
+	log.Printf("Scheduler re-priming: %d buffers queued", s.bufferQ.Len())
+	return true
+}
+
+// End marks the stream as finished. Queued audio keeps playing; once the
+// queue is empty the scheduler stops and Done is closed. Buffers scheduled
+// after End are ignored.
+func (s *Scheduler) End() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ending = true
+}
+
+// Done is closed when an ended stream has played out all queued audio
+func (s *Scheduler) Done() <-chan struct{} {
+	return s.drained
+}
+
 // Output returns the output channel
 func (s *Scheduler) Output() <-chan audio.Buffer {
 	return s.output
@@ -135,11 +234,15 @@ func (s *Scheduler) Output() <-chan audio.Buffer {
 
 // Stats returns scheduler statistics
 func (s *Scheduler) Stats() SchedulerStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	return s.stats
 }
 
 // BufferDepth returns the current buffer queue depth in milliseconds
 func (s *Scheduler) BufferDepth() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	// Each buffer is typically 10ms (480 samples at 48kHz)
 	return s.bufferQ.Len() * 10
 }
@@ -193,6 +296,11 @@ func (q *BufferQueue) Pop() interface{} {
 	return item
 }
 
+// Clear removes all buffers from the queue
+func (q *BufferQueue) Clear() {
+	q.items = q.items[:0]
+}
+
 func (q *BufferQueue) Peek() audio.Buffer {
 	if len(q.items) == 0 {
 		return audio.Buffer{}
@@ -0,0 +1,197 @@
+// ABOUTME: Tests for the playback scheduler
+// ABOUTME: Verifies ordering, clearing and end-of-stream handling
+package sendspin
+
+import (
+	"container/heap"
+	"testing"
+	"time"
+
+	"github.com/Sendspin/sendspin-go/pkg/audio"
+	"github.com/Sendspin/sendspin-go/pkg/sync"
+)
+
+// newTestScheduler returns a scheduler whose clock maps server time 1:1 to local
+// time and that starts playback without waiting for a startup buffer
+func newTestScheduler() *Scheduler {
+	s := NewScheduler(sync.NewClockSync(), 500)
+	s.bufferTarget = 1
+	return s
+}
+
+// serverNowPlus returns a server timestamp offset from now
+func serverNowPlus(d time.Duration) int64 {
+	return sync.ServerMicrosNow() + d.Microseconds()
+}
+
+func TestBufferQueueOrdering(t *testing.T) {
+	q := NewBufferQueue()
+	base := time.Now()
+
+	for _, offset := range []int{30, 10, 20} {
+		heap.Push(q, audio.Buffer{PlayAt: base.Add(time.Duration(offset) * time.Millisecond)})
+	}
+
+	for _, want := range []int{10, 20, 30} {
+		buf := heap.Pop(q).(audio.Buffer)
+		if got := buf.PlayAt.Sub(base); got != time.Duration(want)*time.Millisecond {
+			t.Errorf("expected buffer at +%dms, got %v", want, got)
+		}
+	}
+}
+
+func TestBufferQueueClear(t *testing.T) {
+	q := NewBufferQueue()
+	heap.Push(q, audio.Buffer{PlayAt: time.Now()})
+	heap.Push(q, audio.Buffer{PlayAt: time.Now()})
+
+	q.Clear()
+
+	if q.Len() != 0 {
+		t.Errorf("expected empty queue after Clear, got %d", q.Len())
+	}
+
+	heap.Push(q, audio.Buffer{Timestamp: 42})
+	if q.Peek().Timestamp != 42 {
+		t.Error("expected queue to be usable after Clear")
+	}
+}
+
+func TestSchedulerClear(t *testing.T) {
+	s := newTestScheduler()
+	defer s.Stop()
+
+	// Fill the output channel and the queue
+	for i := 0; i < 5; i++ {
+		s.Schedule(audio.Buffer{Timestamp: serverNowPlus(0)})
+	}
+	s.processQueue()
+	for i := 0; i < 5; i++ {
+		s.Schedule(audio.Buffer{Timestamp: serverNowPlus(time.Second)})
+	}
+
+	if len(s.Output()) == 0 || s.BufferDepth() == 0 {
+		t.Fatalf("expected audio in output (%d) and queue (%dms)", len(s.Output()), s.BufferDepth())
+	}
+
+	s.Clear()
+
+	if len(s.Output()) != 0 {
+		t.Errorf("expected output channel drained, got %d buffers", len(s.Output()))
+	}
+	if s.BufferDepth() != 0 {
+		t.Errorf("expected empty queue, got %dms", s.BufferDepth())
+	}
+	if !s.buffering {
+		t.Error("expected scheduler to re-enter startup buffering after Clear")
+	}
+}
+
+func TestSchedulerEndPlaysOut(t *testing.T) {
+	s := newTestScheduler()
+	go s.Run()
+	defer s.Stop()
+
+	s.Schedule(audio.Buffer{Timestamp: serverNowPlus(20 * time.Millisecond)})
+	s.Schedule(audio.Buffer{Timestamp: serverNowPlus(40 * time.Millisecond)})
+	s.End()
+
+	// Buffers after End are ignored
+	s.Schedule(audio.Buffer{Timestamp: serverNowPlus(60 * time.Millisecond)})
+
+	played := 0
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case <-s.Output():
+			played++
+		case <-s.Done():
+			// Pick up anything handed over just before Done closed
+			played += len(s.Output())
+			if played != 2 {
+				t.Errorf("expected 2 buffers played before end, got %d", played)
+			}
+			return
+		case <-timeout:
+			t.Fatal("scheduler did not finish after End")
+		}
+	}
+}
+
+func TestSchedulerEndWhenEmpty(t *testing.T) {
+	s := newTestScheduler()
+	go s.Run()
+	defer s.Stop()
+
+	s.End()
+
+	select {
+	case <-s.Done():
+	case <-time.After(time.Second):
+		t.Fatal("expected Done to close for an empty ended stream")
+	}
+}
+
+func TestSchedulerEndFinishesOnce(t *testing.T) {
+	s := newTestScheduler()
+	s.End()
+
+	// Ticks that race the finish must not close Done again
+	for range 3 {
+		s.processQueue()
+	}
+	select {
+	case <-s.Done():
+	default:
+		t.Fatal("expected Done to close for an empty ended stream")
+	}
+}
+
+func TestSchedulerReprime(t *testing.T) {
+	s := newTestScheduler()
+	defer s.Stop()
+
+	if s.Reprime() {
+		t.Error("expected no re-prime while still in startup buffering")
+	}
+
+	s.Schedule(audio.Buffer{Timestamp: serverNowPlus(0)})
+	s.processQueue()
+	if s.buffering {
+		t.Fatal("expected startup buffering to complete")
+	}
+
+	if !s.Reprime() {
+		t.Fatal("expected re-prime after playback started")
+	}
+	if !s.buffering {
+		t.Error("expected scheduler back in startup buffering")
+	}
+	if got := s.Stats().Reprimes; got != 1 {
+		t.Errorf("expected 1 re-prime, got %d", got)
+	}
+
+	s.processQueue() // Nothing queued: stays buffering
+	s.End()
+	if s.Reprime() {
+		t.Error("expected no re-prime once the stream is ending")
+	}
+}
+
+func TestSchedulerLatencyReleasesEarly(t *testing.T) {
+	s := newTestScheduler()
+	defer s.Stop()
+
+	// Due in 200ms: too early without latency compensation
+	s.Schedule(audio.Buffer{Timestamp: serverNowPlus(200 * time.Millisecond)})
+	s.processQueue()
+	if len(s.Output()) != 0 {
+		t.Fatal("expected buffer to be held until close to its play time")
+	}
+
+	s.SetLatency(180 * time.Millisecond)
+	s.processQueue()
+	if len(s.Output()) != 1 {
+		t.Errorf("expected buffer released early by the latency, got %d buffers", len(s.Output()))
+	}
+}
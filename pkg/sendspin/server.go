@@ -3,28 +3,31 @@
 package sendspin
 
 import (
+	"cmp"
 	"context"
-	"encoding/binary"
-	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/Sendspin/sendspin-go/internal/discovery"
-	"github.com/Sendspin/sendspin-go/internal/protocol"
-	"github.com/Sendspin/sendspin-go/internal/server"
+	"github.com/Sendspin/sendspin-go/pkg/audio/dsp"
+	"github.com/Sendspin/sendspin-go/pkg/audio/encode"
+	"github.com/Sendspin/sendspin-go/pkg/audio/loudness"
+	"github.com/Sendspin/sendspin-go/pkg/audio/resample"
+	"github.com/Sendspin/sendspin-go/pkg/discovery"
+	"github.com/Sendspin/sendspin-go/pkg/protocol"
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 )
 
 const (
-	// ProtocolVersion is the version of the Sendspin protocol we implement
-	ProtocolVersion = 1
+	// ProtocolVersion is the newest version of the Sendspin protocol we implement
+	ProtocolVersion = protocol.Version
 
 	// Message type for binary audio chunks
-	AudioChunkMessageType = 1
+	AudioChunkMessageType = protocol.AudioChunkType
 
 	// Audio format constants
 	DefaultSampleRate = 192000
@@ -50,10 +53,70 @@ type ServerConfig struct {
 	// EnableMDNS enables mDNS service advertisement (default: true)
 	EnableMDNS bool
 
+	// Interfaces limits mDNS advertisement to matching network interfaces,
+	// and ExcludeInterfaces leaves matching ones out (e.g. "docker*"), as
+	// in discovery.Config
+	Interfaces        []string
+	ExcludeInterfaces []string
+
+	// Adopt makes the server browse for players advertising _sendspin._tcp
+	// and connect to those it accepts (e.g. AdoptAll), so they join without
+	// being given a server address. Requires EnableMDNS. Nil leaves it to
+	// players to connect.
+	Adopt AdoptPolicy
+
 	// Debug enables debug logging
 	Debug bool
+
+	// Normalization selects loudness normalization: off (default), track,
+	// album or auto. Gains come from ReplayGain tags, or from analyzing
+	// untagged files in the background.
+	Normalization loudness.Mode
+
+	// NormalizationTarget is the loudness to normalize to in LUFS
+	// (default: -18, the ReplayGain reference)
+	NormalizationTarget float64
+
+	// LoudnessCacheDir stores analysis results for untagged files
+	// (default: sendspin/loudness in the user cache directory)
+	LoudnessCacheDir string
+
+	// Crossfade is how long consecutive sources overlap when the source
+	// changes (0 to MaxCrossfade). Zero joins sources gaplessly.
+	Crossfade time.Duration
+
+	// OnStatusChange is called with a fresh Status when a client connects,
+	// disconnects or changes state, or the source changes. Calls come from
+	// one goroutine, and changes in quick succession may be reported once.
+	OnStatusChange func(ServerStatus)
+
+	// StateFile stores per-client settings such as channel mappings so
+	// they survive restarts (default: kept in memory only)
+	StateFile string
+
+	// Codecs is the codec preference, most preferred first. Each player
+	// gets the first codec it supports that suits the source, falling back
+	// to PCM. Opus streams are resampled to 48kHz. Default: DefaultCodecs.
+	Codecs []string
+
+	// LeadTime is how far ahead of its playback time audio is sent,
+	// leaving room for network jitter (default: BufferAheadMs)
+	LeadTime time.Duration
+
+	// AuthToken, when set, is a shared secret clients must send as a
+	// bearer token. The server also sends it when connecting to players.
+	AuthToken string
+
+	// TLSCertFile and TLSKeyFile serve wss:// instead of ws://. Connections
+	// the server opens to players (ConnectPlayer, Adopt) are not affected.
+	TLSCertFile string
+	TLSKeyFile  string
 }
 
+// DefaultCodecs is the codec preference used when ServerConfig.Codecs is
+// empty: PCM at the source rate, then Opus, then FLAC
+var DefaultCodecs = []string{"pcm", "opus", "flac"}
+
 // Server represents a Sendspin streaming server
 type Server struct {
 	config   ServerConfig
@@ -69,16 +132,48 @@ type Server struct {
 	// Client management
 	clients   map[string]*client
 	clientsMu sync.RWMutex
+	store     *clientStore
 
 	// Server clock (monotonic microseconds)
 	clockStart time.Time
 
 	// Audio streaming
 	audioSource AudioSource
+	sourceMu    sync.Mutex // Guards audioSource and serializes Read and Seek on it
+
+	// nowPlaying is audioSource's metadata, readable while a Read blocks
+	nowPlaying atomic.Pointer[protocol.StreamMetadata]
+
+	// Source changes (guarded by sourceMu): pending replaces audioSource
+	// with the next chunk, queue plays once the current source ends, and
+	// fade is the crossfade in progress
+	pending AudioSource
+	queue   []AudioSource
+	fade    *crossfade
+
+	// progressDirty requests a session/update with a fresh progress anchor
+	// on the next chunk (guarded by sourceMu)
+	progressDirty bool
+
+	// paused is set while every player in the group is paused; no chunks
+	// are read or sent (guarded by sourceMu)
+	paused bool
+
+	// announcements wait to be mixed into their players' streams; the
+	// first is playing (guarded by sourceMu)
+	announcements []*announcement
+
+	// normalizer applies loudness normalization before encoding; nil when
+	// normalization is off (guarded by sourceMu)
+	normalizer    *loudness.Normalizer
+	loudnessCache *loudness.Cache
 
 	// mDNS discovery
 	mdnsManager *discovery.Manager
 
+	// statusChanged wakes the goroutine calling OnStatusChange
+	statusChanged chan struct{}
+
 	// Control
 	stopChan   chan struct{}
 	stopOnce   sync.Once
@@ -91,10 +186,20 @@ type Server struct {
 type client struct {
 	ID           string
 	Name         string
-	Conn         *websocket.Conn
+	Group        string
 	Roles        []string
 	Capabilities *protocol.PlayerSupport
 
+	// conn is the client's connection, which queues messages for it
+	conn *protocol.ServerConn
+
+	// Features are the optional protocol features negotiated with it
+	Features []string
+
+	// reportedName is the name from client/hello, used when no display
+	// name is assigned
+	reportedName string
+
 	// State
 	State  string
 	Volume int
@@ -102,22 +207,33 @@ type client struct {
 
 	// Negotiated codec for this client
 	Codec       string
-	OpusEncoder *server.OpusEncoder
+	OpusEncoder *encode.OpusEncoder
+
+	// Channels sent to this client; matrix is nil when every source
+	// channel is sent unchanged
+	mapping  ChannelMapping
+	matrix   dsp.Matrix
+	mixedBuf []int32
 
-	// Output channel for messages
-	sendChan chan interface{}
+	// Opus streams from sources not at 48kHz are resampled; opusBuf holds
+	// resampled audio short of a whole frame (guarded by sourceMu)
+	resampler *resample.Resampler
+	opusBuf   []int32
 
 	mu sync.RWMutex
 }
 
 // ClientInfo represents information about a connected client
 type ClientInfo struct {
-	ID     string
-	Name   string
-	State  string
-	Volume int
-	Muted  bool
-	Codec  string
+	ID          string
+	Name        string
+	Group       string
+	State       string
+	Volume      int
+	Muted       bool
+	Codec       string
+	ChannelRole ChannelRole
+	Features    []string // Optional protocol features negotiated with the client
 }
 
 // NewServer creates a new Sendspin server
@@ -129,8 +245,40 @@ func NewServer(config ServerConfig) (*Server, error) {
 	if config.Name == "" {
 		config.Name = "Sendspin Server"
 	}
-	if config.Source == nil {
-		return nil, fmt.Errorf("audio source is required")
+	if err := checkSource(config.Source); err != nil {
+		return nil, err
+	}
+	mode, err := loudness.ParseMode(string(config.Normalization))
+	if err != nil {
+		return nil, err
+	}
+	config.Normalization = mode
+	if config.NormalizationTarget == 0 {
+		config.NormalizationTarget = loudness.ReferenceLoudness
+	}
+	if config.Crossfade < 0 || config.Crossfade > MaxCrossfade {
+		return nil, fmt.Errorf("crossfade must be between 0 and %v, got %v", MaxCrossfade, config.Crossfade)
+	}
+	if len(config.Codecs) == 0 {
+		config.Codecs = DefaultCodecs
+	}
+	for _, codec := range config.Codecs {
+		if codec != "pcm" && codec != "opus" && codec != "flac" {
+			return nil, fmt.Errorf("unsupported codec %q (supported: pcm, opus, flac)", codec)
+		}
+	}
+	if config.LeadTime == 0 {
+		config.LeadTime = BufferAheadMs * time.Millisecond
+	}
+	if config.LeadTime < ChunkDurationMs*time.Millisecond {
+		return nil, fmt.Errorf("lead time must be at least %dms, got %v", ChunkDurationMs, config.LeadTime)
+	}
+	if (config.TLSCertFile == "") != (config.TLSKeyFile == "") {
+		return nil, fmt.Errorf("TLS needs both a certificate and a key file")
+	}
+	store, err := loadClientStore(config.StateFile)
+	if err != nil {
+		return nil, err
 	}
 
 	mux := http.NewServeMux()
@@ -148,8 +296,21 @@ func NewServer(config ServerConfig) (*Server, error) {
 			},
 		},
 		clients:    make(map[string]*client),
+		store:      store,
 		clockStart: time.Now(),
 		stopChan:   make(chan struct{}),
+
+		statusChanged: make(chan struct{}, 1),
+	}
+	metadata := s.streamMetadata()
+	s.nowPlaying.Store(&metadata)
+
+	if mode != loudness.ModeOff {
+		s.normalizer = loudness.NewNormalizer(mode, config.NormalizationTarget,
+			config.Source.SampleRate(), config.Source.Channels())
+		if s.loudnessCache, err = loudness.NewCache(config.LoudnessCacheDir); err != nil {
+			log.Printf("Loudness cache unavailable: %v", err)
+		}
 	}
 
 	return s, nil
@@ -166,9 +327,13 @@ func (s *Server) Start() error {
 	// Start mDNS advertisement if enabled
 	if s.config.EnableMDNS {
 		s.mdnsManager = discovery.NewManager(discovery.Config{
-			ServiceName: s.config.Name,
-			Port:        s.config.Port,
-			ServerMode:  true,
+			ServiceName:       s.config.Name,
+			Port:              s.config.Port,
+			ServerMode:        true,
+			ID:                s.serverID,
+			Version:           ProtocolVersion,
+			Interfaces:        s.config.Interfaces,
+			ExcludeInterfaces: s.config.ExcludeInterfaces,
 		})
 
 		if err := s.mdnsManager.Advertise(); err != nil {
@@ -176,11 +341,35 @@ func (s *Server) Start() error {
 		} else {
 			log.Printf("mDNS advertisement started")
 		}
+
+		if s.config.Adopt != nil {
+			events := s.mdnsManager.Events()
+			s.mdnsManager.Browse()
+			s.wg.Add(1)
+			go func() {
+				defer s.wg.Done()
+				s.adoptPlayers(events)
+			}()
+			log.Printf("Browsing for players to connect to")
+		}
 	}
 
 	// Set up HTTP handlers
 	s.mux.HandleFunc("/sendspin", s.handleWebSocket)
 
+	s.sourceMu.Lock()
+	s.prepareLoudness()
+	s.sourceMu.Unlock()
+
+	if s.config.OnStatusChange != nil {
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.reportStatus()
+		}()
+		s.notifyStatus()
+	}
+
 	// Start audio streaming
 	s.wg.Add(1)
 	go func() {
@@ -200,7 +389,13 @@ func (s *Server) Start() error {
 	// Run server in goroutine
 	errChan := make(chan error, 1)
 	go func() {
-		if err := s.httpServer.ListenAndServe(); err != http.ErrServerClosed {
+		var err error
+		if s.config.TLSCertFile != "" {
+			err = s.httpServer.ListenAndServeTLS(s.config.TLSCertFile, s.config.TLSKeyFile)
+		} else {
+			err = s.httpServer.ListenAndServe()
+		}
+		if err != http.ErrServerClosed {
 			errChan <- err
 		}
 	}()
@@ -209,6 +404,9 @@ func (s *Server) Start() error {
 	select {
 	case <-s.stopChan:
 		log.Printf("Server shutting down...")
+		// Players drop queued audio and go idle rather than playing it out
+		s.sendToPlayers("stream/clear", protocol.StreamClear{})
+		s.sendToPlayers("stream/end", protocol.StreamEnd{})
 	case err := <-errChan:
 		log.Printf("HTTP server error: %v", err)
 		return err
@@ -232,10 +430,15 @@ func (s *Server) Start() error {
 		log.Printf("HTTP server shutdown error: %v", err)
 	}
 
-	// Close audio source
-	if err := s.audioSource.Close(); err != nil {
-		log.Printf("Error closing audio source: %v", err)
-	}
+	// WebSocket connections outlive the HTTP server; closing them lets
+	// players notice and fail over
+	s.closeClients()
+
+	// Close audio sources, including queued ones
+	s.sourceMu.Lock()
+	s.closeSources()
+	s.cancelAnnouncements(fmt.Errorf("server stopped"))
+	s.sourceMu.Unlock()
 
 	s.wg.Wait()
 	log.Printf("Server stopped cleanly")
@@ -250,109 +453,56 @@ func (s *Server) Stop() {
 	})
 }
 
-// Clients returns information about all connected clients
-func (s *Server) Clients() []ClientInfo {
+// closeClients tells every client the server is going away and closes
+// its connection
+func (s *Server) closeClients() {
 	s.clientsMu.RLock()
 	defer s.clientsMu.RUnlock()
 
-	clients := make([]ClientInfo, 0, len(s.clients))
 	for _, c := range s.clients {
-		c.mu.RLock()
-		clients = append(clients, ClientInfo{
-			ID:     c.ID,
-			Name:   c.Name,
-			State:  c.State,
-			Volume: c.Volume,
-			Muted:  c.Muted,
-			Codec:  c.Codec,
-		})
-		c.mu.RUnlock()
+		c.conn.CloseGoingAway("server shutting down")
 	}
-
-	return clients
 }
 
-// streamAudio generates and sends audio chunks to clients
-func (s *Server) streamAudio() {
-	log.Printf("Audio streaming started")
-
-	ticker := time.NewTicker(time.Duration(ChunkDurationMs) * time.Millisecond)
-	defer ticker.Stop()
-
-	for {
-		select {
-		case <-ticker.C:
-			s.generateAndSendChunk()
-		case <-s.stopChan:
-			log.Printf("Audio streaming stopping")
-			return
-		}
-	}
+// NowPlaying returns the metadata of the source being streamed
+func (s *Server) NowPlaying() (title, artist, album string) {
+	metadata := s.nowPlaying.Load()
+	return metadata.Title, metadata.Artist, metadata.Album
 }
 
-// generateAndSendChunk generates a chunk of audio and sends it to all clients
-func (s *Server) generateAndSendChunk() {
-	// Get current timestamp + buffer ahead time
-	currentTime := s.getClockMicros()
-	playbackTime := currentTime + (BufferAheadMs * 1000)
-
-	// Calculate chunk size based on source sample rate
-	chunkSamples := (s.audioSource.SampleRate() * ChunkDurationMs) / 1000
-	totalSamples := chunkSamples * s.audioSource.Channels()
-
-	// Read audio samples from source
-	samples := make([]int32, totalSamples)
-	n, err := s.audioSource.Read(samples)
-	if err != nil {
-		log.Printf("Error reading audio source: %v", err)
-		return
-	}
-
-	// Send to all clients
+// Clients returns information about all connected clients
+func (s *Server) Clients() []ClientInfo {
 	s.clientsMu.RLock()
 	defer s.clientsMu.RUnlock()
 
+	clients := make([]ClientInfo, 0, len(s.clients))
 	for _, c := range s.clients {
-		var audioData []byte
-		var encodeErr error
-
 		c.mu.RLock()
-		codec := c.Codec
-		opusEncoder := c.OpusEncoder
+		clients = append(clients, ClientInfo{
+			ID:          c.ID,
+			Name:        c.Name,
+			Group:       c.Group,
+			State:       c.State,
+			Volume:      c.Volume,
+			Muted:       c.Muted,
+			Codec:       c.Codec,
+			ChannelRole: c.mapping.role(),
+			Features:    c.Features,
+		})
 		c.mu.RUnlock()
-
-		// Encode based on client's negotiated codec
-		switch codec {
-		case "opus":
-			if opusEncoder != nil {
-				samples16 := convertToInt16(samples[:n])
-				audioData, encodeErr = opusEncoder.Encode(samples16)
-				if encodeErr != nil {
-					log.Printf("Opus encode error for %s: %v", c.Name, encodeErr)
-					continue
-				}
-			} else {
-				continue
-			}
-		case "pcm":
-			audioData = encodePCM(samples[:n])
-		default:
-			audioData = encodePCM(samples[:n])
-		}
-
-		// Create binary message
-		chunk := createAudioChunk(playbackTime, audioData)
-
-		if err := s.sendBinary(c, chunk); err != nil {
-			if s.config.Debug {
-				log.Printf("Error sending audio to %s: %v", c.Name, err)
-			}
-		}
 	}
+
+	return clients
 }
 
 // handleWebSocket handles WebSocket connections
 func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	if !authorized(r, s.config.AuthToken) {
+		log.Printf("Rejected unauthorized connection from %s", r.RemoteAddr)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
 	conn, err := s.upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Printf("WebSocket upgrade error: %v", err)
@@ -367,356 +517,500 @@ func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 func (s *Server) handleConnection(conn *websocket.Conn) {
 	defer conn.Close()
 
-	// Check if server is shutting down
-	s.shutdownMu.RLock()
-	if s.isShutdown {
-		s.shutdownMu.RUnlock()
-		log.Printf("Rejecting connection during shutdown")
-		return
-	}
-	s.shutdownMu.RUnlock()
-
-	// Wait for client/hello
-	_, data, err := conn.ReadMessage()
+	c, err := s.handshake(conn)
 	if err != nil {
-		log.Printf("Error reading hello: %v", err)
-		return
-	}
-
-	var msg protocol.Message
-	if err := json.Unmarshal(data, &msg); err != nil {
-		log.Printf("Error unmarshaling message: %v", err)
+		log.Printf("Handshake failed: %v", err)
 		return
 	}
+	s.serveClient(c)
+}
 
-	if msg.Type != "client/hello" {
-		log.Printf("Expected client/hello, got %s", msg.Type)
-		return
-	}
+// clientCommands are the client/command commands the server handles
+var clientCommands = []string{"seek", "next"}
 
-	// Parse client hello
-	helloData, err := json.Marshal(msg.Payload)
+// handshake reads client/hello, registers the client and answers with
+// server/hello. It is the same whichever side opened the connection.
+// Clients that can't be accepted are sent server/error first.
+func (s *Server) handshake(conn *websocket.Conn) (*client, error) {
+	sc, err := protocol.NewServerConn(conn, protocol.ServerConfig{
+		ServerID: s.serverID,
+		Name:     s.config.Name,
+		Commands: clientCommands,
+		Clock:    s.getClockMicros,
+	})
 	if err != nil {
-		log.Printf("Error marshaling hello payload: %v", err)
-		return
-	}
-
-	var hello protocol.ClientHello
-	if err := json.Unmarshal(helloData, &hello); err != nil {
-		log.Printf("Error unmarshaling client hello: %v", err)
-		return
+		return nil, err
 	}
 
-	if hello.ClientID == "" || hello.Name == "" {
-		log.Printf("Client hello missing required fields")
-		return
+	// Check if server is shutting down
+	s.shutdownMu.RLock()
+	if s.isShutdown {
+		s.shutdownMu.RUnlock()
+		return nil, sc.Refuse(protocol.Errorf(protocol.ErrorShuttingDown, "server is shutting down"))
 	}
+	s.shutdownMu.RUnlock()
 
+	hello := sc.Hello()
 	log.Printf("Client hello: %s (ID: %s, Roles: %v)", hello.Name, hello.ClientID, hello.SupportedRoles)
 
-	// Create client
+	// Create client, with the name and group remembered for its ID
+	stored := s.store.get(hello.ClientID)
 	c := &client{
 		ID:           hello.ClientID,
-		Name:         hello.Name,
-		Conn:         conn,
+		Name:         cmp.Or(stored.Name, hello.Name),
+		Group:        stored.Group,
+		reportedName: hello.Name,
+		conn:         sc,
 		Roles:        hello.SupportedRoles,
 		Capabilities: hello.PlayerSupport,
+		Features:     sc.Features(),
 		State:        "idle",
 		Volume:       100,
 		Muted:        false,
-		sendChan:     make(chan interface{}, 100),
 	}
 
 	// Check for duplicate and register
 	s.clientsMu.Lock()
 	if _, exists := s.clients[hello.ClientID]; exists {
 		s.clientsMu.Unlock()
-		log.Printf("Client ID %s already connected, rejecting duplicate", hello.ClientID)
-		return
+		return nil, sc.Refuse(protocol.Errorf(protocol.ErrorDuplicateClient, "client ID %s is already connected", hello.ClientID))
 	}
 	s.clients[c.ID] = c
 	s.clientsMu.Unlock()
 
-	defer func() {
+	if err := sc.Accept(); err != nil {
 		s.removeClient(c)
-		log.Printf("Client disconnected: %s", c.Name)
-	}()
-
-	// Send server/hello
-	serverHello := protocol.ServerHello{
-		ServerID: s.serverID,
-		Name:     s.config.Name,
-		Version:  ProtocolVersion,
+		return nil, err
 	}
 
-	if err := s.sendMessage(c, "server/hello", serverHello); err != nil {
-		log.Printf("Error sending server hello: %v", err)
-		return
+	// A returning player gets back the volume it had
+	if s.hasRole(c, "player") {
+		s.restoreVolume(c, stored)
 	}
 
-	// Start writer goroutine
-	s.wg.Add(1)
-	go func() {
-		defer s.wg.Done()
-		s.clientWriter(c)
+	return c, nil
+}
+
+// serveClient runs a registered client's session until it disconnects
+func (s *Server) serveClient(c *client) {
+	defer func() {
+		s.removeClient(c)
+		log.Printf("Client disconnected: %s", c.Name)
+		s.updateGroupPause()
+		s.notifyStatus()
 	}()
 
 	// Start stream for player clients
 	if s.hasRole(c, "player") {
 		s.addClientToStream(c)
 	}
+	s.notifyStatus()
 
-	// Read messages from client
 	for {
-		_, data, err := conn.ReadMessage()
-		if err != nil {
-			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-				log.Printf("WebSocket error: %v", err)
-			}
-			break
+		select {
+		case state := <-c.conn.PlayerUpdates:
+			s.handlePlayerUpdate(c, state)
+		case cmd := <-c.conn.Commands:
+			s.handleClientCommand(c, cmd)
+		case clientErr := <-c.conn.Errors:
+			log.Printf("Client %s reported an error: %v", c.Name, &clientErr)
+		case <-c.conn.Done():
+			return
 		}
-
-		s.handleClientMessage(c, data)
 	}
 }
 
-// clientWriter sends messages to the client
-func (s *Server) clientWriter(c *client) {
-	ticker := time.NewTicker(30 * time.Second)
-	defer ticker.Stop()
+// handlePlayerUpdate handles state updates from players
+func (s *Server) handlePlayerUpdate(c *client, state protocol.ClientState) {
+	c.mu.Lock()
+	c.State = state.State
+	c.Volume = state.Volume
+	c.Muted = state.Muted
+	c.mu.Unlock()
 
-	const writeDeadline = 10 * time.Second
+	s.rememberVolume(c.ID, state.Volume, state.Muted)
 
-	for {
-		select {
-		case msg, ok := <-c.sendChan:
-			if !ok {
-				return
-			}
+	if s.config.Debug {
+		log.Printf("Client %s state: %s (vol: %d, muted: %v)", c.Name, state.State, state.Volume, state.Muted)
+	}
 
-			switch v := msg.(type) {
-			case []byte:
-				c.Conn.SetWriteDeadline(time.Now().Add(writeDeadline))
-				if err := c.Conn.WriteMessage(websocket.BinaryMessage, v); err != nil {
-					return
-				}
-			default:
-				data, err := json.Marshal(v)
-				if err != nil {
-					continue
-				}
-				c.Conn.SetWriteDeadline(time.Now().Add(writeDeadline))
-				if err := c.Conn.WriteMessage(websocket.TextMessage, data); err != nil {
-					return
-				}
-			}
+	s.updateGroupPause()
+	s.notifyStatus()
+}
 
-		case <-ticker.C:
-			if err := c.Conn.WriteControl(websocket.PingMessage, []byte{}, time.Now().Add(10*time.Second)); err != nil {
-				return
-			}
+// updateGroupPause pauses streaming once every player in the group is
+// paused, and resumes it as soon as any player is playing again. Sources
+// implementing Pausable are paused and resumed along with the group.
+func (s *Server) updateGroupPause() {
+	s.sourceMu.Lock()
+	defer s.sourceMu.Unlock()
+
+	s.clientsMu.RLock()
+	players, pausedPlayers := 0, 0
+	for _, c := range s.clients {
+		if !s.hasRole(c, "player") {
+			continue
+		}
+		players++
+		c.mu.RLock()
+		if c.State == "paused" {
+			pausedPlayers++
 		}
+		c.mu.RUnlock()
 	}
-}
+	s.clientsMu.RUnlock()
 
-// handleClientMessage processes messages from clients
-func (s *Server) handleClientMessage(c *client, data []byte) {
-	var msg protocol.Message
-	if err := json.Unmarshal(data, &msg); err != nil {
-		log.Printf("Error unmarshaling message: %v", err)
+	groupPaused := players > 0 && pausedPlayers == players
+	if groupPaused == s.paused {
 		return
 	}
-
-	switch msg.Type {
-	case "client/time":
-		s.handleTimeSync(c, msg.Payload)
-	case "player/update":
-		s.handlePlayerUpdate(c, msg.Payload)
-	default:
-		if s.config.Debug {
-			log.Printf("Unknown message type: %s", msg.Type)
+	s.paused = groupPaused
+
+	pausable, isPausable := s.audioSource.(Pausable)
+	if !groupPaused {
+		log.Printf("Group resumed")
+		if isPausable {
+			if err := pausable.Resume(); err != nil {
+				log.Printf("Error resuming audio source: %v", err)
+			}
 		}
+		// Re-anchor progress with the first chunk after the pause
+		s.progressDirty = true
+		return
 	}
-}
 
-// handleTimeSync responds to time synchronization requests
-func (s *Server) handleTimeSync(c *client, payload interface{}) {
-	serverRecv := s.getClockMicros()
+	log.Printf("Group paused")
+	if isPausable {
+		if err := pausable.Pause(); err != nil {
+			log.Printf("Error pausing audio source: %v", err)
+		}
+	}
 
-	timeData, err := json.Marshal(payload)
-	if err != nil {
-		return
+	if seekable, ok := s.audioSource.(Seekable); ok {
+		update := s.progressUpdate("paused", s.getClockMicros(), seekable.Position(), seekable.Duration())
+		s.clientsMu.RLock()
+		for _, c := range s.clients {
+			c.conn.SendSessionUpdate(update)
+		}
+		s.clientsMu.RUnlock()
 	}
+}
 
-	var clientTime protocol.ClientTime
-	if err := json.Unmarshal(timeData, &clientTime); err != nil {
-		return
+// handleClientCommand handles control requests from controller clients
+func (s *Server) handleClientCommand(c *client, cmd protocol.ClientCommand) {
+	switch cmd.Command {
+	case "seek":
+		if err := s.Seek(time.Duration(cmd.Position) * time.Millisecond); err != nil {
+			log.Printf("Seek from %s failed: %v", c.Name, err)
+		}
+	case "next":
+		if err := s.Next(); err != nil {
+			log.Printf("Next from %s failed: %v", c.Name, err)
+		}
 	}
+}
 
-	serverSend := s.getClockMicros()
+// Seek moves the audio source to the given position.
+// Players receive stream/clear so audio buffered from before the seek is
+// discarded, and all clients receive a session/update with the new progress.
+// Returns an error if the source does not implement Seekable.
+func (s *Server) Seek(position time.Duration) error {
+	// Hold the source lock until players are cleared so no post-seek
+	// chunk is sent ahead of the stream/clear
+	s.sourceMu.Lock()
+	defer s.sourceMu.Unlock()
+
+	seekable, ok := s.audioSource.(Seekable)
+	if !ok {
+		return fmt.Errorf("audio source is not seekable")
+	}
 
-	response := protocol.ServerTime{
-		ClientTransmitted: clientTime.ClientTransmitted,
-		ServerReceived:    serverRecv,
-		ServerTransmitted: serverSend,
+	if err := seekable.Seek(position); err != nil {
+		return err
+	}
+	// The outgoing source of a crossfade is dropped with the old audio
+	s.endCrossfade()
+	if s.normalizer != nil {
+		s.normalizer.Reset()
 	}
+	s.progressDirty = true
 
-	s.sendMessage(c, "server/time", response)
+	log.Printf("Seeked to %v", position)
+
+	s.sendToPlayers("stream/clear", protocol.StreamClear{})
+	return nil
 }
 
-// handlePlayerUpdate handles state updates from players
-func (s *Server) handlePlayerUpdate(c *client, payload interface{}) {
-	stateData, err := json.Marshal(payload)
-	if err != nil {
-		return
+// SetPlayerDSP replaces a player's processing chain (preamp, parametric EQ
+// and the file name of an impulse response in the player's
+// ImpulseResponseDir). An empty config disables
+// processing. Returns an error if the client is unknown or does not
+// support the "dsp" command.
+func (s *Server) SetPlayerDSP(clientID string, config dsp.ChainConfig) error {
+	if err := config.Validate(); err != nil {
+		return fmt.Errorf("invalid DSP config: %w", err)
 	}
 
-	var state protocol.ClientState
-	if err := json.Unmarshal(stateData, &state); err != nil {
-		return
+	s.clientsMu.RLock()
+	c, ok := s.clients[clientID]
+	s.clientsMu.RUnlock()
+	if !ok {
+		return fmt.Errorf("client not found: %s", clientID)
+	}
+	if !s.hasRole(c, "player") || !supportsCommand(c, "dsp") {
+		return fmt.Errorf("client %s does not support DSP", c.Name)
 	}
 
-	c.mu.Lock()
-	c.State = state.State
-	c.Volume = state.Volume
-	c.Muted = state.Muted
-	c.mu.Unlock()
+	settings := &protocol.DSPSettings{
+		Preamp:          config.Preamp,
+		ImpulseResponse: config.ImpulseResponse,
+	}
+	for _, f := range config.Filters {
+		settings.Filters = append(settings.Filters, protocol.DSPFilter{
+			Type:      string(f.Type),
+			Frequency: f.Frequency,
+			Gain:      f.Gain,
+			Q:         f.Q,
+		})
+	}
 
-	if s.config.Debug {
-		log.Printf("Client %s state: %s (vol: %d, muted: %v)", c.Name, state.State, state.Volume, state.Muted)
+	if err := c.conn.SendCommand(protocol.ServerCommand{Command: "dsp", DSP: settings}); err != nil {
+		return fmt.Errorf("failed to send DSP to %s: %w", c.Name, err)
 	}
+	return nil
 }
 
-// addClientToStream adds a client to receive audio
-func (s *Server) addClientToStream(c *client) {
-	// Negotiate codec
-	codec := s.negotiateCodec(c)
-
-	// Create encoder if needed
-	var opusEncoder *server.OpusEncoder
-	chunkSamples := (s.audioSource.SampleRate() * ChunkDurationMs) / 1000
-
-	switch codec {
-	case "opus":
-		encoder, err := server.NewOpusEncoder(s.audioSource.SampleRate(), s.audioSource.Channels(), chunkSamples)
-		if err != nil {
-			log.Printf("Failed to create Opus encoder for %s, falling back to PCM: %v", c.Name, err)
-			codec = "pcm"
-		} else {
-			opusEncoder = encoder
-		}
-	case "flac":
-		log.Printf("FLAC streaming not supported for %s, using PCM", c.Name)
-		codec = "pcm"
+// SetChannelMapping assigns the channels a client receives, e.g. the left
+// or right side of a stereo pair or a mono downmix for a subwoofer. The
+// mapping is remembered by client ID (and saved to ServerConfig.StateFile
+// if set), so it also applies to clients that connect later. A connected
+// player's stream restarts with the new channels.
+func (s *Server) SetChannelMapping(clientID string, mapping ChannelMapping) error {
+	if err := mapping.Validate(); err != nil {
+		return fmt.Errorf("invalid channel mapping: %w", err)
 	}
 
-	c.mu.Lock()
-	c.Codec = codec
-	c.OpusEncoder = opusEncoder
-	c.mu.Unlock()
+	// Held so the source format can't change under the check and restart
+	s.sourceMu.Lock()
+	defer s.sourceMu.Unlock()
 
-	log.Printf("Added client %s with codec %s", c.Name, codec)
+	if _, err := mapping.matrix(s.audioSource.Channels(), s.audioSource.Channels()); err != nil {
+		return fmt.Errorf("invalid channel mapping: %w", err)
+	}
+	if err := s.store.update(clientID, func(settings *clientSettings) {
+		settings.ChannelMapping = &mapping
+	}); err != nil {
+		return err
+	}
 
-	// Send stream/start message
-	streamStart := protocol.StreamStart{
-		Player: &protocol.StreamStartPlayer{
-			Codec:      codec,
-			SampleRate: s.audioSource.SampleRate(),
-			Channels:   s.audioSource.Channels(),
-			BitDepth:   DefaultBitDepth,
-		},
+	s.clientsMu.RLock()
+	c, ok := s.clients[clientID]
+	s.clientsMu.RUnlock()
+	if ok && s.hasRole(c, "player") {
+		s.configureStream(c)
+		log.Printf("Channel mapping for %s: %s", c.Name, mapping.role())
 	}
+	return nil
+}
 
-	s.sendMessage(c, "stream/start", streamStart)
+// ChannelMapping returns the channels assigned to a client ID
+func (s *Server) ChannelMapping(clientID string) ChannelMapping {
+	if stored := s.store.get(clientID).ChannelMapping; stored != nil {
+		return *stored
+	}
+	return ChannelMapping{Role: ChannelsStereo}
+}
 
-	// Send metadata
-	title, artist, album := s.audioSource.Metadata()
-	metadata := protocol.StreamMetadata{
-		Title:  title,
-		Artist: artist,
-		Album:  album,
+// SetPlayerVolume sets a player's volume (0-100) and mute. The levels are
+// remembered by client ID like the player's own changes, so a player
+// that is not connected gets them when it next connects.
+func (s *Server) SetPlayerVolume(clientID string, volume int, muted bool) error {
+	if volume < 0 || volume > 100 {
+		return fmt.Errorf("volume must be between 0 and 100, got %d", volume)
+	}
+	if err := s.store.update(clientID, func(settings *clientSettings) {
+		settings.Volume = &volume
+		settings.Muted = &muted
+	}); err != nil {
+		return err
 	}
 
-	s.sendMessage(c, "stream/metadata", metadata)
+	s.clientsMu.RLock()
+	c, ok := s.clients[clientID]
+	s.clientsMu.RUnlock()
+	if !ok || !s.hasRole(c, "player") {
+		return nil
+	}
+	return s.sendVolume(c, volume, muted)
 }
 
-// removeClient removes a client
-func (s *Server) removeClient(c *client) {
-	s.clientsMu.Lock()
-	defer s.clientsMu.Unlock()
-
-	c.mu.Lock()
-	if c.OpusEncoder != nil {
-		c.OpusEncoder.Close()
-		c.OpusEncoder = nil
+// SetClientName assigns a display name that replaces the one the client
+// reports, remembered by client ID. An empty name restores the client's own.
+func (s *Server) SetClientName(clientID, name string) error {
+	if err := s.store.update(clientID, func(settings *clientSettings) {
+		settings.Name = name
+	}); err != nil {
+		return err
 	}
-	c.mu.Unlock()
 
-	delete(s.clients, c.ID)
-	close(c.sendChan)
+	s.clientsMu.RLock()
+	c, ok := s.clients[clientID]
+	s.clientsMu.RUnlock()
+	if ok {
+		c.mu.Lock()
+		c.Name = cmp.Or(name, c.reportedName)
+		c.mu.Unlock()
+		s.notifyStatus()
+	}
+	return nil
 }
 
-// negotiateCodec selects the best codec based on client capabilities
-func (s *Server) negotiateCodec(c *client) string {
-	if c.Capabilities == nil {
-		return "pcm"
+// SetClientGroup assigns a client to a named group (e.g. a room),
+// remembered by client ID and reported in ClientInfo. Every client still
+// follows the server's one timeline; an empty group clears it.
+func (s *Server) SetClientGroup(clientID, group string) error {
+	if err := s.store.update(clientID, func(settings *clientSettings) {
+		settings.Group = group
+	}); err != nil {
+		return err
 	}
 
-	sourceRate := s.audioSource.SampleRate()
+	s.clientsMu.RLock()
+	c, ok := s.clients[clientID]
+	s.clientsMu.RUnlock()
+	if ok {
+		c.mu.Lock()
+		c.Group = group
+		c.mu.Unlock()
+		s.notifyStatus()
+	}
+	return nil
+}
 
-	// Prioritize PCM at native rate
-	for _, format := range c.Capabilities.SupportFormats {
-		if format.Codec == "pcm" && format.SampleRate == sourceRate && format.BitDepth == DefaultBitDepth {
-			return "pcm"
-		}
+// restoreVolume sends a returning player the volume remembered for it
+func (s *Server) restoreVolume(c *client, stored clientSettings) {
+	if stored.Volume == nil {
+		return
 	}
+	muted := stored.Muted != nil && *stored.Muted
+	if err := s.sendVolume(c, *stored.Volume, muted); err != nil {
+		log.Printf("Failed to restore volume for %s: %v", c.Name, err)
+		return
+	}
+	log.Printf("Restored volume for %s: %d%% (muted: %v)", c.Name, *stored.Volume, muted)
+}
 
-	// Consider compressed codecs
-	for _, format := range c.Capabilities.SupportFormats {
-		if format.Codec == "opus" && sourceRate == 48000 {
-			return "opus"
+// sendVolume commands a player's volume and mute, where supported
+func (s *Server) sendVolume(c *client, volume int, muted bool) error {
+	if supportsCommand(c, "volume") {
+		if err := c.conn.SendCommand(protocol.ServerCommand{Command: "volume", Volume: volume}); err != nil {
+			return fmt.Errorf("failed to send volume to %s: %w", c.Name, err)
 		}
-		if format.Codec == "flac" {
-			return "flac"
+	}
+	if supportsCommand(c, "mute") {
+		if err := c.conn.SendCommand(protocol.ServerCommand{Command: "mute", Mute: muted}); err != nil {
+			return fmt.Errorf("failed to send mute to %s: %w", c.Name, err)
 		}
 	}
+	return nil
+}
 
-	// Check legacy support
-	for _, codec := range c.Capabilities.SupportCodecs {
-		if codec == "opus" && sourceRate == 48000 {
-			return "opus"
-		}
-		if codec == "flac" {
-			return "flac"
+// rememberVolume stores the levels a player reported, writing the store
+// only when they changed
+func (s *Server) rememberVolume(clientID string, volume int, muted bool) {
+	stored := s.store.get(clientID)
+	if stored.Volume != nil && *stored.Volume == volume && stored.Muted != nil && *stored.Muted == muted {
+		return
+	}
+	if err := s.store.update(clientID, func(settings *clientSettings) {
+		settings.Volume = &volume
+		settings.Muted = &muted
+	}); err != nil {
+		log.Printf("Failed to remember volume for %s: %v", clientID, err)
+	}
+}
+
+// supportsCommand reports whether a player advertised a server/command
+func supportsCommand(c *client, command string) bool {
+	if c.Capabilities == nil {
+		return false
+	}
+	for _, cmd := range c.Capabilities.SupportedCommands {
+		if cmd == command {
+			return true
 		}
 	}
+	return false
+}
 
-	return "pcm"
+// sendToPlayers sends a JSON message to every client with the player role
+func (s *Server) sendToPlayers(msgType string, payload interface{}) {
+	s.clientsMu.RLock()
+	defer s.clientsMu.RUnlock()
+
+	for _, c := range s.clients {
+		if s.hasRole(c, "player") {
+			if err := c.conn.Send(msgType, payload); err != nil && s.config.Debug {
+				log.Printf("Error sending %s to %s: %v", msgType, c.Name, err)
+			}
+		}
+	}
 }
 
-// sendMessage sends a JSON message to a client
-func (s *Server) sendMessage(c *client, msgType string, payload interface{}) error {
-	msg := protocol.Message{
-		Type:    msgType,
-		Payload: payload,
+// progressUpdate builds a session/update anchoring the track position to a server timestamp
+func (s *Server) progressUpdate(playbackState string, timestamp int64, position, duration time.Duration) protocol.SessionUpdate {
+	title, artist, album := s.audioSource.Metadata()
+	update := protocol.SessionUpdate{
+		GroupID:       s.serverID,
+		PlaybackState: playbackState,
+		Metadata: &protocol.SessionMetadata{
+			Title:         title,
+			Artist:        artist,
+			Album:         album,
+			TrackDuration: int(duration / time.Second),
+			PlaybackSpeed: 1.0,
+			Timestamp:     timestamp,
+			TrackProgress: position.Milliseconds(),
+		},
 	}
+	if s.normalizer != nil {
+		if gain, info, ok := s.normalizer.Gain(); ok {
+			update.Metadata.Normalization = &protocol.Normalization{
+				Mode:     string(s.normalizer.Mode()),
+				Gain:     gain.Gain,
+				Peak:     gain.Peak,
+				Loudness: info.Loudness,
+				Source:   info.Source,
+			}
+		}
+	}
+	return update
+}
 
-	select {
-	case c.sendChan <- msg:
-		return nil
-	default:
-		return fmt.Errorf("client send buffer full")
+// streamMetadata describes the current source (called with sourceMu held)
+func (s *Server) streamMetadata() protocol.StreamMetadata {
+	title, artist, album := s.audioSource.Metadata()
+	return protocol.StreamMetadata{
+		Title:  title,
+		Artist: artist,
+		Album:  album,
 	}
 }
 
-// sendBinary sends binary data to a client
-func (s *Server) sendBinary(c *client, data []byte) error {
-	select {
-	case c.sendChan <- data:
-		return nil
-	default:
-		return fmt.Errorf("client send buffer full")
+// removeClient removes a client
+func (s *Server) removeClient(c *client) {
+	s.clientsMu.Lock()
+	defer s.clientsMu.Unlock()
+
+	c.mu.Lock()
+	if c.OpusEncoder != nil {
+		c.OpusEncoder.Close()
+		c.OpusEncoder = nil
 	}
+	c.mu.Unlock()
+
+	delete(s.clients, c.ID)
+	c.conn.Close()
 }
 
 // getClockMicros returns the server clock in microseconds
@@ -733,32 +1027,3 @@ func (s *Server) hasRole(c *client, role string) bool {
 	}
 	return false
 }
-
-// createAudioChunk creates a binary audio chunk message
-func createAudioChunk(timestamp int64, audioData []byte) []byte {
-	chunk := make([]byte, 1+8+len(audioData))
-	chunk[0] = AudioChunkMessageType
-	binary.BigEndian.PutUint64(chunk[1:9], uint64(timestamp))
-	copy(chunk[9:], audioData)
-	return chunk
-}
-
-// convertToInt16 converts int32 samples to int16 (for Opus encoding)
-func convertToInt16(samples []int32) []int16 {
-	result := make([]int16, len(samples))
-	for i, s := range samples {
-		result[i] = int16(s >> 8)
-	}
-	return result
-}
-
-// encodePCM encodes int32 samples as 24-bit PCM bytes
-func encodePCM(samples []int32) []byte {
-	output := make([]byte, len(samples)*3)
-	for i, sample := range samples {
-		output[i*3] = byte(sample)
-		output[i*3+1] = byte(sample >> 8)
-		output[i*3+2] = byte(sample >> 16)
-	}
-	return output
-}
@@ -5,10 +5,12 @@ package sendspin
 import (
 	"encoding/json"
 	"fmt"
+	"sync/atomic"
 	"testing"
 	"time"
 
-	"github.com/Sendspin/sendspin-go/internal/protocol"
+	"github.com/Sendspin/sendspin-go/pkg/audio/dsp"
+	"github.com/Sendspin/sendspin-go/pkg/protocol"
 	"github.com/gorilla/websocket"
 )
 
@@ -53,6 +55,30 @@ func TestNewServer(t *testing.T) {
 			},
 			expectErr: false,
 		},
+		{
+			name: "unknown codec",
+			config: ServerConfig{
+				Source: source,
+				Codecs: []string{"aac"},
+			},
+			expectErr: true,
+		},
+		{
+			name: "TLS certificate without a key",
+			config: ServerConfig{
+				Source:      source,
+				TLSCertFile: "server.pem",
+			},
+			expectErr: true,
+		},
+		{
+			name: "lead time shorter than a chunk",
+			config: ServerConfig{
+				Source:   source,
+				LeadTime: time.Millisecond,
+			},
+			expectErr: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -85,6 +111,41 @@ func TestNewServer(t *testing.T) {
 	}
 }
 
+func TestServerCodecPreference(t *testing.T) {
+	caps := &protocol.PlayerSupport{
+		SupportFormats: []protocol.AudioFormat{
+			{Codec: "flac", Channels: 2, SampleRate: 48000, BitDepth: 24},
+			{Codec: "opus", Channels: 2, SampleRate: 48000, BitDepth: 16},
+			{Codec: "pcm", Channels: 2, SampleRate: 48000, BitDepth: 24},
+		},
+	}
+
+	tests := []struct {
+		name   string
+		rate   int
+		codecs []string
+		want   string
+	}{
+		{name: "default prefers pcm", rate: 48000, want: "pcm"},
+		{name: "opus first", rate: 48000, codecs: []string{"opus", "pcm"}, want: "opus"},
+		{name: "opus at any rate", rate: 44100, codecs: []string{"opus", "flac"}, want: "opus"},
+		{name: "pcm needs the native rate", rate: 44100, codecs: []string{"pcm", "flac"}, want: "flac"},
+		{name: "default without native pcm", rate: 96000, want: "opus"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, err := NewServer(ServerConfig{Source: NewTestTone(tt.rate, 2), Codecs: tt.codecs})
+			if err != nil {
+				t.Fatalf("failed to create server: %v", err)
+			}
+			if got := server.negotiateCodec(&client{Capabilities: caps}); got != tt.want {
+				t.Errorf("expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
 func TestServerStartStop(t *testing.T) {
 	source := NewTestTone(48000, 2)
 
@@ -431,3 +492,508 @@ func TestServerDuplicateClientID(t *testing.T) {
 	server.Stop()
 	time.Sleep(100 * time.Millisecond)
 }
+
+// seekableTone is a test tone that tracks a position within a fixed-length track
+type seekableTone struct {
+	*TestToneSource
+	frames   int64
+	length   int64
+	seekErr  error
+	seekedTo time.Duration
+}
+
+func newSeekableTone(sampleRate, channels int, length time.Duration) *seekableTone {
+	return &seekableTone{
+		TestToneSource: NewTestTone(sampleRate, channels),
+		length:         int64(length) * int64(sampleRate) / int64(time.Second),
+	}
+}
+
+func (s *seekableTone) Read(samples []int32) (int, error) {
+	n, err := s.TestToneSource.Read(samples)
+	s.frames = (s.frames + int64(n/s.Channels())) % s.length
+	return n, err
+}
+
+func (s *seekableTone) Seek(position time.Duration) error {
+	if s.seekErr != nil {
+		return s.seekErr
+	}
+	s.seekedTo = position
+	s.frames = int64(position) * int64(s.SampleRate()) / int64(time.Second)
+	return nil
+}
+
+func (s *seekableTone) Position() time.Duration {
+	return time.Duration(s.frames * int64(time.Second) / int64(s.SampleRate()))
+}
+
+func (s *seekableTone) Duration() time.Duration {
+	return time.Duration(s.length * int64(time.Second) / int64(s.SampleRate()))
+}
+
+// readUntil reads messages until one of the given type arrives, skipping audio
+func readUntil(t *testing.T, conn *websocket.Conn, msgType string) protocol.Message {
+	t.Helper()
+
+	conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	defer conn.SetReadDeadline(time.Time{})
+
+	for {
+		kind, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("failed waiting for %s: %v", msgType, err)
+		}
+		if kind != websocket.TextMessage {
+			continue
+		}
+		var msg protocol.Message
+		if err := json.Unmarshal(data, &msg); err != nil {
+			t.Fatalf("failed to unmarshal message: %v", err)
+		}
+		if msg.Type == msgType {
+			return msg
+		}
+	}
+}
+
+func decodeSessionMetadata(t *testing.T, msg protocol.Message) *protocol.SessionMetadata {
+	t.Helper()
+
+	data, _ := json.Marshal(msg.Payload)
+	var update protocol.SessionUpdate
+	if err := json.Unmarshal(data, &update); err != nil {
+		t.Fatalf("failed to unmarshal session/update: %v", err)
+	}
+	if update.Metadata == nil {
+		t.Fatal("session/update has no metadata")
+	}
+	return update.Metadata
+}
+
+func TestServerSeek(t *testing.T) {
+	source := newSeekableTone(48000, 2, 3*time.Minute)
+
+	server, err := NewServer(ServerConfig{
+		Port:   8933,
+		Name:   "Test Server",
+		Source: source,
+	})
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- server.Start()
+	}()
+	time.Sleep(200 * time.Millisecond)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws://localhost:8933/sendspin", nil)
+	if err != nil {
+		t.Fatalf("failed to connect to server: %v", err)
+	}
+	defer conn.Close()
+
+	hello := protocol.Message{
+		Type: "client/hello",
+		Payload: protocol.ClientHello{
+			ClientID:       "seek-client",
+			Name:           "Seek Client",
+			Version:        1,
+			SupportedRoles: []string{"player", "controller"},
+		},
+	}
+	if err := conn.WriteJSON(hello); err != nil {
+		t.Fatalf("failed to send hello: %v", err)
+	}
+
+	readUntil(t, conn, "stream/start")
+
+	// A new client gets a progress anchor
+	meta := decodeSessionMetadata(t, readUntil(t, conn, "session/update"))
+	if meta.TrackDuration != 180 {
+		t.Errorf("expected track duration 180s, got %d", meta.TrackDuration)
+	}
+	if meta.Timestamp == 0 {
+		t.Error("expected progress timestamp to be set")
+	}
+	if meta.PlaybackSpeed != 1.0 {
+		t.Errorf("expected playback speed 1.0, got %f", meta.PlaybackSpeed)
+	}
+
+	// Seek via client/command
+	seek := protocol.Message{
+		Type:    "client/command",
+		Payload: protocol.ClientCommand{Command: "seek", Position: 90000},
+	}
+	if err := conn.WriteJSON(seek); err != nil {
+		t.Fatalf("failed to send seek: %v", err)
+	}
+
+	// Players are told to drop pre-seek audio, then progress follows
+	readUntil(t, conn, "stream/clear")
+	meta = decodeSessionMetadata(t, readUntil(t, conn, "session/update"))
+	if meta.TrackProgress != 90000 {
+		t.Errorf("expected track progress 90000ms, got %d", meta.TrackProgress)
+	}
+	if source.seekedTo != 90*time.Second {
+		t.Errorf("expected source seeked to 90s, got %v", source.seekedTo)
+	}
+
+	conn.Close()
+	time.Sleep(100 * time.Millisecond)
+
+	server.Stop()
+	select {
+	case <-errChan:
+	case <-time.After(5 * time.Second):
+		t.Error("server did not stop within timeout")
+	}
+}
+
+func TestServerSeekNotSeekable(t *testing.T) {
+	server, err := NewServer(ServerConfig{
+		Port:   8934,
+		Source: NewTestTone(48000, 2),
+	})
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	if err := server.Seek(10 * time.Second); err == nil {
+		t.Error("expected error seeking a non-seekable source")
+	}
+}
+
+type pausableTone struct {
+	*seekableTone
+	pauses  atomic.Int32
+	resumes atomic.Int32
+}
+
+func (s *pausableTone) Pause() error {
+	s.pauses.Add(1)
+	return nil
+}
+
+func (s *pausableTone) Resume() error {
+	s.resumes.Add(1)
+	return nil
+}
+
+// readSessionUpdate reads session/update messages until one has the given playback state
+func readSessionUpdate(t *testing.T, conn *websocket.Conn, playbackState string) protocol.SessionUpdate {
+	t.Helper()
+
+	for {
+		data, _ := json.Marshal(readUntil(t, conn, "session/update").Payload)
+		var update protocol.SessionUpdate
+		if err := json.Unmarshal(data, &update); err != nil {
+			t.Fatalf("failed to unmarshal session/update: %v", err)
+		}
+		if update.PlaybackState == playbackState {
+			return update
+		}
+	}
+}
+
+func TestServerGroupPause(t *testing.T) {
+	source := &pausableTone{seekableTone: newSeekableTone(48000, 2, 3*time.Minute)}
+
+	server, err := NewServer(ServerConfig{
+		Port:   8935,
+		Name:   "Test Server",
+		Source: source,
+	})
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- server.Start()
+	}()
+	time.Sleep(200 * time.Millisecond)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws://localhost:8935/sendspin", nil)
+	if err != nil {
+		t.Fatalf("failed to connect to server: %v", err)
+	}
+	defer conn.Close()
+
+	hello := protocol.Message{
+		Type: "client/hello",
+		Payload: protocol.ClientHello{
+			ClientID:       "pause-client",
+			Name:           "Pause Client",
+			Version:        1,
+			SupportedRoles: []string{"player"},
+		},
+	}
+	if err := conn.WriteJSON(hello); err != nil {
+		t.Fatalf("failed to send hello: %v", err)
+	}
+	readUntil(t, conn, "stream/start")
+
+	sendState := func(state string) {
+		msg := protocol.Message{
+			Type:    "player/update",
+			Payload: protocol.ClientState{State: state, Volume: 100},
+		}
+		if err := conn.WriteJSON(msg); err != nil {
+			t.Fatalf("failed to send %s state: %v", state, err)
+		}
+	}
+
+	// The only player pausing pauses the group
+	sendState("paused")
+	update := readSessionUpdate(t, conn, "paused")
+	if update.Metadata == nil || update.Metadata.Timestamp == 0 {
+		t.Error("expected paused session/update to carry a progress anchor")
+	}
+	if got := source.pauses.Load(); got != 1 {
+		t.Errorf("expected source paused once, got %d", got)
+	}
+
+	// No audio is sent while the group is paused
+	conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	for {
+		kind, _, err := conn.ReadMessage()
+		if err != nil {
+			break
+		}
+		if kind == websocket.BinaryMessage {
+			t.Fatal("received audio while group paused")
+		}
+	}
+	conn.SetReadDeadline(time.Time{})
+
+	// The connection is unusable after a read timeout, so check resume
+	// through the source and server state
+	sendState("playing")
+	time.Sleep(100 * time.Millisecond)
+	if got := source.resumes.Load(); got != 1 {
+		t.Errorf("expected source resumed once, got %d", got)
+	}
+	server.sourceMu.Lock()
+	paused := server.paused
+	server.sourceMu.Unlock()
+	if paused {
+		t.Error("expected group to resume when the player plays")
+	}
+
+	conn.Close()
+	time.Sleep(100 * time.Millisecond)
+
+	server.Stop()
+	select {
+	case <-errChan:
+	case <-time.After(5 * time.Second):
+		t.Error("server did not stop within timeout")
+	}
+}
+
+func TestServerSetPlayerDSP(t *testing.T) {
+	server, err := NewServer(ServerConfig{
+		Port:   8936,
+		Name:   "Test Server",
+		Source: NewTestTone(48000, 2),
+	})
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- server.Start()
+	}()
+	time.Sleep(200 * time.Millisecond)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws://localhost:8936/sendspin", nil)
+	if err != nil {
+		t.Fatalf("failed to connect to server: %v", err)
+	}
+	defer conn.Close()
+
+	hello := protocol.Message{
+		Type: "client/hello",
+		Payload: protocol.ClientHello{
+			ClientID:       "dsp-client",
+			Name:           "DSP Client",
+			Version:        1,
+			SupportedRoles: []string{"player"},
+			PlayerSupport: &protocol.PlayerSupport{
+				SupportedCommands: []string{"volume", "mute", "dsp"},
+			},
+		},
+	}
+	if err := conn.WriteJSON(hello); err != nil {
+		t.Fatalf("failed to send hello: %v", err)
+	}
+	readUntil(t, conn, "stream/start")
+
+	if err := server.SetPlayerDSP("unknown", dsp.ChainConfig{}); err == nil {
+		t.Error("expected error for unknown client")
+	}
+	invalid := dsp.ChainConfig{Filters: []dsp.FilterConfig{{Type: dsp.Peaking}}}
+	if err := server.SetPlayerDSP("dsp-client", invalid); err == nil {
+		t.Error("expected error for invalid config")
+	}
+
+	config := dsp.ChainConfig{
+		Preamp:          -3,
+		Filters:         []dsp.FilterConfig{{Type: dsp.Peaking, Frequency: 60, Gain: -6, Q: 2}},
+		ImpulseResponse: "room.wav",
+	}
+	if err := server.SetPlayerDSP("dsp-client", config); err != nil {
+		t.Fatalf("SetPlayerDSP failed: %v", err)
+	}
+
+	msg := readUntil(t, conn, "server/command")
+	data, _ := json.Marshal(msg.Payload)
+	var cmd protocol.ServerCommand
+	if err := json.Unmarshal(data, &cmd); err != nil {
+		t.Fatalf("failed to unmarshal server/command: %v", err)
+	}
+	if cmd.Command != "dsp" || cmd.DSP == nil {
+		t.Fatalf("expected dsp command with settings, got %+v", cmd)
+	}
+	if cmd.DSP.Preamp != -3 || cmd.DSP.ImpulseResponse != config.ImpulseResponse {
+		t.Errorf("unexpected settings: %+v", cmd.DSP)
+	}
+	if len(cmd.DSP.Filters) != 1 || cmd.DSP.Filters[0] != (protocol.DSPFilter{Type: "peaking", Frequency: 60, Gain: -6, Q: 2}) {
+		t.Errorf("unexpected filters: %+v", cmd.DSP.Filters)
+	}
+
+	conn.Close()
+	time.Sleep(100 * time.Millisecond)
+
+	server.Stop()
+	select {
+	case <-errChan:
+	case <-time.After(5 * time.Second):
+		t.Error("server did not stop within timeout")
+	}
+}
+
+func TestServerProtocolErrors(t *testing.T) {
+	server, err := NewServer(ServerConfig{
+		Port:   8950,
+		Name:   "Test Server",
+		Source: NewTestTone(48000, 2),
+	})
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	go server.Start()
+	defer server.Stop()
+	time.Sleep(200 * time.Millisecond)
+
+	dial := func(hello protocol.ClientHello) *websocket.Conn {
+		t.Helper()
+		conn, _, err := websocket.DefaultDialer.Dial("ws://localhost:8950/sendspin", nil)
+		if err != nil {
+			t.Fatalf("failed to connect to server: %v", err)
+		}
+		if err := conn.WriteJSON(protocol.Message{Type: "client/hello", Payload: hello}); err != nil {
+			t.Fatalf("failed to send hello: %v", err)
+		}
+		return conn
+	}
+	errorCode := func(conn *websocket.Conn) string {
+		t.Helper()
+		var e protocol.Error
+		if err := protocol.DecodePayload(readUntil(t, conn, "server/error").Payload, &e); err != nil {
+			t.Fatalf("invalid server/error: %v", err)
+		}
+		return e.Code
+	}
+
+	// Hellos that can't be accepted are refused with a reason
+	refusals := []struct {
+		name  string
+		hello protocol.ClientHello
+		want  string
+	}{
+		{"no version", protocol.ClientHello{ClientID: "old", Name: "Old", SupportedRoles: []string{"player"}}, protocol.ErrorUnsupportedVersion},
+		{"no name", protocol.ClientHello{ClientID: "anon", Version: 1, SupportedRoles: []string{"player"}}, protocol.ErrorInvalidMessage},
+		{"support without role", protocol.ClientHello{
+			ClientID: "odd", Name: "Odd", Version: 1,
+			SupportedRoles: []string{"controller"},
+			PlayerSupport:  &protocol.PlayerSupport{},
+		}, protocol.ErrorInvalidMessage},
+	}
+	for _, r := range refusals {
+		conn := dial(r.hello)
+		if got := errorCode(conn); got != r.want {
+			t.Errorf("%s: expected %s, got %s", r.name, r.want, got)
+		}
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		if _, _, err := conn.ReadMessage(); err == nil {
+			t.Errorf("%s: expected the connection to close", r.name)
+		}
+		conn.Close()
+	}
+
+	// A newer client is answered with the version and features in common
+	conn := dial(protocol.ClientHello{
+		ClientID:       "future",
+		Name:           "Future Client",
+		Version:        protocol.Version + 1,
+		SupportedRoles: []string{"metadata"},
+		Features:       []string{protocol.FeatureErrors, "from_the_future"},
+	})
+	defer conn.Close()
+
+	var serverHello protocol.ServerHello
+	if err := protocol.DecodePayload(readUntil(t, conn, "server/hello").Payload, &serverHello); err != nil {
+		t.Fatalf("invalid server/hello: %v", err)
+	}
+	if serverHello.Version != protocol.Version {
+		t.Errorf("expected version %d, got %d", protocol.Version, serverHello.Version)
+	}
+	want := []string{protocol.FeatureErrors}
+	if fmt.Sprint(serverHello.Features) != fmt.Sprint(want) {
+		t.Errorf("expected features %v, got %v", want, serverHello.Features)
+	}
+	if clients := server.Clients(); len(clients) != 1 || fmt.Sprint(clients[0].Features) != fmt.Sprint(want) {
+		t.Errorf("expected one client with features %v, got %+v", want, clients)
+	}
+
+	// Later problems are reported without closing the connection
+	messages := []struct {
+		msg  protocol.Message
+		want string
+	}{
+		{protocol.Message{Type: "client/teleport", Payload: struct{}{}}, protocol.ErrorUnknownMessage},
+		{protocol.Message{Type: "player/update", Payload: protocol.ClientState{State: "idle", Volume: 50}}, protocol.ErrorNotPermitted},
+		{protocol.Message{Type: "client/command", Payload: protocol.ClientCommand{Command: "next"}}, protocol.ErrorNotPermitted},
+		{protocol.Message{Type: "client/time", Payload: map[string]any{"client_transmitted": "soon"}}, protocol.ErrorInvalidMessage},
+	}
+	for _, m := range messages {
+		if err := conn.WriteJSON(m.msg); err != nil {
+			t.Fatalf("failed to send %s: %v", m.msg.Type, err)
+		}
+		if got := errorCode(conn); got != m.want {
+			t.Errorf("%s: expected %s, got %s", m.msg.Type, m.want, got)
+		}
+	}
+
+	// client/error is logged, never answered
+	conn.WriteJSON(protocol.Message{Type: "client/error", Payload: protocol.Error{Code: protocol.ErrorUnsupportedCommand, Reason: "test"}})
+	conn.WriteJSON(protocol.Message{Type: "client/time", Payload: protocol.ClientTime{ClientTransmitted: 1}})
+	conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	for {
+		var msg protocol.Message
+		if err := conn.ReadJSON(&msg); err != nil {
+			t.Fatalf("failed waiting for server/time: %v", err)
+		}
+		if msg.Type == "server/error" {
+			t.Fatal("expected client/error not to be answered")
+		}
+		if msg.Type == "server/time" {
+			break
+		}
+	}
+}
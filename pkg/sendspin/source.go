@@ -3,8 +3,16 @@
 package sendspin
 
 import (
+	"encoding/binary"
+	"fmt"
+	"io"
 	"math"
+	"strings"
 	"sync"
+	"time"
+
+	"github.com/Sendspin/sendspin-go/pkg/audio"
+	"github.com/Sendspin/sendspin-go/pkg/audio/loudness"
 )
 
 // AudioSource provides PCM audio samples for streaming
@@ -26,6 +34,46 @@ type AudioSource interface {
 	Close() error
 }
 
+// Seekable is implemented by audio sources that support random access.
+// The server uses it to seek on request and to report track progress.
+type Seekable interface {
+	// Seek moves playback to the given position from the start of the track
+	Seek(position time.Duration) error
+
+	// Position returns the position of the next sample Read will return
+	Position() time.Duration
+
+	// Duration returns the track length, or 0 if unknown
+	Duration() time.Duration
+}
+
+// Pausable is implemented by audio sources that need to know when the
+// group pauses, such as live inputs that would otherwise keep buffering.
+// The server stops reading from every source while the group is paused.
+type Pausable interface {
+	// Pause is called once every player in the group has paused
+	Pause() error
+
+	// Resume is called when any player starts playing again
+	Resume() error
+}
+
+// LoudnessTagged is implemented by sources that know their loudness, such
+// as files with ReplayGain tags. The server uses it for normalization.
+type LoudnessTagged interface {
+	// Loudness returns the source's ReplayGain values; ok is false if the
+	// source has none
+	Loudness() (info loudness.Info, ok bool)
+}
+
+// FileBacked is implemented by sources read from a local file. When
+// normalization is on and the file has no loudness tags, the server
+// analyzes it in the background.
+type FileBacked interface {
+	// Path returns the file the source reads
+	Path() string
+}
+
 // TestToneSource generates a 440Hz test tone for testing
 type TestToneSource struct {
 	sampleIndex uint64
@@ -86,20 +134,153 @@ func (s *TestToneSource) Metadata() (string, string, string) {
 }
 func (s *TestToneSource) Close() error { return nil }
 
-// FileSource streams audio from a file
-// Note: This is a placeholder - users should use server.NewAudioSource() for file streaming
-// which supports MP3, FLAC, and other formats
-type FileSource struct {
-	// This is intentionally not implemented in the public API yet
-	// Users can use internal/server.NewAudioSource() for now
-	// TODO: Move file source implementations to pkg/audio/decode
-}
-
 // NewFileSource creates an audio source from a file
-// Supported formats: MP3, FLAC
+// Supported formats: MP3, FLAC, WAV
+// File sources implement Seekable, FileBacked and LoudnessTagged.
 // Returns an error if the file cannot be opened or decoded
 func NewFileSource(path string) (AudioSource, error) {
-	// For now, we use the internal implementation
-	// TODO: Migrate file sources to pkg/audio/decode
-	return nil, nil
+	if path == "" {
+		return nil, fmt.Errorf("file path is required")
+	}
+	return openSource(path)
+}
+
+// NewURLSource creates an audio source streaming from an HTTP(S) URL.
+// MP3 streams are decoded directly; HLS (.m3u8) streams need ffmpeg.
+func NewURLSource(url string) (AudioSource, error) {
+	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+		return nil, fmt.Errorf("not an HTTP(S) URL: %s", url)
+	}
+	return openSource(url)
+}
+
+// pipeBuffer is how much audio a PipeSource reads ahead of the stream
+const pipeBuffer = time.Second
+
+// PipeSource reads raw interleaved little-endian signed PCM from a
+// reader, such as stdin fed by another program. The reader is read on its
+// own goroutine, so Read never waits on a quiet pipe.
+type PipeSource struct {
+	closer     io.Closer
+	sampleRate int
+	channels   int
+	bitDepth   int
+
+	mu      sync.Mutex
+	room    *sync.Cond // Signalled when Read consumes pending or on Close
+	pending []byte     // Read ahead of the stream, at most pipeBuffer
+	limit   int        // Bytes in pipeBuffer
+	err     error      // Why reading stopped
+	closed  bool
+}
+
+// NewPipeSource creates a source reading PCM from r at the given sample
+// rate, channel count and bit depth (16, 24 or 32). Read returns what has
+// arrived padded with silence, and io.EOF once r has ended and been read
+// out; Close closes r if it is an io.Closer.
+func NewPipeSource(r io.Reader, sampleRate, channels, bitDepth int) (*PipeSource, error) {
+	if sampleRate <= 0 {
+		return nil, fmt.Errorf("invalid sample rate: %d", sampleRate)
+	}
+	if channels < 1 || channels > audio.MaxChannels {
+		return nil, fmt.Errorf("channels must be between 1 and %d, got %d", audio.MaxChannels, channels)
+	}
+	if bitDepth != 16 && bitDepth != 24 && bitDepth != 32 {
+		return nil, fmt.Errorf("unsupported bit depth %d (supported: 16, 24, 32)", bitDepth)
+	}
+
+	closer, _ := r.(io.Closer)
+	s := &PipeSource{
+		closer:     closer,
+		sampleRate: sampleRate,
+		channels:   channels,
+		bitDepth:   bitDepth,
+		limit:      int(pipeBuffer.Seconds()*float64(sampleRate)) * channels * bitDepth / 8,
+	}
+	s.room = sync.NewCond(&s.mu)
+	go s.readPipe(r)
+	return s, nil
+}
+
+// readPipe reads r into pending until it ends or the source is closed,
+// waiting while a second of audio is pending
+func (s *PipeSource) readPipe(r io.Reader) {
+	chunk := make([]byte, 4096)
+	for {
+		s.mu.Lock()
+		for len(s.pending) >= s.limit && !s.closed {
+			s.room.Wait()
+		}
+		want := min(len(chunk), s.limit-len(s.pending))
+		closed := s.closed
+		s.mu.Unlock()
+		if closed {
+			return
+		}
+
+		n, err := r.Read(chunk[:want])
+		s.mu.Lock()
+		s.pending = append(s.pending, chunk[:n]...)
+		if err != nil {
+			s.err = err
+		}
+		s.mu.Unlock()
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (s *PipeSource) Read(samples []int32) (int, error) {
+	width := s.bitDepth / 8
+	frameSize := s.channels * width
+	frames := len(samples) / s.channels
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Whole frames only; a trailing partial frame at the end is dropped
+	n := min(len(s.pending)-len(s.pending)%frameSize, frames*frameSize)
+	count := n / width
+	for i := 0; i < count; i++ {
+		b := s.pending[i*width:]
+		switch s.bitDepth {
+		case 16:
+			samples[i] = int32(int16(binary.LittleEndian.Uint16(b))) << 8
+		case 24:
+			samples[i] = int32(uint32(b[0])<<8|uint32(b[1])<<16|uint32(b[2])<<24) >> 8
+		case 32:
+			samples[i] = int32(binary.LittleEndian.Uint32(b)) >> 8
+		}
+	}
+	s.pending = s.pending[:copy(s.pending, s.pending[n:])]
+	s.room.Signal()
+
+	// Once the pipe has ended, what is left is returned as is
+	if s.err != nil {
+		if count == 0 {
+			return 0, s.err
+		}
+		return count, nil
+	}
+
+	// A quiet pipe plays silence until more arrives
+	clear(samples[count : frames*s.channels])
+	return frames * s.channels, nil
+}
+
+func (s *PipeSource) SampleRate() int { return s.sampleRate }
+func (s *PipeSource) Channels() int   { return s.channels }
+func (s *PipeSource) Metadata() (string, string, string) {
+	return "Pipe", "", ""
+}
+func (s *PipeSource) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	s.room.Broadcast()
+	s.mu.Unlock()
+	if s.closer != nil {
+		return s.closer.Close()
+	}
+	return nil
 }
@@ -0,0 +1,134 @@
+// ABOUTME: Tests for the built-in audio sources
+// ABOUTME: Covers raw PCM read from a pipe, including a quiet one
+package sendspin
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestPipeSource(t *testing.T) {
+	tests := []struct {
+		name     string
+		bitDepth int
+		data     []byte
+		want     []int32
+	}{
+		{
+			name:     "16-bit",
+			bitDepth: 16,
+			data:     []byte{0x01, 0x00, 0xff, 0xff, 0x00, 0x80, 0xff, 0x7f},
+			want:     []int32{1 << 8, -1 << 8, -32768 << 8, 32767 << 8},
+		},
+		{
+			name:     "24-bit",
+			bitDepth: 24,
+			data:     []byte{0x01, 0x00, 0x00, 0xff, 0xff, 0xff, 0x00, 0x00, 0x80, 0xff, 0xff, 0x7f},
+			want:     []int32{1, -1, -8388608, 8388607},
+		},
+		{
+			name:     "32-bit",
+			bitDepth: 32,
+			data:     []byte{0x00, 0x01, 0x00, 0x00, 0x00, 0xff, 0xff, 0xff, 0x00, 0x00, 0x00, 0x80, 0x00, 0x00, 0x00, 0x40},
+			want:     []int32{1, -1, -8388608, 4194304},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// A trailing partial frame is dropped
+			data := append(tt.data, 0x01)
+			source, err := NewPipeSource(bytes.NewReader(data), 48000, 2, tt.bitDepth)
+			if err != nil {
+				t.Fatalf("NewPipeSource failed: %v", err)
+			}
+
+			// Silence pads reads until the data arrives
+			got, err := readPipe(t, source)
+			if !errors.Is(err, io.EOF) {
+				t.Errorf("expected io.EOF at the end, got %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("expected %v, got %v", tt.want, got)
+			}
+			for i, want := range tt.want {
+				if got[i] != want {
+					t.Errorf("sample %d: expected %d, got %d", i, want, got[i])
+				}
+			}
+		})
+	}
+
+	if _, err := NewPipeSource(bytes.NewReader(nil), 48000, 2, 8); err == nil {
+		t.Error("expected error for 8-bit samples")
+	}
+}
+
+// readPipe reads a pipe source to its end, dropping the silence padding
+// around the data
+func readPipe(t *testing.T, source *PipeSource) ([]int32, error) {
+	t.Helper()
+	var got []int32
+	deadline := time.Now().Add(3 * time.Second)
+	samples := make([]int32, 8)
+	for time.Now().Before(deadline) {
+		n, err := source.Read(samples)
+		if err != nil {
+			return got, err
+		}
+		for _, v := range samples[:n] {
+			if v != 0 || len(got) > 0 {
+				got = append(got, v)
+			}
+		}
+		for len(got) > 0 && got[len(got)-1] == 0 {
+			got = got[:len(got)-1]
+		}
+	}
+	t.Fatal("expected the pipe to end")
+	return nil, nil
+}
+
+func TestPipeSourceQuiet(t *testing.T) {
+	r, w := io.Pipe()
+	source, err := NewPipeSource(r, 48000, 2, 16)
+	if err != nil {
+		t.Fatalf("NewPipeSource failed: %v", err)
+	}
+
+	// Nothing written: Read returns silence instead of waiting
+	samples := []int32{1, 1, 1, 1}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if n, err := source.Read(samples); err != nil || n != 4 || samples[0] != 0 || samples[3] != 0 {
+			t.Errorf("expected 4 samples of silence, got %d %v (%v)", n, samples, err)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("expected Read not to block on a quiet pipe")
+	}
+
+	// Data written later is read, and Close ends a pipe that never does
+	go w.Write([]byte{0x01, 0x00, 0x02, 0x00})
+	deadline := time.Now().Add(3 * time.Second)
+	for samples[0] == 0 && time.Now().Before(deadline) {
+		if _, err := source.Read(samples); err != nil {
+			t.Fatalf("Read failed: %v", err)
+		}
+	}
+	if samples[0] != 1<<8 || samples[1] != 2<<8 {
+		t.Errorf("expected the written frame, got %v", samples)
+	}
+	if err := source.Close(); err != nil {
+		t.Errorf("Close failed: %v", err)
+	}
+	if _, err := w.Write([]byte{0}); !errors.Is(err, io.ErrClosedPipe) {
+		t.Errorf("expected the pipe to be closed, got %v", err)
+	}
+}
@@ -0,0 +1,55 @@
+// ABOUTME: Server status snapshots for displays such as the server TUI
+// ABOUTME: Reports clients and the source playing, and notifies OnStatusChange of changes
+package sendspin
+
+import (
+	"time"
+)
+
+// ServerStatus is a snapshot of a server's state
+type ServerStatus struct {
+	Name    string
+	Port    int
+	Uptime  time.Duration
+	Clients []ClientInfo
+
+	// The source playing
+	Title  string
+	Artist string
+	Album  string
+}
+
+// Status returns the server's current state
+func (s *Server) Status() ServerStatus {
+	title, artist, album := s.NowPlaying()
+	return ServerStatus{
+		Name:    s.config.Name,
+		Port:    s.config.Port,
+		Uptime:  time.Since(s.clockStart),
+		Clients: s.Clients(),
+		Title:   title,
+		Artist:  artist,
+		Album:   album,
+	}
+}
+
+// notifyStatus asks for OnStatusChange to be called; it never blocks
+func (s *Server) notifyStatus() {
+	select {
+	case s.statusChanged <- struct{}{}:
+	default:
+	}
+}
+
+// reportStatus calls OnStatusChange after each change until the server
+// stops
+func (s *Server) reportStatus() {
+	for {
+		select {
+		case <-s.statusChanged:
+			s.config.OnStatusChange(s.Status())
+		case <-s.stopChan:
+			return
+		}
+	}
+}
@@ -0,0 +1,84 @@
+// ABOUTME: Tests for server status snapshots
+// ABOUTME: Covers OnStatusChange as clients connect and disconnect
+package sendspin
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Sendspin/sendspin-go/pkg/protocol"
+	"github.com/gorilla/websocket"
+)
+
+func TestServerStatusChanges(t *testing.T) {
+	statuses := make(chan ServerStatus, 100)
+	server, err := NewServer(ServerConfig{
+		Port:           8947,
+		Name:           "Status Server",
+		Source:         NewTestTone(48000, 2),
+		OnStatusChange: func(status ServerStatus) { statuses <- status },
+	})
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- server.Start()
+	}()
+	time.Sleep(200 * time.Millisecond)
+
+	waitFor := func(clients int) ServerStatus {
+		t.Helper()
+		timeout := time.After(3 * time.Second)
+		for {
+			select {
+			case status := <-statuses:
+				if len(status.Clients) == clients {
+					return status
+				}
+			case <-timeout:
+				t.Fatalf("no status with %d clients", clients)
+			}
+		}
+	}
+
+	// The first report comes as the server starts
+	if status := waitFor(0); status.Name != "Status Server" || status.Port != 8947 || status.Title != "Test Tone" {
+		t.Errorf("unexpected initial status: %+v", status)
+	}
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws://localhost:8947/sendspin", nil)
+	if err != nil {
+		t.Fatalf("failed to connect to server: %v", err)
+	}
+	hello := protocol.Message{
+		Type: "client/hello",
+		Payload: protocol.ClientHello{
+			ClientID:       "status-player",
+			Name:           "Status Player",
+			Version:        1,
+			SupportedRoles: []string{"player"},
+			PlayerSupport: &protocol.PlayerSupport{SupportFormats: []protocol.AudioFormat{
+				{Codec: "pcm", Channels: 2, SampleRate: 48000, BitDepth: 24},
+			}},
+		},
+	}
+	if err := conn.WriteJSON(hello); err != nil {
+		t.Fatalf("failed to send hello: %v", err)
+	}
+
+	if status := waitFor(1); status.Clients[0].Name != "Status Player" || status.Clients[0].Codec != "pcm" {
+		t.Errorf("unexpected client: %+v", status.Clients[0])
+	}
+
+	conn.Close()
+	waitFor(0)
+
+	server.Stop()
+	select {
+	case <-errChan:
+	case <-time.After(5 * time.Second):
+		t.Error("server did not stop within timeout")
+	}
+}
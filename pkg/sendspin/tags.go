@@ -0,0 +1,220 @@
+// ABOUTME: ReplayGain tag reading for file sources
+// ABOUTME: Reads FLAC Vorbis comments and ID3v2 TXXX frames (MP3 and WAV)
+package sendspin
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/Sendspin/sendspin-go/pkg/audio/loudness"
+	"github.com/mewkiz/flac/meta"
+)
+
+// maxTagSize bounds how much tag data is read
+const maxTagSize = 16 << 20
+
+// replayGainFromTags converts tags to loudness info, or nil if there are
+// no ReplayGain tags
+func replayGainFromTags(tags map[string]string) *loudness.Info {
+	info, ok := loudness.ParseTags(tags)
+	if !ok {
+		return nil
+	}
+	return &info
+}
+
+// readFLACTags returns the Vorbis comments of a FLAC file, keyed by
+// upper-case field name
+func readFLACTags(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open FLAC file: %w", err)
+	}
+	defer f.Close()
+
+	// Files with a leading ID3 tag (non-standard) are rare; skip it
+	if _, err := f.Seek(id3v2Size(f), io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	r := bufio.NewReader(f)
+	var sig [4]byte
+	if _, err := io.ReadFull(r, sig[:]); err != nil || string(sig[:]) != "fLaC" {
+		return nil, fmt.Errorf("not a FLAC file")
+	}
+
+	tags := make(map[string]string)
+	for {
+		block, err := meta.New(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read FLAC metadata: %w", err)
+		}
+		if block.Type == meta.TypeVorbisComment {
+			if err := block.Parse(); err != nil {
+				return nil, fmt.Errorf("failed to read Vorbis comments: %w", err)
+			}
+			for _, tag := range block.Body.(*meta.VorbisComment).Tags {
+				tags[strings.ToUpper(tag[0])] = tag[1]
+			}
+		} else if err := block.Skip(); err != nil {
+			return nil, fmt.Errorf("failed to read FLAC metadata: %w", err)
+		}
+		if block.IsLast {
+			return tags, nil
+		}
+	}
+}
+
+// readWAVTags returns the ID3 TXXX tags from a WAV file's "id3 " chunk
+func readWAVTags(r io.ReaderAt) map[string]string {
+	tags := make(map[string]string)
+	offset := int64(12)
+	for {
+		var hdr [8]byte
+		if _, err := r.ReadAt(hdr[:], offset); err != nil {
+			return tags
+		}
+		size := int64(binary.LittleEndian.Uint32(hdr[4:8]))
+		if id := strings.ToLower(string(hdr[0:4])); id == "id3 " {
+			return readID3Tags(io.NewSectionReader(r, offset+8, size))
+		}
+		offset += 8 + size + size%2
+	}
+}
+
+// readID3Tags returns the user-defined text (TXXX) frames of an ID3v2 tag
+// at the start of r, keyed by upper-case description
+func readID3Tags(r io.ReaderAt) map[string]string {
+	tags := make(map[string]string)
+
+	size := id3v2Size(r)
+	if size <= 10 || size > maxTagSize {
+		return tags
+	}
+	data := make([]byte, size)
+	if n, err := r.ReadAt(data, 0); err != nil && n < 10 {
+		return tags
+	}
+
+	version := data[3]
+	flags := data[5]
+	body := data[10:]
+	if flags&0x80 != 0 && version < 4 {
+		// Tag-wide unsynchronisation (per-frame in v2.4)
+		body = unsynchronise(body)
+	}
+	if flags&0x40 != 0 && len(body) >= 4 {
+		// Skip the extended header
+		var ext int
+		if version >= 4 {
+			ext = syncsafe(body[0:4])
+		} else {
+			ext = int(binary.BigEndian.Uint32(body[0:4])) + 4
+		}
+		if ext > len(body) {
+			return tags
+		}
+		body = body[ext:]
+	}
+
+	idLen, headerLen := 4, 10
+	userText := "TXXX"
+	if version == 2 {
+		idLen, headerLen = 3, 6
+		userText = "TXX"
+	}
+
+	for len(body) >= headerLen && body[0] != 0 {
+		id := string(body[:idLen])
+		var frameSize int
+		switch version {
+		case 2:
+			frameSize = int(body[3])<<16 | int(body[4])<<8 | int(body[5])
+		case 3:
+			frameSize = int(binary.BigEndian.Uint32(body[4:8]))
+		default:
+			frameSize = syncsafe(body[4:8])
+		}
+		if frameSize < 0 || headerLen+frameSize > len(body) {
+			break
+		}
+		frame := body[headerLen : headerLen+frameSize]
+		if version >= 4 && body[9]&0x02 != 0 {
+			frame = unsynchronise(frame)
+		}
+		body = body[headerLen+frameSize:]
+
+		if id != userText || len(frame) < 2 {
+			continue
+		}
+		parts := decodeID3Text(frame[0], frame[1:])
+		if len(parts) >= 2 {
+			tags[strings.ToUpper(parts[0])] = parts[1]
+		}
+	}
+	return tags
+}
+
+// syncsafe decodes a 28-bit syncsafe integer
+func syncsafe(b []byte) int {
+	return int(b[0]&0x7f)<<21 | int(b[1]&0x7f)<<14 | int(b[2]&0x7f)<<7 | int(b[3]&0x7f)
+}
+
+// unsynchronise removes the 0x00 inserted after every 0xFF
+func unsynchronise(b []byte) []byte {
+	out := make([]byte, 0, len(b))
+	for i := 0; i < len(b); i++ {
+		out = append(out, b[i])
+		if b[i] == 0xff && i+1 < len(b) && b[i+1] == 0 {
+			i++
+		}
+	}
+	return out
+}
+
+// decodeID3Text splits a text frame body into its null-separated strings
+func decodeID3Text(encoding byte, b []byte) []string {
+	switch encoding {
+	case 1, 2: // UTF-16 with BOM, UTF-16BE
+		var parts []string
+		bigEndian := encoding == 2
+		var units []uint16
+		flush := func() {
+			parts = append(parts, string(utf16.Decode(units)))
+			units = units[:0]
+		}
+		for i := 0; i+1 < len(b); i += 2 {
+			u := binary.LittleEndian.Uint16(b[i:])
+			if bigEndian {
+				u = binary.BigEndian.Uint16(b[i:])
+			}
+			switch {
+			case u == 0xfeff && len(units) == 0:
+				// BOM in our byte order
+			case u == 0xfffe && len(units) == 0:
+				bigEndian = !bigEndian
+			case u == 0:
+				flush()
+			default:
+				units = append(units, u)
+			}
+		}
+		if len(units) > 0 {
+			flush()
+		}
+		return parts
+	case 0: // ISO-8859-1
+		runes := make([]rune, len(b))
+		for i, c := range b {
+			runes[i] = rune(c)
+		}
+		return strings.Split(strings.TrimRight(string(runes), "\x00"), "\x00")
+	default: // UTF-8
+		return strings.Split(strings.TrimRight(string(b), "\x00"), "\x00")
+	}
+}
@@ -0,0 +1,158 @@
+// ABOUTME: Tests for ReplayGain tag reading
+// ABOUTME: Builds ID3v2 tags and FLAC Vorbis comments and checks the parsed gains
+package sendspin
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/mewkiz/flac/meta"
+)
+
+// id3Frame builds an ID3v2.3/2.4 frame
+func id3Frame(version byte, id string, body []byte) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(id)
+	size := len(body)
+	if version >= 4 {
+		buf.Write([]byte{byte(size >> 21 & 0x7f), byte(size >> 14 & 0x7f), byte(size >> 7 & 0x7f), byte(size & 0x7f)})
+	} else {
+		binary.Write(&buf, binary.BigEndian, uint32(size))
+	}
+	buf.Write([]byte{0, 0})
+	buf.Write(body)
+	return buf.Bytes()
+}
+
+// id3Tag wraps frames in an ID3v2 header with some padding
+func id3Tag(version byte, frames ...[]byte) []byte {
+	body := bytes.Join(frames, nil)
+	body = append(body, make([]byte, 32)...)
+	size := len(body)
+	hdr := []byte{'I', 'D', '3', version, 0, 0,
+		byte(size >> 21 & 0x7f), byte(size >> 14 & 0x7f), byte(size >> 7 & 0x7f), byte(size & 0x7f)}
+	return append(hdr, body...)
+}
+
+// utf16Text encodes strings as null-terminated UTF-16LE with BOMs
+func utf16Text(parts ...string) []byte {
+	var buf bytes.Buffer
+	for _, p := range parts {
+		buf.Write([]byte{0xff, 0xfe})
+		for _, u := range utf16.Encode([]rune(p)) {
+			binary.Write(&buf, binary.LittleEndian, u)
+		}
+		buf.Write([]byte{0, 0})
+	}
+	return buf.Bytes()
+}
+
+func TestReadID3Tags(t *testing.T) {
+	for _, version := range []byte{3, 4} {
+		tag := id3Tag(version,
+			id3Frame(version, "TIT2", append([]byte{0}, "Title"...)),
+			id3Frame(version, "TXXX", append([]byte{0}, "replaygain_track_gain\x00-7.25 dB"...)),
+			id3Frame(version, "TXXX", append([]byte{3}, "REPLAYGAIN_TRACK_PEAK\x000.95"...)),
+			id3Frame(version, "TXXX", append([]byte{1}, utf16Text("REPLAYGAIN_ALBUM_GAIN", "-5.5 dB")...)),
+		)
+
+		tags := readID3Tags(bytes.NewReader(append(tag, 0xff, 0xfb)))
+		want := map[string]string{
+			"REPLAYGAIN_TRACK_GAIN": "-7.25 dB",
+			"REPLAYGAIN_TRACK_PEAK": "0.95",
+			"REPLAYGAIN_ALBUM_GAIN": "-5.5 dB",
+		}
+		for k, v := range want {
+			if tags[k] != v {
+				t.Errorf("v2.%d %s: got %q, want %q", version, k, tags[k], v)
+			}
+		}
+
+		info := replayGainFromTags(tags)
+		if info == nil || info.Track.Gain != -7.25 || info.Track.Peak != 0.95 || info.Album.Gain != -5.5 {
+			t.Errorf("v2.%d: unexpected loudness %+v", version, info)
+		}
+	}
+
+	if tags := readID3Tags(bytes.NewReader([]byte{0xff, 0xfb, 0x90, 0})); len(tags) != 0 {
+		t.Errorf("expected no tags without an ID3 header, got %v", tags)
+	}
+}
+
+func TestWAVSourceReplayGain(t *testing.T) {
+	path := writeTestWAV(t, 8000, 800)
+
+	// Append an "id3 " chunk after the data
+	tag := id3Tag(3, id3Frame(3, "TXXX", append([]byte{0}, "REPLAYGAIN_TRACK_GAIN\x00+2.00 dB"...)))
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatalf("failed to open WAV: %v", err)
+	}
+	f.WriteString("id3 ")
+	binary.Write(f, binary.LittleEndian, uint32(len(tag)))
+	f.Write(tag)
+	f.Close()
+
+	src, err := NewWAVSource(path)
+	if err != nil {
+		t.Fatalf("NewWAVSource failed: %v", err)
+	}
+	defer src.Close()
+
+	info, ok := src.Loudness()
+	if !ok || info.Track == nil || info.Track.Gain != 2 {
+		t.Errorf("expected +2dB track gain, got %+v, %v", info, ok)
+	}
+	if src.Path() != path {
+		t.Errorf("expected path %s, got %s", path, src.Path())
+	}
+
+	untagged, err := NewWAVSource(writeTestWAV(t, 8000, 800))
+	if err != nil {
+		t.Fatalf("NewWAVSource failed: %v", err)
+	}
+	defer untagged.Close()
+	if _, ok := untagged.Loudness(); ok {
+		t.Error("expected no loudness for an untagged file")
+	}
+}
+
+func TestFLACSourceReplayGain(t *testing.T) {
+	tags := [][2]string{
+		{"TITLE", "Ramp"},
+		{"replaygain_album_gain", "-3.10 dB"},
+		{"replaygain_album_peak", "0.5"},
+	}
+	// The encoder writes an empty block when the length is zero
+	length := int64(4 + len("test") + 4)
+	for _, tag := range tags {
+		length += int64(4 + len(tag[0]) + 1 + len(tag[1]))
+	}
+	comments := &meta.Block{
+		Header: meta.Header{Type: meta.TypeVorbisComment, Length: length},
+		Body: &meta.VorbisComment{
+			Vendor: "test",
+			Tags:   tags,
+		},
+	}
+	path := writeTestFLAC(t, 44100, 4096, 2, comments)
+
+	src, err := NewFLACSource(path)
+	if err != nil {
+		t.Fatalf("NewFLACSource failed: %v", err)
+	}
+	defer src.Close()
+
+	info, ok := src.Loudness()
+	if !ok || info.Album == nil || info.Album.Gain != -3.1 || info.Album.Peak != 0.5 || info.Track != nil {
+		t.Errorf("expected album gain from Vorbis comments, got %+v, %v", info, ok)
+	}
+
+	if _, err := readFLACTags(filepath.Join(t.TempDir(), "missing.flac")); err == nil {
+		t.Error("expected error for missing file")
+	}
+}
@@ -0,0 +1,379 @@
+// ABOUTME: Source changes in the server's streaming loop
+// ABOUTME: Queues sources and joins them gaplessly or with equal-power crossfades
+package sendspin
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"github.com/Sendspin/sendspin-go/pkg/audio"
+	"github.com/Sendspin/sendspin-go/pkg/audio/loudness"
+)
+
+// MaxCrossfade is the longest supported crossfade
+const MaxCrossfade = 12 * time.Second
+
+// limitKnee is where the crossfade mix starts soft limiting (about -1dBFS)
+const limitKnee = audio.Max24Bit * 9 / 10
+
+// crossfade mixes the tail of the outgoing source into the incoming one
+type crossfade struct {
+	from   AudioSource
+	length int     // Frames in the fade
+	pos    int     // Frames mixed so far
+	buf    []int32 // Outgoing audio for the current read
+}
+
+// sourceChange records a source change within a chunk
+type sourceChange struct {
+	offset        int           // Frames of the chunk before the new source starts
+	position      time.Duration // New source's position where it starts
+	formatChanged bool          // Sample rate or channel count differs
+}
+
+// SetSource switches to a new source with the next chunk. It crossfades
+// from the current source when ServerConfig.Crossfade is set and both
+// share a sample rate and channel count; a different format is sent to
+// players as a new stream/start, which drops audio they have buffered.
+// The replaced source is closed. Queued sources still play afterwards.
+func (s *Server) SetSource(source AudioSource) error {
+	if err := checkSource(source); err != nil {
+		return err
+	}
+
+	s.sourceMu.Lock()
+	defer s.sourceMu.Unlock()
+
+	if s.pending != nil {
+		closeSource(s.pending)
+	}
+	s.pending = source
+	return nil
+}
+
+// checkSource rejects sources the server can't stream
+func checkSource(source AudioSource) error {
+	if source == nil {
+		return fmt.Errorf("audio source is required")
+	}
+	if channels := source.Channels(); channels < 1 || channels > audio.MaxChannels {
+		return fmt.Errorf("audio source has %d channels (supported: 1-%d)", channels, audio.MaxChannels)
+	}
+	return nil
+}
+
+// Enqueue adds a source to play after the current one and any already
+// queued. Seekable sources with a known duration hand over to the next
+// source at their end (crossfading if configured); other sources hand
+// over once Read returns an error such as io.EOF. File sources keep
+// looping while the queue is empty.
+func (s *Server) Enqueue(source AudioSource) error {
+	if err := checkSource(source); err != nil {
+		return err
+	}
+
+	s.sourceMu.Lock()
+	defer s.sourceMu.Unlock()
+
+	s.queue = append(s.queue, source)
+	return nil
+}
+
+// Next skips to the next queued source, crossfading if configured.
+// Returns an error if the queue is empty.
+func (s *Server) Next() error {
+	s.sourceMu.Lock()
+	defer s.sourceMu.Unlock()
+
+	if len(s.queue) == 0 {
+		return fmt.Errorf("queue is empty")
+	}
+	if s.pending != nil {
+		closeSource(s.pending)
+	}
+	s.pending = s.queue[0]
+	s.queue = s.queue[1:]
+	return nil
+}
+
+// ClearQueue closes and removes the sources waiting to play. The current
+// source and a pending SetSource are kept.
+func (s *Server) ClearQueue() {
+	s.sourceMu.Lock()
+	defer s.sourceMu.Unlock()
+
+	for _, source := range s.queue {
+		closeSource(source)
+	}
+	s.queue = nil
+}
+
+// Queued returns the number of sources waiting to play
+func (s *Server) Queued() int {
+	s.sourceMu.Lock()
+	defer s.sourceMu.Unlock()
+	return len(s.queue)
+}
+
+// readSource fills samples from the current source, changing sources
+// where one is pending or the queue is due to advance. A format change
+// ends the chunk early, since the rest of the chunk would be in the new
+// format. Called with sourceMu held.
+func (s *Server) readSource(samples []int32) (int, *sourceChange, error) {
+	channels := s.audioSource.Channels()
+	frames := len(samples) / channels
+
+	var change *sourceChange
+	filled := 0
+	for filled < frames {
+		want := frames - filled
+		advance := false
+		if s.pending == nil {
+			if until := s.framesUntilAdvance(); until == 0 {
+				s.pending = s.queue[0]
+				s.queue = s.queue[1:]
+			} else if until > 0 && until <= want {
+				// Stop reading where the next source takes over. Sources
+				// may loop back to the start on reaching the end, so
+				// advance on reading up to it rather than by position.
+				want = until
+				advance = true
+			}
+		}
+		if s.pending != nil {
+			change = s.changeSource(filled)
+			if change.formatChanged {
+				return filled * channels, change, nil
+			}
+			continue
+		}
+
+		chunk := samples[filled*channels : (filled+want)*channels]
+		n, err := s.audioSource.Read(chunk)
+		got := n / channels
+		if s.fade != nil && got > 0 {
+			if s.fade.mix(chunk[:got*channels], channels) {
+				s.endCrossfade()
+			}
+		}
+		filled += got
+
+		if advance && got == want {
+			s.pending = s.queue[0]
+			s.queue = s.queue[1:]
+			continue
+		}
+		if err != nil || got == 0 {
+			if len(s.queue) > 0 {
+				// The source ended; the next one starts right after it
+				s.pending = s.queue[0]
+				s.queue = s.queue[1:]
+				continue
+			}
+			return filled * channels, change, err
+		}
+	}
+	return filled * channels, change, nil
+}
+
+// framesUntilAdvance returns how many more frames the current source
+// plays before the queue advances, or -1 if that is only known once the
+// source ends (empty queue, or no known duration)
+func (s *Server) framesUntilAdvance() int {
+	if len(s.queue) == 0 {
+		return -1
+	}
+	remaining, ok := remainingFrames(s.audioSource)
+	if !ok {
+		return -1
+	}
+	if !formatChanges(s.audioSource, s.queue[0]) {
+		// The next source starts while this one fades out
+		remaining -= s.crossfadeFrames()
+	}
+	return max(remaining, 0)
+}
+
+// changeSource replaces the current source with the pending one, starting
+// a crossfade from the current source if possible
+func (s *Server) changeSource(offset int) *sourceChange {
+	next, prev := s.pending, s.audioSource
+	s.pending = nil
+
+	change := &sourceChange{offset: offset, formatChanged: formatChanges(prev, next)}
+	if seekable, ok := next.(Seekable); ok {
+		change.position = seekable.Position()
+	}
+
+	// A change during a crossfade cuts the older outgoing source
+	s.endCrossfade()
+
+	length := 0
+	if !change.formatChanged {
+		length = s.crossfadeFrames()
+		if remaining, ok := remainingFrames(prev); ok {
+			length = min(length, remaining)
+		}
+	}
+	if length > 0 {
+		s.fade = &crossfade{from: prev, length: length}
+	} else {
+		closeSource(prev)
+	}
+	s.audioSource = next
+	metadata := s.streamMetadata()
+	s.nowPlaying.Store(&metadata)
+	s.notifyStatus()
+
+	title, artist, _ := next.Metadata()
+	if length > 0 {
+		log.Printf("Crossfading to %s - %s", artist, title)
+	} else {
+		log.Printf("Now playing %s - %s (%dHz/%dch)", artist, title, next.SampleRate(), next.Channels())
+	}
+	return change
+}
+
+// sourceChanged updates per-source processing once a chunk spanning a
+// source change has been read and normalized (called with sourceMu held)
+func (s *Server) sourceChanged(change *sourceChange) {
+	if change.formatChanged && s.normalizer != nil {
+		s.normalizer = loudness.NewNormalizer(s.config.Normalization, s.config.NormalizationTarget,
+			s.audioSource.SampleRate(), s.audioSource.Channels())
+	}
+	s.prepareLoudness()
+}
+
+// announceSource tells players about a new source after the chunk in
+// which it started, restarting their streams if the format changed.
+// Called with sourceMu and clientsMu held.
+func (s *Server) announceSource(change *sourceChange) {
+	metadata := s.streamMetadata()
+	for _, c := range s.clients {
+		if !s.hasRole(c, "player") {
+			continue
+		}
+		if change.formatChanged {
+			s.configureStream(c)
+		}
+		c.conn.SendMetadata(metadata)
+	}
+}
+
+// crossfadeFrames converts the configured crossfade to frames of the
+// current source
+func (s *Server) crossfadeFrames() int {
+	return durationToFrames(s.config.Crossfade, s.audioSource.SampleRate())
+}
+
+// endCrossfade closes the outgoing source of a crossfade in progress
+func (s *Server) endCrossfade() {
+	if s.fade != nil {
+		closeSource(s.fade.from)
+		s.fade = nil
+	}
+}
+
+// closeSources closes the current, outgoing, pending and queued sources
+func (s *Server) closeSources() {
+	s.endCrossfade()
+	closeSource(s.audioSource)
+	if s.pending != nil {
+		closeSource(s.pending)
+		s.pending = nil
+	}
+	for _, source := range s.queue {
+		closeSource(source)
+	}
+	s.queue = nil
+}
+
+// closeSource closes a source, logging failures
+func closeSource(source AudioSource) {
+	if err := source.Close(); err != nil {
+		log.Printf("Error closing audio source: %v", err)
+	}
+}
+
+// formatChanges reports whether two sources differ in sample rate or
+// channel count, so they cannot be mixed or joined in one stream
+func formatChanges(a, b AudioSource) bool {
+	return a.SampleRate() != b.SampleRate() || a.Channels() != b.Channels()
+}
+
+// remainingFrames returns the frames left before a source ends, if its
+// duration is known
+func remainingFrames(source AudioSource) (int, bool) {
+	seekable, ok := source.(Seekable)
+	if !ok || seekable.Duration() <= 0 {
+		return 0, false
+	}
+	rate := source.SampleRate()
+	return max(durationToFrames(seekable.Duration(), rate)-durationToFrames(seekable.Position(), rate), 0), true
+}
+
+// durationToFrames converts a duration to the nearest frame count
+func durationToFrames(d time.Duration, sampleRate int) int {
+	return int((int64(d)*int64(sampleRate) + int64(time.Second)/2) / int64(time.Second))
+}
+
+// mix reads the outgoing source and mixes it into samples, which hold the
+// incoming source, returning true once the fade is complete. Frames past
+// the end of the fade are left as they are.
+func (f *crossfade) mix(samples []int32, channels int) bool {
+	frames := min(len(samples)/channels, f.length-f.pos)
+	if cap(f.buf) < frames*channels {
+		f.buf = make([]int32, frames*channels)
+	}
+	out := f.buf[:frames*channels]
+
+	// An outgoing source that ends early fades out from silence
+	n, _ := f.from.Read(out)
+	clear(out[max(n, 0):])
+
+	for i := 0; i < frames; i++ {
+		gainOut, gainIn := equalPowerGains(f.pos, f.length)
+		for ch := 0; ch < channels; ch++ {
+			j := i*channels + ch
+			samples[j] = mixSamples(out[j], samples[j], gainOut, gainIn)
+		}
+		f.pos++
+	}
+	return f.pos >= f.length
+}
+
+// equalPowerGains returns the outgoing and incoming gains (Q16 fixed
+// point) at a frame of a fade. Following a quarter cosine and sine keeps
+// the summed power constant for uncorrelated material.
+func equalPowerGains(pos, length int) (out, in int64) {
+	theta := (float64(pos) + 0.5) / float64(length) * math.Pi / 2
+	return int64(math.Round(math.Cos(theta) * 65536)), int64(math.Round(math.Sin(theta) * 65536))
+}
+
+// mixSamples sums two 24-bit samples with Q16 gains. The sum may exceed
+// the 24-bit range (int32 leaves 8 bits of headroom) and is soft limited
+// back into it.
+func mixSamples(a, b int32, gainA, gainB int64) int32 {
+	return softLimit(int32((int64(a)*gainA + int64(b)*gainB) >> 16))
+}
+
+// softLimit passes samples below limitKnee unchanged and compresses
+// louder ones smoothly so they never exceed full scale
+func softLimit(x int32) int32 {
+	mag := x
+	if mag < 0 {
+		mag = -mag
+	}
+	if mag <= limitKnee {
+		return x
+	}
+
+	span := float64(audio.Max24Bit - limitKnee)
+	y := int32(float64(limitKnee) + span*math.Tanh(float64(mag-limitKnee)/span))
+	if x < 0 {
+		return -y
+	}
+	return y
+}
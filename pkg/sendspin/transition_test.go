@@ -0,0 +1,351 @@
+// ABOUTME: Tests for source changes in the streaming loop
+// ABOUTME: Covers gapless queue joins, equal-power crossfades and format changes
+package sendspin
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/Sendspin/sendspin-go/pkg/audio"
+	"github.com/Sendspin/sendspin-go/pkg/protocol"
+	"github.com/gorilla/websocket"
+)
+
+// rampSource is a seekable, looping source whose samples encode the frame
+// index (base + step*frame), so tests can tell exactly what was played
+type rampSource struct {
+	title      string
+	base, step int32
+	frames     int
+	pos        int
+	rate       int
+	channels   int
+	closed     bool
+}
+
+func newRampSource(title string, base, step int32, frames, rate int) *rampSource {
+	return &rampSource{title: title, base: base, step: step, frames: frames, rate: rate, channels: 2}
+}
+
+func (s *rampSource) Read(samples []int32) (int, error) {
+	for i := 0; i+s.channels <= len(samples); i += s.channels {
+		for ch := 0; ch < s.channels; ch++ {
+			samples[i+ch] = s.base + s.step*int32(s.pos)
+		}
+		s.pos = (s.pos + 1) % s.frames
+	}
+	return len(samples) / s.channels * s.channels, nil
+}
+
+func (s *rampSource) SampleRate() int { return s.rate }
+func (s *rampSource) Channels() int   { return s.channels }
+func (s *rampSource) Metadata() (string, string, string) {
+	return s.title, "Test", "Ramps"
+}
+func (s *rampSource) Close() error {
+	s.closed = true
+	return nil
+}
+
+func (s *rampSource) Seek(position time.Duration) error {
+	s.pos = durationToFrames(position, s.rate)
+	return nil
+}
+
+func (s *rampSource) Position() time.Duration {
+	return time.Duration(int64(s.pos) * int64(time.Second) / int64(s.rate))
+}
+
+func (s *rampSource) Duration() time.Duration {
+	return time.Duration(int64(s.frames) * int64(time.Second) / int64(s.rate))
+}
+
+// readFrames reads chunks of the given size from the server's sources
+// and returns the left channel of every frame along with any changes
+func readFrames(t *testing.T, s *Server, chunks, chunkFrames int) ([]int32, []*sourceChange) {
+	t.Helper()
+
+	s.sourceMu.Lock()
+	defer s.sourceMu.Unlock()
+
+	var frames []int32
+	var changes []*sourceChange
+	for i := 0; i < chunks; i++ {
+		samples := make([]int32, chunkFrames*2)
+		n, change, err := s.readSource(samples)
+		if err != nil {
+			t.Fatalf("readSource failed: %v", err)
+		}
+		for j := 0; j < n; j += 2 {
+			frames = append(frames, samples[j])
+		}
+		changes = append(changes, change)
+	}
+	return frames, changes
+}
+
+func TestServerGaplessQueue(t *testing.T) {
+	first := newRampSource("First", 0, 1, 1500, 48000)
+	second := newRampSource("Second", 100000, 1, 48000, 48000)
+
+	s, err := NewServer(ServerConfig{Source: first})
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	if err := s.Enqueue(second); err != nil {
+		t.Fatalf("Enqueue failed: %v", err)
+	}
+	if title, _, _ := s.NowPlaying(); title != "First" {
+		t.Errorf("expected First playing, got %q", title)
+	}
+
+	frames, changes := readFrames(t, s, 3, 960)
+	if len(frames) != 2880 {
+		t.Fatalf("expected 2880 frames, got %d", len(frames))
+	}
+
+	// The first source plays to its last frame and the second follows
+	// without a gap or a repeat
+	for i, v := range frames {
+		want := int32(i)
+		if i >= 1500 {
+			want = 100000 + int32(i-1500)
+		}
+		if v != want {
+			t.Fatalf("frame %d: expected %d, got %d", i, want, v)
+		}
+	}
+
+	if changes[0] != nil || changes[2] != nil {
+		t.Error("expected a change only in the second chunk")
+	}
+	if c := changes[1]; c == nil || c.offset != 540 || c.formatChanged || c.position != 0 {
+		t.Errorf("expected change at frame 540 of the second chunk, got %+v", c)
+	}
+	if !first.closed {
+		t.Error("expected finished source to be closed")
+	}
+	if s.audioSource != second || s.Queued() != 0 {
+		t.Error("expected queue to advance to the second source")
+	}
+	if title, _, _ := s.NowPlaying(); title != "Second" {
+		t.Errorf("expected Second playing, got %q", title)
+	}
+}
+
+func TestServerClearQueue(t *testing.T) {
+	first := newRampSource("First", 0, 1, 48000, 48000)
+	queued := newRampSource("Queued", 0, 1, 48000, 48000)
+
+	s, err := NewServer(ServerConfig{Source: first})
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	if err := s.Enqueue(queued); err != nil {
+		t.Fatalf("Enqueue failed: %v", err)
+	}
+
+	s.ClearQueue()
+	if s.Queued() != 0 {
+		t.Errorf("expected empty queue, got %d", s.Queued())
+	}
+	if !queued.closed || first.closed {
+		t.Error("expected only the queued source to be closed")
+	}
+}
+
+func TestServerCrossfade(t *testing.T) {
+	first := newRampSource("First", 3000000, 0, 1500, 48000)
+	second := newRampSource("Second", 1000000, 0, 48000, 48000)
+
+	// 10ms at 48kHz is 480 frames, so the fade covers frames 1020-1499
+	s, err := NewServer(ServerConfig{Source: first, Crossfade: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	s.Enqueue(second)
+
+	frames, changes := readFrames(t, s, 3, 960)
+
+	if c := changes[1]; c == nil || c.offset != 60 {
+		t.Fatalf("expected crossfade to start at frame 60 of the second chunk, got %+v", c)
+	}
+	for i, v := range frames {
+		var want float64
+		switch {
+		case i < 1020:
+			want = 3000000
+		case i < 1500:
+			theta := (float64(i-1020) + 0.5) / 480 * math.Pi / 2
+			want = 3000000*math.Cos(theta) + 1000000*math.Sin(theta)
+		default:
+			want = 1000000
+		}
+		// Gains are Q16 fixed point
+		if math.Abs(float64(v)-want) > 100 {
+			t.Fatalf("frame %d: expected %.0f, got %d", i, want, v)
+		}
+	}
+
+	if !first.closed || s.fade != nil {
+		t.Error("expected outgoing source closed after the fade")
+	}
+	// The incoming source played from its start during the fade
+	if second.pos != 2880-1020 {
+		t.Errorf("expected second source at frame %d, got %d", 2880-1020, second.pos)
+	}
+}
+
+func TestServerSetSourceFormatChange(t *testing.T) {
+	first := newRampSource("First", 0, 1, 48000, 48000)
+	second := newRampSource("Second", 0, 1, 44100, 44100)
+
+	s, err := NewServer(ServerConfig{Source: first, Crossfade: time.Second})
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+	if err := s.SetSource(nil); err == nil {
+		t.Error("expected error for nil source")
+	}
+	if err := s.Next(); err == nil {
+		t.Error("expected error with an empty queue")
+	}
+
+	readFrames(t, s, 1, 960)
+	s.SetSource(second)
+
+	// Formats differ, so there is no crossfade and the chunk stops at the change
+	frames, changes := readFrames(t, s, 1, 960)
+	if len(frames) != 0 {
+		t.Errorf("expected no frames before the format change, got %d", len(frames))
+	}
+	if c := changes[0]; c == nil || !c.formatChanged || c.offset != 0 {
+		t.Errorf("expected format change, got %+v", c)
+	}
+	if !first.closed || s.fade != nil || s.audioSource != second {
+		t.Error("expected a hard switch to the new source")
+	}
+}
+
+func TestCrossfadeMix(t *testing.T) {
+	// Equal power: gains follow a quarter circle
+	for _, pos := range []int{0, 100, 240, 479} {
+		out, in := equalPowerGains(pos, 480)
+		power := float64(out*out+in*in) / (65536 * 65536)
+		if math.Abs(power-1) > 1e-4 {
+			t.Errorf("pos %d: expected unit power, got %f", pos, power)
+		}
+	}
+	if out, in := equalPowerGains(0, 480); out < 65530 || in > 300 {
+		t.Errorf("expected fade to start with the outgoing source, got %d/%d", out, in)
+	}
+
+	// Loud correlated material is limited below full scale
+	out, in := equalPowerGains(240, 480)
+	for _, x := range []int32{audio.Max24Bit, audio.Min24Bit} {
+		y := mixSamples(x, x, out, in)
+		if y > audio.Max24Bit || y < -audio.Max24Bit {
+			t.Errorf("mix of %d exceeded full scale: %d", x, y)
+		}
+	}
+	if got := softLimit(1000000); got != 1000000 {
+		t.Errorf("expected quiet sample unchanged, got %d", got)
+	}
+	if a, b := softLimit(8000000), softLimit(9000000); a >= b || b > audio.Max24Bit {
+		t.Errorf("expected monotonic limiting below full scale, got %d, %d", a, b)
+	}
+	if softLimit(-9000000) != -softLimit(9000000) {
+		t.Error("expected symmetric limiting")
+	}
+}
+
+func TestNewServerCrossfade(t *testing.T) {
+	for _, d := range []time.Duration{-time.Second, MaxCrossfade + time.Millisecond} {
+		if _, err := NewServer(ServerConfig{Source: NewTestTone(48000, 2), Crossfade: d}); err == nil {
+			t.Errorf("expected error for crossfade %v", d)
+		}
+	}
+	if _, err := NewServer(ServerConfig{Source: NewTestTone(48000, 2), Crossfade: MaxCrossfade}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestServerSourceChangeRestartsStream(t *testing.T) {
+	server, err := NewServer(ServerConfig{
+		Port:   8938,
+		Name:   "Test Server",
+		Source: newRampSource("First", 0, 1, 48000, 48000),
+	})
+	if err != nil {
+		t.Fatalf("failed to create server: %v", err)
+	}
+
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- server.Start()
+	}()
+	time.Sleep(200 * time.Millisecond)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws://localhost:8938/sendspin", nil)
+	if err != nil {
+		t.Fatalf("failed to connect to server: %v", err)
+	}
+	defer conn.Close()
+
+	hello := protocol.Message{
+		Type: "client/hello",
+		Payload: protocol.ClientHello{
+			ClientID:       "queue-client",
+			Name:           "Queue Client",
+			Version:        1,
+			SupportedRoles: []string{"player", "controller"},
+		},
+	}
+	if err := conn.WriteJSON(hello); err != nil {
+		t.Fatalf("failed to send hello: %v", err)
+	}
+	readUntil(t, conn, "stream/start")
+	readUntil(t, conn, "stream/metadata")
+
+	// Same format: only metadata changes
+	server.Enqueue(newRampSource("Second", 0, 1, 48000, 48000))
+	next := protocol.Message{Type: "client/command", Payload: protocol.ClientCommand{Command: "next"}}
+	if err := conn.WriteJSON(next); err != nil {
+		t.Fatalf("failed to send next: %v", err)
+	}
+	decodeStream := func(msg protocol.Message, v interface{}) {
+		data, _ := json.Marshal(msg.Payload)
+		if err := json.Unmarshal(data, v); err != nil {
+			t.Fatalf("failed to unmarshal %s: %v", msg.Type, err)
+		}
+	}
+	var metadata protocol.StreamMetadata
+	decodeStream(readUntil(t, conn, "stream/metadata"), &metadata)
+	if metadata.Title != "Second" {
+		t.Errorf("expected metadata for the second source, got %+v", metadata)
+	}
+
+	// New format: players get a new stream/start
+	server.SetSource(newRampSource("Third", 0, 1, 44100, 44100))
+	var start protocol.StreamStart
+	decodeStream(readUntil(t, conn, "stream/start"), &start)
+	if start.Player == nil || start.Player.SampleRate != 44100 {
+		t.Errorf("expected stream/start at 44100Hz, got %+v", start.Player)
+	}
+	decodeStream(readUntil(t, conn, "stream/metadata"), &metadata)
+	if metadata.Title != "Third" {
+		t.Errorf("expected metadata for the third source, got %+v", metadata)
+	}
+
+	conn.Close()
+	time.Sleep(100 * time.Millisecond)
+
+	server.Stop()
+	select {
+	case <-errChan:
+	case <-time.After(5 * time.Second):
+		t.Error("server did not stop within timeout")
+	}
+}
@@ -0,0 +1,297 @@
+// ABOUTME: WAV file audio source with sample-accurate seeking
+// ABOUTME: Parses RIFF/WAVE headers and converts 16/24/32-bit PCM to 24-bit range
+package sendspin
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Sendspin/sendspin-go/pkg/audio"
+	"github.com/Sendspin/sendspin-go/pkg/audio/loudness"
+)
+
+const (
+	wavFormatPCM        = 1
+	wavFormatExtensible = 0xFFFE
+)
+
+// wavChannelMasks are the WAVE_FORMAT_EXTENSIBLE speaker masks of the
+// default layout for each channel count (see audio.LayoutFor)
+var wavChannelMasks = [audio.MaxChannels + 1]uint32{
+	1: 0x4,   // FC
+	2: 0x3,   // FL FR
+	3: 0x7,   // FL FR FC
+	4: 0x33,  // FL FR BL BR
+	5: 0x37,  // FL FR FC BL BR
+	6: 0x3F,  // FL FR FC LFE BL BR
+	7: 0x70F, // FL FR FC LFE BC SL SR
+	8: 0x63F, // FL FR FC LFE BL BR SL SR
+}
+
+// WAVSource reads from an uncompressed PCM WAV file
+type WAVSource struct {
+	file         *os.File
+	path         string
+	sampleRate   int
+	channels     int
+	bitDepth     int
+	channelMask  uint32 // WAVE_FORMAT_EXTENSIBLE speaker mask, 0 if absent
+	blockAlign   int    // bytes per PCM frame (all channels)
+	dataStart    int64  // file offset of the first sample
+	totalSamples int64  // PCM frames in the data chunk
+	position     int64  // PCM frames delivered since the start of the track
+	title        string
+	artist       string
+	album        string
+	replayGain   *loudness.Info // From an ID3 chunk, nil if untagged
+	readBuf      []byte
+}
+
+// NewWAVSource creates a new WAV audio source
+func NewWAVSource(filePath string) (*WAVSource, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open WAV file: %w", err)
+	}
+
+	s := &WAVSource{
+		file:   f,
+		path:   filePath,
+		artist: "Unknown Artist",
+		album:  "Unknown Album",
+	}
+
+	if err := s.parseHeader(); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to decode WAV: %w", err)
+	}
+
+	if _, err := f.Seek(s.dataStart, io.SeekStart); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to seek to WAV data: %w", err)
+	}
+	s.replayGain = replayGainFromTags(readWAVTags(f))
+
+	// Extract filename as title
+	filename := filepath.Base(filePath)
+	s.title = strings.TrimSuffix(filename, filepath.Ext(filename))
+
+	log.Printf("Loaded WAV: %s (sample rate: %d Hz, channels: %d, bit depth: %d)",
+		s.title, s.sampleRate, s.channels, s.bitDepth)
+
+	return s, nil
+}
+
+// parseHeader walks the RIFF chunks to find "fmt " and "data"
+func (s *WAVSource) parseHeader() error {
+	var riff [12]byte
+	if _, err := io.ReadFull(s.file, riff[:]); err != nil {
+		return err
+	}
+	if string(riff[0:4]) != "RIFF" || string(riff[8:12]) != "WAVE" {
+		return fmt.Errorf("not a RIFF/WAVE file")
+	}
+
+	haveFmt := false
+	offset := int64(12)
+	for {
+		var hdr [8]byte
+		if _, err := s.file.ReadAt(hdr[:], offset); err != nil {
+			if err == io.EOF {
+				return fmt.Errorf("missing data chunk")
+			}
+			return err
+		}
+		id := string(hdr[0:4])
+		size := int64(binary.LittleEndian.Uint32(hdr[4:8]))
+		body := offset + 8
+
+		switch id {
+		case "fmt ":
+			if size < 16 {
+				return fmt.Errorf("fmt chunk too short")
+			}
+			fmtBuf := make([]byte, 16)
+			if _, err := s.file.ReadAt(fmtBuf, body); err != nil {
+				return err
+			}
+			format := binary.LittleEndian.Uint16(fmtBuf[0:2])
+			if format != wavFormatPCM && format != wavFormatExtensible {
+				return fmt.Errorf("unsupported WAV format %d (only PCM)", format)
+			}
+			s.channels = int(binary.LittleEndian.Uint16(fmtBuf[2:4]))
+			s.sampleRate = int(binary.LittleEndian.Uint32(fmtBuf[4:8]))
+			s.blockAlign = int(binary.LittleEndian.Uint16(fmtBuf[12:14]))
+			s.bitDepth = int(binary.LittleEndian.Uint16(fmtBuf[14:16]))
+			if format == wavFormatExtensible {
+				if err := s.parseExtensible(body, size); err != nil {
+					return err
+				}
+			}
+			haveFmt = true
+
+		case "data":
+			if !haveFmt {
+				return fmt.Errorf("data chunk before fmt chunk")
+			}
+			switch s.bitDepth {
+			case 16, 24, 32:
+			default:
+				return fmt.Errorf("unsupported bit depth %d", s.bitDepth)
+			}
+			if s.channels > audio.MaxChannels {
+				return fmt.Errorf("unsupported channel count %d (at most %d)", s.channels, audio.MaxChannels)
+			}
+			if s.channels < 1 || s.blockAlign != s.channels*s.bitDepth/8 {
+				return fmt.Errorf("invalid block alignment %d for %d channels", s.blockAlign, s.channels)
+			}
+			s.dataStart = body
+			s.totalSamples = size / int64(s.blockAlign)
+			return nil
+		}
+
+		// Chunks are padded to an even size
+		offset = body + size + size%2
+	}
+}
+
+// parseExtensible reads the WAVE_FORMAT_EXTENSIBLE fields of a fmt chunk.
+// Channels are always read in WAVE order; a speaker mask other than the
+// default layout's is logged, since players will treat it as the default.
+func (s *WAVSource) parseExtensible(body, size int64) error {
+	if size < 40 {
+		return fmt.Errorf("extensible fmt chunk too short")
+	}
+	ext := make([]byte, 24)
+	if _, err := s.file.ReadAt(ext, body+16); err != nil {
+		return err
+	}
+	// The sub-format GUID starts with the format code
+	if subFormat := binary.LittleEndian.Uint16(ext[8:10]); subFormat != wavFormatPCM {
+		return fmt.Errorf("unsupported WAV sub-format %d (only PCM)", subFormat)
+	}
+	s.channelMask = binary.LittleEndian.Uint32(ext[4:8])
+	if s.channels >= 1 && s.channels <= audio.MaxChannels && s.channelMask != 0 && s.channelMask != wavChannelMasks[s.channels] {
+		log.Printf("WAV speaker mask 0x%X is not the default for %d channels, playing as %s",
+			s.channelMask, s.channels, audio.LayoutName(s.channels))
+	}
+	return nil
+}
+
+func (s *WAVSource) Read(samples []int32) (int, error) {
+	frames := len(samples) / s.channels
+	samplesRead := 0
+
+	for frames > 0 {
+		remaining := s.totalSamples - s.position
+		if remaining <= 0 {
+			// Loop the audio - seek back to start
+			if err := s.Seek(0); err != nil {
+				return samplesRead, fmt.Errorf("failed to seek to start: %w", err)
+			}
+			remaining = s.totalSamples
+			if remaining == 0 {
+				break
+			}
+		}
+
+		n := int64(frames)
+		if n > remaining {
+			n = remaining
+		}
+
+		size := int(n) * s.blockAlign
+		if cap(s.readBuf) < size {
+			s.readBuf = make([]byte, size)
+		}
+		buf := s.readBuf[:size]
+		read, err := io.ReadFull(s.file, buf)
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return samplesRead, err
+		}
+		n = int64(read / s.blockAlign)
+		if n == 0 {
+			// Truncated data chunk; treat as end of track
+			s.totalSamples = s.position
+			continue
+		}
+
+		s.decode(buf[:int(n)*s.blockAlign], samples[samplesRead:])
+		samplesRead += int(n) * s.channels
+		s.position += n
+		frames -= int(n)
+	}
+
+	return samplesRead, nil
+}
+
+// decode converts little-endian PCM bytes into int32 samples in 24-bit range
+func (s *WAVSource) decode(buf []byte, out []int32) {
+	switch s.bitDepth {
+	case 16:
+		for i := 0; i+1 < len(buf); i += 2 {
+			out[i/2] = int32(int16(binary.LittleEndian.Uint16(buf[i:]))) << 8
+		}
+	case 24:
+		for i := 0; i+2 < len(buf); i += 3 {
+			v := int32(buf[i]) | int32(buf[i+1])<<8 | int32(buf[i+2])<<16
+			out[i/3] = (v << 8) >> 8 // sign-extend
+		}
+	case 32:
+		for i := 0; i+3 < len(buf); i += 4 {
+			out[i/4] = int32(binary.LittleEndian.Uint32(buf[i:])) >> 8
+		}
+	}
+}
+
+// Seek moves playback to the given position in the track
+func (s *WAVSource) Seek(position time.Duration) error {
+	target := durationToSamples(position, s.sampleRate)
+	if target < 0 {
+		target = 0
+	}
+	if target > s.totalSamples {
+		target = s.totalSamples
+	}
+
+	if _, err := s.file.Seek(s.dataStart+target*int64(s.blockAlign), io.SeekStart); err != nil {
+		return fmt.Errorf("failed to seek WAV file: %w", err)
+	}
+	s.position = target
+	return nil
+}
+
+// Position returns the current playback position in the track
+func (s *WAVSource) Position() time.Duration {
+	return samplesToDuration(s.position, s.sampleRate)
+}
+
+// Duration returns the track length
+func (s *WAVSource) Duration() time.Duration {
+	return samplesToDuration(s.totalSamples, s.sampleRate)
+}
+
+func (s *WAVSource) SampleRate() int { return s.sampleRate }
+func (s *WAVSource) Channels() int   { return s.channels }
+func (s *WAVSource) Metadata() (string, string, string) {
+	return s.title, s.artist, s.album
+}
+func (s *WAVSource) Path() string { return s.path }
+
+// Loudness returns the ReplayGain values from the file's ID3 chunk
+func (s *WAVSource) Loudness() (loudness.Info, bool) {
+	if s.replayGain == nil {
+		return loudness.Info{}, false
+	}
+	return *s.replayGain, true
+}
+
+func (s *WAVSource) Close() error {
+	return s.file.Close()
+}